@@ -17,6 +17,9 @@
 //	serve    Start the proxy server (default if no command given)
 //	stats    Show cache statistics
 //	mirror   Pre-populate cache from PURLs, SBOMs, or registries
+//	doctor   Check config, database, storage, and upstream connectivity
+//	vacuum   Reclaim free space in the SQLite database
+//	config   Print the effective configuration (config print)
 //
 // Serve Flags:
 //
@@ -56,6 +59,23 @@
 //	-recent int
 //	      Show N recently cached packages (default 10)
 //
+// Doctor Flags:
+//
+//	-config string
+//	      Path to configuration file (YAML or JSON)
+//	-skip-upstreams
+//	      Don't ping upstream registries
+//
+// Doctor also accepts the storage and database flags from serve.
+//
+// Config Print Flags:
+//
+//	-format string
+//	      Output format: yaml or json (default "yaml")
+//
+// Config print also accepts every serve flag, so it shows the configuration
+// serve would run with. Passwords and tokens are redacted.
+//
 // Global Flags:
 //
 //	-version
@@ -64,22 +84,91 @@
 // Environment Variables:
 //
 //	PROXY_LISTEN           - Listen address
-//	PROXY_BASE_URL         - Public URL
+//	PROXY_BASE_URL         - Public URL, or "auto"
+//	PROXY_H2C              - Accept HTTP/2 over cleartext (true/false)
+//	PROXY_TLS_CERT_FILE    - TLS certificate chain (PEM)
+//	PROXY_TLS_KEY_FILE     - TLS private key (PEM)
+//	PROXY_TLS_CLIENT_CA_FILE - CA bundle for verifying client certificates (PEM)
+//	PROXY_TRUSTED_PROXIES  - Proxies whose X-Forwarded-* headers are trusted (comma-separated)
 //	PROXY_STORAGE_URL      - Storage URL (file:// or s3://)
 //	PROXY_STORAGE_PATH     - Storage directory (deprecated)
+//	PROXY_STORAGE_PREFIX   - Key prefix for sharing a bucket between instances
+//	PROXY_STORAGE_SCRUB_INTERVAL - How often to re-hash a sample of cached artifacts (default "0", disabled)
+//	PROXY_STORAGE_SCRUB_SAMPLE_SIZE - Artifacts re-hashed per scrub (default 10)
+//	PROXY_STORAGE_IDENTITY_CHECK - On a database/storage mismatch at startup: off, warn or fail (default "warn")
 //	PROXY_DATABASE_DRIVER  - Database driver (sqlite or postgres)
 //	PROXY_DATABASE_PATH    - SQLite database file path
 //	PROXY_DATABASE_URL     - PostgreSQL connection URL
+//	PROXY_DATABASE_BUSY_TIMEOUT - SQLite lock wait before failing (default "5s")
+//	PROXY_DATABASE_VACUUM_INTERVAL - How often to reclaim SQLite free space (default "0", disabled)
+//	PROXY_DATABASE_FAIL_CLOSED - Answer 503 when a download can't be recorded (default false)
+//	PROXY_QUARANTINE_DEFAULT - Refuse downloads of versions published more recently than this (default "0", disabled)
+//	PROXY_QUARANTINE_FAIL_OPEN - Serve versions whose publish time can't be found (default false)
 //	PROXY_LOG_LEVEL        - Log level
 //	PROXY_LOG_FORMAT       - Log format
+//	PROXY_LOG_CACHE_FIELDS - Log ecosystem, package, version and cache status per request (default false)
 //	PROXY_UPSTREAM_MAVEN   - Maven repository upstream URL
 //	PROXY_UPSTREAM_GRADLE_PLUGIN_PORTAL - Gradle Plugin Portal upstream URL
+//	PROXY_UPSTREAM_MAX_CONCURRENT_FETCHES    - Max simultaneous upstream downloads per ecosystem
+//	PROXY_UPSTREAM_FETCH_QUEUE_TIMEOUT       - How long a download waits for a slot (default "30s")
+//	PROXY_UPSTREAM_FETCH_TIMEOUT             - Deadline for a single upstream download (default none)
+//	PROXY_UPSTREAM_RESPONSE_HEADERS          - Extra upstream response headers to forward (comma-separated)
+//	PROXY_UPSTREAM_SKIP_CONTENT_CHECK        - Cache binary artifacts even when they look like error pages
+//	PROXY_UPSTREAM_NORMALIZE_URLS            - Canonicalize upstream URLs recorded against artifacts
+//	PROXY_UPSTREAM_MIN_TLS_VERSION           - Lowest TLS version accepted from upstreams (default "1.2")
+//	PROXY_UPSTREAM_TLS_CIPHER_SUITES         - TLS 1.2 cipher suites offered to upstreams (comma-separated)
 //	PROXY_GRADLE_BUILD_CACHE_READ_ONLY       - Disable Gradle PUT uploads
 //	PROXY_GRADLE_BUILD_CACHE_MAX_UPLOAD_SIZE - Max Gradle PUT request body size
 //	PROXY_GRADLE_BUILD_CACHE_MAX_AGE         - Gradle cache max age eviction
 //	PROXY_GRADLE_BUILD_CACHE_MAX_SIZE        - Gradle cache max total size
 //	PROXY_GRADLE_BUILD_CACHE_SWEEP_INTERVAL  - Gradle cache eviction sweep interval
 //	PROXY_HEALTH_STORAGE_PROBE_INTERVAL      - Storage health probe cache interval (default "30s")
+//	PROXY_USAGE_ENABLED                      - Record artifact downloads per team (true/false)
+//	PROXY_USAGE_TEAM_HEADER                  - Request header naming the team (default "X-Team")
+//	PROXY_USAGE_CLIENT_CERT_TEAM             - Fall back to the client certificate CN (true/false)
+//	PROXY_USAGE_MAX_ROWS                     - Access log rows kept (default 1000000)
+//	PROXY_HIT_TIMELINE_ENABLED               - Record the time of every cache hit (true/false)
+//	PROXY_HIT_TIMELINE_RETENTION             - Individual hits kept before daily rollup (default 168h)
+//	PROXY_HIT_TIMELINE_DAILY_RETENTION       - Daily hit totals kept (default 8760h)
+//	PROXY_ENRICHMENT_OFFLINE                 - Disable background upstream metadata lookups
+//	PROXY_ENRICHMENT_BACKFILL_INTERVAL       - latest_version backfill interval (default "1h")
+//	PROXY_ENRICHMENT_BACKFILL_BATCH_SIZE     - Packages resolved per backfill run (default 50)
+//	PROXY_ENRICHMENT_BACKFILL_DELAY          - Pause between backfill lookups (default "1s")
+//	PROXY_ENRICHMENT_VULN_SOURCES            - Vulnerability sources, comma-separated (default "osv")
+//	PROXY_ENRICHMENT_GHSA_TOKEN              - GitHub token for the ghsa vulnerability source
+//	PROXY_API_ENABLED                        - Serve the JSON /api endpoints (default true)
+//	PROXY_DASHBOARD_ENABLED                  - Serve the web UI under /ui (default true)
+//	PROXY_HTTP_COMPRESSION_ENABLED           - Gzip dashboard and API responses (default true)
+//	PROXY_HTTP_COMPRESSION_MIN_SIZE          - Smallest response that is compressed (default "1KB")
+//	PROXY_API_MAX_BODY_SIZE                  - Largest POST /api request body (default "1MB")
+//	PROXY_API_MAX_ITEMS                      - Most packages or PURLs per POST /api request (default 500)
+//	PROXY_API_REQUEST_TIMEOUT                - Time limit for /api/outdated and /api/bulk (default "30s")
+//	PROXY_API_DEFAULT_PAGE_SIZE              - Results per page for package lists and search (default 50)
+//	PROXY_API_MAX_PAGE_SIZE                  - Largest per_page honoured (default 200)
+//	PROXY_API_POLICY_EVENTS_MAX              - Policy events kept (default 10000)
+//	PROXY_CONTAINER_PREFETCH_INDEX           - Cache all platforms of pulled image indexes
+//	PROXY_NPM_PUBLISH                        - Accept npm publish and deprecate for local packages (default false)
+//	PROXY_NPM_PUBLISH_TOKEN                  - Bearer token required to publish to npm (required with PROXY_NPM_PUBLISH)
+//	PROXY_NPM_LOCAL_NAMES                    - npm names and scopes publishable without an upstream check (comma-separated)
+//	PROXY_NPM_MAX_PUBLISH_SIZE               - Max size of an npm publish request (default "100MB")
+//	PROXY_NPM_UNPUBLISH                      - Accept npm unpublish for local packages (default false)
+//	PROXY_CARGO_INDEX_TTL                    - Cache cargo sparse index files for this long (default off)
+//	PROXY_GEM_SPECS_TTL                      - Cache gem specs.4.8.gz indexes for this long (default "5m")
+//	PROXY_GO_LIST_TTL                        - Cache Go @v/list responses for this long (default "1m")
+//	PROXY_CONDA_CHANNELS                     - Conda channels to proxy, comma-separated (default all)
+//	PROXY_CONDA_DEFAULT_CHANNEL              - Channel for requests without one in the path
+//	PROXY_DEBIAN_SUITES                      - Debian suites to proxy, comma-separated (default all)
+//	PROXY_DEBIAN_DEFAULT_SUITE               - Suite served for dists/default/ requests
+//	PROXY_CACHE_INDEX_ONLY                   - Ecosystems whose artifacts redirect upstream uncached
+//	PROXY_DEBUG_ALLOW_UPSTREAM_OVERRIDE      - Honour the X-Proxy-Upstream request header
+//	PROXY_DEBUG_UPSTREAM_OVERRIDE_HOSTS      - Hosts X-Proxy-Upstream may point at
+//	PROXY_DEBUG_CACHE_TRACE                  - Add X-Cache-Lookup to artifact responses
+//	PROXY_DEBUG_ALLOW_CACHE_REFRESH          - Honour X-Proxy-Refresh and Cache-Control: no-cache
+//	PROXY_DEBUG_CACHE_REFRESH_ECOSYSTEMS     - Ecosystems that may be refreshed (default all)
+//	PROXY_DEBUG_CACHE_REFRESH_TOKEN          - Token required in X-Proxy-Refresh-Token
+//	PROXY_DEBUG_ENABLED                      - Serve /api/debug/upstream and /api/inflight
+//	PROXY_DEBUG_TOKEN                        - Bearer token the debug endpoints require
+//	PROXY_ADMIN_TOKEN                        - Bearer token the operator endpoints require
 //
 // Example:
 //
@@ -94,29 +183,49 @@
 //
 //	# Show stats as JSON
 //	proxy stats -json
+//
+//	# Show what was requested and cached in the last day
+//	proxy stats -since 24h
+//
+//	# Check a config before deploying it
+//	proxy doctor -config config.yaml
+//
+//	# Show the configuration serve would use, with secrets redacted
+//	proxy config print -config config.yaml
 package main
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/git-pkgs/proxy/internal/config"
 	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/doctor"
 	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/proxy/internal/metrics"
 	"github.com/git-pkgs/proxy/internal/mirror"
 	"github.com/git-pkgs/proxy/internal/server"
 	"github.com/git-pkgs/proxy/internal/storage"
 	"github.com/git-pkgs/registries/fetch"
 )
 
-const defaultTopN = 10
+const (
+	defaultTopN = 10
+
+	// vacuumBusyTimeout is how long proxy vacuum waits for a running server
+	// to release the database before giving up.
+	vacuumBusyTimeout = time.Minute
+)
 
 var (
 	// Version is set at build time.
@@ -141,6 +250,18 @@ func main() {
 			os.Args = append(os.Args[:1], os.Args[2:]...)
 			runMirror()
 			return
+		case "doctor":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			runDoctor()
+			return
+		case "vacuum":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			runVacuum()
+			return
+		case "config":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			runConfig()
+			return
 		case "-version", "--version":
 			fmt.Printf("proxy %s (%s)\n", Version, Commit)
 			os.Exit(0)
@@ -163,6 +284,9 @@ Commands:
   serve    Start the proxy server (default)
   stats    Show cache statistics
   mirror   Pre-populate cache from PURLs, SBOMs, or registries
+  doctor   Check config, database, storage, and upstream connectivity
+  vacuum   Reclaim free space in the SQLite database
+  config   Print the effective configuration (config print)
 
 Run 'proxy <command> -help' for more information on a command.
 
@@ -174,16 +298,7 @@ Global Flags:
 
 func runServe() {
 	fs := flag.NewFlagSet("serve", flag.ExitOnError)
-	configPath := fs.String("config", "", "Path to configuration file (YAML or JSON)")
-	listen := fs.String("listen", "", "Address to listen on")
-	baseURL := fs.String("base-url", "", "Public URL of this proxy")
-	storageURL := fs.String("storage-url", "", "Storage URL (file:// or s3://)")
-	storagePath := fs.String("storage-path", "", "Path to artifact storage directory (deprecated, use -storage-url)")
-	databaseDriver := fs.String("database-driver", "", "Database driver: sqlite or postgres")
-	databasePath := fs.String("database-path", "", "Path to SQLite database file")
-	databaseURL := fs.String("database-url", "", "PostgreSQL connection URL")
-	logLevel := fs.String("log-level", "", "Log level: debug, info, warn, error")
-	logFormat := fs.String("log-format", "", "Log format: text, json")
+	flags := registerServeFlags(fs)
 	version := fs.Bool("version", false, "Print version and exit")
 
 	fs.Usage = func() {
@@ -193,22 +308,91 @@ func runServe() {
 		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nEnvironment Variables:\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_LISTEN           Listen address\n")
-		fmt.Fprintf(os.Stderr, "  PROXY_BASE_URL         Public URL\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_BASE_URL         Public URL, or \"auto\"\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_H2C              Accept HTTP/2 over cleartext\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_TLS_CERT_FILE    TLS certificate chain (PEM)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_TLS_KEY_FILE     TLS private key (PEM)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_TLS_CLIENT_CA_FILE CA bundle for verifying client certificates\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_TRUSTED_PROXIES  Proxies whose X-Forwarded-* headers are trusted\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_STORAGE_URL      Storage URL (file:// or s3://)\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_STORAGE_PATH     Storage directory (deprecated)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_STORAGE_PREFIX   Key prefix for sharing a bucket between instances\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_STORAGE_SCRUB_INTERVAL How often to re-hash a sample of cached artifacts\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_STORAGE_SCRUB_SAMPLE_SIZE Artifacts re-hashed per scrub\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_STORAGE_IDENTITY_CHECK On a database/storage mismatch at startup: off, warn or fail\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_DATABASE_DRIVER  Database driver (sqlite or postgres)\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_DATABASE_PATH    SQLite database file\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_DATABASE_URL     PostgreSQL connection URL\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DATABASE_BUSY_TIMEOUT SQLite lock wait before failing\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DATABASE_VACUUM_INTERVAL How often to reclaim SQLite free space\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DATABASE_FAIL_CLOSED Answer 503 when a download can't be recorded\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_QUARANTINE_DEFAULT Refuse downloads of versions published more recently than this\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_QUARANTINE_FAIL_OPEN Serve versions whose publish time can't be found\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_LOG_LEVEL        Log level\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_LOG_FORMAT       Log format\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_LOG_CACHE_FIELDS Log ecosystem, package, version and cache status per request\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_MAVEN   Maven repository upstream URL\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_GRADLE_PLUGIN_PORTAL Gradle Plugin Portal upstream URL\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_MAX_CONCURRENT_FETCHES    Max simultaneous upstream downloads per ecosystem\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_FETCH_QUEUE_TIMEOUT       How long a download waits for a slot\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_FETCH_TIMEOUT             Deadline for a single upstream download\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_RESPONSE_HEADERS          Extra upstream response headers to forward\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_SKIP_CONTENT_CHECK        Cache binary artifacts even when they look like error pages\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_NORMALIZE_URLS            Canonicalize upstream URLs recorded against artifacts\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_MIN_TLS_VERSION           Lowest TLS version accepted from upstreams\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_UPSTREAM_TLS_CIPHER_SUITES         TLS 1.2 cipher suites offered to upstreams\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_GRADLE_BUILD_CACHE_READ_ONLY       Disable Gradle PUT uploads\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_GRADLE_BUILD_CACHE_MAX_UPLOAD_SIZE Max Gradle PUT request body size\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_GRADLE_BUILD_CACHE_MAX_AGE         Gradle cache max age eviction\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_GRADLE_BUILD_CACHE_MAX_SIZE        Gradle cache max total size\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_GRADLE_BUILD_CACHE_SWEEP_INTERVAL  Gradle cache eviction sweep interval\n")
 		fmt.Fprintf(os.Stderr, "  PROXY_HEALTH_STORAGE_PROBE_INTERVAL      Storage health probe cache interval\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_USAGE_ENABLED                      Record artifact downloads per team\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_USAGE_TEAM_HEADER                  Request header naming the team\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_USAGE_CLIENT_CERT_TEAM             Fall back to the client certificate CN\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_USAGE_MAX_ROWS                     Access log rows kept\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_HIT_TIMELINE_ENABLED               Record the time of every cache hit\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_HIT_TIMELINE_RETENTION             Individual hits kept before daily rollup\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_HIT_TIMELINE_DAILY_RETENTION       Daily hit totals kept\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ENRICHMENT_OFFLINE                 Disable background upstream metadata lookups\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ENRICHMENT_BACKFILL_INTERVAL       latest_version backfill interval\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ENRICHMENT_BACKFILL_BATCH_SIZE     Packages resolved per backfill run\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ENRICHMENT_BACKFILL_DELAY          Pause between backfill lookups\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ENRICHMENT_VULN_SOURCES            Vulnerability sources (osv, ghsa)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ENRICHMENT_GHSA_TOKEN              GitHub token for the ghsa source\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_ENABLED                        Serve the JSON /api endpoints (default true)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DASHBOARD_ENABLED                  Serve the web UI under /ui (default true)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_HTTP_COMPRESSION_ENABLED           Gzip dashboard and API responses (default true)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_HTTP_COMPRESSION_MIN_SIZE          Smallest response that is compressed (default 1KB)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_MAX_BODY_SIZE                  Largest POST /api request body\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_MAX_ITEMS                      Most packages or PURLs per POST /api request\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_REQUEST_TIMEOUT                Time limit for /api/outdated and /api/bulk\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_DEFAULT_PAGE_SIZE              Results per page for package lists and search\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_MAX_PAGE_SIZE                  Largest per_page honoured\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_API_POLICY_EVENTS_MAX              Policy events kept\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_CONTAINER_PREFETCH_INDEX           Cache all platforms of pulled image indexes\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_NPM_PUBLISH                        Accept npm publish and deprecate for local packages (default false)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_NPM_PUBLISH_TOKEN                  Bearer token required to publish to npm (required with PROXY_NPM_PUBLISH)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_NPM_LOCAL_NAMES                    npm names and scopes publishable without an upstream check (comma-separated)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_NPM_MAX_PUBLISH_SIZE               Max size of an npm publish request (default 100MB)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_NPM_UNPUBLISH                      Accept npm unpublish for local packages (default false)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_CARGO_INDEX_TTL                    Cache cargo sparse index files for this long (default off)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_GEM_SPECS_TTL                      Cache gem specs.4.8.gz indexes for this long (default 5m)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_GO_LIST_TTL                        Cache Go @v/list responses for this long (default 1m)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_CONDA_CHANNELS                     Conda channels to proxy (default all)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_CONDA_DEFAULT_CHANNEL              Channel for requests without one in the path\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBIAN_SUITES                      Debian suites to proxy (default all)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBIAN_DEFAULT_SUITE               Suite served for dists/default/ requests\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_CACHE_INDEX_ONLY                   Ecosystems whose artifacts redirect upstream uncached\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_ALLOW_UPSTREAM_OVERRIDE      Honour the X-Proxy-Upstream request header\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_UPSTREAM_OVERRIDE_HOSTS      Hosts X-Proxy-Upstream may point at\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_CACHE_TRACE                  Add X-Cache-Lookup to artifact responses\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_ALLOW_CACHE_REFRESH          Honour X-Proxy-Refresh and Cache-Control: no-cache\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_CACHE_REFRESH_ECOSYSTEMS     Ecosystems that may be refreshed (default all)\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_CACHE_REFRESH_TOKEN          Token required in X-Proxy-Refresh-Token\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_ENABLED                      Serve /api/debug/upstream and /api/inflight\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_DEBUG_TOKEN                        Bearer token the debug endpoints require\n")
+		fmt.Fprintf(os.Stderr, "  PROXY_ADMIN_TOKEN                        Bearer token the operator endpoints require\n")
 	}
 
 	_ = fs.Parse(os.Args[1:])
@@ -218,45 +402,12 @@ func runServe() {
 		os.Exit(0)
 	}
 
-	// Load configuration
-	cfg, err := loadConfig(*configPath)
+	cfg, err := flags.load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Apply environment variables
-	cfg.LoadFromEnv()
-
-	// Apply command line flags (highest priority)
-	if *listen != "" {
-		cfg.Listen = *listen
-	}
-	if *baseURL != "" {
-		cfg.BaseURL = *baseURL
-	}
-	if *storageURL != "" {
-		cfg.Storage.URL = *storageURL
-	}
-	if *storagePath != "" {
-		cfg.Storage.Path = *storagePath //nolint:staticcheck // backwards compat
-	}
-	if *databaseDriver != "" {
-		cfg.Database.Driver = *databaseDriver
-	}
-	if *databasePath != "" {
-		cfg.Database.Path = *databasePath
-	}
-	if *databaseURL != "" {
-		cfg.Database.URL = *databaseURL
-	}
-	if *logLevel != "" {
-		cfg.Log.Level = *logLevel
-	}
-	if *logFormat != "" {
-		cfg.Log.Format = *logFormat
-	}
-
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
@@ -266,6 +417,8 @@ func runServe() {
 	// Setup logger
 	logger := setupLogger(cfg.Log.Level, cfg.Log.Format)
 
+	metrics.SetBuildInfo(Version, Commit)
+
 	// Create and start server
 	srv, err := server.New(cfg, logger)
 	if err != nil {
@@ -306,6 +459,131 @@ func runServe() {
 	}
 }
 
+// serveFlags holds the config overrides serve accepts on the command line.
+// config print takes the same flags so it shows exactly what serve would
+// run with.
+type serveFlags struct {
+	configPath     *string
+	listen         *string
+	baseURL        *string
+	storageURL     *string
+	storagePath    *string
+	databaseDriver *string
+	databasePath   *string
+	databaseURL    *string
+	logLevel       *string
+	logFormat      *string
+
+	allowStorageChange *bool
+}
+
+func registerServeFlags(fs *flag.FlagSet) *serveFlags {
+	return &serveFlags{
+		configPath:     fs.String("config", "", "Path to configuration file (YAML or JSON)"),
+		listen:         fs.String("listen", "", "Address to listen on"),
+		baseURL:        fs.String("base-url", "", "Public URL of this proxy, or \"auto\" to derive it from each request"),
+		storageURL:     fs.String("storage-url", "", "Storage URL (file:// or s3://)"),
+		storagePath:    fs.String("storage-path", "", "Path to artifact storage directory (deprecated, use -storage-url)"),
+		databaseDriver: fs.String("database-driver", "", "Database driver: sqlite or postgres"),
+		databasePath:   fs.String("database-path", "", "Path to SQLite database file"),
+		databaseURL:    fs.String("database-url", "", "PostgreSQL connection URL"),
+		logLevel:       fs.String("log-level", "", "Log level: debug, info, warn, error"),
+		logFormat:      fs.String("log-format", "", "Log format: text, json"),
+
+		allowStorageChange: fs.Bool("allow-storage-change", false, "Accept that storage or the database moved since the last start and record the new pairing"),
+	}
+}
+
+// load reads the config file, then applies environment variables and
+// command line flags, each overriding the one before.
+func (f *serveFlags) load() (*config.Config, error) {
+	cfg, err := loadConfig(*f.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.LoadFromEnv()
+
+	if *f.listen != "" {
+		cfg.Listen = *f.listen
+	}
+	if *f.baseURL != "" {
+		cfg.BaseURL = *f.baseURL
+	}
+	if *f.storageURL != "" {
+		cfg.Storage.URL = *f.storageURL
+	}
+	if *f.storagePath != "" {
+		cfg.Storage.Path = *f.storagePath //nolint:staticcheck // backwards compat
+	}
+	if *f.databaseDriver != "" {
+		cfg.Database.Driver = *f.databaseDriver
+	}
+	if *f.databasePath != "" {
+		cfg.Database.Path = *f.databasePath
+	}
+	if *f.databaseURL != "" {
+		cfg.Database.URL = *f.databaseURL
+	}
+	if *f.logLevel != "" {
+		cfg.Log.Level = *f.logLevel
+	}
+	if *f.logFormat != "" {
+		cfg.Log.Format = *f.logFormat
+	}
+	cfg.Storage.AllowChange = *f.allowStorageChange
+	return cfg, nil
+}
+
+func runConfig() {
+	if len(os.Args) < 2 || os.Args[1] != "print" {
+		fmt.Fprintf(os.Stderr, "Usage: proxy config print [flags]\n")
+		os.Exit(2) //nolint:mnd // usage error
+	}
+	if err := printConfig(os.Stdout, os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printConfig writes the configuration serve would run with, given the
+// same flags and environment, with secrets redacted.
+func printConfig(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags := registerServeFlags(fs)
+	format := fs.String("format", "yaml", "Output format: yaml or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "git-pkgs proxy - Print the effective configuration\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: proxy config print [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Loads the config file, applies PROXY_* environment variables and\n")
+		fmt.Fprintf(os.Stderr, "flags the same way serve does, validates the result, and prints it\n")
+		fmt.Fprintf(os.Stderr, "with passwords and tokens redacted.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	out, err := cfg.Redacted().Marshal(*format)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
 func runStats() {
 	fs := flag.NewFlagSet("stats", flag.ExitOnError)
 	databaseDriver := fs.String("database-driver", "sqlite", "Database driver: sqlite or postgres")
@@ -314,6 +592,7 @@ func runStats() {
 	asJSON := fs.Bool("json", false, "Output as JSON")
 	popular := fs.Int("popular", defaultTopN, "Show top N most popular packages")
 	recent := fs.Int("recent", defaultTopN, "Show N recently cached packages")
+	since := fs.Duration("since", 0, "Also report artifacts accessed and cached within this window (e.g. 24h)")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "git-pkgs proxy - Show cache statistics\n\n")
@@ -360,12 +639,114 @@ func runStats() {
 		os.Exit(1)
 	}
 
-	if err := printStats(db, *popular, *recent, *asJSON); err != nil {
+	if err := printStats(os.Stdout, db, *popular, *recent, *since, *asJSON); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 }
 
+func runVacuum() {
+	fs := flag.NewFlagSet("vacuum", flag.ExitOnError)
+	databaseDriver := fs.String("database-driver", "sqlite", "Database driver: sqlite or postgres")
+	databasePath := fs.String("database-path", "./cache/proxy.db", "Path to SQLite database file")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "git-pkgs proxy - Reclaim free space in the SQLite database\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: proxy vacuum [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Rebuilds the database file without its free pages and enables\n")
+		fmt.Fprintf(os.Stderr, "incremental vacuuming for database.vacuum_interval. Writes are\n")
+		fmt.Fprintf(os.Stderr, "blocked while it runs, so prefer running it with the server stopped.\n")
+		fmt.Fprintf(os.Stderr, "Does nothing for postgres.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(os.Args[1:])
+
+	if v := os.Getenv("PROXY_DATABASE_DRIVER"); v != "" {
+		*databaseDriver = v
+	}
+	if v := os.Getenv("PROXY_DATABASE_PATH"); v != "" {
+		*databasePath = v
+	}
+
+	if *databaseDriver == "postgres" {
+		fmt.Println("postgres runs its own autovacuum; nothing to do")
+		return
+	}
+
+	if _, statErr := os.Stat(*databasePath); os.IsNotExist(statErr) {
+		fmt.Fprintf(os.Stderr, "database not found: %s\n", *databasePath)
+		os.Exit(1)
+	}
+	db, err := database.OpenWithBusyTimeout(*databasePath, vacuumBusyTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := db.Vacuum(context.Background(), true)
+	_ = db.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error vacuuming database: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Database:  %s\n", *databasePath)
+	fmt.Printf("Before:    %s\n", formatSize(result.BeforeBytes))
+	fmt.Printf("After:     %s\n", formatSize(result.AfterBytes))
+	fmt.Printf("Reclaimed: %s\n", formatSize(result.ReclaimedBytes()))
+}
+
+func runDoctor() {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file (YAML or JSON)")
+	storageURL := fs.String("storage-url", "", "Storage URL (file:// or s3://)")
+	databaseDriver := fs.String("database-driver", "", "Database driver: sqlite or postgres")
+	databasePath := fs.String("database-path", "", "Path to SQLite database file")
+	databaseURL := fs.String("database-url", "", "PostgreSQL connection URL")
+	skipUpstreams := fs.Bool("skip-upstreams", false, "Don't ping upstream registries")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "git-pkgs proxy - Check configuration end to end\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: proxy doctor [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Validates the config, opens the database, round-trips a file through\n")
+		fmt.Fprintf(os.Stderr, "storage, and pings each upstream registry. Exits non-zero if the\n")
+		fmt.Fprintf(os.Stderr, "config, database, or storage check fails.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(os.Args[1:])
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.LoadFromEnv()
+
+	if *storageURL != "" {
+		cfg.Storage.URL = *storageURL
+	}
+	if *databaseDriver != "" {
+		cfg.Database.Driver = *databaseDriver
+	}
+	if *databasePath != "" {
+		cfg.Database.Path = *databasePath
+	}
+	if *databaseURL != "" {
+		cfg.Database.URL = *databaseURL
+	}
+
+	report := doctor.Run(context.Background(), cfg, doctor.Options{SkipUpstreams: *skipUpstreams})
+	report.Write(os.Stdout)
+
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
+
 func runMirror() {
 	fs := flag.NewFlagSet("mirror", flag.ExitOnError)
 	configPath := fs.String("config", "", "Path to configuration file")
@@ -438,7 +819,7 @@ func runMirror() {
 	case "postgres":
 		db, err = database.OpenPostgresOrCreate(cfg.Database.URL)
 	default:
-		db, err = database.OpenOrCreate(cfg.Database.Path)
+		db, err = database.OpenOrCreateWithBusyTimeout(cfg.Database.Path, cfg.ParseDatabaseBusyTimeout())
 	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening database: %v\n", err)
@@ -453,11 +834,7 @@ func runMirror() {
 	}
 
 	// Open storage
-	sURL := cfg.Storage.URL
-	if sURL == "" {
-		sURL = "file://" + cfg.Storage.Path //nolint:staticcheck // backwards compat
-	}
-	store, err := storage.OpenBucket(context.Background(), sURL)
+	store, err := storage.OpenBucket(context.Background(), cfg.StorageURL())
 	if err != nil {
 		_ = db.Close()
 		fmt.Fprintf(os.Stderr, "error opening storage: %v\n", err)
@@ -470,7 +847,17 @@ func runMirror() {
 	proxy := handler.NewProxy(db, store, fetcher, resolver, logger)
 	proxy.CacheMetadata = true // mirror always caches metadata
 	proxy.MetadataTTL = cfg.ParseMetadataTTL()
+	proxy.MetadataTTLOverrides = cfg.ParseMetadataTTLOverrides()
+	proxy.AllowedArtifacts = cfg.Cache.AllowedArtifacts
+	proxy.NotFoundTTL = cfg.ParseNotFoundTTL()
+	proxy.ResolveCacheTTL = cfg.ParseResolveCacheTTL()
 	proxy.MetadataMaxSize = cfg.ParseMetadataMaxSize()
+	proxy.ServeBufferSize = cfg.ParseServeBufferSize()
+	proxy.StoragePrefix = cfg.Storage.Prefix
+	proxy.MaxConcurrentFetches = cfg.Upstream.MaxConcurrentFetches
+	proxy.FetchQueueTimeout = cfg.ParseFetchQueueTimeout()
+	proxy.FetchTimeout = cfg.ParseFetchTimeout()
+	proxy.SetForwardedResponseHeaders(cfg.Upstream.ResponseHeaders)
 
 	m := mirror.New(proxy, db, store, logger, *concurrency)
 
@@ -512,7 +899,7 @@ func runMirror() {
 	}
 }
 
-func printStats(db *database.DB, popular, recent int, asJSON bool) error {
+func printStats(w io.Writer, db *database.DB, popular, recent int, since time.Duration, asJSON bool) error {
 	defer func() { _ = db.Close() }()
 
 	stats, err := db.GetCacheStats()
@@ -530,23 +917,77 @@ func printStats(db *database.DB, popular, recent int, asJSON bool) error {
 		return fmt.Errorf("error getting recent packages: %w", err)
 	}
 
-	if asJSON {
-		outputJSON(stats, popularPkgs, recentPkgs)
-	} else {
-		outputText(stats, popularPkgs, recentPkgs)
+	var window *database.WindowStats
+	if since > 0 {
+		if window, err = db.GetCacheStatsSince(time.Now().Add(-since)); err != nil {
+			return fmt.Errorf("error getting stats since %s: %w", since, err)
+		}
+	}
+
+	if !asJSON {
+		outputText(w, stats, popularPkgs, recentPkgs, window)
+		return nil
+	}
+
+	byEcosystem, err := db.GetCacheStatsByEcosystem()
+	if err != nil {
+		return fmt.Errorf("error getting stats by ecosystem: %w", err)
+	}
+
+	enrichment, err := db.GetEnrichmentStats()
+	if err != nil {
+		return fmt.Errorf("error getting enrichment stats: %w", err)
 	}
-	return nil
+
+	return outputJSON(w, stats, byEcosystem, enrichment, popularPkgs, recentPkgs, window)
 }
 
+// jsonOutput is the document printed by stats -json. Dashboards read it,
+// so field names are stable: add fields rather than renaming them. The
+// fields are described in the README's stats section.
 type jsonOutput struct {
-	Packages   int64            `json:"packages"`
-	Versions   int64            `json:"versions"`
-	Artifacts  int64            `json:"artifacts"`
-	TotalSize  int64            `json:"total_size_bytes"`
-	TotalHits  int64            `json:"total_hits"`
-	Ecosystems map[string]int64 `json:"ecosystems"`
-	Popular    []jsonPopular    `json:"popular"`
-	Recent     []jsonRecent     `json:"recent"`
+	Packages    int64            `json:"packages"`
+	Versions    int64            `json:"versions"`
+	Artifacts   int64            `json:"artifacts"`
+	TotalSize   int64            `json:"total_size_bytes"`
+	TotalHits   int64            `json:"total_hits"`
+	Ecosystems  map[string]int64 `json:"ecosystems"`
+	ByEcosystem []jsonEcosystem  `json:"by_ecosystem"`
+	Enrichment  jsonEnrichment   `json:"enrichment"`
+	Popular     []jsonPopular    `json:"popular"`
+	Recent      []jsonRecent     `json:"recent"`
+	Window      *jsonWindow      `json:"window,omitempty"`
+}
+
+type jsonEcosystem struct {
+	Ecosystem string `json:"ecosystem"`
+	Artifacts int64  `json:"artifacts"`
+	Size      int64  `json:"size_bytes"`
+	Hits      int64  `json:"hits"`
+}
+
+type jsonEnrichment struct {
+	Packages           int64               `json:"packages"`
+	EnrichedPackages   int64               `json:"enriched_packages"`
+	VulnSyncedPackages int64               `json:"vuln_synced_packages"`
+	Vulnerabilities    jsonVulnerabilities `json:"vulnerabilities"`
+}
+
+type jsonVulnerabilities struct {
+	Total    int64 `json:"total"`
+	Critical int64 `json:"critical"`
+	High     int64 `json:"high"`
+	Medium   int64 `json:"medium"`
+	Low      int64 `json:"low"`
+}
+
+type jsonWindow struct {
+	Since             string `json:"since"`
+	Hits              int64  `json:"hits"`
+	AccessedArtifacts int64  `json:"accessed_artifacts"`
+	AccessedSize      int64  `json:"accessed_size_bytes"`
+	CachedArtifacts   int64  `json:"cached_artifacts"`
+	CachedSize        int64  `json:"cached_size_bytes"`
 }
 
 type jsonPopular struct {
@@ -564,16 +1005,38 @@ type jsonRecent struct {
 	Size      int64  `json:"size_bytes"`
 }
 
-func outputJSON(stats *database.CacheStats, popular []database.PopularPackage, recent []database.RecentPackage) {
+func outputJSON(w io.Writer, stats *database.CacheStats, byEcosystem []database.EcosystemCacheStats, enrichment *database.EnrichmentStats, popular []database.PopularPackage, recent []database.RecentPackage, window *database.WindowStats) error {
 	out := jsonOutput{
-		Packages:   stats.TotalPackages,
-		Versions:   stats.TotalVersions,
-		Artifacts:  stats.TotalArtifacts,
-		TotalSize:  stats.TotalSize,
-		TotalHits:  stats.TotalHits,
-		Ecosystems: stats.EcosystemCounts,
-		Popular:    make([]jsonPopular, len(popular)),
-		Recent:     make([]jsonRecent, len(recent)),
+		Packages:    stats.TotalPackages,
+		Versions:    stats.TotalVersions,
+		Artifacts:   stats.TotalArtifacts,
+		TotalSize:   stats.TotalSize,
+		TotalHits:   stats.TotalHits,
+		Ecosystems:  stats.EcosystemCounts,
+		ByEcosystem: make([]jsonEcosystem, len(byEcosystem)),
+		Enrichment: jsonEnrichment{
+			Packages:           enrichment.TotalPackages,
+			EnrichedPackages:   enrichment.EnrichedPackages,
+			VulnSyncedPackages: enrichment.VulnSyncedPackages,
+			Vulnerabilities: jsonVulnerabilities{
+				Total:    enrichment.TotalVulnerabilities,
+				Critical: enrichment.CriticalVulns,
+				High:     enrichment.HighVulns,
+				Medium:   enrichment.MediumVulns,
+				Low:      enrichment.LowVulns,
+			},
+		},
+		Popular: make([]jsonPopular, len(popular)),
+		Recent:  make([]jsonRecent, len(recent)),
+	}
+
+	for i, e := range byEcosystem {
+		out.ByEcosystem[i] = jsonEcosystem{
+			Ecosystem: e.Ecosystem,
+			Artifacts: e.Artifacts,
+			Size:      e.Size,
+			Hits:      e.Hits,
+		}
 	}
 
 	for i, p := range popular {
@@ -595,40 +1058,60 @@ func outputJSON(stats *database.CacheStats, popular []database.PopularPackage, r
 		}
 	}
 
-	enc := json.NewEncoder(os.Stdout)
+	if window != nil {
+		out.Window = &jsonWindow{
+			Since:             window.Since.Format("2006-01-02 15:04:05"),
+			Hits:              window.Hits,
+			AccessedArtifacts: window.AccessedArtifacts,
+			AccessedSize:      window.AccessedSize,
+			CachedArtifacts:   window.CachedArtifacts,
+			CachedSize:        window.CachedSize,
+		}
+	}
+
+	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
-	_ = enc.Encode(out)
+	return enc.Encode(out)
 }
 
-func outputText(stats *database.CacheStats, popular []database.PopularPackage, recent []database.RecentPackage) {
-	fmt.Printf("Cache Statistics\n")
-	fmt.Printf("================\n\n")
+func outputText(w io.Writer, stats *database.CacheStats, popular []database.PopularPackage, recent []database.RecentPackage, window *database.WindowStats) {
+	fmt.Fprintf(w, "Cache Statistics\n")
+	fmt.Fprintf(w, "================\n\n")
 
-	fmt.Printf("Packages:   %d\n", stats.TotalPackages)
-	fmt.Printf("Versions:   %d\n", stats.TotalVersions)
-	fmt.Printf("Artifacts:  %d\n", stats.TotalArtifacts)
-	fmt.Printf("Total size: %s\n", formatSize(stats.TotalSize))
-	fmt.Printf("Total hits: %d\n", stats.TotalHits)
+	fmt.Fprintf(w, "Packages:   %d\n", stats.TotalPackages)
+	fmt.Fprintf(w, "Versions:   %d\n", stats.TotalVersions)
+	fmt.Fprintf(w, "Artifacts:  %d\n", stats.TotalArtifacts)
+	fmt.Fprintf(w, "Total size: %s\n", formatSize(stats.TotalSize))
+	fmt.Fprintf(w, "Total hits: %d\n", stats.TotalHits)
 
 	if len(stats.EcosystemCounts) > 0 {
-		fmt.Printf("\nPackages by ecosystem:\n")
+		fmt.Fprintf(w, "\nPackages by ecosystem:\n")
 		for eco, count := range stats.EcosystemCounts {
-			fmt.Printf("  %-10s %d\n", eco, count)
+			fmt.Fprintf(w, "  %-10s %d\n", eco, count)
 		}
 	}
 
 	if len(popular) > 0 {
-		fmt.Printf("\nMost popular packages:\n")
+		fmt.Fprintf(w, "\nMost popular packages:\n")
 		for i, p := range popular {
-			fmt.Printf("  %2d. %s/%s (%d hits, %s)\n", i+1, p.Ecosystem, p.Name, p.Hits, formatSize(p.Size))
+			fmt.Fprintf(w, "  %2d. %s/%s (%d hits, %s)\n", i+1, p.Ecosystem, p.Name, p.Hits, formatSize(p.Size))
 		}
 	}
 
 	if len(recent) > 0 {
-		fmt.Printf("\nRecently cached:\n")
+		fmt.Fprintf(w, "\nRecently cached:\n")
 		for _, r := range recent {
-			fmt.Printf("  %s/%s@%s (%s, %s)\n", r.Ecosystem, r.Name, r.Version, r.CachedAt.Format("2006-01-02 15:04"), formatSize(r.Size))
+			fmt.Fprintf(w, "  %s/%s@%s (%s, %s)\n", r.Ecosystem, r.Name, r.Version, r.CachedAt.Format("2006-01-02 15:04"), formatSize(r.Size))
+		}
+	}
+
+	if window != nil {
+		fmt.Fprintf(w, "\nSince %s:\n", window.Since.Format("2006-01-02 15:04"))
+		if window.Hits > 0 {
+			fmt.Fprintf(w, "  Hits:               %d\n", window.Hits)
 		}
+		fmt.Fprintf(w, "  Artifacts accessed: %d (%s)\n", window.AccessedArtifacts, formatSize(window.AccessedSize))
+		fmt.Fprintf(w, "  Artifacts cached:   %d (%s)\n", window.CachedArtifacts, formatSize(window.CachedSize))
 	}
 }
 
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+func TestPrintConfigShowsOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("listen: \":7000\"\nlog:\n  level: warn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROXY_LISTEN", ":9000")
+	t.Setenv("PROXY_STORAGE_URL", "file:///from/env")
+
+	var buf bytes.Buffer
+	err := printConfig(&buf, []string{
+		"-config", path,
+		"-format", "json",
+		"-storage-url", "file:///from/flag",
+		"-database-driver", "postgres",
+		"-database-url", "postgres://proxy:hunter2@db/proxy",
+	})
+	if err != nil {
+		t.Fatalf("printConfig() error = %v", err)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("printed config contains the database password:\n%s", buf.String())
+	}
+
+	var got struct {
+		Listen  string `json:"listen"`
+		Storage struct {
+			URL string `json:"url"`
+		} `json:"storage"`
+		Database struct {
+			URL string `json:"url"`
+		} `json:"database"`
+		Log struct {
+			Level string `json:"level"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if got.Log.Level != "warn" {
+		t.Errorf("log.level = %q, want warn from the file", got.Log.Level)
+	}
+	if got.Listen != ":9000" {
+		t.Errorf("listen = %q, want :9000 from the environment", got.Listen)
+	}
+	if got.Storage.URL != "file:///from/flag" {
+		t.Errorf("storage.url = %q, want the flag value", got.Storage.URL)
+	}
+	if got.Database.URL != "postgres://proxy:REDACTED@db/proxy" {
+		t.Errorf("database.url = %q, want the password redacted", got.Database.URL)
+	}
+}
+
+func TestPrintConfigRejectsInvalidConfig(t *testing.T) {
+	var buf bytes.Buffer
+	err := printConfig(&buf, []string{"-database-driver", "oracle"})
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("printConfig() error = %v, want invalid configuration", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("printed an invalid config:\n%s", buf.String())
+	}
+}
+
+func TestPrintStatsJSONIncludesEnrichmentAndEcosystems(t *testing.T) {
+	db, err := database.OpenOrCreate(filepath.Join(t.TempDir(), "proxy.db"))
+	if err != nil {
+		t.Fatalf("OpenOrCreate: %v", err)
+	}
+
+	seed := []struct {
+		ecosystem, name, version string
+		size, hits               int64
+		enriched                 bool
+	}{
+		{"npm", "lodash", "4.17.21", 100, 5, true},
+		{"npm", "react", "18.2.0", 300, 2, false},
+		{"cargo", "serde", "1.0.0", 50, 7, true},
+	}
+	for _, s := range seed {
+		pkgPURL := "pkg:" + s.ecosystem + "/" + s.name
+		pkg := &database.Package{PURL: pkgPURL, Ecosystem: s.ecosystem, Name: s.name}
+		if s.enriched {
+			pkg.EnrichedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		if err := db.UpsertPackage(pkg); err != nil {
+			t.Fatalf("UpsertPackage: %v", err)
+		}
+		versionPURL := pkgPURL + "@" + s.version
+		if err := db.UpsertVersion(&database.Version{PURL: versionPURL, PackagePURL: pkgPURL}); err != nil {
+			t.Fatalf("UpsertVersion: %v", err)
+		}
+		if err := db.UpsertArtifact(&database.Artifact{
+			VersionPURL: versionPURL,
+			Filename:    s.name + ".tgz",
+			UpstreamURL: "https://example.com/" + s.name + ".tgz",
+			StoragePath: sql.NullString{String: s.ecosystem + "/" + s.name, Valid: true},
+			Size:        sql.NullInt64{Int64: s.size, Valid: true},
+			HitCount:    s.hits,
+		}); err != nil {
+			t.Fatalf("UpsertArtifact: %v", err)
+		}
+	}
+	if err := db.SetVulnsSyncedAt("npm", "lodash"); err != nil {
+		t.Fatalf("SetVulnsSyncedAt: %v", err)
+	}
+	for i, severity := range []string{"critical", "high", "high", "low"} {
+		if err := db.UpsertVulnerability(&database.Vulnerability{
+			VulnID:      fmt.Sprintf("GHSA-%d", i),
+			Ecosystem:   "npm",
+			PackageName: "lodash",
+			Severity:    sql.NullString{String: severity, Valid: true},
+		}); err != nil {
+			t.Fatalf("UpsertVulnerability: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := printStats(&buf, db, defaultTopN, defaultTopN, 0, true); err != nil {
+		t.Fatalf("printStats() error = %v", err)
+	}
+
+	var got jsonOutput
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+
+	wantEnrichment := jsonEnrichment{
+		Packages:           3,
+		EnrichedPackages:   2,
+		VulnSyncedPackages: 1,
+		Vulnerabilities:    jsonVulnerabilities{Total: 4, Critical: 1, High: 2, Low: 1},
+	}
+	if got.Enrichment != wantEnrichment {
+		t.Errorf("enrichment = %+v, want %+v", got.Enrichment, wantEnrichment)
+	}
+
+	wantEcosystems := []jsonEcosystem{
+		{Ecosystem: "cargo", Artifacts: 1, Size: 50, Hits: 7},
+		{Ecosystem: "npm", Artifacts: 2, Size: 400, Hits: 7},
+	}
+	if !reflect.DeepEqual(got.ByEcosystem, wantEcosystems) {
+		t.Errorf("by_ecosystem = %+v, want %+v", got.ByEcosystem, wantEcosystems)
+	}
+
+	for _, key := range []string{`"enrichment"`, `"by_ecosystem"`, `"vuln_synced_packages"`, `"size_bytes"`} {
+		if !strings.Contains(buf.String(), key) {
+			t.Errorf("output is missing %s:\n%s", key, buf.String())
+		}
+	}
+}
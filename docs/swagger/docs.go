@@ -15,8 +15,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/bulk": {
+        "/api/artifacts/pin": {
             "post": {
+                "description": "Pinned artifacts are never removed by LRU eviction and are left out of the eviction preview. Use this for baseline artifacts such as a golden base image. Send pinned=false to make an artifact evictable again.",
                 "consumes": [
                     "application/json"
                 ],
@@ -26,15 +27,15 @@ const docTemplate = `{
                 "tags": [
                     "api"
                 ],
-                "summary": "Bulk package lookup by PURL",
+                "summary": "Pin or unpin an artifact",
                 "parameters": [
                     {
-                        "description": "PURLs",
+                        "description": "Artifact to pin",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/server.BulkRequest"
+                            "$ref": "#/definitions/server.PinRequest"
                         }
                     }
                 ],
@@ -42,7 +43,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.BulkResponse"
+                            "$ref": "#/definitions/server.PinRequest"
                         }
                     },
                     "400": {
@@ -51,6 +52,24 @@ const docTemplate = `{
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -60,7 +79,7 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/outdated": {
+        "/api/bulk": {
             "post": {
                 "consumes": [
                     "application/json"
@@ -71,15 +90,15 @@ const docTemplate = `{
                 "tags": [
                     "api"
                 ],
-                "summary": "Check outdated packages",
+                "summary": "Bulk package lookup by PURL",
                 "parameters": [
                     {
-                        "description": "Packages to check",
+                        "description": "PURLs",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/server.OutdatedRequest"
+                            "$ref": "#/definitions/server.BulkRequest"
                         }
                     }
                 ],
@@ -87,7 +106,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.OutdatedResponse"
+                            "$ref": "#/definitions/server.BulkResponse"
                         }
                     },
                     "400": {
@@ -96,51 +115,56 @@ const docTemplate = `{
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/api/packages": {
-            "get": {
+        "/api/cached": {
+            "post": {
+                "description": "Takes versioned PURLs and reports, for each, whether all of its known artifacts are in the cache. CI can use this before a build to decide whether it can run against the proxy offline. A version the proxy has never seen, or one with any artifact not yet downloaded, is reported as not cached.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "api"
                 ],
-                "summary": "List cached packages",
+                "summary": "Check which versions are cached",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Ecosystem",
-                        "name": "ecosystem",
-                        "in": "query"
-                    },
-                    {
-                        "enum": [
-                            "hits",
-                            "name",
-                            "size",
-                            "cached_at",
-                            "ecosystem",
-                            "vulns"
-                        ],
-                        "type": "string",
-                        "description": "Sort",
-                        "name": "sort",
-                        "in": "query"
+                        "description": "Versioned PURLs",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.CachedCheckRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.PackagesListResponse"
+                            "$ref": "#/definitions/server.CachedCheckResponse"
                         }
                     },
                     "400": {
@@ -149,6 +173,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -158,27 +188,68 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/search": {
+        "/api/collisions": {
             "get": {
+                "description": "Reports package names the proxy has seen in more than one ecosystem, or in spellings that differ only in case or '-', '_' and '.' separators. Either can point at a dependency confusion attempt. Names are compared after folding case and collapsing separators, the way PyPI normalizes names.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "api"
                 ],
-                "summary": "Search cached packages",
+                "summary": "List package name collisions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.CollisionsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/deps/{ecosystem}/{name}/{version}": {
+            "get": {
+                "description": "Reads the manifest (package.json for npm, Cargo.toml for cargo) from the version's cached artifact and lists its declared dependencies with their version constraints. Nothing is fetched from upstream, so the version must be cached.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "List the dependencies a cached version declares",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Query",
-                        "name": "q",
-                        "in": "query",
+                        "description": "Ecosystem (npm or cargo)",
+                        "name": "ecosystem",
+                        "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Ecosystem",
-                        "name": "ecosystem",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to read",
+                        "name": "artifact",
                         "in": "query"
                     }
                 ],
@@ -186,7 +257,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.SearchResponse"
+                            "$ref": "#/definitions/server.DependenciesResponse"
                         }
                     },
                     "400": {
@@ -195,6 +266,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -204,45 +281,92 @@ const docTemplate = `{
                 }
             }
         },
-        "/health": {
+        "/api/eviction/preview": {
             "get": {
+                "description": "Lists cached artifacts in least-recently-used order until removing them would bring the cache under target_size. Nothing is deleted. target_size defaults to storage.max_size. Only served when admin.token is set; send it as a bearer token.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "meta"
+                    "api"
+                ],
+                "summary": "Preview LRU eviction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Target cache size, e.g. 5GB",
+                        "name": "target_size",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Health check",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.HealthResponse"
+                            "$ref": "#/definitions/server.EvictionPreviewResponse"
                         }
                     },
-                    "503": {
-                        "description": "Service Unavailable",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/server.HealthResponse"
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/stats": {
-            "get": {
+        "/api/outdated": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "meta"
+                    "api"
+                ],
+                "summary": "Check outdated packages",
+                "parameters": [
+                    {
+                        "description": "Packages to check",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.OutdatedRequest"
+                        }
+                    }
                 ],
-                "summary": "Cache statistics",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.StatsResponse"
+                            "$ref": "#/definitions/server.OutdatedResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
                     "500": {
@@ -250,20 +374,26 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/ui/api/browse/{ecosystem}/{name}/{version}": {
+        "/api/package/{ecosystem}/{name}": {
             "get": {
-                "description": "Lists files from the first cached artifact for a package version.",
+                "description": "Looks up a package in its upstream registry. Namespaced names (npm @scope/name, Composer vendor/name) keep their slash.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "browse"
+                    "api"
                 ],
-                "summary": "List files inside a cached artifact",
+                "summary": "Get package metadata",
                 "parameters": [
                     {
                         "type": "string",
@@ -278,26 +408,19 @@ const docTemplate = `{
                         "name": "name",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Version",
-                        "name": "version",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Directory path inside the archive",
-                        "name": "path",
-                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.BrowseListResponse"
+                            "$ref": "#/definitions/server.PackageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
                     "404": {
@@ -306,8 +429,8 @@ const docTemplate = `{
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "502": {
+                        "description": "Bad Gateway",
                         "schema": {
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
@@ -315,16 +438,15 @@ const docTemplate = `{
                 }
             }
         },
-        "/ui/api/browse/{ecosystem}/{name}/{version}/file/{filepath}": {
+        "/api/package/{ecosystem}/{name}/{version}": {
             "get": {
-                "description": "Streams a single file from the cached artifact. The file path may contain slashes.",
                 "produces": [
-                    "application/octet-stream"
+                    "application/json"
                 ],
                 "tags": [
-                    "browse"
+                    "api"
                 ],
-                "summary": "Fetch a file inside a cached artifact",
+                "summary": "Get version metadata with vulnerabilities",
                 "parameters": [
                     {
                         "type": "string",
@@ -346,20 +468,13 @@ const docTemplate = `{
                         "name": "version",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "File path inside the archive",
-                        "name": "filepath",
-                        "in": "path",
-                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "file"
+                            "$ref": "#/definitions/server.EnrichmentResponse"
                         }
                     },
                     "400": {
@@ -368,14 +483,8 @@ const docTemplate = `{
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "$ref": "#/definitions/server.ErrorResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "502": {
+                        "description": "Bad Gateway",
                         "schema": {
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
@@ -383,42 +492,230 @@ const docTemplate = `{
                 }
             }
         },
-        "/ui/api/compare/{ecosystem}/{name}/{fromVersion}/{toVersion}": {
+        "/api/packages": {
             "get": {
-                "description": "Returns a structured diff for two cached versions.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "browse"
+                    "api"
                 ],
-                "summary": "Compare two cached versions",
+                "summary": "List cached packages",
                 "parameters": [
                     {
                         "type": "string",
                         "description": "Ecosystem",
                         "name": "ecosystem",
-                        "in": "path",
-                        "required": true
+                        "in": "query"
                     },
                     {
+                        "enum": [
+                            "hits",
+                            "name",
+                            "size",
+                            "cached_at",
+                            "ecosystem",
+                            "vulns"
+                        ],
                         "type": "string",
-                        "description": "Package name",
-                        "name": "name",
-                        "in": "path",
-                        "required": true
+                        "description": "Sort",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Results per page, clamped to api.max_page_size",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.PackagesListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/pin": {
+            "post": {
+                "description": "Downloads each listed version if it isn't cached yet and pins its artifacts so LRU eviction never removes them. Versions are handled one at a time and each gets its own result; a failure doesn't stop the rest. Only served when mirror_api is enabled, since it triggers upstream downloads, and admin.token is set; requests must send that token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "Fetch and pin package versions",
+                "parameters": [
+                    {
+                        "description": "Versions to pin",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.PinVersionsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.PinVersionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/policy-events": {
+            "get": {
+                "description": "Events carry the client IP of the refused request, so this is only served when admin.token is set; send it as a bearer token.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "List policy decision audit events",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "From version",
-                        "name": "fromVersion",
-                        "in": "path",
-                        "required": true
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum events to return (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of events to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.PolicyEventsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/reconcile": {
+            "post": {
+                "description": "Starts a background scan that marks artifacts whose blobs are missing from storage as uncached, so they are refetched, and reports blobs no artifact points at. Only one scan runs at a time; starting another while one is running returns 409 with the running job's id.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "Start storage reconciliation",
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/reconcile/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "Get reconcile job status",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "To version",
-                        "name": "toVersion",
+                        "description": "Job ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -427,8 +724,13 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/server.ReconcileJob"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
                         }
                     },
                     "404": {
@@ -436,6 +738,58 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/server.ErrorResponse"
                         }
+                    }
+                }
+            }
+        },
+        "/api/search": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "Search cached packages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Results per page, clamped to api.max_page_size",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.SearchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
@@ -445,203 +799,1399 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "server.BrowseFileInfo": {
-            "type": "object",
-            "properties": {
-                "is_dir": {
-                    "type": "boolean"
-                },
-                "mod_time": {
-                    "type": "string"
-                },
-                "name": {
-                    "type": "string"
-                },
-                "path": {
+        },
+        "/api/usage": {
+            "get": {
+                "description": "Totals the artifact downloads recorded in the access log per team, for chargeback. Requires usage.enabled. from and to accept RFC 3339 timestamps or dates; the range includes from and excludes to. Defaults to the last 30 days.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "Artifact downloads per team",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Start of the range (RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range, exclusive (RFC 3339 or YYYY-MM-DD, default now)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.UsageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/versions/{ecosystem}/{name}": {
+            "get": {
+                "description": "Lists every version the proxy has seen for a package, newest first by the ecosystem's version ordering, with whether any artifact for it is cached.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "List known versions of a package",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.PackageVersionsResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/vulns/{ecosystem}/{name}": {
+            "get": {
+                "description": "Without a version, lists every known vulnerability for the package.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "List vulnerabilities",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.VulnsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/vulns/{ecosystem}/{name}/{version}": {
+            "get": {
+                "description": "Without a version, lists every known vulnerability for the package.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api"
+                ],
+                "summary": "List vulnerabilities",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.VulnsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "meta"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.HealthResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/server.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stats": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "meta"
+                ],
+                "summary": "Cache statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.StatsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/api/browse/{ecosystem}/{name}/{version}": {
+            "get": {
+                "description": "Lists files from a cached artifact for a package version. Uses the first cached artifact unless artifact is given.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "browse"
+                ],
+                "summary": "List files inside a cached artifact",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Directory path inside the archive",
+                        "name": "path",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to browse",
+                        "name": "artifact",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.BrowseListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/api/browse/{ecosystem}/{name}/{version}/archive": {
+            "get": {
+                "description": "Streams a new zip or tar.gz containing only the files under path. Paths inside the archive are relative to the artifact root, so path=dist yields entries like dist/index.js. An empty path repackages the whole artifact.",
+                "produces": [
+                    "application/zip",
+                    "application/gzip"
+                ],
+                "tags": [
+                    "browse"
+                ],
+                "summary": "Download a directory from a cached artifact as an archive",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Directory inside the archive",
+                        "name": "path",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Output format: zip (default) or tar.gz",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to browse",
+                        "name": "artifact",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/api/browse/{ecosystem}/{name}/{version}/file/{filepath}": {
+            "get": {
+                "description": "Streams a single file from the cached artifact. The file path may contain slashes.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "browse"
+                ],
+                "summary": "Fetch a file inside a cached artifact",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File path inside the archive",
+                        "name": "filepath",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to browse",
+                        "name": "artifact",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/api/browse/{ecosystem}/{name}/{version}/tree": {
+            "get": {
+                "description": "Returns all files and directories of a cached artifact in one nested response, so a client can render the whole tree without listing each directory. Very large archives are cut off and marked truncated.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "browse"
+                ],
+                "summary": "List every file inside a cached artifact as a tree",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version",
+                        "name": "version",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to browse",
+                        "name": "artifact",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.BrowseTreeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/api/compare/{ecosystem}/{name}/{fromVersion}/{toVersion}": {
+            "get": {
+                "description": "Returns a structured diff for two cached versions.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "browse"
+                ],
+                "summary": "Compare two cached versions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Ecosystem",
+                        "name": "ecosystem",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Package name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "From version",
+                        "name": "fromVersion",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "To version",
+                        "name": "toVersion",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to use for the from version",
+                        "name": "from_artifact",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filename of the cached artifact to use for the to version",
+                        "name": "to_artifact",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "database.CollisionPackage": {
+            "type": "object",
+            "properties": {
+                "ecosystem": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.NameCollision": {
+            "type": "object",
+            "properties": {
+                "ecosystems": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "key": {
+                    "type": "string"
+                },
+                "packages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.CollisionPackage"
+                    }
+                }
+            }
+        },
+        "server.BrowseFileInfo": {
+            "type": "object",
+            "properties": {
+                "is_dir": {
+                    "type": "boolean"
+                },
+                "mod_time": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.BrowseListResponse": {
+            "type": "object",
+            "properties": {
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.BrowseFileInfo"
+                    }
+                },
+                "path": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/server.BrowseSource"
+                }
+            }
+        },
+        "server.BrowseSource": {
+            "type": "object",
+            "properties": {
+                "fetched_at": {
+                    "type": "string"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.BrowseTreeNode": {
+            "type": "object",
+            "properties": {
+                "children": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.BrowseTreeNode"
+                    }
+                },
+                "is_dir": {
+                    "type": "boolean"
+                },
+                "mod_time": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.BrowseTreeResponse": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "description": "Entries counts the files and directories in the tree.",
+                    "type": "integer"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.BrowseTreeNode"
+                    }
+                },
+                "source": {
+                    "$ref": "#/definitions/server.BrowseSource"
+                },
+                "truncated": {
+                    "description": "Truncated is set when the archive holds more than the entry cap and\nthe tree is incomplete.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "server.BulkRequest": {
+            "type": "object",
+            "properties": {
+                "purls": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.BulkResponse": {
+            "type": "object",
+            "properties": {
+                "packages": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/server.PackageResponse"
+                    }
+                }
+            }
+        },
+        "server.CachedCheckRequest": {
+            "type": "object",
+            "properties": {
+                "purls": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.CachedCheckResponse": {
+            "type": "object",
+            "properties": {
+                "all_cached": {
+                    "type": "boolean"
+                },
+                "purls": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/server.CachedCheckResult"
+                    }
+                }
+            }
+        },
+        "server.CachedCheckResult": {
+            "type": "object",
+            "properties": {
+                "artifacts": {
+                    "type": "integer"
+                },
+                "cached": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.CollisionsResponse": {
+            "type": "object",
+            "properties": {
+                "collisions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.NameCollision"
+                    }
+                },
+                "count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.DependenciesResponse": {
+            "type": "object",
+            "properties": {
+                "dependencies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.DependencyResult"
+                    }
+                },
+                "ecosystem": {
+                    "type": "string"
+                },
+                "manifest": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/server.BrowseSource"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.DependencyResult": {
+            "type": "object",
+            "properties": {
+                "constraint": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "optional": {
+                    "type": "boolean"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "target": {
+                    "description": "Target is the platform condition a cargo dependency applies to,\nsuch as cfg(windows).",
+                    "type": "string"
+                }
+            }
+        },
+        "server.EnrichmentResponse": {
+            "type": "object",
+            "properties": {
+                "is_outdated": {
+                    "type": "boolean"
+                },
+                "license_category": {
+                    "type": "string"
+                },
+                "package": {
+                    "$ref": "#/definitions/server.PackageResponse"
+                },
+                "version": {
+                    "$ref": "#/definitions/server.VersionResponse"
+                },
+                "vulnerabilities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.VulnResponse"
+                    }
+                }
+            }
+        },
+        "server.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.EvictionPreviewResponse": {
+            "type": "object",
+            "properties": {
+                "artifacts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.EvictionPreviewResult"
+                    }
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "current_size_bytes": {
+                    "type": "integer"
+                },
+                "freed_bytes": {
+                    "type": "integer"
+                },
+                "projected_size_bytes": {
+                    "type": "integer"
+                },
+                "target_met": {
+                    "type": "boolean"
+                },
+                "target_size_bytes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.EvictionPreviewResult": {
+            "type": "object",
+            "properties": {
+                "cumulative_freed_bytes": {
+                    "type": "integer"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "last_accessed_at": {
+                    "type": "string"
+                },
+                "size_bytes": {
+                    "type": "integer"
+                },
+                "version_purl": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.HealthCheck": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "step": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.HealthResponse": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/server.HealthCheck"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.MetadataFreshness": {
+            "type": "object",
+            "properties": {
+                "fetched_at": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "stale": {
+                    "type": "boolean"
+                },
+                "ttl": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.OutdatedPackage": {
+            "type": "object",
+            "properties": {
+                "ecosystem": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.OutdatedRequest": {
+            "type": "object",
+            "properties": {
+                "packages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.OutdatedPackage"
+                    }
+                }
+            }
+        },
+        "server.OutdatedResponse": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.OutdatedResult"
+                    }
+                }
+            }
+        },
+        "server.OutdatedResult": {
+            "type": "object",
+            "properties": {
+                "ecosystem": {
+                    "type": "string"
+                },
+                "is_outdated": {
+                    "type": "boolean"
+                },
+                "latest_version": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.PackageListResult": {
+            "type": "object",
+            "properties": {
+                "cached_at": {
+                    "type": "string"
+                },
+                "ecosystem": {
+                    "type": "string"
+                },
+                "hits": {
+                    "type": "integer"
+                },
+                "latest_version": {
+                    "type": "string"
+                },
+                "license": {
+                    "type": "string"
+                },
+                "license_category": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "vuln_count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.PackageResponse": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "ecosystem": {
+                    "type": "string"
+                },
+                "homepage": {
+                    "type": "string"
+                },
+                "latest_version": {
+                    "type": "string"
+                },
+                "license": {
+                    "type": "string"
+                },
+                "license_category": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "registry_url": {
+                    "type": "string"
+                },
+                "repository": {
+                    "type": "string"
+                },
+                "supplier_name": {
+                    "type": "string"
+                },
+                "supplier_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.PackageVersionResult": {
+            "type": "object",
+            "properties": {
+                "cached": {
+                    "type": "boolean"
+                },
+                "first_cached_at": {
+                    "type": "string"
+                },
+                "last_fetched_at": {
+                    "type": "string"
+                },
+                "license": {
+                    "type": "string"
+                },
+                "published_at": {
+                    "type": "string"
+                },
+                "version": {
                     "type": "string"
                 },
-                "size": {
-                    "type": "integer"
+                "yanked": {
+                    "type": "boolean"
                 }
             }
         },
-        "server.BrowseListResponse": {
+        "server.PackageVersionsResponse": {
             "type": "object",
             "properties": {
-                "files": {
+                "count": {
+                    "type": "integer"
+                },
+                "ecosystem": {
+                    "type": "string"
+                },
+                "metadata": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/server.BrowseFileInfo"
+                        "$ref": "#/definitions/server.MetadataFreshness"
                     }
                 },
-                "path": {
+                "name": {
                     "type": "string"
-                }
-            }
-        },
-        "server.BulkRequest": {
-            "type": "object",
-            "properties": {
-                "purls": {
+                },
+                "versions": {
                     "type": "array",
                     "items": {
-                        "type": "string"
+                        "$ref": "#/definitions/server.PackageVersionResult"
                     }
                 }
             }
         },
-        "server.BulkResponse": {
+        "server.PackagesListResponse": {
             "type": "object",
             "properties": {
-                "packages": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "$ref": "#/definitions/server.PackageResponse"
+                "count": {
+                    "type": "integer"
+                },
+                "ecosystem": {
+                    "type": "string"
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "per_page": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.PackageListResult"
                     }
+                },
+                "sort_by": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
                 }
             }
         },
-        "server.ErrorResponse": {
+        "server.PinRequest": {
             "type": "object",
             "properties": {
-                "code": {
+                "filename": {
                     "type": "string"
                 },
-                "message": {
+                "pinned": {
+                    "type": "boolean"
+                },
+                "version_purl": {
                     "type": "string"
                 }
             }
         },
-        "server.HealthCheck": {
+        "server.PinVersion": {
             "type": "object",
             "properties": {
-                "error": {
+                "ecosystem": {
                     "type": "string"
                 },
-                "status": {
+                "name": {
                     "type": "string"
                 },
-                "step": {
+                "version": {
                     "type": "string"
                 }
             }
         },
-        "server.HealthResponse": {
+        "server.PinVersionResult": {
             "type": "object",
             "properties": {
-                "checks": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "$ref": "#/definitions/server.HealthCheck"
+                "artifacts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     }
                 },
-                "status": {
-                    "type": "string"
-                }
-            }
-        },
-        "server.OutdatedPackage": {
-            "type": "object",
-            "properties": {
                 "ecosystem": {
                     "type": "string"
                 },
+                "error": {
+                    "type": "string"
+                },
+                "fetched": {
+                    "type": "boolean"
+                },
                 "name": {
                     "type": "string"
                 },
+                "purl": {
+                    "type": "string"
+                },
                 "version": {
                     "type": "string"
                 }
             }
         },
-        "server.OutdatedRequest": {
+        "server.PinVersionsRequest": {
             "type": "object",
             "properties": {
                 "packages": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/server.OutdatedPackage"
+                        "$ref": "#/definitions/server.PinVersion"
                     }
                 }
             }
         },
-        "server.OutdatedResponse": {
+        "server.PinVersionsResponse": {
             "type": "object",
             "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "pinned": {
+                    "type": "integer"
+                },
                 "results": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/server.OutdatedResult"
+                        "$ref": "#/definitions/server.PinVersionResult"
                     }
                 }
             }
         },
-        "server.OutdatedResult": {
+        "server.PolicyEventResult": {
             "type": "object",
             "properties": {
-                "ecosystem": {
+                "client_ip": {
                     "type": "string"
                 },
-                "is_outdated": {
-                    "type": "boolean"
+                "decision": {
+                    "type": "string"
                 },
-                "latest_version": {
+                "ecosystem": {
                     "type": "string"
                 },
                 "name": {
                     "type": "string"
                 },
+                "reason": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
                 "version": {
                     "type": "string"
                 }
             }
         },
-        "server.PackageListResult": {
+        "server.PolicyEventsResponse": {
             "type": "object",
             "properties": {
-                "cached_at": {
-                    "type": "string"
+                "count": {
+                    "type": "integer"
                 },
                 "ecosystem": {
                     "type": "string"
                 },
-                "hits": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.PolicyEventResult"
+                    }
+                },
+                "limit": {
                     "type": "integer"
                 },
-                "latest_version": {
-                    "type": "string"
+                "offset": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.ReconcileJob": {
+            "type": "object",
+            "properties": {
+                "checked": {
+                    "description": "Checked is the number of cached artifact rows examined so far.",
+                    "type": "integer"
                 },
-                "license": {
+                "cleared": {
+                    "description": "Cleared is the number of rows whose blob was missing. They are marked\nuncached so the next request refetches from upstream.",
+                    "type": "integer"
+                },
+                "error": {
                     "type": "string"
                 },
-                "license_category": {
+                "finished_at": {
                     "type": "string"
                 },
-                "name": {
+                "id": {
                     "type": "string"
                 },
-                "size": {
+                "orphan_count": {
+                    "description": "OrphanCount is the number of blobs with no artifact row. Orphans are\nreported, never deleted.",
                     "type": "integer"
                 },
-                "vuln_count": {
-                    "type": "integer"
+                "orphan_scan": {
+                    "description": "OrphanScan is \"skipped\" when the storage backend cannot list objects.",
+                    "type": "string"
+                },
+                "orphans": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string"
                 }
             }
         },
-        "server.PackageResponse": {
+        "server.SearchPackageResult": {
             "type": "object",
             "properties": {
-                "description": {
+                "cached_at": {
                     "type": "string"
                 },
                 "ecosystem": {
                     "type": "string"
                 },
-                "homepage": {
-                    "type": "string"
+                "hits": {
+                    "type": "integer"
                 },
                 "latest_version": {
                     "type": "string"
@@ -649,109 +2199,163 @@ const docTemplate = `{
                 "license": {
                     "type": "string"
                 },
-                "license_category": {
-                    "type": "string"
-                },
                 "name": {
                     "type": "string"
                 },
-                "registry_url": {
-                    "type": "string"
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.SearchResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
                 },
-                "repository": {
+                "query": {
                     "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.SearchPackageResult"
+                    }
                 }
             }
         },
-        "server.PackagesListResponse": {
+        "server.StatsResponse": {
             "type": "object",
             "properties": {
-                "count": {
+                "cached_artifacts": {
                     "type": "integer"
                 },
-                "ecosystem": {
+                "database_path": {
                     "type": "string"
                 },
-                "page": {
+                "storage_url": {
+                    "type": "string"
+                },
+                "total_size": {
+                    "type": "string"
+                },
+                "total_size_bytes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.TeamUsageResult": {
+            "type": "object",
+            "properties": {
+                "bytes": {
                     "type": "integer"
                 },
-                "per_page": {
+                "requests": {
                     "type": "integer"
                 },
-                "results": {
+                "team": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.UsageResponse": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "teams": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/server.PackageListResult"
+                        "$ref": "#/definitions/server.TeamUsageResult"
                     }
                 },
-                "sort_by": {
+                "to": {
                     "type": "string"
                 },
-                "total": {
+                "total_bytes": {
+                    "type": "integer"
+                },
+                "total_requests": {
                     "type": "integer"
                 }
             }
         },
-        "server.SearchPackageResult": {
+        "server.VersionResponse": {
             "type": "object",
             "properties": {
-                "cached_at": {
-                    "type": "string"
-                },
                 "ecosystem": {
                     "type": "string"
                 },
-                "hits": {
-                    "type": "integer"
-                },
-                "latest_version": {
+                "integrity": {
                     "type": "string"
                 },
+                "is_outdated": {
+                    "type": "boolean"
+                },
                 "license": {
                     "type": "string"
                 },
                 "name": {
                     "type": "string"
                 },
-                "size": {
-                    "type": "integer"
+                "published_at": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                },
+                "yanked": {
+                    "type": "boolean"
                 }
             }
         },
-        "server.SearchResponse": {
+        "server.VulnResponse": {
             "type": "object",
             "properties": {
-                "count": {
-                    "type": "integer"
+                "cvss_score": {
+                    "type": "number"
                 },
-                "query": {
+                "fixed_version": {
                     "type": "string"
                 },
-                "results": {
+                "id": {
+                    "type": "string"
+                },
+                "references": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/server.SearchPackageResult"
+                        "type": "string"
                     }
+                },
+                "severity": {
+                    "type": "string"
+                },
+                "summary": {
+                    "type": "string"
                 }
             }
         },
-        "server.StatsResponse": {
+        "server.VulnsResponse": {
             "type": "object",
             "properties": {
-                "cached_artifacts": {
+                "count": {
                     "type": "integer"
                 },
-                "database_path": {
+                "ecosystem": {
                     "type": "string"
                 },
-                "storage_url": {
+                "name": {
                     "type": "string"
                 },
-                "total_size": {
+                "version": {
                     "type": "string"
                 },
-                "total_size_bytes": {
-                    "type": "integer"
+                "vulnerabilities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.VulnResponse"
+                    }
                 }
             }
         }
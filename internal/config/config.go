@@ -48,17 +48,25 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/netip"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/git-pkgs/cooldown"
 	"github.com/git-pkgs/purl"
 	"gopkg.in/yaml.v3"
 )
@@ -72,6 +80,11 @@ type Config struct {
 	// Used for rewriting package metadata URLs and shown to humans on the
 	// install guide so they know what to point their package manager at.
 	// Example: "https://proxy.example.com" or "http://localhost:8080"
+	//
+	// Set to "auto" when the proxy is reached under several hostnames. Each
+	// request's base URL is then derived from its Host header, or from
+	// X-Forwarded-Proto and X-Forwarded-Host when it comes from one of
+	// TrustedProxies.
 	BaseURL string `json:"base_url" yaml:"base_url"`
 
 	// UIBaseURL is the public URL where the web UI is reachable. Defaults to
@@ -82,6 +95,25 @@ type Config struct {
 	// Example: "https://proxy.example.com/ui"
 	UIBaseURL string `json:"ui_base_url" yaml:"ui_base_url"`
 
+	// TrustedProxies lists the IP addresses and CIDR ranges of load
+	// balancers whose X-Forwarded-Proto and X-Forwarded-Host headers are
+	// believed when base_url is "auto". Forwarded headers from anyone else
+	// are ignored.
+	// Example: ["10.0.0.0/8", "127.0.0.1"]
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
+	// H2C accepts HTTP/2 over cleartext connections alongside HTTP/1.1, for
+	// deployments behind a load balancer that terminates TLS and forwards
+	// HTTP/2 unencrypted. Default: false
+	H2C bool `json:"h2c" yaml:"h2c"`
+
+	// TLS configures serving HTTPS directly instead of behind a proxy that
+	// terminates TLS.
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+
+	// HTTP configures extra headers sent on every response.
+	HTTP HTTPConfig `json:"http" yaml:"http"`
+
 	// Storage configures artifact storage.
 	Storage StorageConfig `json:"storage" yaml:"storage"`
 
@@ -97,6 +129,10 @@ type Config struct {
 	// Cooldown configures version age filtering to mitigate supply chain attacks.
 	Cooldown CooldownConfig `json:"cooldown" yaml:"cooldown"`
 
+	// Quarantine refuses downloads of versions published upstream too
+	// recently, unless allowlisted.
+	Quarantine QuarantineConfig `json:"quarantine" yaml:"quarantine"`
+
 	// CacheMetadata enables caching of upstream metadata responses for offline fallback.
 	// When enabled, metadata is stored in the database and storage backend.
 	// The mirror command always enables this regardless of this setting.
@@ -107,26 +143,89 @@ type Config struct {
 	// Default: "5m". Set to "0" to always revalidate.
 	MetadataTTL string `json:"metadata_ttl" yaml:"metadata_ttl"`
 
+	// Cache holds per-package overrides for metadata caching.
+	Cache CacheConfig `json:"cache" yaml:"cache"`
+
 	// MetadataMaxSize is the maximum size of an upstream metadata response
 	// the proxy will buffer (e.g. "100MB", "250MB"). Responses over this
 	// size return ErrMetadataTooLarge. Default: "100MB".
 	MetadataMaxSize string `json:"metadata_max_size" yaml:"metadata_max_size"`
 
+	// ServeBufferSize is the copy buffer used when streaming cached artifacts
+	// to clients (e.g. "32KB", "1MB"). Larger buffers mean fewer reads for
+	// multi-hundred-MB blobs. Artifacts read straight from a local file use
+	// sendfile and skip the buffer. Default: "32KB".
+	ServeBufferSize string `json:"serve_buffer_size" yaml:"serve_buffer_size"`
+
 	// HTTPTimeout is the timeout for individual upstream HTTP requests made
 	// by protocol handlers (metadata fetches, pass-through file requests).
 	// Uses Go duration syntax (e.g. "30s", "2m"). Default: "30s".
 	// Set to "0" to disable the timeout entirely.
 	HTTPTimeout string `json:"http_timeout" yaml:"http_timeout"`
 
+	// NotFoundTTL is how long an upstream 404 for an artifact download is
+	// remembered, so repeated requests for a missing version are answered
+	// without contacting upstream. Uses Go duration syntax. Default: "1m".
+	// Set to "0" to disable negative caching.
+	NotFoundTTL string `json:"not_found_ttl" yaml:"not_found_ttl"`
+
+	// ResolveCacheTTL is how long the download URL resolved for a package
+	// version is reused before asking the registry again. Uses Go duration
+	// syntax. Default: "1h". Set to "0" to disable the resolver cache.
+	ResolveCacheTTL string `json:"resolve_cache_ttl" yaml:"resolve_cache_ttl"`
+
 	// MirrorAPI enables the /api/mirror endpoints for starting mirror jobs via HTTP.
 	// Disabled by default to prevent unauthenticated users from triggering downloads.
 	MirrorAPI bool `json:"mirror_api" yaml:"mirror_api"`
 
+	// API configures the JSON /api endpoints.
+	API APIConfig `json:"api" yaml:"api"`
+
+	// Dashboard configures the HTML web UI under /ui.
+	Dashboard DashboardConfig `json:"dashboard" yaml:"dashboard"`
+
 	// Gradle configures Gradle HttpBuildCache behavior.
 	Gradle GradleConfig `json:"gradle" yaml:"gradle"`
 
 	// Health configures the /health endpoint behavior.
 	Health HealthConfig `json:"health" yaml:"health"`
+
+	// Usage configures per-team accounting of artifacts served.
+	Usage UsageConfig `json:"usage" yaml:"usage"`
+
+	// HitTimeline configures the timestamped record of artifact cache hits.
+	HitTimeline HitTimelineConfig `json:"hit_timeline" yaml:"hit_timeline"`
+
+	// Enrichment configures background package metadata enrichment.
+	Enrichment EnrichmentConfig `json:"enrichment" yaml:"enrichment"`
+
+	// Container configures the OCI/Docker registry proxy.
+	Container ContainerConfig `json:"container" yaml:"container"`
+
+	// NPM configures the npm registry proxy.
+	NPM NPMConfig `json:"npm" yaml:"npm"`
+
+	// Cargo configures the Cargo sparse index proxy.
+	Cargo CargoConfig `json:"cargo" yaml:"cargo"`
+
+	// Gem configures the RubyGems proxy.
+	Gem GemConfig `json:"gem" yaml:"gem"`
+
+	// Go configures the Go module proxy.
+	Go GoConfig `json:"go" yaml:"go"`
+
+	// Conda restricts which Conda channels are proxied.
+	Conda CondaConfig `json:"conda" yaml:"conda"`
+
+	// Debian restricts which Debian suites are proxied.
+	Debian DebianConfig `json:"debian" yaml:"debian"`
+
+	// Debug configures troubleshooting features that are unsafe to leave
+	// enabled on a shared proxy.
+	Debug DebugConfig `json:"debug" yaml:"debug"`
+
+	// Admin configures the operator endpoints that change the cache.
+	Admin AdminConfig `json:"admin" yaml:"admin"`
 }
 
 // CooldownConfig configures version cooldown periods.
@@ -171,6 +270,86 @@ func (c *CooldownConfig) NormalizedPackages() map[string]string {
 	return normalized
 }
 
+// QuarantineConfig configures the grace period before newly published
+// versions are served. Where cooldown hides young versions from metadata,
+// quarantine refuses their artifacts outright with 403, so a client that
+// already knows the version (from a lockfile, say) can't pull it either.
+type QuarantineConfig struct {
+	// Default is how long after upstream publishes a version its downloads
+	// are refused (e.g., "48h", "3d"). Default: "0" (disabled).
+	Default string `json:"default" yaml:"default"`
+
+	// Ecosystems overrides the default for specific ecosystems.
+	Ecosystems map[string]string `json:"ecosystems" yaml:"ecosystems"`
+
+	// Allow lists PURLs served during their quarantine. A package PURL
+	// allows all of its versions; a version PURL allows only that version.
+	Allow []string `json:"allow" yaml:"allow"`
+
+	// FailOpen serves versions whose publish time is unknown, or couldn't
+	// be looked up because the registry or enrichment service failed.
+	// Default: false, so such versions are refused while quarantine is on.
+	FailOpen bool `json:"fail_open" yaml:"fail_open"`
+}
+
+// Validate checks the quarantine periods and allowlist.
+func (q *QuarantineConfig) Validate() error {
+	var errs []error
+	if _, err := cooldown.ParseDuration(q.Default); err != nil {
+		errs = append(errs, fmt.Errorf("invalid quarantine.default: %w", err))
+	}
+	for eco, value := range q.Ecosystems {
+		if _, err := cooldown.ParseDuration(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid quarantine.ecosystems.%s: %w", eco, err))
+		}
+	}
+	for _, entry := range q.Allow {
+		if _, err := purl.Parse(entry); err != nil {
+			errs = append(errs, fmt.Errorf("invalid quarantine.allow entry %q: %w", entry, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseDefault returns the default quarantine period, 0 (disabled) if
+// unset or invalid.
+func (q *QuarantineConfig) ParseDefault() time.Duration {
+	d, err := cooldown.ParseDuration(q.Default)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ParseEcosystems returns the per-ecosystem quarantine periods, skipping
+// invalid entries.
+func (q *QuarantineConfig) ParseEcosystems() map[string]time.Duration {
+	if len(q.Ecosystems) == 0 {
+		return nil
+	}
+	periods := make(map[string]time.Duration, len(q.Ecosystems))
+	for eco, value := range q.Ecosystems {
+		d, err := cooldown.ParseDuration(value)
+		if err != nil || d < 0 {
+			continue
+		}
+		periods[eco] = d
+	}
+	return periods
+}
+
+// NormalizedAllow returns the allowlist in canonical PURL form, skipping
+// invalid entries.
+func (q *QuarantineConfig) NormalizedAllow() []string {
+	allow := make([]string, 0, len(q.Allow))
+	for _, entry := range q.Allow {
+		if parsed, err := purl.Parse(entry); err == nil {
+			allow = append(allow, parsed.String())
+		}
+	}
+	return allow
+}
+
 // StorageConfig configures artifact storage.
 type StorageConfig struct {
 	// URL is the storage backend URL.
@@ -206,6 +385,117 @@ type StorageConfig struct {
 	// storage at an internal address (e.g. 127.0.0.1 or a Docker hostname)
 	// but clients must use a public one.
 	DirectServeBaseURL string `json:"direct_serve_base_url" yaml:"direct_serve_base_url"`
+
+	// MaxFilenameLength caps the length in bytes of the filename part of
+	// an artifact's storage key. Longer names, and names with characters
+	// outside a safe set, are rewritten with a hash suffix.
+	// Must be between 64 and 255. Default: 200
+	MaxFilenameLength int `json:"max_filename_length" yaml:"max_filename_length"`
+
+	// Prefix namespaces every storage key this instance writes, e.g.
+	// "prod" stores artifacts under prod/npm/... Use it when several
+	// instances share one bucket. Keys already recorded in the database
+	// keep working if it changes, but new ones are written under it.
+	Prefix string `json:"prefix" yaml:"prefix"`
+
+	// ScrubInterval is how often a random sample of cached artifacts is
+	// re-read and checked against its recorded hashes (e.g., "1h").
+	// Corrupt artifacts have their cache entry cleared so the next request
+	// refetches them. Default: "0" (disabled)
+	ScrubInterval string `json:"scrub_interval" yaml:"scrub_interval"`
+
+	// ScrubSampleSize is how many artifacts each scrub checks. Default: 10
+	ScrubSampleSize int `json:"scrub_sample_size" yaml:"scrub_sample_size"`
+
+	// IdentityCheck controls what happens at startup when the database and
+	// storage don't belong together: the database was last used with a
+	// different storage URL, or the storage was written by a different
+	// database. "warn" logs it, "fail" refuses to start and "off" skips
+	// the check. Default: "warn"
+	IdentityCheck string `json:"identity_check" yaml:"identity_check"`
+
+	// AllowChange acknowledges an intentional storage move for one start:
+	// the identity check passes and the new storage is recorded. Set by
+	// serve's -allow-storage-change flag only, so it can't be left on in a
+	// config file.
+	AllowChange bool `json:"-" yaml:"-"`
+}
+
+// Storage identity check modes for storage.identity_check.
+const (
+	StorageIdentityOff  = "off"
+	StorageIdentityWarn = "warn"
+	StorageIdentityFail = "fail"
+)
+
+// defaultStorageScrubSampleSize is the number of artifacts a scrub checks
+// when storage.scrub_sample_size is unset.
+const defaultStorageScrubSampleSize = 10
+
+// Bounds for storage.max_filename_length. The minimum leaves room for the
+// hash suffix added to rewritten names; the maximum is the name limit of
+// most filesystems.
+const (
+	minStorageFilenameLength = 64
+	maxStorageFilenameLength = 255
+)
+
+// validateStoragePrefix checks that storage.prefix is a relative key path
+// made of plain segments. Surrounding slashes are allowed and ignored.
+func validateStoragePrefix(prefix string) error {
+	trimmed := strings.Trim(prefix, "/")
+	if trimmed == "" {
+		return nil
+	}
+	if strings.Contains(trimmed, "\\") {
+		return fmt.Errorf("invalid storage.prefix %q: must not contain backslashes", prefix)
+	}
+	for seg := range strings.SplitSeq(trimmed, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return fmt.Errorf("invalid storage.prefix %q: segments must not be empty, \".\" or \"..\"", prefix)
+		}
+	}
+	return nil
+}
+
+// defaultStoragePath is the storage.path that Default fills in. Every config
+// that doesn't mention storage carries it, so it alone doesn't count as
+// using the deprecated field.
+const defaultStoragePath = "./cache/artifacts"
+
+// StorageURL returns the storage backend URL. storage.url wins when set;
+// otherwise the deprecated storage.path is used as file://{path}.
+func (c *Config) StorageURL() string {
+	if c.Storage.URL != "" {
+		return c.Storage.URL
+	}
+	return "file://" + c.Storage.Path //nolint:staticcheck // backwards compat
+}
+
+// Deprecation describes a deprecated setting the config relies on.
+type Deprecation struct {
+	// Field is the deprecated config key, e.g. "storage.path".
+	Field string
+	// Replacement is the key to use instead.
+	Replacement string
+	// Detail says what the proxy does with the setting and how to migrate.
+	Detail string
+}
+
+// Deprecations lists the deprecated settings in c, for logging at startup.
+func (c *Config) Deprecations() []Deprecation {
+	var deps []Deprecation
+	path := c.Storage.Path //nolint:staticcheck // reporting deprecated use
+	if path != "" && path != defaultStoragePath {
+		d := Deprecation{Field: "storage.path", Replacement: "storage.url"}
+		if c.Storage.URL != "" {
+			d.Detail = fmt.Sprintf("ignored because storage.url is set; remove storage.path %q", path)
+		} else {
+			d.Detail = fmt.Sprintf("set storage.url to %q instead", "file://"+path)
+		}
+		deps = append(deps, d)
+	}
+	return deps
 }
 
 // GradleConfig configures Gradle-specific features.
@@ -244,6 +534,638 @@ type HealthConfig struct {
 	StorageProbeInterval string `json:"storage_probe_interval" yaml:"storage_probe_interval"`
 }
 
+// ContainerConfig configures the OCI/Docker registry proxy.
+type ContainerConfig struct {
+	// PrefetchIndex caches every platform manifest, config and layer
+	// referenced by a multi-platform image index when the index is pulled,
+	// so later pulls for other architectures are served from the cache.
+	// Disabled by default because it downloads images for all platforms.
+	PrefetchIndex bool `json:"prefetch_index" yaml:"prefetch_index"`
+}
+
+// APIConfig limits the POST /api endpoints.
+type APIConfig struct {
+	// Enabled serves the JSON /api endpoints, including the mirror API when
+	// mirror_api is set. When false they return 404. Default: true.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// MaxBodySize caps a request body (e.g. "1MB"). Larger bodies get a 413.
+	// Default: "1MB".
+	MaxBodySize string `json:"max_body_size" yaml:"max_body_size"`
+
+	// MaxItems caps the number of packages or PURLs in a single request.
+	// Requests with more get a 400. Default: 500.
+	MaxItems int `json:"max_items" yaml:"max_items"`
+
+	// RequestTimeout bounds how long one request may take, including the
+	// upstream lookups it triggers. Default: "30s".
+	RequestTimeout string `json:"request_timeout" yaml:"request_timeout"`
+
+	// DefaultPageSize is how many results the package list and search
+	// endpoints, JSON and HTML, return when the request has no per_page.
+	// Default: 50.
+	DefaultPageSize int `json:"default_page_size" yaml:"default_page_size"`
+
+	// MaxPageSize caps a requested per_page; larger values are clamped to
+	// it. Default: 200.
+	MaxPageSize int `json:"max_page_size" yaml:"max_page_size"`
+
+	// PolicyEventsMax caps the policy_events table listed by
+	// /api/policy-events; the oldest rows are pruned once it grows past
+	// this. Default: 10000
+	PolicyEventsMax int `json:"policy_events_max" yaml:"policy_events_max"`
+}
+
+// Validate checks the API limits. Unset values fall back to their defaults.
+func (a *APIConfig) Validate() error {
+	if a.MaxBodySize != "" {
+		size, err := ParseSize(a.MaxBodySize)
+		if err != nil {
+			return fmt.Errorf("invalid api.max_body_size: %w", err)
+		}
+		if size <= 0 {
+			return fmt.Errorf("invalid api.max_body_size %q: must be positive", a.MaxBodySize)
+		}
+	}
+	if a.MaxItems < 0 {
+		return fmt.Errorf("invalid api.max_items %d: must be non-negative", a.MaxItems)
+	}
+	if a.RequestTimeout != "" {
+		d, err := time.ParseDuration(a.RequestTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid api.request_timeout %q: %w", a.RequestTimeout, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid api.request_timeout %q: must be positive", a.RequestTimeout)
+		}
+	}
+	if a.DefaultPageSize < 0 {
+		return fmt.Errorf("invalid api.default_page_size %d: must be non-negative", a.DefaultPageSize)
+	}
+	if a.MaxPageSize < 0 {
+		return fmt.Errorf("invalid api.max_page_size %d: must be non-negative", a.MaxPageSize)
+	}
+	if a.DefaultPageSize > 0 && a.MaxPageSize > 0 && a.DefaultPageSize > a.MaxPageSize {
+		return fmt.Errorf("invalid api.default_page_size %d: larger than api.max_page_size %d", a.DefaultPageSize, a.MaxPageSize)
+	}
+	if a.PolicyEventsMax < 0 {
+		return fmt.Errorf("invalid api.policy_events_max %d: must be non-negative", a.PolicyEventsMax)
+	}
+	return nil
+}
+
+// AdminConfig configures the operator endpoints under /api that change
+// the cache, such as POST /api/reconcile.
+type AdminConfig struct {
+	// Token is the bearer token the operator endpoints require. They are
+	// not served while it is empty. Can reference environment variables
+	// with ${VAR_NAME} syntax.
+	Token string `json:"token" yaml:"token"`
+}
+
+// TokenValue returns the admin token with env vars expanded.
+func (a *AdminConfig) TokenValue() string {
+	return expandEnv(a.Token)
+}
+
+// CacheConfig configures per-package metadata caching behavior.
+type CacheConfig struct {
+	// TTLOverrides replaces metadata_ttl for specific packages, keyed by
+	// "ecosystem/name" (e.g. "npm/react": "30s", "npm/@babel/core": "1h").
+	// Values use Go duration syntax; "0" always revalidates. Packages
+	// without an entry use metadata_ttl.
+	TTLOverrides map[string]string `json:"ttl_overrides" yaml:"ttl_overrides"`
+
+	// AllowedArtifacts restricts, per ecosystem, which artifact filenames
+	// are fetched and cached. Entries starting with "." match a filename
+	// suffix (".tgz", ".tar.gz"); anything else is a glob matched against
+	// the filename ("*.jar", "maven-metadata.xml"). Other requests get a 404
+	// without contacting upstream. Ecosystems without an entry are
+	// unrestricted.
+	// Example: {"npm": [".tgz"], "cargo": [".crate"]}
+	AllowedArtifacts map[string][]string `json:"allowed_artifacts" yaml:"allowed_artifacts"`
+
+	// IndexOnly lists ecosystems whose artifacts are never cached. Metadata
+	// is still proxied and rewritten, but artifact downloads redirect to
+	// the upstream URL so clients fetch them from the upstream CDN.
+	// Example: ["npm", "pypi"]
+	IndexOnly []string `json:"index_only" yaml:"index_only"`
+}
+
+// Validate checks that every override key names an ecosystem and package and
+// every value is a non-negative duration, that every allowed_artifacts
+// entry is a non-empty suffix or a valid glob, and that index_only entries
+// are plain ecosystem names.
+func (c *CacheConfig) Validate() error {
+	for _, e := range c.IndexOnly {
+		if e == "" || strings.ContainsAny(e, "/ ") {
+			return fmt.Errorf("invalid cache.index_only entry %q", e)
+		}
+	}
+	for ecosystem, patterns := range c.AllowedArtifacts {
+		if len(patterns) == 0 {
+			return fmt.Errorf("invalid cache.allowed_artifacts.%s: list at least one extension or pattern", ecosystem)
+		}
+		for _, pattern := range patterns {
+			if pattern == "" || pattern == "." {
+				return fmt.Errorf("invalid cache.allowed_artifacts.%s entry %q", ecosystem, pattern)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid cache.allowed_artifacts.%s entry %q: %w", ecosystem, pattern, err)
+			}
+		}
+	}
+	for key, value := range c.TTLOverrides {
+		eco, name, ok := strings.Cut(key, "/")
+		if !ok || eco == "" || name == "" {
+			return fmt.Errorf("invalid cache.ttl_overrides key %q: must be ecosystem/name", key)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid cache.ttl_overrides[%q] %q: %w", key, value, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid cache.ttl_overrides[%q] %q: must be non-negative", key, value)
+		}
+	}
+	return nil
+}
+
+// DashboardConfig configures the HTML web UI.
+type DashboardConfig struct {
+	// Enabled serves the dashboard, search, package, browse and compare pages
+	// under /ui and redirects / to them. When false those paths return 404,
+	// which suits a pure-proxy deployment. The protocol routes, /health and
+	// /metrics are unaffected. Default: true.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+}
+
+// CargoConfig configures the Cargo sparse index proxy.
+type CargoConfig struct {
+	// IndexTTL caches per-crate sparse index files for this long, even when
+	// metadata caching is otherwise off. Stale entries are revalidated with
+	// If-None-Match/If-Modified-Since. Empty or "0" disables the index cache
+	// (default). A cache.ttl_overrides entry for the crate takes precedence.
+	IndexTTL string `json:"index_ttl" yaml:"index_ttl"`
+}
+
+// Validate checks that the index TTL is a non-negative duration.
+func (c *CargoConfig) Validate() error {
+	if c.IndexTTL == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(c.IndexTTL)
+	if err != nil {
+		return fmt.Errorf("invalid cargo.index_ttl %q: %w", c.IndexTTL, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid cargo.index_ttl %q: must not be negative", c.IndexTTL)
+	}
+	return nil
+}
+
+// NPMConfig configures the npm registry proxy.
+type NPMConfig struct {
+	// Publish accepts `npm publish` and `npm deprecate` for packages that
+	// don't exist upstream. Published packages are served only from this
+	// proxy; names already proxied from upstream can't be published, and a
+	// name outside LocalNames is only published first if upstream answers
+	// 404 for it. Other registry writes always get a 405. Requires
+	// PublishToken.
+	// Default: false
+	Publish bool `json:"publish" yaml:"publish"`
+
+	// PublishToken is the bearer token npm clients must send to publish,
+	// deprecate or unpublish, set as the registry's _authToken in .npmrc. Required when
+	// Publish is set. Can reference environment variables with ${VAR_NAME}
+	// syntax.
+	PublishToken string `json:"publish_token" yaml:"publish_token"`
+
+	// LocalNames lists package names and scopes (e.g. "@mycompany") that
+	// belong to this proxy. They can be published without checking
+	// upstream, so list only scopes you own on the public registry.
+	LocalNames []string `json:"local_names" yaml:"local_names"`
+
+	// MaxPublishSize caps the body of a single publish request, which
+	// carries the tarball base64-encoded (e.g. "100MB"). Default: "100MB"
+	MaxPublishSize string `json:"max_publish_size" yaml:"max_publish_size"`
+
+	// Unpublish accepts `npm unpublish` for packages published to this
+	// proxy, removing the version or whole package with its tarballs.
+	// Proxied packages can never be unpublished. Requires Publish.
+	// Default: false
+	Unpublish bool `json:"unpublish" yaml:"unpublish"`
+
+	// Scopes maps npm scopes to the registries their packages are fetched
+	// from, for example an internal registry for a company scope. Packages
+	// outside these scopes use upstream.npm. Scoped registries must serve
+	// tarballs at the standard /@scope/name/-/name-version.tgz path.
+	// Example: {"@mycompany": "https://npm.internal.example.com"}
+	Scopes map[string]string `json:"scopes" yaml:"scopes"`
+}
+
+// PublishTokenValue returns the npm publish token with env vars expanded.
+func (c *NPMConfig) PublishTokenValue() string {
+	return expandEnv(c.PublishToken)
+}
+
+// Validate checks that the publish size limit parses and is positive, that
+// publish has a token, that unpublish isn't enabled without publish, that
+// local names are non-empty, and that scope mappings name a scope and an
+// absolute URL.
+func (c *NPMConfig) Validate() error {
+	if c.Publish && c.PublishTokenValue() == "" {
+		return fmt.Errorf("npm.publish requires npm.publish_token")
+	}
+	for _, name := range c.LocalNames {
+		if name == "" || name == "@" || strings.ContainsAny(name, " \\") {
+			return fmt.Errorf("invalid npm.local_names entry %q", name)
+		}
+	}
+	if c.Unpublish && !c.Publish {
+		return fmt.Errorf("npm.unpublish requires npm.publish")
+	}
+	for scope, upstream := range c.Scopes {
+		if len(scope) < 2 || !strings.HasPrefix(scope, "@") || strings.ContainsAny(scope, "/ ") {
+			return fmt.Errorf("invalid npm.scopes key %q (must be a scope like \"@mycompany\")", scope)
+		}
+		if err := validateAbsoluteURL("npm.scopes."+scope, upstream); err != nil {
+			return err
+		}
+	}
+	if c.MaxPublishSize == "" {
+		return nil
+	}
+	size, err := ParseSize(c.MaxPublishSize)
+	if err != nil {
+		return fmt.Errorf("invalid npm.max_publish_size: %w", err)
+	}
+	if size <= 0 {
+		return fmt.Errorf("invalid npm.max_publish_size %q: must be > 0", c.MaxPublishSize)
+	}
+	return nil
+}
+
+// GemConfig configures the RubyGems proxy.
+type GemConfig struct {
+	// SpecsTTL caches the specs.4.8.gz indexes for this long, even when
+	// metadata caching is otherwise off. Stale indexes are revalidated with
+	// If-None-Match/If-Modified-Since. "0" disables the index cache.
+	// Default: "5m"
+	SpecsTTL string `json:"specs_ttl" yaml:"specs_ttl"`
+}
+
+// Validate checks that the specs TTL is a non-negative duration.
+func (c *GemConfig) Validate() error {
+	if c.SpecsTTL == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(c.SpecsTTL)
+	if err != nil {
+		return fmt.Errorf("invalid gem.specs_ttl %q: %w", c.SpecsTTL, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid gem.specs_ttl %q: must not be negative", c.SpecsTTL)
+	}
+	return nil
+}
+
+// GoConfig configures the Go module proxy.
+type GoConfig struct {
+	// ListTTL caches @v/list version lists for this long, even when
+	// metadata caching is otherwise off. Stale lists are revalidated with
+	// If-None-Match/If-Modified-Since. "0" disables the list cache.
+	// Default: "1m"
+	ListTTL string `json:"list_ttl" yaml:"list_ttl"`
+}
+
+// Validate checks that the list TTL is a non-negative duration.
+func (c *GoConfig) Validate() error {
+	if c.ListTTL == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(c.ListTTL)
+	if err != nil {
+		return fmt.Errorf("invalid go.list_ttl %q: %w", c.ListTTL, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid go.list_ttl %q: must not be negative", c.ListTTL)
+	}
+	return nil
+}
+
+// CondaConfig configures the Conda channel proxy.
+type CondaConfig struct {
+	// Channels lists the channels that may be proxied (e.g. "conda-forge").
+	// Requests for any other channel get a 404. Empty allows every channel.
+	Channels []string `json:"channels" yaml:"channels"`
+
+	// DefaultChannel serves requests that leave the channel out of the path,
+	// so /conda/linux-64/repodata.json is fetched from this channel. Empty
+	// means such requests get a 404. Must be in Channels when both are set.
+	DefaultChannel string `json:"default_channel" yaml:"default_channel"`
+}
+
+// Validate checks that the default channel is one of the allowed channels.
+func (c *CondaConfig) Validate() error {
+	if c.DefaultChannel != "" && len(c.Channels) > 0 && !slices.Contains(c.Channels, c.DefaultChannel) {
+		return fmt.Errorf("conda.default_channel %q is not in conda.channels", c.DefaultChannel)
+	}
+	return nil
+}
+
+// DebianConfig configures the Debian/APT repository proxy.
+type DebianConfig struct {
+	// Suites lists the suites or codenames whose dists/ metadata may be
+	// proxied (e.g. "stable", "bookworm", "bookworm-updates"). Requests for
+	// any other suite get a 404. Empty allows every suite. Package files
+	// under pool/ are shared between suites and are not filtered.
+	Suites []string `json:"suites" yaml:"suites"`
+
+	// DefaultSuite serves requests for dists/default/..., so clients can
+	// name the suite "default" in sources.list and follow whichever suite
+	// is configured here. Empty means such requests get a 404. Must be in
+	// Suites when both are set.
+	DefaultSuite string `json:"default_suite" yaml:"default_suite"`
+}
+
+// Validate checks that the default suite is a single path segment and one
+// of the allowed suites.
+func (c *DebianConfig) Validate() error {
+	if c.DefaultSuite == "" {
+		return nil
+	}
+	if strings.Contains(c.DefaultSuite, "/") || c.DefaultSuite == "default" {
+		return fmt.Errorf("debian.default_suite %q is not a suite name", c.DefaultSuite)
+	}
+	if len(c.Suites) > 0 && !slices.Contains(c.Suites, c.DefaultSuite) {
+		return fmt.Errorf("debian.default_suite %q is not in debian.suites", c.DefaultSuite)
+	}
+	return nil
+}
+
+// DebugConfig configures troubleshooting features.
+type DebugConfig struct {
+	// AllowUpstreamOverride honours an X-Proxy-Upstream request header that
+	// sends that request's upstream traffic to another base URL, bypassing
+	// the cache. Only hosts in UpstreamOverrideHosts are accepted.
+	// Disabled by default.
+	AllowUpstreamOverride bool `json:"allow_upstream_override" yaml:"allow_upstream_override"`
+
+	// UpstreamOverrideHosts lists the hostnames X-Proxy-Upstream may point at.
+	UpstreamOverrideHosts []string `json:"upstream_override_hosts" yaml:"upstream_override_hosts"`
+
+	// CacheTrace adds an X-Cache-Lookup header to artifact responses showing
+	// which cache lookup stage decided between a hit and an upstream fetch.
+	// Disabled by default.
+	CacheTrace bool `json:"cache_trace" yaml:"cache_trace"`
+
+	// AllowCacheRefresh honours X-Proxy-Refresh: true and Cache-Control:
+	// no-cache on requests, fetching metadata and artifacts from upstream
+	// even when a fresh cache entry exists and updating the cache with the
+	// result. Disabled by default.
+	AllowCacheRefresh bool `json:"allow_cache_refresh" yaml:"allow_cache_refresh"`
+
+	// CacheRefreshEcosystems limits refreshes to these ecosystems, e.g.
+	// "npm" or "pypi". Empty allows every ecosystem.
+	CacheRefreshEcosystems []string `json:"cache_refresh_ecosystems" yaml:"cache_refresh_ecosystems"`
+
+	// CacheRefreshToken must be sent in X-Proxy-Refresh-Token for a
+	// refresh to be honoured. Required when AllowCacheRefresh is set. Can
+	// reference environment variables with ${VAR_NAME} syntax.
+	CacheRefreshToken string `json:"cache_refresh_token" yaml:"cache_refresh_token"`
+
+	// Enabled serves the debug endpoints: /api/debug/upstream, the raw
+	// upstream fetch, and /api/inflight, the running downloads. Requests
+	// must send Token as a bearer token. Disabled by default.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Token is the bearer token the debug endpoints require. Required
+	// when Enabled is set. Can reference environment variables with
+	// ${VAR_NAME} syntax.
+	Token string `json:"token" yaml:"token"`
+}
+
+// TokenValue returns the debug endpoint token with env vars expanded.
+func (d *DebugConfig) TokenValue() string {
+	return expandEnv(d.Token)
+}
+
+// CacheRefreshTokenValue returns the cache refresh token with env vars
+// expanded.
+func (d *DebugConfig) CacheRefreshTokenValue() string {
+	return expandEnv(d.CacheRefreshToken)
+}
+
+// Validate checks that override hosts are bare hostnames, that the
+// override isn't enabled without any, that refresh ecosystems are plain
+// names, and that cache refresh and the debug endpoints have their tokens.
+func (d *DebugConfig) Validate() error {
+	for _, h := range d.UpstreamOverrideHosts {
+		if h == "" || strings.ContainsAny(h, "/: ") {
+			return fmt.Errorf("invalid debug.upstream_override_hosts entry %q (must be a hostname)", h)
+		}
+	}
+	if d.AllowUpstreamOverride && len(d.UpstreamOverrideHosts) == 0 {
+		return fmt.Errorf("debug.allow_upstream_override requires debug.upstream_override_hosts")
+	}
+	for _, e := range d.CacheRefreshEcosystems {
+		if e == "" || strings.ContainsAny(e, "/ ") {
+			return fmt.Errorf("invalid debug.cache_refresh_ecosystems entry %q", e)
+		}
+	}
+	if d.AllowCacheRefresh && d.CacheRefreshTokenValue() == "" {
+		return fmt.Errorf("debug.allow_cache_refresh requires debug.cache_refresh_token")
+	}
+	if d.Enabled && d.TokenValue() == "" {
+		return fmt.Errorf("debug.enabled requires debug.token")
+	}
+	return nil
+}
+
+// EnrichmentConfig configures background enrichment jobs.
+type EnrichmentConfig struct {
+	// Offline disables background jobs that query upstream registries for
+	// package metadata. Proxying and caching artifacts are unaffected.
+	Offline bool `json:"offline" yaml:"offline"`
+
+	// BackfillInterval is how often packages missing latest_version are
+	// resolved against their upstream registry. Uses Go duration syntax.
+	// Default: "1h". Set to "0" to disable the backfill.
+	BackfillInterval string `json:"backfill_interval" yaml:"backfill_interval"`
+
+	// BackfillBatchSize is the maximum number of packages resolved per run.
+	// Default: 50.
+	BackfillBatchSize int `json:"backfill_batch_size" yaml:"backfill_batch_size"`
+
+	// BackfillDelay is the pause between upstream lookups within a run, to
+	// stay under registry rate limits (e.g. "1s", "250ms"). Default: "1s".
+	BackfillDelay string `json:"backfill_delay" yaml:"backfill_delay"`
+
+	// VulnSources lists the vulnerability databases queried for advisories:
+	// "osv" and/or "ghsa" (GitHub Security Advisories). Results from several
+	// sources are merged and deduplicated by advisory ID. Default: ["osv"].
+	VulnSources []string `json:"vuln_sources" yaml:"vuln_sources"`
+
+	// GHSAToken is the GitHub API token used by the ghsa source. Optional,
+	// but unauthenticated requests are heavily rate limited.
+	// Can reference environment variables with ${VAR_NAME} syntax.
+	GHSAToken string `json:"ghsa_token" yaml:"ghsa_token"`
+}
+
+// GHSATokenValue returns the GitHub Advisory token with env vars expanded.
+func (e *EnrichmentConfig) GHSATokenValue() string {
+	return expandEnv(e.GHSAToken)
+}
+
+// TLSConfig configures native TLS serving. Both files are PEM encoded and
+// re-read when they change, so renewed certificates are picked up without
+// a restart.
+type TLSConfig struct {
+	// CertFile is the certificate chain, leaf first.
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+
+	// KeyFile is the private key for the leaf certificate.
+	KeyFile string `json:"key_file" yaml:"key_file"`
+
+	// ClientCAFile is a PEM bundle of CAs whose client certificates are
+	// verified when a client presents one. Clients without a certificate
+	// are still served. Loaded once at startup.
+	ClientCAFile string `json:"client_ca_file" yaml:"client_ca_file"`
+}
+
+// Enabled reports whether the server should serve TLS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// UsageConfig configures the access log used to attribute artifact
+// downloads to teams for chargeback.
+type UsageConfig struct {
+	// Enabled records every artifact served in the access_log table with
+	// the requesting team, ecosystem, purl and bytes sent, and serves the
+	// totals at /api/usage. Default: false
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// TeamHeader is the request header naming the team. Default: "X-Team"
+	TeamHeader string `json:"team_header" yaml:"team_header"`
+
+	// ClientCertTeam attributes requests without TeamHeader to the Common
+	// Name of the client's verified TLS certificate. Requires
+	// tls.client_ca_file. Default: false
+	ClientCertTeam bool `json:"client_cert_team" yaml:"client_cert_team"`
+
+	// MaxRows caps the access_log table; the oldest rows are pruned once it
+	// grows past this. Default: 1000000
+	MaxRows int `json:"max_rows" yaml:"max_rows"`
+}
+
+// Validate checks the team header name and row cap.
+func (u *UsageConfig) Validate() error {
+	var errs []error
+	if u.TeamHeader != "" && !validHeaderName(u.TeamHeader) {
+		errs = append(errs, fmt.Errorf("invalid usage.team_header %q", u.TeamHeader))
+	}
+	if u.MaxRows < 0 {
+		errs = append(errs, fmt.Errorf("usage.max_rows must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// HitTimelineConfig configures the artifact_hits table, which records the
+// time of every artifact cache hit so hits can be charted per day.
+type HitTimelineConfig struct {
+	// Enabled records a row per cache hit. Rows are written in batches,
+	// but this still adds database writes in proportion to traffic.
+	// Default: false
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Retention is how long individual hits are kept before being rolled
+	// up into per-day totals. Default: "168h"
+	Retention string `json:"retention" yaml:"retention"`
+
+	// DailyRetention is how long the per-day totals are kept.
+	// Default: "8760h"
+	DailyRetention string `json:"daily_retention" yaml:"daily_retention"`
+}
+
+// Validate checks the retention windows. Unset values fall back to their
+// defaults; explicit ones must parse and be positive.
+func (h *HitTimelineConfig) Validate() error {
+	for _, f := range []struct{ name, value string }{
+		{"hit_timeline.retention", h.Retention},
+		{"hit_timeline.daily_retention", h.DailyRetention},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", f.name, f.value, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid %s %q: must be positive", f.name, f.value)
+		}
+	}
+	return nil
+}
+
+// DashboardContentSecurityPolicy is a Content-Security-Policy the web UI
+// works under. The dashboard relies on inline scripts, inline styles
+// injected by Tailwind, and diff2html from jsDelivr, so a stricter policy
+// breaks it.
+const DashboardContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+
+// HTTPConfig configures response headers added by the server.
+type HTTPConfig struct {
+	// Headers are set on every response, API, dashboard and protocol
+	// endpoints alike, e.g. Strict-Transport-Security or
+	// X-Content-Type-Options. They are set before the handler runs, so a
+	// header the handler sets itself, such as Content-Type, takes
+	// precedence.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+
+	// Compression gzips dashboard and /api responses for clients that
+	// accept it. Package protocol routes are never compressed.
+	Compression CompressionConfig `json:"compression" yaml:"compression"`
+}
+
+// CompressionConfig configures response compression.
+type CompressionConfig struct {
+	// Enabled turns compression on. Default: true
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// MinSize is the smallest response that is compressed (e.g. "1KB").
+	// Smaller responses are sent as is. Default: "1KB"
+	MinSize string `json:"min_size" yaml:"min_size"`
+}
+
+// Validate checks that every header has a valid name and a value that
+// can't split the response, and that the compression threshold parses.
+func (h *HTTPConfig) Validate() error {
+	for name, value := range h.Headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid http.headers name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid http.headers value for %q: must not contain line breaks", name)
+		}
+	}
+	if h.Compression.MinSize != "" {
+		size, err := ParseSize(h.Compression.MinSize)
+		if err != nil {
+			return fmt.Errorf("invalid http.compression.min_size: %w", err)
+		}
+		if size < 0 {
+			return fmt.Errorf("invalid http.compression.min_size %q: must not be negative", h.Compression.MinSize)
+		}
+	}
+	return nil
+}
+
 // DatabaseConfig configures the cache database.
 type DatabaseConfig struct {
 	// Driver is the database driver: "sqlite" or "postgres".
@@ -254,6 +1176,22 @@ type DatabaseConfig struct {
 
 	// URL is the PostgreSQL connection string.
 	URL string `json:"url" yaml:"url"`
+
+	// BusyTimeout is how long a SQLite write waits for a lock held by
+	// another connection before failing (e.g., "5s", "30s").
+	// Ignored for postgres. Default: "5s"
+	BusyTimeout string `json:"busy_timeout" yaml:"busy_timeout"`
+
+	// VacuumInterval is how often free pages left by eviction and pruning
+	// are returned to the filesystem (e.g., "24h"). Each run waits until the
+	// proxy is idle. Ignored for postgres. Default: "0" (disabled)
+	VacuumInterval string `json:"vacuum_interval" yaml:"vacuum_interval"`
+
+	// FailClosed answers a download with 503 when the artifact it fetched
+	// can't be recorded in the database, instead of serving it uncached.
+	// The health check also fails while recording is broken, so an
+	// orchestrator can restart the proxy. Default: false
+	FailClosed bool `json:"fail_closed" yaml:"fail_closed"`
 }
 
 // String returns a human-readable description of the configured database
@@ -278,6 +1216,13 @@ type LogConfig struct {
 
 	// Format is the log format: "text" or "json".
 	Format string `json:"format" yaml:"format"`
+
+	// CacheFields adds the ecosystem, package name, version and cache
+	// status (hit, miss or bypass) of each request to its request log line,
+	// parsed from the route, for log-based analytics. Fields a request
+	// doesn't have are left out.
+	// Default: false
+	CacheFields bool `json:"cache_fields" yaml:"cache_fields"`
 }
 
 // UpstreamConfig configures upstream registry URLs and authentication.
@@ -308,6 +1253,176 @@ type UpstreamConfig struct {
 	// Keys are URL prefixes that are matched against request URLs.
 	// Example: "https://npm.pkg.github.com" matches all requests to that host.
 	Auth map[string]AuthConfig `json:"auth" yaml:"auth"`
+
+	// TrustedHosts lists, per ecosystem, additional hostnames whose URLs in
+	// upstream metadata may be rewritten to point at this proxy. These are
+	// added to the built-in defaults (e.g. files.pythonhosted.org for pypi).
+	// URLs to any other host are passed through untouched.
+	TrustedHosts map[string][]string `json:"trusted_hosts" yaml:"trusted_hosts"`
+
+	// Fallbacks lists, per ecosystem, mirror URLs that artifact downloads
+	// are retried against, in order, when the primary upstream fails or
+	// times out. The download URL keeps its path; its scheme and host are
+	// replaced by the mirror's and any path on the mirror is prepended. A
+	// 404 from the primary is final.
+	// Example: {"npm": ["https://registry.npmmirror.com"]}
+	Fallbacks map[string][]string `json:"fallbacks" yaml:"fallbacks"`
+
+	// MaxConcurrentFetches caps how many artifact downloads run against
+	// upstream at once, per ecosystem. Requests beyond the limit wait for a
+	// free slot.
+	// Default: 0 (unlimited)
+	MaxConcurrentFetches int `json:"max_concurrent_fetches" yaml:"max_concurrent_fetches"`
+
+	// FetchQueueTimeout is how long a download waits for a free slot before
+	// the request fails with 503. Only used when MaxConcurrentFetches is set.
+	// Default: 30s
+	FetchQueueTimeout string `json:"fetch_queue_timeout" yaml:"fetch_queue_timeout"`
+
+	// FetchTimeout bounds each artifact download from upstream, including
+	// writing it to storage. A download still running after this long is
+	// abandoned and the request fails with 504, freeing its fetch slot.
+	// Default: 0 (no limit beyond the server's write timeout)
+	FetchTimeout string `json:"fetch_timeout" yaml:"fetch_timeout"`
+
+	// ResponseHeaders lists extra upstream response headers to pass through
+	// to clients on requests the proxy forwards as-is. A built-in allowlist
+	// (content type, length, validators, caching) is always forwarded;
+	// anything else, such as Set-Cookie, is dropped unless named here.
+	// Example: ["X-Request-Id"]
+	ResponseHeaders []string `json:"response_headers" yaml:"response_headers"`
+
+	// SkipContentCheck turns off the check that refuses to cache a binary
+	// artifact download (tarball, wheel, zip) whose body is an HTML page or
+	// JSON object, which some registries send with a 200 for missing files.
+	// Default: false
+	SkipContentCheck bool `json:"skip_content_check" yaml:"skip_content_check"`
+
+	// NormalizeURLs canonicalizes upstream URLs before they are recorded
+	// against cached artifacts: the scheme and host are lowercased, default
+	// ports and fragments dropped, tracking query parameters such as
+	// utm_source removed and the rest of the query sorted.
+	// Default: false
+	NormalizeURLs bool `json:"normalize_urls" yaml:"normalize_urls"`
+
+	// MinTLSVersion is the lowest TLS version accepted from upstreams:
+	// "1.2" or "1.3".
+	// Default: "1.2"
+	MinTLSVersion string `json:"min_tls_version" yaml:"min_tls_version"`
+
+	// TLSCipherSuites restricts the cipher suites offered to upstreams over
+	// TLS 1.2, by IANA name. TLS 1.3 suites can't be restricted. Empty
+	// keeps Go's default list.
+	// Example: ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]
+	TLSCipherSuites []string `json:"tls_cipher_suites" yaml:"tls_cipher_suites"`
+
+	// HostTLS overrides TLS settings for individual upstream hosts, keyed
+	// by hostname or host:port. Hosts not listed keep full certificate
+	// verification.
+	// Example: {"npm.internal.example.com": {"insecure_skip_verify": true}}
+	HostTLS map[string]HostTLSConfig `json:"host_tls" yaml:"host_tls"`
+}
+
+// HostTLSConfig holds TLS overrides for one upstream host.
+type HostTLSConfig struct {
+	// InsecureSkipVerify accepts any certificate the host presents,
+	// including self-signed and expired ones. This removes protection
+	// against an attacker impersonating the host; use it only for internal
+	// registries while their certificates are being sorted out.
+	// Default: false
+	InsecureSkipVerify bool `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+}
+
+// InsecureHosts returns the upstream hosts, lower-cased, that skip
+// certificate verification.
+func (u *UpstreamConfig) InsecureHosts() []string {
+	var hosts []string
+	for host, t := range u.HostTLS {
+		if t.InsecureSkipVerify {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Validate checks that trusted host entries are bare hostnames, fallbacks
+// are absolute URLs and the fetch limit settings are usable.
+func (u *UpstreamConfig) Validate() error {
+	for ecosystem, hosts := range u.TrustedHosts {
+		for _, h := range hosts {
+			if h == "" || strings.ContainsAny(h, "/ ") {
+				return fmt.Errorf("invalid upstream.trusted_hosts.%s entry %q (must be a hostname)", ecosystem, h)
+			}
+		}
+	}
+	for ecosystem, urls := range u.Fallbacks {
+		for _, fallback := range urls {
+			if err := validateAbsoluteURL("upstream.fallbacks."+ecosystem+" entry", fallback); err != nil {
+				return err
+			}
+		}
+	}
+	if u.MaxConcurrentFetches < 0 {
+		return fmt.Errorf("invalid upstream.max_concurrent_fetches %d: must be non-negative", u.MaxConcurrentFetches)
+	}
+	if u.FetchQueueTimeout != "" {
+		d, err := time.ParseDuration(u.FetchQueueTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid upstream.fetch_queue_timeout %q: %w", u.FetchQueueTimeout, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid upstream.fetch_queue_timeout %q: must be > 0", u.FetchQueueTimeout)
+		}
+	}
+	if u.FetchTimeout != "" {
+		d, err := time.ParseDuration(u.FetchTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid upstream.fetch_timeout %q: %w", u.FetchTimeout, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid upstream.fetch_timeout %q: must not be negative", u.FetchTimeout)
+		}
+	}
+	for _, h := range u.ResponseHeaders {
+		if !validHeaderName(strings.TrimSpace(h)) {
+			return fmt.Errorf("invalid upstream.response_headers entry %q (must be a header name)", h)
+		}
+	}
+	if _, ok := tlsVersions[u.MinTLSVersion]; !ok {
+		return fmt.Errorf("invalid upstream.min_tls_version %q: must be 1.2 or 1.3", u.MinTLSVersion)
+	}
+	if len(u.TLSCipherSuites) > 0 && tlsVersions[u.MinTLSVersion] == tls.VersionTLS13 {
+		return fmt.Errorf("upstream.tls_cipher_suites has no effect with upstream.min_tls_version 1.3")
+	}
+	for _, name := range u.TLSCipherSuites {
+		if _, ok := cipherSuiteID(name); !ok {
+			return fmt.Errorf("invalid upstream.tls_cipher_suites entry %q (must be a supported, secure cipher suite name)", name)
+		}
+	}
+	for host := range u.HostTLS {
+		if host == "" || strings.ContainsAny(host, "/ *") {
+			return fmt.Errorf("invalid upstream.host_tls key %q (must be a hostname or host:port)", host)
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name
+// (an RFC 9110 token).
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // AuthForURL returns the auth config that matches the given URL.
@@ -361,7 +1476,7 @@ func Default() *Config {
 		Listen:  ":8080",
 		BaseURL: "http://localhost:8080",
 		Storage: StorageConfig{
-			Path:    "./cache/artifacts",
+			Path:    defaultStoragePath,
 			MaxSize: "",
 		},
 		Database: DatabaseConfig{
@@ -372,6 +1487,15 @@ func Default() *Config {
 			Level:  "info",
 			Format: "text",
 		},
+		API: APIConfig{
+			Enabled: true,
+		},
+		Dashboard: DashboardConfig{
+			Enabled: true,
+		},
+		HTTP: HTTPConfig{
+			Compression: CompressionConfig{Enabled: true},
+		},
 		Upstream: UpstreamConfig{
 			NPM:                "https://registry.npmjs.org",
 			Maven:              "https://repo1.maven.org/maven2",
@@ -422,17 +1546,170 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// redactedValue replaces secrets in Redacted output.
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of c that is safe to print: upstream credentials,
+// the GHSA token and the cache refresh token are replaced, and passwords embedded in the database
+// and storage URLs are masked. Values that only reference an environment
+// variable, such as "${NPM_TOKEN}", are kept since they show where the
+// secret comes from without revealing it.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Database.URL = redactURL(c.Database.URL)
+	out.Storage.URL = redactURL(c.Storage.URL)
+	out.Enrichment.GHSAToken = redactSecret(c.Enrichment.GHSAToken)
+	out.Debug.CacheRefreshToken = redactSecret(c.Debug.CacheRefreshToken)
+	out.Debug.Token = redactSecret(c.Debug.Token)
+	out.Admin.Token = redactSecret(c.Admin.Token)
+	out.NPM.PublishToken = redactSecret(c.NPM.PublishToken)
+	if c.Upstream.Auth != nil {
+		out.Upstream.Auth = make(map[string]AuthConfig, len(c.Upstream.Auth))
+		for pattern, a := range c.Upstream.Auth {
+			a.Token = redactSecret(a.Token)
+			a.Password = redactSecret(a.Password)
+			a.HeaderValue = redactSecret(a.HeaderValue)
+			out.Upstream.Auth[pattern] = a
+		}
+	}
+	return &out
+}
+
+// Marshal encodes c as "yaml" or "json".
+func (c *Config) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "yaml", "":
+		return yaml.Marshal(c)
+	case "json":
+		return json.MarshalIndent(c, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown config format %q (want yaml or json)", format)
+	}
+}
+
+func redactSecret(s string) string {
+	if s == "" || isEnvReference(s) {
+		return s
+	}
+	return redactedValue
+}
+
+// isEnvReference reports whether s is exactly one ${VAR} reference.
+func isEnvReference(s string) bool {
+	name, ok := strings.CutPrefix(s, "${")
+	if !ok {
+		return false
+	}
+	name, ok = strings.CutSuffix(name, "}")
+	return ok && name != "" && !strings.ContainsAny(name, "${}")
+}
+
+// redactURL masks a password in a URL's userinfo or query. Strings that
+// don't parse as URLs are returned unchanged.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || s == "" {
+		return s
+	}
+	changed := false
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+			changed = true
+		}
+	}
+	// Postgres also accepts the password as a query parameter.
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", redactedValue)
+		u.RawQuery = q.Encode()
+		changed = true
+	}
+	if !changed {
+		return s
+	}
+	return u.String()
+}
+
 // LoadFromEnv applies environment variable overrides to a Config.
 // Environment variables use the PROXY_ prefix:
 //   - PROXY_LISTEN
 //   - PROXY_BASE_URL
+//   - PROXY_H2C
+//   - PROXY_TLS_CERT_FILE
+//   - PROXY_TLS_KEY_FILE
+//   - PROXY_TLS_CLIENT_CA_FILE
 //   - PROXY_UI_URL
+//   - PROXY_TRUSTED_PROXIES (comma-separated)
 //   - PROXY_STORAGE_PATH
 //   - PROXY_STORAGE_MAX_SIZE
+//   - PROXY_STORAGE_MAX_FILENAME_LENGTH
+//   - PROXY_STORAGE_PREFIX
+//   - PROXY_STORAGE_SCRUB_INTERVAL
+//   - PROXY_STORAGE_SCRUB_SAMPLE_SIZE
+//   - PROXY_STORAGE_IDENTITY_CHECK
 //   - PROXY_DATABASE_PATH
+//   - PROXY_DATABASE_BUSY_TIMEOUT
+//   - PROXY_DATABASE_VACUUM_INTERVAL
+//   - PROXY_DATABASE_FAIL_CLOSED
 //   - PROXY_LOG_LEVEL
 //   - PROXY_LOG_FORMAT
+//   - PROXY_API_ENABLED
+//   - PROXY_DASHBOARD_ENABLED
+//   - PROXY_HTTP_COMPRESSION_ENABLED
+//   - PROXY_HTTP_COMPRESSION_MIN_SIZE
+//   - PROXY_API_MAX_BODY_SIZE
+//   - PROXY_API_MAX_ITEMS
+//   - PROXY_API_REQUEST_TIMEOUT
+//   - PROXY_API_DEFAULT_PAGE_SIZE
+//   - PROXY_API_MAX_PAGE_SIZE
+//   - PROXY_API_POLICY_EVENTS_MAX
+//   - PROXY_UPSTREAM_MAX_CONCURRENT_FETCHES
+//   - PROXY_UPSTREAM_FETCH_QUEUE_TIMEOUT
+//   - PROXY_UPSTREAM_FETCH_TIMEOUT
+//   - PROXY_UPSTREAM_RESPONSE_HEADERS (comma-separated)
+//   - PROXY_UPSTREAM_SKIP_CONTENT_CHECK
+//   - PROXY_UPSTREAM_NORMALIZE_URLS
+//   - PROXY_UPSTREAM_MIN_TLS_VERSION
+//   - PROXY_UPSTREAM_TLS_CIPHER_SUITES (comma-separated)
+//   - PROXY_QUARANTINE_DEFAULT
+//   - PROXY_QUARANTINE_FAIL_OPEN
 //   - PROXY_HEALTH_STORAGE_PROBE_INTERVAL
+//   - PROXY_USAGE_ENABLED
+//   - PROXY_USAGE_TEAM_HEADER
+//   - PROXY_USAGE_CLIENT_CERT_TEAM
+//   - PROXY_USAGE_MAX_ROWS
+//   - PROXY_HIT_TIMELINE_ENABLED
+//   - PROXY_HIT_TIMELINE_RETENTION
+//   - PROXY_HIT_TIMELINE_DAILY_RETENTION
+//   - PROXY_ENRICHMENT_OFFLINE
+//   - PROXY_ENRICHMENT_BACKFILL_INTERVAL
+//   - PROXY_ENRICHMENT_BACKFILL_BATCH_SIZE
+//   - PROXY_ENRICHMENT_BACKFILL_DELAY
+//   - PROXY_ENRICHMENT_VULN_SOURCES (comma-separated)
+//   - PROXY_ENRICHMENT_GHSA_TOKEN
+//   - PROXY_CONTAINER_PREFETCH_INDEX
+//   - PROXY_CARGO_INDEX_TTL
+//   - PROXY_NPM_PUBLISH
+//   - PROXY_NPM_PUBLISH_TOKEN
+//   - PROXY_NPM_LOCAL_NAMES
+//   - PROXY_NPM_MAX_PUBLISH_SIZE
+//   - PROXY_NPM_UNPUBLISH
+//   - PROXY_GEM_SPECS_TTL
+//   - PROXY_GO_LIST_TTL
+//   - PROXY_CONDA_CHANNELS (comma-separated)
+//   - PROXY_CONDA_DEFAULT_CHANNEL
+//   - PROXY_DEBIAN_SUITES (comma-separated)
+//   - PROXY_DEBIAN_DEFAULT_SUITE
+//   - PROXY_CACHE_INDEX_ONLY (comma-separated)
+//   - PROXY_DEBUG_ALLOW_UPSTREAM_OVERRIDE
+//   - PROXY_DEBUG_UPSTREAM_OVERRIDE_HOSTS (comma-separated)
+//   - PROXY_DEBUG_CACHE_TRACE
+//   - PROXY_DEBUG_ALLOW_CACHE_REFRESH
+//   - PROXY_DEBUG_CACHE_REFRESH_ECOSYSTEMS (comma-separated)
+//   - PROXY_DEBUG_CACHE_REFRESH_TOKEN
+//   - PROXY_DEBUG_ENABLED
+//   - PROXY_DEBUG_TOKEN
+//   - PROXY_ADMIN_TOKEN
 func (c *Config) LoadFromEnv() {
 	if v := os.Getenv("PROXY_LISTEN"); v != "" {
 		c.Listen = v
@@ -440,9 +1717,24 @@ func (c *Config) LoadFromEnv() {
 	if v := os.Getenv("PROXY_BASE_URL"); v != "" {
 		c.BaseURL = v
 	}
+	if v := os.Getenv("PROXY_H2C"); v != "" {
+		c.H2C = envBool(v)
+	}
+	if v := os.Getenv("PROXY_TLS_CERT_FILE"); v != "" {
+		c.TLS.CertFile = v
+	}
+	if v := os.Getenv("PROXY_TLS_KEY_FILE"); v != "" {
+		c.TLS.KeyFile = v
+	}
+	if v := os.Getenv("PROXY_TLS_CLIENT_CA_FILE"); v != "" {
+		c.TLS.ClientCAFile = v
+	}
 	if v := os.Getenv("PROXY_UI_URL"); v != "" {
 		c.UIBaseURL = v
 	}
+	if v := os.Getenv("PROXY_TRUSTED_PROXIES"); v != "" {
+		c.TrustedProxies = strings.Split(v, ",")
+	}
 	if v := os.Getenv("PROXY_STORAGE_URL"); v != "" {
 		c.Storage.URL = v
 	}
@@ -452,6 +1744,25 @@ func (c *Config) LoadFromEnv() {
 	if v := os.Getenv("PROXY_STORAGE_MAX_SIZE"); v != "" {
 		c.Storage.MaxSize = v
 	}
+	if v := os.Getenv("PROXY_STORAGE_PREFIX"); v != "" {
+		c.Storage.Prefix = v
+	}
+	if v := os.Getenv("PROXY_STORAGE_MAX_FILENAME_LENGTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Storage.MaxFilenameLength = n
+		}
+	}
+	if v := os.Getenv("PROXY_STORAGE_SCRUB_INTERVAL"); v != "" {
+		c.Storage.ScrubInterval = v
+	}
+	if v := os.Getenv("PROXY_STORAGE_SCRUB_SAMPLE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Storage.ScrubSampleSize = n
+		}
+	}
+	if v := os.Getenv("PROXY_STORAGE_IDENTITY_CHECK"); v != "" {
+		c.Storage.IdentityCheck = v
+	}
 	if v := os.Getenv("PROXY_STORAGE_DIRECT_SERVE"); v != "" {
 		c.Storage.DirectServe = envBool(v)
 	}
@@ -470,36 +1781,127 @@ func (c *Config) LoadFromEnv() {
 	if v := os.Getenv("PROXY_DATABASE_URL"); v != "" {
 		c.Database.URL = v
 	}
+	if v := os.Getenv("PROXY_DATABASE_BUSY_TIMEOUT"); v != "" {
+		c.Database.BusyTimeout = v
+	}
+	if v := os.Getenv("PROXY_DATABASE_VACUUM_INTERVAL"); v != "" {
+		c.Database.VacuumInterval = v
+	}
+	if v := os.Getenv("PROXY_DATABASE_FAIL_CLOSED"); v != "" {
+		c.Database.FailClosed = envBool(v)
+	}
 	if v := os.Getenv("PROXY_LOG_LEVEL"); v != "" {
 		c.Log.Level = v
 	}
 	if v := os.Getenv("PROXY_LOG_FORMAT"); v != "" {
 		c.Log.Format = v
 	}
+	if v := os.Getenv("PROXY_LOG_CACHE_FIELDS"); v != "" {
+		c.Log.CacheFields = envBool(v)
+	}
 	if v := os.Getenv("PROXY_UPSTREAM_MAVEN"); v != "" {
 		c.Upstream.Maven = v
 	}
 	if v := os.Getenv("PROXY_UPSTREAM_GRADLE_PLUGIN_PORTAL"); v != "" {
 		c.Upstream.GradlePluginPortal = v
 	}
+	if v := os.Getenv("PROXY_UPSTREAM_MAX_CONCURRENT_FETCHES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Upstream.MaxConcurrentFetches = n
+		}
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_FETCH_QUEUE_TIMEOUT"); v != "" {
+		c.Upstream.FetchQueueTimeout = v
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_FETCH_TIMEOUT"); v != "" {
+		c.Upstream.FetchTimeout = v
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_RESPONSE_HEADERS"); v != "" {
+		c.Upstream.ResponseHeaders = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_SKIP_CONTENT_CHECK"); v != "" {
+		c.Upstream.SkipContentCheck = envBool(v)
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_NORMALIZE_URLS"); v != "" {
+		c.Upstream.NormalizeURLs = envBool(v)
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_MIN_TLS_VERSION"); v != "" {
+		c.Upstream.MinTLSVersion = v
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_TLS_CIPHER_SUITES"); v != "" {
+		c.Upstream.TLSCipherSuites = strings.Split(v, ",")
+	}
 	if v := os.Getenv("PROXY_COOLDOWN_DEFAULT"); v != "" {
 		c.Cooldown.Default = v
 	}
+	if v := os.Getenv("PROXY_QUARANTINE_DEFAULT"); v != "" {
+		c.Quarantine.Default = v
+	}
+	if v := os.Getenv("PROXY_QUARANTINE_FAIL_OPEN"); v != "" {
+		c.Quarantine.FailOpen = envBool(v)
+	}
 	if v := os.Getenv("PROXY_CACHE_METADATA"); v != "" {
 		c.CacheMetadata = envBool(v)
 	}
 	if v := os.Getenv("PROXY_MIRROR_API"); v != "" {
 		c.MirrorAPI = envBool(v)
 	}
+	if v := os.Getenv("PROXY_API_ENABLED"); v != "" {
+		c.API.Enabled = envBool(v)
+	}
+	if v := os.Getenv("PROXY_DASHBOARD_ENABLED"); v != "" {
+		c.Dashboard.Enabled = envBool(v)
+	}
+	if v := os.Getenv("PROXY_API_MAX_BODY_SIZE"); v != "" {
+		c.API.MaxBodySize = v
+	}
+	if v := os.Getenv("PROXY_API_MAX_ITEMS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.API.MaxItems = n
+		}
+	}
+	if v := os.Getenv("PROXY_API_REQUEST_TIMEOUT"); v != "" {
+		c.API.RequestTimeout = v
+	}
+	if v := os.Getenv("PROXY_API_DEFAULT_PAGE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.API.DefaultPageSize = n
+		}
+	}
+	if v := os.Getenv("PROXY_API_MAX_PAGE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.API.MaxPageSize = n
+		}
+	}
+	if v := os.Getenv("PROXY_API_POLICY_EVENTS_MAX"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.API.PolicyEventsMax = n
+		}
+	}
 	if v := os.Getenv("PROXY_METADATA_TTL"); v != "" {
 		c.MetadataTTL = v
 	}
 	if v := os.Getenv("PROXY_METADATA_MAX_SIZE"); v != "" {
 		c.MetadataMaxSize = v
 	}
+	if v := os.Getenv("PROXY_SERVE_BUFFER_SIZE"); v != "" {
+		c.ServeBufferSize = v
+	}
+	if v := os.Getenv("PROXY_HTTP_COMPRESSION_ENABLED"); v != "" {
+		c.HTTP.Compression.Enabled = envBool(v)
+	}
+	if v := os.Getenv("PROXY_HTTP_COMPRESSION_MIN_SIZE"); v != "" {
+		c.HTTP.Compression.MinSize = v
+	}
 	if v := os.Getenv("PROXY_HTTP_TIMEOUT"); v != "" {
 		c.HTTPTimeout = v
 	}
+	if v := os.Getenv("PROXY_NOT_FOUND_TTL"); v != "" {
+		c.NotFoundTTL = v
+	}
+	if v := os.Getenv("PROXY_RESOLVE_CACHE_TTL"); v != "" {
+		c.ResolveCacheTTL = v
+	}
 	if v := os.Getenv("PROXY_GRADLE_BUILD_CACHE_READ_ONLY"); v != "" {
 		c.Gradle.BuildCache.ReadOnly = v == "true" || v == "1"
 	}
@@ -509,54 +1911,279 @@ func (c *Config) LoadFromEnv() {
 	if v := os.Getenv("PROXY_GRADLE_BUILD_CACHE_MAX_AGE"); v != "" {
 		c.Gradle.BuildCache.MaxAge = v
 	}
-	if v := os.Getenv("PROXY_GRADLE_BUILD_CACHE_MAX_SIZE"); v != "" {
-		c.Gradle.BuildCache.MaxSize = v
+	if v := os.Getenv("PROXY_GRADLE_BUILD_CACHE_MAX_SIZE"); v != "" {
+		c.Gradle.BuildCache.MaxSize = v
+	}
+	if v := os.Getenv("PROXY_GRADLE_BUILD_CACHE_SWEEP_INTERVAL"); v != "" {
+		c.Gradle.BuildCache.SweepInterval = v
+	}
+	if v := os.Getenv("PROXY_HEALTH_STORAGE_PROBE_INTERVAL"); v != "" {
+		c.Health.StorageProbeInterval = v
+	}
+	if v := os.Getenv("PROXY_USAGE_ENABLED"); v != "" {
+		c.Usage.Enabled = envBool(v)
+	}
+	if v := os.Getenv("PROXY_USAGE_TEAM_HEADER"); v != "" {
+		c.Usage.TeamHeader = v
+	}
+	if v := os.Getenv("PROXY_USAGE_CLIENT_CERT_TEAM"); v != "" {
+		c.Usage.ClientCertTeam = envBool(v)
+	}
+	if v := os.Getenv("PROXY_USAGE_MAX_ROWS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Usage.MaxRows = n
+		}
+	}
+	if v := os.Getenv("PROXY_HIT_TIMELINE_ENABLED"); v != "" {
+		c.HitTimeline.Enabled = envBool(v)
+	}
+	if v := os.Getenv("PROXY_HIT_TIMELINE_RETENTION"); v != "" {
+		c.HitTimeline.Retention = v
+	}
+	if v := os.Getenv("PROXY_HIT_TIMELINE_DAILY_RETENTION"); v != "" {
+		c.HitTimeline.DailyRetention = v
+	}
+	if v := os.Getenv("PROXY_ENRICHMENT_OFFLINE"); v != "" {
+		c.Enrichment.Offline = envBool(v)
+	}
+	if v := os.Getenv("PROXY_ENRICHMENT_BACKFILL_INTERVAL"); v != "" {
+		c.Enrichment.BackfillInterval = v
+	}
+	if v := os.Getenv("PROXY_ENRICHMENT_BACKFILL_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Enrichment.BackfillBatchSize = n
+		}
+	}
+	if v := os.Getenv("PROXY_ENRICHMENT_BACKFILL_DELAY"); v != "" {
+		c.Enrichment.BackfillDelay = v
+	}
+	if v := os.Getenv("PROXY_ENRICHMENT_VULN_SOURCES"); v != "" {
+		c.Enrichment.VulnSources = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_ENRICHMENT_GHSA_TOKEN"); v != "" {
+		c.Enrichment.GHSAToken = v
+	}
+	if v := os.Getenv("PROXY_CONTAINER_PREFETCH_INDEX"); v != "" {
+		c.Container.PrefetchIndex = envBool(v)
+	}
+	if v := os.Getenv("PROXY_CARGO_INDEX_TTL"); v != "" {
+		c.Cargo.IndexTTL = v
+	}
+	if v := os.Getenv("PROXY_NPM_PUBLISH"); v != "" {
+		c.NPM.Publish = envBool(v)
+	}
+	if v := os.Getenv("PROXY_NPM_PUBLISH_TOKEN"); v != "" {
+		c.NPM.PublishToken = v
+	}
+	if v := os.Getenv("PROXY_NPM_LOCAL_NAMES"); v != "" {
+		c.NPM.LocalNames = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_NPM_MAX_PUBLISH_SIZE"); v != "" {
+		c.NPM.MaxPublishSize = v
+	}
+	if v := os.Getenv("PROXY_NPM_UNPUBLISH"); v != "" {
+		c.NPM.Unpublish = envBool(v)
+	}
+	if v := os.Getenv("PROXY_GEM_SPECS_TTL"); v != "" {
+		c.Gem.SpecsTTL = v
+	}
+	if v := os.Getenv("PROXY_GO_LIST_TTL"); v != "" {
+		c.Go.ListTTL = v
+	}
+	if v := os.Getenv("PROXY_CONDA_CHANNELS"); v != "" {
+		c.Conda.Channels = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_CONDA_DEFAULT_CHANNEL"); v != "" {
+		c.Conda.DefaultChannel = v
+	}
+	if v := os.Getenv("PROXY_DEBIAN_SUITES"); v != "" {
+		c.Debian.Suites = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_DEBIAN_DEFAULT_SUITE"); v != "" {
+		c.Debian.DefaultSuite = v
+	}
+	if v := os.Getenv("PROXY_CACHE_INDEX_ONLY"); v != "" {
+		c.Cache.IndexOnly = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_DEBUG_ALLOW_UPSTREAM_OVERRIDE"); v != "" {
+		c.Debug.AllowUpstreamOverride = envBool(v)
+	}
+	if v := os.Getenv("PROXY_DEBUG_UPSTREAM_OVERRIDE_HOSTS"); v != "" {
+		c.Debug.UpstreamOverrideHosts = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_DEBUG_CACHE_TRACE"); v != "" {
+		c.Debug.CacheTrace = envBool(v)
+	}
+	if v := os.Getenv("PROXY_DEBUG_ALLOW_CACHE_REFRESH"); v != "" {
+		c.Debug.AllowCacheRefresh = envBool(v)
+	}
+	if v := os.Getenv("PROXY_DEBUG_CACHE_REFRESH_ECOSYSTEMS"); v != "" {
+		c.Debug.CacheRefreshEcosystems = strings.Split(v, ",")
+	}
+	if v := os.Getenv("PROXY_DEBUG_CACHE_REFRESH_TOKEN"); v != "" {
+		c.Debug.CacheRefreshToken = v
+	}
+	if v := os.Getenv("PROXY_DEBUG_ENABLED"); v != "" {
+		c.Debug.Enabled = envBool(v)
+	}
+	if v := os.Getenv("PROXY_DEBUG_TOKEN"); v != "" {
+		c.Debug.Token = v
+	}
+	if v := os.Getenv("PROXY_ADMIN_TOKEN"); v != "" {
+		c.Admin.Token = v
+	}
+}
+
+// validateAbsoluteURL returns an error if value is not a parseable URL with
+// both a scheme and host. fieldName is used in the error message.
+func validateAbsoluteURL(fieldName, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid %s %q: must be an absolute URL", fieldName, value)
+	}
+	return nil
+}
+
+// BaseURLAuto is the base_url value that turns on per-request detection.
+const BaseURLAuto = "auto"
+
+// DetectBaseURL reports whether base_url is "auto".
+func (c *Config) DetectBaseURL() bool {
+	return strings.EqualFold(c.BaseURL, BaseURLAuto)
+}
+
+// StaticBaseURL returns the configured base URL, or when base_url is "auto",
+// a localhost URL on the listen port. The latter is only used where there is
+// no request to derive one from.
+func (c *Config) StaticBaseURL() string {
+	if !c.DetectBaseURL() {
+		return c.BaseURL
+	}
+	scheme := "http"
+	if c.TLS.Enabled() {
+		scheme = "https"
+	}
+	_, port, err := net.SplitHostPort(c.Listen)
+	if err != nil || port == "" {
+		return scheme + "://localhost"
+	}
+	return scheme + "://localhost:" + port
+}
+
+// validate checks that both files are set and hold a usable key pair, so a
+// bad path or mismatched key fails at startup rather than on the first
+// handshake.
+func (t TLSConfig) validate() error {
+	if !t.Enabled() {
+		if t.ClientCAFile != "" {
+			return fmt.Errorf("tls.client_ca_file requires tls.cert_file and tls.key_file")
+		}
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+		return fmt.Errorf("loading tls certificate: %w", err)
+	}
+	if _, err := t.ClientCAs(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClientCAs loads ClientCAFile into a pool. It returns nil when no file is
+// configured.
+func (t TLSConfig) ClientCAs() (*x509.CertPool, error) {
+	if t.ClientCAFile == "" {
+		return nil, nil
 	}
-	if v := os.Getenv("PROXY_GRADLE_BUILD_CACHE_SWEEP_INTERVAL"); v != "" {
-		c.Gradle.BuildCache.SweepInterval = v
+	data, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading tls.client_ca_file: %w", err)
 	}
-	if v := os.Getenv("PROXY_HEALTH_STORAGE_PROBE_INTERVAL"); v != "" {
-		c.Health.StorageProbeInterval = v
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tls.client_ca_file %q contains no PEM certificates", t.ClientCAFile)
 	}
+	return pool, nil
 }
 
-// validateAbsoluteURL returns an error if value is not a parseable URL with
-// both a scheme and host. fieldName is used in the error message.
-func validateAbsoluteURL(fieldName, value string) error {
-	u, err := url.Parse(value)
-	if err != nil || u.Scheme == "" || u.Host == "" {
-		return fmt.Errorf("invalid %s %q: must be an absolute URL", fieldName, value)
+func validTrustedProxy(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, err := netip.ParsePrefix(entry)
+		return err == nil
 	}
-	return nil
+	_, err := netip.ParseAddr(entry)
+	return err == nil
 }
 
-// Validate checks the configuration for errors.
+// Validate checks the configuration for errors. Every problem found is
+// reported, joined into one error, so a bad config can be fixed in one pass.
 func (c *Config) Validate() error {
+	var errs []error
+
 	if c.Listen == "" {
-		return fmt.Errorf("listen address is required")
+		errs = append(errs, fmt.Errorf("listen address is required"))
 	}
 	if c.BaseURL == "" {
-		return fmt.Errorf("base_url is required")
+		errs = append(errs, fmt.Errorf("base_url is required"))
+	} else if !c.DetectBaseURL() {
+		if err := validateAbsoluteURL("base_url", c.BaseURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, entry := range c.TrustedProxies {
+		if !validTrustedProxy(entry) {
+			errs = append(errs, fmt.Errorf("invalid trusted_proxies entry %q (must be an IP address or CIDR range)", entry))
+		}
+	}
+	if err := c.TLS.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Usage.ClientCertTeam && c.TLS.ClientCAFile == "" {
+		errs = append(errs, fmt.Errorf("usage.client_cert_team requires tls.client_ca_file"))
 	}
 	if c.UIBaseURL == "" {
-		c.UIBaseURL = c.BaseURL
+		// With detection on there is no single URL to default to, so the
+		// UI goes without canonical links.
+		if !c.DetectBaseURL() {
+			c.UIBaseURL = c.BaseURL
+		}
 	} else if err := validateAbsoluteURL("ui_base_url", c.UIBaseURL); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 	if c.Storage.URL == "" && c.Storage.Path == "" {
-		return fmt.Errorf("storage.url or storage.path is required")
+		errs = append(errs, fmt.Errorf("storage.url or storage.path is required"))
 	}
 	switch c.Database.Driver {
 	case "sqlite":
 		if c.Database.Path == "" {
-			return fmt.Errorf("database.path is required for sqlite driver")
+			errs = append(errs, fmt.Errorf("database.path is required for sqlite driver"))
 		}
 	case "postgres":
 		if c.Database.URL == "" {
-			return fmt.Errorf("database.url is required for postgres driver")
+			errs = append(errs, fmt.Errorf("database.url is required for postgres driver"))
 		}
 	default:
-		return fmt.Errorf("invalid database.driver %q (must be sqlite or postgres)", c.Database.Driver)
+		errs = append(errs, fmt.Errorf("invalid database.driver %q (must be sqlite or postgres)", c.Database.Driver))
+	}
+	if c.Database.BusyTimeout != "" {
+		d, err := time.ParseDuration(c.Database.BusyTimeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid database.busy_timeout %q: %w", c.Database.BusyTimeout, err))
+		} else if d <= 0 {
+			errs = append(errs, fmt.Errorf("database.busy_timeout must be positive"))
+		}
+	}
+	if v := c.Database.VacuumInterval; v != "" && v != "0" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid database.vacuum_interval %q: %w", v, err))
+		} else if d < 0 {
+			errs = append(errs, fmt.Errorf("invalid database.vacuum_interval %q: must be non-negative", v))
+		}
 	}
 
 	// Validate log level
@@ -564,7 +2191,7 @@ func (c *Config) Validate() error {
 	case "debug", "info", "warn", "error":
 		// OK
 	default:
-		return fmt.Errorf("invalid log level %q (must be debug, info, warn, or error)", c.Log.Level)
+		errs = append(errs, fmt.Errorf("invalid log level %q (must be debug, info, warn, or error)", c.Log.Level))
 	}
 
 	// Validate log format
@@ -572,53 +2199,120 @@ func (c *Config) Validate() error {
 	case "text", "json":
 		// OK
 	default:
-		return fmt.Errorf("invalid log format %q (must be text or json)", c.Log.Format)
+		errs = append(errs, fmt.Errorf("invalid log format %q (must be text or json)", c.Log.Format))
 	}
 
 	// Validate max size if specified
 	if c.Storage.MaxSize != "" {
 		if _, err := ParseSize(c.Storage.MaxSize); err != nil {
-			return fmt.Errorf("invalid storage.max_size: %w", err)
+			errs = append(errs, fmt.Errorf("invalid storage.max_size: %w", err))
+		}
+	}
+
+	if err := validateStoragePrefix(c.Storage.Prefix); err != nil {
+		errs = append(errs, err)
+	}
+
+	if v := c.Storage.ScrubInterval; v != "" && v != "0" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid storage.scrub_interval %q: %w", v, err))
+		} else if d < 0 {
+			errs = append(errs, fmt.Errorf("invalid storage.scrub_interval %q: must be non-negative", v))
 		}
 	}
+	if c.Storage.ScrubSampleSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid storage.scrub_sample_size %d: must be non-negative", c.Storage.ScrubSampleSize))
+	}
+	switch c.Storage.IdentityCheck {
+	case "", StorageIdentityOff, StorageIdentityWarn, StorageIdentityFail:
+	default:
+		errs = append(errs, fmt.Errorf("invalid storage.identity_check %q: must be off, warn or fail", c.Storage.IdentityCheck))
+	}
 
 	// Validate direct serve TTL if specified
+	if n := c.Storage.MaxFilenameLength; n != 0 && (n < minStorageFilenameLength || n > maxStorageFilenameLength) {
+		errs = append(errs, fmt.Errorf("invalid storage.max_filename_length %d: must be between %d and %d",
+			n, minStorageFilenameLength, maxStorageFilenameLength))
+	}
 	if c.Storage.DirectServeTTL != "" {
 		if _, err := time.ParseDuration(c.Storage.DirectServeTTL); err != nil {
-			return fmt.Errorf("invalid storage.direct_serve_ttl %q: %w", c.Storage.DirectServeTTL, err)
+			errs = append(errs, fmt.Errorf("invalid storage.direct_serve_ttl %q: %w", c.Storage.DirectServeTTL, err))
 		}
 	}
 
 	// Validate direct serve base URL if specified
 	if c.Storage.DirectServeBaseURL != "" {
 		if err := validateAbsoluteURL("storage.direct_serve_base_url", c.Storage.DirectServeBaseURL); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
 
 	// Validate metadata TTL if specified
 	if c.MetadataTTL != "" && c.MetadataTTL != "0" {
 		if _, err := time.ParseDuration(c.MetadataTTL); err != nil {
-			return fmt.Errorf("invalid metadata_ttl %q: %w", c.MetadataTTL, err)
+			errs = append(errs, fmt.Errorf("invalid metadata_ttl %q: %w", c.MetadataTTL, err))
 		}
 	}
 
-	if err := validateMetadataMaxSize(c.MetadataMaxSize); err != nil {
-		return err
-	}
+	// The remaining checks are self-contained; errors.Join drops the nils.
+	errs = append(errs,
+		c.Cache.Validate(),
+		c.API.Validate(),
+		validateMetadataMaxSize(c.MetadataMaxSize),
+		validateServeBufferSize(c.ServeBufferSize),
+		validateHTTPTimeout(c.HTTPTimeout),
+		validateNotFoundTTL(c.NotFoundTTL),
+		validateResolveCacheTTL(c.ResolveCacheTTL),
+		c.Upstream.Validate(),
+		c.HTTP.Validate(),
+		c.Health.Validate(),
+		c.Usage.Validate(),
+		c.HitTimeline.Validate(),
+		c.Gradle.BuildCache.Validate(),
+		c.Enrichment.Validate(),
+		c.NPM.Validate(),
+		c.Cargo.Validate(),
+		c.Gem.Validate(),
+		c.Go.Validate(),
+		c.Conda.Validate(),
+		c.Debian.Validate(),
+		c.Debug.Validate(),
+		c.Quarantine.Validate(),
+	)
+
+	return errors.Join(errs...)
+}
 
-	if err := validateHTTPTimeout(c.HTTPTimeout); err != nil {
-		return err
+// Validate checks the enrichment settings. Unset values fall back to their
+// defaults; explicit durations must parse and be non-negative.
+func (e *EnrichmentConfig) Validate() error {
+	for _, f := range []struct{ name, value string }{
+		{"enrichment.backfill_interval", e.BackfillInterval},
+		{"enrichment.backfill_delay", e.BackfillDelay},
+	} {
+		if f.value == "" || f.value == "0" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", f.name, f.value, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid %s %q: must be non-negative", f.name, f.value)
+		}
 	}
-
-	if err := c.Health.Validate(); err != nil {
-		return err
+	if e.BackfillBatchSize < 0 {
+		return fmt.Errorf("invalid enrichment.backfill_batch_size %d: must be non-negative", e.BackfillBatchSize)
 	}
-
-	if err := c.Gradle.BuildCache.Validate(); err != nil {
-		return err
+	for _, src := range e.VulnSources {
+		switch strings.ToLower(strings.TrimSpace(src)) {
+		case "osv", "ghsa":
+			// OK
+		default:
+			return fmt.Errorf("invalid enrichment.vuln_sources entry %q (must be osv or ghsa)", src)
+		}
 	}
-
 	return nil
 }
 
@@ -678,16 +2372,180 @@ func (g *GradleBuildCacheConfig) Validate() error {
 }
 
 const (
-	defaultMetadataTTL                   = 5 * time.Minute  //nolint:mnd // sensible default
+	defaultMetadataTTL                   = 5 * time.Minute //nolint:mnd // sensible default
+	defaultGemSpecsTTL                   = 5 * time.Minute //nolint:mnd // sensible default
+	defaultGoListTTL                     = time.Minute
 	defaultDirectServeTTL                = 15 * time.Minute //nolint:mnd // sensible default
 	defaultHTTPTimeout                   = 30 * time.Second //nolint:mnd // sensible default
+	defaultNotFoundTTL                   = time.Minute
+	defaultResolveCacheTTL               = time.Hour
+	defaultFetchQueueTimeout             = 30 * time.Second
 	defaultMetadataMaxSize               = 100 << 20
+	defaultServeBufferSize               = 32 << 10
+	maxServeBufferSize                   = 64 << 20
 	defaultGradleBuildCacheMaxUploadSize = 100 << 20
 	defaultGradleBuildCacheSweepInterval = 10 * time.Minute
 	defaultGradleMaxUploadSizeStr        = "100MB"
 	defaultGradleSweepIntervalStr        = "10m"
+	defaultNPMMaxPublishSize             = 100 << 20
+	defaultCompressionMinSize            = 1 << 10
+	defaultBackfillInterval              = time.Hour
+	defaultBackfillBatchSize             = 50
+	defaultBackfillDelay                 = time.Second
+	defaultAPIMaxBodySize                = 1 << 20
+	defaultAPIMaxItems                   = 500
+	defaultAPIRequestTimeout             = 30 * time.Second
+	defaultAPIDefaultPageSize            = 50
+	defaultAPIMaxPageSize                = 200
+	defaultDatabaseBusyTimeout           = 5 * time.Second
+	defaultHitTimelineRetention          = 7 * 24 * time.Hour
+	defaultHitTimelineDailyRetention     = 365 * 24 * time.Hour
 )
 
+// ParseHitTimelineRetention returns how long individual cache hits are kept
+// before being rolled up. Returns 7 days if unset or invalid.
+func (c *Config) ParseHitTimelineRetention() time.Duration {
+	if c.HitTimeline.Retention == "" {
+		return defaultHitTimelineRetention
+	}
+	d, err := time.ParseDuration(c.HitTimeline.Retention)
+	if err != nil || d <= 0 {
+		return defaultHitTimelineRetention
+	}
+	return d
+}
+
+// ParseHitTimelineDailyRetention returns how long per-day hit totals are
+// kept. Returns 365 days if unset or invalid.
+func (c *Config) ParseHitTimelineDailyRetention() time.Duration {
+	if c.HitTimeline.DailyRetention == "" {
+		return defaultHitTimelineDailyRetention
+	}
+	d, err := time.ParseDuration(c.HitTimeline.DailyRetention)
+	if err != nil || d <= 0 {
+		return defaultHitTimelineDailyRetention
+	}
+	return d
+}
+
+// ParseStorageScrubInterval returns how often cached artifacts are
+// scrubbed. Returns 0 (disabled) if unset or invalid.
+func (c *Config) ParseStorageScrubInterval() time.Duration {
+	if c.Storage.ScrubInterval == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.Storage.ScrubInterval)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ParseStorageScrubSampleSize returns how many artifacts each scrub
+// checks. Returns 10 if unset or invalid.
+func (c *Config) ParseStorageScrubSampleSize() int {
+	if c.Storage.ScrubSampleSize <= 0 {
+		return defaultStorageScrubSampleSize
+	}
+	return c.Storage.ScrubSampleSize
+}
+
+// ParseStorageIdentityCheck returns the storage identity check mode.
+// Returns "warn" if unset or invalid.
+func (c *Config) ParseStorageIdentityCheck() string {
+	switch c.Storage.IdentityCheck {
+	case StorageIdentityOff, StorageIdentityFail:
+		return c.Storage.IdentityCheck
+	default:
+		return StorageIdentityWarn
+	}
+}
+
+// ParseDatabaseVacuumInterval returns how often the SQLite database is
+// vacuumed. Returns 0 (disabled) if unset or invalid.
+func (c *Config) ParseDatabaseVacuumInterval() time.Duration {
+	if c.Database.VacuumInterval == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.Database.VacuumInterval)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ParseDatabaseBusyTimeout returns the SQLite busy timeout.
+// Returns 5s if unset or invalid.
+func (c *Config) ParseDatabaseBusyTimeout() time.Duration {
+	if c.Database.BusyTimeout == "" {
+		return defaultDatabaseBusyTimeout
+	}
+	d, err := time.ParseDuration(c.Database.BusyTimeout)
+	if err != nil || d <= 0 {
+		return defaultDatabaseBusyTimeout
+	}
+	return d
+}
+
+// ParseAPIMaxBodySize returns the POST /api body limit in bytes.
+// Returns 1MB if unset or invalid.
+func (c *Config) ParseAPIMaxBodySize() int64 {
+	if c.API.MaxBodySize == "" {
+		return defaultAPIMaxBodySize
+	}
+	size, err := ParseSize(c.API.MaxBodySize)
+	if err != nil || size <= 0 {
+		return defaultAPIMaxBodySize
+	}
+	return size
+}
+
+// ParseAPIMaxItems returns the per-request item cap for the POST /api
+// endpoints. Returns 500 if unset.
+func (c *Config) ParseAPIMaxItems() int {
+	if c.API.MaxItems <= 0 {
+		return defaultAPIMaxItems
+	}
+	return c.API.MaxItems
+}
+
+// ParseAPIMaxPageSize returns the largest per_page the list and search
+// endpoints accept. Returns 200 if unset, raised to the default page size
+// when that is set higher.
+func (c *Config) ParseAPIMaxPageSize() int {
+	limit := c.API.MaxPageSize
+	if limit <= 0 {
+		limit = defaultAPIMaxPageSize
+	}
+	if c.API.DefaultPageSize > limit {
+		return c.API.DefaultPageSize
+	}
+	return limit
+}
+
+// ParseAPIDefaultPageSize returns the page size the list and search
+// endpoints use when the request has no per_page. Returns 50 if unset,
+// clamped to the max page size.
+func (c *Config) ParseAPIDefaultPageSize() int {
+	if c.API.DefaultPageSize <= 0 {
+		return min(defaultAPIDefaultPageSize, c.ParseAPIMaxPageSize())
+	}
+	return c.API.DefaultPageSize
+}
+
+// ParseAPIRequestTimeout returns the POST /api request timeout.
+// Returns 30s if unset or invalid.
+func (c *Config) ParseAPIRequestTimeout() time.Duration {
+	if c.API.RequestTimeout == "" {
+		return defaultAPIRequestTimeout
+	}
+	d, err := time.ParseDuration(c.API.RequestTimeout)
+	if err != nil || d <= 0 {
+		return defaultAPIRequestTimeout
+	}
+	return d
+}
+
 // ParseMaxSize returns the maximum cache size in bytes.
 // Returns 0 if unset or explicitly disabled (meaning unlimited).
 func (c *Config) ParseMaxSize() int64 {
@@ -715,6 +2573,34 @@ func validateHTTPTimeout(s string) error {
 	return nil
 }
 
+func validateNotFoundTTL(s string) error {
+	if s == "" || s == "0" {
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid not_found_ttl %q: %w", s, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid not_found_ttl %q: must be non-negative", s)
+	}
+	return nil
+}
+
+func validateResolveCacheTTL(s string) error {
+	if s == "" || s == "0" {
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid resolve_cache_ttl %q: %w", s, err)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid resolve_cache_ttl %q: must be non-negative", s)
+	}
+	return nil
+}
+
 func validateMetadataMaxSize(s string) error {
 	if s == "" {
 		return nil
@@ -742,6 +2628,33 @@ func (c *Config) ParseMetadataMaxSize() int64 {
 	return size
 }
 
+func validateServeBufferSize(s string) error {
+	if s == "" {
+		return nil
+	}
+	size, err := ParseSize(s)
+	if err != nil {
+		return fmt.Errorf("invalid serve_buffer_size: %w", err)
+	}
+	if size <= 0 || size > maxServeBufferSize {
+		return fmt.Errorf("invalid serve_buffer_size %q: must be between 1B and 64MB", s)
+	}
+	return nil
+}
+
+// ParseServeBufferSize returns the artifact copy buffer size in bytes.
+// Returns 32KB if unset or invalid.
+func (c *Config) ParseServeBufferSize() int {
+	if c.ServeBufferSize == "" {
+		return defaultServeBufferSize
+	}
+	size, err := ParseSize(c.ServeBufferSize)
+	if err != nil || size <= 0 || size > maxServeBufferSize {
+		return defaultServeBufferSize
+	}
+	return int(size)
+}
+
 // ParseHTTPTimeout returns the upstream HTTP client timeout.
 // Returns 30s if unset, 0 (no timeout) if explicitly set to "0".
 func (c *Config) ParseHTTPTimeout() time.Duration {
@@ -758,6 +2671,104 @@ func (c *Config) ParseHTTPTimeout() time.Duration {
 	return d
 }
 
+// ParseNotFoundTTL returns how long upstream 404s are negatively cached.
+// Returns 1 minute if unset or invalid, 0 if explicitly disabled.
+func (c *Config) ParseNotFoundTTL() time.Duration {
+	if c.NotFoundTTL == "" {
+		return defaultNotFoundTTL
+	}
+	if c.NotFoundTTL == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.NotFoundTTL)
+	if err != nil || d < 0 {
+		return defaultNotFoundTTL
+	}
+	return d
+}
+
+// ParseResolveCacheTTL returns how long resolved download URLs are reused.
+// Returns 1 hour if unset or invalid, 0 if explicitly disabled.
+func (c *Config) ParseResolveCacheTTL() time.Duration {
+	if c.ResolveCacheTTL == "" {
+		return defaultResolveCacheTTL
+	}
+	if c.ResolveCacheTTL == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.ResolveCacheTTL)
+	if err != nil || d < 0 {
+		return defaultResolveCacheTTL
+	}
+	return d
+}
+
+// ParseFetchQueueTimeout returns how long a download waits for a fetch slot.
+// Returns 30s if unset or invalid.
+func (c *Config) ParseFetchQueueTimeout() time.Duration {
+	if c.Upstream.FetchQueueTimeout == "" {
+		return defaultFetchQueueTimeout
+	}
+	d, err := time.ParseDuration(c.Upstream.FetchQueueTimeout)
+	if err != nil || d <= 0 {
+		return defaultFetchQueueTimeout
+	}
+	return d
+}
+
+// ParseFetchTimeout returns the deadline for a single upstream download.
+// Returns 0 (no deadline) if unset or invalid.
+func (c *Config) ParseFetchTimeout() time.Duration {
+	if c.Upstream.FetchTimeout == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.Upstream.FetchTimeout)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// tlsVersions maps the accepted upstream.min_tls_version values to their
+// crypto/tls constants. Unset means TLS 1.2.
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseMinTLSVersion returns the minimum TLS version for upstream
+// connections. Returns TLS 1.2 if unset or invalid.
+func (c *Config) ParseMinTLSVersion() uint16 {
+	if v, ok := tlsVersions[c.Upstream.MinTLSVersion]; ok {
+		return v
+	}
+	return tls.VersionTLS12
+}
+
+// ParseTLSCipherSuites returns the IDs of the configured upstream cipher
+// suites, or nil to use Go's defaults. Unknown names are skipped.
+func (c *Config) ParseTLSCipherSuites() []uint16 {
+	var ids []uint16
+	for _, name := range c.Upstream.TLSCipherSuites {
+		if id, ok := cipherSuiteID(name); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// cipherSuiteID looks up a cipher suite by IANA name among those crypto/tls
+// considers secure.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == strings.TrimSpace(name) {
+			return cs.ID, true
+		}
+	}
+	return 0, false
+}
+
 // ParseMetadataTTL returns the metadata TTL duration.
 // Returns 5 minutes if unset, 0 if explicitly disabled.
 func (c *Config) ParseMetadataTTL() time.Duration {
@@ -774,6 +2785,88 @@ func (c *Config) ParseMetadataTTL() time.Duration {
 	return d
 }
 
+// ParseMetadataTTLOverrides returns the per-package metadata TTLs keyed by
+// "ecosystem/name". Invalid entries are skipped; Validate reports them.
+func (c *Config) ParseMetadataTTLOverrides() map[string]time.Duration {
+	if len(c.Cache.TTLOverrides) == 0 {
+		return nil
+	}
+	overrides := make(map[string]time.Duration, len(c.Cache.TTLOverrides))
+	for key, value := range c.Cache.TTLOverrides {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			continue
+		}
+		overrides[key] = d
+	}
+	return overrides
+}
+
+// ParseCargoIndexTTL returns how long cargo sparse index files are cached.
+// Returns 0 (index cache off) if unset or invalid.
+func (c *Config) ParseCargoIndexTTL() time.Duration {
+	if c.Cargo.IndexTTL == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.Cargo.IndexTTL)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ParseGemSpecsTTL returns how long the gem specs indexes are cached.
+// Returns 5 minutes if unset or invalid, 0 if explicitly disabled.
+func (c *Config) ParseGemSpecsTTL() time.Duration {
+	if c.Gem.SpecsTTL == "" {
+		return defaultGemSpecsTTL
+	}
+	d, err := time.ParseDuration(c.Gem.SpecsTTL)
+	if err != nil || d < 0 {
+		return defaultGemSpecsTTL
+	}
+	return d
+}
+
+// ParseGoListTTL returns how long Go @v/list responses are cached.
+// Returns 1 minute if unset or invalid, 0 if explicitly disabled.
+func (c *Config) ParseGoListTTL() time.Duration {
+	if c.Go.ListTTL == "" {
+		return defaultGoListTTL
+	}
+	d, err := time.ParseDuration(c.Go.ListTTL)
+	if err != nil || d < 0 {
+		return defaultGoListTTL
+	}
+	return d
+}
+
+// ParseCompressionMinSize returns the smallest response size that is
+// compressed. Defaults to 1KB if unset or invalid.
+func (c *Config) ParseCompressionMinSize() int {
+	if c.HTTP.Compression.MinSize == "" {
+		return defaultCompressionMinSize
+	}
+	size, err := ParseSize(c.HTTP.Compression.MinSize)
+	if err != nil || size < 0 {
+		return defaultCompressionMinSize
+	}
+	return int(size)
+}
+
+// ParseNPMMaxPublishSize returns the max accepted npm publish body size.
+// Defaults to 100MB if unset or invalid.
+func (c *Config) ParseNPMMaxPublishSize() int64 {
+	if c.NPM.MaxPublishSize == "" {
+		return defaultNPMMaxPublishSize
+	}
+	size, err := ParseSize(c.NPM.MaxPublishSize)
+	if err != nil || size <= 0 {
+		return defaultNPMMaxPublishSize
+	}
+	return size
+}
+
 // ParseGradleBuildCacheMaxUploadSize returns the max accepted PUT body size.
 // Defaults to 100MB if unset or invalid.
 func (c *Config) ParseGradleBuildCacheMaxUploadSize() int64 {
@@ -923,3 +3016,45 @@ func expandEnv(s string) string {
 func envBool(v string) bool {
 	return v == "true" || v == "1"
 }
+
+// ParseBackfillInterval returns how often the latest_version backfill runs.
+// Returns 1h if unset or invalid, and 0 (disabled) if explicitly set to "0"
+// or when enrichment is offline.
+func (c *Config) ParseBackfillInterval() time.Duration {
+	if c.Enrichment.Offline || c.Enrichment.BackfillInterval == "0" {
+		return 0
+	}
+	if c.Enrichment.BackfillInterval == "" {
+		return defaultBackfillInterval
+	}
+	d, err := time.ParseDuration(c.Enrichment.BackfillInterval)
+	if err != nil || d < 0 {
+		return defaultBackfillInterval
+	}
+	return d
+}
+
+// ParseBackfillBatchSize returns the number of packages resolved per backfill
+// run. Defaults to 50 if unset.
+func (c *Config) ParseBackfillBatchSize() int {
+	if c.Enrichment.BackfillBatchSize <= 0 {
+		return defaultBackfillBatchSize
+	}
+	return c.Enrichment.BackfillBatchSize
+}
+
+// ParseBackfillDelay returns the pause between backfill lookups.
+// Returns 1s if unset or invalid, 0 if explicitly set to "0".
+func (c *Config) ParseBackfillDelay() time.Duration {
+	if c.Enrichment.BackfillDelay == "" {
+		return defaultBackfillDelay
+	}
+	if c.Enrichment.BackfillDelay == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(c.Enrichment.BackfillDelay)
+	if err != nil || d < 0 {
+		return defaultBackfillDelay
+	}
+	return d
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"crypto/tls"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -60,6 +63,16 @@ func TestValidate(t *testing.T) {
 			modify:  func(c *Config) { c.BaseURL = "" },
 			wantErr: true,
 		},
+		{
+			name:    "relative base_url",
+			modify:  func(c *Config) { c.BaseURL = "/proxy" },
+			wantErr: true,
+		},
+		{
+			name:    "base_url without scheme",
+			modify:  func(c *Config) { c.BaseURL = "proxy.example.com" },
+			wantErr: true,
+		},
 		{
 			name:    "empty storage path and url",
 			modify:  func(c *Config) { c.Storage.Path = ""; c.Storage.URL = "" },
@@ -506,6 +519,44 @@ func TestValidateMetadataMaxSize(t *testing.T) {
 	}
 }
 
+func TestParseServeBufferSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size string
+		want int
+	}{
+		{"unset uses default", "", defaultServeBufferSize},
+		{"explicit value", "1MB", 1 << 20},
+		{"invalid uses default", "big", defaultServeBufferSize},
+		{"over limit uses default", "1GB", defaultServeBufferSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.ServeBufferSize = tt.size
+			got := cfg.ParseServeBufferSize()
+			if got != tt.want {
+				t.Errorf("ParseServeBufferSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateServeBufferSize(t *testing.T) {
+	cfg := Default()
+	for _, bad := range []string{"huge", "0", "128MB"} {
+		cfg.ServeBufferSize = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected validation error for serve_buffer_size %q", bad)
+		}
+	}
+
+	cfg.ServeBufferSize = "256KB"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error for valid serve_buffer_size: %v", err)
+	}
+}
+
 func TestValidateMetadataTTL(t *testing.T) {
 	cfg := Default()
 	cfg.MetadataTTL = "invalid"
@@ -577,6 +628,64 @@ func TestParseHTTPTimeout(t *testing.T) {
 	}
 }
 
+func TestParseNotFoundTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  string
+		want time.Duration
+	}{
+		{"empty defaults to 1m", "", time.Minute},
+		{"explicit zero disables", "0", 0},
+		{"30 seconds", "30s", 30 * time.Second},
+		{"invalid defaults to 1m", "soon", time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.NotFoundTTL = tt.ttl
+			if got := cfg.ParseNotFoundTTL(); got != tt.want {
+				t.Errorf("ParseNotFoundTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	cfg := Default()
+	cfg.NotFoundTTL = "-1m"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for negative not_found_ttl")
+	}
+}
+
+func TestParseResolveCacheTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  string
+		want time.Duration
+	}{
+		{"empty defaults to 1h", "", time.Hour},
+		{"explicit zero disables", "0", 0},
+		{"ten minutes", "10m", 10 * time.Minute},
+		{"invalid defaults to 1h", "later", time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.ResolveCacheTTL = tt.ttl
+			if got := cfg.ParseResolveCacheTTL(); got != tt.want {
+				t.Errorf("ParseResolveCacheTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	cfg := Default()
+	cfg.ResolveCacheTTL = "-1h"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for negative resolve_cache_ttl")
+	}
+}
+
 func TestValidateHTTPTimeout(t *testing.T) {
 	cfg := Default()
 	cfg.HTTPTimeout = "not-a-duration"
@@ -749,6 +858,32 @@ func TestValidateUIBaseURL(t *testing.T) {
 	}
 }
 
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := Default()
+	cfg.BaseURL = "proxy.example.com"
+	cfg.Database.Driver = testDriverPostgres
+	cfg.Database.URL = ""
+	cfg.Storage.MaxSize = testInvalid
+	cfg.Log.Level = testInvalid
+	cfg.Log.Format = testInvalid
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"base_url",
+		"database.url is required for postgres driver",
+		"storage.max_size",
+		"invalid log level",
+		"invalid log format",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+}
+
 func TestValidateDirectServeBaseURL(t *testing.T) {
 	cfg := Default()
 
@@ -788,3 +923,1412 @@ func TestDatabaseConfigString(t *testing.T) {
 		}
 	}
 }
+
+func TestParseEnrichmentBackfillConfig(t *testing.T) {
+	cfg := Default()
+
+	if got := cfg.ParseBackfillInterval(); got != time.Hour {
+		t.Errorf("ParseBackfillInterval() = %v, want %v", got, time.Hour)
+	}
+	if got := cfg.ParseBackfillBatchSize(); got != 50 {
+		t.Errorf("ParseBackfillBatchSize() = %d, want 50", got)
+	}
+	if got := cfg.ParseBackfillDelay(); got != time.Second {
+		t.Errorf("ParseBackfillDelay() = %v, want %v", got, time.Second)
+	}
+
+	cfg.Enrichment.BackfillInterval = "30m"
+	cfg.Enrichment.BackfillBatchSize = 10
+	cfg.Enrichment.BackfillDelay = "0"
+
+	if got := cfg.ParseBackfillInterval(); got != 30*time.Minute {
+		t.Errorf("ParseBackfillInterval() = %v, want %v", got, 30*time.Minute)
+	}
+	if got := cfg.ParseBackfillBatchSize(); got != 10 {
+		t.Errorf("ParseBackfillBatchSize() = %d, want 10", got)
+	}
+	if got := cfg.ParseBackfillDelay(); got != 0 {
+		t.Errorf("ParseBackfillDelay() = %v, want 0", got)
+	}
+
+	cfg.Enrichment.Offline = true
+	if got := cfg.ParseBackfillInterval(); got != 0 {
+		t.Errorf("ParseBackfillInterval() in offline mode = %v, want 0", got)
+	}
+}
+
+func TestValidateEnrichmentConfig(t *testing.T) {
+	cfg := Default()
+	cfg.Enrichment.BackfillInterval = "soon"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for invalid enrichment.backfill_interval")
+	}
+
+	cfg.Enrichment.BackfillInterval = "2h"
+	cfg.Enrichment.BackfillDelay = "-1s"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for negative enrichment.backfill_delay")
+	}
+
+	cfg.Enrichment.BackfillDelay = "500ms"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error for valid enrichment config: %v", err)
+	}
+}
+
+func TestValidateUpstreamTrustedHosts(t *testing.T) {
+	cfg := Default()
+	cfg.Upstream.TrustedHosts = map[string][]string{"npm": {"https://npm.example.com"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for trusted host with scheme")
+	}
+
+	cfg.Upstream.TrustedHosts = map[string][]string{"npm": {"npm.example.com"}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error for valid trusted hosts: %v", err)
+	}
+}
+
+func TestValidateUpstreamFetchLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		timeout string
+		wantErr bool
+	}{
+		{"unset", 0, "", false},
+		{"limit with default timeout", 8, "", false},
+		{"limit with timeout", 8, "1m", false},
+		{"negative limit", -1, "", true},
+		{"bad timeout", 8, "soon", true},
+		{"zero timeout", 8, "0s", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Upstream.MaxConcurrentFetches = tt.max
+			cfg.Upstream.FetchQueueTimeout = tt.timeout
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadUpstreamFetchLimitFromEnv(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseFetchQueueTimeout(); got != 30*time.Second {
+		t.Errorf("ParseFetchQueueTimeout() default = %v, want 30s", got)
+	}
+
+	t.Setenv("PROXY_UPSTREAM_MAX_CONCURRENT_FETCHES", "4")
+	t.Setenv("PROXY_UPSTREAM_FETCH_QUEUE_TIMEOUT", "2m")
+	cfg.LoadFromEnv()
+
+	if cfg.Upstream.MaxConcurrentFetches != 4 {
+		t.Errorf("Upstream.MaxConcurrentFetches = %d, want 4", cfg.Upstream.MaxConcurrentFetches)
+	}
+	if got := cfg.ParseFetchQueueTimeout(); got != 2*time.Minute {
+		t.Errorf("ParseFetchQueueTimeout() = %v, want 2m", got)
+	}
+}
+
+func TestValidateAPILimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     APIConfig
+		wantErr bool
+	}{
+		{"unset", APIConfig{}, false},
+		{"valid", APIConfig{MaxBodySize: "4MB", MaxItems: 1000, RequestTimeout: "1m"}, false},
+		{"bad size", APIConfig{MaxBodySize: "lots"}, true},
+		{"zero size", APIConfig{MaxBodySize: "0"}, true},
+		{"negative items", APIConfig{MaxItems: -1}, true},
+		{"bad timeout", APIConfig{RequestTimeout: "soon"}, true},
+		{"zero timeout", APIConfig{RequestTimeout: "0s"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.API = tt.api
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadAPILimitsFromEnv(t *testing.T) {
+	cfg := Default()
+	if cfg.ParseAPIMaxBodySize() != 1<<20 || cfg.ParseAPIMaxItems() != 500 || cfg.ParseAPIRequestTimeout() != 30*time.Second {
+		t.Errorf("defaults = %d, %d, %v; want 1MB, 500, 30s",
+			cfg.ParseAPIMaxBodySize(), cfg.ParseAPIMaxItems(), cfg.ParseAPIRequestTimeout())
+	}
+
+	t.Setenv("PROXY_API_MAX_BODY_SIZE", "2MB")
+	t.Setenv("PROXY_API_MAX_ITEMS", "50")
+	t.Setenv("PROXY_API_REQUEST_TIMEOUT", "5s")
+	cfg.LoadFromEnv()
+
+	if got := cfg.ParseAPIMaxBodySize(); got != 2<<20 {
+		t.Errorf("ParseAPIMaxBodySize() = %d, want 2MB", got)
+	}
+	if got := cfg.ParseAPIMaxItems(); got != 50 {
+		t.Errorf("ParseAPIMaxItems() = %d, want 50", got)
+	}
+	if got := cfg.ParseAPIRequestTimeout(); got != 5*time.Second {
+		t.Errorf("ParseAPIRequestTimeout() = %v, want 5s", got)
+	}
+}
+
+func TestAPIPolicyEventsMax(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_API_POLICY_EVENTS_MAX", "500")
+	cfg.LoadFromEnv()
+	if cfg.API.PolicyEventsMax != 500 {
+		t.Errorf("PolicyEventsMax = %d, want 500", cfg.API.PolicyEventsMax)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	cfg.API.PolicyEventsMax = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted a negative api.policy_events_max")
+	}
+}
+
+func TestAPIPageSize(t *testing.T) {
+	cfg := Default()
+	if got, limit := cfg.ParseAPIDefaultPageSize(), cfg.ParseAPIMaxPageSize(); got != 50 || limit != 200 {
+		t.Errorf("defaults = %d, %d; want 50, 200", got, limit)
+	}
+
+	t.Setenv("PROXY_API_DEFAULT_PAGE_SIZE", "25")
+	t.Setenv("PROXY_API_MAX_PAGE_SIZE", "100")
+	cfg.LoadFromEnv()
+	if got, limit := cfg.ParseAPIDefaultPageSize(), cfg.ParseAPIMaxPageSize(); got != 25 || limit != 100 {
+		t.Errorf("from env = %d, %d; want 25, 100", got, limit)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	cfg = Default()
+	cfg.API.MaxPageSize = 20
+	if got := cfg.ParseAPIDefaultPageSize(); got != 20 {
+		t.Errorf("default with max 20 = %d, want 20", got)
+	}
+
+	cfg = Default()
+	cfg.API.DefaultPageSize = 500
+	if got := cfg.ParseAPIMaxPageSize(); got != 500 {
+		t.Errorf("max with default 500 = %d, want 500", got)
+	}
+
+	for _, api := range []APIConfig{
+		{DefaultPageSize: -1},
+		{MaxPageSize: -1},
+		{DefaultPageSize: 100, MaxPageSize: 10},
+	} {
+		cfg := Default()
+		cfg.API.DefaultPageSize = api.DefaultPageSize
+		cfg.API.MaxPageSize = api.MaxPageSize
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted default_page_size %d, max_page_size %d", api.DefaultPageSize, api.MaxPageSize)
+		}
+	}
+}
+
+func TestValidateCacheTTLOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		wantErr   bool
+	}{
+		{"unset", nil, false},
+		{"valid", map[string]string{"npm/react": "30s", "npm/@babel/core": "1h", "pypi/requests": "0"}, false},
+		{"missing name", map[string]string{"npm/": "30s"}, true},
+		{"missing ecosystem", map[string]string{"react": "30s"}, true},
+		{"bad duration", map[string]string{"npm/react": "soon"}, true},
+		{"negative", map[string]string{"npm/react": "-1m"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Cache.TTLOverrides = tt.overrides
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCacheAllowedArtifacts(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed map[string][]string
+		wantErr bool
+	}{
+		{"unset", nil, false},
+		{"valid", map[string][]string{"npm": {".tgz"}, "maven": {".jar", "maven-metadata*.xml"}}, false},
+		{"empty list", map[string][]string{"npm": {}}, true},
+		{"empty entry", map[string][]string{"npm": {""}}, true},
+		{"bad glob", map[string][]string{"npm": {"[.tgz"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Cache.AllowedArtifacts = tt.allowed
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheIndexOnly(t *testing.T) {
+	t.Setenv("PROXY_CACHE_INDEX_ONLY", "npm,pypi")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	if len(cfg.Cache.IndexOnly) != 2 || cfg.Cache.IndexOnly[0] != "npm" || cfg.Cache.IndexOnly[1] != "pypi" {
+		t.Errorf("Cache.IndexOnly = %v, want [npm pypi]", cfg.Cache.IndexOnly)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	cfg.Cache.IndexOnly = []string{"npm/lodash"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for an index_only entry that isn't an ecosystem name")
+	}
+}
+
+func TestParseMetadataTTLOverrides(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseMetadataTTLOverrides(); got != nil {
+		t.Errorf("ParseMetadataTTLOverrides() = %v, want nil when unset", got)
+	}
+
+	cfg.Cache.TTLOverrides = map[string]string{"npm/react": "30s", "npm/lodash": "24h"}
+	got := cfg.ParseMetadataTTLOverrides()
+	if got["npm/react"] != 30*time.Second || got["npm/lodash"] != 24*time.Hour {
+		t.Errorf("ParseMetadataTTLOverrides() = %v", got)
+	}
+}
+
+func TestValidateCondaDefaultChannel(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []string
+		def      string
+		wantErr  bool
+	}{
+		{"unset", nil, "", false},
+		{"default without allowlist", nil, "conda-forge", false},
+		{"default in allowlist", []string{"conda-forge", "bioconda"}, "conda-forge", false},
+		{"default not in allowlist", []string{"bioconda"}, "conda-forge", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Conda.Channels = tt.channels
+			cfg.Conda.DefaultChannel = tt.def
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDebianDefaultSuite(t *testing.T) {
+	tests := []struct {
+		name    string
+		suites  []string
+		def     string
+		wantErr bool
+	}{
+		{"unset", nil, "", false},
+		{"default without allowlist", nil, "bookworm", false},
+		{"default in allowlist", []string{"stable", "bookworm"}, "bookworm", false},
+		{"default not in allowlist", []string{"stable"}, "sid", true},
+		{"path in default", nil, "bookworm/updates", true},
+		{"default names itself", nil, "default", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Debian.Suites = tt.suites
+			cfg.Debian.DefaultSuite = tt.def
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadChannelAllowlistsFromEnv(t *testing.T) {
+	t.Setenv("PROXY_CONDA_CHANNELS", "conda-forge,bioconda")
+	t.Setenv("PROXY_CONDA_DEFAULT_CHANNEL", "conda-forge")
+	t.Setenv("PROXY_DEBIAN_SUITES", "stable,bookworm")
+	t.Setenv("PROXY_DEBIAN_DEFAULT_SUITE", "bookworm")
+
+	cfg := Default()
+	cfg.LoadFromEnv()
+
+	if len(cfg.Conda.Channels) != 2 || cfg.Conda.Channels[1] != "bioconda" {
+		t.Errorf("Conda.Channels = %v, want [conda-forge bioconda]", cfg.Conda.Channels)
+	}
+	if cfg.Conda.DefaultChannel != "conda-forge" {
+		t.Errorf("Conda.DefaultChannel = %q, want conda-forge", cfg.Conda.DefaultChannel)
+	}
+	if len(cfg.Debian.Suites) != 2 || cfg.Debian.Suites[0] != "stable" {
+		t.Errorf("Debian.Suites = %v, want [stable bookworm]", cfg.Debian.Suites)
+	}
+	if cfg.Debian.DefaultSuite != "bookworm" {
+		t.Errorf("Debian.DefaultSuite = %q, want bookworm", cfg.Debian.DefaultSuite)
+	}
+}
+
+func TestDashboardAndAPIToggles(t *testing.T) {
+	cfg := Default()
+	if !cfg.Dashboard.Enabled || !cfg.API.Enabled {
+		t.Fatalf("defaults: dashboard = %v, api = %v; want both enabled", cfg.Dashboard.Enabled, cfg.API.Enabled)
+	}
+
+	t.Setenv("PROXY_DASHBOARD_ENABLED", "false")
+	cfg.LoadFromEnv()
+	if cfg.Dashboard.Enabled {
+		t.Error("PROXY_DASHBOARD_ENABLED=false did not disable the dashboard")
+	}
+	if !cfg.API.Enabled {
+		t.Error("disabling the dashboard should leave the API enabled")
+	}
+
+	t.Setenv("PROXY_API_ENABLED", "false")
+	cfg.LoadFromEnv()
+	if cfg.API.Enabled {
+		t.Error("PROXY_API_ENABLED=false did not disable the API")
+	}
+}
+
+func TestCargoIndexTTL(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseCargoIndexTTL(); got != 0 {
+		t.Errorf("default ParseCargoIndexTTL() = %v, want 0", got)
+	}
+
+	t.Setenv("PROXY_CARGO_INDEX_TTL", "30s")
+	cfg.LoadFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseCargoIndexTTL(); got != 30*time.Second {
+		t.Errorf("ParseCargoIndexTTL() = %v, want 30s", got)
+	}
+
+	for _, bad := range []string{"soon", "-1m"} {
+		cfg.Cargo.IndexTTL = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted cargo.index_ttl %q", bad)
+		}
+	}
+}
+
+func TestDatabaseBusyTimeout(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseDatabaseBusyTimeout(); got != 5*time.Second {
+		t.Errorf("default ParseDatabaseBusyTimeout() = %v, want 5s", got)
+	}
+
+	t.Setenv("PROXY_DATABASE_BUSY_TIMEOUT", "30s")
+	cfg.LoadFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseDatabaseBusyTimeout(); got != 30*time.Second {
+		t.Errorf("ParseDatabaseBusyTimeout() = %v, want 30s", got)
+	}
+
+	for _, bad := range []string{"soon", "0s", "-1s"} {
+		cfg.Database.BusyTimeout = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted database.busy_timeout %q", bad)
+		}
+	}
+}
+
+func TestDatabaseVacuumInterval(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseDatabaseVacuumInterval(); got != 0 {
+		t.Errorf("default ParseDatabaseVacuumInterval() = %v, want 0", got)
+	}
+
+	t.Setenv("PROXY_DATABASE_VACUUM_INTERVAL", "24h")
+	cfg.LoadFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseDatabaseVacuumInterval(); got != 24*time.Hour {
+		t.Errorf("ParseDatabaseVacuumInterval() = %v, want 24h", got)
+	}
+
+	for _, bad := range []string{"daily", "-1h"} {
+		cfg.Database.VacuumInterval = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted database.vacuum_interval %q", bad)
+		}
+	}
+}
+
+func TestStorageScrub(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseStorageScrubInterval(); got != 0 {
+		t.Errorf("default ParseStorageScrubInterval() = %v, want 0", got)
+	}
+	if got := cfg.ParseStorageScrubSampleSize(); got != 10 {
+		t.Errorf("default ParseStorageScrubSampleSize() = %d, want 10", got)
+	}
+
+	t.Setenv("PROXY_STORAGE_SCRUB_INTERVAL", "1h")
+	t.Setenv("PROXY_STORAGE_SCRUB_SAMPLE_SIZE", "50")
+	cfg.LoadFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseStorageScrubInterval(); got != time.Hour {
+		t.Errorf("ParseStorageScrubInterval() = %v, want 1h", got)
+	}
+	if got := cfg.ParseStorageScrubSampleSize(); got != 50 {
+		t.Errorf("ParseStorageScrubSampleSize() = %d, want 50", got)
+	}
+
+	for _, bad := range []string{"hourly", "-1h"} {
+		cfg.Storage.ScrubInterval = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted storage.scrub_interval %q", bad)
+		}
+	}
+	cfg.Storage.ScrubInterval = "1h"
+	cfg.Storage.ScrubSampleSize = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted a negative storage.scrub_sample_size")
+	}
+}
+
+func TestValidateEnrichmentVulnSources(t *testing.T) {
+	cfg := Default()
+	cfg.Enrichment.VulnSources = []string{"osv", "nvd"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for unknown vuln source")
+	}
+
+	cfg.Enrichment.VulnSources = []string{"osv", "ghsa"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error for valid vuln sources: %v", err)
+	}
+}
+
+func TestLoadEnrichmentVulnSourcesFromEnv(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_ENRICHMENT_VULN_SOURCES", "osv,ghsa")
+	t.Setenv("TEST_GHSA_TOKEN", "secret")
+	t.Setenv("PROXY_ENRICHMENT_GHSA_TOKEN", "${TEST_GHSA_TOKEN}")
+	cfg.LoadFromEnv()
+
+	if len(cfg.Enrichment.VulnSources) != 2 || cfg.Enrichment.VulnSources[1] != "ghsa" {
+		t.Errorf("Enrichment.VulnSources = %v, want [osv ghsa]", cfg.Enrichment.VulnSources)
+	}
+	if got := cfg.Enrichment.GHSATokenValue(); got != "secret" {
+		t.Errorf("GHSATokenValue() = %q, want %q", got, "secret")
+	}
+}
+
+func TestLoadEnrichmentFromEnv(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_ENRICHMENT_OFFLINE", "true")
+	t.Setenv("PROXY_ENRICHMENT_BACKFILL_BATCH_SIZE", "25")
+	cfg.LoadFromEnv()
+
+	if !cfg.Enrichment.Offline {
+		t.Error("Enrichment.Offline = false, want true")
+	}
+	if cfg.Enrichment.BackfillBatchSize != 25 {
+		t.Errorf("Enrichment.BackfillBatchSize = %d, want 25", cfg.Enrichment.BackfillBatchSize)
+	}
+}
+
+func TestLoadContainerFromEnv(t *testing.T) {
+	cfg := Default()
+	if cfg.Container.PrefetchIndex {
+		t.Error("Container.PrefetchIndex should default to false")
+	}
+
+	t.Setenv("PROXY_CONTAINER_PREFETCH_INDEX", "true")
+	cfg.LoadFromEnv()
+
+	if !cfg.Container.PrefetchIndex {
+		t.Error("Container.PrefetchIndex = false, want true")
+	}
+}
+
+func TestValidateDebugUpstreamOverride(t *testing.T) {
+	cfg := Default()
+	if cfg.Debug.AllowUpstreamOverride {
+		t.Error("upstream override should be disabled by default")
+	}
+
+	cfg.Debug.AllowUpstreamOverride = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error when override is enabled without hosts")
+	}
+
+	cfg.Debug.UpstreamOverrideHosts = []string{"https://mirror.example.com"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for override host with scheme")
+	}
+
+	cfg.Debug.UpstreamOverrideHosts = []string{"mirror.example.com"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error for valid override hosts: %v", err)
+	}
+}
+
+func TestLoadDebugFromEnv(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_DEBUG_ALLOW_UPSTREAM_OVERRIDE", "true")
+	t.Setenv("PROXY_DEBUG_UPSTREAM_OVERRIDE_HOSTS", "a.example.com,b.example.com")
+	t.Setenv("PROXY_DEBUG_CACHE_TRACE", "1")
+	cfg.LoadFromEnv()
+
+	if !cfg.Debug.AllowUpstreamOverride {
+		t.Error("AllowUpstreamOverride = false, want true")
+	}
+	if len(cfg.Debug.UpstreamOverrideHosts) != 2 || cfg.Debug.UpstreamOverrideHosts[1] != "b.example.com" {
+		t.Errorf("UpstreamOverrideHosts = %v", cfg.Debug.UpstreamOverrideHosts)
+	}
+	if !cfg.Debug.CacheTrace {
+		t.Error("CacheTrace = false, want true")
+	}
+}
+
+func TestDebugCacheRefresh(t *testing.T) {
+	cfg := Default()
+	if cfg.Debug.AllowCacheRefresh {
+		t.Error("cache refresh should be disabled by default")
+	}
+
+	t.Setenv("PROXY_DEBUG_ALLOW_CACHE_REFRESH", "true")
+	t.Setenv("PROXY_DEBUG_CACHE_REFRESH_ECOSYSTEMS", "npm,pypi")
+	t.Setenv("PROXY_DEBUG_CACHE_REFRESH_TOKEN", "s3cret")
+	cfg.LoadFromEnv()
+
+	if !cfg.Debug.AllowCacheRefresh {
+		t.Error("AllowCacheRefresh = false, want true")
+	}
+	if len(cfg.Debug.CacheRefreshEcosystems) != 2 || cfg.Debug.CacheRefreshEcosystems[1] != "pypi" {
+		t.Errorf("CacheRefreshEcosystems = %v", cfg.Debug.CacheRefreshEcosystems)
+	}
+	if got := cfg.Debug.CacheRefreshTokenValue(); got != "s3cret" {
+		t.Errorf("CacheRefreshTokenValue() = %q, want %q", got, "s3cret")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got := cfg.Redacted().Debug.CacheRefreshToken; got == "s3cret" {
+		t.Error("Redacted() leaked the cache refresh token")
+	}
+
+	cfg.Debug.CacheRefreshEcosystems = []string{"npm/"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for malformed ecosystem")
+	}
+
+	cfg.Debug.CacheRefreshEcosystems = nil
+	cfg.Debug.CacheRefreshToken = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for cache refresh without a token")
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	cfg := Default()
+	if cfg.Debug.Enabled {
+		t.Error("debug endpoints should be disabled by default")
+	}
+
+	t.Setenv("PROXY_DEBUG_ENABLED", "true")
+	cfg.LoadFromEnv()
+	if !cfg.Debug.Enabled {
+		t.Error("Enabled = false, want true")
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for debug.enabled without a token")
+	}
+
+	t.Setenv("TEST_DEBUG_TOKEN", "s3cret")
+	t.Setenv("PROXY_DEBUG_TOKEN", "${TEST_DEBUG_TOKEN}")
+	cfg.LoadFromEnv()
+	if got := cfg.Debug.TokenValue(); got != "s3cret" {
+		t.Errorf("TokenValue() = %q, want %q", got, "s3cret")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cfg.Debug.Token = "s3cret"
+	if got := cfg.Redacted().Debug.Token; got == "s3cret" {
+		t.Error("Redacted() leaked the debug token")
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	cfg := Default()
+	if cfg.Admin.TokenValue() != "" {
+		t.Error("admin token should be unset by default")
+	}
+
+	t.Setenv("TEST_ADMIN_TOKEN", "s3cret")
+	t.Setenv("PROXY_ADMIN_TOKEN", "${TEST_ADMIN_TOKEN}")
+	cfg.LoadFromEnv()
+	if got := cfg.Admin.TokenValue(); got != "s3cret" {
+		t.Errorf("TokenValue() = %q, want %q", got, "s3cret")
+	}
+	cfg.Admin.Token = "s3cret"
+	if got := cfg.Redacted().Admin.Token; got == "s3cret" {
+		t.Error("Redacted() leaked the admin token")
+	}
+}
+
+func TestUpstreamFetchTimeout(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseFetchTimeout(); got != 0 {
+		t.Errorf("default fetch timeout = %v, want 0", got)
+	}
+
+	cfg.Upstream.FetchTimeout = "90s"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseFetchTimeout(); got != 90*time.Second {
+		t.Errorf("fetch timeout = %v, want 90s", got)
+	}
+
+	t.Setenv("PROXY_UPSTREAM_FETCH_TIMEOUT", "2m")
+	cfg.LoadFromEnv()
+	if got := cfg.ParseFetchTimeout(); got != 2*time.Minute {
+		t.Errorf("fetch timeout from env = %v, want 2m", got)
+	}
+
+	for _, bad := range []string{"soon", "-1s"} {
+		cfg.Upstream.FetchTimeout = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted fetch_timeout %q", bad)
+		}
+	}
+}
+
+func TestUpstreamResponseHeaders(t *testing.T) {
+	cfg := Default()
+	cfg.Upstream.ResponseHeaders = []string{"X-Request-Id", " x-served-by "}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	t.Setenv("PROXY_UPSTREAM_RESPONSE_HEADERS", "X-Request-Id,X-Cache")
+	cfg.LoadFromEnv()
+	if len(cfg.Upstream.ResponseHeaders) != 2 || cfg.Upstream.ResponseHeaders[1] != "X-Cache" {
+		t.Errorf("response headers from env = %v", cfg.Upstream.ResponseHeaders)
+	}
+
+	for _, bad := range []string{"", "X Request", "X-Id:"} {
+		cfg.Upstream.ResponseHeaders = []string{bad}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted response header %q", bad)
+		}
+	}
+}
+
+func TestUpstreamSkipContentCheck(t *testing.T) {
+	cfg := Default()
+	if cfg.Upstream.SkipContentCheck {
+		t.Error("content check should be on by default")
+	}
+
+	t.Setenv("PROXY_UPSTREAM_SKIP_CONTENT_CHECK", "true")
+	cfg.LoadFromEnv()
+	if !cfg.Upstream.SkipContentCheck {
+		t.Error("PROXY_UPSTREAM_SKIP_CONTENT_CHECK was not applied")
+	}
+}
+
+func TestUpstreamNormalizeURLs(t *testing.T) {
+	cfg := Default()
+	if cfg.Upstream.NormalizeURLs {
+		t.Error("URL normalization should be off by default")
+	}
+
+	t.Setenv("PROXY_UPSTREAM_NORMALIZE_URLS", "true")
+	cfg.LoadFromEnv()
+	if !cfg.Upstream.NormalizeURLs {
+		t.Error("PROXY_UPSTREAM_NORMALIZE_URLS was not applied")
+	}
+}
+
+func TestUpstreamTLSPolicy(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseMinTLSVersion(); got != tls.VersionTLS12 {
+		t.Errorf("default min TLS version = %x, want TLS 1.2", got)
+	}
+
+	t.Setenv("PROXY_UPSTREAM_MIN_TLS_VERSION", "1.3")
+	cfg.LoadFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseMinTLSVersion(); got != tls.VersionTLS13 {
+		t.Errorf("min TLS version from env = %x, want TLS 1.3", got)
+	}
+
+	cfg.Upstream.MinTLSVersion = "1.2"
+	cfg.Upstream.TLSCipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", " TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 "}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseTLSCipherSuites(); len(got) != 2 || got[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("cipher suites = %v", got)
+	}
+
+	for _, bad := range []struct {
+		version string
+		suites  []string
+	}{
+		{"1.1", nil},
+		{"tls1.3", nil},
+		{"1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{"1.2", []string{"not-a-suite"}},
+		{"1.3", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+	} {
+		cfg.Upstream.MinTLSVersion = bad.version
+		cfg.Upstream.TLSCipherSuites = bad.suites
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted min_tls_version %q with suites %v", bad.version, bad.suites)
+		}
+	}
+}
+
+func TestUpstreamHostTLS(t *testing.T) {
+	cfg := Default()
+	if hosts := cfg.Upstream.InsecureHosts(); len(hosts) != 0 {
+		t.Errorf("default InsecureHosts() = %v, want none", hosts)
+	}
+
+	cfg.Upstream.HostTLS = map[string]HostTLSConfig{
+		"Registry.Internal":    {InsecureSkipVerify: true},
+		"mirror.internal:8443": {InsecureSkipVerify: true},
+		"strict.internal":      {},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	got := cfg.Upstream.InsecureHosts()
+	if len(got) != 2 || got[0] != "mirror.internal:8443" || got[1] != "registry.internal" {
+		t.Errorf("InsecureHosts() = %v, want [mirror.internal:8443 registry.internal]", got)
+	}
+
+	for _, bad := range []string{"", "*", "*.internal", "https://registry.internal", "registry.internal/npm"} {
+		cfg.Upstream.HostTLS = map[string]HostTLSConfig{bad: {InsecureSkipVerify: true}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted upstream.host_tls key %q", bad)
+		}
+	}
+}
+
+func TestHTTPHeaders(t *testing.T) {
+	cfg := Default()
+	cfg.HTTP.Headers = map[string]string{
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		"Content-Security-Policy":   DashboardContentSecurityPolicy,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for name, value := range map[string]string{
+		"X Frame":     "DENY",
+		"X-Frame:":    "DENY",
+		"X-Injected":  "ok\r\nSet-Cookie: a=b",
+		"X-Truncated": "a\x00b",
+	} {
+		cfg.HTTP.Headers = map[string]string{name: value}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted header %q: %q", name, value)
+		}
+	}
+}
+
+func TestStorageMaxFilenameLength(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_STORAGE_MAX_FILENAME_LENGTH", "128")
+	cfg.LoadFromEnv()
+	if cfg.Storage.MaxFilenameLength != 128 {
+		t.Errorf("max filename length from env = %d, want 128", cfg.Storage.MaxFilenameLength)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, bad := range []int{-1, 10, 63, 256} {
+		cfg.Storage.MaxFilenameLength = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted storage.max_filename_length %d", bad)
+		}
+	}
+}
+
+func TestStoragePrefix(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_STORAGE_PREFIX", "tenants/prod")
+	cfg.LoadFromEnv()
+	if cfg.Storage.Prefix != "tenants/prod" {
+		t.Errorf("prefix from env = %q, want tenants/prod", cfg.Storage.Prefix)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, ok := range []string{"", "prod", "/prod/", "a-b_c.d/e"} {
+		cfg.Storage.Prefix = ok
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate() rejected storage.prefix %q: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"..", "prod/../staging", "a//b", "./prod", `prod\staging`} {
+		cfg.Storage.Prefix = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted storage.prefix %q", bad)
+		}
+	}
+}
+
+func TestUpstreamFallbacks(t *testing.T) {
+	cfg := Default()
+	cfg.Upstream.Fallbacks = map[string][]string{
+		"npm":  {"https://registry.npmmirror.com"},
+		"pypi": {"https://mirrors.example.com/pypi/"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, bad := range []string{"", "registry.npmmirror.com", "/npm"} {
+		cfg.Upstream.Fallbacks = map[string][]string{"npm": {bad}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted fallback %q", bad)
+		}
+	}
+}
+
+func TestHTTPCompression(t *testing.T) {
+	cfg := Default()
+	if !cfg.HTTP.Compression.Enabled {
+		t.Error("compression should be on by default")
+	}
+	if got := cfg.ParseCompressionMinSize(); got != 1024 {
+		t.Errorf("default min size = %d, want 1024", got)
+	}
+
+	t.Setenv("PROXY_HTTP_COMPRESSION_ENABLED", "false")
+	t.Setenv("PROXY_HTTP_COMPRESSION_MIN_SIZE", "4KB")
+	cfg.LoadFromEnv()
+	if cfg.HTTP.Compression.Enabled {
+		t.Error("PROXY_HTTP_COMPRESSION_ENABLED=false should turn compression off")
+	}
+	if got := cfg.ParseCompressionMinSize(); got != 4096 {
+		t.Errorf("min size from env = %d, want 4096", got)
+	}
+
+	cfg.HTTP.Compression.MinSize = "lots"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted an invalid compression min_size")
+	}
+}
+
+func TestNPMPublish(t *testing.T) {
+	cfg := Default()
+	if cfg.NPM.Publish {
+		t.Error("npm publish should be off by default")
+	}
+	if got := cfg.ParseNPMMaxPublishSize(); got != 100<<20 {
+		t.Errorf("default max publish size = %d, want 100MB", got)
+	}
+
+	t.Setenv("PROXY_NPM_PUBLISH", "true")
+	t.Setenv("PROXY_NPM_MAX_PUBLISH_SIZE", "10MB")
+	cfg.LoadFromEnv()
+	if !cfg.NPM.Publish {
+		t.Error("PROXY_NPM_PUBLISH=true should enable publish")
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted npm.publish without npm.publish_token")
+	}
+
+	t.Setenv("PROXY_NPM_PUBLISH_TOKEN", "s3cret")
+	cfg.LoadFromEnv()
+	if got := cfg.NPM.PublishTokenValue(); got != "s3cret" {
+		t.Errorf("PublishTokenValue() = %q, want %q", got, "s3cret")
+	}
+	if got := cfg.Redacted().NPM.PublishToken; got == "s3cret" {
+		t.Error("Redacted() leaked the npm publish token")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseNPMMaxPublishSize(); got != 10<<20 {
+		t.Errorf("max publish size from env = %d, want 10MB", got)
+	}
+
+	t.Setenv("PROXY_NPM_LOCAL_NAMES", "@mycompany,internal-tool")
+	cfg.LoadFromEnv()
+	if got := cfg.NPM.LocalNames; len(got) != 2 || got[0] != "@mycompany" || got[1] != "internal-tool" {
+		t.Errorf("LocalNames from env = %v", got)
+	}
+	for _, bad := range []string{"", "@", "my tool"} {
+		cfg.NPM.LocalNames = []string{bad}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted local_names entry %q", bad)
+		}
+	}
+	cfg.NPM.LocalNames = nil
+
+	for _, bad := range []string{"huge", "0"} {
+		cfg.NPM.MaxPublishSize = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted max_publish_size %q", bad)
+		}
+	}
+}
+
+func TestNPMUnpublish(t *testing.T) {
+	cfg := Default()
+	t.Setenv("PROXY_NPM_UNPUBLISH", "true")
+	cfg.LoadFromEnv()
+	if !cfg.NPM.Unpublish {
+		t.Fatal("PROXY_NPM_UNPUBLISH=true should enable unpublish")
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted npm.unpublish without npm.publish")
+	}
+	cfg.NPM.Publish = true
+	cfg.NPM.PublishToken = "s3cret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestNPMScopes(t *testing.T) {
+	cfg := Default()
+	cfg.NPM.Scopes = map[string]string{"@mycompany": "https://npm.internal.example.com"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for scope, upstream := range map[string]string{
+		"mycompany":     "https://npm.internal.example.com",
+		"@":             "https://npm.internal.example.com",
+		"@my/company":   "https://npm.internal.example.com",
+		"@mycompany ":   "https://npm.internal.example.com",
+		"@mycompany-ok": "npm.internal.example.com",
+	} {
+		cfg.NPM.Scopes = map[string]string{scope: upstream}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted scope %q -> %q", scope, upstream)
+		}
+	}
+}
+
+func TestHitTimeline(t *testing.T) {
+	cfg := Default()
+	if cfg.HitTimeline.Enabled {
+		t.Error("hit timeline should be off by default")
+	}
+	if got := cfg.ParseHitTimelineRetention(); got != 7*24*time.Hour {
+		t.Errorf("default retention = %v, want 168h", got)
+	}
+	if got := cfg.ParseHitTimelineDailyRetention(); got != 365*24*time.Hour {
+		t.Errorf("default daily retention = %v, want 8760h", got)
+	}
+
+	t.Setenv("PROXY_HIT_TIMELINE_ENABLED", "true")
+	t.Setenv("PROXY_HIT_TIMELINE_RETENTION", "48h")
+	t.Setenv("PROXY_HIT_TIMELINE_DAILY_RETENTION", "720h")
+	cfg.LoadFromEnv()
+	if !cfg.HitTimeline.Enabled {
+		t.Error("PROXY_HIT_TIMELINE_ENABLED=true should enable the hit timeline")
+	}
+	if got := cfg.ParseHitTimelineRetention(); got != 48*time.Hour {
+		t.Errorf("retention from env = %v, want 48h", got)
+	}
+	if got := cfg.ParseHitTimelineDailyRetention(); got != 720*time.Hour {
+		t.Errorf("daily retention from env = %v, want 720h", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, bad := range []string{"weekly", "0", "-1h"} {
+		cfg.HitTimeline.Retention = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted retention %q", bad)
+		}
+	}
+}
+
+func TestGemSpecsTTL(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseGemSpecsTTL(); got != 5*time.Minute {
+		t.Errorf("default specs TTL = %v, want 5m", got)
+	}
+
+	cfg.Gem.SpecsTTL = "0"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseGemSpecsTTL(); got != 0 {
+		t.Errorf("specs TTL = %v, want 0 when disabled", got)
+	}
+
+	t.Setenv("PROXY_GEM_SPECS_TTL", "30s")
+	cfg.LoadFromEnv()
+	if got := cfg.ParseGemSpecsTTL(); got != 30*time.Second {
+		t.Errorf("specs TTL from env = %v, want 30s", got)
+	}
+
+	for _, bad := range []string{"often", "-1m"} {
+		cfg.Gem.SpecsTTL = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted specs_ttl %q", bad)
+		}
+	}
+}
+
+func TestGoListTTL(t *testing.T) {
+	cfg := Default()
+	if got := cfg.ParseGoListTTL(); got != time.Minute {
+		t.Errorf("default list TTL = %v, want 1m", got)
+	}
+
+	cfg.Go.ListTTL = "0"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := cfg.ParseGoListTTL(); got != 0 {
+		t.Errorf("list TTL = %v, want 0 when disabled", got)
+	}
+
+	t.Setenv("PROXY_GO_LIST_TTL", "30s")
+	cfg.LoadFromEnv()
+	if got := cfg.ParseGoListTTL(); got != 30*time.Second {
+		t.Errorf("list TTL from env = %v, want 30s", got)
+	}
+
+	for _, bad := range []string{"often", "-1m"} {
+		cfg.Go.ListTTL = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted list_ttl %q", bad)
+		}
+	}
+}
+
+func TestStorageURLPrecedence(t *testing.T) {
+	tests := []struct {
+		name           string
+		url, path      string
+		wantURL        string
+		wantDeprecated string
+		wantErr        bool
+	}{
+		{name: "url only", url: "s3://bucket", wantURL: "s3://bucket"},
+		{name: "path only", path: "/data/cache", wantURL: "file:///data/cache", wantDeprecated: "file:///data/cache"},
+		{name: "both set, url wins", url: "s3://bucket", path: "/data/cache", wantURL: "s3://bucket", wantDeprecated: "ignored"},
+		{name: "default path", path: defaultStoragePath, wantURL: "file://" + defaultStoragePath},
+		{name: "neither", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Storage.URL = tt.url
+			cfg.Storage.Path = tt.path
+
+			err := cfg.Validate()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "storage.url or storage.path") {
+					t.Errorf("Validate() error = %v, want missing storage error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if got := cfg.StorageURL(); got != tt.wantURL {
+				t.Errorf("StorageURL() = %q, want %q", got, tt.wantURL)
+			}
+
+			deps := cfg.Deprecations()
+			if tt.wantDeprecated == "" {
+				if len(deps) != 0 {
+					t.Errorf("Deprecations() = %+v, want none", deps)
+				}
+				return
+			}
+			if len(deps) != 1 || deps[0].Field != "storage.path" || deps[0].Replacement != "storage.url" {
+				t.Fatalf("Deprecations() = %+v, want one for storage.path", deps)
+			}
+			if !strings.Contains(deps[0].Detail, tt.wantDeprecated) {
+				t.Errorf("Detail = %q, want it to mention %q", deps[0].Detail, tt.wantDeprecated)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://proxy:hunter2@db:5432/proxy?sslmode=disable"
+	cfg.Storage.URL = "s3://bucket?endpoint=http://minio:9000"
+	cfg.Enrichment.GHSAToken = "ghp_secret"
+	cfg.Upstream.Auth = map[string]AuthConfig{
+		"https://npm.example.com":   {Type: "bearer", Token: "npm_secret"},
+		"https://maven.example.com": {Type: "basic", Username: "ci", Password: "${MAVEN_PASSWORD}"},
+	}
+
+	r := cfg.Redacted()
+
+	if r.Database.URL != "postgres://proxy:REDACTED@db:5432/proxy?sslmode=disable" {
+		t.Errorf("database URL = %q", r.Database.URL)
+	}
+	if r.Storage.URL != cfg.Storage.URL {
+		t.Errorf("storage URL without credentials changed to %q", r.Storage.URL)
+	}
+	if r.Enrichment.GHSAToken != redactedValue {
+		t.Errorf("GHSA token = %q", r.Enrichment.GHSAToken)
+	}
+	if got := r.Upstream.Auth["https://npm.example.com"].Token; got != redactedValue {
+		t.Errorf("npm token = %q", got)
+	}
+	maven := r.Upstream.Auth["https://maven.example.com"]
+	if maven.Password != "${MAVEN_PASSWORD}" || maven.Username != "ci" {
+		t.Errorf("maven auth = %+v, want env reference and username kept", maven)
+	}
+
+	if cfg.Upstream.Auth["https://npm.example.com"].Token != "npm_secret" || cfg.Enrichment.GHSAToken != "ghp_secret" {
+		t.Error("Redacted modified the original config")
+	}
+
+	out, err := r.Marshal("yaml")
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, secret := range []string{"hunter2", "ghp_secret", "npm_secret"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("marshalled config contains %q", secret)
+		}
+	}
+	if _, err := r.Marshal("toml"); err == nil {
+		t.Error("Marshal accepted an unknown format")
+	}
+}
+
+func TestRedactURLQueryPassword(t *testing.T) {
+	got := redactURL("postgres://db/proxy?password=hunter2&sslmode=require")
+	if strings.Contains(got, "hunter2") || !strings.Contains(got, "sslmode=require") {
+		t.Errorf("redactURL = %q", got)
+	}
+}
+
+func TestH2CFromEnv(t *testing.T) {
+	cfg := Default()
+	if cfg.H2C {
+		t.Error("h2c enabled by default")
+	}
+	t.Setenv("PROXY_H2C", "true")
+	cfg.LoadFromEnv()
+	if !cfg.H2C {
+		t.Error("PROXY_H2C=true did not enable h2c")
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.pem")
+
+	cfg := Default()
+	cfg.TLS.CertFile = missing
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Errorf("Validate() with only cert_file = %v, want a must be set together error", err)
+	}
+
+	cfg.TLS.KeyFile = missing
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "loading tls certificate") {
+		t.Errorf("Validate() with missing files = %v, want a loading error", err)
+	}
+}
+
+func TestTLSClientCAs(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := Default()
+	cfg.TLS.ClientCAFile = filepath.Join(dir, "ca.pem")
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "requires tls.cert_file") {
+		t.Errorf("Validate() with client_ca_file alone = %v, want a requires error", err)
+	}
+
+	tc := TLSConfig{ClientCAFile: filepath.Join(dir, "ca.pem")}
+	if _, err := tc.ClientCAs(); err == nil {
+		t.Error("ClientCAs() accepted a missing file")
+	}
+	if err := os.WriteFile(tc.ClientCAFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.ClientCAs(); err == nil || !strings.Contains(err.Error(), "no PEM certificates") {
+		t.Errorf("ClientCAs() with garbage = %v, want a no PEM certificates error", err)
+	}
+	if pool, err := (TLSConfig{}).ClientCAs(); pool != nil || err != nil {
+		t.Errorf("ClientCAs() without a file = %v, %v; want nil, nil", pool, err)
+	}
+}
+
+func TestUsageConfig(t *testing.T) {
+	cfg := Default()
+	if cfg.Usage.Enabled {
+		t.Error("usage log should be disabled by default")
+	}
+
+	t.Setenv("PROXY_USAGE_ENABLED", "true")
+	t.Setenv("PROXY_USAGE_TEAM_HEADER", "X-Cost-Center")
+	t.Setenv("PROXY_USAGE_MAX_ROWS", "5000")
+	cfg.LoadFromEnv()
+	if !cfg.Usage.Enabled || cfg.Usage.TeamHeader != "X-Cost-Center" || cfg.Usage.MaxRows != 5000 {
+		t.Errorf("Usage = %+v", cfg.Usage)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	cfg.Usage.TeamHeader = "X Team"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted a team header with a space")
+	}
+	cfg.Usage.TeamHeader = ""
+
+	cfg.Usage.MaxRows = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted negative max_rows")
+	}
+	cfg.Usage.MaxRows = 0
+
+	cfg.Usage.ClientCertTeam = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "client_ca_file") {
+		t.Errorf("Validate() with client_cert_team and no CA = %v, want a client_ca_file error", err)
+	}
+}
+
+func TestStaticBaseURLWithTLS(t *testing.T) {
+	cfg := Default()
+	cfg.BaseURL = BaseURLAuto
+	cfg.Listen = ":8443"
+	cfg.TLS.CertFile = "cert.pem"
+	cfg.TLS.KeyFile = "key.pem"
+	if got := cfg.StaticBaseURL(); got != "https://localhost:8443" {
+		t.Errorf("StaticBaseURL() = %q, want https://localhost:8443", got)
+	}
+}
+
+func TestBaseURLAuto(t *testing.T) {
+	cfg := Default()
+	cfg.BaseURL = BaseURLAuto
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "127.0.0.1", "::1"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !cfg.DetectBaseURL() {
+		t.Error("DetectBaseURL() = false for base_url auto")
+	}
+	if cfg.UIBaseURL != "" {
+		t.Errorf("UIBaseURL = %q, want it left unset with auto detection", cfg.UIBaseURL)
+	}
+	if got := cfg.StaticBaseURL(); got != "http://localhost:8080" {
+		t.Errorf("StaticBaseURL() = %q, want http://localhost:8080", got)
+	}
+
+	t.Setenv("PROXY_TRUSTED_PROXIES", "192.0.2.1,198.51.100.0/24")
+	cfg.LoadFromEnv()
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1] != "198.51.100.0/24" {
+		t.Errorf("TrustedProxies from env = %v", cfg.TrustedProxies)
+	}
+
+	cfg.TrustedProxies = []string{"proxy.example.com"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() accepted a hostname in trusted_proxies")
+	}
+
+	cfg = Default()
+	if cfg.DetectBaseURL() || cfg.StaticBaseURL() != cfg.BaseURL {
+		t.Error("a configured base_url should be used as is")
+	}
+}
+
+func TestQuarantineConfig(t *testing.T) {
+	cfg := Default()
+	if got := cfg.Quarantine.ParseDefault(); got != 0 {
+		t.Errorf("default quarantine = %v, want disabled", got)
+	}
+	if cfg.Quarantine.FailOpen {
+		t.Error("quarantine fails open by default, want fail closed")
+	}
+
+	t.Setenv("PROXY_QUARANTINE_DEFAULT", "2d")
+	t.Setenv("PROXY_QUARANTINE_FAIL_OPEN", "true")
+	cfg.LoadFromEnv()
+	if !cfg.Quarantine.FailOpen {
+		t.Error("PROXY_QUARANTINE_FAIL_OPEN was not applied")
+	}
+	cfg.Quarantine.Ecosystems = map[string]string{"npm": "72h", "cargo": "0"}
+	cfg.Quarantine.Allow = []string{"pkg:npm/@babel/core", "pkg:pypi/Django@5.0"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if got := cfg.Quarantine.ParseDefault(); got != 48*time.Hour {
+		t.Errorf("default from env = %v, want 48h", got)
+	}
+	want := map[string]time.Duration{"npm": 72 * time.Hour, "cargo": 0}
+	if got := cfg.Quarantine.ParseEcosystems(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ecosystems = %v, want %v", got, want)
+	}
+	wantAllow := []string{"pkg:npm/%40babel/core", "pkg:pypi/django@5.0"}
+	if got := cfg.Quarantine.NormalizedAllow(); !reflect.DeepEqual(got, wantAllow) {
+		t.Errorf("allow = %v, want %v", got, wantAllow)
+	}
+
+	for _, q := range []QuarantineConfig{
+		{Default: "soon"},
+		{Ecosystems: map[string]string{"npm": "1w"}},
+		{Allow: []string{"lodash"}},
+	} {
+		cfg := Default()
+		cfg.Quarantine = q
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() accepted quarantine %+v", q)
+		}
+	}
+}
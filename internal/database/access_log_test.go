@@ -0,0 +1,87 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAccessLogUsageByTeam(t *testing.T) {
+	db, err := Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour)
+	for _, e := range []AccessLogEntry{
+		{Team: "payments", Ecosystem: testEcosystemNPM, PURL: "pkg:npm/lodash@4.17.21", Bytes: 300, CreatedAt: now},
+		{Team: "payments", Ecosystem: "pypi", PURL: "pkg:pypi/requests@2.31.0", Bytes: 200, CreatedAt: now},
+		{Team: "search", Ecosystem: testEcosystemNPM, PURL: "pkg:npm/lodash@4.17.21", Bytes: 1000, CreatedAt: now},
+		{Ecosystem: testEcosystemNPM, PURL: "pkg:npm/left-pad@1.3.0", Bytes: 10, CreatedAt: now},
+		{Team: "payments", Ecosystem: testEcosystemNPM, PURL: "pkg:npm/lodash@4.17.20", Bytes: 5000, CreatedAt: old},
+	} {
+		if err := db.InsertAccessLog(&e); err != nil {
+			t.Fatalf("InsertAccessLog() error = %v", err)
+		}
+	}
+
+	usage, err := db.GetUsageByTeam(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetUsageByTeam() error = %v", err)
+	}
+	want := []TeamUsage{
+		{Team: "search", Requests: 1, Bytes: 1000},
+		{Team: "payments", Requests: 2, Bytes: 500},
+		{Team: "", Requests: 1, Bytes: 10},
+	}
+	if len(usage) != len(want) {
+		t.Fatalf("got %d teams, want %d: %+v", len(usage), len(want), usage)
+	}
+	for i := range want {
+		if usage[i] != want[i] {
+			t.Errorf("usage[%d] = %+v, want %+v", i, usage[i], want[i])
+		}
+	}
+
+	usage, err = db.GetUsageByTeam(old.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetUsageByTeam() error = %v", err)
+	}
+	if usage[0].Team != "payments" || usage[0].Bytes != 5500 || usage[0].Requests != 3 {
+		t.Errorf("wider range: top team = %+v, want payments with 3 requests and 5500 bytes", usage[0])
+	}
+
+	removed, err := db.PruneAccessLog(2)
+	if err != nil {
+		t.Fatalf("PruneAccessLog() error = %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("removed = %d, want 3", removed)
+	}
+}
+
+func TestAccessLogTableCreatedByMigration(t *testing.T) {
+	db := setupMetadataCacheDB(t)
+
+	// Simulate a database from before the access_log migration existed.
+	if _, err := db.Exec("DROP TABLE access_log"); err != nil {
+		t.Fatalf("dropping access_log: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM migrations WHERE name = '008_ensure_access_log_table'"); err != nil {
+		t.Fatalf("deleting migration record: %v", err)
+	}
+
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatalf("MigrateSchema() error = %v", err)
+	}
+
+	has, err := db.HasTable("access_log")
+	if err != nil {
+		t.Fatalf("HasTable() error = %v", err)
+	}
+	if !has {
+		t.Error("access_log table should exist after migration")
+	}
+}
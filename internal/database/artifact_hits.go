@@ -0,0 +1,171 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The artifact_hits table holds one row per cache hit, giving hit_count a
+// time dimension. Rows older than the retention window are rolled up into
+// artifact_hits_daily, one row per artifact per UTC day, so the table stays
+// bounded while per-day totals are kept for longer.
+
+// ArtifactHit is one cache hit on an artifact.
+type ArtifactHit struct {
+	VersionPURL string
+	Filename    string
+	HitAt       time.Time
+}
+
+// DailyHits is the number of cache hits on one UTC day, formatted
+// YYYY-MM-DD.
+type DailyHits struct {
+	Day  string `db:"day"`
+	Hits int64  `db:"hits"`
+}
+
+// hitDay returns the SQL expression for the UTC day of artifact_hits.hit_at.
+// Hits are stored in UTC, so on SQLite the date is the timestamp's prefix.
+func (db *DB) hitDay() string {
+	if db.dialect == DialectPostgres {
+		return "TO_CHAR(hit_at, 'YYYY-MM-DD')"
+	}
+	return "SUBSTR(hit_at, 1, 10)"
+}
+
+// InsertArtifactHits appends hits to artifact_hits in a single transaction.
+func (db *DB) InsertArtifactHits(hits []ArtifactHit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("inserting artifact hits: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Preparex(db.Rebind(`
+		INSERT INTO artifact_hits (version_purl, filename, hit_at) VALUES (?, ?, ?)
+	`))
+	if err != nil {
+		return fmt.Errorf("inserting artifact hits: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, h := range hits {
+		if _, err := stmt.Exec(h.VersionPURL, h.Filename, h.HitAt.UTC()); err != nil {
+			return fmt.Errorf("inserting artifact hits: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RollupArtifactHits adds every hit before cutoff to the per-day totals in
+// artifact_hits_daily and deletes it from artifact_hits, returning the
+// number of hits rolled up. A day split by cutoff is completed by a later
+// rollup, which adds to the same row.
+func (db *DB) RollupArtifactHits(cutoff time.Time) (int64, error) {
+	cutoff = cutoff.UTC()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("rolling up artifact hits: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	day := db.hitDay()
+	rollup := db.Rebind(fmt.Sprintf(`
+		INSERT INTO artifact_hits_daily (day, version_purl, filename, hits)
+		SELECT %s, version_purl, filename, COUNT(*)
+		FROM artifact_hits
+		WHERE hit_at < ?
+		GROUP BY %s, version_purl, filename
+		ON CONFLICT(day, version_purl, filename)
+		DO UPDATE SET hits = artifact_hits_daily.hits + excluded.hits
+	`, day, day))
+	if _, err := tx.Exec(rollup, cutoff); err != nil {
+		return 0, fmt.Errorf("rolling up artifact hits: %w", err)
+	}
+
+	res, err := tx.Exec(db.Rebind(`DELETE FROM artifact_hits WHERE hit_at < ?`), cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("deleting rolled up artifact hits: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("rolling up artifact hits: %w", err)
+	}
+	return n, nil
+}
+
+// PruneDailyArtifactHits deletes per-day totals for days before cutoff's
+// UTC day and returns the number of rows removed.
+func (db *DB) PruneDailyArtifactHits(cutoff time.Time) (int64, error) {
+	res, err := db.Exec(db.Rebind(`DELETE FROM artifact_hits_daily WHERE day < ?`),
+		cutoff.UTC().Format(time.DateOnly))
+	if err != nil {
+		return 0, fmt.Errorf("pruning daily artifact hits: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetDailyArtifactHits returns the hits per UTC day from since's day on,
+// oldest first, combining rolled up totals with hits not yet rolled up.
+// Days without hits are left out.
+func (db *DB) GetDailyArtifactHits(since time.Time) ([]DailyHits, error) {
+	since = since.UTC()
+
+	var rolled []DailyHits
+	if err := db.Select(&rolled, db.Rebind(`
+		SELECT day, SUM(hits) AS hits FROM artifact_hits_daily
+		WHERE day >= ?
+		GROUP BY day
+	`), since.Format(time.DateOnly)); err != nil {
+		return nil, fmt.Errorf("loading daily artifact hits: %w", err)
+	}
+
+	var recent []DailyHits
+	day := db.hitDay()
+	if err := db.Select(&recent, db.Rebind(fmt.Sprintf(`
+		SELECT %s AS day, COUNT(*) AS hits FROM artifact_hits
+		WHERE hit_at >= ?
+		GROUP BY %s
+	`, day, day)), since); err != nil {
+		return nil, fmt.Errorf("loading daily artifact hits: %w", err)
+	}
+
+	totals := make(map[string]int64, len(rolled)+len(recent))
+	for _, d := range append(rolled, recent...) {
+		totals[d.Day] += d.Hits
+	}
+	days := make([]DailyHits, 0, len(totals))
+	for d, hits := range totals {
+		days = append(days, DailyHits{Day: d, Hits: hits})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
+
+// countArtifactHitsSince counts the hits recorded at or after since. Hits
+// already rolled up only have a day, so for those since is rounded down to
+// its UTC day.
+func (db *DB) countArtifactHitsSince(since time.Time) (int64, error) {
+	since = since.UTC()
+	var recent, rolled int64
+	if err := db.Get(&recent, db.Rebind(`
+		SELECT COUNT(*) FROM artifact_hits WHERE hit_at >= ?
+	`), since); err != nil {
+		return 0, err
+	}
+	if err := db.Get(&rolled, db.Rebind(`
+		SELECT COALESCE(SUM(hits), 0) FROM artifact_hits_daily WHERE day >= ?
+	`), since.Format(time.DateOnly)); err != nil {
+		return 0, err
+	}
+	return recent + rolled, nil
+}
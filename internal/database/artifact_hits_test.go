@@ -0,0 +1,150 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArtifactHitsRecordedWithTimestamps(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		hitAt := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+		if err := db.InsertArtifactHits([]ArtifactHit{
+			{VersionPURL: "pkg:npm/lodash@4.17.21", Filename: "lodash-4.17.21.tgz", HitAt: hitAt},
+			{VersionPURL: "pkg:npm/lodash@4.17.21", Filename: "lodash-4.17.21.tgz", HitAt: hitAt.Add(time.Hour)},
+		}); err != nil {
+			t.Fatalf("InsertArtifactHits: %v", err)
+		}
+
+		var rows []struct {
+			VersionPURL string    `db:"version_purl"`
+			Filename    string    `db:"filename"`
+			HitAt       time.Time `db:"hit_at"`
+		}
+		if err := db.Select(&rows, `SELECT version_purl, filename, hit_at FROM artifact_hits ORDER BY hit_at`); err != nil {
+			t.Fatalf("selecting hits: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("got %d hits, want 2", len(rows))
+		}
+		if rows[0].VersionPURL != "pkg:npm/lodash@4.17.21" || rows[0].Filename != "lodash-4.17.21.tgz" {
+			t.Errorf("hit = %+v", rows[0])
+		}
+		if !rows[0].HitAt.Equal(hitAt) || !rows[1].HitAt.Equal(hitAt.Add(time.Hour)) {
+			t.Errorf("hit times = %v, %v; want %v, %v", rows[0].HitAt, rows[1].HitAt, hitAt, hitAt.Add(time.Hour))
+		}
+
+		n, err := db.countArtifactHitsSince(hitAt.Add(30 * time.Minute))
+		if err != nil {
+			t.Fatalf("countArtifactHitsSince: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("hits since 10:00 = %d, want 1", n)
+		}
+	})
+}
+
+func TestRollupArtifactHits(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		day := func(d, h int) time.Time { return time.Date(2026, 10, d, h, 0, 0, 0, time.UTC) }
+		lodash, react := "pkg:npm/lodash@4.17.21", "pkg:npm/react@18.2.0"
+		hits := []ArtifactHit{
+			{lodash, "lodash-4.17.21.tgz", day(10, 1)},
+			{lodash, "lodash-4.17.21.tgz", day(10, 23)},
+			{react, "react-18.2.0.tgz", day(10, 12)},
+			{lodash, "lodash-4.17.21.tgz", day(11, 8)},
+			{lodash, "lodash-4.17.21.tgz", day(11, 20)},
+			{react, "react-18.2.0.tgz", day(12, 6)},
+		}
+		if err := db.InsertArtifactHits(hits); err != nil {
+			t.Fatalf("InsertArtifactHits: %v", err)
+		}
+
+		// The cutoff splits the 11th; the rest of that day is rolled up later.
+		n, err := db.RollupArtifactHits(day(11, 12))
+		if err != nil {
+			t.Fatalf("RollupArtifactHits: %v", err)
+		}
+		if n != 4 {
+			t.Errorf("rolled up %d hits, want 4", n)
+		}
+		if n, err = db.RollupArtifactHits(day(12, 0)); err != nil || n != 1 {
+			t.Fatalf("second RollupArtifactHits = %d, %v; want 1", n, err)
+		}
+
+		var rows []struct {
+			Day         string `db:"day"`
+			VersionPURL string `db:"version_purl"`
+			Hits        int64  `db:"hits"`
+		}
+		if err := db.Select(&rows, `SELECT day, version_purl, hits FROM artifact_hits_daily ORDER BY day, version_purl`); err != nil {
+			t.Fatalf("selecting daily hits: %v", err)
+		}
+		want := []struct {
+			day  string
+			purl string
+			hits int64
+		}{
+			{"2026-10-10", lodash, 2},
+			{"2026-10-10", react, 1},
+			{"2026-10-11", lodash, 2},
+		}
+		if len(rows) != len(want) {
+			t.Fatalf("got %d daily rows, want %d: %+v", len(rows), len(want), rows)
+		}
+		for i, w := range want {
+			if rows[i].Day != w.day || rows[i].VersionPURL != w.purl || rows[i].Hits != w.hits {
+				t.Errorf("row %d = %+v, want %s %s %d", i, rows[i], w.day, w.purl, w.hits)
+			}
+		}
+
+		daily, err := db.GetDailyArtifactHits(day(10, 0))
+		if err != nil {
+			t.Fatalf("GetDailyArtifactHits: %v", err)
+		}
+		wantDaily := []DailyHits{
+			{Day: "2026-10-10", Hits: 3},
+			{Day: "2026-10-11", Hits: 2},
+			{Day: "2026-10-12", Hits: 1},
+		}
+		if !reflect.DeepEqual(daily, wantDaily) {
+			t.Errorf("GetDailyArtifactHits = %+v, want %+v", daily, wantDaily)
+		}
+
+		pruned, err := db.PruneDailyArtifactHits(day(11, 5))
+		if err != nil {
+			t.Fatalf("PruneDailyArtifactHits: %v", err)
+		}
+		if pruned != 2 {
+			t.Errorf("pruned %d daily rows, want 2", pruned)
+		}
+	})
+}
+
+func TestArtifactHitsTablesCreatedByMigration(t *testing.T) {
+	db := setupMetadataCacheDB(t)
+
+	// Simulate a database from before the artifact_hits migration existed.
+	for _, table := range []string{"artifact_hits", "artifact_hits_daily"} {
+		if _, err := db.Exec("DROP TABLE " + table); err != nil {
+			t.Fatalf("dropping %s: %v", table, err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM migrations WHERE name = '010_ensure_artifact_hits_tables'"); err != nil {
+		t.Fatalf("deleting migration record: %v", err)
+	}
+
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatalf("MigrateSchema() error = %v", err)
+	}
+
+	for _, table := range []string{"artifact_hits", "artifact_hits_daily"} {
+		has, err := db.HasTable(table)
+		if err != nil {
+			t.Fatalf("HasTable() error = %v", err)
+		}
+		if !has {
+			t.Errorf("%s table should exist after migration", table)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CollisionPackage is one package in a NameCollision.
+type CollisionPackage struct {
+	Ecosystem string `db:"ecosystem" json:"ecosystem"`
+	Name      string `db:"name" json:"name"`
+}
+
+// NameCollision is a group of packages whose names normalize to the same
+// key: the same name cached from several ecosystems, or spellings that
+// differ only in case or separators. Either can point at a dependency
+// confusion attempt.
+type NameCollision struct {
+	Key        string             `json:"key"`
+	Ecosystems []string           `json:"ecosystems"`
+	Packages   []CollisionPackage `json:"packages"`
+}
+
+// CollisionKey normalizes a package name for collision matching. Case is
+// folded and runs of '-', '_' and '.' become a single '-', the way PyPI
+// normalizes names, so "Foo_Bar" and "foo-bar" match.
+func CollisionKey(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if r == '-' || r == '_' || r == '.' {
+			sep = true
+			continue
+		}
+		if sep && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		sep = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// FindNameCollisions returns every group of two or more known packages that
+// share a CollisionKey, ordered by key. Packages within a group are ordered
+// by ecosystem, then name.
+func (db *DB) FindNameCollisions() ([]NameCollision, error) {
+	var packages []CollisionPackage
+	if err := db.Select(&packages, `SELECT ecosystem, name FROM packages`); err != nil {
+		return nil, fmt.Errorf("listing packages: %w", err)
+	}
+
+	groups := make(map[string][]CollisionPackage)
+	for _, p := range packages {
+		key := CollisionKey(p.Name)
+		if key == "" {
+			continue
+		}
+		groups[key] = append(groups[key], p)
+	}
+
+	collisions := []NameCollision{}
+	for key, pkgs := range groups {
+		if len(pkgs) < 2 {
+			continue
+		}
+		sort.Slice(pkgs, func(i, j int) bool {
+			if pkgs[i].Ecosystem != pkgs[j].Ecosystem {
+				return pkgs[i].Ecosystem < pkgs[j].Ecosystem
+			}
+			return pkgs[i].Name < pkgs[j].Name
+		})
+		var ecosystems []string
+		for _, p := range pkgs {
+			if len(ecosystems) == 0 || ecosystems[len(ecosystems)-1] != p.Ecosystem {
+				ecosystems = append(ecosystems, p.Ecosystem)
+			}
+		}
+		collisions = append(collisions, NameCollision{Key: key, Ecosystems: ecosystems, Packages: pkgs})
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].Key < collisions[j].Key })
+	return collisions, nil
+}
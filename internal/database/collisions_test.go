@@ -0,0 +1,61 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollisionKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"foo", "foo"},
+		{"Foo_Bar", "foo-bar"},
+		{"foo.bar", "foo-bar"},
+		{"foo--bar", "foo-bar"},
+		{"_foo_", "foo"},
+		{"@scope/foo", "@scope/foo"},
+	}
+	for _, tt := range tests {
+		if got := CollisionKey(tt.name); got != tt.want {
+			t.Errorf("CollisionKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindNameCollisions(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		for _, p := range []Package{
+			{PURL: "pkg:npm/foo", Ecosystem: testEcosystemNPM, Name: "foo"},
+			{PURL: "pkg:pypi/foo", Ecosystem: "pypi", Name: "foo"},
+			{PURL: "pkg:npm/left-pad", Ecosystem: testEcosystemNPM, Name: "left-pad"},
+			{PURL: "pkg:npm/left_pad", Ecosystem: testEcosystemNPM, Name: "left_pad"},
+			{PURL: "pkg:npm/lodash", Ecosystem: testEcosystemNPM, Name: "lodash"},
+		} {
+			if err := db.UpsertPackage(&p); err != nil {
+				t.Fatalf("UpsertPackage(%s) failed: %v", p.PURL, err)
+			}
+		}
+
+		got, err := db.FindNameCollisions()
+		if err != nil {
+			t.Fatalf("FindNameCollisions() error = %v", err)
+		}
+		want := []NameCollision{
+			{
+				Key:        "foo",
+				Ecosystems: []string{testEcosystemNPM, "pypi"},
+				Packages:   []CollisionPackage{{testEcosystemNPM, "foo"}, {"pypi", "foo"}},
+			},
+			{
+				Key:        "left-pad",
+				Ecosystems: []string{testEcosystemNPM},
+				Packages:   []CollisionPackage{{testEcosystemNPM, "left-pad"}, {testEcosystemNPM, "left_pad"}},
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindNameCollisions() =\n%+v\nwant\n%+v", got, want)
+		}
+	})
+}
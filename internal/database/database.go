@@ -1,19 +1,28 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
-const SchemaVersion = 1
+// SchemaVersion is the version a fully migrated database reports: the base
+// schema (1) plus one per entry in migrations.
+const SchemaVersion = 12
 
 const dirPermissions = 0755
 
+// DefaultBusyTimeout is how long a SQLite connection waits on a locked
+// database before failing with "database is locked".
+const DefaultBusyTimeout = 5 * time.Second
+
 type Dialect string
 
 const (
@@ -37,13 +46,21 @@ func Exists(path string) bool {
 }
 
 func Create(path string) (*DB, error) {
+	return CreateWithBusyTimeout(path, DefaultBusyTimeout)
+}
+
+// CreateWithBusyTimeout is Create with a custom SQLite busy timeout.
+func CreateWithBusyTimeout(path string, busyTimeout time.Duration) (*DB, error) {
 	if Exists(path) {
 		if err := os.Remove(path); err != nil {
 			return nil, fmt.Errorf("removing existing database: %w", err)
 		}
 	}
 
-	db, err := Open(path)
+	// Incremental auto_vacuum lets Vacuum trim free pages without rebuilding
+	// the whole file. It only takes effect on a database with no tables that
+	// isn't in WAL mode yet, so it has to be set as the connection opens.
+	db, err := openSQLite(path, busyTimeout, "auto_vacuum(INCREMENTAL)")
 	if err != nil {
 		return nil, err
 	}
@@ -57,14 +74,34 @@ func Create(path string) (*DB, error) {
 }
 
 func Open(path string) (*DB, error) {
+	return OpenWithBusyTimeout(path, DefaultBusyTimeout)
+}
+
+// OpenWithBusyTimeout is Open with a custom SQLite busy timeout. A zero or
+// negative timeout uses DefaultBusyTimeout.
+func OpenWithBusyTimeout(path string, busyTimeout time.Duration) (*DB, error) {
+	return openSQLite(path, busyTimeout)
+}
+
+// openSQLite opens a SQLite database, applying pragmas to each connection
+// as it is opened.
+func openSQLite(path string, busyTimeout time.Duration, pragmas ...string) (*DB, error) {
+	if busyTimeout <= 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
 	if dir := filepath.Dir(path); dir != "." && dir != "/" {
 		if err := os.MkdirAll(dir, dirPermissions); err != nil {
 			return nil, fmt.Errorf("creating database directory: %w", err)
 		}
 	}
 
-	// Add busy_timeout to handle concurrent writes
-	sqlDB, err := sqlx.Open("sqlite", path+"?_busy_timeout=5000")
+	// Wait on a locked database instead of failing immediately, so writes
+	// from another process (mirror, CLI commands) don't error out.
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(%d)", path, busyTimeout.Milliseconds())
+	for _, pragma := range pragmas {
+		dsn += "&_pragma=" + pragma
+	}
+	sqlDB, err := sqlx.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
@@ -82,10 +119,47 @@ func Open(path string) (*DB, error) {
 }
 
 func OpenOrCreate(path string) (*DB, error) {
+	return OpenOrCreateWithBusyTimeout(path, DefaultBusyTimeout)
+}
+
+// OpenOrCreateWithBusyTimeout is OpenOrCreate with a custom SQLite busy
+// timeout.
+func OpenOrCreateWithBusyTimeout(path string, busyTimeout time.Duration) (*DB, error) {
 	if Exists(path) {
-		return Open(path)
+		return OpenWithBusyTimeout(path, busyTimeout)
+	}
+	return CreateWithBusyTimeout(path, busyTimeout)
+}
+
+// sqliteBusyCoder matches the driver's error type without importing it.
+type sqliteBusyCoder interface {
+	Code() int
+}
+
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+	// sqlitePrimaryCodeMask strips extended result codes down to the
+	// primary code.
+	sqlitePrimaryCodeMask = 0xff
+)
+
+// IsBusy reports whether err is SQLite failing because another connection
+// holds the lock (SQLITE_BUSY or SQLITE_LOCKED). Such writes are safe to
+// retry.
+func IsBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	var coder sqliteBusyCoder
+	if errors.As(err, &coder) {
+		switch coder.Code() & sqlitePrimaryCodeMask {
+		case sqliteBusy, sqliteLocked:
+			return true
+		}
 	}
-	return Create(path)
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY")
 }
 
 func OpenPostgres(url string) (*DB, error) {
@@ -2,8 +2,12 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -158,6 +162,20 @@ func TestVersionCRUD(t *testing.T) {
 		if len(versions) != 1 {
 			t.Errorf("expected 1 version, got %d", len(versions))
 		}
+
+		if err := db.SetVersionYanked("pkg:npm/lodash@4.17.21", true); err != nil {
+			t.Fatalf("SetVersionYanked failed: %v", err)
+		}
+		got, _ = db.GetVersionByPURL("pkg:npm/lodash@4.17.21")
+		if !got.Yanked {
+			t.Error("expected version to be yanked")
+		}
+		if err := db.SetVersionYanked("pkg:npm/lodash@0.0.0", true); err != nil {
+			t.Errorf("SetVersionYanked on unknown version failed: %v", err)
+		}
+		if v, _ := db.GetVersionByPURL("pkg:npm/lodash@0.0.0"); v != nil {
+			t.Error("SetVersionYanked created a version row")
+		}
 	})
 }
 
@@ -291,6 +309,119 @@ func TestCacheManagement(t *testing.T) {
 		if len(lru) != 2 {
 			t.Errorf("expected 2 LRU artifacts, got %d", len(lru))
 		}
+
+		if err := db.PinArtifact(lru[0].VersionPURL, lru[0].Filename, true); err != nil {
+			t.Fatalf("PinArtifact failed: %v", err)
+		}
+		unpinned, err := db.GetLeastRecentlyUsedArtifacts(3)
+		if err != nil {
+			t.Fatalf("GetLeastRecentlyUsedArtifacts failed: %v", err)
+		}
+		if len(unpinned) != 2 {
+			t.Errorf("expected pinned artifact to be skipped, got %d LRU artifacts", len(unpinned))
+		}
+		for _, a := range unpinned {
+			if a.ID == lru[0].ID {
+				t.Errorf("pinned artifact %s returned by GetLeastRecentlyUsedArtifacts", a.Filename)
+			}
+		}
+		pinned, err := db.GetArtifact(lru[0].VersionPURL, lru[0].Filename)
+		if err != nil || pinned == nil || !pinned.Pinned {
+			t.Errorf("expected artifact to read back as pinned, got %+v, %v", pinned, err)
+		}
+		if err := db.PinArtifact("pkg:npm/nope@1.0.0", "nope.tgz", true); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("PinArtifact on missing artifact = %v, want sql.ErrNoRows", err)
+		}
+
+		page, err := db.ListCachedArtifactsAfter(0, 2)
+		if err != nil {
+			t.Fatalf("ListCachedArtifactsAfter failed: %v", err)
+		}
+		if len(page) != 2 {
+			t.Fatalf("expected first page of 2, got %d", len(page))
+		}
+		rest, err := db.ListCachedArtifactsAfter(page[1].ID, 2)
+		if err != nil {
+			t.Fatalf("ListCachedArtifactsAfter failed: %v", err)
+		}
+		if len(rest) != 1 || rest[0].ID <= page[1].ID {
+			t.Errorf("expected one artifact after id %d, got %+v", page[1].ID, rest)
+		}
+	})
+}
+
+func TestSampleCachedArtifacts(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		_ = db.UpsertPackage(&Package{PURL: "pkg:npm/test", Ecosystem: "npm", Name: "test"})
+		_ = db.UpsertVersion(&Version{
+			PURL:        "pkg:npm/test@1.0.0",
+			PackagePURL: "pkg:npm/test",
+			Integrity:   sql.NullString{String: "sha512-abc", Valid: true},
+		})
+		_ = db.UpsertVersion(&Version{PURL: "pkg:npm/test@2.0.0", PackagePURL: "pkg:npm/test"})
+
+		// Checkable through the version's integrity.
+		_ = db.UpsertArtifact(&Artifact{
+			VersionPURL: "pkg:npm/test@1.0.0",
+			Filename:    "test-1.0.0.tgz",
+			UpstreamURL: "https://example.com/test-1.0.0.tgz",
+			StoragePath: sql.NullString{String: "npm/test/1.0.0/test-1.0.0.tgz", Valid: true},
+		})
+		// Checkable through its own content hash.
+		_ = db.UpsertArtifact(&Artifact{
+			VersionPURL: "pkg:npm/test@2.0.0",
+			Filename:    "test-2.0.0.tgz",
+			UpstreamURL: "https://example.com/test-2.0.0.tgz",
+			StoragePath: sql.NullString{String: "npm/test/2.0.0/test-2.0.0.tgz", Valid: true},
+			ContentHash: sql.NullString{String: "deadbeef", Valid: true},
+		})
+		// Nothing to check against.
+		_ = db.UpsertArtifact(&Artifact{
+			VersionPURL: "pkg:npm/test@2.0.0",
+			Filename:    "test-2.0.0.tgz.sig",
+			UpstreamURL: "https://example.com/test-2.0.0.tgz.sig",
+			StoragePath: sql.NullString{String: "npm/test/2.0.0/test-2.0.0.tgz.sig", Valid: true},
+		})
+		// Not cached.
+		_ = db.UpsertArtifact(&Artifact{
+			VersionPURL: "pkg:npm/test@2.0.0",
+			Filename:    "test-2.0.0.zip",
+			UpstreamURL: "https://example.com/test-2.0.0.zip",
+			ContentHash: sql.NullString{String: "deadbeef", Valid: true},
+		})
+
+		sample, err := db.SampleCachedArtifacts(10)
+		if err != nil {
+			t.Fatalf("SampleCachedArtifacts failed: %v", err)
+		}
+		if len(sample) != 2 {
+			t.Fatalf("expected 2 sampled artifacts, got %d: %+v", len(sample), sample)
+		}
+		for _, a := range sample {
+			if a.Ecosystem != "npm" {
+				t.Errorf("%s: ecosystem = %q, want npm", a.Filename, a.Ecosystem)
+			}
+			switch a.Filename {
+			case "test-1.0.0.tgz":
+				if a.Integrity.String != "sha512-abc" {
+					t.Errorf("integrity = %q, want sha512-abc", a.Integrity.String)
+				}
+			case "test-2.0.0.tgz":
+				if a.ContentHash.String != "deadbeef" {
+					t.Errorf("content hash = %q, want deadbeef", a.ContentHash.String)
+				}
+			default:
+				t.Errorf("unexpected sampled artifact %s", a.Filename)
+			}
+		}
+
+		one, err := db.SampleCachedArtifacts(1)
+		if err != nil {
+			t.Fatalf("SampleCachedArtifacts failed: %v", err)
+		}
+		if len(one) != 1 {
+			t.Errorf("expected sample of 1, got %d", len(one))
+		}
 	})
 }
 
@@ -374,12 +505,93 @@ func TestGetCacheStats(t *testing.T) {
 		if stats.EcosystemCounts["npm"] != 2 {
 			t.Errorf("expected 2 npm packages, got %d", stats.EcosystemCounts["npm"])
 		}
+
+		byEcosystem, err := db.GetCacheStatsByEcosystem()
+		if err != nil {
+			t.Fatalf("GetCacheStatsByEcosystem failed: %v", err)
+		}
+		want := []EcosystemCacheStats{
+			{Ecosystem: "cargo", Artifacts: 2, Size: 2000, Hits: 3},
+			{Ecosystem: "npm", Artifacts: 2, Size: 2000, Hits: 3},
+		}
+		if !reflect.DeepEqual(byEcosystem, want) {
+			t.Errorf("GetCacheStatsByEcosystem = %+v, want %+v", byEcosystem, want)
+		}
 		if stats.EcosystemCounts["cargo"] != 2 {
 			t.Errorf("expected 2 cargo packages, got %d", stats.EcosystemCounts["cargo"])
 		}
 	})
 }
 
+func TestGetCacheStatsSince(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		now := time.Now()
+		hoursAgo := func(h int) sql.NullTime {
+			return sql.NullTime{Time: now.Add(-time.Duration(h) * time.Hour), Valid: true}
+		}
+		artifacts := []struct {
+			name         string
+			cached       bool
+			size         int64
+			fetchedAt    sql.NullTime
+			lastAccessed sql.NullTime
+		}{
+			{"old-but-hit", true, 100, hoursAgo(240), hoursAgo(1)},
+			{"new", true, 200, hoursAgo(2), sql.NullTime{}},
+			{"stale", true, 400, hoursAgo(240), hoursAgo(120)},
+			{"evicted", false, 800, hoursAgo(1), hoursAgo(1)},
+		}
+		for _, art := range artifacts {
+			pkgPURL := "pkg:npm/" + art.name
+			_ = db.UpsertPackage(&Package{PURL: pkgPURL, Ecosystem: "npm", Name: art.name})
+			versionPURL := pkgPURL + "@1.0.0"
+			_ = db.UpsertVersion(&Version{PURL: versionPURL, PackagePURL: pkgPURL})
+			a := &Artifact{
+				VersionPURL:    versionPURL,
+				Filename:       art.name + ".tgz",
+				UpstreamURL:    "https://example.com/" + art.name + ".tgz",
+				Size:           sql.NullInt64{Int64: art.size, Valid: true},
+				FetchedAt:      art.fetchedAt,
+				LastAccessedAt: art.lastAccessed,
+			}
+			if art.cached {
+				a.StoragePath = sql.NullString{String: "/cache/" + art.name + ".tgz", Valid: true}
+			}
+			if err := db.UpsertArtifact(a); err != nil {
+				t.Fatalf("UpsertArtifact: %v", err)
+			}
+		}
+
+		since := now.Add(-24 * time.Hour)
+		stats, err := db.GetCacheStatsSince(since)
+		if err != nil {
+			t.Fatalf("GetCacheStatsSince failed: %v", err)
+		}
+		want := &WindowStats{
+			Since:             since,
+			AccessedArtifacts: 2,
+			AccessedSize:      300,
+			CachedArtifacts:   1,
+			CachedSize:        200,
+		}
+		if !reflect.DeepEqual(stats, want) {
+			t.Errorf("GetCacheStatsSince(24h) = %+v, want %+v", stats, want)
+		}
+
+		// A wider window takes in the artifact last requested five days ago.
+		stats, err = db.GetCacheStatsSince(now.Add(-7 * 24 * time.Hour))
+		if err != nil {
+			t.Fatalf("GetCacheStatsSince failed: %v", err)
+		}
+		if stats.AccessedArtifacts != 3 || stats.AccessedSize != 700 {
+			t.Errorf("7d window accessed = %d (%d bytes), want 3 (700 bytes)", stats.AccessedArtifacts, stats.AccessedSize)
+		}
+		if stats.CachedArtifacts != 1 {
+			t.Errorf("7d window cached = %d, want 1", stats.CachedArtifacts)
+		}
+	})
+}
+
 func TestGetMostPopularPackages(t *testing.T) {
 	runWithBothDatabases(t, func(t *testing.T, db *DB) {
 		for i := 1; i <= 3; i++ {
@@ -550,19 +762,9 @@ func runWithBothDatabases(t *testing.T, testFunc func(t *testing.T, db *DB)) {
 	})
 }
 
-// TestMigrationFromOldSchema tests that we can migrate from an old schema
-// that's missing columns like enriched_at, registry_url, etc.
-func TestMigrationFromOldSchema(t *testing.T) {
-	dir := t.TempDir()
-	dbPath := filepath.Join(dir, "old.db")
-
-	// Create a database with old schema (missing new columns)
-	sqlDB, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		t.Fatalf("failed to open database: %v", err)
-	}
-
-	oldSchema := `
+// v1SchemaSQLite is the schema from before any migrations existed: no
+// enrichment columns, vulnerabilities, metadata_cache or migrations table.
+const v1SchemaSQLite = `
 	CREATE TABLE packages (
 		id INTEGER PRIMARY KEY,
 		purl TEXT NOT NULL,
@@ -608,9 +810,21 @@ func TestMigrationFromOldSchema(t *testing.T) {
 
 	CREATE TABLE schema_info (version INTEGER NOT NULL);
 	INSERT INTO schema_info (version) VALUES (1);
-	`
+`
+
+// TestMigrationFromOldSchema tests that we can migrate from an old schema
+// that's missing columns like enriched_at, registry_url, etc.
+func TestMigrationFromOldSchema(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "old.db")
 
-	if _, err := sqlDB.Exec(oldSchema); err != nil {
+	// Create a database with old schema (missing new columns)
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if _, err := sqlDB.Exec(v1SchemaSQLite); err != nil {
 		t.Fatalf("failed to create old schema: %v", err)
 	}
 
@@ -806,6 +1020,147 @@ func TestMigrateSchemaUpgradeFromFullyMigrated(t *testing.T) {
 	}
 }
 
+func openV1Database(t *testing.T) *DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "v1.db")
+
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := sqlDB.Exec(v1SchemaSQLite); err != nil {
+		t.Fatalf("failed to create v1 schema: %v", err)
+	}
+	// schema_info belongs to git-pkgs, which may hold any version there;
+	// migrating must leave it exactly as it was.
+	if _, err := sqlDB.Exec("INSERT INTO schema_info (version) VALUES (7)"); err != nil {
+		t.Fatalf("failed to add schema_info row: %v", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatalf("failed to close database: %v", err)
+	}
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// assertSchemaVersion checks the proxy's schema version and that
+// schema_info holds exactly wantInfo.
+func assertSchemaVersion(t *testing.T, db *DB, want int, wantInfo ...int) {
+	t.Helper()
+	var info []int
+	if err := db.Select(&info, "SELECT version FROM schema_info ORDER BY version"); err != nil {
+		t.Fatalf("reading schema_info: %v", err)
+	}
+	if !slices.Equal(info, wantInfo) {
+		t.Errorf("schema_info = %v, want %v", info, wantInfo)
+	}
+	got, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("schema version = %d, want %d", got, want)
+	}
+}
+
+func TestSchemaVersionMatchesMigrations(t *testing.T) {
+	if want := migrationVersion(len(migrations) - 1); SchemaVersion != want {
+		t.Errorf("SchemaVersion = %d, want %d; bump it when adding a migration", SchemaVersion, want)
+	}
+}
+
+func TestMigrateStepwiseFromV1(t *testing.T) {
+	db := openV1Database(t)
+
+	for i, m := range migrations {
+		version := migrationVersion(i)
+		if err := db.migrateTo(version); err != nil {
+			t.Fatalf("migrateTo(%d) failed: %v", version, err)
+		}
+		assertSchemaVersion(t, db, version, 1, 7)
+
+		applied, err := db.appliedMigrations()
+		if err != nil {
+			t.Fatalf("appliedMigrations failed: %v", err)
+		}
+		if len(applied) != i+1 || !applied[m.name] {
+			t.Errorf("after version %d applied = %v, want first %d migrations", version, applied, i+1)
+		}
+	}
+
+	if has, _ := db.HasTable("policy_events"); !has {
+		t.Error("expected policy_events table after migrating to current version")
+	}
+
+	// Re-running is a no-op and leaves a single row at the current version.
+	for range 2 {
+		if err := db.MigrateSchema(); err != nil {
+			t.Fatalf("MigrateSchema re-run failed: %v", err)
+		}
+		assertSchemaVersion(t, db, SchemaVersion, 1, 7)
+	}
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		t.Fatalf("PendingMigrations failed: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending migrations after re-run: %v", pending)
+	}
+}
+
+func TestMigrateFailedStepDoesNotAdvanceVersion(t *testing.T) {
+	db := openV1Database(t)
+
+	if err := db.migrateTo(3); err != nil {
+		t.Fatalf("migrateTo(3) failed: %v", err)
+	}
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append([]migration{}, saved[:2]...)
+	migrations = append(migrations, migration{"003_broken", func(s *schemaTx) error {
+		if _, err := s.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+			return err
+		}
+		return errors.New("step failed")
+	}})
+
+	if err := db.MigrateSchema(); err == nil {
+		t.Fatal("expected MigrateSchema to fail")
+	}
+	assertSchemaVersion(t, db, 3, 1, 7)
+
+	if has, _ := db.HasTable("half_done"); has {
+		t.Error("partial migration was not rolled back")
+	}
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		t.Fatalf("appliedMigrations failed: %v", err)
+	}
+	if applied["003_broken"] {
+		t.Error("failed migration was recorded as applied")
+	}
+}
+
+func TestCreateSchemaSingleVersionRow(t *testing.T) {
+	db, err := Create(filepath.Join(t.TempDir(), "fresh.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	assertSchemaVersion(t, db, SchemaVersion, 1)
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatalf("MigrateSchema failed: %v", err)
+	}
+	assertSchemaVersion(t, db, SchemaVersion, 1)
+}
+
 func TestConcurrentWrites(t *testing.T) {
 	dir := t.TempDir()
 	dbPath := filepath.Join(dir, "test.db")
@@ -1014,3 +1369,69 @@ func BenchmarkMigrateSchemaFullyMigrated(b *testing.B) {
 		}
 	}
 }
+
+func TestGetVersionsByPackagePURLSorted(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		pkg := &Package{PURL: "pkg:npm/semver-order", Ecosystem: "npm", Name: "semver-order"}
+		if err := db.UpsertPackage(pkg); err != nil {
+			t.Fatalf("UpsertPackage failed: %v", err)
+		}
+		// Insert in an order that differs from version order.
+		for _, v := range []string{"1.9.0", "2.0.0", "1.10.0", "2.0.0-rc.1", "1.10.0-alpha"} {
+			if err := db.UpsertVersion(&Version{PURL: pkg.PURL + "@" + v, PackagePURL: pkg.PURL}); err != nil {
+				t.Fatalf("UpsertVersion(%s) failed: %v", v, err)
+			}
+		}
+
+		versions, err := db.GetVersionsByPackagePURLSorted(pkg.PURL)
+		if err != nil {
+			t.Fatalf("GetVersionsByPackagePURLSorted failed: %v", err)
+		}
+		var got []string
+		for _, v := range versions {
+			got = append(got, v.Version())
+		}
+		want := []string{"2.0.0", "2.0.0-rc.1", "1.10.0", "1.10.0-alpha", "1.9.0"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("versions = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestSortVersionsDescendingUsesScheme(t *testing.T) {
+	versions := []Version{
+		{PURL: "pkg:pypi/requests@2.9.0"},
+		{PURL: "pkg:pypi/requests@2.10.0rc1"},
+		{PURL: "pkg:pypi/requests@2.10.0"},
+	}
+	SortVersionsDescending(versions, "pypi")
+
+	want := []string{"2.10.0", "2.10.0rc1", "2.9.0"}
+	for i, w := range want {
+		if versions[i].Version() != w {
+			t.Errorf("versions[%d] = %s, want %s", i, versions[i].Version(), w)
+		}
+	}
+}
+
+func TestPURLType(t *testing.T) {
+	tests := []struct {
+		purl string
+		want string
+	}{
+		{"pkg:npm/lodash", "npm"},
+		{"pkg:npm/%40babel/core", "npm"},
+		{"pkg:npm/%40babel/core@7.24.0", "npm"},
+		{"pkg:maven/org.apache.commons/commons-lang3@3.14.0", "maven"},
+		{"pkg:golang/github.com/stretchr/testify@v1.9.0", "golang"},
+		{"pkg:deb/debian/curl@8.5.0?arch=amd64", "deb"},
+		{"pkg:NPM/lodash", "npm"},
+		{"lodash", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := purlType(tt.purl); got != tt.want {
+			t.Errorf("purlType(%q) = %q, want %q", tt.purl, got, tt.want)
+		}
+	}
+}
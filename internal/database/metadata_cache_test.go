@@ -178,3 +178,26 @@ func TestMetadataCacheTableCreatedByMigration(t *testing.T) {
 		t.Error("metadata_cache table should exist after migration")
 	}
 }
+
+func TestGetMetadataCacheForPackage(t *testing.T) {
+	db := setupMetadataCacheDB(t)
+
+	for _, name := range []string{"requests", "requests/simple", "requests-oauth", "flask/simple"} {
+		if err := db.UpsertMetadataCache(&MetadataCacheEntry{
+			Ecosystem:   "pypi",
+			Name:        name,
+			StoragePath: "_metadata/pypi/" + name,
+			FetchedAt:   sql.NullTime{Time: time.Now(), Valid: true},
+		}); err != nil {
+			t.Fatalf("UpsertMetadataCache(%s) error = %v", name, err)
+		}
+	}
+
+	entries, err := db.GetMetadataCacheForPackage("pypi", "requests")
+	if err != nil {
+		t.Fatalf("GetMetadataCacheForPackage() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "requests" || entries[1].Name != "requests/simple" {
+		t.Errorf("entries = %+v, want requests and requests/simple", entries)
+	}
+}
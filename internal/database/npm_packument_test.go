@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNPMPackumentRoundTrip(t *testing.T) {
+	db, err := Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	got, err := db.GetNPMPackument("@acme/widgets")
+	if err != nil {
+		t.Fatalf("GetNPMPackument() error = %v", err)
+	}
+	if got != nil {
+		t.Fatalf("GetNPMPackument() = %+v, want nil before publish", got)
+	}
+
+	if err := db.UpsertNPMPackument("@acme/widgets", `{"name":"@acme/widgets"}`); err != nil {
+		t.Fatalf("UpsertNPMPackument() error = %v", err)
+	}
+	if err := db.UpsertNPMPackument("@acme/widgets", `{"name":"@acme/widgets","versions":{}}`); err != nil {
+		t.Fatalf("UpsertNPMPackument() second call error = %v", err)
+	}
+
+	got, err = db.GetNPMPackument("@acme/widgets")
+	if err != nil {
+		t.Fatalf("GetNPMPackument() error = %v", err)
+	}
+	if got == nil {
+		t.Fatal("GetNPMPackument() = nil after publish")
+	}
+	if got.Document != `{"name":"@acme/widgets","versions":{}}` {
+		t.Errorf("Document = %s, want the second upsert", got.Document)
+	}
+	if got.CreatedAt.After(got.UpdatedAt) {
+		t.Errorf("CreatedAt %v after UpdatedAt %v", got.CreatedAt, got.UpdatedAt)
+	}
+}
+
+func TestDeleteVersionAndPackage(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		pkgPURL := "pkg:npm/widgets"
+		if err := db.UpsertPackage(&Package{PURL: pkgPURL, Ecosystem: testEcosystemNPM, Name: "widgets"}); err != nil {
+			t.Fatalf("UpsertPackage: %v", err)
+		}
+		for _, v := range []string{"1.0.0", "2.0.0"} {
+			versionPURL := pkgPURL + "@" + v
+			if err := db.UpsertVersion(&Version{PURL: versionPURL, PackagePURL: pkgPURL}); err != nil {
+				t.Fatalf("UpsertVersion: %v", err)
+			}
+			if err := db.UpsertArtifact(&Artifact{
+				VersionPURL: versionPURL,
+				Filename:    "widgets-" + v + ".tgz",
+				StoragePath: sql.NullString{String: "npm/widgets/" + v, Valid: true},
+			}); err != nil {
+				t.Fatalf("UpsertArtifact: %v", err)
+			}
+		}
+		if err := db.UpsertNPMPackument("widgets", `{}`); err != nil {
+			t.Fatalf("UpsertNPMPackument: %v", err)
+		}
+
+		paths, err := db.DeleteVersion(pkgPURL + "@2.0.0")
+		if err != nil {
+			t.Fatalf("DeleteVersion: %v", err)
+		}
+		if !reflect.DeepEqual(paths, []string{"npm/widgets/2.0.0"}) {
+			t.Errorf("DeleteVersion paths = %v", paths)
+		}
+		if v, _ := db.GetVersionByPURL(pkgPURL + "@2.0.0"); v != nil {
+			t.Error("deleted version still present")
+		}
+		if v, _ := db.GetVersionByPURL(pkgPURL + "@1.0.0"); v == nil {
+			t.Error("other version was deleted")
+		}
+
+		paths, err = db.DeletePackage(pkgPURL)
+		if err != nil {
+			t.Fatalf("DeletePackage: %v", err)
+		}
+		if !reflect.DeepEqual(paths, []string{"npm/widgets/1.0.0"}) {
+			t.Errorf("DeletePackage paths = %v", paths)
+		}
+		if pkg, _ := db.GetPackageByPURL(pkgPURL); pkg != nil {
+			t.Error("deleted package still present")
+		}
+		if art, _ := db.GetArtifact(pkgPURL+"@1.0.0", "widgets-1.0.0.tgz"); art != nil {
+			t.Error("artifact of deleted package still present")
+		}
+
+		if err := db.DeleteNPMPackument("widgets"); err != nil {
+			t.Fatalf("DeleteNPMPackument: %v", err)
+		}
+		if p, _ := db.GetNPMPackument("widgets"); p != nil {
+			t.Error("deleted packument still present")
+		}
+	})
+}
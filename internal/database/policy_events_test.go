@@ -0,0 +1,78 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyEvents(t *testing.T) {
+	db, err := Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, e := range []PolicyEvent{
+		{Ecosystem: testEcosystemNPM, Name: "left-pad", Version: "1.0.0", Decision: "deny", Reason: "blocked"},
+		{Ecosystem: "pypi", Name: "requests", Decision: "deny", Reason: "license"},
+		{Ecosystem: testEcosystemNPM, Name: "lodash", Version: "4.17.21", Decision: "deny", Reason: "blocked"},
+	} {
+		if err := db.InsertPolicyEvent(&e); err != nil {
+			t.Fatalf("InsertPolicyEvent() error = %v", err)
+		}
+	}
+
+	events, err := db.ListPolicyEvents(testEcosystemNPM, 10, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyEvents() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d npm events, want 2", len(events))
+	}
+	if events[0].Name != "lodash" {
+		t.Errorf("first event = %q, want newest (lodash)", events[0].Name)
+	}
+	if events[0].CreatedAt.IsZero() {
+		t.Error("created_at not set")
+	}
+
+	removed, err := db.PrunePolicyEvents(1)
+	if err != nil {
+		t.Fatalf("PrunePolicyEvents() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+
+	events, err = db.ListPolicyEvents("", 10, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyEvents() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Name != "lodash" {
+		t.Errorf("remaining events = %+v, want only lodash", events)
+	}
+}
+
+func TestPolicyEventsTableCreatedByMigration(t *testing.T) {
+	db := setupMetadataCacheDB(t)
+
+	// Simulate a database from before the policy_events migration existed.
+	if _, err := db.Exec("DROP TABLE policy_events"); err != nil {
+		t.Fatalf("dropping policy_events: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM migrations WHERE name = '006_ensure_policy_events_table'"); err != nil {
+		t.Fatalf("deleting migration record: %v", err)
+	}
+
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatalf("MigrateSchema() error = %v", err)
+	}
+
+	has, err := db.HasTable("policy_events")
+	if err != nil {
+		t.Fatalf("HasTable() error = %v", err)
+	}
+	if !has {
+		t.Error("policy_events table should exist after migration")
+	}
+}
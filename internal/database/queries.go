@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+	"unicode/utf8"
 )
 
 // Package queries
@@ -46,48 +47,30 @@ func (db *DB) GetPackageByEcosystemName(ecosystem, name string) (*Package, error
 	return &pkg, nil
 }
 
+// packageUpsert keeps a known latest_version and supplier when the incoming
+// row doesn't have them, so downloads and enrichment without that data don't
+// erase it.
+var packageUpsert = upsert{
+	table: "packages",
+	columns: []string{"purl", "ecosystem", "name", "latest_version", "license",
+		"description", "homepage", "repository_url", "registry_url",
+		"supplier_name", "supplier_type", "enriched_at", "created_at", "updated_at"},
+	conflict: []string{"purl"},
+	set: []string{
+		"latest_version = COALESCE(excluded.latest_version, packages.latest_version)",
+		"supplier_name = COALESCE(excluded.supplier_name, packages.supplier_name)",
+		"supplier_type = COALESCE(excluded.supplier_type, packages.supplier_type)",
+	},
+	update: []string{"license", "description", "homepage", "repository_url",
+		"registry_url", "enriched_at", "updated_at"},
+}
+
 func (db *DB) UpsertPackage(pkg *Package) error {
 	now := time.Now()
-	var query string
-
-	if db.dialect == DialectPostgres {
-		query = `
-			INSERT INTO packages (purl, ecosystem, name, latest_version, license,
-			                      description, homepage, repository_url, registry_url,
-			                      enriched_at, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-			ON CONFLICT(purl) DO UPDATE SET
-				latest_version = EXCLUDED.latest_version,
-				license = EXCLUDED.license,
-				description = EXCLUDED.description,
-				homepage = EXCLUDED.homepage,
-				repository_url = EXCLUDED.repository_url,
-				registry_url = EXCLUDED.registry_url,
-				enriched_at = EXCLUDED.enriched_at,
-				updated_at = EXCLUDED.updated_at
-		`
-	} else {
-		query = `
-			INSERT INTO packages (purl, ecosystem, name, latest_version, license,
-			                      description, homepage, repository_url, registry_url,
-			                      enriched_at, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(purl) DO UPDATE SET
-				latest_version = excluded.latest_version,
-				license = excluded.license,
-				description = excluded.description,
-				homepage = excluded.homepage,
-				repository_url = excluded.repository_url,
-				registry_url = excluded.registry_url,
-				enriched_at = excluded.enriched_at,
-				updated_at = excluded.updated_at
-		`
-	}
-
-	_, err := db.Exec(query,
+	err := db.execUpsert(packageUpsert,
 		pkg.PURL, pkg.Ecosystem, pkg.Name, pkg.LatestVersion,
 		pkg.License, pkg.Description, pkg.Homepage, pkg.RepositoryURL,
-		pkg.RegistryURL, pkg.EnrichedAt, now, now,
+		pkg.RegistryURL, pkg.SupplierName, pkg.SupplierType, pkg.EnrichedAt, now, now,
 	)
 	if err != nil {
 		return fmt.Errorf("upserting package: %w", err)
@@ -114,6 +97,9 @@ func (db *DB) GetVersionByPURL(purl string) (*Version, error) {
 	return &v, nil
 }
 
+// GetVersionsByPackagePURL returns a package's versions in the order they
+// were cached, most recent first. Use GetVersionsByPackagePURLSorted for
+// version order.
 func (db *DB) GetVersionsByPackagePURL(packagePURL string) ([]Version, error) {
 	var versions []Version
 	query := db.Rebind(`
@@ -129,39 +115,65 @@ func (db *DB) GetVersionsByPackagePURL(packagePURL string) ([]Version, error) {
 	return versions, nil
 }
 
+// GetVersionsByPackagePURLSorted returns a package's versions newest first
+// by the ecosystem's version ordering, so 1.10.0 sorts above 1.9.0 and
+// prereleases sort below their release.
+func (db *DB) GetVersionsByPackagePURLSorted(packagePURL string) ([]Version, error) {
+	versions, err := db.GetVersionsByPackagePURL(packagePURL)
+	if err != nil {
+		return nil, err
+	}
+	SortVersionsDescending(versions, purlType(packagePURL))
+	return versions, nil
+}
+
+// GetCachedVersions returns a package's versions that have at least one
+// artifact in storage, with when each was first cached and last fetched.
+func (db *DB) GetCachedVersions(packagePURL string) ([]CachedVersion, error) {
+	var rows []struct {
+		VersionPURL string       `db:"version_purl"`
+		CreatedAt   time.Time    `db:"created_at"`
+		FetchedAt   sql.NullTime `db:"fetched_at"`
+	}
+	query := db.Rebind(`
+		SELECT a.version_purl, a.created_at, a.fetched_at
+		FROM artifacts a
+		JOIN versions v ON v.purl = a.version_purl
+		WHERE v.package_purl = ? AND a.storage_path IS NOT NULL
+		ORDER BY a.version_purl
+	`)
+	if err := db.Select(&rows, query, packagePURL); err != nil {
+		return nil, err
+	}
+
+	var versions []CachedVersion
+	for _, row := range rows {
+		if len(versions) == 0 || versions[len(versions)-1].VersionPURL != row.VersionPURL {
+			versions = append(versions, CachedVersion{VersionPURL: row.VersionPURL, FirstCachedAt: row.CreatedAt})
+		}
+		v := &versions[len(versions)-1]
+		if row.CreatedAt.Before(v.FirstCachedAt) {
+			v.FirstCachedAt = row.CreatedAt
+		}
+		if row.FetchedAt.Valid && (!v.LastFetchedAt.Valid || row.FetchedAt.Time.After(v.LastFetchedAt.Time)) {
+			v.LastFetchedAt = row.FetchedAt
+		}
+	}
+	return versions, nil
+}
+
+var versionUpsert = upsert{
+	table: "versions",
+	columns: []string{"purl", "package_purl", "license", "integrity", "published_at",
+		"yanked", "enriched_at", "created_at", "updated_at"},
+	conflict: []string{"purl"},
+	update: []string{"license", "integrity", "published_at", "yanked",
+		"enriched_at", "updated_at"},
+}
+
 func (db *DB) UpsertVersion(v *Version) error {
 	now := time.Now()
-	var query string
-
-	if db.dialect == DialectPostgres {
-		query = `
-			INSERT INTO versions (purl, package_purl, license, integrity, published_at,
-			                      yanked, enriched_at, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-			ON CONFLICT(purl) DO UPDATE SET
-				license = EXCLUDED.license,
-				integrity = EXCLUDED.integrity,
-				published_at = EXCLUDED.published_at,
-				yanked = EXCLUDED.yanked,
-				enriched_at = EXCLUDED.enriched_at,
-				updated_at = EXCLUDED.updated_at
-		`
-	} else {
-		query = `
-			INSERT INTO versions (purl, package_purl, license, integrity, published_at,
-			                      yanked, enriched_at, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(purl) DO UPDATE SET
-				license = excluded.license,
-				integrity = excluded.integrity,
-				published_at = excluded.published_at,
-				yanked = excluded.yanked,
-				enriched_at = excluded.enriched_at,
-				updated_at = excluded.updated_at
-		`
-	}
-
-	_, err := db.Exec(query,
+	err := db.execUpsert(versionUpsert,
 		v.PURL, v.PackagePURL, v.License, v.Integrity,
 		v.PublishedAt, v.Yanked, v.EnrichedAt, now, now,
 	)
@@ -171,6 +183,28 @@ func (db *DB) UpsertVersion(v *Version) error {
 	return nil
 }
 
+// SetVersionYanked records whether upstream has yanked (or retracted) a
+// version. Versions the proxy has not seen are left alone.
+func (db *DB) SetVersionYanked(purl string, yanked bool) error {
+	query := db.Rebind(`UPDATE versions SET yanked = ?, updated_at = ? WHERE purl = ? AND yanked != ?`)
+	_, err := db.Exec(query, yanked, time.Now(), purl, yanked)
+	if err != nil {
+		return fmt.Errorf("setting version yanked: %w", err)
+	}
+	return nil
+}
+
+// SetVersionPublishedAt records when upstream published a version.
+// Versions the proxy has not seen are left alone.
+func (db *DB) SetVersionPublishedAt(purl string, publishedAt time.Time) error {
+	query := db.Rebind(`UPDATE versions SET published_at = ?, updated_at = ? WHERE purl = ?`)
+	_, err := db.Exec(query, publishedAt, time.Now(), purl)
+	if err != nil {
+		return fmt.Errorf("setting version published_at: %w", err)
+	}
+	return nil
+}
+
 // Artifact queries
 
 func (db *DB) GetArtifact(versionPURL, filename string) (*Artifact, error) {
@@ -178,7 +212,7 @@ func (db *DB) GetArtifact(versionPURL, filename string) (*Artifact, error) {
 	query := db.Rebind(`
 		SELECT id, version_purl, filename, upstream_url, storage_path, content_hash,
 		       size, content_type, fetched_at, hit_count, last_accessed_at,
-		       created_at, updated_at
+		       pinned, created_at, updated_at
 		FROM artifacts WHERE version_purl = ? AND filename = ?
 	`)
 	err := db.Get(&a, query, versionPURL, filename)
@@ -196,7 +230,7 @@ func (db *DB) GetArtifactByPath(storagePath string) (*Artifact, error) {
 	query := db.Rebind(`
 		SELECT id, version_purl, filename, upstream_url, storage_path, content_hash,
 		       size, content_type, fetched_at, hit_count, last_accessed_at,
-		       created_at, updated_at
+		       pinned, created_at, updated_at
 		FROM artifacts WHERE storage_path = ?
 	`)
 	err := db.Get(&a, query, storagePath)
@@ -214,7 +248,7 @@ func (db *DB) GetArtifactsByVersionPURL(versionPURL string) ([]Artifact, error)
 	query := db.Rebind(`
 		SELECT id, version_purl, filename, upstream_url, storage_path, content_hash,
 		       size, content_type, fetched_at, hit_count, last_accessed_at,
-		       created_at, updated_at
+		       pinned, created_at, updated_at
 		FROM artifacts WHERE version_purl = ?
 		ORDER BY filename
 	`)
@@ -225,41 +259,21 @@ func (db *DB) GetArtifactsByVersionPURL(versionPURL string) ([]Artifact, error)
 	return artifacts, nil
 }
 
+// artifactUpsert leaves upstream_url, hit_count and last_accessed_at alone on
+// conflict so re-caching a file doesn't reset its usage history.
+var artifactUpsert = upsert{
+	table: "artifacts",
+	columns: []string{"version_purl", "filename", "upstream_url", "storage_path", "content_hash",
+		"size", "content_type", "fetched_at", "hit_count", "last_accessed_at",
+		"created_at", "updated_at"},
+	conflict: []string{"version_purl", "filename"},
+	update: []string{"storage_path", "content_hash", "size", "content_type",
+		"fetched_at", "updated_at"},
+}
+
 func (db *DB) UpsertArtifact(a *Artifact) error {
 	now := time.Now()
-	var query string
-
-	if db.dialect == DialectPostgres {
-		query = `
-			INSERT INTO artifacts (version_purl, filename, upstream_url, storage_path, content_hash,
-			                       size, content_type, fetched_at, hit_count, last_accessed_at,
-			                       created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-			ON CONFLICT(version_purl, filename) DO UPDATE SET
-				storage_path = EXCLUDED.storage_path,
-				content_hash = EXCLUDED.content_hash,
-				size = EXCLUDED.size,
-				content_type = EXCLUDED.content_type,
-				fetched_at = EXCLUDED.fetched_at,
-				updated_at = EXCLUDED.updated_at
-		`
-	} else {
-		query = `
-			INSERT INTO artifacts (version_purl, filename, upstream_url, storage_path, content_hash,
-			                       size, content_type, fetched_at, hit_count, last_accessed_at,
-			                       created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(version_purl, filename) DO UPDATE SET
-				storage_path = excluded.storage_path,
-				content_hash = excluded.content_hash,
-				size = excluded.size,
-				content_type = excluded.content_type,
-				fetched_at = excluded.fetched_at,
-				updated_at = excluded.updated_at
-		`
-	}
-
-	_, err := db.Exec(query,
+	err := db.execUpsert(artifactUpsert,
 		a.VersionPURL, a.Filename, a.UpstreamURL, a.StoragePath, a.ContentHash,
 		a.Size, a.ContentType, a.FetchedAt, a.HitCount, a.LastAccessedAt, now, now,
 	)
@@ -292,26 +306,110 @@ func (db *DB) MarkArtifactCached(versionPURL, filename, storagePath, contentHash
 	return err
 }
 
+// PinArtifact sets or clears an artifact's pinned flag. Pinned artifacts are
+// skipped by GetLeastRecentlyUsedArtifacts, so eviction never removes them.
+// Returns sql.ErrNoRows if there is no such artifact.
+func (db *DB) PinArtifact(versionPURL, filename string, pinned bool) error {
+	query := db.Rebind(`
+		UPDATE artifacts SET pinned = ?, updated_at = ?
+		WHERE version_purl = ? AND filename = ?
+	`)
+	res, err := db.Exec(query, pinned, time.Now(), versionPURL, filename)
+	if err != nil {
+		return fmt.Errorf("pinning artifact: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("pinning artifact: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // Cache management queries
 
+// GetLeastRecentlyUsedArtifacts returns up to limit cached, unpinned
+// artifacts, least recently accessed first.
 func (db *DB) GetLeastRecentlyUsedArtifacts(limit int) ([]Artifact, error) {
+	return db.ListLeastRecentlyUsedArtifacts(0, limit)
+}
+
+// ListLeastRecentlyUsedArtifacts is GetLeastRecentlyUsedArtifacts starting
+// offset rows in, for callers that page through the order without removing
+// what they have seen.
+func (db *DB) ListLeastRecentlyUsedArtifacts(offset, limit int) ([]Artifact, error) {
+	var artifacts []Artifact
+	query := db.Rebind(`
+		SELECT id, version_purl, filename, upstream_url, storage_path, content_hash,
+		       size, content_type, fetched_at, hit_count, last_accessed_at,
+		       pinned, created_at, updated_at
+		FROM artifacts
+		WHERE storage_path IS NOT NULL AND NOT pinned
+		ORDER BY last_accessed_at ASC NULLS FIRST, id
+		LIMIT ? OFFSET ?
+	`)
+	err := db.Select(&artifacts, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+// ListCachedArtifactsAfter returns up to limit cached artifacts with an id
+// greater than afterID, ordered by id. Callers page through the whole table
+// by passing the last id they saw.
+func (db *DB) ListCachedArtifactsAfter(afterID int64, limit int) ([]Artifact, error) {
 	var artifacts []Artifact
 	query := db.Rebind(`
 		SELECT id, version_purl, filename, upstream_url, storage_path, content_hash,
 		       size, content_type, fetched_at, hit_count, last_accessed_at,
-		       created_at, updated_at
+		       pinned, created_at, updated_at
 		FROM artifacts
-		WHERE storage_path IS NOT NULL
-		ORDER BY last_accessed_at ASC NULLS FIRST
+		WHERE storage_path IS NOT NULL AND id > ?
+		ORDER BY id
 		LIMIT ?
 	`)
-	err := db.Select(&artifacts, query, limit)
+	err := db.Select(&artifacts, query, afterID, limit)
 	if err != nil {
 		return nil, err
 	}
 	return artifacts, nil
 }
 
+// SampledArtifact is a cached artifact picked for an integrity check, with
+// the hashes it can be checked against.
+type SampledArtifact struct {
+	VersionPURL string         `db:"version_purl"`
+	Filename    string         `db:"filename"`
+	Ecosystem   string         `db:"ecosystem"`
+	StoragePath string         `db:"storage_path"`
+	ContentHash sql.NullString `db:"content_hash"`
+	Integrity   sql.NullString `db:"integrity"`
+}
+
+// SampleCachedArtifacts returns up to n cached artifacts chosen at random
+// from those with a content hash or upstream integrity to check against.
+func (db *DB) SampleCachedArtifacts(n int) ([]SampledArtifact, error) {
+	var artifacts []SampledArtifact
+	query := db.Rebind(`
+		SELECT a.version_purl, a.filename, COALESCE(p.ecosystem, '') AS ecosystem,
+		       a.storage_path, a.content_hash, v.integrity
+		FROM artifacts a
+		LEFT JOIN versions v ON v.purl = a.version_purl
+		LEFT JOIN packages p ON p.purl = v.package_purl
+		WHERE a.storage_path IS NOT NULL
+		  AND (a.content_hash IS NOT NULL OR v.integrity IS NOT NULL)
+		ORDER BY RANDOM()
+		LIMIT ?
+	`)
+	if err := db.Select(&artifacts, query, n); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
 func (db *DB) GetTotalCacheSize() (int64, error) {
 	var total sql.NullInt64
 	err := db.Get(&total, `SELECT SUM(size) FROM artifacts WHERE storage_path IS NOT NULL`)
@@ -407,6 +505,100 @@ func (db *DB) GetCacheStats() (*CacheStats, error) {
 	return stats, rows.Err()
 }
 
+// EcosystemCacheStats is the cached artifact count, size and hit count for
+// one ecosystem.
+type EcosystemCacheStats struct {
+	Ecosystem string `db:"ecosystem"`
+	Artifacts int64  `db:"artifacts"`
+	Size      int64  `db:"size"`
+	Hits      int64  `db:"hits"`
+}
+
+// GetCacheStatsByEcosystem breaks the cached artifacts down by ecosystem in
+// a single grouped query, ordered by ecosystem. Ecosystems with nothing
+// cached are left out.
+func (db *DB) GetCacheStatsByEcosystem() ([]EcosystemCacheStats, error) {
+	hasArtifacts, err := db.HasTable("artifacts")
+	if err != nil {
+		return nil, err
+	}
+	if !hasArtifacts {
+		return nil, nil
+	}
+
+	var stats []EcosystemCacheStats
+	err = db.Select(&stats, `
+		SELECT p.ecosystem,
+		       COUNT(*) as artifacts,
+		       COALESCE(SUM(a.size), 0) as size,
+		       COALESCE(SUM(a.hit_count), 0) as hits
+		FROM artifacts a
+		JOIN versions v ON v.purl = a.version_purl
+		JOIN packages p ON p.purl = v.package_purl
+		WHERE a.storage_path IS NOT NULL
+		GROUP BY p.ecosystem
+		ORDER BY p.ecosystem
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// WindowStats describes cache activity since a point in time. hit_count is
+// a running total, so demand in the window is approximated by the cached
+// artifacts last requested or fetched in it rather than by their hits.
+type WindowStats struct {
+	Since time.Time
+	// Hits counts the cache hits recorded in artifact_hits in the window.
+	// It stays zero unless the hit timeline is enabled.
+	Hits int64
+	// AccessedArtifacts and AccessedSize cover cached artifacts requested
+	// or fetched since Since: roughly the cache needed for recent demand.
+	AccessedArtifacts int64
+	AccessedSize      int64
+	// CachedArtifacts and CachedSize cover artifacts fetched from upstream
+	// since Since.
+	CachedArtifacts int64
+	CachedSize      int64
+}
+
+// GetCacheStatsSince reports the cached artifacts accessed and fetched at
+// or after since, and the hits recorded since then.
+func (db *DB) GetCacheStatsSince(since time.Time) (*WindowStats, error) {
+	stats := &WindowStats{Since: since}
+	hasArtifacts, err := db.HasTable("artifacts")
+	if err != nil {
+		return nil, err
+	}
+	if !hasArtifacts {
+		return stats, nil
+	}
+
+	row := db.QueryRow(db.Rebind(`
+		SELECT COUNT(*), COALESCE(SUM(size), 0)
+		FROM artifacts
+		WHERE storage_path IS NOT NULL AND (last_accessed_at >= ? OR fetched_at >= ?)
+	`), since, since)
+	if err := row.Scan(&stats.AccessedArtifacts, &stats.AccessedSize); err != nil {
+		return nil, err
+	}
+
+	row = db.QueryRow(db.Rebind(`
+		SELECT COUNT(*), COALESCE(SUM(size), 0)
+		FROM artifacts
+		WHERE storage_path IS NOT NULL AND fetched_at >= ?
+	`), since)
+	if err := row.Scan(&stats.CachedArtifacts, &stats.CachedSize); err != nil {
+		return nil, err
+	}
+
+	if stats.Hits, err = db.countArtifactHitsSince(since); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
 type PopularPackage struct {
 	Ecosystem string `db:"ecosystem"`
 	Name      string `db:"name"`
@@ -617,43 +809,19 @@ func (db *DB) GetVulnerabilitiesForPackage(ecosystem, name string) ([]Vulnerabil
 	return vulns, nil
 }
 
+var vulnerabilityUpsert = upsert{
+	table: "vulnerabilities",
+	columns: []string{"vuln_id", "ecosystem", "package_name", "severity", "summary",
+		"fixed_version", "cvss_score", `"references"`, "fetched_at",
+		"created_at", "updated_at"},
+	conflict: []string{"vuln_id", "ecosystem", "package_name"},
+	update: []string{"severity", "summary", "fixed_version", "cvss_score",
+		`"references"`, "fetched_at", "updated_at"},
+}
+
 func (db *DB) UpsertVulnerability(v *Vulnerability) error {
 	now := time.Now()
-	var query string
-
-	if db.dialect == DialectPostgres {
-		query = `
-			INSERT INTO vulnerabilities (vuln_id, ecosystem, package_name, severity, summary,
-			                             fixed_version, cvss_score, "references", fetched_at,
-			                             created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-			ON CONFLICT(vuln_id, ecosystem, package_name) DO UPDATE SET
-				severity = EXCLUDED.severity,
-				summary = EXCLUDED.summary,
-				fixed_version = EXCLUDED.fixed_version,
-				cvss_score = EXCLUDED.cvss_score,
-				"references" = EXCLUDED."references",
-				fetched_at = EXCLUDED.fetched_at,
-				updated_at = EXCLUDED.updated_at
-		`
-	} else {
-		query = `
-			INSERT INTO vulnerabilities (vuln_id, ecosystem, package_name, severity, summary,
-			                             fixed_version, cvss_score, "references", fetched_at,
-			                             created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(vuln_id, ecosystem, package_name) DO UPDATE SET
-				severity = excluded.severity,
-				summary = excluded.summary,
-				fixed_version = excluded.fixed_version,
-				cvss_score = excluded.cvss_score,
-				"references" = excluded."references",
-				fetched_at = excluded.fetched_at,
-				updated_at = excluded.updated_at
-		`
-	}
-
-	_, err := db.Exec(query,
+	err := db.execUpsert(vulnerabilityUpsert,
 		v.VulnID, v.Ecosystem, v.PackageName, v.Severity, v.Summary,
 		v.FixedVersion, v.CVSSScore, v.References, v.FetchedAt, now, now,
 	)
@@ -709,6 +877,43 @@ func (db *DB) GetPackagesNeedingVulnSync(limit int, minAge time.Duration) ([]Pac
 	return packages, nil
 }
 
+// GetPackagesMissingLatestVersion returns packages with no recorded
+// latest_version, least recently enriched first.
+func (db *DB) GetPackagesMissingLatestVersion(limit int) ([]Package, error) {
+	var packages []Package
+	query := db.Rebind(`
+		SELECT id, purl, ecosystem, name, latest_version, license,
+		       description, homepage, repository_url, registry_url,
+		       supplier_name, supplier_type, source, enriched_at,
+		       vulns_synced_at, created_at, updated_at
+		FROM packages
+		WHERE latest_version IS NULL OR latest_version = ''
+		ORDER BY enriched_at ASC NULLS FIRST, id ASC
+		LIMIT ?
+	`)
+	err := db.Select(&packages, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// SetPackageLatestVersion records the latest version for a package and
+// marks it as enriched. An empty latest leaves the column NULL so the
+// package is retried on a later pass.
+func (db *DB) SetPackageLatestVersion(purl, latest string) error {
+	now := time.Now()
+	query := db.Rebind(`
+		UPDATE packages SET latest_version = ?, enriched_at = ?, updated_at = ?
+		WHERE purl = ?
+	`)
+	_, err := db.Exec(query, sql.NullString{String: latest, Valid: latest != ""}, now, now, purl)
+	if err != nil {
+		return fmt.Errorf("setting latest version: %w", err)
+	}
+	return nil
+}
+
 func (db *DB) GetVulnCountForPackage(ecosystem, name string) (int64, error) {
 	var count int64
 	query := db.Rebind(`SELECT COUNT(*) FROM vulnerabilities WHERE ecosystem = ? AND package_name = ?`)
@@ -804,18 +1009,20 @@ func (db *DB) ListCachedPackages(ecosystem string, sortBy string, limit int, off
 		vulnSelect = "COALESCE(v.vuln_count, 0) as vuln_count"
 	}
 
-	orderClause := "ORDER BY hits DESC"
+	// Every order ends with p.purl, which is unique, so rows that tie on
+	// the sort key keep the same order from page to page.
+	orderClause := "ORDER BY hits DESC, p.purl ASC"
 	switch sortBy {
 	case "name":
-		orderClause = "ORDER BY p.name ASC"
+		orderClause = "ORDER BY p.name ASC, p.purl ASC"
 	case "size":
-		orderClause = "ORDER BY size DESC"
+		orderClause = "ORDER BY size DESC, p.purl ASC"
 	case "cached_at":
-		orderClause = "ORDER BY cached_at DESC"
+		orderClause = "ORDER BY cached_at DESC, p.purl ASC"
 	case "ecosystem":
-		orderClause = "ORDER BY p.ecosystem ASC, p.name ASC"
+		orderClause = "ORDER BY p.ecosystem ASC, p.name ASC, p.purl ASC"
 	case "vulns":
-		orderClause = "ORDER BY vuln_count DESC, p.name ASC"
+		orderClause = "ORDER BY vuln_count DESC, p.name ASC, p.purl ASC"
 	}
 
 	whereClause := "WHERE a.storage_path IS NOT NULL"
@@ -907,41 +1114,37 @@ func (db *DB) GetMetadataCache(ecosystem, name string) (*MetadataCacheEntry, err
 	return &entry, nil
 }
 
+// GetMetadataCacheForPackage returns the cached metadata documents for a
+// package: the one stored under its name and any stored under a subpath of
+// it, such as "requests/simple".
+func (db *DB) GetMetadataCacheForPackage(ecosystem, name string) ([]MetadataCacheEntry, error) {
+	var entries []MetadataCacheEntry
+	prefix := name + "/"
+	query := db.Rebind(`
+		SELECT id, ecosystem, name, storage_path, etag, content_type,
+		       size, last_modified, fetched_at, created_at, updated_at
+		FROM metadata_cache
+		WHERE ecosystem = ? AND (name = ? OR SUBSTR(name, 1, ?) = ?)
+		ORDER BY name
+	`)
+	if err := db.Select(&entries, query, ecosystem, name, utf8.RuneCountInString(prefix), prefix); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+var metadataCacheUpsert = upsert{
+	table: "metadata_cache",
+	columns: []string{"ecosystem", "name", "storage_path", "etag", "content_type",
+		"size", "last_modified", "fetched_at", "created_at", "updated_at"},
+	conflict: []string{"ecosystem", "name"},
+	update: []string{"storage_path", "etag", "content_type", "size",
+		"last_modified", "fetched_at", "updated_at"},
+}
+
 func (db *DB) UpsertMetadataCache(entry *MetadataCacheEntry) error {
 	now := time.Now()
-	var query string
-
-	if db.dialect == DialectPostgres {
-		query = `
-			INSERT INTO metadata_cache (ecosystem, name, storage_path, etag, content_type,
-			                            size, last_modified, fetched_at, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-			ON CONFLICT(ecosystem, name) DO UPDATE SET
-				storage_path = EXCLUDED.storage_path,
-				etag = EXCLUDED.etag,
-				content_type = EXCLUDED.content_type,
-				size = EXCLUDED.size,
-				last_modified = EXCLUDED.last_modified,
-				fetched_at = EXCLUDED.fetched_at,
-				updated_at = EXCLUDED.updated_at
-		`
-	} else {
-		query = `
-			INSERT INTO metadata_cache (ecosystem, name, storage_path, etag, content_type,
-			                            size, last_modified, fetched_at, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-			ON CONFLICT(ecosystem, name) DO UPDATE SET
-				storage_path = excluded.storage_path,
-				etag = excluded.etag,
-				content_type = excluded.content_type,
-				size = excluded.size,
-				last_modified = excluded.last_modified,
-				fetched_at = excluded.fetched_at,
-				updated_at = excluded.updated_at
-		`
-	}
-
-	_, err := db.Exec(query,
+	err := db.execUpsert(metadataCacheUpsert,
 		entry.Ecosystem, entry.Name, entry.StoragePath, entry.ETag,
 		entry.ContentType, entry.Size, entry.LastModified, entry.FetchedAt, now, now,
 	)
@@ -950,3 +1153,191 @@ func (db *DB) UpsertMetadataCache(entry *MetadataCacheEntry) error {
 	}
 	return nil
 }
+
+func (db *DB) InsertPolicyEvent(e *PolicyEvent) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	query := db.Rebind(`
+		INSERT INTO policy_events (created_at, client_ip, ecosystem, name, version, decision, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	_, err := db.Exec(query, e.CreatedAt, e.ClientIP, e.Ecosystem, e.Name, e.Version, e.Decision, e.Reason)
+	if err != nil {
+		return fmt.Errorf("inserting policy event: %w", err)
+	}
+	return nil
+}
+
+// ListPolicyEvents returns policy events newest first. An empty ecosystem
+// matches every ecosystem.
+func (db *DB) ListPolicyEvents(ecosystem string, limit, offset int) ([]PolicyEvent, error) {
+	var events []PolicyEvent
+	query := `
+		SELECT id, created_at, client_ip, ecosystem, name, version, decision, reason
+		FROM policy_events
+	`
+	args := []any{}
+	if ecosystem != "" {
+		query += " WHERE ecosystem = ?"
+		args = append(args, ecosystem)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	err := db.Select(&events, db.Rebind(query), args...)
+	return events, err
+}
+
+// PrunePolicyEvents deletes all but the newest keep events and returns the
+// number of rows removed.
+func (db *DB) PrunePolicyEvents(keep int) (int64, error) {
+	query := db.Rebind(`
+		DELETE FROM policy_events WHERE id <= (
+			SELECT id FROM policy_events ORDER BY id DESC LIMIT 1 OFFSET ?
+		)
+	`)
+	res, err := db.Exec(query, keep)
+	if err != nil {
+		return 0, fmt.Errorf("pruning policy events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (db *DB) InsertAccessLog(e *AccessLogEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	query := db.Rebind(`
+		INSERT INTO access_log (created_at, team, ecosystem, purl, bytes)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	_, err := db.Exec(query, e.CreatedAt, e.Team, e.Ecosystem, e.PURL, e.Bytes)
+	if err != nil {
+		return fmt.Errorf("inserting access log entry: %w", err)
+	}
+	return nil
+}
+
+// GetUsageByTeam totals the requests and bytes in the access log per team
+// for entries created at or after from and before to, largest first.
+func (db *DB) GetUsageByTeam(from, to time.Time) ([]TeamUsage, error) {
+	var usage []TeamUsage
+	query := db.Rebind(`
+		SELECT team, COUNT(*) AS requests, COALESCE(SUM(bytes), 0) AS bytes
+		FROM access_log
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY team
+		ORDER BY bytes DESC, team
+	`)
+	if err := db.Select(&usage, query, from.UTC(), to.UTC()); err != nil {
+		return nil, fmt.Errorf("aggregating access log: %w", err)
+	}
+	return usage, nil
+}
+
+// PruneAccessLog deletes all but the newest keep entries and returns the
+// number of rows removed.
+func (db *DB) PruneAccessLog(keep int) (int64, error) {
+	query := db.Rebind(`
+		DELETE FROM access_log WHERE id <= (
+			SELECT id FROM access_log ORDER BY id DESC LIMIT 1 OFFSET ?
+		)
+	`)
+	res, err := db.Exec(query, keep)
+	if err != nil {
+		return 0, fmt.Errorf("pruning access log: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetNPMPackument returns the packument of a locally published npm
+// package, or nil if the package isn't published here.
+func (db *DB) GetNPMPackument(name string) (*NPMPackument, error) {
+	var p NPMPackument
+	query := db.Rebind(`
+		SELECT name, document, created_at, updated_at
+		FROM npm_packuments WHERE name = ?
+	`)
+	err := db.Get(&p, query, name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+var npmPackumentUpsert = upsert{
+	table:    "npm_packuments",
+	columns:  []string{"name", "document", "created_at", "updated_at"},
+	conflict: []string{"name"},
+	update:   []string{"document", "updated_at"},
+}
+
+// UpsertNPMPackument stores the packument of a locally published npm
+// package, replacing any previous document.
+func (db *DB) UpsertNPMPackument(name, document string) error {
+	now := time.Now()
+	if err := db.execUpsert(npmPackumentUpsert, name, document, now, now); err != nil {
+		return fmt.Errorf("upserting npm packument: %w", err)
+	}
+	return nil
+}
+
+// DeleteNPMPackument removes the packument of a locally published npm
+// package.
+func (db *DB) DeleteNPMPackument(name string) error {
+	if _, err := db.Exec(db.Rebind(`DELETE FROM npm_packuments WHERE name = ?`), name); err != nil {
+		return fmt.Errorf("deleting npm packument: %w", err)
+	}
+	return nil
+}
+
+// DeleteVersion removes a version and its artifact rows in one transaction.
+// It returns the storage paths of the artifacts that were cached so the
+// caller can delete them from storage.
+func (db *DB) DeleteVersion(versionPURL string) ([]string, error) {
+	return db.deleteVersions(`WHERE purl = ?`, versionPURL, false)
+}
+
+// DeletePackage removes a package with all of its versions and artifact
+// rows in one transaction. Like DeleteVersion, it returns the storage paths
+// of the artifacts that were cached.
+func (db *DB) DeletePackage(packagePURL string) ([]string, error) {
+	return db.deleteVersions(`WHERE package_purl = ?`, packagePURL, true)
+}
+
+// deleteVersions deletes the versions matching versionWhere and their
+// artifacts, and the package arg names when deletePackage is set.
+func (db *DB) deleteVersions(versionWhere, arg string, deletePackage bool) ([]string, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	artifactWhere := `WHERE version_purl IN (SELECT purl FROM versions ` + versionWhere + `)`
+	var paths []string
+	if err := tx.Select(&paths, db.Rebind(`SELECT storage_path FROM artifacts `+artifactWhere+` AND storage_path IS NOT NULL`), arg); err != nil {
+		return nil, fmt.Errorf("listing artifacts: %w", err)
+	}
+	if _, err := tx.Exec(db.Rebind(`DELETE FROM artifacts `+artifactWhere), arg); err != nil {
+		return nil, fmt.Errorf("deleting artifacts: %w", err)
+	}
+	if _, err := tx.Exec(db.Rebind(`DELETE FROM versions `+versionWhere), arg); err != nil {
+		return nil, fmt.Errorf("deleting versions: %w", err)
+	}
+	if deletePackage {
+		if _, err := tx.Exec(db.Rebind(`DELETE FROM packages WHERE purl = ?`), arg); err != nil {
+			return nil, fmt.Errorf("deleting package: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing: %w", err)
+	}
+	return paths, nil
+}
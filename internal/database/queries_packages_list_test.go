@@ -173,3 +173,87 @@ func TestListCachedPackages(t *testing.T) {
 		}
 	})
 }
+
+func TestListCachedPackagesStablePagination(t *testing.T) {
+	db, err := Create(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	// Every package ties on hits, size and fetch time, and two share a name.
+	fetchedAt := time.Now().Add(-time.Hour)
+	names := []struct{ ecosystem, name string }{
+		{"npm", "delta"}, {"npm", "alpha"}, {"cargo", "alpha"},
+		{"npm", "charlie"}, {"pypi", "bravo"}, {"npm", "echo"}, {"gem", "foxtrot"},
+	}
+	for _, n := range names {
+		purl := "pkg:" + n.ecosystem + "/" + n.name
+		if err := db.UpsertPackage(&Package{PURL: purl, Ecosystem: n.ecosystem, Name: n.name}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpsertVersion(&Version{PURL: purl + "@1.0.0", PackagePURL: purl}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpsertArtifact(&Artifact{
+			VersionPURL: purl + "@1.0.0",
+			Filename:    n.name + ".tgz",
+			UpstreamURL: "https://example.com/" + n.name + ".tgz",
+			StoragePath: sql.NullString{String: n.ecosystem + "/" + n.name + ".tgz", Valid: true},
+			Size:        sql.NullInt64{Int64: 100, Valid: true},
+			HitCount:    5,
+			FetchedAt:   sql.NullTime{Time: fetchedAt, Valid: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pageThrough := func(sortBy string) []string {
+		t.Helper()
+		var seen []string
+		for offset := 0; ; offset += 2 {
+			page, err := db.ListCachedPackages("", sortBy, 2, offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				return seen
+			}
+			for _, p := range page {
+				seen = append(seen, p.Ecosystem+"/"+p.Name)
+			}
+		}
+	}
+
+	for _, sortBy := range []string{"hits", "name", "size", "cached_at", "ecosystem", "vulns"} {
+		t.Run(sortBy, func(t *testing.T) {
+			first := pageThrough(sortBy)
+			second := pageThrough(sortBy)
+
+			if len(first) != len(names) {
+				t.Fatalf("paged through %d packages, want %d: %v", len(first), len(names), first)
+			}
+			unique := make(map[string]bool)
+			for _, p := range first {
+				if unique[p] {
+					t.Errorf("package %s appeared on more than one page: %v", p, first)
+				}
+				unique[p] = true
+			}
+			for i := range first {
+				if first[i] != second[i] {
+					t.Fatalf("order changed between fetches:\n%v\n%v", first, second)
+				}
+			}
+		})
+	}
+
+	// Ties on hits fall back to purl order.
+	want := []string{"cargo/alpha", "gem/foxtrot", "npm/alpha", "npm/charlie", "npm/delta", "npm/echo", "pypi/bravo"}
+	got := pageThrough("hits")
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("hits order = %v, want %v", got, want)
+		}
+	}
+}
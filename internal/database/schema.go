@@ -1,9 +1,12 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 const (
@@ -71,6 +74,7 @@ CREATE TABLE IF NOT EXISTS artifacts (
 	fetched_at DATETIME,
 	hit_count INTEGER DEFAULT 0,
 	last_accessed_at DATETIME,
+	pinned INTEGER NOT NULL DEFAULT 0,
 	created_at DATETIME,
 	updated_at DATETIME
 );
@@ -110,6 +114,57 @@ CREATE TABLE IF NOT EXISTS metadata_cache (
 );
 CREATE UNIQUE INDEX IF NOT EXISTS idx_metadata_eco_name ON metadata_cache(ecosystem, name);
 
+CREATE TABLE IF NOT EXISTS policy_events (
+	id INTEGER PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	client_ip TEXT NOT NULL DEFAULT '',
+	ecosystem TEXT NOT NULL,
+	name TEXT NOT NULL,
+	version TEXT NOT NULL DEFAULT '',
+	decision TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_policy_events_created_at ON policy_events(created_at);
+
+CREATE TABLE IF NOT EXISTS access_log (
+	id INTEGER PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	team TEXT NOT NULL DEFAULT '',
+	ecosystem TEXT NOT NULL,
+	purl TEXT NOT NULL,
+	bytes INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_access_log_created_at ON access_log(created_at);
+
+CREATE TABLE IF NOT EXISTS npm_packuments (
+	name TEXT NOT NULL PRIMARY KEY,
+	document TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS artifact_hits (
+	id INTEGER PRIMARY KEY,
+	version_purl TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	hit_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_artifact_hits_hit_at ON artifact_hits(hit_at);
+
+CREATE TABLE IF NOT EXISTS artifact_hits_daily (
+	day TEXT NOT NULL,
+	version_purl TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	hits INTEGER NOT NULL,
+	PRIMARY KEY (day, version_purl, filename)
+);
+
+CREATE TABLE IF NOT EXISTS proxy_settings (
+	name TEXT NOT NULL PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
 CREATE TABLE IF NOT EXISTS migrations (
 	name TEXT NOT NULL PRIMARY KEY,
 	applied_at DATETIME NOT NULL
@@ -171,6 +226,7 @@ CREATE TABLE IF NOT EXISTS artifacts (
 	fetched_at TIMESTAMP,
 	hit_count BIGINT DEFAULT 0,
 	last_accessed_at TIMESTAMP,
+	pinned BOOLEAN NOT NULL DEFAULT FALSE,
 	created_at TIMESTAMP,
 	updated_at TIMESTAMP
 );
@@ -210,6 +266,57 @@ CREATE TABLE IF NOT EXISTS metadata_cache (
 );
 CREATE UNIQUE INDEX IF NOT EXISTS idx_metadata_eco_name ON metadata_cache(ecosystem, name);
 
+CREATE TABLE IF NOT EXISTS policy_events (
+	id SERIAL PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	client_ip TEXT NOT NULL DEFAULT '',
+	ecosystem TEXT NOT NULL,
+	name TEXT NOT NULL,
+	version TEXT NOT NULL DEFAULT '',
+	decision TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_policy_events_created_at ON policy_events(created_at);
+
+CREATE TABLE IF NOT EXISTS access_log (
+	id SERIAL PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	team TEXT NOT NULL DEFAULT '',
+	ecosystem TEXT NOT NULL,
+	purl TEXT NOT NULL,
+	bytes BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_access_log_created_at ON access_log(created_at);
+
+CREATE TABLE IF NOT EXISTS npm_packuments (
+	name TEXT NOT NULL PRIMARY KEY,
+	document TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS artifact_hits (
+	id SERIAL PRIMARY KEY,
+	version_purl TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	hit_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_artifact_hits_hit_at ON artifact_hits(hit_at);
+
+CREATE TABLE IF NOT EXISTS artifact_hits_daily (
+	day TEXT NOT NULL,
+	version_purl TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	hits BIGINT NOT NULL,
+	PRIMARY KEY (day, version_purl, filename)
+);
+
+CREATE TABLE IF NOT EXISTS proxy_settings (
+	name TEXT NOT NULL PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
 CREATE TABLE IF NOT EXISTS migrations (
 	name TEXT NOT NULL PRIMARY KEY,
 	applied_at TIMESTAMP NOT NULL
@@ -230,6 +337,7 @@ CREATE TABLE IF NOT EXISTS artifacts (
 	fetched_at DATETIME,
 	hit_count INTEGER DEFAULT 0,
 	last_accessed_at DATETIME,
+	pinned INTEGER NOT NULL DEFAULT 0,
 	created_at DATETIME,
 	updated_at DATETIME
 );
@@ -251,6 +359,7 @@ CREATE TABLE IF NOT EXISTS artifacts (
 	fetched_at TIMESTAMP,
 	hit_count BIGINT DEFAULT 0,
 	last_accessed_at TIMESTAMP,
+	pinned BOOLEAN NOT NULL DEFAULT FALSE,
 	created_at TIMESTAMP,
 	updated_at TIMESTAMP
 );
@@ -275,9 +384,10 @@ func (db *DB) CreateSchema() error {
 		return fmt.Errorf("executing schema: %w", err)
 	}
 
-	query := db.Rebind("INSERT INTO schema_info (version) VALUES (?)")
-	if _, err := db.Exec(query, SchemaVersion); err != nil {
-		return fmt.Errorf("setting schema version: %w", err)
+	// schema_info belongs to git-pkgs. A database created here gets the
+	// base row git-pkgs expects, and the proxy never writes to it again.
+	if _, err := db.Exec("INSERT INTO schema_info (version) SELECT 1 WHERE NOT EXISTS (SELECT 1 FROM schema_info)"); err != nil {
+		return fmt.Errorf("initializing schema_info: %w", err)
 	}
 
 	// Record all migrations as applied since the full schema is already current.
@@ -291,64 +401,94 @@ func (db *DB) CreateSchema() error {
 // EnsureArtifactsTable adds the artifacts table to an existing database
 // (e.g., a git-pkgs database) if it doesn't already exist.
 func (db *DB) EnsureArtifactsTable() error {
-	var schema string
-	if db.dialect == DialectPostgres {
-		schema = schemaArtifactsPostgres
-	} else {
-		schema = schemaArtifactsSQLite
-	}
-
-	if _, err := db.Exec(schema); err != nil {
-		return fmt.Errorf("creating artifacts table: %w", err)
-	}
-
-	return nil
+	return db.schema().ensureArtifactsTable()
 }
 
+// SchemaVersion returns the proxy's schema version: the base schema (1)
+// plus the leading run of migrations recorded as applied. It reads only the
+// migrations table, since schema_info belongs to git-pkgs.
 func (db *DB) SchemaVersion() (int, error) {
-	var version int
-	err := db.Get(&version, "SELECT version FROM schema_info LIMIT 1")
+	applied, err := db.appliedMigrations()
 	if err != nil {
 		return 0, err
 	}
+	if applied == nil {
+		return 0, fmt.Errorf("no migrations table: %w", sql.ErrNoRows)
+	}
+	version := 1
+	for _, m := range migrations {
+		if !applied[m.name] {
+			break
+		}
+		version++
+	}
 	return version, nil
 }
 
 // HasTable checks if a table exists in the database.
 func (db *DB) HasTable(name string) (bool, error) {
+	return db.schema().HasTable(name)
+}
+
+// HasColumn checks if a column exists in a table.
+func (db *DB) HasColumn(table, column string) (bool, error) {
+	return db.schema().HasColumn(table, column)
+}
+
+// schemaTx runs schema changes against either the database or an open
+// transaction, so migration steps can be applied atomically.
+type schemaTx struct {
+	sqlx.Ext
+	dialect Dialect
+}
+
+func (db *DB) schema() *schemaTx {
+	return &schemaTx{Ext: db.DB, dialect: db.dialect}
+}
+
+// HasTable checks if a table exists.
+func (s *schemaTx) HasTable(name string) (bool, error) {
 	var exists bool
 	var query string
 
-	if db.dialect == DialectPostgres {
+	if s.dialect == DialectPostgres {
 		query = "SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = $1)"
 	} else {
 		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type='table' AND name=?)"
 	}
 
-	err := db.Get(&exists, query, name)
+	err := sqlx.Get(s, &exists, query, name)
 	return exists, err
 }
 
 // HasColumn checks if a column exists in a table.
-func (db *DB) HasColumn(table, column string) (bool, error) {
+func (s *schemaTx) HasColumn(table, column string) (bool, error) {
 	var exists bool
 	var query string
 
-	if db.dialect == DialectPostgres {
+	if s.dialect == DialectPostgres {
 		query = "SELECT EXISTS (SELECT FROM information_schema.columns WHERE table_name = $1 AND column_name = $2)"
 	} else {
 		// For SQLite, check table_info
 		query = "SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?"
 	}
 
-	err := db.Get(&exists, query, table, column)
+	err := sqlx.Get(s, &exists, query, table, column)
 	return exists, err
 }
 
-// migration represents a named schema migration.
+// migration represents a named schema migration. Version 1 is the base
+// schema; each entry in migrations moves the database to the next version,
+// so the migration at index i produces version i+2.
 type migration struct {
 	name string
-	fn   func(db *DB) error
+	fn   func(s *schemaTx) error
+}
+
+// migrationVersion returns the schema version reached once the migration
+// at index i has been applied.
+func migrationVersion(i int) int {
+	return i + 2 //nolint:mnd // base schema is version 1
 }
 
 // migrations is the ordered list of all schema migrations. See
@@ -359,6 +499,12 @@ var migrations = []migration{
 	{"003_ensure_artifacts_table", migrateEnsureArtifactsTable},
 	{"004_ensure_vulnerabilities_table", migrateEnsureVulnerabilitiesTable},
 	{"005_ensure_metadata_cache_table", migrateEnsureMetadataCacheTable},
+	{"006_ensure_policy_events_table", migrateEnsurePolicyEventsTable},
+	{"007_add_artifacts_pinned_column", migrateAddArtifactsPinnedColumn},
+	{"008_ensure_access_log_table", migrateEnsureAccessLogTable},
+	{"009_ensure_npm_packuments_table", migrateEnsureNPMPackumentsTable},
+	{"010_ensure_artifact_hits_tables", migrateEnsureArtifactHitsTables},
+	{"011_ensure_proxy_settings_table", migrateEnsureProxySettingsTable},
 }
 
 // isTableNotFound returns true if the error indicates a missing table.
@@ -410,9 +556,9 @@ func (db *DB) appliedMigrations() (map[string]bool, error) {
 }
 
 // recordMigration inserts a migration name into the migrations table.
-func (db *DB) recordMigration(name string) error {
-	query := db.Rebind("INSERT INTO migrations (name, applied_at) VALUES (?, ?)")
-	if _, err := db.Exec(query, name, time.Now().UTC()); err != nil {
+func recordMigration(e sqlx.Ext, name string) error {
+	query := e.Rebind("INSERT INTO migrations (name, applied_at) VALUES (?, ?)")
+	if _, err := e.Exec(query, name, time.Now().UTC()); err != nil {
 		return fmt.Errorf("recording migration %s: %w", name, err)
 	}
 	return nil
@@ -421,16 +567,42 @@ func (db *DB) recordMigration(name string) error {
 // recordAllMigrations marks every known migration as applied.
 func (db *DB) recordAllMigrations() error {
 	for _, m := range migrations {
-		if err := db.recordMigration(m.name); err != nil {
+		if err := recordMigration(db.DB, m.name); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// MigrateSchema applies any unapplied migrations in order.
-// For a fully migrated database this executes a single SELECT query.
+// PendingMigrations returns the names of migrations that have not been
+// applied yet, in the order MigrateSchema would run them.
+func (db *DB) PendingMigrations() ([]string, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, m := range migrations {
+		if !applied[m.name] {
+			pending = append(pending, m.name)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateSchema applies any unapplied migrations in order, bringing the
+// database to SchemaVersion. For a fully migrated database this executes a
+// single SELECT query.
 func (db *DB) MigrateSchema() error {
+	return db.migrateTo(SchemaVersion)
+}
+
+// migrateTo applies unapplied migrations up to and including the one that
+// produces version target. Only the migrations table records what has run;
+// schema_info belongs to git-pkgs and is never written. Each step runs in a
+// transaction together with its migrations row, so a failed step leaves
+// both untouched.
+func (db *DB) migrateTo(target int) error {
 	applied, err := db.appliedMigrations()
 	if err != nil {
 		return err
@@ -444,14 +616,14 @@ func (db *DB) MigrateSchema() error {
 		applied = make(map[string]bool)
 	}
 
-	for _, m := range migrations {
+	for i, m := range migrations {
+		if migrationVersion(i) > target {
+			break
+		}
 		if applied[m.name] {
 			continue
 		}
-		if err := m.fn(db); err != nil {
-			return fmt.Errorf("migration %s: %w", m.name, err)
-		}
-		if err := db.recordMigration(m.name); err != nil {
+		if err := db.applyMigration(m); err != nil {
 			return err
 		}
 	}
@@ -459,7 +631,28 @@ func (db *DB) MigrateSchema() error {
 	return nil
 }
 
-func migrateAddPackagesEnrichmentColumns(db *DB) error {
+// applyMigration runs one migration step and records it in a single
+// transaction.
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("migration %s: beginning transaction: %w", m.name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := m.fn(&schemaTx{Ext: tx, dialect: db.dialect}); err != nil {
+		return fmt.Errorf("migration %s: %w", m.name, err)
+	}
+	if err := recordMigration(tx, m.name); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %s: committing: %w", m.name, err)
+	}
+	return nil
+}
+
+func migrateAddPackagesEnrichmentColumns(s *schemaTx) error {
 	columns := map[string]string{
 		"registry_url":    colTypeText,
 		"supplier_name":   colTypeText,
@@ -469,19 +662,19 @@ func migrateAddPackagesEnrichmentColumns(db *DB) error {
 		"vulns_synced_at": sqliteDatetime,
 	}
 
-	if db.dialect == DialectPostgres {
+	if s.dialect == DialectPostgres {
 		columns["enriched_at"] = postgresTimestamp
 		columns["vulns_synced_at"] = postgresTimestamp
 	}
 
 	for column, colType := range columns {
-		hasCol, err := db.HasColumn("packages", column)
+		hasCol, err := s.HasColumn("packages", column)
 		if err != nil {
 			return fmt.Errorf("checking column %s: %w", column, err)
 		}
 		if !hasCol {
 			alterQuery := fmt.Sprintf("ALTER TABLE packages ADD COLUMN %s %s", column, colType)
-			if _, err := db.Exec(alterQuery); err != nil {
+			if _, err := s.Exec(alterQuery); err != nil {
 				return fmt.Errorf("adding column %s to packages: %w", column, err)
 			}
 		}
@@ -489,7 +682,7 @@ func migrateAddPackagesEnrichmentColumns(db *DB) error {
 	return nil
 }
 
-func migrateAddVersionsEnrichmentColumns(db *DB) error {
+func migrateAddVersionsEnrichmentColumns(s *schemaTx) error {
 	columns := map[string]string{
 		"integrity":   colTypeText,
 		"yanked":      "INTEGER DEFAULT 0",
@@ -497,19 +690,19 @@ func migrateAddVersionsEnrichmentColumns(db *DB) error {
 		"enriched_at": sqliteDatetime,
 	}
 
-	if db.dialect == DialectPostgres {
+	if s.dialect == DialectPostgres {
 		columns["yanked"] = "BOOLEAN DEFAULT FALSE"
 		columns["enriched_at"] = postgresTimestamp
 	}
 
 	for column, colType := range columns {
-		hasCol, err := db.HasColumn("versions", column)
+		hasCol, err := s.HasColumn("versions", column)
 		if err != nil {
 			return fmt.Errorf("checking column %s: %w", column, err)
 		}
 		if !hasCol {
 			alterQuery := fmt.Sprintf("ALTER TABLE versions ADD COLUMN %s %s", column, colType)
-			if _, err := db.Exec(alterQuery); err != nil {
+			if _, err := s.Exec(alterQuery); err != nil {
 				return fmt.Errorf("adding column %s to versions: %w", column, err)
 			}
 		}
@@ -517,12 +710,45 @@ func migrateAddVersionsEnrichmentColumns(db *DB) error {
 	return nil
 }
 
-func migrateEnsureArtifactsTable(db *DB) error {
-	return db.EnsureArtifactsTable()
+func migrateAddArtifactsPinnedColumn(s *schemaTx) error {
+	hasCol, err := s.HasColumn("artifacts", "pinned")
+	if err != nil {
+		return fmt.Errorf("checking column pinned: %w", err)
+	}
+	if hasCol {
+		return nil
+	}
+	colType := "INTEGER NOT NULL DEFAULT 0"
+	if s.dialect == DialectPostgres {
+		colType = "BOOLEAN NOT NULL DEFAULT FALSE"
+	}
+	if _, err := s.Exec("ALTER TABLE artifacts ADD COLUMN pinned " + colType); err != nil {
+		return fmt.Errorf("adding column pinned to artifacts: %w", err)
+	}
+	return nil
+}
+
+func migrateEnsureArtifactsTable(s *schemaTx) error {
+	return s.ensureArtifactsTable()
 }
 
-func migrateEnsureVulnerabilitiesTable(db *DB) error {
-	hasVulns, err := db.HasTable("vulnerabilities")
+func (s *schemaTx) ensureArtifactsTable() error {
+	var schema string
+	if s.dialect == DialectPostgres {
+		schema = schemaArtifactsPostgres
+	} else {
+		schema = schemaArtifactsSQLite
+	}
+
+	if _, err := s.Exec(schema); err != nil {
+		return fmt.Errorf("creating artifacts table: %w", err)
+	}
+
+	return nil
+}
+
+func migrateEnsureVulnerabilitiesTable(s *schemaTx) error {
+	hasVulns, err := s.HasTable("vulnerabilities")
 	if err != nil {
 		return fmt.Errorf("checking vulnerabilities table: %w", err)
 	}
@@ -531,7 +757,7 @@ func migrateEnsureVulnerabilitiesTable(db *DB) error {
 	}
 
 	var vulnSchema string
-	if db.dialect == DialectPostgres {
+	if s.dialect == DialectPostgres {
 		vulnSchema = `
 			CREATE TABLE vulnerabilities (
 				id SERIAL PRIMARY KEY,
@@ -570,20 +796,24 @@ func migrateEnsureVulnerabilitiesTable(db *DB) error {
 			CREATE INDEX IF NOT EXISTS idx_vulns_ecosystem_pkg ON vulnerabilities(ecosystem, package_name);
 		`
 	}
-	if _, err := db.Exec(vulnSchema); err != nil {
+	if _, err := s.Exec(vulnSchema); err != nil {
 		return fmt.Errorf("creating vulnerabilities table: %w", err)
 	}
 
 	return nil
 }
 
-func migrateEnsureMetadataCacheTable(db *DB) error {
-	return db.EnsureMetadataCacheTable()
+func migrateEnsureMetadataCacheTable(s *schemaTx) error {
+	return s.ensureMetadataCacheTable()
 }
 
 // EnsureMetadataCacheTable creates the metadata_cache table if it doesn't exist.
 func (db *DB) EnsureMetadataCacheTable() error {
-	has, err := db.HasTable("metadata_cache")
+	return db.schema().ensureMetadataCacheTable()
+}
+
+func (s *schemaTx) ensureMetadataCacheTable() error {
+	has, err := s.HasTable("metadata_cache")
 	if err != nil {
 		return fmt.Errorf("checking metadata_cache table: %w", err)
 	}
@@ -592,7 +822,7 @@ func (db *DB) EnsureMetadataCacheTable() error {
 	}
 
 	var schema string
-	if db.dialect == DialectPostgres {
+	if s.dialect == DialectPostgres {
 		schema = `
 			CREATE TABLE metadata_cache (
 				id SERIAL PRIMARY KEY,
@@ -627,8 +857,165 @@ func (db *DB) EnsureMetadataCacheTable() error {
 			CREATE UNIQUE INDEX IF NOT EXISTS idx_metadata_eco_name ON metadata_cache(ecosystem, name);
 		`
 	}
-	if _, err := db.Exec(schema); err != nil {
+	if _, err := s.Exec(schema); err != nil {
 		return fmt.Errorf("creating metadata_cache table: %w", err)
 	}
 	return nil
 }
+
+func migrateEnsurePolicyEventsTable(s *schemaTx) error {
+	return s.ensurePolicyEventsTable()
+}
+
+// EnsurePolicyEventsTable creates the policy_events table if it doesn't exist.
+func (db *DB) EnsurePolicyEventsTable() error {
+	return db.schema().ensurePolicyEventsTable()
+}
+
+func (s *schemaTx) ensurePolicyEventsTable() error {
+	has, err := s.HasTable("policy_events")
+	if err != nil {
+		return fmt.Errorf("checking policy_events table: %w", err)
+	}
+	if has {
+		return nil
+	}
+
+	idCol, ts := "INTEGER PRIMARY KEY", sqliteDatetime
+	if s.dialect == DialectPostgres {
+		idCol, ts = "SERIAL PRIMARY KEY", postgresTimestamp
+	}
+
+	schema := fmt.Sprintf(`
+		CREATE TABLE policy_events (
+			id %s,
+			created_at %s NOT NULL,
+			client_ip TEXT NOT NULL DEFAULT '',
+			ecosystem TEXT NOT NULL,
+			name TEXT NOT NULL,
+			version TEXT NOT NULL DEFAULT '',
+			decision TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_policy_events_created_at ON policy_events(created_at);
+	`, idCol, ts)
+	if _, err := s.Exec(schema); err != nil {
+		return fmt.Errorf("creating policy_events table: %w", err)
+	}
+	return nil
+}
+
+func migrateEnsureAccessLogTable(s *schemaTx) error {
+	has, err := s.HasTable("access_log")
+	if err != nil {
+		return fmt.Errorf("checking access_log table: %w", err)
+	}
+	if has {
+		return nil
+	}
+
+	idCol, ts, bytesCol := "INTEGER PRIMARY KEY", sqliteDatetime, "INTEGER"
+	if s.dialect == DialectPostgres {
+		idCol, ts, bytesCol = "SERIAL PRIMARY KEY", postgresTimestamp, "BIGINT"
+	}
+
+	schema := fmt.Sprintf(`
+		CREATE TABLE access_log (
+			id %s,
+			created_at %s NOT NULL,
+			team TEXT NOT NULL DEFAULT '',
+			ecosystem TEXT NOT NULL,
+			purl TEXT NOT NULL,
+			bytes %s NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_access_log_created_at ON access_log(created_at);
+	`, idCol, ts, bytesCol)
+	if _, err := s.Exec(schema); err != nil {
+		return fmt.Errorf("creating access_log table: %w", err)
+	}
+	return nil
+}
+
+func migrateEnsureNPMPackumentsTable(s *schemaTx) error {
+	has, err := s.HasTable("npm_packuments")
+	if err != nil {
+		return fmt.Errorf("checking npm_packuments table: %w", err)
+	}
+	if has {
+		return nil
+	}
+
+	ts := sqliteDatetime
+	if s.dialect == DialectPostgres {
+		ts = postgresTimestamp
+	}
+
+	schema := fmt.Sprintf(`
+		CREATE TABLE npm_packuments (
+			name TEXT NOT NULL PRIMARY KEY,
+			document TEXT NOT NULL,
+			created_at %s NOT NULL,
+			updated_at %s NOT NULL
+		);
+	`, ts, ts)
+	if _, err := s.Exec(schema); err != nil {
+		return fmt.Errorf("creating npm_packuments table: %w", err)
+	}
+	return nil
+}
+
+func migrateEnsureArtifactHitsTables(s *schemaTx) error {
+	has, err := s.HasTable("artifact_hits")
+	if err != nil {
+		return fmt.Errorf("checking artifact_hits table: %w", err)
+	}
+	if has {
+		return nil
+	}
+
+	idCol, ts, hitsCol := "INTEGER PRIMARY KEY", sqliteDatetime, "INTEGER"
+	if s.dialect == DialectPostgres {
+		idCol, ts, hitsCol = "SERIAL PRIMARY KEY", postgresTimestamp, "BIGINT"
+	}
+
+	schema := fmt.Sprintf(`
+		CREATE TABLE artifact_hits (
+			id %s,
+			version_purl TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			hit_at %s NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_artifact_hits_hit_at ON artifact_hits(hit_at);
+
+		CREATE TABLE IF NOT EXISTS artifact_hits_daily (
+			day TEXT NOT NULL,
+			version_purl TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			hits %s NOT NULL,
+			PRIMARY KEY (day, version_purl, filename)
+		);
+	`, idCol, ts, hitsCol)
+	if _, err := s.Exec(schema); err != nil {
+		return fmt.Errorf("creating artifact_hits tables: %w", err)
+	}
+	return nil
+}
+
+func migrateEnsureProxySettingsTable(s *schemaTx) error {
+	ts := sqliteDatetime
+	if s.dialect == DialectPostgres {
+		ts = postgresTimestamp
+	}
+
+	schema := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS proxy_settings (
+			name TEXT NOT NULL PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at %s NOT NULL
+		);
+	`, ts)
+	if _, err := s.Exec(schema); err != nil {
+		return fmt.Errorf("creating proxy_settings table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetSetting returns the value stored under name in proxy_settings, and
+// whether there was one.
+func (db *DB) GetSetting(name string) (string, bool, error) {
+	var value string
+	err := db.Get(&value, db.Rebind(`SELECT value FROM proxy_settings WHERE name = ?`), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("reading setting %s: %w", name, err)
+	}
+	return value, true, nil
+}
+
+// SetSetting stores value under name in proxy_settings, replacing any
+// previous value.
+func (db *DB) SetSetting(name, value string) error {
+	_, err := db.Exec(db.Rebind(`
+		INSERT INTO proxy_settings (name, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`), name, value, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("writing setting %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package database
+
+import "testing"
+
+func TestSettings(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		if _, ok, err := db.GetSetting("storage_url"); err != nil || ok {
+			t.Fatalf("GetSetting on empty table = ok %v, err %v; want not found", ok, err)
+		}
+
+		for _, value := range []string{"file:///var/cache/a", "file:///var/cache/b"} {
+			if err := db.SetSetting("storage_url", value); err != nil {
+				t.Fatalf("SetSetting: %v", err)
+			}
+			got, ok, err := db.GetSetting("storage_url")
+			if err != nil || !ok || got != value {
+				t.Errorf("GetSetting = %q, %v, %v; want %q", got, ok, err, value)
+			}
+		}
+	})
+}
@@ -2,8 +2,12 @@ package database
 
 import (
 	"database/sql"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/vers"
 )
 
 // Package represents a package in the database.
@@ -53,6 +57,26 @@ func (v *Version) Version() string {
 	return ""
 }
 
+// SortVersionsDescending sorts versions newest first using the version
+// comparison rules for scheme, which is a PURL type such as "npm", "pypi"
+// or "gem". Versions that compare equal keep their existing order.
+func SortVersionsDescending(versions []Version, scheme string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return vers.CompareWithScheme(versions[i].Version(), versions[j].Version(), scheme) > 0
+	})
+}
+
+// purlType returns the type component of a PURL, e.g. "npm" for
+// "pkg:npm/lodash" or "maven" for "pkg:maven/org.apache/commons@1.0".
+// Returns "" when p isn't a valid PURL.
+func purlType(p string) string {
+	parsed, err := purl.Parse(p)
+	if err != nil {
+		return ""
+	}
+	return parsed.Type
+}
+
 // Artifact represents a cached artifact in the database.
 // This table is proxy-specific and not part of git-pkgs.
 type Artifact struct {
@@ -67,10 +91,20 @@ type Artifact struct {
 	FetchedAt      sql.NullTime   `db:"fetched_at" json:"fetched_at,omitempty"`
 	HitCount       int64          `db:"hit_count" json:"hit_count"`
 	LastAccessedAt sql.NullTime   `db:"last_accessed_at" json:"last_accessed_at,omitempty"`
+	Pinned         bool           `db:"pinned" json:"pinned"`
 	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
 	UpdatedAt      time.Time      `db:"updated_at" json:"updated_at"`
 }
 
+// CachedVersion summarizes the stored artifacts of one version.
+// FirstCachedAt is when the earliest of them was first recorded and stays
+// put across re-fetches; LastFetchedAt is the most recent download.
+type CachedVersion struct {
+	VersionPURL   string
+	FirstCachedAt time.Time
+	LastFetchedAt sql.NullTime
+}
+
 // IsCached returns true if the artifact has been fetched and stored locally.
 func (a *Artifact) IsCached() bool {
 	return a.StoragePath.Valid && a.FetchedAt.Valid
@@ -106,3 +140,45 @@ type Vulnerability struct {
 	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
 	UpdatedAt    time.Time       `db:"updated_at" json:"updated_at"`
 }
+
+// PolicyEvent records a request the proxy rejected or altered because of a
+// policy decision, kept as an audit trail for compliance reporting.
+type PolicyEvent struct {
+	ID        int64     `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ClientIP  string    `db:"client_ip" json:"client_ip"`
+	Ecosystem string    `db:"ecosystem" json:"ecosystem"`
+	Name      string    `db:"name" json:"name"`
+	Version   string    `db:"version" json:"version"`
+	Decision  string    `db:"decision" json:"decision"`
+	Reason    string    `db:"reason" json:"reason"`
+}
+
+// AccessLogEntry records one artifact served to a client, attributed to the
+// team that asked for it, for usage reporting and chargeback.
+type AccessLogEntry struct {
+	ID        int64     `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	Team      string    `db:"team" json:"team"`
+	Ecosystem string    `db:"ecosystem" json:"ecosystem"`
+	PURL      string    `db:"purl" json:"purl"`
+	Bytes     int64     `db:"bytes" json:"bytes"`
+}
+
+// TeamUsage totals the access log for one team over a time range. Requests
+// without a team are grouped under the empty team.
+type TeamUsage struct {
+	Team     string `db:"team" json:"team"`
+	Requests int64  `db:"requests" json:"requests"`
+	Bytes    int64  `db:"bytes" json:"bytes"`
+}
+
+// NPMPackument is the packument of an npm package published to the proxy
+// itself rather than fetched from upstream. Document is the JSON served to
+// clients, before tarball URLs are pointed at the requesting host.
+type NPMPackument struct {
+	Name      string    `db:"name" json:"name"`
+	Document  string    `db:"document" json:"document"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,48 @@
+package database
+
+import "strings"
+
+// upsert describes an INSERT ... ON CONFLICT DO UPDATE statement that is
+// written once and bound for the connection's dialect. Both SQLite and
+// Postgres accept the same upsert syntax, and the excluded pseudo-table is
+// case-insensitive in both, so only the placeholders differ.
+type upsert struct {
+	table    string
+	columns  []string
+	conflict []string
+	// update lists the columns overwritten from the incoming row when the
+	// conflict target already exists. Columns left out, such as created_at,
+	// keep their stored value.
+	update []string
+	// set holds extra assignments written as-is after the update columns,
+	// for columns that need more than a plain overwrite.
+	set []string
+}
+
+// SQL renders the statement with ? placeholders.
+func (u upsert) SQL() string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(u.table)
+	b.WriteString(" (")
+	b.WriteString(strings.Join(u.columns, ", "))
+	b.WriteString(") VALUES (")
+	b.WriteString(strings.TrimSuffix(strings.Repeat("?, ", len(u.columns)), ", "))
+	b.WriteString(") ON CONFLICT(")
+	b.WriteString(strings.Join(u.conflict, ", "))
+	b.WriteString(") DO UPDATE SET ")
+
+	assignments := make([]string, 0, len(u.set)+len(u.update))
+	assignments = append(assignments, u.set...)
+	for _, col := range u.update {
+		assignments = append(assignments, col+" = excluded."+col)
+	}
+	b.WriteString(strings.Join(assignments, ", "))
+	return b.String()
+}
+
+// execUpsert runs u with args, which must line up with u.columns.
+func (db *DB) execUpsert(u upsert, args ...any) error {
+	_, err := db.Exec(db.Rebind(u.SQL()), args...)
+	return err
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestUpsertSQL(t *testing.T) {
+	u := upsert{
+		table:    "t",
+		columns:  []string{"a", "b", `"c"`},
+		conflict: []string{"a"},
+		set:      []string{"b = COALESCE(excluded.b, t.b)"},
+		update:   []string{`"c"`},
+	}
+
+	want := `INSERT INTO t (a, b, "c") VALUES (?, ?, ?) ON CONFLICT(a) DO UPDATE SET b = COALESCE(excluded.b, t.b), "c" = excluded."c"`
+	if got := u.SQL(); got != want {
+		t.Errorf("SQL() =\n%s\nwant\n%s", got, want)
+	}
+
+	wantPostgres := `INSERT INTO t (a, b, "c") VALUES ($1, $2, $3) ON CONFLICT(a) DO UPDATE SET b = COALESCE(excluded.b, t.b), "c" = excluded."c"`
+	if got := sqlx.Rebind(sqlx.DOLLAR, u.SQL()); got != wantPostgres {
+		t.Errorf("postgres SQL =\n%s\nwant\n%s", got, wantPostgres)
+	}
+}
+
+func TestUpsertStatementsBindEveryColumn(t *testing.T) {
+	for _, u := range []upsert{packageUpsert, versionUpsert, artifactUpsert, vulnerabilityUpsert, metadataCacheUpsert} {
+		for _, col := range append(append([]string{}, u.conflict...), u.update...) {
+			found := false
+			for _, c := range u.columns {
+				found = found || c == col
+			}
+			if !found {
+				t.Errorf("%s: %s is not an inserted column", u.table, col)
+			}
+		}
+	}
+}
+
+func TestUpsertPackageSupplier(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		pkgPURL := "pkg:npm/%40acme/widgets"
+		if err := db.UpsertPackage(&Package{
+			PURL: pkgPURL, Ecosystem: "npm", Name: "@acme/widgets",
+			SupplierName: sql.NullString{String: "acme", Valid: true},
+			SupplierType: sql.NullString{String: "organization", Valid: true},
+		}); err != nil {
+			t.Fatalf("UpsertPackage failed: %v", err)
+		}
+
+		pkg, err := db.GetPackageByPURL(pkgPURL)
+		if err != nil || pkg == nil {
+			t.Fatalf("GetPackageByPURL = %v, %v", pkg, err)
+		}
+		if pkg.SupplierName.String != "acme" || pkg.SupplierType.String != "organization" {
+			t.Errorf("supplier = %q/%q, want acme/organization", pkg.SupplierName.String, pkg.SupplierType.String)
+		}
+
+		// Caching a download records the package without a supplier; the
+		// enriched one is kept.
+		if err := db.UpsertPackage(&Package{PURL: pkgPURL, Ecosystem: "npm", Name: "@acme/widgets"}); err != nil {
+			t.Fatalf("UpsertPackage (update) failed: %v", err)
+		}
+		pkg, _ = db.GetPackageByPURL(pkgPURL)
+		if pkg.SupplierName.String != "acme" || pkg.SupplierType.String != "organization" {
+			t.Errorf("supplier = %q/%q after upsert without one, want acme/organization kept",
+				pkg.SupplierName.String, pkg.SupplierType.String)
+		}
+	})
+}
+
+func TestArtifactRefetchKeepsFirstCached(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		pkgPURL := "pkg:npm/refetch-test"
+		versionPURL := pkgPURL + "@1.0.0"
+		_ = db.UpsertPackage(&Package{PURL: pkgPURL, Ecosystem: "npm", Name: "refetch-test"})
+		_ = db.UpsertVersion(&Version{PURL: versionPURL, PackagePURL: pkgPURL})
+
+		firstFetch := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+		refetch := time.Now().UTC().Truncate(time.Second)
+		art := &Artifact{
+			VersionPURL: versionPURL, Filename: "refetch-test-1.0.0.tgz",
+			UpstreamURL: "https://example.com/refetch-test-1.0.0.tgz",
+			StoragePath: sql.NullString{String: "npm/refetch-test-1.0.0.tgz", Valid: true},
+			FetchedAt:   sql.NullTime{Time: firstFetch, Valid: true},
+		}
+		if err := db.UpsertArtifact(art); err != nil {
+			t.Fatalf("UpsertArtifact failed: %v", err)
+		}
+		first, _ := db.GetArtifact(versionPURL, art.Filename)
+
+		art.FetchedAt = sql.NullTime{Time: refetch, Valid: true}
+		if err := db.UpsertArtifact(art); err != nil {
+			t.Fatalf("UpsertArtifact (refetch) failed: %v", err)
+		}
+		got, _ := db.GetArtifact(versionPURL, art.Filename)
+		if got == nil {
+			t.Fatal("artifact missing after refetch")
+		}
+		if !got.CreatedAt.Equal(first.CreatedAt) {
+			t.Errorf("created_at changed from %v to %v on refetch", first.CreatedAt, got.CreatedAt)
+		}
+		if !got.FetchedAt.Time.Equal(refetch) {
+			t.Errorf("fetched_at = %v, want %v", got.FetchedAt.Time, refetch)
+		}
+
+		cached, err := db.GetCachedVersions(pkgPURL)
+		if err != nil {
+			t.Fatalf("GetCachedVersions failed: %v", err)
+		}
+		if len(cached) != 1 || cached[0].VersionPURL != versionPURL {
+			t.Fatalf("GetCachedVersions = %+v, want %s", cached, versionPURL)
+		}
+		if !cached[0].FirstCachedAt.Equal(first.CreatedAt) || !cached[0].LastFetchedAt.Time.Equal(refetch) {
+			t.Errorf("cached version = %+v, want first cached %v and last fetched %v",
+				cached[0], first.CreatedAt, refetch)
+		}
+	})
+}
+
+func TestUpsertsUpdateOnConflict(t *testing.T) {
+	runWithBothDatabases(t, func(t *testing.T, db *DB) {
+		pkgPURL := "pkg:npm/upsert-test"
+		if err := db.UpsertPackage(&Package{
+			PURL: pkgPURL, Ecosystem: "npm", Name: "upsert-test",
+			LatestVersion: sql.NullString{String: "1.0.0", Valid: true},
+			License:       sql.NullString{String: "MIT", Valid: true},
+		}); err != nil {
+			t.Fatalf("UpsertPackage failed: %v", err)
+		}
+		first, _ := db.GetPackageByPURL(pkgPURL)
+
+		// A later upsert without a latest version keeps the known one.
+		if err := db.UpsertPackage(&Package{
+			PURL: pkgPURL, Ecosystem: "npm", Name: "upsert-test",
+			License: sql.NullString{String: "ISC", Valid: true},
+		}); err != nil {
+			t.Fatalf("UpsertPackage (update) failed: %v", err)
+		}
+		pkg, err := db.GetPackageByPURL(pkgPURL)
+		if err != nil || pkg == nil {
+			t.Fatalf("GetPackageByPURL = %v, %v", pkg, err)
+		}
+		if pkg.LatestVersion.String != "1.0.0" {
+			t.Errorf("latest_version = %q, want 1.0.0 kept", pkg.LatestVersion.String)
+		}
+		if pkg.License.String != "ISC" {
+			t.Errorf("license = %q, want ISC", pkg.License.String)
+		}
+		if !pkg.CreatedAt.Equal(first.CreatedAt) {
+			t.Errorf("created_at changed from %v to %v", first.CreatedAt, pkg.CreatedAt)
+		}
+
+		versionPURL := pkgPURL + "@1.0.0"
+		_ = db.UpsertVersion(&Version{PURL: versionPURL, PackagePURL: pkgPURL})
+		if err := db.UpsertVersion(&Version{PURL: versionPURL, PackagePURL: pkgPURL, Yanked: true,
+			Integrity: sql.NullString{String: "sha512-abc", Valid: true}}); err != nil {
+			t.Fatalf("UpsertVersion (update) failed: %v", err)
+		}
+		v, _ := db.GetVersionByPURL(versionPURL)
+		if v == nil || !v.Yanked || v.Integrity.String != "sha512-abc" {
+			t.Errorf("version = %+v, want yanked with integrity", v)
+		}
+
+		_ = db.UpsertArtifact(&Artifact{VersionPURL: versionPURL, Filename: "a.tgz", UpstreamURL: "https://example.com/a.tgz"})
+		if err := db.RecordArtifactHit(versionPURL, "a.tgz"); err != nil {
+			t.Fatalf("RecordArtifactHit failed: %v", err)
+		}
+		if err := db.UpsertArtifact(&Artifact{VersionPURL: versionPURL, Filename: "a.tgz",
+			UpstreamURL: "https://mirror.example.com/a.tgz",
+			StoragePath: sql.NullString{String: "npm/a.tgz", Valid: true}}); err != nil {
+			t.Fatalf("UpsertArtifact (update) failed: %v", err)
+		}
+		a, _ := db.GetArtifact(versionPURL, "a.tgz")
+		if a == nil {
+			t.Fatal("artifact missing after upsert")
+		}
+		if a.StoragePath.String != "npm/a.tgz" {
+			t.Errorf("storage_path = %q, want npm/a.tgz", a.StoragePath.String)
+		}
+		if a.HitCount != 1 || a.UpstreamURL != "https://example.com/a.tgz" {
+			t.Errorf("hit_count = %d, upstream_url = %q; want both kept", a.HitCount, a.UpstreamURL)
+		}
+
+		vuln := &Vulnerability{VulnID: "GHSA-upsert", Ecosystem: "npm", PackageName: "upsert-test",
+			References: sql.NullString{String: "[]", Valid: true}}
+		_ = db.UpsertVulnerability(vuln)
+		vuln.References = sql.NullString{String: `["https://example.com"]`, Valid: true}
+		if err := db.UpsertVulnerability(vuln); err != nil {
+			t.Fatalf("UpsertVulnerability (update) failed: %v", err)
+		}
+		vulns, _ := db.GetVulnerabilitiesForPackage("npm", "upsert-test")
+		if len(vulns) != 1 || vulns[0].References.String != `["https://example.com"]` {
+			t.Errorf("vulnerabilities = %+v, want one with updated references", vulns)
+		}
+
+		_ = db.UpsertMetadataCache(&MetadataCacheEntry{Ecosystem: "npm", Name: "upsert-test", StoragePath: "meta/1"})
+		if err := db.UpsertMetadataCache(&MetadataCacheEntry{Ecosystem: "npm", Name: "upsert-test", StoragePath: "meta/2"}); err != nil {
+			t.Fatalf("UpsertMetadataCache (update) failed: %v", err)
+		}
+		entry, _ := db.GetMetadataCache("npm", "upsert-test")
+		if entry == nil || entry.StoragePath != "meta/2" {
+			t.Errorf("metadata cache = %+v, want storage_path meta/2", entry)
+		}
+	})
+}
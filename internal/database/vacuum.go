@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrVacuumNeedsFull is returned by Vacuum when the database isn't in
+// incremental auto_vacuum mode and can only be compacted by a full rebuild.
+var ErrVacuumNeedsFull = errors.New("database needs a full vacuum to enable incremental vacuuming")
+
+// sqliteAutoVacuumIncremental is the auto_vacuum mode in which free pages
+// are kept until PRAGMA incremental_vacuum returns them to the filesystem.
+const sqliteAutoVacuumIncremental = 2
+
+// incrementalVacuumStep is how many free pages one incremental_vacuum call
+// releases. The single SQLite connection is held for the call, so small
+// steps let queued queries run in between.
+const incrementalVacuumStep = 1000
+
+// VacuumResult describes the database file before and after a vacuum.
+type VacuumResult struct {
+	// Full is true when the whole database was rebuilt with VACUUM rather
+	// than trimmed with incremental_vacuum.
+	Full        bool
+	BeforeBytes int64
+	AfterBytes  int64
+	FreePages   int64
+}
+
+// ReclaimedBytes is how much smaller the database file got.
+func (r VacuumResult) ReclaimedBytes() int64 {
+	return r.BeforeBytes - r.AfterBytes
+}
+
+// Vacuum returns free pages left behind by deletes (eviction, pruning) to
+// the filesystem. It does nothing for postgres, which has its own
+// autovacuum.
+//
+// Databases in incremental auto_vacuum mode, which is how new databases are
+// created, are trimmed a step at a time so reads are only held up briefly.
+// Otherwise, or when full is set, the database is rebuilt with VACUUM and
+// switched to incremental mode on the way. A rebuild holds the database for
+// its whole duration, so it is left to callers that can afford that, such as
+// the proxy vacuum command. With full unset, such databases are left alone
+// and ErrVacuumNeedsFull is returned.
+func (db *DB) Vacuum(ctx context.Context, full bool) (VacuumResult, error) {
+	var result VacuumResult
+	if db.dialect == DialectPostgres {
+		return result, nil
+	}
+
+	before, err := db.sqliteSize(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.BeforeBytes = before.bytes()
+	result.FreePages = before.freePages
+
+	var mode int
+	if err := db.GetContext(ctx, &mode, "PRAGMA auto_vacuum"); err != nil {
+		return result, fmt.Errorf("reading auto_vacuum: %w", err)
+	}
+
+	switch {
+	case full || mode != sqliteAutoVacuumIncremental:
+		if !full {
+			return result, ErrVacuumNeedsFull
+		}
+		result.Full = true
+		if _, err := db.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+			return result, fmt.Errorf("setting auto_vacuum: %w", err)
+		}
+		if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+			return result, fmt.Errorf("vacuuming database: %w", err)
+		}
+	default:
+		for free := before.freePages; free > 0; free -= incrementalVacuumStep {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", incrementalVacuumStep)); err != nil {
+				return result, fmt.Errorf("incremental vacuum: %w", err)
+			}
+		}
+	}
+
+	// Fold the WAL back into the main file so the size on disk shrinks now
+	// rather than at the next automatic checkpoint.
+	if _, err := db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return result, fmt.Errorf("checkpointing WAL: %w", err)
+	}
+
+	after, err := db.sqliteSize(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.AfterBytes = after.bytes()
+	return result, nil
+}
+
+type sqlitePages struct {
+	pageSize  int64
+	pageCount int64
+	freePages int64
+}
+
+func (p sqlitePages) bytes() int64 {
+	return p.pageSize * p.pageCount
+}
+
+func (db *DB) sqliteSize(ctx context.Context) (sqlitePages, error) {
+	var p sqlitePages
+	for _, q := range []struct {
+		pragma string
+		dest   *int64
+	}{
+		{"page_size", &p.pageSize},
+		{"page_count", &p.pageCount},
+		{"freelist_count", &p.freePages},
+	} {
+		if err := db.GetContext(ctx, q.dest, "PRAGMA "+q.pragma); err != nil {
+			return p, fmt.Errorf("reading %s: %w", q.pragma, err)
+		}
+	}
+	return p, nil
+}
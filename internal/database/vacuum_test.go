@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fillAndDelete inserts n packages with bulky metadata and deletes them all,
+// leaving free pages behind.
+func fillAndDelete(t *testing.T, db *DB, n int) {
+	t.Helper()
+	filler := strings.Repeat("x", 2000)
+	for i := range n {
+		pkg := &Package{
+			PURL:      fmt.Sprintf("pkg:npm/filler-%d", i),
+			Ecosystem: "npm",
+			Name:      fmt.Sprintf("filler-%d", i),
+		}
+		pkg.Description.String, pkg.Description.Valid = filler, true
+		if err := db.UpsertPackage(pkg); err != nil {
+			t.Fatalf("UpsertPackage: %v", err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM packages WHERE name LIKE 'filler-%'"); err != nil {
+		t.Fatalf("deleting packages: %v", err)
+	}
+}
+
+func TestVacuum_Incremental(t *testing.T) {
+	db, err := Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := db.UpsertPackage(&Package{PURL: "pkg:npm/lodash", Ecosystem: "npm", Name: "lodash"}); err != nil {
+		t.Fatalf("UpsertPackage: %v", err)
+	}
+	fillAndDelete(t, db, 2000)
+
+	result, err := db.Vacuum(t.Context(), false)
+	if err != nil {
+		t.Fatalf("Vacuum failed: %v", err)
+	}
+	if result.Full {
+		t.Error("new database should be vacuumed incrementally")
+	}
+	if result.FreePages == 0 || result.ReclaimedBytes() <= 0 {
+		t.Errorf("nothing reclaimed: %+v", result)
+	}
+
+	pkg, err := db.GetPackageByPURL("pkg:npm/lodash")
+	if err != nil || pkg == nil {
+		t.Fatalf("database not queryable after vacuum: %v", err)
+	}
+	var free int64
+	if err := db.Get(&free, "PRAGMA freelist_count"); err != nil || free != 0 {
+		t.Errorf("freelist_count = %d (%v), want 0", free, err)
+	}
+}
+
+func TestVacuum_LegacyDatabaseNeedsFull(t *testing.T) {
+	db, err := Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	// Databases created before incremental mode have auto_vacuum off.
+	if _, err := db.Exec("PRAGMA auto_vacuum = NONE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("VACUUM"); err != nil {
+		t.Fatal(err)
+	}
+	fillAndDelete(t, db, 500)
+
+	if _, err := db.Vacuum(t.Context(), false); !errors.Is(err, ErrVacuumNeedsFull) {
+		t.Fatalf("err = %v, want ErrVacuumNeedsFull", err)
+	}
+
+	result, err := db.Vacuum(t.Context(), true)
+	if err != nil {
+		t.Fatalf("full Vacuum failed: %v", err)
+	}
+	if !result.Full || result.ReclaimedBytes() <= 0 {
+		t.Errorf("full vacuum result = %+v", result)
+	}
+	if _, err := db.Vacuum(t.Context(), false); err != nil {
+		t.Errorf("incremental vacuum after full rebuild: %v", err)
+	}
+	if n, err := db.GetCachedArtifactCount(); err != nil || n != 0 {
+		t.Errorf("database not queryable after vacuum: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,187 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/config"
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.Storage.URL = "file://" + filepath.Join(dir, "artifacts")
+	cfg.Database.Path = filepath.Join(dir, "proxy.db")
+
+	db, err := database.Create(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+	_ = db.Close()
+
+	return cfg
+}
+
+func findCheck(t *testing.T, r *Report, name string) Check {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %q check in report: %+v", name, r.Checks)
+	return Check{}
+}
+
+func TestRunGoodConfigPasses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	cfg := testConfig(t)
+	report := Run(context.Background(), cfg, Options{
+		Upstreams:  []Upstream{{Ecosystem: "npm", URL: upstream.URL}},
+		HTTPClient: upstream.Client(),
+	})
+
+	if report.Failed() {
+		var buf bytes.Buffer
+		report.Write(&buf)
+		t.Fatalf("expected a passing report, got:\n%s", buf.String())
+	}
+	for _, name := range []string{"config", "database", "storage", "upstream npm"} {
+		if c := findCheck(t, report, name); c.Status != StatusPass {
+			t.Errorf("%s: status = %s (%s), want pass", name, c.Status, c.Detail)
+		}
+	}
+	if c := findCheck(t, report, "database"); !strings.Contains(c.Detail, "schema version") {
+		t.Errorf("database detail should report the schema version, got %q", c.Detail)
+	}
+}
+
+func TestRunBadStorageURLFails(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Storage.URL = "bogus://nowhere"
+
+	report := Run(context.Background(), cfg, Options{SkipUpstreams: true})
+
+	if !report.Failed() {
+		t.Fatal("expected report to fail with a bad storage URL")
+	}
+	c := findCheck(t, report, "storage")
+	if c.Status != StatusFail {
+		t.Fatalf("storage status = %s, want fail", c.Status)
+	}
+	if !strings.Contains(c.Detail, "bogus://nowhere") {
+		t.Errorf("storage detail should name the URL, got %q", c.Detail)
+	}
+	if c.Hint == "" {
+		t.Error("storage failure should include a hint")
+	}
+
+	var buf bytes.Buffer
+	report.Write(&buf)
+	if !strings.Contains(buf.String(), "[FAIL] storage") {
+		t.Errorf("printed report missing storage failure:\n%s", buf.String())
+	}
+}
+
+func TestRunInvalidConfigSkipsRemainingChecks(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Database.Driver = "mysql"
+
+	report := Run(context.Background(), cfg, Options{})
+
+	if !report.Failed() {
+		t.Fatal("expected report to fail with an invalid config")
+	}
+	if c := findCheck(t, report, "config"); !strings.Contains(c.Detail, "database.driver") {
+		t.Errorf("config detail = %q, want it to name database.driver", c.Detail)
+	}
+	if c := findCheck(t, report, "storage"); c.Status != StatusSkip {
+		t.Errorf("storage status = %s, want skip", c.Status)
+	}
+}
+
+func TestRunMissingSQLiteDatabaseWarns(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Database.Path = filepath.Join(t.TempDir(), "missing.db")
+
+	report := Run(context.Background(), cfg, Options{SkipUpstreams: true})
+
+	if report.Failed() {
+		t.Error("a database that doesn't exist yet should not fail the report")
+	}
+	if c := findCheck(t, report, "database"); c.Status != StatusWarn {
+		t.Errorf("database status = %s, want warn", c.Status)
+	}
+}
+
+func TestRunDeprecatedStoragePathWarns(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Storage.URL = ""
+	cfg.Storage.Path = filepath.Join(t.TempDir(), "artifacts") //nolint:staticcheck // testing deprecated field
+
+	report := Run(context.Background(), cfg, Options{SkipUpstreams: true})
+
+	if report.Failed() {
+		t.Error("a deprecated setting should not fail the report")
+	}
+	c := findCheck(t, report, "config")
+	if c.Status != StatusWarn || !strings.Contains(c.Detail, "storage.path") {
+		t.Errorf("config = %s (%s), want warn naming storage.path", c.Status, c.Detail)
+	}
+	if !strings.Contains(c.Hint, "storage.url") {
+		t.Errorf("hint = %q, want it to point at storage.url", c.Hint)
+	}
+	if c := findCheck(t, report, "storage"); c.Status != StatusPass {
+		t.Errorf("storage status = %s (%s), want pass via storage.path", c.Status, c.Detail)
+	}
+}
+
+func TestRunUnreachableUpstreamWarns(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	cfg := testConfig(t)
+	report := Run(context.Background(), cfg, Options{
+		Upstreams:  []Upstream{{Ecosystem: "pypi", URL: upstream.URL}},
+		HTTPClient: upstream.Client(),
+	})
+
+	if report.Failed() {
+		t.Error("an upstream outage should not fail the report")
+	}
+	if c := findCheck(t, report, "upstream pypi"); c.Status != StatusWarn {
+		t.Errorf("upstream status = %s, want warn", c.Status)
+	}
+}
+
+func TestDefaultUpstreamsMatchHandlers(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Upstream.NPM = "https://npm.internal.example.com"
+	cfg.Upstream.Cargo = "https://cargo.internal.example.com"
+	cfg.Upstream.Maven = "https://maven.internal.example.com"
+
+	want := map[string]string{
+		"npm":   "https://registry.npmjs.org",
+		"cargo": "https://index.crates.io/config.json",
+		"maven": "https://maven.internal.example.com",
+	}
+	for _, u := range DefaultUpstreams(cfg) {
+		if url, ok := want[u.Ecosystem]; ok && u.URL != url {
+			t.Errorf("%s upstream = %q, want %q", u.Ecosystem, u.URL, url)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package enrichment
 import (
 	"context"
 	"log/slog"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,13 +26,35 @@ type Service struct {
 	vulnSource vulns.Source
 }
 
+// Option configures a Service.
+type Option func(*Service)
+
+// WithVulnSource sets the vulnerability source. Defaults to OSV.
+func WithVulnSource(src vulns.Source) Option {
+	return func(s *Service) {
+		s.vulnSource = src
+	}
+}
+
+// WithRegistryClient sets the client used for registry lookups. Defaults
+// to registries.DefaultClient().
+func WithRegistryClient(c *registries.Client) Option {
+	return func(s *Service) {
+		s.regClient = c
+	}
+}
+
 // New creates a new enrichment service.
-func New(logger *slog.Logger) *Service {
-	return &Service{
+func New(logger *slog.Logger, opts ...Option) *Service {
+	s := &Service{
 		logger:     logger,
 		regClient:  registries.DefaultClient(),
 		vulnSource: osv.New(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // PackageInfo contains enriched package metadata.
@@ -44,8 +67,19 @@ type PackageInfo struct {
 	Homepage      string
 	Repository    string
 	RegistryURL   string
+	// SupplierName and SupplierType identify who publishes the package:
+	// an "organization" for namespaced packages, otherwise a "person"
+	// taken from the registry's author or maintainer data.
+	SupplierName string
+	SupplierType string
 }
 
+// Supplier types recorded in PackageInfo.SupplierType.
+const (
+	SupplierOrganization = "organization"
+	SupplierPerson       = "person"
+)
+
 // VersionInfo contains enriched version metadata.
 type VersionInfo struct {
 	Number      string
@@ -87,6 +121,7 @@ func (s *Service) EnrichPackage(ctx context.Context, ecosystem, name string) (*P
 		Repository:    pkg.Repository,
 		RegistryURL:   registries.DefaultURL(ecosystem),
 	}
+	info.SupplierName, info.SupplierType = s.supplier(ctx, purlStr, pkg)
 
 	// Normalize license to SPDX format
 	if pkg.Licenses != "" {
@@ -100,6 +135,36 @@ func (s *Service) EnrichPackage(ctx context.Context, ecosystem, name string) (*P
 	return info, nil
 }
 
+// supplier picks the package's supplier from its registry metadata. The
+// namespace (npm scope, Maven groupId) names an organization; failing that,
+// an author or owner recorded by the registry, or the first listed
+// maintainer, names a person. Returns empty strings if none is known.
+func (s *Service) supplier(ctx context.Context, purlStr string, pkg *registries.Package) (string, string) {
+	if ns := strings.TrimPrefix(pkg.Namespace, "@"); ns != "" {
+		return ns, SupplierOrganization
+	}
+	for _, key := range []string{"author", "owner"} {
+		if name, ok := pkg.Metadata[key].(string); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name), SupplierPerson
+		}
+	}
+
+	maintainers, err := registries.FetchMaintainersFromPURL(ctx, purlStr, s.regClient)
+	if err != nil {
+		s.logger.Debug("failed to fetch maintainers", "purl", purlStr, "error", err)
+		return "", ""
+	}
+	for _, m := range maintainers {
+		if m.Name != "" {
+			return m.Name, SupplierPerson
+		}
+		if m.Login != "" {
+			return m.Login, SupplierPerson
+		}
+	}
+	return "", ""
+}
+
 // EnrichVersion fetches metadata for a specific package version.
 func (s *Service) EnrichVersion(ctx context.Context, ecosystem, name, version string) (*VersionInfo, error) {
 	purlStr := purl.MakePURLString(ecosystem, name, version)
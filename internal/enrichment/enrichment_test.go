@@ -1,9 +1,12 @@
 package enrichment
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"testing"
+
+	"github.com/git-pkgs/registries"
 )
 
 func TestNew(t *testing.T) {
@@ -96,3 +99,28 @@ func TestNormalizeLicense(t *testing.T) {
 		}
 	}
 }
+
+func TestSupplier(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := New(logger)
+
+	tests := []struct {
+		name     string
+		pkg      *registries.Package
+		wantName string
+		wantType string
+	}{
+		{"npm scope", &registries.Package{Name: "@babel/core", Namespace: "babel"}, "babel", SupplierOrganization},
+		{"maven group", &registries.Package{Name: "guava", Namespace: "com.google.guava"}, "com.google.guava", SupplierOrganization},
+		{"author", &registries.Package{Name: "ggplot2", Metadata: map[string]any{"author": " Hadley Wickham "}}, "Hadley Wickham", SupplierPerson},
+		{"owner", &registries.Package{Name: "vibe-d", Metadata: map[string]any{"owner": "sludwig"}}, "sludwig", SupplierPerson},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, typ := svc.supplier(context.Background(), "pkg:generic/"+tt.pkg.Name, tt.pkg)
+			if name != tt.wantName || typ != tt.wantType {
+				t.Errorf("supplier = %q/%q, want %q/%q", name, typ, tt.wantName, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/vulns"
+	"github.com/git-pkgs/vulns/ghsa"
+	"github.com/git-pkgs/vulns/osv"
+)
+
+// Vulnerability source names accepted by NewVulnSource.
+const (
+	VulnSourceOSV  = "osv"
+	VulnSourceGHSA = "ghsa"
+)
+
+// NewVulnSource builds a vulnerability source from a list of source names.
+// A single name returns that source directly; several are merged so each
+// query fans out to all of them and advisories are deduplicated by ID.
+// ghsaToken is passed to the GitHub Advisory source and may be empty.
+func NewVulnSource(names []string, ghsaToken string, logger *slog.Logger) (vulns.Source, error) { //nolint:ireturn // returns a single or composite source
+	var sources []vulns.Source
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case VulnSourceOSV:
+			sources = append(sources, osv.New())
+		case VulnSourceGHSA:
+			var opts []ghsa.Option
+			if ghsaToken != "" {
+				opts = append(opts, ghsa.WithToken(ghsaToken))
+			}
+			sources = append(sources, ghsa.New(opts...))
+		default:
+			return nil, fmt.Errorf("unknown vulnerability source %q", name)
+		}
+	}
+
+	switch len(sources) {
+	case 0:
+		return osv.New(), nil
+	case 1:
+		return sources[0], nil
+	default:
+		return newMultiSource(logger, sources...), nil
+	}
+}
+
+// multiSource queries several vulnerability sources and merges the results.
+// A source that fails is logged and skipped; the query only fails when every
+// source does.
+type multiSource struct {
+	sources []vulns.Source
+	logger  *slog.Logger
+}
+
+func newMultiSource(logger *slog.Logger, sources ...vulns.Source) *multiSource {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &multiSource{sources: sources, logger: logger}
+}
+
+func (m *multiSource) Name() string {
+	names := make([]string, len(m.sources))
+	for i, s := range m.sources {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (m *multiSource) Query(ctx context.Context, p *purl.PURL) ([]vulns.Vulnerability, error) {
+	var results [][]vulns.Vulnerability
+	var errs []error
+	for _, s := range m.sources {
+		vs, err := s.Query(ctx, p)
+		if err != nil {
+			m.logger.Warn("vulnerability source query failed", "source", s.Name(), "purl", p.String(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+			continue
+		}
+		results = append(results, vs)
+	}
+	if len(results) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return mergeVulns(results...), nil
+}
+
+func (m *multiSource) QueryBatch(ctx context.Context, purls []*purl.PURL) ([][]vulns.Vulnerability, error) {
+	perSource := make([][][]vulns.Vulnerability, 0, len(m.sources))
+	var errs []error
+	for _, s := range m.sources {
+		res, err := s.QueryBatch(ctx, purls)
+		if err != nil {
+			m.logger.Warn("vulnerability source batch query failed", "source", s.Name(), "count", len(purls), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+			continue
+		}
+		perSource = append(perSource, res)
+	}
+	if len(perSource) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	merged := make([][]vulns.Vulnerability, len(purls))
+	for i := range purls {
+		lists := make([][]vulns.Vulnerability, 0, len(perSource))
+		for _, res := range perSource {
+			if i < len(res) {
+				lists = append(lists, res[i])
+			}
+		}
+		merged[i] = mergeVulns(lists...)
+	}
+	return merged, nil
+}
+
+func (m *multiSource) Get(ctx context.Context, id string) (*vulns.Vulnerability, error) {
+	var errs []error
+	for _, s := range m.sources {
+		v, err := s.Get(ctx, id)
+		if err == nil && v != nil {
+			return v, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, nil
+}
+
+// mergeVulns concatenates vulnerability lists, keeping the first occurrence
+// of each advisory. Two entries are the same advisory when they share an ID
+// or one lists the other's ID as an alias (e.g. OSV reporting GHSA-xxxx
+// under a CVE alias).
+func mergeVulns(lists ...[]vulns.Vulnerability) []vulns.Vulnerability {
+	seen := make(map[string]bool)
+	var out []vulns.Vulnerability
+	for _, list := range lists {
+		for _, v := range list {
+			if seen[v.ID] {
+				continue
+			}
+			dup := false
+			for _, alias := range v.Aliases {
+				if seen[alias] {
+					dup = true
+					break
+				}
+			}
+			seen[v.ID] = true
+			for _, alias := range v.Aliases {
+				seen[alias] = true
+			}
+			if !dup {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
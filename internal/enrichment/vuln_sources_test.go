@@ -0,0 +1,158 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/vulns"
+)
+
+type fakeVulnSource struct {
+	name  string
+	vulns []vulns.Vulnerability
+	err   error
+}
+
+func (f *fakeVulnSource) Name() string { return f.name }
+
+func (f *fakeVulnSource) Query(_ context.Context, _ *purl.PURL) ([]vulns.Vulnerability, error) {
+	return f.vulns, f.err
+}
+
+func (f *fakeVulnSource) QueryBatch(_ context.Context, purls []*purl.PURL) ([][]vulns.Vulnerability, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make([][]vulns.Vulnerability, len(purls))
+	for i := range purls {
+		out[i] = f.vulns
+	}
+	return out, nil
+}
+
+func (f *fakeVulnSource) Get(_ context.Context, id string) (*vulns.Vulnerability, error) {
+	for i := range f.vulns {
+		if f.vulns[i].ID == id {
+			return &f.vulns[i], nil
+		}
+	}
+	return nil, f.err
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func vulnIDs(vs []vulns.Vulnerability) []string {
+	ids := make([]string, len(vs))
+	for i, v := range vs {
+		ids[i] = v.ID
+	}
+	return ids
+}
+
+func TestMultiSourceMergesAndDeduplicates(t *testing.T) {
+	osvSrc := &fakeVulnSource{name: "osv", vulns: []vulns.Vulnerability{
+		{ID: "GHSA-aaaa-bbbb-cccc", Summary: "from osv", Aliases: []string{"CVE-2024-0001"}},
+		{ID: "PYSEC-2024-1"},
+	}}
+	ghsaSrc := &fakeVulnSource{name: "ghsa", vulns: []vulns.Vulnerability{
+		{ID: "GHSA-aaaa-bbbb-cccc", Summary: "from ghsa"},
+		{ID: "GHSA-dddd-eeee-ffff", Aliases: []string{"CVE-2024-0002"}},
+		{ID: "CVE-2024-0001"},
+	}}
+
+	svc := New(discardLogger(), WithVulnSource(newMultiSource(discardLogger(), osvSrc, ghsaSrc)))
+
+	got, err := svc.CheckVulnerabilities(context.Background(), "pypi", "requests", "2.0.0")
+	if err != nil {
+		t.Fatalf("CheckVulnerabilities failed: %v", err)
+	}
+
+	want := []string{"GHSA-aaaa-bbbb-cccc", "PYSEC-2024-1", "GHSA-dddd-eeee-ffff"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d vulns %v, want %v", len(got), got, want)
+	}
+	for i, id := range want {
+		if got[i].ID != id {
+			t.Errorf("vuln[%d] = %s, want %s", i, got[i].ID, id)
+		}
+	}
+	if got[0].Summary != "from osv" {
+		t.Errorf("first source should win for duplicates, got summary %q", got[0].Summary)
+	}
+}
+
+func TestMultiSourceQueryBatch(t *testing.T) {
+	a := &fakeVulnSource{name: "a", vulns: []vulns.Vulnerability{{ID: "X-1"}, {ID: "X-2"}}}
+	b := &fakeVulnSource{name: "b", vulns: []vulns.Vulnerability{{ID: "X-2"}, {ID: "X-3"}}}
+	m := newMultiSource(discardLogger(), a, b)
+
+	purls := []*purl.PURL{purl.MakePURL("npm", "left-pad", "1.0.0"), purl.MakePURL("npm", "lodash", "4.0.0")}
+	res, err := m.QueryBatch(context.Background(), purls)
+	if err != nil {
+		t.Fatalf("QueryBatch failed: %v", err)
+	}
+	if len(res) != len(purls) {
+		t.Fatalf("got %d results, want %d", len(res), len(purls))
+	}
+	for i, vs := range res {
+		ids := vulnIDs(vs)
+		if len(ids) != 3 || ids[0] != "X-1" || ids[1] != "X-2" || ids[2] != "X-3" {
+			t.Errorf("result[%d] = %v, want [X-1 X-2 X-3]", i, ids)
+		}
+	}
+}
+
+func TestMultiSourceToleratesFailingSource(t *testing.T) {
+	ok := &fakeVulnSource{name: "ok", vulns: []vulns.Vulnerability{{ID: "X-1"}}}
+	broken := &fakeVulnSource{name: "broken", err: errors.New("rate limited")}
+
+	m := newMultiSource(discardLogger(), broken, ok)
+	vs, err := m.Query(context.Background(), purl.MakePURL("npm", "lodash", "4.0.0"))
+	if err != nil {
+		t.Fatalf("Query should succeed when one source works: %v", err)
+	}
+	if ids := vulnIDs(vs); len(ids) != 1 || ids[0] != "X-1" {
+		t.Errorf("got %v, want [X-1]", ids)
+	}
+
+	m = newMultiSource(discardLogger(), broken, broken)
+	if _, err := m.Query(context.Background(), purl.MakePURL("npm", "lodash", "4.0.0")); err == nil {
+		t.Error("Query should fail when every source fails")
+	}
+}
+
+func TestNewVulnSource(t *testing.T) {
+	tests := []struct {
+		names    []string
+		wantName string
+		wantErr  bool
+	}{
+		{nil, "osv", false},
+		{[]string{"osv"}, "osv", false},
+		{[]string{"ghsa"}, "ghsa", false},
+		{[]string{"osv", " GHSA ", "osv"}, "osv+ghsa", false},
+		{[]string{"nvd"}, "", true},
+	}
+
+	for _, tt := range tests {
+		src, err := NewVulnSource(tt.names, "", discardLogger())
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewVulnSource(%v) expected error", tt.names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewVulnSource(%v) failed: %v", tt.names, err)
+		}
+		if src.Name() != tt.wantName {
+			t.Errorf("NewVulnSource(%v).Name() = %q, want %q", tt.names, src.Name(), tt.wantName)
+		}
+	}
+}
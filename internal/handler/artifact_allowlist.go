@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// ErrArtifactNotAllowed is returned for a filename outside its ecosystem's
+// AllowedArtifacts list. It is wrapped in ErrUpstreamNotFound so handlers
+// answer 404, the same as for an artifact that doesn't exist.
+var ErrArtifactNotAllowed = errors.New("artifact type not allowed for ecosystem")
+
+// artifactAllowed reports whether filename may be fetched and served for
+// ecosystem. An entry starting with "." matches filenames ending in it; any
+// other entry is a path.Match glob against the filename's last path
+// element. Matching ignores case.
+func (p *Proxy) artifactAllowed(ecosystem, filename string) bool {
+	patterns, ok := p.AllowedArtifacts[ecosystem]
+	if !ok {
+		return true
+	}
+	name := strings.ToLower(filename)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, ".") {
+			if strings.HasSuffix(name, pattern) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, path.Base(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArtifactAllowed returns an ErrUpstreamNotFound-wrapped
+// ErrArtifactNotAllowed if filename isn't allowed, before anything is
+// looked up or fetched.
+func (p *Proxy) checkArtifactAllowed(ecosystem, filename string) error {
+	if p.artifactAllowed(ecosystem, filename) {
+		return nil
+	}
+	p.Logger.Warn("rejected artifact outside the ecosystem's allowlist",
+		"ecosystem", ecosystem, "filename", filename)
+	return upstreamNotFound(ErrArtifactNotAllowed)
+}
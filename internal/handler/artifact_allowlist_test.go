@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestArtifactAllowed(t *testing.T) {
+	p := &Proxy{AllowedArtifacts: map[string][]string{
+		"npm":   {".tgz"},
+		"maven": {".jar", ".pom", "maven-metadata*.xml"},
+	}}
+
+	tests := []struct {
+		ecosystem, filename string
+		want                bool
+	}{
+		{"npm", "lodash-4.17.21.tgz", true},
+		{"npm", "LODASH-4.17.21.TGZ", true},
+		{"npm", "lodash-4.17.21.exe", false},
+		{"npm", "lodash-4.17.21.tgz.html", false},
+		{"maven", "guava-33.0.0.jar", true},
+		{"maven", "maven-metadata-central.xml", true},
+		{"maven", "guava-33.0.0.zip", false},
+		{"pypi", "anything.bin", true},
+	}
+	for _, tt := range tests {
+		if got := p.artifactAllowed(tt.ecosystem, tt.filename); got != tt.want {
+			t.Errorf("artifactAllowed(%q, %q) = %v, want %v", tt.ecosystem, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadAllowlist(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	proxy.AllowedArtifacts = map[string][]string{"npm": {".tgz"}, "pypi": {".whl", ".tar.gz"}}
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("\x1f\x8btarball"))}
+
+	w := httptest.NewRecorder()
+	NewNPMHandler(proxy, "http://proxy.local").Routes().ServeHTTP(w,
+		httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("npm .tgz status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	fetcher.fetchCalled = false
+	_, err := proxy.GetOrFetchArtifact(t.Context(), "npm", "lodash", "4.17.21", "lodash-4.17.21.zip")
+	if !errors.Is(err, ErrUpstreamNotFound) || !errors.Is(err, ErrArtifactNotAllowed) {
+		t.Errorf("npm .zip err = %v, want ErrUpstreamNotFound wrapping ErrArtifactNotAllowed", err)
+	}
+
+	w = httptest.NewRecorder()
+	NewPyPIHandler(proxy, "http://proxy.local").Routes().ServeHTTP(w,
+		httptest.NewRequest(http.MethodGet, "/packages/packages/ab/cd/ef0123456789/requests-2.31.0.exe", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("pypi .exe status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if fetcher.fetchCalled {
+		t.Error("a rejected artifact should not be fetched")
+	}
+}
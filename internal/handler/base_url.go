@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+type baseURLKey struct{}
+
+// forwardedHostPattern accepts a bare host or host:port, including bracketed
+// IPv6 literals. Anything else is ignored so a request header can't inject
+// markup or a path into rewritten links.
+var forwardedHostPattern = regexp.MustCompile(`^(\[[0-9A-Fa-f:.]+\]|[A-Za-z0-9.-]+)(:[0-9]{1,5})?$`)
+
+// EnableBaseURLDetection makes BaseURLMiddleware derive each request's base
+// URL from the request itself instead of using the configured one. Forwarded
+// headers are only believed from peers in trustedProxies, a list of IP
+// addresses and CIDR ranges; everyone else gets the Host header. It must be
+// called before handlers serve traffic.
+func (p *Proxy) EnableBaseURLDetection(trustedProxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, entry := range trustedProxies {
+		prefix, err := parseTrustedProxy(entry)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	p.detectBaseURL = true
+	p.trustedProxies = prefixes
+	return nil
+}
+
+func parseTrustedProxy(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// BaseURLMiddleware attaches the request's base URL to its context when
+// detection is enabled. Handlers that write links back to the proxy into
+// metadata read it with requestBaseURL. When detection is off the
+// middleware does nothing and handlers use the configured base URL.
+func (p *Proxy) BaseURLMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.detectBaseURL {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if base := p.detectRequestBaseURL(r); base != "" {
+			r = r.WithContext(context.WithValue(r.Context(), baseURLKey{}, base))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// detectRequestBaseURL builds scheme://host for r. X-Forwarded-Proto and
+// X-Forwarded-Host are used when the immediate peer is a trusted proxy;
+// otherwise the scheme follows the connection and the host comes from the
+// Host header. Returns "" if no usable host is found.
+func (p *Proxy) detectRequestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if p.fromTrustedProxy(r) {
+		if proto := strings.ToLower(firstHeaderValue(r, "X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwd := firstHeaderValue(r, "X-Forwarded-Host"); fwd != "" {
+			host = fwd
+		}
+	}
+
+	if !forwardedHostPattern.MatchString(host) {
+		return ""
+	}
+	return scheme + "://" + host
+}
+
+// fromTrustedProxy reports whether r arrived directly from a trusted proxy.
+func (p *Proxy) fromTrustedProxy(r *http.Request) bool {
+	if len(p.trustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header. Each
+// proxy in a chain appends its own value, so the first is the client-facing
+// one.
+func firstHeaderValue(r *http.Request, name string) string {
+	v, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(v)
+}
+
+// RequestBaseURL returns the base URL detected for the request that ctx
+// belongs to, or fallback when detection is off or found nothing usable.
+func RequestBaseURL(ctx context.Context, fallback string) string {
+	if base, ok := ctx.Value(baseURLKey{}).(string); ok {
+		return base
+	}
+	return fallback
+}
+
+// requestBaseURL is RequestBaseURL for a handler's configured proxy URL.
+func requestBaseURL(r *http.Request, fallback string) string {
+	return RequestBaseURL(r.Context(), fallback)
+}
+
+// linkBase holds the configured proxy URL for handlers that rewrite
+// upstream metadata to link back to the proxy. Embedding it lets
+// forRequest swap in the request's base URL.
+type linkBase struct {
+	proxyURL string // URL where this proxy is hosted
+}
+
+func (l *linkBase) links() *linkBase { return l }
+
+// forRequest returns a copy of h that writes links using r's base URL, which
+// differs from the configured one when base URL detection is on.
+func forRequest[H any, P interface {
+	*H
+	links() *linkBase
+}](h P, r *http.Request) P {
+	c := P(new(H))
+	*c = *h
+	c.links().proxyURL = requestBaseURL(r, h.links().proxyURL)
+	return c
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newBaseURLTestProxy(t *testing.T, trusted ...string) *Proxy {
+	t.Helper()
+	p := testProxy()
+	if err := p.EnableBaseURLDetection(trusted); err != nil {
+		t.Fatalf("EnableBaseURLDetection: %v", err)
+	}
+	return p
+}
+
+// detectedBaseURL runs req through the middleware and returns the base URL
+// a handler configured with fallback would see.
+func detectedBaseURL(p *Proxy, req *http.Request, fallback string) string {
+	var got string
+	p.BaseURLMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = requestBaseURL(r, fallback)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestBaseURLDetection(t *testing.T) {
+	p := newBaseURLTestProxy(t, "10.0.0.0/8", "192.0.2.1")
+
+	tests := []struct {
+		name    string
+		remote  string
+		host    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name: "host header", remote: "203.0.113.5:4000", host: "proxy.internal:8080",
+			want: "http://proxy.internal:8080",
+		},
+		{
+			name: "forwarded from trusted range", remote: "10.1.2.3:4000", host: "proxy.internal:8080",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "pkgs.example.com"},
+			want:    "https://pkgs.example.com",
+		},
+		{
+			name: "forwarded from trusted address", remote: "192.0.2.1:4000", host: "proxy.internal",
+			headers: map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "pkgs.example.com, lb.internal"},
+			want:    "https://pkgs.example.com",
+		},
+		{
+			name: "forwarded from untrusted peer", remote: "203.0.113.5:4000", host: "proxy.internal",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.com"},
+			want:    "http://proxy.internal",
+		},
+		{
+			name: "unusable host falls back", remote: "10.1.2.3:4000", host: "proxy.internal",
+			headers: map[string]string{"X-Forwarded-Host": `pkgs.example.com"><script>`},
+			want:    "http://fallback.example",
+		},
+		{
+			name: "unknown proto ignored", remote: "10.1.2.3:4000", host: "proxy.internal",
+			headers: map[string]string{"X-Forwarded-Proto": "gopher"},
+			want:    "http://proxy.internal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/npm/lodash", nil)
+			req.RemoteAddr = tt.remote
+			req.Host = tt.host
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := detectedBaseURL(p, req, "http://fallback.example"); got != tt.want {
+				t.Errorf("base URL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseURLDetection_OffByDefault(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/npm/lodash", nil)
+	req.Host = "other.example"
+	if got := detectedBaseURL(testProxy(), req, "http://configured.example"); got != "http://configured.example" {
+		t.Errorf("base URL = %q, want the configured one", got)
+	}
+}
+
+func TestEnableBaseURLDetection_RejectsInvalidEntries(t *testing.T) {
+	if err := testProxy().EnableBaseURLDetection([]string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid trusted proxy")
+	}
+	if err := testProxy().EnableBaseURLDetection([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestNPMHandler_RewritesWithDetectedBaseURL(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"testpkg","versions":{"1.0.0":{"dist":{"tarball":"https://registry.npmjs.org/testpkg/-/testpkg-1.0.0.tgz"}}}}`))
+	}))
+	defer upstream.Close()
+
+	p := newBaseURLTestProxy(t, "10.0.0.0/8")
+	h := &NPMHandler{proxy: p, upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://localhost:8080"}}
+
+	req := httptest.NewRequest(http.MethodGet, "/testpkg", nil)
+	req.SetPathValue("name", "testpkg")
+	req.RemoteAddr = "10.0.0.7:5000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "pkgs.example.com")
+	w := httptest.NewRecorder()
+	p.BaseURLMiddleware(http.HandlerFunc(h.handlePackageMetadata)).ServeHTTP(w, req)
+
+	var result struct {
+		Versions map[string]struct {
+			Dist struct {
+				Tarball string `json:"tarball"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decoding response: %v: %s", err, w.Body.String())
+	}
+	want := "https://pkgs.example.com/npm/testpkg/-/testpkg-1.0.0.tgz"
+	if got := result.Versions["1.0.0"].Dist.Tarball; got != want {
+		t.Errorf("tarball = %q, want %q", got, want)
+	}
+	if h.proxyURL != "http://localhost:8080" {
+		t.Errorf("handler's configured URL changed to %q", h.proxyURL)
+	}
+}
+
+func TestForRequest(t *testing.T) {
+	h := NewPubHandler(testProxy(), "http://configured.example")
+
+	r := httptest.NewRequest(http.MethodGet, "/api/packages/foo", nil)
+	if got := forRequest(h, r).proxyURL; got != "http://configured.example" {
+		t.Errorf("without a detected base URL, proxyURL = %q, want the configured one", got)
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), baseURLKey{}, "https://detected.example"))
+	c := forRequest(h, r)
+	if c.proxyURL != "https://detected.example" {
+		t.Errorf("proxyURL = %q, want the detected base URL", c.proxyURL)
+	}
+	if c == h || h.proxyURL != "http://configured.example" {
+		t.Error("forRequest changed the shared handler")
+	}
+	if c.proxy != h.proxy || c.upstreamURL != h.upstreamURL {
+		t.Error("forRequest dropped the handler's other fields")
+	}
+}
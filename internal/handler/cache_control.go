@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControlImmutable is sent with artifacts whose bytes can never change
+// for a given URL: versioned tarballs, digest-addressed blobs and the like.
+const cacheControlImmutable = "public, max-age=31536000, immutable"
+
+// immutableMaxAge matches the max-age in cacheControlImmutable.
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// setCacheHeaders sets Cache-Control and a matching Expires for HTTP/1.0
+// caches that ignore Cache-Control.
+func setCacheHeaders(h http.Header, directive string, maxAge time.Duration) {
+	h.Set("Cache-Control", directive)
+	h.Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+}
+
+// CacheDateHeader carries the time a cached response was fetched from
+// upstream, alongside an Age header giving how long ago that was.
+const CacheDateHeader = "X-Proxy-Cache-Date"
+
+// setAgeHeaders sets Age and CacheDateHeader for a response served from
+// cache that was fetched from upstream at fetchedAt. Nothing is set for a
+// zero fetchedAt.
+func setAgeHeaders(h http.Header, fetchedAt time.Time) {
+	if fetchedAt.IsZero() {
+		return
+	}
+	age := max(int64(time.Since(fetchedAt)/time.Second), 0)
+	h.Set("Age", strconv.FormatInt(age, 10))
+	h.Set(CacheDateHeader, fetchedAt.UTC().Format(http.TimeFormat))
+}
+
+// setImmutableCacheHeaders marks a response as cacheable forever.
+func setImmutableCacheHeaders(h http.Header) {
+	setCacheHeaders(h, cacheControlImmutable, immutableMaxAge)
+}
+
+// isImmutable reports whether the artifact identified by ecosystem, version
+// and filename is fixed once published. Registries don't allow a released
+// version to be overwritten, so nearly everything is; the exceptions are
+// Maven snapshots, which are republished under the same version.
+func isImmutable(ecosystem, version, filename string) bool {
+	switch ecosystem {
+	case "maven":
+		if strings.HasSuffix(version, "-SNAPSHOT") || strings.HasPrefix(filename, "maven-metadata") {
+			return false
+		}
+	}
+	return version != ""
+}
+
+// markImmutable records on result whether it may be cached forever.
+func markImmutable(result *CacheResult, ecosystem, version, filename string) {
+	if result != nil {
+		result.Immutable = isImmutable(ecosystem, version, filename)
+	}
+}
+
+// metadataCacheControl is the directive for everything that isn't an
+// immutable artifact. Clients and intermediaries may reuse the response for
+// as long as the proxy itself treats cached metadata as fresh (ttl), then
+// must revalidate.
+func metadataCacheControl(ttl time.Duration) string {
+	return fmt.Sprintf("public, max-age=%d, must-revalidate", int(ttl.Seconds()))
+}
+
+// setMetadataMaxAge replaces the TTL CacheControlMiddleware advertises for
+// this response. Handlers that know which package they serve call it with
+// p.MetadataTTLFor, or their own cache policy's TTL, so a per-package
+// override reaches clients too. It does nothing without the middleware.
+func setMetadataMaxAge(w http.ResponseWriter, ttl time.Duration) {
+	for {
+		switch cw := w.(type) {
+		case *cacheControlWriter:
+			cw.directive = metadataCacheControl(ttl)
+			cw.maxAge = ttl
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = cw.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// CacheControlMiddleware gives successful GET and HEAD responses from the
+// protocol handlers a Cache-Control header. Immutable artifacts set their own
+// directive in ServeArtifact; any other 200 that doesn't already carry one
+// (including those passed through with upstream's header) gets the short
+// metadata directive, with MetadataTTL unless the handler set the package's
+// own TTL with setMetadataMaxAge. Errors and redirects are left uncached.
+func (p *Proxy) CacheControlMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&cacheControlWriter{
+			ResponseWriter: w,
+			directive:      metadataCacheControl(p.MetadataTTL),
+			maxAge:         p.MetadataTTL,
+		}, r)
+	})
+}
+
+// cacheControlWriter fills in a default Cache-Control when the response
+// status is written.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	directive   string
+	maxAge      time.Duration
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if (status == http.StatusOK || status == http.StatusNotModified) && w.Header().Get("Cache-Control") == "" {
+			setCacheHeaders(w.Header(), w.directive, w.maxAge)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom keeps the underlying writer's sendfile path available to
+// copyArtifact.
+func (w *cacheControlWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+func TestCacheControl_NPMTarballImmutable(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "tarball data")
+
+	h := NewNPMHandler(proxy, "http://proxy.local")
+	srv := proxy.CacheControlMiddleware(h.Routes())
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != cacheControlImmutable {
+		t.Errorf("Cache-Control = %q, want %q", got, cacheControlImmutable)
+	}
+	expires, err := http.ParseTime(w.Header().Get("Expires"))
+	if err != nil || time.Until(expires) < 364*24*time.Hour {
+		t.Errorf("Expires = %q, want about a year ahead", w.Header().Get("Expires"))
+	}
+}
+
+func TestCacheControl_NPMPackumentRevalidates(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"testpkg","versions":{}}`))
+	}))
+	defer upstream.Close()
+
+	proxy := testProxy()
+	proxy.MetadataTTL = 5 * time.Minute
+	h := &NPMHandler{proxy: proxy, upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://proxy.local"}}
+	srv := proxy.CacheControlMiddleware(h.Routes())
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/testpkg", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	want := "public, max-age=300, must-revalidate"
+	if got := w.Header().Get("Cache-Control"); got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+	expires, err := http.ParseTime(w.Header().Get("Expires"))
+	if err != nil || time.Until(expires) > 5*time.Minute {
+		t.Errorf("Expires = %q, want within the metadata TTL", w.Header().Get("Expires"))
+	}
+}
+
+func TestCacheControl_PackageTTLOverride(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"` + strings.TrimPrefix(r.URL.Path, "/") + `","versions":{}}`))
+	}))
+	defer upstream.Close()
+
+	proxy := testProxy()
+	proxy.MetadataTTL = 5 * time.Minute
+	proxy.MetadataTTLOverrides = map[string]time.Duration{"npm/fastpkg": 30 * time.Second}
+	h := &NPMHandler{proxy: proxy, upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://proxy.local"}}
+	srv := proxy.CacheControlMiddleware(h.Routes())
+
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{"/fastpkg", "public, max-age=30, must-revalidate"},
+		{"/otherpkg", "public, max-age=300, must-revalidate"},
+	} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want 200", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("GET %s Cache-Control = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCacheControl_ErrorsNotCached(t *testing.T) {
+	proxy := testProxy()
+	srv := proxy.CacheControlMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+	}))
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/anything", nil))
+
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Cache-Control = %q on error response, want none", got)
+	}
+}
+
+func TestIsImmutable(t *testing.T) {
+	tests := []struct {
+		ecosystem, version, filename string
+		want                         bool
+	}{
+		{"npm", "4.17.21", "lodash-4.17.21.tgz", true},
+		{"oci", "sha256:abc", "sha256:abc", true},
+		{"maven", "1.0.0", "lib-1.0.0.jar", true},
+		{"maven", "1.0.0-SNAPSHOT", "lib-1.0.0-20240101.120000-1.jar", false},
+		{"npm", "", "lodash.tgz", false},
+	}
+	for _, tt := range tests {
+		if got := isImmutable(tt.ecosystem, tt.version, tt.filename); got != tt.want {
+			t.Errorf("isImmutable(%q, %q, %q) = %v, want %v", tt.ecosystem, tt.version, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestCachedArtifactAge(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "tarball data")
+
+	art, err := db.GetArtifact("pkg:npm/lodash@4.17.21", "lodash-4.17.21.tgz")
+	if err != nil || art == nil {
+		t.Fatalf("GetArtifact = %v, %v", art, err)
+	}
+	fetchedAt := time.Now().Add(-time.Hour)
+	art.FetchedAt = sql.NullTime{Time: fetchedAt, Valid: true}
+	if err := db.UpsertArtifact(art); err != nil {
+		t.Fatalf("UpsertArtifact: %v", err)
+	}
+
+	h := NewNPMHandler(proxy, "http://proxy.local")
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	age, err := strconv.Atoi(w.Header().Get("Age"))
+	if err != nil || age < 3595 || age > 3605 {
+		t.Errorf("Age = %q, want about 3600", w.Header().Get("Age"))
+	}
+	date, err := http.ParseTime(w.Header().Get(CacheDateHeader))
+	if err != nil || !date.Equal(fetchedAt.Truncate(time.Second)) {
+		t.Errorf("%s = %q, want %s", CacheDateHeader, w.Header().Get(CacheDateHeader), fetchedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+func TestCachedMetadataAge(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+	if err := db.UpsertMetadataCache(&database.MetadataCacheEntry{
+		Ecosystem:   "maven",
+		Name:        "com/example/lib/maven-metadata.xml",
+		StoragePath: "_metadata/maven/com/example/lib/maven-metadata.xml",
+		FetchedAt:   sql.NullTime{Time: time.Now().Add(-10 * time.Minute), Valid: true},
+	}); err != nil {
+		t.Fatalf("UpsertMetadataCache: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/com/example/lib/maven-metadata.xml", nil)
+	proxy.writeMetadataCachedResponse(w, r, "maven", "com/example/lib/maven-metadata.xml", []byte("<metadata/>"), "application/xml")
+
+	age, err := strconv.Atoi(w.Header().Get("Age"))
+	if err != nil || age < 595 || age > 605 {
+		t.Errorf("Age = %q, want about 600", w.Header().Get("Age"))
+	}
+	if w.Header().Get(CacheDateHeader) == "" {
+		t.Errorf("%s not set", CacheDateHeader)
+	}
+}
+
+func TestFreshArtifactHasNoAge(t *testing.T) {
+	w := httptest.NewRecorder()
+	testProxy().ServeArtifact(w, &CacheResult{Reader: io.NopCloser(strings.NewReader("data"))})
+
+	if got := w.Header().Get("Age"); got != "" {
+		t.Errorf("Age = %q on a fresh fetch, want none", got)
+	}
+}
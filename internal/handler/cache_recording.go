@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+)
+
+// cacheUnavailableRetryAfter is the Retry-After hint, in seconds, sent with
+// 503s for downloads that couldn't be recorded in the database.
+const cacheUnavailableRetryAfter = "30"
+
+// ErrCacheUnavailable is returned for a fetched artifact that couldn't be
+// recorded in the database when FailClosedOnDBError is set.
+var ErrCacheUnavailable = errors.New("cache database unavailable")
+
+// recordCacheDB runs updateCacheDB and tracks whether recording is
+// degraded. A failure is logged and, unless FailClosedOnDBError is set,
+// swallowed so the artifact is still served; it just won't be cached.
+func (p *Proxy) recordCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, upstreamURL, storagePath, hash string, size int64, contentType string) error {
+	err := p.updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, upstreamURL, storagePath, hash, size, contentType)
+	p.setCacheRecordingError(err)
+	if err == nil {
+		return nil
+	}
+	p.Logger.Warn("failed to update cache database", "error", err)
+	if p.FailClosedOnDBError {
+		return errors.Join(ErrCacheUnavailable, err)
+	}
+	return nil
+}
+
+func (p *Proxy) setCacheRecordingError(err error) {
+	p.cacheRecordingMu.Lock()
+	defer p.cacheRecordingMu.Unlock()
+	if (err == nil) != (p.cacheRecordingErr == nil) {
+		metrics.SetCacheRecordingDegraded(err != nil)
+	}
+	p.cacheRecordingErr = err
+}
+
+// CacheRecordingError returns the error from the last attempt to record a
+// fetched artifact in the database, or nil if it succeeded. The next
+// successful write clears it.
+func (p *Proxy) CacheRecordingError() error {
+	p.cacheRecordingMu.Lock()
+	defer p.cacheRecordingMu.Unlock()
+	return p.cacheRecordingErr
+}
+
+// writeCacheUnavailableError answers a download that failed closed because
+// the database couldn't record it.
+func writeCacheUnavailableError(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", cacheUnavailableRetryAfter)
+	http.Error(w, "cache database unavailable", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestCacheRecording_DBWriteFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		failClosed bool
+		wantStatus int
+	}{
+		{"serves uncached by default", false, http.StatusOK},
+		{"fails closed", true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, db, _, fetcher := setupTestProxy(t)
+			proxy.FailClosedOnDBError = tt.failClosed
+			fetcher.artifact = &fetch.Artifact{
+				Body:        io.NopCloser(strings.NewReader("tarball")),
+				ContentType: "application/octet-stream",
+			}
+			// Reads still work but recording the artifact fails.
+			if _, err := db.Exec("DROP TABLE artifacts"); err != nil {
+				t.Fatalf("dropping artifacts table: %v", err)
+			}
+
+			h := NewNPMHandler(proxy, "http://proxy.local").Routes()
+			req := httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.failClosed {
+				if w.Header().Get("Retry-After") == "" {
+					t.Error("503 should carry Retry-After")
+				}
+			} else if w.Body.String() != "tarball" {
+				t.Errorf("body = %q, want the fetched artifact", w.Body.String())
+			}
+			if proxy.CacheRecordingError() == nil {
+				t.Error("CacheRecordingError() = nil, want the write failure")
+			}
+		})
+	}
+}
+
+func TestCacheRecording_ClearsOnSuccess(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("tarball")),
+		ContentType: "application/octet-stream",
+	}
+	proxy.setCacheRecordingError(io.ErrUnexpectedEOF)
+
+	result, err := proxy.GetOrFetchArtifact(t.Context(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetOrFetchArtifact() error = %v", err)
+	}
+	_ = result.Reader.Close()
+
+	if err := proxy.CacheRecordingError(); err != nil {
+		t.Errorf("CacheRecordingError() = %v, want nil after a successful write", err)
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CacheRefreshHeader asks, when cache refresh is enabled, for a request
+	// to be served from upstream and the cache updated with the result.
+	CacheRefreshHeader = "X-Proxy-Refresh"
+	// CacheRefreshTokenHeader carries the token a refresh must present, set
+	// by debug.cache_refresh_token.
+	CacheRefreshTokenHeader = "X-Proxy-Refresh-Token"
+)
+
+type cacheRefreshKey struct{}
+
+// EnableCacheRefresh turns on CacheRefreshHeader and Cache-Control: no-cache
+// handling for the given ecosystems, or all of them when ecosystems is
+// empty. Every refresh must present token in CacheRefreshTokenHeader; with
+// an empty token none is honoured.
+func (p *Proxy) EnableCacheRefresh(ecosystems []string, token string) {
+	p.cacheRefreshEnabled = true
+	p.cacheRefreshToken = token
+	p.cacheRefreshEcosystems = nil
+	for _, e := range ecosystems {
+		if p.cacheRefreshEcosystems == nil {
+			p.cacheRefreshEcosystems = make(map[string]bool, len(ecosystems))
+		}
+		p.cacheRefreshEcosystems[strings.ToLower(strings.TrimSpace(e))] = true
+	}
+}
+
+// CacheRefreshMiddleware marks requests asking for a refresh so the cache
+// lookups made while serving them go to upstream instead. An explicit
+// CacheRefreshHeader without a valid token gets a 403. Cache-Control:
+// no-cache without one is served normally, since package managers send it
+// on their own. When refresh is not enabled both headers are ignored.
+func (p *Proxy) CacheRefreshMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		explicit := isTrue(r.Header.Get(CacheRefreshHeader))
+		if !p.cacheRefreshEnabled || (!explicit && !hasNoCache(r.Header)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !p.validRefreshToken(r.Header.Get(CacheRefreshTokenHeader)) {
+			if explicit {
+				p.Logger.Warn("rejected cache refresh", "path", r.URL.Path)
+				http.Error(w, "cache refresh requires a valid "+CacheRefreshTokenHeader, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p.Logger.Info("cache refresh requested", "path", r.URL.Path)
+		ctx := context.WithValue(r.Context(), cacheRefreshKey{}, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (p *Proxy) validRefreshToken(got string) bool {
+	if p.cacheRefreshToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(p.cacheRefreshToken)) == 1
+}
+
+// refreshMarked reports whether CacheRefreshMiddleware marked the request
+// behind ctx, whatever its ecosystem.
+func refreshMarked(ctx context.Context) bool {
+	v, _ := ctx.Value(cacheRefreshKey{}).(bool)
+	return v
+}
+
+// refreshRequested reports whether the request behind ctx asked for a
+// cache refresh and refreshes are allowed for ecosystem.
+func (p *Proxy) refreshRequested(ctx context.Context, ecosystem string) bool {
+	if !refreshMarked(ctx) {
+		return false
+	}
+	return p.cacheRefreshEcosystems == nil || p.cacheRefreshEcosystems[ecosystem]
+}
+
+// lookupCachedArtifact is checkCache, except that a request asking for a
+// refresh is treated as a miss so the artifact is fetched and stored again.
+func (p *Proxy) lookupCachedArtifact(ctx context.Context, ecosystem, pkgPURL, versionPURL, filename string, trace *cacheTrace) (*CacheResult, error) {
+	if p.refreshRequested(ctx, ecosystem) {
+		trace.add("refresh", "requested")
+		return nil, nil
+	}
+	return p.checkCache(ctx, pkgPURL, versionPURL, filename, trace)
+}
+
+func isTrue(v string) bool {
+	return v == "true" || v == "1"
+}
+
+// hasNoCache reports whether h carries a Cache-Control: no-cache directive.
+func hasNoCache(h http.Header) bool {
+	for _, v := range h.Values("Cache-Control") {
+		for directive := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func serveNPMTarball(h http.Handler, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestCacheRefreshRefetchesArtifact(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "stale tarball")
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("fresh tarball"))}
+	proxy.EnableCacheRefresh(nil, "s3cret")
+	h := proxy.CacheRefreshMiddleware(NewNPMHandler(proxy, "http://localhost").Routes())
+
+	w := serveNPMTarball(h, http.Header{CacheRefreshHeader: {"true"}, CacheRefreshTokenHeader: {"s3cret"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !fetcher.fetchCalled || w.Body.String() != "fresh tarball" {
+		t.Fatalf("fetched = %v, body = %q; want a fresh upstream fetch", fetcher.fetchCalled, w.Body.String())
+	}
+
+	// The refreshed artifact replaces the cached one.
+	fetcher.fetchCalled = false
+	w = serveNPMTarball(h, nil)
+	if fetcher.fetchCalled {
+		t.Error("request without the refresh header went upstream")
+	}
+	if w.Body.String() != "fresh tarball" {
+		t.Errorf("body = %q, want the refreshed artifact from cache", w.Body.String())
+	}
+}
+
+func TestCacheRefreshRefetchesMetadata(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"name":"testpkg","versions":{}}`))
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.CacheMetadata = true
+	proxy.MetadataTTL = time.Hour
+	proxy.EnableCacheRefresh([]string{"npm"}, "s3cret")
+	h := proxy.CacheRefreshMiddleware((&NPMHandler{proxy: proxy, upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://proxy.local"}}).Routes())
+
+	get := func(header http.Header) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/testpkg", nil)
+		req.Header = header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+	}
+
+	get(http.Header{})
+	get(http.Header{})
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("upstream hits = %d after a fresh cache entry, want 1", got)
+	}
+	get(http.Header{"Cache-Control": {"no-cache"}})
+	if got := hits.Load(); got != 1 {
+		t.Errorf("upstream hits = %d after Cache-Control: no-cache without a token, want 1", got)
+	}
+	get(http.Header{"Cache-Control": {"no-cache"}, CacheRefreshTokenHeader: {"s3cret"}})
+	if got := hits.Load(); got != 2 {
+		t.Errorf("upstream hits = %d after Cache-Control: no-cache, want 2", got)
+	}
+	get(http.Header{CacheRefreshHeader: {"1"}, CacheRefreshTokenHeader: {"s3cret"}})
+	if got := hits.Load(); got != 3 {
+		t.Errorf("upstream hits = %d after %s, want 3", got, CacheRefreshHeader)
+	}
+}
+
+func TestCacheRefreshToken(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "cached tarball")
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("fresh tarball"))}
+	proxy.EnableCacheRefresh(nil, "s3cret")
+	h := proxy.CacheRefreshMiddleware(NewNPMHandler(proxy, "http://localhost").Routes())
+
+	w := serveNPMTarball(h, http.Header{CacheRefreshHeader: {"true"}, CacheRefreshTokenHeader: {"wrong"}})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("wrong token: status = %d, want 403", w.Code)
+	}
+
+	// Package managers send no-cache on their own; without the token it is
+	// served from cache rather than refused.
+	w = serveNPMTarball(h, http.Header{"Cache-Control": {"no-cache"}})
+	if w.Code != http.StatusOK || fetcher.fetchCalled {
+		t.Errorf("no-cache without token: status = %d, fetched = %v; want 200 from cache", w.Code, fetcher.fetchCalled)
+	}
+
+	w = serveNPMTarball(h, http.Header{CacheRefreshHeader: {"true"}, CacheRefreshTokenHeader: {"s3cret"}})
+	if w.Code != http.StatusOK || !fetcher.fetchCalled {
+		t.Errorf("valid token: status = %d, fetched = %v; want 200 from upstream", w.Code, fetcher.fetchCalled)
+	}
+}
+
+func TestCacheRefreshIgnored(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable func(p *Proxy)
+	}{
+		{"disabled", func(*Proxy) {}},
+		{"other ecosystem", func(p *Proxy) { p.EnableCacheRefresh([]string{"pypi"}, "s3cret") }},
+		{"no token configured", func(p *Proxy) { p.EnableCacheRefresh(nil, "") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, db, store, fetcher := setupTestProxy(t)
+			seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "cached tarball")
+			tt.enable(proxy)
+			h := proxy.CacheRefreshMiddleware(NewNPMHandler(proxy, "http://localhost").Routes())
+
+			w := serveNPMTarball(h, http.Header{"Cache-Control": {"no-cache"}, CacheRefreshTokenHeader: {"s3cret"}})
+			if w.Code != http.StatusOK || fetcher.fetchCalled {
+				t.Errorf("status = %d, fetched = %v; want 200 from cache", w.Code, fetcher.fetchCalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import "strings"
+
+// CacheLookupHeader carries the cache lookup trace when Proxy.CacheTrace is
+// enabled, e.g. "package=found, version=found, artifact=found, blob=missing,
+// result=fetch".
+const CacheLookupHeader = "X-Cache-Lookup"
+
+// cacheTrace records each stage of an artifact cache lookup. A nil trace
+// records nothing, so callers don't need to check whether tracing is on.
+type cacheTrace struct {
+	steps []string
+}
+
+// newCacheTrace returns a trace when CacheTrace is enabled, otherwise nil.
+func (p *Proxy) newCacheTrace() *cacheTrace {
+	if !p.CacheTrace {
+		return nil
+	}
+	return &cacheTrace{}
+}
+
+func (t *cacheTrace) add(stage, outcome string) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, stage+"="+outcome)
+}
+
+// finish records the outcome and attaches the trace to result.
+func (t *cacheTrace) finish(result *CacheResult, outcome string) {
+	if t == nil || result == nil {
+		return
+	}
+	t.add("result", outcome)
+	result.Trace = strings.Join(t.steps, ", ")
+}
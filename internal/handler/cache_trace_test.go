@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestCacheTrace_CleanHit(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	proxy.CacheTrace = true
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "cached content")
+
+	result, err := proxy.GetOrFetchArtifact(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeArtifact(w, result)
+
+	want := "package=found, version=found, artifact=found, blob=present, hit=recorded, result=hit"
+	if got := w.Header().Get(CacheLookupHeader); got != want {
+		t.Errorf("%s = %q, want %q", CacheLookupHeader, got, want)
+	}
+}
+
+func TestCacheTrace_MissingBlobRefetch(t *testing.T) {
+	proxy, db, _, fetcher := setupTestProxy(t)
+	proxy.CacheTrace = true
+
+	pkg := &database.Package{PURL: "pkg:npm/missing", Ecosystem: "npm", Name: "missing"}
+	_ = db.UpsertPackage(pkg)
+	ver := &database.Version{PURL: "pkg:npm/missing@1.0.0", PackagePURL: pkg.PURL}
+	_ = db.UpsertVersion(ver)
+	_ = db.UpsertArtifact(&database.Artifact{
+		VersionPURL: ver.PURL,
+		Filename:    "missing-1.0.0.tgz",
+		UpstreamURL: "https://example.com/missing.tgz",
+		StoragePath: sql.NullString{String: "nonexistent/path.tgz", Valid: true},
+		Size:        sql.NullInt64{Int64: 100, Valid: true},
+		FetchedAt:   sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("refetched content")),
+		ContentType: "application/gzip",
+	}
+
+	result, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "missing", "1.0.0", "missing-1.0.0.tgz", "https://example.com/missing.tgz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeArtifact(w, result)
+
+	want := "package=found, version=found, artifact=found, blob=missing, result=fetch"
+	if got := w.Header().Get(CacheLookupHeader); got != want {
+		t.Errorf("%s = %q, want %q", CacheLookupHeader, got, want)
+	}
+	if w.Body.String() != "refetched content" {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
+
+func TestCacheTrace_DisabledByDefault(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "cached content")
+
+	result, err := proxy.GetOrFetchArtifact(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeArtifact(w, result)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := w.Header().Get(CacheLookupHeader); got != "" {
+		t.Errorf("%s should be absent when tracing is off, got %q", CacheLookupHeader, got)
+	}
+}
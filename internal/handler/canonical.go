@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/git-pkgs/purl"
+)
+
+// pypiSeparators matches the runs of separators PEP 503 folds into one dash.
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// Canonicalize returns the form of name that ecosystem's registry treats as
+// the same package, so every spelling of it maps to one purl, one database
+// row and one storage path. Names in ecosystems without such rules are
+// returned unchanged.
+//
+//   - pypi: PEP 503 normalization, so Flask, flask and FLASK are one package
+//     and zope_interface is zope-interface.
+//   - npm: scoped names are always lower case, and the %2f form clients send
+//     for the scope separator is decoded. Unscoped names keep their case,
+//     since old mixed-case packages are distinct from their lower-case twins.
+//   - golang: case-encoded module paths (github.com/!azure/...) are decoded.
+//     Module paths are otherwise case-sensitive and kept as is.
+//   - composer, nuget: case-insensitive, so lower case.
+func Canonicalize(ecosystem, name string) string {
+	switch purl.NormalizeEcosystem(ecosystem) {
+	case "pypi":
+		return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+	case "npm":
+		if !strings.HasPrefix(name, "@") {
+			return name
+		}
+		name = strings.Replace(name, "%2f", "/", 1)
+		name = strings.Replace(name, "%2F", "/", 1)
+		return strings.ToLower(name)
+	case "golang":
+		if strings.Contains(name, "!") {
+			return decodeGoModule(name)
+		}
+		return name
+	case "composer", "packagist", "nuget":
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// lookupArtifact looks up an artifact under the canonical name and, on a
+// miss, under the spelling the client asked for. Releases before names were
+// canonicalized keyed rows by that spelling; they are served where they are
+// and never rewritten, since the database may be shared with git-pkgs. A
+// miss under both is fetched into the canonical key.
+func (p *Proxy) lookupArtifact(ctx context.Context, ecosystem, requested, name, version, filename string, trace *cacheTrace) (*CacheResult, error) {
+	pkgPURL := purl.MakePURLString(ecosystem, name, "")
+	cached, err := p.lookupCachedArtifact(ctx, ecosystem, pkgPURL, purl.MakePURLString(ecosystem, name, version), filename, trace)
+	if err != nil || cached != nil {
+		return cached, err
+	}
+	legacyPURL := purl.MakePURLString(ecosystem, requested, "")
+	if legacyPURL == pkgPURL {
+		return nil, nil
+	}
+	trace.add("spelling", "legacy")
+	return p.lookupCachedArtifact(ctx, ecosystem, legacyPURL, purl.MakePURLString(ecosystem, requested, version), filename, trace)
+}
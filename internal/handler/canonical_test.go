@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		ecosystem, name, want string
+	}{
+		{"pypi", "Flask", "flask"},
+		{"pypi", "FLASK", "flask"},
+		{"pypi", "zope.interface", "zope-interface"},
+		{"pypi", "Foo__Bar-_.baz", "foo-bar-baz"},
+		{"npm", "@Babel/Core", "@babel/core"},
+		{"npm", "@babel%2fcore", "@babel/core"},
+		{"npm", "@babel%2Fcore", "@babel/core"},
+		{"npm", "JSONStream", "JSONStream"},
+		{"golang", "github.com/!azure/azure-sdk-for-go", "github.com/Azure/azure-sdk-for-go"},
+		{"golang", "github.com/Azure/azure-sdk-for-go", "github.com/Azure/azure-sdk-for-go"},
+		{"go", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml"},
+		{"composer", "Symfony/Console", "symfony/console"},
+		{"nuget", "Newtonsoft.Json", "newtonsoft.json"},
+		{"gem", "Rails", "Rails"},
+		{"cargo", "serde_json", "serde_json"},
+	}
+	for _, tt := range tests {
+		if got := Canonicalize(tt.ecosystem, tt.name); got != tt.want {
+			t.Errorf("Canonicalize(%q, %q) = %q, want %q", tt.ecosystem, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalize_SpellingsShareCacheEntry(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		spellings []string
+		want      string
+	}{
+		{"pypi", []string{"Flask", "flask", "FLASK"}, "flask"},
+		{"npm", []string{"@babel/core", "@Babel/Core", "@babel%2fcore"}, "@babel/core"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ecosystem, func(t *testing.T) {
+			proxy, db, _, fetcher := setupTestProxy(t)
+
+			for i, name := range tt.spellings {
+				fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("data"))}
+				result, err := proxy.GetOrFetchArtifactFromURL(t.Context(), tt.ecosystem, name, "1.0.0",
+					"pkg-1.0.0.tgz", "https://upstream.example/pkg-1.0.0.tgz")
+				if err != nil {
+					t.Fatalf("fetching %q: %v", name, err)
+				}
+				_ = result.Reader.Close()
+				if i > 0 && !result.Cached {
+					t.Errorf("%q missed the cache entry stored for %q", name, tt.spellings[0])
+				}
+			}
+
+			if fetcher.fetchCount != 1 {
+				t.Errorf("upstream fetches = %d, want 1", fetcher.fetchCount)
+			}
+			pkg, err := db.GetPackageByEcosystemName(tt.ecosystem, tt.want)
+			if err != nil || pkg == nil {
+				t.Fatalf("package %q not stored under its canonical name: %v", tt.want, err)
+			}
+			if n, _ := db.GetCachedArtifactCount(); n != 1 {
+				t.Errorf("cached artifacts = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestGetOrFetchArtifact_ServesLegacySpelling(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	// An older release cached Flask under the spelling the client used.
+	seedPackageWithPURL(t, db, store, "pypi", "Flask", "3.0.0", "flask-3.0.0.tar.gz", "legacy")
+
+	result, err := proxy.GetOrFetchArtifactFromURL(t.Context(), "pypi", "Flask", "3.0.0",
+		"flask-3.0.0.tar.gz", "https://upstream.example/flask-3.0.0.tar.gz")
+	if err != nil {
+		t.Fatalf("GetOrFetchArtifactFromURL() error = %v", err)
+	}
+	body, _ := io.ReadAll(result.Reader)
+	_ = result.Reader.Close()
+	if !result.Cached || string(body) != "legacy" {
+		t.Errorf("got cached=%v body=%q, want the row cached under Flask", result.Cached, body)
+	}
+	if fetcher.fetchCalled {
+		t.Error("a legacy cache hit should not fetch from upstream")
+	}
+	if pkg, _ := db.GetPackageByPURL("pkg:pypi/Flask"); pkg == nil {
+		t.Error("legacy row was rewritten")
+	}
+
+	// Another spelling misses the legacy row and is fetched into the
+	// canonical key.
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("fresh"))}
+	result, err = proxy.GetOrFetchArtifactFromURL(t.Context(), "pypi", "FLASK", "3.0.0",
+		"flask-3.0.0.tar.gz", "https://upstream.example/flask-3.0.0.tar.gz")
+	if err != nil {
+		t.Fatalf("GetOrFetchArtifactFromURL() error = %v", err)
+	}
+	_ = result.Reader.Close()
+	if result.Cached {
+		t.Error("FLASK should miss the row cached under Flask")
+	}
+	if pkg, _ := db.GetPackageByPURL("pkg:pypi/flask"); pkg == nil {
+		t.Error("fetch was not stored under the canonical name")
+	}
+}
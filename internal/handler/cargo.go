@@ -54,8 +54,11 @@ func (h *CargoHandler) Routes() http.Handler {
 	mux.HandleFunc("GET /3/{a}/{name}", h.handleIndex)
 	mux.HandleFunc("GET /{a}/{b}/{name}", h.handleIndex)
 
-	// Download endpoint
+	// Download endpoints. The first is the dl template from config.json;
+	// the second is the crates.io web API form, which some tools use
+	// instead. Both serve the same cached .crate file.
 	mux.HandleFunc("GET /crates/{name}/{version}/download", h.handleDownload)
+	mux.HandleFunc("GET /api/v1/crates/{name}/{version}/download", h.handleDownload)
 
 	return mux
 }
@@ -69,13 +72,20 @@ type CargoConfig struct {
 // handleConfig returns the registry configuration.
 func (h *CargoHandler) handleConfig(w http.ResponseWriter, r *http.Request) {
 	config := CargoConfig{
-		DL: h.proxyURL + "/cargo/crates/{crate}/{version}/download",
+		DL: h.crateDownloadURL(r, "{crate}", "{version}"),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(config)
 }
 
+// crateDownloadURL returns the proxy URL a crate version is downloaded
+// from. config.json advertises it as the dl template, with "{crate}" and
+// "{version}" placeholders.
+func (h *CargoHandler) crateDownloadURL(r *http.Request, crate, version string) string {
+	return fmt.Sprintf("%s/cargo/crates/%s/%s/download", requestBaseURL(r, h.proxyURL), crate, version)
+}
+
 // handleIndex proxies the crate index from upstream.
 func (h *CargoHandler) handleIndex(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
@@ -89,7 +99,9 @@ func (h *CargoHandler) handleIndex(w http.ResponseWriter, r *http.Request) {
 	indexPath := h.buildIndexPath(name)
 	upstreamURL := fmt.Sprintf("%s/%s", h.indexURL, indexPath)
 
-	body, contentType, err := h.proxy.FetchOrCacheMetadata(r.Context(), "cargo", name, upstreamURL, "text/plain")
+	policy := h.indexCachePolicy(name)
+	setMetadataMaxAge(w, policy.ttl)
+	body, contentType, err := h.proxy.fetchOrCacheMetadata(r.Context(), "cargo", indexPath, upstreamURL, policy, "text/plain")
 	if err != nil {
 		if errors.Is(err, ErrUpstreamNotFound) {
 			http.Error(w, "not found", http.StatusNotFound)
@@ -109,6 +121,23 @@ func (h *CargoHandler) handleIndex(w http.ResponseWriter, r *http.Request) {
 	h.applyCooldownFiltering(w, body)
 }
 
+// indexCachePolicy returns how a crate's index file is cached. Index files
+// are cached under their sharded path, so "Serde" and "serde" share one
+// entry. With CargoIndexTTL set they are cached for that long and then
+// revalidated with upstream, whether or not metadata caching is enabled in
+// general. A per-package TTL override for the crate still wins.
+func (h *CargoHandler) indexCachePolicy(name string) metadataCachePolicy {
+	crate := strings.ToLower(name)
+	policy := metadataCachePolicy{enabled: h.proxy.CacheMetadata, ttl: h.proxy.MetadataTTLFor("cargo", crate)}
+	if h.proxy.CargoIndexTTL > 0 {
+		policy.enabled = true
+		if _, overridden := h.proxy.MetadataTTLOverrides["cargo/"+crate]; !overridden {
+			policy.ttl = h.proxy.CargoIndexTTL
+		}
+	}
+	return policy
+}
+
 type crateIndexEntry struct {
 	Name        string `json:"name"`
 	Version     string `json:"vers"`
@@ -184,17 +213,26 @@ func (h *CargoHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if version == latestAlias {
+		h.proxy.redirectToLatest(w, r, "cargo", name, func(version string) string {
+			return h.crateDownloadURL(r, name, version)
+		})
+		return
+	}
+
 	filename := fmt.Sprintf("%s-%s.crate", name, version)
 
 	h.proxy.Logger.Info("cargo download request",
 		"crate", name, "version", version, "filename", filename)
 
-	result, err := h.proxy.GetOrFetchArtifact(r.Context(), "cargo", name, version, filename)
+	result, err := h.proxy.GetOrFetchArtifact(expectBinary(r.Context()), "cargo", name, version, filename)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch crate", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch crate", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/git-pkgs/cooldown"
+	"github.com/git-pkgs/registries/fetch"
 )
 
 func cargoTestProxy() *Proxy {
@@ -151,6 +153,51 @@ func TestCargoRoutes(t *testing.T) {
 	}
 }
 
+func TestCargoAPIDownloadPath(t *testing.T) {
+	proxy, db, _, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("\x1f\x8bcrate bytes"))}
+	h := NewCargoHandler(proxy, "http://proxy.local")
+	routes := h.Routes()
+
+	// Tools that use the crates.io web API form get the crate and fill the cache.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/crates/serde/1.0.0/download", nil)
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("API download status = %d, want 200; body: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "\x1f\x8bcrate bytes" {
+		t.Errorf("body = %q", w.Body.String())
+	}
+	if fetcher.fetchedURL != "https://static.crates.io/crates/serde/serde-1.0.0.crate" {
+		t.Errorf("fetched %q", fetcher.fetchedURL)
+	}
+	art, err := db.GetArtifact("pkg:cargo/serde@1.0.0", "serde-1.0.0.crate")
+	if err != nil || art == nil || !art.IsCached() {
+		t.Fatalf("crate not cached after API download: %+v, %v", art, err)
+	}
+
+	// The dl template from config.json serves the same cached file.
+	configReq := httptest.NewRequest(http.MethodGet, "/config.json", nil)
+	configW := httptest.NewRecorder()
+	routes.ServeHTTP(configW, configReq)
+	var config CargoConfig
+	if err := json.Unmarshal(configW.Body.Bytes(), &config); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	dl := strings.NewReplacer("{crate}", "serde", "{version}", "1.0.0").Replace(config.DL)
+	dlPath := strings.TrimPrefix(dl, "http://proxy.local/cargo")
+
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, dlPath, nil))
+	if w.Code != http.StatusOK || w.Body.String() != "\x1f\x8bcrate bytes" {
+		t.Errorf("dl template %s: status %d, body %q", dlPath, w.Code, w.Body.String())
+	}
+	if fetcher.fetchCount != 1 {
+		t.Errorf("upstream fetches = %d, want 1", fetcher.fetchCount)
+	}
+}
+
 type filterTestCase struct {
 	line     string
 	expected bool
@@ -204,3 +251,76 @@ func TestCargoCooldown(t *testing.T) {
 	}
 
 }
+
+func TestCargoIndexCachedWithinTTL(t *testing.T) {
+	const indexContent = `{"name":"serde","vers":"1.0.0","deps":[],"cksum":"abc","features":{},"yanked":false}` + "\n"
+	var hits int
+	var lastIfNoneMatch string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		lastIfNoneMatch = r.Header.Get("If-None-Match")
+		if lastIfNoneMatch == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(indexContent))
+	}))
+	defer upstream.Close()
+
+	proxy, db, _, _ := setupTestProxy(t)
+	proxy.HTTPClient = upstream.Client()
+	proxy.CargoIndexTTL = time.Hour
+	h := &CargoHandler{proxy: proxy, indexURL: upstream.URL, proxyURL: "http://proxy.local"}
+	routes := h.Routes()
+
+	for _, path := range []string{"/se/rd/serde", "/se/rd/SERDE"} {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != indexContent {
+			t.Fatalf("%s: status = %d, body = %q", path, w.Code, w.Body.String())
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("upstream hits = %d, want 1 (second request served from cache)", hits)
+	}
+
+	entry, err := db.GetMetadataCache("cargo", "se/rd/serde")
+	if err != nil || entry == nil {
+		t.Fatalf("expected index cached under its sharded path, got %v, %v", entry, err)
+	}
+
+	// Once the TTL lapses the proxy revalidates with the stored ETag.
+	proxy.CargoIndexTTL = time.Nanosecond
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/se/rd/serde", nil))
+	if w.Code != http.StatusOK || w.Body.String() != indexContent {
+		t.Fatalf("revalidated: status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if hits != 2 || lastIfNoneMatch != `"v1"` {
+		t.Errorf("hits = %d, If-None-Match = %q; want a conditional revalidation", hits, lastIfNoneMatch)
+	}
+}
+
+func TestCargoIndexNotCachedByDefault(t *testing.T) {
+	var hits int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits++
+		_, _ = w.Write([]byte(`{"name":"serde","vers":"1.0.0"}` + "\n"))
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.HTTPClient = upstream.Client()
+	h := &CargoHandler{proxy: proxy, indexURL: upstream.URL, proxyURL: "http://proxy.local"}
+	routes := h.Routes()
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/se/rd/serde", nil))
+	}
+	if hits != 2 {
+		t.Errorf("upstream hits = %d, want 2 without an index TTL", hits)
+	}
+}
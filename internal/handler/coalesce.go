@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// coalescedMetadata is the result shared by coalesced metadata requests.
+type coalescedMetadata struct {
+	body        []byte
+	contentType string
+}
+
+// coalesceMetadata runs fn once for all concurrent callers passing the same
+// key and hands each of them its result, so simultaneous first-time
+// requests for a package page share one upstream fetch and one rewrite. The
+// body is shared between callers and must not be modified.
+//
+// fn runs without the first caller's cancellation, so a client hanging up
+// doesn't fail the others; each caller stops waiting when its own context
+// ends. Requests with an upstream override or asking for a cache refresh
+// are never coalesced.
+func (p *Proxy) coalesceMetadata(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, string, error)) ([]byte, string, error) {
+	if upstreamOverride(ctx) != nil || refreshMarked(ctx) {
+		return fn(ctx)
+	}
+
+	ch := p.metadataFlight.DoChan(key, func() (any, error) {
+		body, contentType, err := fn(context.WithoutCancel(ctx))
+		return coalescedMetadata{body: body, contentType: contentType}, err
+	})
+	select {
+	case res := <-ch:
+		m, _ := res.Val.(coalescedMetadata)
+		return m.body, m.contentType, res.Err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+// metadataFlightKey joins the parts that make a rewritten metadata response
+// unique: the upstream URL, the Accept header sent for it and the base URL
+// links are rewritten to.
+func metadataFlightKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// coalesceMetadataSpool is coalesceMetadata for documents too large to share
+// as a body: concurrent callers passing the same key share one fetch into a
+// spool, and each reads it on its own. Every caller given a spool calls
+// release when done with it; the spool is closed after the last release.
+func (p *Proxy) coalesceMetadataSpool(ctx context.Context, key string, fn func(ctx context.Context) (*metadataSpool, error)) (spool *metadataSpool, release func(), err error) {
+	if upstreamOverride(ctx) != nil || refreshMarked(ctx) {
+		spool, err = fn(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return spool, func() { _ = spool.Close() }, nil
+	}
+	return p.spoolFlight.do(ctx, key, fn)
+}
+
+// spoolFlight runs one fetch per key for coalesceMetadataSpool and counts
+// the callers waiting on or reading each result.
+type spoolFlight struct {
+	mu    sync.Mutex
+	calls map[string]*spoolCall
+}
+
+type spoolCall struct {
+	done    chan struct{}
+	spool   *metadataSpool
+	err     error
+	callers int
+}
+
+func (f *spoolFlight) do(ctx context.Context, key string, fn func(ctx context.Context) (*metadataSpool, error)) (*metadataSpool, func(), error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*spoolCall)
+	}
+	c, ok := f.calls[key]
+	if !ok {
+		c = &spoolCall{done: make(chan struct{})}
+		f.calls[key] = c
+		go func() {
+			c.spool, c.err = fn(context.WithoutCancel(ctx))
+			f.mu.Lock()
+			if f.calls[key] == c {
+				delete(f.calls, key)
+			}
+			f.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.callers++
+	f.mu.Unlock()
+
+	release := func() {
+		f.mu.Lock()
+		c.callers--
+		last := c.callers == 0
+		if last && f.calls[key] == c {
+			delete(f.calls, key)
+		}
+		f.mu.Unlock()
+		if last {
+			go func() {
+				<-c.done
+				if c.spool != nil {
+					_ = c.spool.Close()
+				}
+			}()
+		}
+	}
+
+	select {
+	case <-c.done:
+		if c.err != nil {
+			release()
+			return nil, nil, c.err
+		}
+		return c.spool, release, nil
+	case <-ctx.Done():
+		release()
+		return nil, nil, ctx.Err()
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingUpstream serves body for every request but holds the first one
+// until release is closed, so concurrent requests pile up behind it.
+func blockingUpstream(t *testing.T, contentType, body string) (srv *httptest.Server, hits *atomic.Int32, firstHit <-chan struct{}, release chan struct{}) {
+	t.Helper()
+	hits = &atomic.Int32{}
+	first := make(chan struct{})
+	release = make(chan struct{})
+	var once sync.Once
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		once.Do(func() { close(first) })
+		<-release
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hits, first, release
+}
+
+// serveConcurrently sends n identical requests to h at once and returns the
+// responses once all have finished. The first upstream request is held
+// until the others have had time to join it.
+func serveConcurrently(t *testing.T, h http.Handler, n int, newReq func() *http.Request, firstHit <-chan struct{}, release chan struct{}) []*httptest.ResponseRecorder {
+	t.Helper()
+	recs := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			h.ServeHTTP(w, newReq())
+		}(recs[i])
+	}
+
+	select {
+	case <-firstHit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream was never called")
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return recs
+}
+
+func TestNPMConcurrentMetadataRequestsShareUpstreamFetch(t *testing.T) {
+	upstream, hits, firstHit, release := blockingUpstream(t, "application/json", `{
+		"name": "testpkg",
+		"versions": {"1.0.0": {"dist": {"tarball": "https://registry.npmjs.org/testpkg/-/testpkg-1.0.0.tgz"}}}
+	}`)
+
+	h := &NPMHandler{proxy: testProxy(), upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://proxy.local"}}
+	recs := serveConcurrently(t, h.Routes(), 10, func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/testpkg", nil)
+	}, firstHit, release)
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("upstream requests = %d, want 1", got)
+	}
+	for i, w := range recs {
+		if w.Code != http.StatusOK {
+			t.Fatalf("response %d: status = %d, want 200", i, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "http://proxy.local/npm/testpkg/-/testpkg-1.0.0.tgz") {
+			t.Errorf("response %d not rewritten: %s", i, w.Body.String())
+		}
+	}
+}
+
+func TestPyPIConcurrentSimpleRequestsShareUpstreamFetch(t *testing.T) {
+	upstream, hits, firstHit, release := blockingUpstream(t, "text/html",
+		`<a href="https://files.pythonhosted.org/packages/ab/cd/requests-2.31.0.tar.gz">requests-2.31.0.tar.gz</a>`)
+
+	h := &PyPIHandler{proxy: testProxy(), upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://proxy.local"}}
+	recs := serveConcurrently(t, h.Routes(), 10, func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/simple/requests/", nil)
+	}, firstHit, release)
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("upstream requests = %d, want 1", got)
+	}
+	for i, w := range recs {
+		if w.Code != http.StatusOK {
+			t.Fatalf("response %d: status = %d, want 200", i, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "http://proxy.local/pypi/packages/") {
+			t.Errorf("response %d not rewritten: %s", i, w.Body.String())
+		}
+	}
+}
+
+func TestCoalesceMetadataCallerCancel(t *testing.T) {
+	p := testProxy()
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	done := make(chan error, 1)
+	go func() {
+		body, _, err := p.coalesceMetadata(context.Background(), "key", func(ctx context.Context) ([]byte, string, error) {
+			close(started)
+			<-release
+			return []byte("ok"), "text/plain", ctx.Err()
+		})
+		if err == nil && string(body) != "ok" {
+			err = errors.New("unexpected body " + string(body))
+		}
+		done <- err
+	}()
+	<-started
+
+	// A second caller that gives up doesn't cancel the shared fetch.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := p.coalesceMetadata(ctx, "key", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller err = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("first caller err = %v, want nil", err)
+	}
+}
@@ -24,7 +24,7 @@ type ComposerHandler struct {
 	proxy       *Proxy
 	upstreamURL string
 	repoURL     string
-	proxyURL    string
+	linkBase
 }
 
 // NewComposerHandler creates a new Composer protocol handler.
@@ -33,7 +33,7 @@ func NewComposerHandler(proxy *Proxy, proxyURL string) *ComposerHandler {
 		proxy:       proxy,
 		upstreamURL: composerUpstream,
 		repoURL:     composerRepo,
-		proxyURL:    strings.TrimSuffix(proxyURL, "/"),
+		linkBase:    linkBase{proxyURL: strings.TrimSuffix(proxyURL, "/")},
 	}
 }
 
@@ -60,12 +60,13 @@ func (h *ComposerHandler) Routes() http.Handler {
 // handleServiceIndex returns the Composer repository service index.
 func (h *ComposerHandler) handleServiceIndex(w http.ResponseWriter, r *http.Request) {
 	// Return a minimal service index pointing to our proxy
+	baseURL := requestBaseURL(r, h.proxyURL)
 	index := map[string]any{
 		"packages":           map[string]any{},
-		"metadata-url":       h.proxyURL + "/composer/p2/%package%.json",
+		"metadata-url":       baseURL + "/composer/p2/%package%.json",
 		"notify-batch":       h.upstreamURL + "/downloads/",
-		"search":             h.proxyURL + "/composer/search.json?q=%query%&type=%type%",
-		"providers-lazy-url": h.proxyURL + "/composer/p2/%package%.json",
+		"search":             baseURL + "/composer/search.json?q=%query%&type=%type%",
+		"providers-lazy-url": baseURL + "/composer/p2/%package%.json",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -90,6 +91,7 @@ func (h *ComposerHandler) handlePackageMetadata(w http.ResponseWriter, r *http.R
 
 	upstreamURL := fmt.Sprintf("%s/p2/%s/%s.json", h.repoURL, vendor, pkg)
 
+	setMetadataMaxAge(w, h.proxy.MetadataTTLFor("composer", packageName))
 	body, _, err := h.proxy.FetchOrCacheMetadata(r.Context(), "composer", packageName, upstreamURL)
 	if err != nil {
 		if errors.Is(err, ErrUpstreamNotFound) {
@@ -101,7 +103,7 @@ func (h *ComposerHandler) handlePackageMetadata(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	rewritten, err := h.rewriteMetadata(body)
+	rewritten, err := forRequest(h, r).rewriteMetadata(body)
 	if err != nil {
 		h.proxy.Logger.Warn("failed to rewrite metadata, proxying original", "error", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -273,6 +275,11 @@ func (h *ComposerHandler) rewriteDistURL(vmap map[string]any, packageName, versi
 		return
 	}
 
+	if !h.proxy.IsTrustedUpstream("composer", url) {
+		h.proxy.logUntrustedUpstream("composer", url)
+		return
+	}
+
 	filename := "package.zip"
 	if idx := strings.LastIndex(url, "/"); idx >= 0 {
 		filename = url[idx+1:]
@@ -344,14 +351,23 @@ func (h *ComposerHandler) handleDownload(w http.ResponseWriter, r *http.Request)
 		"package", packageName, "version", version,
 		"download_url", downloadURL)
 
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "composer", packageName, version, filename, downloadURL)
+	if !h.proxy.IsTrustedUpstream("composer", downloadURL) {
+		h.proxy.RecordPolicyEvent(r, "composer", packageName, version, PolicyDecisionDeny,
+			"untrusted upstream host: "+downloadURL)
+		http.Error(w, "upstream host not trusted", http.StatusForbidden)
+		return
+	}
+
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "composer", packageName, version, filename, downloadURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // isDevVersion reports whether a Composer version string refers to a
@@ -483,11 +499,7 @@ func (h *ComposerHandler) proxyUpstream(w http.ResponseWriter, r *http.Request)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	h.proxy.copyUpstreamHeaders(w.Header(), resp.Header)
 
 	w.WriteHeader(resp.StatusCode)
 	_, _ = io.Copy(w, resp.Body)
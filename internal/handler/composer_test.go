@@ -16,7 +16,7 @@ import (
 func TestComposerRewriteMetadata(t *testing.T) {
 	h := &ComposerHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -57,7 +57,7 @@ func TestComposerRewriteMetadata(t *testing.T) {
 func TestComposerRewriteMetadataExpandsMinified(t *testing.T) {
 	h := &ComposerHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	// Minified format: first version has all fields, subsequent versions
@@ -118,7 +118,7 @@ func TestComposerRewriteMetadataExpandsMinified(t *testing.T) {
 func TestComposerRewriteMetadataMinifiedDevReset(t *testing.T) {
 	h := &ComposerHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	// The ~dev sentinel resets the inheritance chain for dev versions.
@@ -183,7 +183,7 @@ func TestComposerRewriteMetadataMinifiedDevReset(t *testing.T) {
 func TestComposerRewriteMetadataUnset(t *testing.T) {
 	h := &ComposerHandler{
 		proxy:    &Proxy{Logger: slog.Default()},
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	// In the minified format, "__unset" removes a field from the inherited
@@ -265,7 +265,7 @@ func TestComposerRewriteMetadataCooldownPreservesNames(t *testing.T) {
 
 	h := &ComposerHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	// Minified format where "name" only appears in first version.
@@ -329,7 +329,7 @@ func TestComposerRewriteDistURLGitHubZipball(t *testing.T) {
 	// archives library can detect the format when browsing source.
 	h := &ComposerHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	vmap := map[string]any{
@@ -358,7 +358,7 @@ func TestComposerRewriteMetadataGitHubZipballFilenames(t *testing.T) {
 	// download URLs that end in .zip so browse source can open them.
 	h := &ComposerHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -403,7 +403,7 @@ func TestComposerExpandMinifiedSharedDistReferences(t *testing.T) {
 	// corrupt the dist URLs via shared map references.
 	h := &ComposerHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	// In this minified payload, v5.3.0 does NOT include a dist field,
@@ -522,7 +522,7 @@ func TestComposerDownloadDevVersionUsesDevMetadata(t *testing.T) {
 	h := &ComposerHandler{
 		proxy:    testProxy(),
 		repoURL:  srv.URL,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	ctx := context.Background()
@@ -572,7 +572,7 @@ func TestComposerRewriteMetadataCooldown(t *testing.T) {
 
 	h := &ComposerHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -84,12 +84,14 @@ func (h *ConanHandler) handleRecipeFile(w http.ResponseWriter, r *http.Request)
 
 	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "conan", packageName, storageVersion, storageFilename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch file", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch file", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handlePackageFile serves a package file, fetching and caching from upstream if needed.
@@ -122,12 +124,14 @@ func (h *ConanHandler) handlePackageFile(w http.ResponseWriter, r *http.Request)
 
 	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "conan", packageName, storageVersion, storageFilename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch file", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch file", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // shouldCacheFile returns true if the file should be cached.
@@ -190,11 +194,7 @@ func (h *ConanHandler) proxyUpstream(w http.ResponseWriter, r *http.Request) {
 	defer func() { _ = resp.Body.Close() }()
 
 	// Copy response headers
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	h.proxy.copyUpstreamHeaders(w.Header(), resp.Header)
 
 	w.WriteHeader(resp.StatusCode)
 	_, _ = io.Copy(w, resp.Body)
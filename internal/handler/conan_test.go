@@ -151,8 +151,10 @@ func TestConanProxyUpstreamCopiesHeaders(t *testing.T) {
 	}))
 	defer upstream.Close()
 
+	proxy := conanTestProxy()
+	proxy.SetForwardedResponseHeaders([]string{"x-custom-header"})
 	h := &ConanHandler{
-		proxy:       conanTestProxy(),
+		proxy:       proxy,
 		upstreamURL: upstream.URL,
 		proxyURL:    "http://proxy.local",
 	}
@@ -161,6 +163,9 @@ func TestConanProxyUpstreamCopiesHeaders(t *testing.T) {
 	w := httptest.NewRecorder()
 	h.proxyUpstream(w, req)
 
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
 	if w.Header().Get("X-Custom-Header") != "test-value" {
 		t.Errorf("X-Custom-Header = %q, want %q", w.Header().Get("X-Custom-Header"), "test-value")
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
@@ -41,7 +42,33 @@ func (h *CondaHandler) Routes() http.Handler {
 	// Package downloads (cache these)
 	mux.HandleFunc("GET /{channel}/{arch}/{filename}", h.handleDownload)
 
-	return mux
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if rest != "" && !strings.Contains(rest, "/") {
+			// {arch}/{filename}: no channel in the path.
+			if h.proxy.CondaDefaultChannel == "" {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			channel = h.proxy.CondaDefaultChannel
+			r = r.Clone(r.Context())
+			r.URL.Path = "/" + channel + r.URL.Path
+			r.URL.RawPath = ""
+		}
+
+		if !h.channelAllowed(channel) {
+			http.Error(w, "channel not allowed", http.StatusNotFound)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// channelAllowed reports whether channel may be proxied under the configured
+// allowlist. An empty allowlist permits every channel.
+func (h *CondaHandler) channelAllowed(channel string) bool {
+	return len(h.proxy.CondaChannels) == 0 || slices.Contains(h.proxy.CondaChannels, channel)
 }
 
 // handleDownload serves a package file, fetching and caching from upstream if needed.
@@ -70,14 +97,16 @@ func (h *CondaHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 
 	upstreamURL := h.upstreamURL + r.URL.Path
 
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "conda", packageName, version, filename, upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "conda", packageName, version, filename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // isPackageFile returns true if the filename is a Conda package.
@@ -149,11 +178,7 @@ func (h *CondaHandler) handleRepodata(w http.ResponseWriter, r *http.Request) {
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		for k, vv := range resp.Header {
-			for _, v := range vv {
-				w.Header().Add(k, v)
-			}
-		}
+		h.proxy.copyUpstreamHeaders(w.Header(), resp.Header)
 		w.WriteHeader(resp.StatusCode)
 		_, _ = io.Copy(w, resp.Body)
 		return
@@ -303,3 +303,56 @@ func TestCondaHandleRepodataWithoutCooldown(t *testing.T) {
 		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
 	}
 }
+
+func TestCondaChannelAllowlist(t *testing.T) {
+	var upstreamPaths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPaths = append(upstreamPaths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"info":{},"packages":{},"packages.conda":{}}`))
+	}))
+	defer upstream.Close()
+
+	proxy := testProxy()
+	proxy.CondaChannels = []string{"conda-forge"}
+	proxy.CondaDefaultChannel = "conda-forge"
+	h := &CondaHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://proxy.local"}
+	routes := h.Routes()
+
+	tests := []struct {
+		path         string
+		wantStatus   int
+		wantUpstream string
+	}{
+		{"/conda-forge/noarch/repodata.json", http.StatusOK, "/conda-forge/noarch/repodata.json"},
+		{"/noarch/repodata.json", http.StatusOK, "/conda-forge/noarch/repodata.json"},
+		{"/bioconda/noarch/repodata.json", http.StatusNotFound, ""},
+		{"/bioconda/linux-64/samtools-1.17-h00cdaf9_0.conda", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		upstreamPaths = nil
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.wantStatus)
+		}
+		if tt.wantUpstream == "" && len(upstreamPaths) > 0 {
+			t.Errorf("%s: upstream was called for a disallowed channel", tt.path)
+		}
+		if tt.wantUpstream != "" && (len(upstreamPaths) != 1 || upstreamPaths[0] != tt.wantUpstream) {
+			t.Errorf("%s: upstream paths = %v, want [%s]", tt.path, upstreamPaths, tt.wantUpstream)
+		}
+	}
+}
+
+func TestCondaNoDefaultChannel(t *testing.T) {
+	h := &CondaHandler{proxy: testProxy(), upstreamURL: "http://upstream.invalid"}
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/noarch/repodata.json", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
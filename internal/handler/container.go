@@ -1,12 +1,19 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/git-pkgs/registries/fetch"
 )
 
 const (
@@ -25,6 +32,15 @@ type ContainerHandler struct {
 	registryURL string
 	authURL     string
 	proxyURL    string
+
+	// blobTypes maps blob digests to the media type the manifests served
+	// through the proxy declared for them.
+	blobTypesMu sync.Mutex
+	blobTypes   map[string]string
+
+	// prefetchSlots bounds how many image and referrers indexes are
+	// prefetched in the background at once; see acquirePrefetchSlot.
+	prefetchSlots chan struct{}
 }
 
 // NewContainerHandler creates a new container registry protocol handler.
@@ -34,6 +50,8 @@ func NewContainerHandler(proxy *Proxy, proxyURL string) *ContainerHandler {
 		registryURL: dockerHubRegistry,
 		authURL:     dockerHubAuth,
 		proxyURL:    strings.TrimSuffix(proxyURL, "/"),
+
+		prefetchSlots: make(chan struct{}, indexPrefetchConcurrency),
 	}
 }
 
@@ -54,6 +72,9 @@ func (h *ContainerHandler) Routes() http.Handler {
 		case strings.HasSuffix(path, "/blobs/"+r.URL.Query().Get("digest")) || strings.Contains(path, "/blobs/sha256:"):
 			// Blob download: GET /v2/{name}/blobs/{digest}
 			h.handleBlobDownload(w, r, path)
+		case strings.Contains(path, "/referrers/"):
+			// Referrers: GET /v2/{name}/referrers/{digest}
+			h.handleReferrers(w, r, path)
 		case strings.Contains(path, "/manifests/"):
 			// Manifest: GET /v2/{name}/manifests/{reference}
 			h.handleManifest(w, r, path)
@@ -117,6 +138,24 @@ func (h *ContainerHandler) handleBlobDownload(w http.ResponseWriter, r *http.Req
 	)
 
 	if err != nil {
+		if errors.Is(err, ErrUpstreamNotFound) {
+			h.containerError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		if errors.Is(err, ErrFetchLimitReached) {
+			w.Header().Set("Retry-After", fetchLimitRetryAfter)
+			h.containerError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "too many concurrent upstream fetches")
+			return
+		}
+		if errors.Is(err, ErrCacheUnavailable) {
+			w.Header().Set("Retry-After", cacheUnavailableRetryAfter)
+			h.containerError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "cache database unavailable")
+			return
+		}
+		if errors.Is(err, ErrUpstreamTimeout) {
+			h.upstreamTimeoutError(w)
+			return
+		}
 		h.proxy.Logger.Error("failed to fetch blob", "error", err)
 		h.containerError(w, http.StatusBadGateway, "BLOB_UNKNOWN", "failed to fetch blob")
 		return
@@ -124,11 +163,18 @@ func (h *ContainerHandler) handleBlobDownload(w http.ResponseWriter, r *http.Req
 
 	w.Header().Set("Docker-Content-Digest", digest)
 	w.Header().Set("Content-Type", "application/octet-stream")
-	ServeArtifact(w, result)
+	if mediaType := h.blobMediaType(digest); mediaType != "" {
+		result.ContentType = mediaType
+		if filename := blobFilename(digest, mediaType); filename != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		}
+	}
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handleManifest proxies manifest requests to upstream.
-// Manifests change when tags are updated, so we proxy these directly.
+// Manifests referenced by tag change when tags are updated, so we proxy these
+// directly; manifests referenced by digest are immutable and cached.
 // Path format: {name}/manifests/{reference}
 func (h *ContainerHandler) handleManifest(w http.ResponseWriter, r *http.Request, path string) {
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
@@ -152,10 +198,18 @@ func (h *ContainerHandler) handleManifest(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Digest references are immutable, so serve them from the cache.
+	if r.Method == http.MethodGet && isDigestReference(reference) {
+		h.serveManifestByDigest(w, r, name, reference, token)
+		return
+	}
+
 	// Proxy to upstream
 	upstreamURL := fmt.Sprintf("%s/v2/%s/manifests/%s", h.registryURL, name, reference)
 
-	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstreamURL, nil)
+	ctx, cancel := h.proxy.withFetchDeadline(r.Context())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, r.Method, upstreamURL, nil)
 	if err != nil {
 		h.containerError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "failed to create request")
 		return
@@ -168,32 +222,125 @@ func (h *ContainerHandler) handleManifest(w http.ResponseWriter, r *http.Request
 		req.Header.Set("Accept", accept)
 	} else {
 		// Default accept headers for manifests
-		req.Header.Set("Accept", strings.Join([]string{
-			"application/vnd.oci.image.manifest.v1+json",
-			"application/vnd.oci.image.index.v1+json",
-			"application/vnd.docker.distribution.manifest.v2+json",
-			"application/vnd.docker.distribution.manifest.list.v2+json",
-			"application/vnd.docker.distribution.manifest.v1+prettyjws",
-		}, ", "))
+		req.Header.Set("Accept", manifestAccept)
 	}
 
 	resp, err := h.proxy.HTTPClient.Do(req)
 	if err != nil {
+		if fetchTimedOut(r.Context(), ctx) {
+			h.upstreamTimeoutError(w)
+			return
+		}
 		h.proxy.Logger.Error("failed to fetch manifest", "error", err)
 		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
 		return
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// Copy relevant headers
-	for _, header := range []string{"Content-Type", "Content-Length", "Docker-Content-Digest", "ETag"} {
+	// Copy relevant headers. Content-Length is only copied when the
+	// upstream body is streamed as-is; otherwise an error response written
+	// in its place would carry upstream's length.
+	for _, header := range []string{"Content-Type", "Docker-Content-Digest", "ETag"} {
 		if v := resp.Header.Get(header); v != "" {
 			w.Header().Set(header, v)
 		}
 	}
 
+	index := isImageIndex(resp.Header.Get("Content-Type"))
+	prefetch := h.proxy.ContainerPrefetchIndex && index
+	if r.Method != http.MethodGet || resp.StatusCode != http.StatusOK || (index && !prefetch) {
+		if v := resp.Header.Get("Content-Length"); v != "" {
+			w.Header().Set("Content-Length", v)
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	body, err := h.proxy.ReadMetadata(resp.Body)
+	if err != nil {
+		h.proxy.Logger.Error("failed to read manifest", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to read from upstream")
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
+	_, _ = w.Write(body)
+
+	if prefetch {
+		h.prefetchIndexPlatforms(r.Context(), name, token, body)
+		return
+	}
+	h.rememberBlobMediaTypes(body)
+}
+
+// serveManifestByDigest serves a manifest referenced by digest from the
+// cache, fetching it from upstream on a miss. When prefetching is enabled
+// and the manifest is a freshly fetched image index, its platforms are
+// cached in the background.
+func (h *ContainerHandler) serveManifestByDigest(w http.ResponseWriter, r *http.Request, name, digest, token string) {
+	result, err := h.fetchManifestByDigest(r.Context(), name, digest, token)
+	if err != nil {
+		if errors.Is(err, fetch.ErrNotFound) {
+			h.containerError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		if errors.Is(err, ErrUpstreamTimeout) {
+			h.upstreamTimeoutError(w)
+			return
+		}
+		h.proxy.Logger.Error("failed to fetch manifest", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
+		return
+	}
+
+	w.Header().Set("Docker-Content-Digest", digest)
+
+	if result.Reader == nil {
+		h.proxy.ServeArtifact(w, result)
+		return
+	}
+	if !isImageIndex(result.ContentType) {
+		h.serveImageManifest(w, result)
+		return
+	}
+	if !h.proxy.ContainerPrefetchIndex || result.Cached {
+		h.proxy.ServeArtifact(w, result)
+		return
+	}
+
+	body, err := h.proxy.ReadMetadata(result.Reader)
+	_ = result.Reader.Close()
+	if err != nil {
+		h.proxy.Logger.Error("failed to read image index", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to read manifest")
+		return
+	}
+	w.Header().Set("Content-Type", result.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	if result.Immutable {
+		setImmutableCacheHeaders(w.Header())
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+
+	h.prefetchIndexPlatforms(r.Context(), name, token, body)
+}
+
+// serveImageManifest serves a single-image manifest from the cache and
+// remembers the media types it declares for its blobs.
+func (h *ContainerHandler) serveImageManifest(w http.ResponseWriter, result *CacheResult) {
+	body, err := h.proxy.ReadMetadata(result.Reader)
+	_ = result.Reader.Close()
+	if err != nil {
+		h.proxy.Logger.Error("failed to read manifest", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to read manifest")
+		return
+	}
+	h.rememberBlobMediaTypes(body)
+
+	result.Reader = io.NopCloser(bytes.NewReader(body))
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handleTagsList proxies tag list requests to upstream.
@@ -221,7 +368,9 @@ func (h *ContainerHandler) handleTagsList(w http.ResponseWriter, r *http.Request
 		upstreamURL += "?" + r.URL.RawQuery
 	}
 
-	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstreamURL, nil)
+	ctx, cancel := h.proxy.withFetchDeadline(r.Context())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamURL, nil)
 	if err != nil {
 		h.containerError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "failed to create request")
 		return
@@ -231,6 +380,10 @@ func (h *ContainerHandler) handleTagsList(w http.ResponseWriter, r *http.Request
 
 	resp, err := h.proxy.HTTPClient.Do(req)
 	if err != nil {
+		if fetchTimedOut(r.Context(), ctx) {
+			h.upstreamTimeoutError(w)
+			return
+		}
 		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
 		return
 	}
@@ -282,7 +435,9 @@ func (h *ContainerHandler) getAuthToken(_ interface{ Done() <-chan struct{} }, r
 func (h *ContainerHandler) proxyBlobHead(w http.ResponseWriter, r *http.Request, name, digest, token string) {
 	upstreamURL := fmt.Sprintf("%s/v2/%s/blobs/%s", h.registryURL, name, digest)
 
-	req, err := http.NewRequestWithContext(r.Context(), http.MethodHead, upstreamURL, nil)
+	ctx, cancel := h.proxy.withFetchDeadline(r.Context())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, upstreamURL, nil)
 	if err != nil {
 		h.containerError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "failed to create request")
 		return
@@ -292,6 +447,10 @@ func (h *ContainerHandler) proxyBlobHead(w http.ResponseWriter, r *http.Request,
 
 	resp, err := h.proxy.HTTPClient.Do(req)
 	if err != nil {
+		if fetchTimedOut(r.Context(), ctx) {
+			h.upstreamTimeoutError(w)
+			return
+		}
 		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
 		return
 	}
@@ -302,6 +461,9 @@ func (h *ContainerHandler) proxyBlobHead(w http.ResponseWriter, r *http.Request,
 			w.Header().Set(header, v)
 		}
 	}
+	if mediaType := h.blobMediaType(digest); mediaType != "" && resp.StatusCode == http.StatusOK {
+		w.Header().Set("Content-Type", mediaType)
+	}
 
 	w.WriteHeader(resp.StatusCode)
 }
@@ -317,6 +479,12 @@ func (h *ContainerHandler) containerError(w http.ResponseWriter, status int, cod
 	})
 }
 
+// upstreamTimeoutError answers a request whose upstream call ran past the
+// proxy's FetchTimeout.
+func (h *ContainerHandler) upstreamTimeoutError(w http.ResponseWriter) {
+	h.containerError(w, http.StatusGatewayTimeout, "UNAVAILABLE", "upstream fetch timed out")
+}
+
 // blobPathPattern matches blob paths: {name}/blobs/{digest}
 var blobPathPattern = regexp.MustCompile(`^(.+)/blobs/(sha256:[a-f0-9]+)$`)
 
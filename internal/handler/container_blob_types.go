@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+// maxBlobMediaTypes bounds the digest to media type map so pulls of many
+// distinct images can't grow it without limit. When it fills up it is
+// cleared; a forgotten blob is served as application/octet-stream until a
+// manifest naming it passes through again.
+const maxBlobMediaTypes = 50000
+
+// rememberBlobMediaTypes records the media type of the config and every
+// layer a manifest references, so a later blob download can be served with
+// the type the manifest declared rather than whatever upstream's storage
+// backend sent. Bodies that aren't single-image manifests are ignored.
+func (h *ContainerHandler) rememberBlobMediaTypes(manifestBody []byte) {
+	var manifest ociManifest
+	if err := json.Unmarshal(manifestBody, &manifest); err != nil {
+		return
+	}
+
+	descs := make([]ociDescriptor, 0, len(manifest.Layers)+len(manifest.Blobs)+1)
+	descs = append(descs, manifest.Config)
+	descs = append(descs, manifest.Layers...)
+	descs = append(descs, manifest.Blobs...)
+
+	h.blobTypesMu.Lock()
+	defer h.blobTypesMu.Unlock()
+	for _, desc := range descs {
+		if desc.MediaType == "" || !isDigestReference(desc.Digest) {
+			continue
+		}
+		if h.blobTypes == nil || len(h.blobTypes) >= maxBlobMediaTypes {
+			h.blobTypes = make(map[string]string)
+		}
+		h.blobTypes[desc.Digest] = desc.MediaType
+	}
+}
+
+// blobMediaType returns the media type a manifest declared for digest, or
+// "" if no manifest naming it has been seen.
+func (h *ContainerHandler) blobMediaType(digest string) string {
+	h.blobTypesMu.Lock()
+	defer h.blobTypesMu.Unlock()
+	return h.blobTypes[digest]
+}
+
+// blobFilename names a blob for Content-Disposition: the digest's hex part
+// plus an extension derived from the media type, such as
+// "abc123.tar.gz" for an application/vnd.oci.image.layer.v1.tar+gzip layer.
+// It returns "" for media types with no obvious extension.
+func blobFilename(digest, mediaType string) string {
+	mediaType, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return ""
+	}
+
+	var ext string
+	switch {
+	case strings.HasSuffix(mediaType, "+json"), mediaType == "application/json":
+		ext = ".json"
+	case strings.HasSuffix(mediaType, ".tar"):
+		ext = ".tar"
+	case strings.HasSuffix(mediaType, ".tar+gzip"), strings.HasSuffix(mediaType, ".tar.gzip"):
+		ext = ".tar.gz"
+	case strings.HasSuffix(mediaType, ".tar+zstd"):
+		ext = ".tar.zst"
+	default:
+		return ""
+	}
+
+	_, hex, _ := strings.Cut(digest, ":")
+	return hex + ext
+}
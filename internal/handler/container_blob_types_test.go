@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContainerHandler_BlobServedWithManifestMediaType(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, _ := newIndexTestHandler(t, reg)
+	routes := h.Routes()
+
+	var manifestDigest string
+	for d := range reg.manifests {
+		manifestDigest = d
+		break
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(reg.manifests[manifestDigest], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	layer := manifest.Layers[0]
+
+	// Before any manifest naming it has been served, the layer's type is unknown.
+	req := httptest.NewRequest(http.MethodGet, "/library/app/blobs/"+layer.Digest, nil)
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got == layer.MediaType {
+		t.Errorf("Content-Type = %q before the manifest was seen", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/library/app/manifests/"+manifestDigest, nil)
+	routes.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/library/app/blobs/"+layer.Digest, nil)
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/vnd.oci.image.layer.v1.tar+gzip" {
+		t.Errorf("Content-Type = %q, want the layer's declared media type", got)
+	}
+	wantFilename := strings.TrimPrefix(layer.Digest, "sha256:") + ".tar.gz"
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=`+wantFilename {
+		t.Errorf("Content-Disposition = %q, want filename %s", got, wantFilename)
+	}
+	if w.Body.String() != string(reg.blobs[layer.Digest]) {
+		t.Error("blob body changed")
+	}
+}
+
+func TestBlobFilename(t *testing.T) {
+	const digest = "sha256:abc123"
+	tests := []struct {
+		mediaType string
+		want      string
+	}{
+		{"application/vnd.oci.image.layer.v1.tar+gzip", "abc123.tar.gz"},
+		{"application/vnd.oci.image.layer.v1.tar+zstd", "abc123.tar.zst"},
+		{"application/vnd.oci.image.layer.v1.tar", "abc123.tar"},
+		{"application/vnd.docker.image.rootfs.diff.tar.gzip", "abc123.tar.gz"},
+		{"application/vnd.oci.image.config.v1+json", "abc123.json"},
+		{"application/vnd.docker.container.image.v1+json", "abc123.json"},
+		{"application/octet-stream", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := blobFilename(digest, tt.mediaType); got != tt.want {
+			t.Errorf("blobFilename(%q) = %q, want %q", tt.mediaType, got, tt.want)
+		}
+	}
+}
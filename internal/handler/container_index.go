@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ociIndexMediaType           = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType        = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestV1MediaType   = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+
+	// containerManifestFilename is the artifact filename used for manifests
+	// cached by digest. Blobs use their digest as the filename.
+	containerManifestFilename = "manifest.json"
+
+	// indexPrefetchTimeout bounds the background work of caching every
+	// platform referenced by an image index.
+	indexPrefetchTimeout = 30 * time.Minute
+
+	// indexPrefetchConcurrency is how many image and referrers indexes
+	// are prefetched in the background at once.
+	indexPrefetchConcurrency = 4
+)
+
+// manifestAccept lists every manifest media type the proxy understands, in
+// the order sent upstream when the client didn't specify its own Accept.
+var manifestAccept = strings.Join([]string{
+	ociManifestMediaType,
+	ociIndexMediaType,
+	dockerManifestMediaType,
+	dockerManifestListMediaType,
+	dockerManifestV1MediaType,
+	ociArtifactManifestMediaType,
+}, ", ")
+
+// ociDescriptor references content by digest, as used in image indexes and
+// manifests.
+type ociDescriptor struct {
+	MediaType string       `json:"mediaType"`
+	Digest    string       `json:"digest"`
+	Size      int64        `json:"size"`
+	Platform  *ociPlatform `json:"platform,omitempty"`
+	// ArtifactType is set on referrers index entries, e.g. the cosign
+	// signature or SBOM media type.
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// ociPlatform describes the platform an index entry targets.
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p *ociPlatform) String() string {
+	if p == nil {
+		return ""
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// ociIndex is an OCI image index or Docker manifest list.
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is a single-platform OCI image manifest or Docker v2 manifest.
+// Blobs is only used by the older OCI artifact manifest, which some
+// registries still serve for signatures.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+	Blobs     []ociDescriptor `json:"blobs,omitempty"`
+}
+
+// isImageIndex reports whether a manifest Content-Type is a multi-platform
+// index rather than a single image manifest.
+func isImageIndex(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	return mediaType == ociIndexMediaType || mediaType == dockerManifestListMediaType
+}
+
+// isDigestReference reports whether a manifest reference is a content digest
+// rather than a tag. Digest references are immutable and safe to cache.
+func isDigestReference(reference string) bool {
+	return strings.HasPrefix(reference, "sha256:")
+}
+
+// fetchManifestByDigest returns a manifest from the cache, fetching and
+// caching it from upstream on a miss.
+func (h *ContainerHandler) fetchManifestByDigest(ctx context.Context, name, digest, token string) (*CacheResult, error) {
+	headers := http.Header{
+		"Authorization": {"Bearer " + token},
+		"Accept":        {manifestAccept},
+	}
+	return h.proxy.GetOrFetchArtifactFromURLWithHeaders(
+		ctx,
+		"oci",
+		name,
+		digest,
+		containerManifestFilename,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", h.registryURL, name, digest),
+		headers,
+	)
+}
+
+// fetchBlob caches a blob by digest, fetching it from upstream on a miss.
+func (h *ContainerHandler) fetchBlob(ctx context.Context, name, digest, token string) (*CacheResult, error) {
+	headers := http.Header{"Authorization": {"Bearer " + token}}
+	return h.proxy.GetOrFetchArtifactFromURLWithHeaders(
+		ctx,
+		"oci",
+		name,
+		digest,
+		digest,
+		fmt.Sprintf("%s/v2/%s/blobs/%s", h.registryURL, name, digest),
+		headers,
+	)
+}
+
+// cacheIndexPlatforms caches every platform manifest referenced by an image
+// index along with each manifest's config and layer blobs. Entries without a
+// real platform (such as buildx attestation manifests, which use
+// "unknown/unknown") are skipped. The index itself is not modified, so
+// clients still choose their own platform from it.
+func (h *ContainerHandler) cacheIndexPlatforms(ctx context.Context, name, token string, indexBody []byte) error {
+	var index ociIndex
+	if err := json.Unmarshal(indexBody, &index); err != nil {
+		return fmt.Errorf("parsing image index: %w", err)
+	}
+
+	var errs []error
+	for _, desc := range index.Manifests {
+		if desc.Platform != nil && desc.Platform.OS == "unknown" {
+			continue
+		}
+		if err := h.cachePlatformManifest(ctx, name, token, desc); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", desc.Digest, desc.Platform, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *ContainerHandler) cachePlatformManifest(ctx context.Context, name, token string, desc ociDescriptor) error {
+	if !isDigestReference(desc.Digest) {
+		return fmt.Errorf("unsupported digest %q", desc.Digest)
+	}
+
+	// The index is the only thing vouching for this digest, so the
+	// manifest is checked against it before it is cached.
+	result, err := h.fetchManifestByDigest(expectDigest(ctx, desc.Digest), name, desc.Digest, token)
+	if err != nil {
+		return fmt.Errorf("caching manifest: %w", err)
+	}
+	if result.Reader == nil {
+		// Direct-serve mode returns a redirect; the manifest is cached but
+		// we can't read it back to find its blobs.
+		return nil
+	}
+	body, err := h.proxy.ReadMetadata(result.Reader)
+	_ = result.Reader.Close()
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+	h.rememberBlobMediaTypes(body)
+
+	blobs := make([]ociDescriptor, 0, len(manifest.Layers)+len(manifest.Blobs)+1)
+	if manifest.Config.Digest != "" {
+		blobs = append(blobs, manifest.Config)
+	}
+	blobs = append(blobs, manifest.Layers...)
+	blobs = append(blobs, manifest.Blobs...)
+
+	for _, blob := range blobs {
+		if !isDigestReference(blob.Digest) {
+			continue
+		}
+		res, err := h.fetchBlob(ctx, name, blob.Digest, token)
+		if err != nil {
+			return fmt.Errorf("caching blob %s: %w", blob.Digest, err)
+		}
+		if res.Reader != nil {
+			_ = res.Reader.Close()
+		}
+	}
+	return nil
+}
+
+// acquirePrefetchSlot takes one of the indexPrefetchConcurrency slots for
+// background prefetching, reporting false when they are all in use. An index
+// pulled while they are all busy is not prefetched; its manifests are cached
+// as clients pull them instead.
+func (h *ContainerHandler) acquirePrefetchSlot(name string) bool {
+	select {
+	case h.prefetchSlots <- struct{}{}:
+		return true
+	default:
+		h.proxy.Logger.Info("skipping image index prefetch, too many running", "name", name)
+		return false
+	}
+}
+
+// prefetchIndexPlatforms runs cacheIndexPlatforms in the background, detached
+// from the client request so a finished pull doesn't cancel it.
+func (h *ContainerHandler) prefetchIndexPlatforms(ctx context.Context, name, token string, indexBody []byte) {
+	if !h.acquirePrefetchSlot(name) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), indexPrefetchTimeout)
+	go func() {
+		defer func() { <-h.prefetchSlots }()
+		defer cancel()
+		if err := h.cacheIndexPlatforms(ctx, name, token, indexBody); err != nil {
+			h.proxy.Logger.Warn("failed to cache image index platforms", "name", name, "error", err)
+			return
+		}
+		h.proxy.Logger.Info("cached image index platforms", "name", name)
+	}()
+}
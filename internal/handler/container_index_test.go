@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func sha256Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fakeRegistry serves an image index referencing two platform manifests and
+// an attestation manifest, plus each manifest's config and layer blobs.
+type fakeRegistry struct {
+	server    *httptest.Server
+	index     []byte
+	manifests map[string][]byte // digest -> manifest JSON
+	blobs     map[string][]byte // digest -> blob content
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+
+	reg := &fakeRegistry{
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+		requests:  map[string]int{},
+	}
+
+	var entries []ociDescriptor
+	for _, p := range []ociPlatform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64", Variant: "v8"}} {
+		config := []byte(`{"architecture":"` + p.Architecture + `"}`)
+		layer := []byte("layer for " + p.String())
+		reg.blobs[sha256Digest(config)] = config
+		reg.blobs[sha256Digest(layer)] = layer
+
+		manifest, _ := json.Marshal(ociManifest{
+			MediaType: ociManifestMediaType,
+			Config:    ociDescriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: sha256Digest(config)},
+			Layers:    []ociDescriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: sha256Digest(layer)}},
+		})
+		reg.manifests[sha256Digest(manifest)] = manifest
+		platform := p
+		entries = append(entries, ociDescriptor{MediaType: ociManifestMediaType, Digest: sha256Digest(manifest), Platform: &platform})
+	}
+	entries = append(entries, ociDescriptor{
+		MediaType: ociManifestMediaType,
+		Digest:    sha256Digest([]byte("attestation")),
+		Platform:  &ociPlatform{OS: "unknown", Architecture: "unknown"},
+	})
+	reg.index, _ = json.Marshal(ociIndex{MediaType: ociIndexMediaType, Manifests: entries})
+
+	reg.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.Lock()
+		reg.requests[r.URL.Path]++
+		reg.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/token":
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "tok"})
+		case r.URL.Path == "/v2/library/app/manifests/latest":
+			w.Header().Set("Content-Type", ociIndexMediaType)
+			_, _ = w.Write(reg.index)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/app/manifests/"):
+			body, ok := reg.manifests[strings.TrimPrefix(r.URL.Path, "/v2/library/app/manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			_, _ = w.Write(body)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/app/blobs/"):
+			body, ok := reg.blobs[strings.TrimPrefix(r.URL.Path, "/v2/library/app/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(reg.server.Close)
+	return reg
+}
+
+func (reg *fakeRegistry) requestCount(path string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.requests[path]
+}
+
+func newIndexTestHandler(t *testing.T, reg *fakeRegistry) (*ContainerHandler, *database.DB) {
+	t.Helper()
+
+	db, err := database.Create(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	fetcher := fetch.NewFetcher(fetch.WithHTTPClient(reg.server.Client()), fetch.WithMaxRetries(0))
+	proxy := NewProxy(db, newMockStorage(), fetcher, fetch.NewResolver(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	return &ContainerHandler{
+		proxy:       proxy,
+		registryURL: reg.server.URL,
+		authURL:     reg.server.URL,
+		proxyURL:    "http://localhost:8080",
+
+		prefetchSlots: make(chan struct{}, indexPrefetchConcurrency),
+	}, db
+}
+
+func assertOCICached(t *testing.T, db *database.DB, digest, filename string) {
+	t.Helper()
+	art, err := db.GetArtifact(purl.MakePURLString("oci", "library/app", digest), filename)
+	if err != nil {
+		t.Fatalf("GetArtifact(%s): %v", digest, err)
+	}
+	if art == nil || !art.IsCached() {
+		t.Errorf("%s (%s) not cached", digest, filename)
+	}
+}
+
+func TestContainerHandler_CacheIndexPlatforms(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, db := newIndexTestHandler(t, reg)
+
+	if err := h.cacheIndexPlatforms(context.Background(), "library/app", "tok", reg.index); err != nil {
+		t.Fatalf("cacheIndexPlatforms() error = %v", err)
+	}
+
+	if len(reg.manifests) != 2 {
+		t.Fatalf("fake registry has %d manifests, want 2", len(reg.manifests))
+	}
+	for digest := range reg.manifests {
+		assertOCICached(t, db, digest, containerManifestFilename)
+	}
+	for digest := range reg.blobs {
+		assertOCICached(t, db, digest, digest)
+	}
+
+	attestation := "/v2/library/app/manifests/" + sha256Digest([]byte("attestation"))
+	if n := reg.requestCount(attestation); n != 0 {
+		t.Errorf("attestation manifest fetched %d times, want 0", n)
+	}
+}
+
+func TestContainerHandler_ManifestByDigestServedFromCache(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, _ := newIndexTestHandler(t, reg)
+	routes := h.Routes()
+
+	var digest string
+	for d := range reg.manifests {
+		digest = d
+		break
+	}
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/library/app/manifests/"+digest, nil)
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != ociManifestMediaType {
+			t.Errorf("Content-Type = %q, want %q", got, ociManifestMediaType)
+		}
+		if got := w.Header().Get("Docker-Content-Digest"); got != digest {
+			t.Errorf("Docker-Content-Digest = %q, want %q", got, digest)
+		}
+		if w.Body.String() != string(reg.manifests[digest]) {
+			t.Errorf("body = %q, want manifest", w.Body.String())
+		}
+	}
+
+	if n := reg.requestCount("/v2/library/app/manifests/" + digest); n != 1 {
+		t.Errorf("upstream manifest requests = %d, want 1", n)
+	}
+}
+
+func TestContainerHandler_ManifestByDigestNotFound(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, _ := newIndexTestHandler(t, reg)
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/manifests/"+sha256Digest([]byte("missing")), nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestContainerHandler_TagIndexPassedThrough(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, _ := newIndexTestHandler(t, reg)
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/manifests/latest", nil)
+	req.Header.Set("Accept", ociIndexMediaType)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != ociIndexMediaType {
+		t.Errorf("Content-Type = %q, want %q", got, ociIndexMediaType)
+	}
+	if w.Body.String() != string(reg.index) {
+		t.Error("index body should be passed through unchanged so clients can pick their platform")
+	}
+}
+
+func TestIsImageIndex(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{ociIndexMediaType, true},
+		{dockerManifestListMediaType, true},
+		{ociIndexMediaType + "; charset=utf-8", true},
+		{ociManifestMediaType, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isImageIndex(tt.contentType); got != tt.want {
+			t.Errorf("isImageIndex(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestContainerHandler_TagIndexPrefetchesPlatforms(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, db := newIndexTestHandler(t, reg)
+	h.proxy.ContainerPrefetchIndex = true
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/manifests/latest", nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Body.String() != string(reg.index) {
+		t.Fatal("index body should be passed through unchanged")
+	}
+
+	// Prefetching runs in the background; wait for the last blob to land.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cached, _ := db.GetCachedArtifactCount()
+		if cached == int64(len(reg.manifests)+len(reg.blobs)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cached %d artifacts, want %d", cached, len(reg.manifests)+len(reg.blobs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for digest := range reg.manifests {
+		assertOCICached(t, db, digest, containerManifestFilename)
+	}
+}
+
+func TestContainerHandler_IndexPlatformDigestMismatchNotCached(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, db := newIndexTestHandler(t, reg)
+
+	// Serve something else under the first platform's manifest digest.
+	var tampered string
+	for digest := range reg.manifests {
+		tampered = digest
+		reg.manifests[digest] = []byte(`{"mediaType":"` + ociManifestMediaType + `","layers":[]}`)
+		break
+	}
+
+	err := h.cacheIndexPlatforms(context.Background(), "library/app", "tok", reg.index)
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("cacheIndexPlatforms error = %v, want ErrDigestMismatch", err)
+	}
+	art, err := db.GetArtifact(purl.MakePURLString("oci", "library/app", tampered), containerManifestFilename)
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if art != nil && art.StoragePath.Valid {
+		t.Error("manifest that doesn't match its digest was cached")
+	}
+	for digest := range reg.manifests {
+		if digest != tampered {
+			assertOCICached(t, db, digest, containerManifestFilename)
+		}
+	}
+}
+
+func TestContainerHandler_IndexPrefetchBounded(t *testing.T) {
+	reg := newFakeRegistry(t)
+	h, db := newIndexTestHandler(t, reg)
+
+	for range cap(h.prefetchSlots) {
+		h.prefetchSlots <- struct{}{}
+	}
+	h.prefetchIndexPlatforms(context.Background(), "library/app", "tok", reg.index)
+	for range cap(h.prefetchSlots) {
+		<-h.prefetchSlots
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	for digest := range reg.manifests {
+		if n := reg.requestCount("/v2/library/app/manifests/" + digest); n != 0 {
+			t.Errorf("manifest %s fetched %d times while every prefetch slot was busy", digest, n)
+		}
+	}
+	if cached, _ := db.GetCachedArtifactCount(); cached != 0 {
+		t.Errorf("cached %d artifacts, want 0", cached)
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	ociArtifactManifestMediaType = "application/vnd.oci.artifact.manifest.v1+json"
+
+	// ociFiltersAppliedHeader tells referrers clients which query filters
+	// the registry applied, so they know whether to filter the list
+	// themselves.
+	ociFiltersAppliedHeader = "OCI-Filters-Applied"
+
+	referrersMatchCount = 3 // full match + name + digest
+)
+
+// referrersPathPattern matches referrers paths: {name}/referrers/{digest}
+var referrersPathPattern = regexp.MustCompile(`^(.+)/referrers/(sha256:[a-f0-9]+)$`)
+
+// parseReferrersPath extracts repository name and subject digest from a
+// referrers path.
+func (h *ContainerHandler) parseReferrersPath(path string) (name, digest string) {
+	matches := referrersPathPattern.FindStringSubmatch(path)
+	if len(matches) != referrersMatchCount {
+		return "", ""
+	}
+	return matches[1], matches[2]
+}
+
+// referrersFallbackTag returns the tag that registries without the referrers
+// API use to hold a digest's referrers index, e.g. sha256:abc -> sha256-abc.
+func referrersFallbackTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// emptyReferrersIndex is returned when a subject has no referrers.
+var emptyReferrersIndex = []byte(`{"schemaVersion":2,"mediaType":"` + ociIndexMediaType + `","manifests":[]}`)
+
+// handleReferrers proxies the OCI referrers API, which signing and SBOM
+// tools (cosign, notation, oras) use to find signatures and attestations
+// for an image. The list itself changes whenever something new is attached,
+// so it is always fetched from upstream; the referenced manifests and blobs
+// are immutable and cached when pulled by digest.
+//
+// When upstream doesn't implement the API, the referrers index is read from
+// the fallback tag schema instead, so clients get the same answer either way.
+// Path format: {name}/referrers/{digest}
+func (h *ContainerHandler) handleReferrers(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, digest := h.parseReferrersPath(path)
+	if name == "" || digest == "" {
+		h.containerError(w, http.StatusBadRequest, "MANIFEST_UNKNOWN", "invalid referrers path")
+		return
+	}
+
+	h.proxy.Logger.Info("container referrers request", "name", name, "digest", digest)
+
+	token, err := h.getAuthToken(r.Context(), name, "pull")
+	if err != nil {
+		h.proxy.Logger.Error("failed to get auth token", "error", err)
+		h.containerError(w, http.StatusUnauthorized, "UNAUTHORIZED", "failed to authenticate")
+		return
+	}
+
+	upstreamURL := fmt.Sprintf("%s/v2/%s/referrers/%s", h.registryURL, name, digest)
+	if r.URL.RawQuery != "" {
+		upstreamURL += "?" + r.URL.RawQuery
+	}
+
+	ctx, cancel := h.proxy.withFetchDeadline(r.Context())
+	defer cancel()
+	resp, err := h.getIndex(ctx, upstreamURL, token)
+	if err != nil {
+		if fetchTimedOut(r.Context(), ctx) {
+			h.upstreamTimeoutError(w)
+			return
+		}
+		h.proxy.Logger.Error("failed to fetch referrers", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		h.serveReferrersFromTag(w, r, name, digest, token)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		if ct := resp.Header.Get("Content-Type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	body, err := h.proxy.ReadMetadata(resp.Body)
+	if err != nil {
+		h.proxy.Logger.Error("failed to read referrers", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to read from upstream")
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = ociIndexMediaType
+	}
+	w.Header().Set("Content-Type", contentType)
+	if v := resp.Header.Get(ociFiltersAppliedHeader); v != "" {
+		w.Header().Set(ociFiltersAppliedHeader, v)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+
+	h.prefetchReferrers(r.Context(), name, token, body)
+}
+
+// serveReferrersFromTag answers a referrers request from the fallback tag
+// for upstreams that don't implement the referrers API. A missing tag means
+// no referrers, which is an empty index rather than a 404.
+func (h *ContainerHandler) serveReferrersFromTag(w http.ResponseWriter, r *http.Request, name, digest, token string) {
+	upstreamURL := fmt.Sprintf("%s/v2/%s/manifests/%s", h.registryURL, name, referrersFallbackTag(digest))
+	ctx, cancel := h.proxy.withFetchDeadline(r.Context())
+	defer cancel()
+	resp, err := h.getIndex(ctx, upstreamURL, token)
+	if err != nil {
+		if fetchTimedOut(r.Context(), ctx) {
+			h.upstreamTimeoutError(w)
+			return
+		}
+		h.proxy.Logger.Error("failed to fetch referrers tag", "error", err)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var body []byte
+	switch resp.StatusCode {
+	case http.StatusOK:
+		body, err = h.proxy.ReadMetadata(resp.Body)
+		if err != nil {
+			h.proxy.Logger.Error("failed to read referrers tag", "error", err)
+			h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to read from upstream")
+			return
+		}
+	case http.StatusNotFound:
+		body = emptyReferrersIndex
+	default:
+		h.proxy.Logger.Error("unexpected status for referrers tag", "status", resp.StatusCode)
+		h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "failed to fetch from upstream")
+		return
+	}
+
+	if artifactType := r.URL.Query().Get("artifactType"); artifactType != "" {
+		filtered, err := filterReferrers(body, artifactType)
+		if err != nil {
+			h.proxy.Logger.Error("failed to filter referrers", "error", err)
+			h.containerError(w, http.StatusBadGateway, "INTERNAL_ERROR", "invalid referrers index from upstream")
+			return
+		}
+		body = filtered
+		w.Header().Set(ociFiltersAppliedHeader, "artifactType")
+	}
+
+	w.Header().Set("Content-Type", ociIndexMediaType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+
+	h.prefetchReferrers(r.Context(), name, token, body)
+}
+
+// getIndex requests an image index from upstream with the given token.
+func (h *ContainerHandler) getIndex(ctx context.Context, upstreamURL, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", ociIndexMediaType)
+	return h.proxy.HTTPClient.Do(req)
+}
+
+// filterReferrers keeps only the index entries whose artifactType matches.
+// Entries are copied through unchanged so annotations survive.
+func filterReferrers(body []byte, artifactType string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("parsing referrers index: %w", err)
+	}
+	var entries []json.RawMessage
+	if raw, ok := doc["manifests"]; ok {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("parsing referrers index: %w", err)
+		}
+	}
+
+	kept := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		var desc ociDescriptor
+		if err := json.Unmarshal(entry, &desc); err != nil {
+			return nil, fmt.Errorf("parsing referrers entry: %w", err)
+		}
+		if desc.ArtifactType == artifactType {
+			kept = append(kept, entry)
+		}
+	}
+
+	manifests, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	doc["manifests"] = manifests
+	return json.Marshal(doc)
+}
+
+// prefetchReferrers caches every manifest in a referrers index, along with
+// its blobs, in the background when index prefetching is enabled. Clients
+// verifying a signature fetch these next, so a warm cache saves a round
+// trip to upstream on the next verification.
+func (h *ContainerHandler) prefetchReferrers(ctx context.Context, name, token string, indexBody []byte) {
+	if !h.proxy.ContainerPrefetchIndex || !h.acquirePrefetchSlot(name) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), indexPrefetchTimeout)
+	go func() {
+		defer func() { <-h.prefetchSlots }()
+		defer cancel()
+		var index ociIndex
+		if err := json.Unmarshal(indexBody, &index); err != nil {
+			h.proxy.Logger.Warn("failed to parse referrers index", "name", name, "error", err)
+			return
+		}
+		for _, desc := range index.Manifests {
+			if err := h.cachePlatformManifest(ctx, name, token, desc); err != nil {
+				h.proxy.Logger.Warn("failed to cache referrer", "name", name, "digest", desc.Digest, "error", err)
+			}
+		}
+	}()
+}
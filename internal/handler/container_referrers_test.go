@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	cosignSignatureType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	spdxSBOMType        = "application/spdx+json"
+)
+
+// newReferrersRegistry serves a signature manifest and blob for subject and
+// lists it as a referrer. When tagFallback is set the registry doesn't
+// implement the referrers API and publishes the index under the fallback
+// tag instead.
+func newReferrersRegistry(t *testing.T, subject string, tagFallback bool) (*fakeRegistry, []byte) {
+	t.Helper()
+
+	sigBlob := []byte(`{"critical":{"identity":{"docker-reference":"library/app"}}}`)
+	sigManifest, _ := json.Marshal(ociManifest{
+		MediaType: ociManifestMediaType,
+		Config:    ociDescriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: sha256Digest([]byte("{}"))},
+		Layers:    []ociDescriptor{{MediaType: "application/vnd.dev.cosign.simplesigning.v1+json", Digest: sha256Digest(sigBlob)}},
+	})
+	index, _ := json.Marshal(ociIndex{
+		MediaType: ociIndexMediaType,
+		Manifests: []ociDescriptor{
+			{MediaType: ociManifestMediaType, Digest: sha256Digest(sigManifest), ArtifactType: cosignSignatureType},
+			{MediaType: ociManifestMediaType, Digest: sha256Digest([]byte("sbom")), ArtifactType: spdxSBOMType},
+		},
+	})
+
+	reg := &fakeRegistry{
+		index:     index,
+		manifests: map[string][]byte{sha256Digest(sigManifest): sigManifest},
+		blobs:     map[string][]byte{sha256Digest(sigBlob): sigBlob, sha256Digest([]byte("{}")): []byte("{}")},
+		requests:  map[string]int{},
+	}
+	reg.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.Lock()
+		reg.requests[r.URL.Path]++
+		reg.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/token":
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "tok"})
+		case r.URL.Path == "/v2/library/app/referrers/"+subject && !tagFallback:
+			w.Header().Set("Content-Type", ociIndexMediaType)
+			_, _ = w.Write(index)
+		case r.URL.Path == "/v2/library/app/manifests/"+referrersFallbackTag(subject) && tagFallback:
+			w.Header().Set("Content-Type", ociIndexMediaType)
+			_, _ = w.Write(index)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/app/manifests/"):
+			body, ok := reg.manifests[strings.TrimPrefix(r.URL.Path, "/v2/library/app/manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			_, _ = w.Write(body)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/app/blobs/"):
+			body, ok := reg.blobs[strings.TrimPrefix(r.URL.Path, "/v2/library/app/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(reg.server.Close)
+	return reg, index
+}
+
+func decodeReferrers(t *testing.T, body []byte) ociIndex {
+	t.Helper()
+	var index ociIndex
+	if err := json.Unmarshal(body, &index); err != nil {
+		t.Fatalf("decoding referrers: %v: %s", err, body)
+	}
+	return index
+}
+
+func TestContainerHandler_ReferrersProxied(t *testing.T) {
+	subject := sha256Digest([]byte("image"))
+	reg, index := newReferrersRegistry(t, subject, false)
+	h, _ := newIndexTestHandler(t, reg)
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/referrers/"+subject, nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != ociIndexMediaType {
+		t.Errorf("Content-Type = %q, want %q", got, ociIndexMediaType)
+	}
+	if w.Body.String() != string(index) {
+		t.Errorf("body = %s, want upstream index unchanged", w.Body.String())
+	}
+	if n := reg.requestCount("/v2/library/app/referrers/" + subject); n != 1 {
+		t.Errorf("upstream referrers requests = %d, want 1", n)
+	}
+}
+
+func TestContainerHandler_ReferrersTagFallback(t *testing.T) {
+	subject := sha256Digest([]byte("image"))
+	reg, _ := newReferrersRegistry(t, subject, true)
+	h, _ := newIndexTestHandler(t, reg)
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/referrers/"+subject+"?artifactType="+url.QueryEscape(cosignSignatureType), nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != ociIndexMediaType {
+		t.Errorf("Content-Type = %q, want %q", got, ociIndexMediaType)
+	}
+	if got := w.Header().Get(ociFiltersAppliedHeader); got != "artifactType" {
+		t.Errorf("%s = %q, want artifactType", ociFiltersAppliedHeader, got)
+	}
+	index := decodeReferrers(t, w.Body.Bytes())
+	if len(index.Manifests) != 1 || index.Manifests[0].ArtifactType != cosignSignatureType {
+		t.Errorf("manifests = %+v, want only the signature", index.Manifests)
+	}
+}
+
+func TestContainerHandler_ReferrersNoneIsEmptyIndex(t *testing.T) {
+	reg, _ := newReferrersRegistry(t, sha256Digest([]byte("image")), true)
+	h, _ := newIndexTestHandler(t, reg)
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/referrers/"+sha256Digest([]byte("unsigned")), nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	index := decodeReferrers(t, w.Body.Bytes())
+	if index.MediaType != ociIndexMediaType || len(index.Manifests) != 0 {
+		t.Errorf("got %+v, want an empty image index", index)
+	}
+}
+
+func TestContainerHandler_ReferrersPrefetch(t *testing.T) {
+	subject := sha256Digest([]byte("image"))
+	reg, _ := newReferrersRegistry(t, subject, false)
+	h, db := newIndexTestHandler(t, reg)
+	h.proxy.ContainerPrefetchIndex = true
+
+	req := httptest.NewRequest(http.MethodGet, "/library/app/referrers/"+subject, nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	// The signature manifest and both its blobs are cached in the
+	// background. The SBOM entry is missing upstream and is skipped.
+	want := int64(len(reg.manifests) + len(reg.blobs))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cached, _ := db.GetCachedArtifactCount()
+		if cached == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cached %d artifacts, want %d", cached, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for digest := range reg.manifests {
+		assertOCICached(t, db, digest, containerManifestFilename)
+	}
+}
+
+func TestContainerHandler_parseReferrersPath(t *testing.T) {
+	h := &ContainerHandler{}
+
+	name, digest := h.parseReferrersPath("library/nginx/referrers/sha256:abc123")
+	if name != "library/nginx" || digest != "sha256:abc123" {
+		t.Errorf("parseReferrersPath() = %q, %q", name, digest)
+	}
+	if name, _ := h.parseReferrersPath("library/nginx/referrers/latest"); name != "" {
+		t.Errorf("parseReferrersPath() accepted a tag, name = %q", name)
+	}
+}
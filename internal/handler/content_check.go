@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// ErrUnexpectedContent is returned when upstream answered a binary artifact
+// download with what looks like an error page. Nothing is cached and
+// handlers answer with 502.
+var ErrUnexpectedContent = errors.New("upstream returned an error page instead of the artifact")
+
+// contentSniffLen is how much of an artifact body is inspected, the same
+// amount http.DetectContentType looks at.
+const contentSniffLen = 512
+
+type expectBinaryKey struct{}
+
+// expectBinary marks artifact downloads made with the returned context as
+// binary archives, such as tarballs, wheels and zips. Handlers use it where
+// every file they serve is one, so a 200 carrying an HTML or JSON error
+// page is refused rather than cached.
+func expectBinary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, expectBinaryKey{}, true)
+}
+
+// expectsBinary reports whether ctx was marked by expectBinary.
+func expectsBinary(ctx context.Context) bool {
+	v, _ := ctx.Value(expectBinaryKey{}).(bool)
+	return v
+}
+
+// checkArtifactContent looks at the start of an upstream artifact body
+// before it is stored. For downloads marked with expectBinary, a body that
+// sniffs as HTML or XML, or starts like a JSON object, is rejected with
+// ErrUnexpectedContent. The bytes read are put back in front of the body.
+func (p *Proxy) checkArtifactContent(ctx context.Context, ecosystem, upstreamURL string, artifact *fetch.Artifact) error {
+	if p.SkipContentCheck || !expectsBinary(ctx) {
+		return nil
+	}
+
+	br := bufio.NewReaderSize(artifact.Body, contentSniffLen)
+	head, err := br.Peek(contentSniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return fmt.Errorf("reading upstream artifact: %w", err)
+	}
+	artifact.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, artifact.Body}
+
+	if !looksLikeErrorPage(head) {
+		return nil
+	}
+	p.Logger.Warn("upstream returned an error page for a binary artifact, not caching",
+		"ecosystem", ecosystem, "url", upstreamURL, "content_type", artifact.ContentType)
+	metrics.RecordUpstreamError(ecosystem, "unexpected_content")
+	return fmt.Errorf("%w: %s sent %s", ErrUnexpectedContent, upstreamURL, http.DetectContentType(head))
+}
+
+// looksLikeErrorPage reports whether head, the start of a body, is markup or
+// a JSON object. No archive format starts with either.
+func looksLikeErrorPage(head []byte) bool {
+	sniffed := http.DetectContentType(head)
+	if strings.HasPrefix(sniffed, "text/html") || strings.HasPrefix(sniffed, "text/xml") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("{"))
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestNPMTarballErrorPageNotCached(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("<!DOCTYPE html><html><body><h1>Package not found</h1></body></html>")),
+		ContentType: "text/html",
+	}
+
+	h := NewNPMHandler(proxy, "http://localhost")
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("storage holds %d files, want none", len(store.files))
+	}
+	art, err := db.GetArtifact(purl.MakePURLString("npm", "lodash", "4.17.21"), "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if art != nil && art.IsCached() {
+		t.Error("error page was recorded as a cached artifact")
+	}
+}
+
+func TestJSONErrorRejectedForBinaryDownload(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader(`  {"error": "not found"}`)),
+		ContentType: "application/octet-stream",
+	}
+
+	_, err := proxy.GetOrFetchArtifactFromURL(expectBinary(context.Background()), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+	if !errors.Is(err, ErrUnexpectedContent) {
+		t.Fatalf("err = %v, want ErrUnexpectedContent", err)
+	}
+}
+
+func TestContentCheckKeepsBody(t *testing.T) {
+	gzipped := "\x1f\x8b\x08\x00" + strings.Repeat("x", 2000)
+	proxy, _, store, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader(gzipped))}
+
+	result, err := proxy.GetOrFetchArtifactFromURL(expectBinary(context.Background()), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(result.Reader)
+	_ = result.Reader.Close()
+	if string(body) != gzipped {
+		t.Errorf("body was altered by the content check: got %d bytes, want %d", len(body), len(gzipped))
+	}
+	if len(store.files) != 1 {
+		t.Errorf("storage holds %d files, want 1", len(store.files))
+	}
+}
+
+func TestContentCheckOnlyForBinaryDownloads(t *testing.T) {
+	page := "<html><body>index</body></html>"
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		skip bool
+	}{
+		{"no hint", context.Background(), false},
+		{"check disabled", expectBinary(context.Background()), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, _, _, fetcher := setupTestProxy(t)
+			proxy.SkipContentCheck = tc.skip
+			fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader(page))}
+
+			result, err := proxy.GetOrFetchArtifactFromURL(tc.ctx, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = result.Reader.Close()
+		})
+	}
+}
@@ -70,14 +70,16 @@ func (h *CRANHandler) handleSourceDownload(w http.ResponseWriter, r *http.Reques
 
 	upstreamURL := h.upstreamURL + r.URL.Path
 
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "cran", name, version, filename, upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "cran", name, version, filename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handleBinaryDownload serves a binary package, fetching and caching from upstream.
@@ -105,14 +107,16 @@ func (h *CRANHandler) handleBinaryDownload(w http.ResponseWriter, r *http.Reques
 
 	upstreamURL := h.upstreamURL + r.URL.Path
 
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "cran", name, storageVersion, filename, upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "cran", name, storageVersion, filename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // parseSourceFilename extracts name and version from a CRAN source filename.
@@ -4,12 +4,17 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 const (
 	debianUpstream = "http://deb.debian.org/debian"
 	debMatchCount  = 4 // full match + name + version + arch
+
+	// debianDefaultSuite is the suite name clients use to get
+	// DebianDefaultSuite.
+	debianDefaultSuite = "default"
 )
 
 // DebianHandler handles APT/Debian repository protocol requests.
@@ -51,6 +56,18 @@ func (h *DebianHandler) Routes() http.Handler {
 			// Package downloads - cache these
 			h.handlePackageDownload(w, r, path)
 		case strings.HasPrefix(path, "dists/"):
+			if rest, ok := strings.CutPrefix(path, "dists/"+debianDefaultSuite+"/"); ok {
+				// dists/default/...: the suite is whichever one is configured.
+				if h.proxy.DebianDefaultSuite == "" {
+					http.Error(w, "not found", http.StatusNotFound)
+					return
+				}
+				path = "dists/" + h.proxy.DebianDefaultSuite + "/" + rest
+			}
+			if !h.suiteAllowed(path) {
+				http.Error(w, "suite not allowed", http.StatusNotFound)
+				return
+			}
 			// Repository metadata - proxy without caching (changes frequently)
 			h.handleMetadata(w, r, path)
 		default:
@@ -60,6 +77,16 @@ func (h *DebianHandler) Routes() http.Handler {
 	})
 }
 
+// suiteAllowed reports whether a dists/{suite}/... path names a suite in the
+// configured allowlist. An empty allowlist permits every suite.
+func (h *DebianHandler) suiteAllowed(path string) bool {
+	if len(h.proxy.DebianSuites) == 0 {
+		return true
+	}
+	suite, _, _ := strings.Cut(strings.TrimPrefix(path, "dists/"), "/")
+	return slices.Contains(h.proxy.DebianSuites, suite)
+}
+
 // handlePackageDownload fetches and caches .deb packages from the pool.
 // Pool path format: pool/{component}/{prefix}/{name}/{filename}
 // Example: pool/main/n/nginx/nginx_1.18.0-6_amd64.deb
@@ -81,13 +108,15 @@ func (h *DebianHandler) handlePackageDownload(w http.ResponseWriter, r *http.Req
 	result, err := h.proxy.GetOrFetchArtifactFromURL(
 		r.Context(), "deb", name, version, filename, downloadURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get debian package", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get debian package", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/vnd.debian.binary-package")
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handleMetadata proxies repository metadata files.
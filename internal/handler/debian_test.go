@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -21,3 +23,68 @@ func TestDebianHandler_Routes(t *testing.T) {
 	h := NewDebianHandler(nil, "http://localhost:8080")
 	assertRoutesBasics(t, h.Routes(), "/dists/stable/Release", "/pool/../../../etc/passwd")
 }
+
+func TestDebianHandler_SuiteAllowlist(t *testing.T) {
+	upstreamCalled := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstreamCalled = true
+		_, _ = w.Write([]byte("Suite: stable\n"))
+	}))
+	defer upstream.Close()
+
+	proxy := testProxy()
+	proxy.DebianSuites = []string{"stable", "bookworm"}
+	h := &DebianHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://proxy.local"}
+	routes := h.Routes()
+
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dists/sid/InRelease", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("disallowed suite: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if upstreamCalled {
+		t.Error("upstream was called for a disallowed suite")
+	}
+
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dists/stable/InRelease", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("allowed suite: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !upstreamCalled {
+		t.Error("expected allowed suite to be fetched from upstream")
+	}
+}
+
+func TestDebianHandler_DefaultSuite(t *testing.T) {
+	var upstreamPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		_, _ = w.Write([]byte("Suite: stable\n"))
+	}))
+	defer upstream.Close()
+
+	proxy := testProxy()
+	proxy.DebianSuites = []string{"stable", "bookworm"}
+	h := &DebianHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://proxy.local"}
+	routes := h.Routes()
+
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dists/default/InRelease", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("no default suite: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if upstreamPath != "" {
+		t.Errorf("upstream was called for %s without a default suite", upstreamPath)
+	}
+
+	proxy.DebianDefaultSuite = "bookworm"
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dists/default/main/binary-amd64/Packages.xz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("default suite: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if upstreamPath != "/dists/bookworm/main/binary-amd64/Packages.xz" {
+		t.Errorf("upstream path = %q, want the default suite's", upstreamPath)
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// debugUpstreams are the default upstream base URLs, by ecosystem, that
+// DebugUpstreamHandler resolves paths against.
+var debugUpstreams = map[string]string{
+	"npm":      npmUpstream,
+	"cargo":    cargoUpstream,
+	"gem":      gemUpstream,
+	"golang":   goUpstream,
+	"hex":      hexUpstream,
+	"pub":      pubUpstream,
+	"pypi":     pypiUpstream,
+	"maven":    mavenCentralUpstream,
+	"nuget":    nugetUpstream,
+	"composer": composerUpstream,
+	"conan":    conanUpstream,
+	"conda":    condaUpstream,
+	"cran":     cranUpstream,
+	"julia":    juliaUpstream,
+	"deb":      debianUpstream,
+	"rpm":      defaultRPMUpstream,
+}
+
+// debugUpstreamSkipHeaders are upstream response headers that describe the
+// upstream connection rather than the response, so they aren't copied.
+var debugUpstreamSkipHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Trailer":           true,
+	"Upgrade":           true,
+}
+
+// DebugUpstreamURLHeader names the response header carrying the upstream
+// URL a debug fetch was sent to.
+const DebugUpstreamURLHeader = "X-Proxy-Upstream-URL"
+
+// DebugUpstreamHandler serves GET /api/debug/upstream, which fetches
+// ?path= from an ecosystem's upstream and returns the response exactly as
+// upstream sent it: status, headers and body, with no caching, rewriting or
+// cooldown filtering. Comparing it with the proxied response tells a
+// rewriting bug from an upstream one.
+type DebugUpstreamHandler struct {
+	proxy     *Proxy
+	token     string
+	upstreams map[string]string
+}
+
+// NewDebugUpstreamHandler creates the handler. Requests must carry token as
+// a bearer token. mavenUpstream overrides the Maven Central default when
+// set, as it does for the Maven handler.
+func NewDebugUpstreamHandler(proxy *Proxy, token, mavenUpstream string) *DebugUpstreamHandler {
+	upstreams := make(map[string]string, len(debugUpstreams))
+	for ecosystem, upstream := range debugUpstreams {
+		upstreams[ecosystem] = upstream
+	}
+	if mavenUpstream != "" {
+		upstreams["maven"] = strings.TrimSuffix(mavenUpstream, "/")
+	}
+	return &DebugUpstreamHandler{proxy: proxy, token: token, upstreams: upstreams}
+}
+
+func (h *DebugUpstreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !bearerAuthorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="proxy debug"`)
+		JSONError(w, http.StatusUnauthorized, "debug endpoints require a valid bearer token")
+		return
+	}
+
+	upstreamURL, err := h.upstreamURL(r.URL.Query().Get("ecosystem"), r.URL.Query().Get("path"))
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstreamURL, nil)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to create request")
+		return
+	}
+	// Sending the client's Accept-Encoding keeps the transport from
+	// decompressing, so the body is byte for byte what upstream sent.
+	for _, header := range []string{"Accept", "Accept-Encoding", "User-Agent"} {
+		if v := r.Header.Get(header); v != "" {
+			req.Header.Set(header, v)
+		}
+	}
+
+	h.proxy.Logger.Info("debug upstream fetch", "url", upstreamURL)
+	resp, err := h.proxy.HTTPClient.Do(req)
+	if err != nil {
+		h.proxy.Logger.Warn("debug upstream fetch failed", "url", upstreamURL, "error", err)
+		JSONError(w, http.StatusBadGateway, "upstream request failed: "+err.Error())
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	for name, values := range resp.Header {
+		if debugUpstreamSkipHeaders[name] {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.Header().Set(DebugUpstreamURLHeader, upstreamURL)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// bearerAuthorized reports whether r carries token as its bearer token. An
+// empty token authorizes nothing.
+func bearerAuthorized(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// upstreamURL resolves path against ecosystem's upstream, which may be
+// given by ecosystem name ("golang") or mount point ("go"). Scoped npm
+// packages use their scope's registry. The result must stay on the
+// upstream's host, so the endpoint can't be pointed anywhere else.
+func (h *DebugUpstreamHandler) upstreamURL(ecosystem, path string) (string, error) {
+	if mapped, ok := mountEcosystems[ecosystem]; ok {
+		ecosystem = mapped
+	}
+	base, ok := h.upstreams[ecosystem]
+	if !ok {
+		return "", fmt.Errorf("unsupported ecosystem %q", ecosystem)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("path must start with /")
+	}
+	if ecosystem == "npm" {
+		name := strings.TrimPrefix(path, "/")
+		if decoded, err := url.PathUnescape(name); err == nil {
+			name = decoded
+		}
+		npm := &NPMHandler{proxy: h.proxy, upstreamURL: base}
+		base, _ = npm.upstreamFor(name)
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream %q", base)
+	}
+	target, err := url.Parse(base + path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	if target.Scheme != baseURL.Scheme || target.Host != baseURL.Host {
+		return "", fmt.Errorf("path must stay on the upstream host")
+	}
+	for _, segment := range strings.Split(target.Path, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("path must not contain ..")
+		}
+	}
+	return target.String(), nil
+}
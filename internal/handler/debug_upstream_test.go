@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugUpstreamReturnsRawResponse(t *testing.T) {
+	const packument = `{"name":"lodash","versions":{"4.17.21":{"dist":{"tarball":"https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz"}}}}`
+	var gotPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/vnd.npm.install-v1+json")
+		w.Header().Set("X-Upstream-Only", "yes")
+		_, _ = io.WriteString(w, packument)
+	}))
+	defer upstream.Close()
+
+	h := NewDebugUpstreamHandler(testProxy(), "s3cret", "")
+	h.upstreams["npm"] = upstream.URL
+
+	req := httptest.NewRequest(http.MethodGet, "/api/debug/upstream?ecosystem=npm&path=/lodash", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if gotPath != "/lodash" {
+		t.Errorf("upstream path = %q, want /lodash", gotPath)
+	}
+	if w.Body.String() != packument {
+		t.Errorf("body was changed:\ngot  %s\nwant %s", w.Body.String(), packument)
+	}
+	if got := w.Header().Get("X-Upstream-Only"); got != "yes" {
+		t.Errorf("upstream header not passed through, got %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/vnd.npm.install-v1+json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Header().Get(DebugUpstreamURLHeader); got != upstream.URL+"/lodash" {
+		t.Errorf("%s = %q", DebugUpstreamURLHeader, got)
+	}
+}
+
+func TestDebugUpstreamRequiresToken(t *testing.T) {
+	h := NewDebugUpstreamHandler(testProxy(), "s3cret", "")
+	for _, auth := range []string{"", "Bearer wrong", "s3cret", "Basic czNjcmV0"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/debug/upstream?ecosystem=npm&path=/lodash", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want 401", auth, w.Code)
+		}
+	}
+}
+
+func TestDebugUpstreamURL(t *testing.T) {
+	proxy := testProxy()
+	proxy.SetNPMScopeUpstreams(map[string]string{"@corp": "https://npm.corp.example/"})
+	h := NewDebugUpstreamHandler(proxy, "s3cret", "https://maven.corp.example/releases/")
+
+	tests := []struct {
+		ecosystem, path, want string
+	}{
+		{"npm", "/lodash", "https://registry.npmjs.org/lodash"},
+		{"npm", "/@corp%2fwidget", "https://npm.corp.example/@corp%2fwidget"},
+		{"go", "/golang.org/x/mod/@v/list", "https://proxy.golang.org/golang.org/x/mod/@v/list"},
+		{"golang", "/golang.org/x/mod/@latest", "https://proxy.golang.org/golang.org/x/mod/@latest"},
+		{"maven", "/com/example/lib/maven-metadata.xml", "https://maven.corp.example/releases/com/example/lib/maven-metadata.xml"},
+		{"pypi", "/simple/requests/", "https://pypi.org/simple/requests/"},
+	}
+	for _, tt := range tests {
+		got, err := h.upstreamURL(tt.ecosystem, tt.path)
+		if err != nil {
+			t.Errorf("upstreamURL(%q, %q): %v", tt.ecosystem, tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("upstreamURL(%q, %q) = %q, want %q", tt.ecosystem, tt.path, got, tt.want)
+		}
+	}
+
+	for _, bad := range []struct{ ecosystem, path string }{
+		{"nope", "/lodash"},
+		{"npm", "lodash"},
+		{"npm", ""},
+		{"npm", "@evil.example/lodash"},
+		{"pypi", "/simple/../../etc/passwd"},
+	} {
+		if got, err := h.upstreamURL(bad.ecosystem, bad.path); err == nil {
+			t.Errorf("upstreamURL(%q, %q) = %q, want error", bad.ecosystem, bad.path, got)
+		}
+	}
+}
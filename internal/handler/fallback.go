@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// SetUpstreamFallbacks sets, per ecosystem, the mirrors an artifact download
+// is retried against, in order, when the primary upstream fails. Entries
+// that don't parse as absolute URLs are skipped; config validation rejects
+// them before this is called.
+func (p *Proxy) SetUpstreamFallbacks(fallbacks map[string][]string) {
+	p.upstreamFallbacks = nil
+	for ecosystem, bases := range fallbacks {
+		for _, base := range bases {
+			u, err := url.Parse(strings.TrimSpace(base))
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				continue
+			}
+			u.Path = strings.TrimSuffix(u.Path, "/")
+			if p.upstreamFallbacks == nil {
+				p.upstreamFallbacks = make(map[string][]*url.URL)
+			}
+			p.upstreamFallbacks[ecosystem] = append(p.upstreamFallbacks[ecosystem], u)
+		}
+	}
+}
+
+// fetchArtifact downloads rawURL from upstream. When that fails for any
+// reason other than the artifact not existing, the ecosystem's fallback
+// mirrors are tried in order with the same path. A primary whose circuit
+// breaker is open fails straight away, so its fallbacks are reached without
+// waiting on it.
+//
+// Each attempt gets its own FetchTimeout. The context of the attempt that
+// produced the result is returned so the caller can store the body under
+// the same deadline and tell a timeout from other failures; cancel must
+// always be called. headers are only sent to the primary, since they may
+// carry credentials for it.
+func (p *Proxy) fetchArtifact(ctx context.Context, ecosystem, rawURL string, headers http.Header) (artifact *fetch.Artifact, fetchedURL string, fetchCtx context.Context, cancel context.CancelFunc, err error) {
+	fallbacks := p.upstreamFallbacks[ecosystem]
+	fetchedURL = rawURL
+	for i := 0; ; i++ {
+		if err = p.checkUpstreamLoop(ctx, fetchedURL); err != nil {
+			return nil, fetchedURL, ctx, func() {}, err
+		}
+		fetchCtx, cancel = p.withFetchDeadline(ctx)
+		artifact, err = p.Fetcher.FetchWithHeaders(fetchCtx, fetchedURL, headers)
+		if err == nil || i == len(fallbacks) || !shouldFailover(ctx, err) {
+			return artifact, fetchedURL, fetchCtx, cancel, err
+		}
+		cancel()
+
+		next := applyUpstreamOverride(fallbacks[i], rawURL)
+		p.Logger.Warn("upstream fetch failed, trying fallback",
+			"ecosystem", ecosystem, "url", fetchedURL, "fallback", next, "error", err)
+		metrics.RecordUpstreamError(ecosystem, "failover")
+		fetchedURL = next
+		headers = nil
+	}
+}
+
+// shouldFailover reports whether a failed primary fetch is worth retrying
+// against a fallback. A 404 is an answer rather than an outage, and a
+// request that was cancelled or ran out of time has nobody left to serve.
+func shouldFailover(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, fetch.ErrNotFound)
+}
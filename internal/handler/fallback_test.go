@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+const (
+	npmPrimaryTarball  = "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz"
+	npmFallbackTarball = "https://registry.npmmirror.com/lodash/-/lodash-4.17.21.tgz"
+)
+
+func TestNPMDownloadFailsOverToFallback(t *testing.T) {
+	proxy, db, _, fetcher := setupTestProxy(t)
+	proxy.SetUpstreamFallbacks(map[string][]string{"npm": {"https://registry.npmmirror.com/"}})
+	fetcher.fetchErrByURL = map[string]error{npmPrimaryTarball: fetch.ErrUpstreamDown}
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("tarball from mirror")),
+		ContentType: "application/octet-stream",
+	}
+
+	h := NewNPMHandler(proxy, "http://localhost")
+	req := httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "tarball from mirror" {
+		t.Errorf("body = %q, want the fallback's tarball", w.Body.String())
+	}
+	if fetcher.fetchCount != 2 || fetcher.fetchedURL != npmFallbackTarball {
+		t.Errorf("fetches = %d, last URL = %q; want 2 ending at %s", fetcher.fetchCount, fetcher.fetchedURL, npmFallbackTarball)
+	}
+
+	art, err := db.GetArtifact(purl.MakePURLString("npm", "lodash", "4.17.21"), "lodash-4.17.21.tgz")
+	if err != nil || art == nil {
+		t.Fatalf("GetArtifact = %v, %v", art, err)
+	}
+	if art.UpstreamURL != npmFallbackTarball {
+		t.Errorf("upstream_url = %q, want %q", art.UpstreamURL, npmFallbackTarball)
+	}
+}
+
+func TestFallbackNotTriedOnNotFound(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	proxy.SetUpstreamFallbacks(map[string][]string{"npm": {"https://registry.npmmirror.com"}})
+	fetcher.fetchErrByURL = map[string]error{npmPrimaryTarball: fetch.ErrNotFound}
+
+	_, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+	if !errors.Is(err, ErrUpstreamNotFound) {
+		t.Fatalf("err = %v, want ErrUpstreamNotFound", err)
+	}
+	if fetcher.fetchCount != 1 {
+		t.Errorf("fetches = %d, want 1", fetcher.fetchCount)
+	}
+}
+
+func TestFallbacksExhausted(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	proxy.SetUpstreamFallbacks(map[string][]string{"npm": {"https://mirror-a.example.com", "https://mirror-b.example.com/npm"}})
+	fetcher.fetchErr = fetch.ErrUpstreamDown
+
+	_, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+	if !errors.Is(err, fetch.ErrUpstreamDown) {
+		t.Fatalf("err = %v, want ErrUpstreamDown", err)
+	}
+	if fetcher.fetchCount != 3 {
+		t.Errorf("fetches = %d, want 3", fetcher.fetchCount)
+	}
+	if want := "https://mirror-b.example.com/npm/lodash/-/lodash-4.17.21.tgz"; fetcher.fetchedURL != want {
+		t.Errorf("last URL = %q, want %q", fetcher.fetchedURL, want)
+	}
+}
+
+// hangingFetcher blocks fetches from hang until their context ends and
+// serves everything else, recording the headers each URL was fetched with.
+type hangingFetcher struct {
+	hang    string
+	headers map[string]http.Header
+}
+
+func (f *hangingFetcher) Fetch(ctx context.Context, url string) (*fetch.Artifact, error) {
+	return f.FetchWithHeaders(ctx, url, nil)
+}
+
+func (f *hangingFetcher) FetchWithHeaders(ctx context.Context, url string, headers http.Header) (*fetch.Artifact, error) {
+	f.headers[url] = headers
+	if url == f.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &fetch.Artifact{Body: io.NopCloser(strings.NewReader("from " + url))}, nil
+}
+
+func (f *hangingFetcher) Head(_ context.Context, _ string) (int64, string, error) {
+	return 0, "", nil
+}
+
+func TestFallbackAfterPrimaryTimeout(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	fetcher := &hangingFetcher{hang: npmPrimaryTarball, headers: map[string]http.Header{}}
+	proxy.Fetcher = fetcher
+	proxy.FetchTimeout = 50 * time.Millisecond
+	proxy.SetUpstreamFallbacks(map[string][]string{"npm": {"https://registry.npmmirror.com"}})
+
+	headers := http.Header{"Authorization": {"Bearer primary-token"}}
+	result, err := proxy.GetOrFetchArtifactFromURLWithHeaders(context.Background(),
+		"npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball, headers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(result.Reader)
+	_ = result.Reader.Close()
+
+	if string(body) != "from "+npmFallbackTarball {
+		t.Errorf("body = %q, want the fallback's artifact", body)
+	}
+	if fetcher.headers[npmPrimaryTarball].Get("Authorization") == "" {
+		t.Error("primary should get the request headers")
+	}
+	if got := fetcher.headers[npmFallbackTarball]; got != nil {
+		t.Errorf("fallback got headers %v, want none", got)
+	}
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+)
+
+// defaultFetchQueueTimeout is used when Proxy.FetchQueueTimeout is unset.
+const defaultFetchQueueTimeout = 30 * time.Second
+
+// fetchLimitRetryAfter is the Retry-After hint, in seconds, sent with 503s
+// for downloads that could not get a fetch slot.
+const fetchLimitRetryAfter = "5"
+
+// ErrFetchLimitReached is returned when an upstream download waited
+// FetchQueueTimeout for a free slot without getting one.
+var ErrFetchLimitReached = errors.New("too many concurrent upstream fetches")
+
+// acquireFetchSlot blocks until fewer than MaxConcurrentFetches downloads are
+// running for ecosystem, then returns a function that frees the slot. It gives
+// up with ErrFetchLimitReached after FetchQueueTimeout, or with the context's
+// error if the client goes away first. With no limit set it never blocks.
+func (p *Proxy) acquireFetchSlot(ctx context.Context, ecosystem string) (func(), error) {
+	slots := p.fetchSlots(ecosystem)
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			wait := p.FetchQueueTimeout
+			if wait <= 0 {
+				wait = defaultFetchQueueTimeout
+			}
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				metrics.RecordUpstreamError(ecosystem, "fetch_limit")
+				return nil, ErrFetchLimitReached
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	metrics.IncrementUpstreamFetches(ecosystem)
+	return func() {
+		metrics.DecrementUpstreamFetches(ecosystem)
+		if slots != nil {
+			<-slots
+		}
+	}, nil
+}
+
+// fetchSlots returns the semaphore for ecosystem, creating it on first use.
+// Returns nil when fetches are unlimited.
+func (p *Proxy) fetchSlots(ecosystem string) chan struct{} {
+	if p.MaxConcurrentFetches <= 0 {
+		return nil
+	}
+	p.fetchSlotsMu.Lock()
+	defer p.fetchSlotsMu.Unlock()
+	if p.fetchSlotsByEco == nil {
+		p.fetchSlotsByEco = make(map[string]chan struct{})
+	}
+	slots, ok := p.fetchSlotsByEco[ecosystem]
+	if !ok {
+		slots = make(chan struct{}, p.MaxConcurrentFetches)
+		p.fetchSlotsByEco[ecosystem] = slots
+	}
+	return slots
+}
+
+// writeFetchLimitError answers a request whose download could not get a
+// fetch slot. Retry-After tells clients the condition is temporary.
+func writeFetchLimitError(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", fetchLimitRetryAfter)
+	http.Error(w, "too many concurrent upstream fetches", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/storage"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// blockingFetcher holds every fetch open until release is closed, reporting
+// each start on started.
+type blockingFetcher struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingFetcher() *blockingFetcher {
+	return &blockingFetcher{started: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (f *blockingFetcher) Fetch(ctx context.Context, url string) (*fetch.Artifact, error) {
+	return f.FetchWithHeaders(ctx, url, nil)
+}
+
+func (f *blockingFetcher) FetchWithHeaders(ctx context.Context, url string, _ http.Header) (*fetch.Artifact, error) {
+	f.started <- url
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &fetch.Artifact{Body: io.NopCloser(strings.NewReader("data")), ContentType: "application/octet-stream"}, nil
+}
+
+func (f *blockingFetcher) Head(_ context.Context, _ string) (int64, string, error) {
+	return 0, "", nil
+}
+
+// setupLimitedProxy returns a proxy backed by filesystem storage, which is
+// safe for the concurrent fetches these tests start.
+func setupLimitedProxy(t *testing.T, limit int, wait time.Duration) (*Proxy, *blockingFetcher) {
+	t.Helper()
+	proxy, _, _, _ := setupTestProxy(t)
+	store, err := storage.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+	fetcher := newBlockingFetcher()
+	proxy.Storage = store
+	proxy.Fetcher = fetcher
+	proxy.MaxConcurrentFetches = limit
+	proxy.FetchQueueTimeout = wait
+	return proxy, fetcher
+}
+
+func fetchAsync(p *Proxy, ecosystem, name string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		result, err := p.GetOrFetchArtifactFromURL(context.Background(), ecosystem, name, "1.0.0",
+			name+".tgz", "https://upstream.example/"+ecosystem+"/"+name)
+		if result != nil && result.Reader != nil {
+			_ = result.Reader.Close()
+		}
+		done <- err
+	}()
+	return done
+}
+
+func waitStarted(t *testing.T, f *blockingFetcher) string {
+	t.Helper()
+	select {
+	case url := <-f.started:
+		return url
+	case <-time.After(2 * time.Second):
+		t.Fatal("fetch did not start")
+		return ""
+	}
+}
+
+func TestFetchLimit_BlocksUntilSlotFrees(t *testing.T) {
+	proxy, fetcher := setupLimitedProxy(t, 2, 5*time.Second)
+
+	first := fetchAsync(proxy, "npm", "a")
+	second := fetchAsync(proxy, "npm", "b")
+	waitStarted(t, fetcher)
+	waitStarted(t, fetcher)
+
+	third := fetchAsync(proxy, "npm", "c")
+	select {
+	case url := <-fetcher.started:
+		t.Fatalf("third fetch %s started while both slots were taken", url)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Another ecosystem has its own slots.
+	other := fetchAsync(proxy, "pypi", "d")
+	if url := waitStarted(t, fetcher); !strings.Contains(url, "/pypi/") {
+		t.Fatalf("started %s, want the pypi fetch", url)
+	}
+
+	// Releasing lets every held fetch finish, freeing a slot for the third.
+	close(fetcher.release)
+	if url := waitStarted(t, fetcher); !strings.HasSuffix(url, "/c") {
+		t.Fatalf("started %s, want the queued fetch", url)
+	}
+	for _, done := range []<-chan error{first, second, third, other} {
+		if err := <-done; err != nil {
+			t.Errorf("fetch failed: %v", err)
+		}
+	}
+}
+
+func TestFetchLimit_TimesOut(t *testing.T) {
+	proxy, fetcher := setupLimitedProxy(t, 1, 20*time.Millisecond)
+	defer close(fetcher.release)
+
+	first := fetchAsync(proxy, "npm", "a")
+	waitStarted(t, fetcher)
+
+	_, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "b", "1.0.0", "b.tgz", "https://upstream.example/npm/b")
+	if !errors.Is(err, ErrFetchLimitReached) {
+		t.Fatalf("err = %v, want ErrFetchLimitReached", err)
+	}
+
+	fetcher.release <- struct{}{}
+	if err := <-first; err != nil {
+		t.Errorf("first fetch failed: %v", err)
+	}
+}
+
+func TestFetchLimit_HandlerReturns503(t *testing.T) {
+	proxy, fetcher := setupLimitedProxy(t, 1, 20*time.Millisecond)
+	defer close(fetcher.release)
+
+	h := NewPyPIHandler(proxy, "http://localhost")
+	first := fetchAsync(proxy, "pypi", "held")
+	waitStarted(t, fetcher)
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/packages/packages/ab/cd/ef0123456789/requests-2.31.0-py3-none-any.whl", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	fetcher.release <- struct{}{}
+	<-first
+}
+
+func TestFetchLimit_UnlimitedByDefault(t *testing.T) {
+	proxy, fetcher := setupLimitedProxy(t, 0, 0)
+
+	var done []<-chan error
+	for _, name := range []string{"a", "b", "c", "d"} {
+		done = append(done, fetchAsync(proxy, "npm", name))
+	}
+	for range done {
+		waitStarted(t, fetcher)
+	}
+	close(fetcher.release)
+	for _, d := range done {
+		if err := <-d; err != nil {
+			t.Errorf("fetch failed: %v", err)
+		}
+	}
+}
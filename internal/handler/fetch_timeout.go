@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrUpstreamTimeout is returned when an upstream fetch ran past
+// FetchTimeout. Handlers answer it with 504.
+var ErrUpstreamTimeout = errors.New("upstream fetch timed out")
+
+// withFetchDeadline bounds an upstream fetch by FetchTimeout. The deadline
+// covers the whole exchange, including reading the body into storage, so a
+// slow upstream can't hold a fetch slot for the server's full write window.
+// With no timeout set the context is returned unchanged.
+func (p *Proxy) withFetchDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.FetchTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.FetchTimeout)
+}
+
+// fetchTimedOut reports whether fetchCtx, derived from ctx by
+// withFetchDeadline, hit its own deadline. A client that disconnected or a
+// request that ran out of time on its own doesn't count.
+func fetchTimedOut(ctx, fetchCtx context.Context) bool {
+	return ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded)
+}
+
+// writeUpstreamTimeoutError answers a request whose upstream fetch ran past
+// FetchTimeout.
+func writeUpstreamTimeoutError(w http.ResponseWriter) {
+	http.Error(w, "upstream fetch timed out", http.StatusGatewayTimeout)
+}
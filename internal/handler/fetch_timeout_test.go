@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchTimeout_HandlerReturns504(t *testing.T) {
+	proxy, fetcher := setupLimitedProxy(t, 1, 2*time.Second)
+	proxy.FetchTimeout = 50 * time.Millisecond
+	defer close(fetcher.release)
+
+	h := NewPyPIHandler(proxy, "http://localhost")
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/packages/packages/ab/cd/ef0123456789/requests-2.31.0-py3-none-any.whl", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	waitStarted(t, fetcher)
+
+	// The timed-out fetch gave its slot back, so the next one starts
+	// without waiting on the queue.
+	next := fetchAsync(proxy, "pypi", "next")
+	if url := waitStarted(t, fetcher); !strings.HasSuffix(url, "/next") {
+		t.Fatalf("started %s, want the next fetch", url)
+	}
+	if err := <-next; !errors.Is(err, ErrUpstreamTimeout) {
+		t.Errorf("err = %v, want ErrUpstreamTimeout", err)
+	}
+}
+
+func TestFetchTimeout_ClientCancelIsNotTimeout(t *testing.T) {
+	proxy, fetcher := setupLimitedProxy(t, 0, 0)
+	proxy.FetchTimeout = time.Minute
+	defer close(fetcher.release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := proxy.GetOrFetchArtifactFromURL(ctx, "npm", "a", "1.0.0", "a.tgz", "https://upstream.example/npm/a")
+		done <- err
+	}()
+	waitStarted(t, fetcher)
+	cancel()
+	if err := <-done; err == nil || errors.Is(err, ErrUpstreamTimeout) {
+		t.Errorf("err = %v, want a cancellation error", err)
+	}
+}
+
+func TestFetchTimeout_ContainerTagsReturns504(t *testing.T) {
+	stall := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"token":"tok"}`))
+			return
+		}
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(stall)
+
+	reg := &fakeRegistry{server: upstream, requests: map[string]int{}}
+	h, _ := newIndexTestHandler(t, reg)
+	h.proxy.FetchTimeout = 50 * time.Millisecond
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/library/app/tags/list", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusGatewayTimeout, w.Body.String())
+	}
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +13,12 @@ import (
 
 const (
 	gemUpstream = "https://rubygems.org"
+
+	// gemMarshalContentType is served for the specs indexes and quick
+	// gemspecs. RubyGems compresses these files itself (gzip and zlib), so
+	// they go out as opaque bytes without a Content-Encoding that would make
+	// an HTTP client inflate them before RubyGems does.
+	gemMarshalContentType = "application/octet-stream"
 )
 
 // GemHandler handles RubyGems registry protocol requests.
@@ -38,16 +45,16 @@ func (h *GemHandler) Routes() http.Handler {
 	mux.HandleFunc("GET /gems/{filename}", h.handleDownload)
 
 	// Specs indexes (compressed Ruby Marshal format)
-	mux.HandleFunc("GET /specs.4.8.gz", h.proxyCached)
-	mux.HandleFunc("GET /latest_specs.4.8.gz", h.proxyCached)
-	mux.HandleFunc("GET /prerelease_specs.4.8.gz", h.proxyCached)
+	mux.HandleFunc("GET /specs.4.8.gz", h.handleSpecsIndex)
+	mux.HandleFunc("GET /latest_specs.4.8.gz", h.handleSpecsIndex)
+	mux.HandleFunc("GET /prerelease_specs.4.8.gz", h.handleSpecsIndex)
 
 	// Compact index (bundler 2.x+)
 	mux.HandleFunc("GET /versions", h.proxyCached)
 	mux.HandleFunc("GET /info/{name}", h.handleCompactIndex)
 
 	// Quick index
-	mux.HandleFunc("GET /quick/Marshal.4.8/{filename}", h.proxyUpstream)
+	mux.HandleFunc("GET /quick/Marshal.4.8/{filename}", h.handleQuickSpec)
 
 	// API endpoints - use catch-all since {name}.json pattern isn't allowed
 	mux.HandleFunc("GET /api/v1/gems/", h.proxyUpstream)
@@ -64,6 +71,13 @@ func (h *GemHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if name := trimLatestFilename(filename, ".gem"); name != "" {
+		h.proxy.redirectToLatest(w, r, "gem", name, func(version string) string {
+			return fmt.Sprintf("%s/gem/gems/%s-%s.gem", requestBaseURL(r, h.proxyURL), name, version)
+		})
+		return
+	}
+
 	// Extract name and version from filename (e.g., "rails-7.1.0.gem")
 	name, version := h.parseGemFilename(filename)
 	if name == "" || version == "" {
@@ -74,14 +88,16 @@ func (h *GemHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("gem download request",
 		"name", name, "version", version, "filename", filename)
 
-	result, err := h.proxy.GetOrFetchArtifact(r.Context(), "gem", name, version, filename)
+	result, err := h.proxy.GetOrFetchArtifact(expectBinary(r.Context()), "gem", name, version, filename)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch gem", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch gem", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // parseGemFilename extracts name and version from a gem filename.
@@ -101,6 +117,53 @@ func (h *GemHandler) parseGemFilename(filename string) (name, version string) {
 	return "", ""
 }
 
+// handleSpecsIndex serves one of the specs.4.8.gz indexes. They are rebuilt
+// on every push upstream, so with GemSpecsTTL set they are cached for that
+// long and then revalidated, whether or not metadata caching is enabled in
+// general.
+func (h *GemHandler) handleSpecsIndex(w http.ResponseWriter, r *http.Request) {
+	policy := metadataCachePolicy{enabled: h.proxy.CacheMetadata, ttl: h.proxy.MetadataTTLFor("gem", strings.TrimPrefix(r.URL.Path, "/"))}
+	if h.proxy.GemSpecsTTL > 0 {
+		policy = metadataCachePolicy{enabled: true, ttl: h.proxy.GemSpecsTTL}
+	}
+	h.serveMarshal(w, r, policy)
+}
+
+// handleQuickSpec serves a single gemspec from the quick index, e.g.
+// quick/Marshal.4.8/rails-7.1.0.gemspec.rz. RubyGems never lets a version be
+// pushed twice, so once cached the file is served without asking upstream
+// again.
+func (h *GemHandler) handleQuickSpec(w http.ResponseWriter, r *http.Request) {
+	base, ok := strings.CutSuffix(r.PathValue("filename"), ".gemspec.rz")
+	if !ok {
+		http.Error(w, "invalid filename", http.StatusBadRequest)
+		return
+	}
+	if name, version := h.parseGemFilename(base + ".gem"); name == "" || version == "" {
+		http.Error(w, "could not parse gemspec filename", http.StatusBadRequest)
+		return
+	}
+	h.serveMarshal(w, r, metadataCachePolicy{enabled: true, ttl: immutableMaxAge})
+}
+
+// serveMarshal fetches one of the compressed Marshal files through the
+// metadata cache and serves it as-is.
+func (h *GemHandler) serveMarshal(w http.ResponseWriter, r *http.Request, policy metadataCachePolicy) {
+	cacheKey := strings.TrimPrefix(r.URL.Path, "/")
+	setMetadataMaxAge(w, policy.ttl)
+	body, _, err := h.proxy.fetchOrCacheMetadata(r.Context(), "gem", cacheKey, h.upstreamURL+r.URL.Path, policy, "*/*")
+	if err != nil {
+		if errors.Is(err, ErrUpstreamNotFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		h.proxy.Logger.Error("failed to fetch gem index", "path", r.URL.Path, "error", err)
+		http.Error(w, "failed to fetch from upstream", http.StatusBadGateway)
+		return
+	}
+	h.proxy.writeMetadataCachedResponse(w, r, "gem", cacheKey, body, gemMarshalContentType)
+}
+
 // handleCompactIndex serves the compact index for a gem, filtering versions
 // based on cooldown when enabled.
 func (h *GemHandler) handleCompactIndex(w http.ResponseWriter, r *http.Request) {
@@ -126,7 +189,7 @@ func (h *GemHandler) handleCompactIndex(w http.ResponseWriter, r *http.Request)
 	defer func() { _ = indexResp.Body.Close() }()
 
 	if indexResp.StatusCode != http.StatusOK {
-		copyResponseHeaders(w, indexResp.Header)
+		h.proxy.copyUpstreamHeaders(w.Header(), indexResp.Header)
 		w.WriteHeader(indexResp.StatusCode)
 		_, _ = io.Copy(w, indexResp.Body)
 		return
@@ -134,7 +197,7 @@ func (h *GemHandler) handleCompactIndex(w http.ResponseWriter, r *http.Request)
 
 	if filteredVersions == nil {
 		h.proxy.Logger.Warn("failed to fetch version timestamps, proxying unfiltered", "name", name)
-		copyResponseHeaders(w, indexResp.Header)
+		h.proxy.copyUpstreamHeaders(w.Header(), indexResp.Header)
 		w.WriteHeader(http.StatusOK)
 		_, _ = io.Copy(w, indexResp.Body)
 		return
@@ -190,14 +253,8 @@ func (h *GemHandler) fetchCompactIndex(r *http.Request, name string) (*http.Resp
 
 // writeFilteredIndex writes the compact index response with cooldown-filtered versions removed.
 func (h *GemHandler) writeFilteredIndex(w http.ResponseWriter, resp *http.Response, name string, filtered map[string]bool) {
-	for k, vv := range resp.Header {
-		if strings.EqualFold(k, "Content-Length") {
-			continue // length will change after filtering
-		}
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	// Content-Length changes after filtering.
+	h.proxy.copyUpstreamHeaders(w.Header(), resp.Header, "Content-Length")
 	w.WriteHeader(http.StatusOK)
 
 	scanner := bufio.NewScanner(resp.Body)
@@ -224,15 +281,6 @@ func (h *GemHandler) writeFilteredIndex(w http.ResponseWriter, resp *http.Respon
 	}
 }
 
-// copyResponseHeaders copies HTTP headers from a response to a writer.
-func copyResponseHeaders(w http.ResponseWriter, headers http.Header) {
-	for k, vv := range headers {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
-}
-
 // gemVersion represents a version entry from the RubyGems versions API.
 type gemVersion struct {
 	Number    string `json:"number"`
@@ -324,11 +372,7 @@ func (h *GemHandler) proxyUpstream(w http.ResponseWriter, r *http.Request) {
 	defer func() { _ = resp.Body.Close() }()
 
 	// Copy response headers
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	h.proxy.copyUpstreamHeaders(w.Header(), resp.Header)
 
 	w.WriteHeader(resp.StatusCode)
 	_, _ = io.Copy(w, resp.Body)
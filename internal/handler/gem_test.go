@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +14,7 @@ import (
 	"time"
 
 	"github.com/git-pkgs/cooldown"
+	"github.com/git-pkgs/registries/fetch"
 )
 
 func TestGemParseFilename(t *testing.T) {
@@ -250,3 +254,147 @@ func TestGemFetchFilteredVersions(t *testing.T) {
 
 	_ = fmt.Sprintf // silence unused import
 }
+
+func TestGemHandler_DownloadCachesArtifact(t *testing.T) {
+	proxy, db, _, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("fetched gem")),
+		ContentType: "application/octet-stream",
+	}
+
+	srv := httptest.NewServer(NewGemHandler(proxy, "http://localhost").Routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/gems/aws-sdk-s3-1.142.0.gem")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "fetched gem" {
+		t.Fatalf("status = %d, body = %q", resp.StatusCode, body)
+	}
+
+	artifact, err := db.GetArtifact("pkg:gem/aws-sdk-s3@1.142.0", "aws-sdk-s3-1.142.0.gem")
+	if err != nil || artifact == nil {
+		t.Fatalf("artifact not recorded: %v", err)
+	}
+	if !artifact.StoragePath.Valid {
+		t.Error("artifact recorded without a storage path")
+	}
+
+	resp, err = http.Get(srv.URL + "/gems/aws-sdk-s3-1.142.0.gem")
+	if err != nil {
+		t.Fatalf("second request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if fetcher.fetchCount != 1 {
+		t.Errorf("fetch count = %d, want 1 (second download served from cache)", fetcher.fetchCount)
+	}
+}
+
+func TestGemHandler_SpecsIndexCachedCompressed(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte("marshalled specs"))
+	_ = gz.Close()
+	specs := buf.Bytes()
+
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/specs.4.8.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		hits++
+		_, _ = w.Write(specs)
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.GemSpecsTTL = 5 * time.Minute
+	h := &GemHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://localhost"}
+
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	for i := range 2 {
+		resp, err := http.Get(srv.URL + "/specs.4.8.gz")
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != gemMarshalContentType {
+			t.Errorf("request %d: Content-Type = %q, want %q", i, ct, gemMarshalContentType)
+		}
+		if resp.Uncompressed || resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("request %d: index sent with a Content-Encoding", i)
+		}
+		if !bytes.Equal(body, specs) {
+			t.Fatalf("request %d: body is not the upstream gzip file", i)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("request %d: body is not gzip: %v", i, err)
+		}
+		if plain, _ := io.ReadAll(zr); string(plain) != "marshalled specs" {
+			t.Errorf("request %d: decompressed body = %q", i, plain)
+		}
+	}
+
+	if hits != 1 {
+		t.Errorf("upstream hits = %d, want 1 within the specs TTL", hits)
+	}
+}
+
+func TestGemHandler_QuickSpecCached(t *testing.T) {
+	up := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-deflate")
+		_, _ = w.Write([]byte("deflated gemspec"))
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	h := &GemHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://localhost"}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp, string(body)
+	}
+
+	resp, body := get("/quick/Marshal.4.8/rails-7.1.0.gemspec.rz")
+	if resp.StatusCode != http.StatusOK || body != "deflated gemspec" {
+		t.Fatalf("status = %d, body = %q", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != gemMarshalContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, gemMarshalContentType)
+	}
+
+	up = false
+	resp, body = get("/quick/Marshal.4.8/rails-7.1.0.gemspec.rz")
+	if resp.StatusCode != http.StatusOK || body != "deflated gemspec" {
+		t.Errorf("offline: status = %d, body = %q; want cached gemspec", resp.StatusCode, body)
+	}
+
+	if resp, _ := get("/quick/Marshal.4.8/rails.gemspec.rz"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unversioned gemspec: status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-
-	"github.com/git-pkgs/registries/fetch"
 )
 
 const (
@@ -61,7 +59,7 @@ func (h *GoHandler) handleRequest(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case rest == "list":
 			// GET /{module}/@v/list - list versions
-			h.proxyCached(w, r, decodedMod+"/@v/list")
+			h.handleList(w, r, decodedMod)
 
 		case strings.HasSuffix(rest, ".info"):
 			// GET /{module}/@v/{version}.info - version metadata
@@ -101,18 +99,107 @@ func (h *GoHandler) handleDownload(w http.ResponseWriter, r *http.Request, modul
 	h.proxy.Logger.Info("go module download request",
 		"module", decodedModule, "version", version)
 
-	result, err := h.proxy.GetOrFetchArtifact(r.Context(), "golang", decodedModule, version, filename)
+	result, err := h.proxy.GetOrFetchArtifact(expectBinary(r.Context()), "golang", decodedModule, version, filename)
 	if err != nil {
-		if errors.Is(err, fetch.ErrNotFound) {
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch module", http.StatusBadGateway)
+		}
+		return
+	}
+
+	h.proxy.ServeArtifact(w, result)
+}
+
+// handleList serves the tagged versions of a module, one per line. Lists
+// change whenever a version is tagged, so with GoListTTL set they are cached
+// for that long and then revalidated, whether or not metadata caching is
+// enabled in general. A module with no tagged versions gets an empty 200,
+// which is what the go command expects.
+func (h *GoHandler) handleList(w http.ResponseWriter, r *http.Request, module string) {
+	cacheKey := module + "/@v/list"
+	policy := metadataCachePolicy{enabled: h.proxy.CacheMetadata, ttl: h.proxy.MetadataTTLFor("golang", cacheKey)}
+	if h.proxy.GoListTTL > 0 {
+		policy.enabled = true
+		if _, overridden := h.proxy.MetadataTTLOverrides["golang/"+module]; !overridden {
+			policy.ttl = h.proxy.GoListTTL
+		}
+	}
+
+	setMetadataMaxAge(w, policy.ttl)
+	body, _, err := h.proxy.fetchOrCacheMetadata(r.Context(), "golang", cacheKey, h.upstreamURL+r.URL.Path, policy, "text/plain")
+	if err != nil {
+		if errors.Is(err, ErrUpstreamNotFound) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch module", http.StatusBadGateway)
+		h.proxy.Logger.Error("failed to fetch go version list", "module", module, "error", err)
+		http.Error(w, "failed to fetch from upstream", http.StatusBadGateway)
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.writeMetadataCachedResponse(w, r, "golang", cacheKey, filterGoVersionList(module, body), "text/plain; charset=utf-8")
+}
+
+// filterGoVersionList normalizes an @v/list body to one version per line,
+// keeping only versions that belong to module's major version: "v2." and up
+// for a /v2 module path, and v0, v1 or +incompatible versions otherwise.
+func filterGoVersionList(module string, body []byte) []byte {
+	major := goPathMajor(module)
+	var b strings.Builder
+	for line := range strings.SplitSeq(string(body), "\n") {
+		version := strings.TrimSpace(line)
+		if !strings.HasPrefix(version, "v") || !goVersionMatchesMajor(version, major) {
+			continue
+		}
+		b.WriteString(version)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// goPathMajor returns the major version suffix of a module path, such as
+// "v2" for example.com/mod/v2 or "v3" for gopkg.in/yaml.v3, or "" when the
+// path has none.
+func goPathMajor(module string) string {
+	if strings.HasPrefix(module, "gopkg.in/") {
+		if idx := strings.LastIndex(module, ".v"); idx >= 0 && isGoMajor(module[idx+1:]) {
+			return module[idx+1:]
+		}
+		return ""
+	}
+	if last := lastComponent(module); last != module && isGoMajor(last) && last != "v0" && last != "v1" {
+		return last
+	}
+	return ""
+}
+
+// isGoMajor reports whether s is a major version element such as "v2".
+func isGoMajor(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || (s[1] == '0' && len(s) > 2) {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// goVersionMatchesMajor reports whether version can be a version of a
+// module path whose major version suffix is major.
+func goVersionMatchesMajor(version, major string) bool {
+	switch major {
+	case "":
+		return strings.HasPrefix(version, "v0.") || strings.HasPrefix(version, "v1.") ||
+			strings.HasSuffix(version, "+incompatible")
+	case "v0", "v1":
+		// gopkg.in/pkg.v1 serves v1.x.y, and v0.x.y before a v1 tag.
+		return strings.HasPrefix(version, "v0.") || strings.HasPrefix(version, "v1.")
+	default:
+		return strings.HasPrefix(version, major+".") && !strings.HasSuffix(version, "+incompatible")
+	}
 }
 
 // proxyUpstream forwards a request to proxy.golang.org without caching.
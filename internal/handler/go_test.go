@@ -2,9 +2,11 @@ package handler
 
 import (
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/git-pkgs/registries/fetch"
 )
@@ -44,6 +46,87 @@ func TestGoModuleDownloadUpstreamErrors(t *testing.T) {
 	}
 }
 
+func TestGoVersionListMajorVersion(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/github.com/!user/repo/v2/@v/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		hits++
+		_, _ = io.WriteString(w, "v2.0.0\nv2.1.0\r\n\nv1.5.0\nv3.0.0+incompatible\n")
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.GoListTTL = time.Minute
+	h := &GoHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://localhost"}
+
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/github.com/!user/repo/v2/@v/list", nil)
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, resp.Code)
+		}
+		if got, want := resp.Body.String(), "v2.0.0\nv2.1.0\n"; got != want {
+			t.Errorf("request %d: body = %q, want %q", i, got, want)
+		}
+		if ct := resp.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("request %d: Content-Type = %q", i, ct)
+		}
+	}
+
+	if hits != 1 {
+		t.Errorf("upstream hits = %d, want 1 within the list TTL", hits)
+	}
+}
+
+func TestGoVersionListEmpty(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.GoListTTL = time.Minute
+	h := &GoHandler{proxy: proxy, upstreamURL: upstream.URL, proxyURL: "http://localhost"}
+
+	req := httptest.NewRequest(http.MethodGet, "/example.com/untagged/@v/list", nil)
+	resp := httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.Code)
+	}
+	if resp.Body.Len() != 0 {
+		t.Errorf("body = %q, want empty", resp.Body.String())
+	}
+}
+
+func TestFilterGoVersionList(t *testing.T) {
+	tests := []struct {
+		module string
+		body   string
+		want   string
+	}{
+		{"example.com/mod", "v1.0.0\nv0.1.0\nv2.0.0+incompatible\nv2.0.0\n", "v1.0.0\nv0.1.0\nv2.0.0+incompatible\n"},
+		{"example.com/mod/v3", "v3.0.0\nv3.1.0-rc.1\nv2.0.0\n", "v3.0.0\nv3.1.0-rc.1\n"},
+		{"example.com/nested/pkg/sub", "v1.2.3\n", "v1.2.3\n"},
+		{"gopkg.in/yaml.v3", "v3.0.1\nv2.4.0\n", "v3.0.1\n"},
+		{"example.com/mod", "", ""},
+		{"example.com/mod", "\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := string(filterGoVersionList(tt.module, []byte(tt.body))); got != tt.want {
+			t.Errorf("filterGoVersionList(%q, %q) = %q, want %q", tt.module, tt.body, got, tt.want)
+		}
+	}
+}
+
 func TestDecodeGoModule(t *testing.T) {
 	tests := []struct {
 		encoded string
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"regexp"
@@ -55,6 +56,7 @@ func (h *GradleBuildCacheHandler) Routes() http.Handler {
 
 		if r.Method == http.MethodPut {
 			if h.proxy.GradleReadOnly {
+				h.proxy.RecordPolicyEvent(r, "gradle", key, "", PolicyDecisionDeny, "gradle build cache is read-only")
 				http.Error(w, "gradle build cache is read-only", http.StatusMethodNotAllowed)
 				return
 			}
@@ -88,7 +90,7 @@ func (h *GradleBuildCacheHandler) parseCacheKey(urlPath string) (string, int) {
 }
 
 func (h *GradleBuildCacheHandler) cacheStoragePath(key string) string {
-	return gradleBuildCacheStorageRoot + "/" + key
+	return h.proxy.storageKey(gradleBuildCacheStorageRoot + "/" + key)
 }
 
 func (h *GradleBuildCacheHandler) handleGetOrHead(w http.ResponseWriter, r *http.Request, key string) {
@@ -161,6 +163,8 @@ func (h *GradleBuildCacheHandler) handlePut(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		var maxBytesErr *http.MaxBytesError
 		if errors.As(err, &maxBytesErr) {
+			h.proxy.RecordPolicyEvent(r, "gradle", key, "", PolicyDecisionDeny,
+				fmt.Sprintf("cache entry exceeds max upload size of %d bytes", maxUploadSize))
 			http.Error(w, "cache entry too large", http.StatusRequestEntityTooLarge)
 			return
 		}
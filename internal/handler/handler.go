@@ -2,7 +2,6 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"errors"
@@ -10,17 +9,22 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/git-pkgs/cooldown"
 	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/enrichment"
 	"github.com/git-pkgs/proxy/internal/metrics"
 	"github.com/git-pkgs/proxy/internal/storage"
 	"github.com/git-pkgs/purl"
 	"github.com/git-pkgs/registries/fetch"
+	"golang.org/x/sync/singleflight"
 )
 
 // containsPathTraversal returns true if the path contains ".." segments
@@ -51,7 +55,7 @@ const defaultHTTPTimeout = 30 * time.Second
 // canonicalPackagePURL returns a versionless PURL in canonical form so cooldown
 // lookups match keys produced by config.CooldownConfig.NormalizedPackages.
 func canonicalPackagePURL(ecosystem, name string) string {
-	p := purl.MakePURL(ecosystem, name, "")
+	p := purl.MakePURL(ecosystem, Canonicalize(ecosystem, name), "")
 	_ = p.Normalize()
 	return p.String()
 }
@@ -70,10 +74,7 @@ var ErrMetadataTooLarge = errors.New("metadata response exceeds size limit")
 // from unexpectedly large responses. Returns ErrMetadataTooLarge if the response
 // is truncated by the limit.
 func (p *Proxy) ReadMetadata(r io.Reader) ([]byte, error) {
-	limit := p.MetadataMaxSize
-	if limit <= 0 {
-		limit = defaultMetadataMaxSize
-	}
+	limit := p.metadataMaxSize()
 	data, err := io.ReadAll(io.LimitReader(r, limit+1))
 	if err != nil {
 		return nil, err
@@ -84,17 +85,49 @@ func (p *Proxy) ReadMetadata(r io.Reader) ([]byte, error) {
 	return data, nil
 }
 
+// metadataMaxSize returns MetadataMaxSize, or the default when it is unset.
+func (p *Proxy) metadataMaxSize() int64 {
+	if p.MetadataMaxSize <= 0 {
+		return defaultMetadataMaxSize
+	}
+	return p.MetadataMaxSize
+}
+
 // Proxy provides shared functionality for protocol handlers.
 type Proxy struct {
-	DB                  *database.DB
-	Storage             storage.Storage
-	Fetcher             fetch.FetcherInterface
-	Resolver            *fetch.Resolver
-	Logger              *slog.Logger
-	Cooldown            *cooldown.Config
-	CacheMetadata       bool
-	MetadataTTL         time.Duration
-	MetadataMaxSize     int64
+	DB       *database.DB
+	Storage  storage.Storage
+	Fetcher  fetch.FetcherInterface
+	Resolver *fetch.Resolver
+	Logger   *slog.Logger
+	Cooldown *cooldown.Config
+	// Quarantine, when set, refuses downloads of versions published
+	// upstream too recently.
+	Quarantine      *Quarantine
+	CacheMetadata   bool
+	MetadataTTL     time.Duration
+	MetadataMaxSize int64
+	// MetadataTTLOverrides replaces MetadataTTL for specific packages,
+	// keyed by "ecosystem/name".
+	MetadataTTLOverrides map[string]time.Duration
+	// CargoIndexTTL, when positive, caches cargo sparse index files for this
+	// long even if CacheMetadata is off.
+	CargoIndexTTL time.Duration
+	// GemSpecsTTL, when positive, caches the gem specs.4.8.gz indexes for
+	// this long even if CacheMetadata is off.
+	GemSpecsTTL time.Duration
+	// GoListTTL, when positive, caches Go @v/list responses for this long
+	// even if CacheMetadata is off.
+	GoListTTL time.Duration
+	// MaxFilenameLength caps the filename part of artifact storage keys;
+	// see storage.SanitizeFilename. Zero uses the storage default.
+	MaxFilenameLength int
+	// StoragePrefix namespaces every key the proxy writes to storage, so
+	// instances sharing a bucket don't collide. See storage.PrefixedPath.
+	StoragePrefix string
+	// ServeBufferSize is the copy buffer used when streaming artifacts to
+	// clients. Defaults to 32KB when zero.
+	ServeBufferSize     int
 	GradleReadOnly      bool
 	GradleMaxUploadSize int64
 	DirectServe         bool
@@ -104,6 +137,159 @@ type Proxy struct {
 	// storage at an internal one.
 	DirectServeBaseURL string
 	HTTPClient         *http.Client
+	// ContainerPrefetchIndex caches every platform manifest and blob
+	// referenced by an OCI image index when the index is fetched.
+	ContainerPrefetchIndex bool
+	// CondaChannels restricts proxied Conda channels; empty allows all.
+	// CondaDefaultChannel serves requests whose path has no channel.
+	CondaChannels       []string
+	CondaDefaultChannel string
+	// DebianSuites restricts which dists/ suites are proxied; empty allows all.
+	DebianSuites []string
+
+	// DebianDefaultSuite serves requests for dists/default/.
+	DebianDefaultSuite string
+	// NPMPublish accepts npm publish and deprecate for packages not proxied
+	// from upstream, from clients sending NPMPublishToken as a bearer token.
+	// NPMMaxPublishSize caps a publish body; 100MB when zero.
+	NPMPublish        bool
+	NPMPublishToken   string
+	NPMMaxPublishSize int64
+	// NPMLocalNames lists names and scopes (e.g. "@mycompany") that may be
+	// published without first checking that upstream has no such package.
+	NPMLocalNames []string
+	// NPMUnpublish additionally accepts npm unpublish for packages
+	// published here. It has no effect unless NPMPublish is set.
+	NPMUnpublish bool
+	// PolicyEventsMax caps the number of rows kept in the policy_events
+	// audit table. Defaults to 10000 when zero.
+	PolicyEventsMax int
+	// UsageLogMax caps the number of rows kept in the access_log table.
+	// Defaults to 1000000 when zero.
+	UsageLogMax int
+	// TrustedHosts adds per-ecosystem hostnames to defaultTrustedHosts.
+	// Only URLs on trusted hosts are rewritten to point at this proxy.
+	TrustedHosts map[string][]string
+	// AllowedArtifacts lists, per ecosystem, the artifact filenames the
+	// proxy will fetch and serve: ".ext" suffixes or path.Match globs.
+	// Ecosystems without an entry are unrestricted.
+	AllowedArtifacts map[string][]string
+	// IndexOnly lists ecosystems whose artifacts are never cached: requests
+	// for them are redirected to the upstream download URL while metadata
+	// is still proxied and rewritten.
+	IndexOnly map[string]bool
+	// NotFoundTTL is how long an upstream 404 for an artifact is remembered
+	// so repeated requests for a missing version don't re-hit upstream.
+	// Zero disables negative caching.
+	NotFoundTTL time.Duration
+	// ResolveCacheTTL is how long the download URL resolved for a version
+	// is reused before the Resolver is asked again. Zero disables the
+	// resolver cache.
+	ResolveCacheTTL time.Duration
+	// FailClosedOnDBError makes a download fail with ErrCacheUnavailable
+	// when the fetched artifact can't be recorded in the database, rather
+	// than serving it without caching it.
+	FailClosedOnDBError bool
+	// Enrichment answers vulnerability queries for endpoints such as npm
+	// audit. Those endpoints are unavailable when nil.
+	Enrichment *enrichment.Service
+	// CacheTrace adds an X-Cache-Lookup header to artifact responses
+	// recording each stage of the cache lookup.
+	CacheTrace bool
+	// MaxConcurrentFetches caps simultaneous upstream downloads per
+	// ecosystem. Zero means unlimited.
+	MaxConcurrentFetches int
+	// FetchQueueTimeout is how long a download waits for a free slot before
+	// failing with ErrFetchLimitReached. Defaults to 30s when zero.
+	FetchQueueTimeout time.Duration
+	// FetchTimeout bounds each upstream download, including storing the
+	// body, after which it fails with ErrUpstreamTimeout. Zero means no
+	// limit beyond the request's own.
+	FetchTimeout time.Duration
+	// SkipContentCheck turns off the check that refuses to cache an HTML or
+	// JSON error page served in place of a binary artifact.
+	SkipContentCheck bool
+	// NormalizeUpstreamURLs canonicalizes upstream URLs with
+	// normalizeUpstreamURL before they are stored on artifacts.
+	NormalizeUpstreamURLs bool
+
+	fetchSlotsMu    sync.Mutex
+	fetchSlotsByEco map[string]chan struct{}
+
+	// inflight holds the downloads currently holding a fetch slot; see
+	// InflightFetches.
+	inflightMu sync.Mutex
+	inflight   map[*inflightFetch]struct{}
+
+	notFoundMu sync.Mutex
+	notFound   map[string]time.Time
+
+	resolvedMu sync.Mutex
+	resolved   map[string]resolvedEntry
+
+	publishedMu sync.Mutex
+	published   map[string]publishedEntry
+
+	// cacheRecordingErr is the last updateCacheDB failure, cleared by the
+	// next success; see CacheRecordingError.
+	cacheRecordingMu  sync.Mutex
+	cacheRecordingErr error
+
+	// npmPublishMu serializes updates to local npm packuments, which are
+	// read, modified and written back whole.
+	npmPublishMu sync.Mutex
+
+	// hitTimeline buffers cache hits for the artifact_hits table; nil
+	// unless EnableHitTimeline has been called.
+	hitTimeline *hitTimeline
+
+	// metadataFlight coalesces concurrent identical metadata requests; see
+	// coalesceMetadata.
+	metadataFlight singleflight.Group
+
+	// spoolFlight coalesces concurrent fetches of documents read from a
+	// spool; see coalesceMetadataSpool.
+	spoolFlight spoolFlight
+
+	// upstreamOverrideHosts is non-nil once EnableUpstreamOverride has been
+	// called and lists the hosts X-Proxy-Upstream may point at.
+	upstreamOverrideHosts map[string]bool
+
+	// cacheRefreshEnabled, cacheRefreshEcosystems and cacheRefreshToken are
+	// set by EnableCacheRefresh. A nil ecosystem set allows all of them.
+	cacheRefreshEnabled    bool
+	cacheRefreshEcosystems map[string]bool
+	cacheRefreshToken      string
+
+	// usageEnabled, usageTeamHeader and usageClientCertTeam are set by
+	// EnableUsageLog. usageInserts counts access log rows written since
+	// startup so the table is pruned periodically rather than on every row.
+	usageEnabled        bool
+	usageTeamHeader     string
+	usageClientCertTeam bool
+	usageInserts        atomic.Int64
+
+	// detectBaseURL is set by EnableBaseURLDetection, which also fills
+	// trustedProxies with the peers whose forwarded headers are believed.
+	detectBaseURL  bool
+	trustedProxies []netip.Prefix
+
+	// upstreamFallbacks holds, per ecosystem, the mirrors tried when an
+	// artifact download from the primary fails; see SetUpstreamFallbacks.
+	upstreamFallbacks map[string][]*url.URL
+
+	// selfHosts holds the host:port pairs this proxy is reached at, set by
+	// SetSelfURLs. Upstream requests to them fail with ErrUpstreamLoop.
+	selfHosts map[string]bool
+
+	// npmScopeUpstreams maps a lowercased npm scope ("@mycompany") to the
+	// registry its packages are fetched from; see SetNPMScopeUpstreams.
+	npmScopeUpstreams map[string]string
+
+	// forwardedHeaders is the set of upstream response headers passed
+	// through to clients, set by SetForwardedResponseHeaders. Nil means
+	// the built-in allowlist.
+	forwardedHeaders map[string]bool
 }
 
 // NewProxy creates a new Proxy with the given dependencies.
@@ -111,7 +297,7 @@ func NewProxy(db *database.DB, store storage.Storage, fetcher fetch.FetcherInter
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &Proxy{
+	p := &Proxy{
 		DB:       db,
 		Storage:  store,
 		Fetcher:  fetcher,
@@ -120,71 +306,152 @@ func NewProxy(db *database.DB, store storage.Storage, fetcher fetch.FetcherInter
 		HTTPClient: &http.Client{
 			Timeout: defaultHTTPTimeout,
 		},
+		NotFoundTTL:     defaultNotFoundTTL,
+		ResolveCacheTTL: defaultResolveCacheTTL,
 	}
+	p.HTTPClient.Transport = &upstreamLogTransport{proxy: p}
+	return p
 }
 
 // CacheResult contains information about a cached or fetched artifact.
 type CacheResult struct {
 	Reader      io.ReadCloser
 	RedirectURL string
+	// Size is the length of Reader's content. Stored artifacts always
+	// know it. A pass-through stream whose length upstream didn't send
+	// leaves it 0 or negative, and contentLength treats that as unknown.
 	Size        int64
 	ContentType string
 	Hash        string
 	Cached      bool
+	// Trace is the X-Cache-Lookup value, set only when CacheTrace is on.
+	Trace string
+	// Immutable marks artifacts that can be cached by clients forever.
+	Immutable bool
+	// FetchedAt is when a cached artifact was fetched from upstream. It is
+	// zero for artifacts fetched by this request.
+	FetchedAt time.Time
+
+	// usage, when set, records the artifact in the access log once served.
+	usage *usageRecord
 }
 
 // GetOrFetchArtifact retrieves an artifact from cache or fetches from upstream.
+// The name is canonicalized first, so equivalent spellings share a cache entry.
 func (p *Proxy) GetOrFetchArtifact(ctx context.Context, ecosystem, name, version, filename string) (*CacheResult, error) {
+	if filename != "" {
+		if err := p.checkArtifactAllowed(ecosystem, filename); err != nil {
+			return nil, err
+		}
+	}
+	requested := name
+	name = Canonicalize(ecosystem, name)
+	if err := p.checkQuarantine(ctx, ecosystem, name, version); err != nil {
+		return nil, err
+	}
 	pkgPURL := purl.MakePURLString(ecosystem, name, "")
 	versionPURL := purl.MakePURLString(ecosystem, name, version)
 
-	if cached, err := p.checkCache(ctx, pkgPURL, versionPURL, filename); err != nil {
+	if upstreamOverride(ctx) != nil {
+		info, err := p.resolve(ctx, ecosystem, name, version)
+		if err != nil {
+			if errors.Is(err, fetch.ErrNotFound) {
+				return nil, upstreamNotFound(err)
+			}
+			return nil, fmt.Errorf("resolving download URL: %w", err)
+		}
+		return p.fetchUncached(ctx, info.URL, nil)
+	}
+
+	if p.isIndexOnly(ecosystem) {
+		info, err := p.resolve(ctx, ecosystem, name, version)
+		if err != nil {
+			if errors.Is(err, fetch.ErrNotFound) {
+				return nil, upstreamNotFound(err)
+			}
+			return nil, fmt.Errorf("resolving download URL: %w", err)
+		}
+		if filename == "" {
+			if err := p.checkArtifactAllowed(ecosystem, info.Filename); err != nil {
+				return nil, err
+			}
+		}
+		return p.indexOnlyArtifact(ctx, ecosystem, versionPURL, info.URL, nil)
+	}
+
+	trace := p.newCacheTrace()
+	if cached, err := p.lookupArtifact(ctx, ecosystem, requested, name, version, filename, trace); err != nil {
 		return nil, err
 	} else if cached != nil {
+		markImmutable(cached, ecosystem, version, filename)
+		attachUsage(ctx, cached, ecosystem, versionPURL)
+		noteCacheStatus(ctx, CacheStatusHit)
 		return cached, nil
 	}
 
-	return p.fetchAndCache(ctx, ecosystem, name, version, filename, pkgPURL, versionPURL)
+	result, err := p.fetchAndCache(ctx, ecosystem, name, version, filename, pkgPURL, versionPURL)
+	trace.finish(result, "fetch")
+	markImmutable(result, ecosystem, version, filename)
+	attachUsage(ctx, result, ecosystem, versionPURL)
+	if err == nil {
+		noteCacheStatus(ctx, CacheStatusMiss)
+	}
+	return result, err
 }
 
 // checkCache looks up an artifact in the cache. Returns nil if not cached.
-func (p *Proxy) checkCache(ctx context.Context, pkgPURL, versionPURL, filename string) (*CacheResult, error) {
+// Each stage is recorded in trace, which may be nil.
+func (p *Proxy) checkCache(ctx context.Context, pkgPURL, versionPURL, filename string, trace *cacheTrace) (*CacheResult, error) {
 	pkg, err := p.DB.GetPackageByPURL(pkgPURL)
 	if err != nil {
 		return nil, fmt.Errorf("checking package cache: %w", err)
 	}
 	if pkg == nil {
+		trace.add("package", "missing")
 		return nil, nil
 	}
+	trace.add("package", "found")
 
 	ver, err := p.DB.GetVersionByPURL(versionPURL)
 	if err != nil {
 		return nil, fmt.Errorf("checking version cache: %w", err)
 	}
 	if ver == nil {
+		trace.add("version", "missing")
 		return nil, nil
 	}
+	trace.add("version", "found")
 
 	artifact, err := p.DB.GetArtifact(versionPURL, filename)
 	if err != nil {
 		return nil, fmt.Errorf("checking artifact cache: %w", err)
 	}
-	if artifact == nil || !artifact.IsCached() {
+	if artifact == nil {
+		trace.add("artifact", "missing")
+		return nil, nil
+	}
+	if !artifact.IsCached() {
+		trace.add("artifact", "uncached")
 		return nil, nil
 	}
+	trace.add("artifact", "found")
 
 	result := &CacheResult{
 		Size:        artifact.Size.Int64,
 		ContentType: artifact.ContentType.String,
 		Hash:        artifact.ContentHash.String,
 		Cached:      true,
+		FetchedAt:   artifact.FetchedAt.Time,
 	}
 
 	if p.DirectServe {
 		signed, err := p.Storage.SignedURL(ctx, artifact.StoragePath.String, p.DirectServeTTL)
 		if err == nil {
 			result.RedirectURL = rewriteSignedURLHost(signed, p.DirectServeBaseURL)
+			trace.add("blob", "signed")
 			p.recordCacheHit(pkgPURL, versionPURL, filename)
+			trace.add("hit", "recorded")
+			trace.finish(result, "redirect")
 			return result, nil
 		}
 		if !errors.Is(err, storage.ErrSignedURLUnsupported) {
@@ -200,8 +467,10 @@ func (p *Proxy) checkCache(ctx context.Context, pkgPURL, versionPURL, filename s
 		metrics.RecordStorageError("read")
 		p.Logger.Warn("cached artifact missing from storage, will refetch",
 			"path", artifact.StoragePath.String, "error", err)
+		trace.add("blob", "missing")
 		return nil, nil
 	}
+	trace.add("blob", "present")
 
 	result.Reader = newVerifyingReader(reader, artifact.ContentHash.String, ver.Integrity.String,
 		func(reason string) {
@@ -214,6 +483,8 @@ func (p *Proxy) checkCache(ctx context.Context, pkgPURL, versionPURL, filename s
 			}
 		})
 	p.recordCacheHit(pkgPURL, versionPURL, filename)
+	trace.add("hit", "recorded")
+	trace.finish(result, "hit")
 	return result, nil
 }
 
@@ -239,6 +510,7 @@ func rewriteSignedURLHost(signed, baseURL string) string {
 
 func (p *Proxy) recordCacheHit(pkgPURL, versionPURL, filename string) {
 	_ = p.DB.RecordArtifactHit(versionPURL, filename)
+	p.recordHitTimeline(versionPURL, filename)
 	if parsed, err := purl.Parse(pkgPURL); err == nil {
 		metrics.RecordCacheHit(purl.PURLTypeToEcosystem(parsed.Type))
 	}
@@ -248,48 +520,93 @@ func (p *Proxy) fetchAndCache(ctx context.Context, ecosystem, name, version, fil
 	// Record cache miss
 	metrics.RecordCacheMiss(ecosystem)
 
+	// Requests for versions that don't exist upstream are remembered
+	// briefly so clients retrying them don't keep hitting the registry.
+	notFoundKey := versionPURL + "#" + filename
+	if !p.refreshRequested(ctx, ecosystem) && p.isNotFoundCached(notFoundKey) {
+		return nil, upstreamNotFound(fetch.ErrNotFound)
+	}
+
 	// Resolve download URL
-	info, err := p.Resolver.Resolve(ctx, ecosystem, name, version)
+	info, err := p.resolve(ctx, ecosystem, name, version)
 	if err != nil {
+		if errors.Is(err, fetch.ErrNotFound) {
+			p.rememberNotFound(notFoundKey, err)
+			return nil, upstreamNotFound(err)
+		}
 		return nil, fmt.Errorf("resolving download URL: %w", err)
 	}
 
 	// Use resolved filename if provided filename is empty
 	if filename == "" {
 		filename = info.Filename
+		if err := p.checkArtifactAllowed(ecosystem, filename); err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := p.acquireFetchSlot(ctx, ecosystem)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+	inflight, untrack := p.trackFetch(ecosystem, name, version, info.URL)
+	defer untrack()
 
 	p.Logger.Info("fetching from upstream",
 		"ecosystem", ecosystem, "name", name, "version", version, "url", info.URL)
 
 	// Fetch from upstream with timing
 	fetchStart := time.Now()
-	artifact, err := p.Fetcher.Fetch(ctx, info.URL)
+	artifact, fetchedURL, fetchCtx, cancel, err := p.fetchArtifact(ctx, ecosystem, info.URL, nil)
+	defer cancel()
 	fetchDuration := time.Since(fetchStart)
 
 	if err != nil {
 		metrics.RecordUpstreamFetch(ecosystem, fetchDuration)
+		if fetchTimedOut(ctx, fetchCtx) {
+			metrics.RecordUpstreamError(ecosystem, "fetch_timeout")
+			return nil, ErrUpstreamTimeout
+		}
+		if errors.Is(err, fetch.ErrNotFound) {
+			p.rememberNotFound(notFoundKey, err)
+			return nil, upstreamNotFound(err)
+		}
 		metrics.RecordUpstreamError(ecosystem, "fetch_failed")
 		return nil, fmt.Errorf("fetching from upstream: %w", err)
 	}
 	metrics.RecordUpstreamFetch(ecosystem, fetchDuration)
+	p.logUpstreamArtifact(ctx, fetchedURL, artifact)
+	if err := p.checkArtifactContent(ctx, ecosystem, fetchedURL, artifact); err != nil {
+		_ = artifact.Body.Close()
+		return nil, err
+	}
+	artifact.Body = checkDigest(ctx, artifact.Body)
+
+	artifact.Body = p.fetched(inflight, fetchedURL, artifact.Body)
 
 	// Store in cache
-	storagePath := storage.ArtifactPath(ecosystem, "", name, version, filename)
+	storagePath := p.storageKey(storage.ArtifactPathLimited(ecosystem, "", name, version, filename, p.MaxFilenameLength))
 	storeStart := time.Now()
-	size, hash, err := p.Storage.Store(ctx, storagePath, artifact.Body)
+	size, hash, err := p.Storage.Store(fetchCtx, storagePath, artifact.Body)
 	_ = artifact.Body.Close()
 	metrics.RecordStorageOperation("write", time.Since(storeStart))
 
 	if err != nil {
+		if fetchTimedOut(ctx, fetchCtx) {
+			metrics.RecordUpstreamError(ecosystem, "fetch_timeout")
+			return nil, ErrUpstreamTimeout
+		}
 		metrics.RecordStorageError("write")
 		return nil, fmt.Errorf("storing artifact: %w", err)
 	}
+	if err := p.checkStoredSize(ctx, ecosystem, storagePath, fetchedURL, artifact.Size, size); err != nil {
+		return nil, err
+	}
 
-	// Update database
-	if err := p.updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, info.URL, storagePath, hash, size, artifact.ContentType); err != nil {
-		p.Logger.Warn("failed to update cache database", "error", err)
-		// Continue anyway - we have the file
+	// Update database. Unless failing closed, continue anyway - we have the file
+	if err := p.recordCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, fetchedURL, storagePath, hash, size, artifact.ContentType); err != nil {
+		return nil, err
 	}
 
 	// Open the stored file to return
@@ -311,6 +628,30 @@ func (p *Proxy) fetchAndCache(ctx context.Context, ecosystem, name, version, fil
 	}, nil
 }
 
+const (
+	// cacheDBAttempts bounds how often a cache DB write is tried when SQLite
+	// reports the database is locked.
+	cacheDBAttempts = 4
+	// cacheDBRetryDelay is the first backoff between attempts; it doubles
+	// after each one.
+	cacheDBRetryDelay = 25 * time.Millisecond
+)
+
+// retryOnBusy runs fn, retrying with backoff while it fails because another
+// connection holds the SQLite write lock. Other errors return immediately.
+func retryOnBusy(fn func() error) error {
+	delay := cacheDBRetryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !database.IsBusy(err) || attempt == cacheDBAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
 func (p *Proxy) updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, upstreamURL, storagePath, hash string, size int64, contentType string) error {
 	now := time.Now()
 
@@ -322,7 +663,7 @@ func (p *Proxy) updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, u
 		RegistryURL: sql.NullString{String: upstreamURL, Valid: true},
 		EnrichedAt:  sql.NullTime{Time: now, Valid: true},
 	}
-	if err := p.DB.UpsertPackage(pkg); err != nil {
+	if err := retryOnBusy(func() error { return p.DB.UpsertPackage(pkg) }); err != nil {
 		return fmt.Errorf("upserting package: %w", err)
 	}
 
@@ -332,11 +673,21 @@ func (p *Proxy) updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, u
 		PackagePURL: pkgPURL,
 		EnrichedAt:  sql.NullTime{Time: now, Valid: true},
 	}
-	if err := p.DB.UpsertVersion(ver); err != nil {
+	// Downloads don't carry yanked status or publish time, so keep
+	// whatever enrichment recorded rather than resetting it on every
+	// refetch.
+	if existing, err := p.DB.GetVersionByPURL(versionPURL); err == nil && existing != nil {
+		ver.Yanked = existing.Yanked
+		ver.PublishedAt = existing.PublishedAt
+	}
+	if err := retryOnBusy(func() error { return p.DB.UpsertVersion(ver) }); err != nil {
 		return fmt.Errorf("upserting version: %w", err)
 	}
 
 	// Upsert artifact
+	if p.NormalizeUpstreamURLs {
+		upstreamURL = normalizeUpstreamURL(upstreamURL)
+	}
 	art := &database.Artifact{
 		VersionPURL: versionPURL,
 		Filename:    filename,
@@ -347,21 +698,39 @@ func (p *Proxy) updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, u
 		ContentType: sql.NullString{String: contentType, Valid: true},
 		FetchedAt:   sql.NullTime{Time: now, Valid: true},
 	}
-	if err := p.DB.UpsertArtifact(art); err != nil {
+	if err := retryOnBusy(func() error { return p.DB.UpsertArtifact(art) }); err != nil {
 		return fmt.Errorf("upserting artifact: %w", err)
 	}
 
 	return nil
 }
 
+// contentLength returns the Content-Length to send for result. A stored
+// artifact's size is always known, even when it is empty. For a pass-through
+// stream only a positive size is trusted, since a zero-valued Size there
+// usually means nobody set it; such streams are sent chunked instead.
+func (result *CacheResult) contentLength() (int64, bool) {
+	if result.Size > 0 {
+		return result.Size, true
+	}
+	if result.Size == 0 && (result.Cached || result.Hash != "") {
+		return 0, true
+	}
+	return 0, false
+}
+
 // ServeArtifact writes a CacheResult to an HTTP response.
-func ServeArtifact(w http.ResponseWriter, result *CacheResult) {
+func (p *Proxy) ServeArtifact(w http.ResponseWriter, result *CacheResult) {
+	if result.Trace != "" {
+		w.Header().Set(CacheLookupHeader, result.Trace)
+	}
 	if result.RedirectURL != "" {
 		if result.Hash != "" {
 			w.Header().Set("ETag", fmt.Sprintf(`"%s"`, result.Hash))
 		}
 		w.Header().Set("Location", result.RedirectURL)
 		w.WriteHeader(http.StatusFound)
+		p.recordUsage(result.usage, result.Size)
 		return
 	}
 
@@ -370,20 +739,26 @@ func ServeArtifact(w http.ResponseWriter, result *CacheResult) {
 	if result.ContentType != "" {
 		w.Header().Set("Content-Type", result.ContentType)
 	}
-	if result.Size > 0 {
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", result.Size))
+	if n, ok := result.contentLength(); ok {
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	} else {
+		w.Header().Del("Content-Length")
 	}
 	if result.Hash != "" {
 		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, result.Hash))
 	}
+	if result.Immutable {
+		setImmutableCacheHeaders(w.Header())
+	}
+	setAgeHeaders(w.Header(), result.FetchedAt)
 
 	w.WriteHeader(http.StatusOK)
-	_, _ = io.Copy(w, result.Reader)
+	p.recordUsage(result.usage, p.copyArtifact(w, result.Reader))
 }
 
 // ProxyUpstream forwards a request to an upstream URL without caching.
-// It copies the request, forwards specified headers, and streams the response back.
-// If forwardHeaders is nil, all response headers are copied.
+// It copies the request headers named in forwardHeaders, streams the response
+// back, and copies the forwarded subset of the upstream response headers.
 func (p *Proxy) ProxyUpstream(w http.ResponseWriter, r *http.Request, upstreamURL string, forwardHeaders []string) {
 	p.Logger.Debug("proxying to upstream", "url", upstreamURL)
 
@@ -408,17 +783,14 @@ func (p *Proxy) ProxyUpstream(w http.ResponseWriter, r *http.Request, upstreamUR
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	p.copyUpstreamHeaders(w.Header(), resp.Header)
 
 	w.WriteHeader(resp.StatusCode)
 	_, _ = io.Copy(w, resp.Body)
 }
 
-// ProxyFile forwards a file request to upstream, copying all response headers.
+// ProxyFile forwards a file request to upstream, copying the forwarded subset
+// of its response headers.
 func (p *Proxy) ProxyFile(w http.ResponseWriter, r *http.Request, upstreamURL string) {
 	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstreamURL, nil)
 	if err != nil {
@@ -433,11 +805,7 @@ func (p *Proxy) ProxyFile(w http.ResponseWriter, r *http.Request, upstreamURL st
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	for key, values := range resp.Header {
-		for _, v := range values {
-			w.Header().Add(key, v)
-		}
-	}
+	p.copyUpstreamHeaders(w.Header(), resp.Header)
 
 	w.WriteHeader(resp.StatusCode)
 	_, _ = io.Copy(w, resp.Body)
@@ -453,9 +821,38 @@ func JSONError(w http.ResponseWriter, status int, message string) {
 // ErrUpstreamNotFound indicates the upstream returned 404.
 var ErrUpstreamNotFound = fmt.Errorf("upstream: not found")
 
+// writeArtifactError answers a failed artifact download whose error has a
+// status of its own: 404 when upstream has no such file, 503 when no fetch
+// slot is free, 504 for an upstream timeout, 503 when the cache database is
+// unavailable, and 403 for a quarantined version. It reports whether it
+// wrote a response; any other error is left to the caller, which logs it and
+// answers with 502.
+func writeArtifactError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrUpstreamNotFound), errors.Is(err, fetch.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, ErrFetchLimitReached):
+		writeFetchLimitError(w)
+	case errors.Is(err, ErrUpstreamTimeout):
+		writeUpstreamTimeoutError(w)
+	case errors.Is(err, ErrCacheUnavailable):
+		writeCacheUnavailableError(w)
+	case errors.Is(err, ErrVersionQuarantined):
+		writeQuarantinedError(w, err)
+	default:
+		return false
+	}
+	return true
+}
+
 // errStale304 is returned when upstream sends 304 but the cached file is missing.
 var errStale304 = fmt.Errorf("upstream returned 304 but cached file is missing")
 
+// storageKey places path under the configured storage prefix.
+func (p *Proxy) storageKey(path string) string {
+	return storage.PrefixedPath(p.StoragePrefix, path)
+}
+
 // metadataStoragePath builds a storage path for cached metadata.
 func metadataStoragePath(ecosystem, cacheKey string) string {
 	return "_metadata/" + ecosystem + "/" + cacheKey + "/metadata"
@@ -467,57 +864,100 @@ func metadataStoragePath(ecosystem, cacheKey string) string {
 // cacheKey is typically the package name but can include subpath components.
 // Optional acceptHeaders specify the Accept header(s) to send; defaults to application/json.
 func (p *Proxy) FetchOrCacheMetadata(ctx context.Context, ecosystem, cacheKey, upstreamURL string, acceptHeaders ...string) ([]byte, string, error) {
+	policy := metadataCachePolicy{enabled: p.CacheMetadata, ttl: p.MetadataTTLFor(ecosystem, cacheKey)}
+	return p.fetchOrCacheMetadata(ctx, ecosystem, cacheKey, upstreamURL, policy, acceptHeaders...)
+}
+
+// metadataCachePolicy decides whether one metadata fetch is cached and for
+// how long. FetchOrCacheMetadata uses the proxy-wide settings; handlers with
+// their own cache settings pass a policy to fetchOrCacheMetadata directly.
+type metadataCachePolicy struct {
+	enabled bool
+	ttl     time.Duration
+}
+
+func (p *Proxy) fetchOrCacheMetadata(ctx context.Context, ecosystem, cacheKey, upstreamURL string, policy metadataCachePolicy, acceptHeaders ...string) ([]byte, string, error) {
+	spool, contentType, err := p.fetchOrCacheMetadataSpool(ctx, ecosystem, cacheKey, upstreamURL, policy, acceptHeaders...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = spool.Close() }()
+	body, err := spool.Bytes()
+	if err != nil {
+		return nil, "", fmt.Errorf("reading metadata: %w", err)
+	}
+	return body, contentType, nil
+}
+
+// fetchOrCacheMetadataSpool is fetchOrCacheMetadata for callers that read
+// large documents without holding them in memory. The caller closes the
+// returned spool.
+func (p *Proxy) fetchOrCacheMetadataSpool(ctx context.Context, ecosystem, cacheKey, upstreamURL string, policy metadataCachePolicy, acceptHeaders ...string) (*metadataSpool, string, error) {
 	if containsPathTraversal(cacheKey) {
 		return nil, "", fmt.Errorf("invalid cache key: %q", cacheKey)
 	}
 
-	storagePath := metadataStoragePath(ecosystem, cacheKey)
+	accept := contentTypeJSON
+	if len(acceptHeaders) > 0 && acceptHeaders[0] != "" {
+		accept = acceptHeaders[0]
+	}
+
+	// Overridden upstreams bypass the metadata cache in both directions.
+	if upstreamOverride(ctx) != nil {
+		spool, contentType, _, _, err := p.fetchUpstreamMetadata(ctx, upstreamURL, nil, accept)
+		return spool, contentType, err
+	}
+
+	storagePath := p.storageKey(metadataStoragePath(ecosystem, cacheKey))
 
 	// Check for existing cache entry (for ETag revalidation and TTL)
 	var entry *database.MetadataCacheEntry
-	if p.CacheMetadata && p.DB != nil {
+	if policy.enabled && p.DB != nil {
 		entry, _ = p.DB.GetMetadataCache(ecosystem, cacheKey)
 	}
 
+	// A refresh skips the TTL and revalidation; entry is still kept as the
+	// fallback if upstream fails.
+	refresh := p.refreshRequested(ctx, ecosystem)
+	validators := entry
+	if refresh {
+		validators = nil
+	}
+
 	// Serve from cache if within TTL (skip upstream entirely)
-	if entry != nil && p.MetadataTTL > 0 && entry.FetchedAt.Valid {
-		if time.Since(entry.FetchedAt.Time) < p.MetadataTTL {
+	if entry != nil && !refresh && policy.ttl > 0 && entry.FetchedAt.Valid {
+		if time.Since(entry.FetchedAt.Time) < policy.ttl {
 			cached, readErr := p.Storage.Open(ctx, entry.StoragePath)
 			if readErr == nil {
 				defer func() { _ = cached.Close() }()
-				data, readErr := p.ReadMetadata(cached)
+				spool, readErr := p.spoolMetadata(cached)
 				if readErr == nil {
 					ct := contentTypeJSON
 					if entry.ContentType.Valid {
 						ct = entry.ContentType.String
 					}
-					return data, ct, nil
+					return spool, ct, nil
 				}
 			}
 			// Cache file missing/unreadable, fall through to upstream
 		}
 	}
 
-	accept := contentTypeJSON
-	if len(acceptHeaders) > 0 && acceptHeaders[0] != "" {
-		accept = acceptHeaders[0]
-	}
-
 	// Try upstream
-	body, contentType, etag, lastModified, err := p.fetchUpstreamMetadata(ctx, upstreamURL, entry, accept)
+	spool, contentType, etag, lastModified, err := p.fetchUpstreamMetadata(ctx, upstreamURL, validators, accept)
 	if errors.Is(err, errStale304) {
 		// 304 but cached file is gone; retry without ETag
-		body, contentType, etag, lastModified, err = p.fetchUpstreamMetadata(ctx, upstreamURL, nil, accept)
+		spool, contentType, etag, lastModified, err = p.fetchUpstreamMetadata(ctx, upstreamURL, nil, accept)
 	}
 	if err == nil {
-		if p.CacheMetadata {
-			p.cacheMetadataBlob(ctx, ecosystem, cacheKey, storagePath, body, contentType, etag, lastModified)
+		if policy.enabled {
+			p.cacheMetadataBlob(ctx, ecosystem, cacheKey, storagePath, spool.Reader(), contentType, etag, lastModified)
 		}
-		return body, contentType, nil
+		return spool, contentType, nil
 	}
 
 	// Upstream failed -- fall back to cache if available
-	if !p.CacheMetadata || entry == nil {
+	if !policy.enabled || entry == nil {
 		return nil, "", fmt.Errorf("upstream failed and no cached metadata: %w", err)
 	}
 
@@ -530,7 +970,7 @@ func (p *Proxy) FetchOrCacheMetadata(ctx context.Context, ecosystem, cacheKey, u
 	}
 	defer func() { _ = cached.Close() }()
 
-	data, readErr := p.ReadMetadata(cached)
+	spool, readErr = p.spoolMetadata(cached)
 	if readErr != nil {
 		return nil, "", fmt.Errorf("upstream failed and cached read error: %w", err)
 	}
@@ -541,12 +981,12 @@ func (p *Proxy) FetchOrCacheMetadata(ctx context.Context, ecosystem, cacheKey, u
 	}
 	p.Logger.Info("serving metadata from cache",
 		"ecosystem", ecosystem, "key", cacheKey)
-	return data, ct, nil
+	return spool, ct, nil
 }
 
 // fetchUpstreamMetadata fetches metadata from upstream, using ETag for conditional revalidation.
-// Returns the body, content type, ETag, upstream Last-Modified time, and any error.
-func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, entry *database.MetadataCacheEntry, accept string) ([]byte, string, string, time.Time, error) {
+// Returns the body, spooled, content type, ETag, upstream Last-Modified time, and any error.
+func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, entry *database.MetadataCacheEntry, accept string) (*metadataSpool, string, string, time.Time, error) {
 	var zeroTime time.Time
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamURL, nil)
@@ -558,6 +998,9 @@ func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, e
 	if entry != nil && entry.ETag.Valid {
 		req.Header.Set("If-None-Match", entry.ETag.String)
 	}
+	if entry != nil && entry.LastModified.Valid {
+		req.Header.Set("If-Modified-Since", entry.LastModified.Time.UTC().Format(http.TimeFormat))
+	}
 
 	resp, err := p.HTTPClient.Do(req)
 	if err != nil {
@@ -572,7 +1015,7 @@ func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, e
 			return nil, "", "", zeroTime, errStale304
 		}
 		defer func() { _ = cached.Close() }()
-		data, readErr := p.ReadMetadata(cached)
+		spool, readErr := p.spoolMetadata(cached)
 		if readErr != nil {
 			return nil, "", "", zeroTime, errStale304
 		}
@@ -584,7 +1027,7 @@ func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, e
 		if entry.LastModified.Valid {
 			lm = entry.LastModified.Time
 		}
-		return data, ct, entry.ETag.String, lm, nil
+		return spool, ct, entry.ETag.String, lm, nil
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
@@ -594,7 +1037,7 @@ func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, e
 		return nil, "", "", zeroTime, fmt.Errorf("upstream returned %d", resp.StatusCode)
 	}
 
-	body, err := p.ReadMetadata(resp.Body)
+	spool, err := p.spoolMetadata(resp.Body)
 	if err != nil {
 		return nil, "", "", zeroTime, fmt.Errorf("reading response: %w", err)
 	}
@@ -611,16 +1054,17 @@ func (p *Proxy) fetchUpstreamMetadata(ctx context.Context, upstreamURL string, e
 		lastModified, _ = http.ParseTime(lm)
 	}
 
-	return body, contentType, etag, lastModified, nil
+	return spool, contentType, etag, lastModified, nil
 }
 
-// cacheMetadataBlob stores metadata bytes in storage and updates the database.
-func (p *Proxy) cacheMetadataBlob(ctx context.Context, ecosystem, cacheKey, storagePath string, data []byte, contentType, etag string, lastModified time.Time) {
+// cacheMetadataBlob stores metadata read from data in storage and updates
+// the database.
+func (p *Proxy) cacheMetadataBlob(ctx context.Context, ecosystem, cacheKey, storagePath string, data io.Reader, contentType, etag string, lastModified time.Time) {
 	if p.DB == nil || p.Storage == nil {
 		return
 	}
 
-	size, _, err := p.Storage.Store(ctx, storagePath, bytes.NewReader(data))
+	size, _, err := p.Storage.Store(ctx, storagePath, data)
 	if err != nil {
 		p.Logger.Warn("failed to cache metadata", "ecosystem", ecosystem, "key", cacheKey, "error", err)
 		return
@@ -642,6 +1086,7 @@ func (p *Proxy) cacheMetadataBlob(ctx context.Context, ecosystem, cacheKey, stor
 type cachedMeta struct {
 	etag         string
 	lastModified time.Time
+	fetchedAt    time.Time
 	stale        bool
 }
 
@@ -661,20 +1106,46 @@ func (p *Proxy) lookupCachedMeta(ecosystem, cacheKey string) cachedMeta {
 	if entry.LastModified.Valid {
 		cm.lastModified = entry.LastModified.Time
 	}
+	if entry.FetchedAt.Valid {
+		cm.fetchedAt = entry.FetchedAt.Time
+	}
 	// If FetchedAt is older than TTL, upstream must have failed and
 	// we served from stale cache (successful fetches update FetchedAt).
-	if p.MetadataTTL > 0 && entry.FetchedAt.Valid && time.Since(entry.FetchedAt.Time) > p.MetadataTTL {
+	ttl := p.MetadataTTLFor(ecosystem, cacheKey)
+	if ttl > 0 && entry.FetchedAt.Valid && time.Since(entry.FetchedAt.Time) > ttl {
 		cm.stale = true
 	}
 	return cm
 }
 
+// MetadataTTLFor returns how long the cached metadata under cacheKey stays
+// fresh. A MetadataTTLOverrides entry for the package wins over MetadataTTL.
+// Cache keys may carry a subpath after the package name ("requests/simple"),
+// so the key is shortened one segment at a time until an override matches.
+func (p *Proxy) MetadataTTLFor(ecosystem, cacheKey string) time.Duration {
+	if len(p.MetadataTTLOverrides) == 0 {
+		return p.MetadataTTL
+	}
+	key := ecosystem + "/" + cacheKey
+	for {
+		if ttl, ok := p.MetadataTTLOverrides[key]; ok {
+			return ttl
+		}
+		i := strings.LastIndex(key, "/")
+		if i <= len(ecosystem) {
+			return p.MetadataTTL
+		}
+		key = key[:i]
+	}
+}
+
 // ProxyCached fetches metadata from upstream (with optional caching for offline fallback)
 // and writes it to the response. Optional acceptHeaders specify the Accept header to send.
 // When metadata caching is disabled, the response is streamed directly to avoid buffering
 // large metadata responses (e.g. npm packages with many versions) in memory.
 func (p *Proxy) ProxyCached(w http.ResponseWriter, r *http.Request, upstreamURL, ecosystem, cacheKey string, acceptHeaders ...string) {
-	if !p.CacheMetadata {
+	setMetadataMaxAge(w, p.MetadataTTLFor(ecosystem, cacheKey))
+	if !p.CacheMetadata || upstreamOverride(r.Context()) != nil {
 		// Stream directly without buffering when caching is off.
 		p.proxyMetadataStream(w, r, upstreamURL, acceptHeaders...)
 		return
@@ -722,6 +1193,7 @@ func (p *Proxy) writeMetadataCachedResponse(w http.ResponseWriter, r *http.Reque
 	if !cm.lastModified.IsZero() {
 		w.Header().Set("Last-Modified", cm.lastModified.UTC().Format(http.TimeFormat))
 	}
+	setAgeHeaders(w.Header(), cm.fetchedAt)
 	if cm.stale {
 		w.Header().Set("Warning", `110 - "Response is Stale"`)
 	}
@@ -777,36 +1249,100 @@ func (p *Proxy) GetOrFetchArtifactFromURL(ctx context.Context, ecosystem, name,
 // with additional HTTP headers. This is needed for registries that require authentication
 // (e.g. Docker Hub requires a Bearer token even for public images).
 func (p *Proxy) GetOrFetchArtifactFromURLWithHeaders(ctx context.Context, ecosystem, name, version, filename, downloadURL string, headers http.Header) (*CacheResult, error) {
+	if err := p.checkArtifactAllowed(ecosystem, filename); err != nil {
+		return nil, err
+	}
+	requested := name
+	name = Canonicalize(ecosystem, name)
+	if err := p.checkQuarantine(ctx, ecosystem, name, version); err != nil {
+		return nil, err
+	}
 	pkgPURL := purl.MakePURLString(ecosystem, name, "")
 	versionPURL := purl.MakePURLString(ecosystem, name, version)
+	// A negotiated artifact is cached per Accept variant.
+	cacheFilename := artifactVariantFilename(filename, version, headers)
+
+	if upstreamOverride(ctx) != nil {
+		return p.fetchUncached(ctx, downloadURL, headers)
+	}
 
-	if cached, err := p.checkCache(ctx, pkgPURL, versionPURL, filename); err != nil {
+	if p.isIndexOnly(ecosystem) {
+		return p.indexOnlyArtifact(ctx, ecosystem, versionPURL, downloadURL, headers)
+	}
+
+	trace := p.newCacheTrace()
+	if cached, err := p.lookupArtifact(ctx, ecosystem, requested, name, version, cacheFilename, trace); err != nil {
 		return nil, err
 	} else if cached != nil {
+		markImmutable(cached, ecosystem, version, filename)
+		attachUsage(ctx, cached, ecosystem, versionPURL)
+		noteCacheStatus(ctx, CacheStatusHit)
 		return cached, nil
 	}
 
-	return p.fetchAndCacheFromURL(ctx, ecosystem, name, version, filename, pkgPURL, versionPURL, downloadURL, headers)
+	result, err := p.fetchAndCacheFromURL(ctx, ecosystem, name, version, cacheFilename, pkgPURL, versionPURL, downloadURL, headers)
+	trace.finish(result, "fetch")
+	markImmutable(result, ecosystem, version, filename)
+	attachUsage(ctx, result, ecosystem, versionPURL)
+	if err == nil {
+		noteCacheStatus(ctx, CacheStatusMiss)
+	}
+	return result, err
 }
 
 func (p *Proxy) fetchAndCacheFromURL(ctx context.Context, ecosystem, name, version, filename, pkgPURL, versionPURL, downloadURL string, headers http.Header) (*CacheResult, error) {
+	if !p.refreshRequested(ctx, ecosystem) && p.isNotFoundCached(downloadURL) {
+		return nil, upstreamNotFound(fetch.ErrNotFound)
+	}
+
+	release, err := p.acquireFetchSlot(ctx, ecosystem)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	inflight, untrack := p.trackFetch(ecosystem, name, version, downloadURL)
+	defer untrack()
+
 	p.Logger.Info("fetching from upstream",
 		"ecosystem", ecosystem, "name", name, "version", version, "url", downloadURL)
 
-	artifact, err := p.Fetcher.FetchWithHeaders(ctx, downloadURL, headers)
+	artifact, fetchedURL, fetchCtx, cancel, err := p.fetchArtifact(ctx, ecosystem, downloadURL, headers)
+	defer cancel()
 	if err != nil {
+		if fetchTimedOut(ctx, fetchCtx) {
+			metrics.RecordUpstreamError(ecosystem, "fetch_timeout")
+			return nil, ErrUpstreamTimeout
+		}
+		if errors.Is(err, fetch.ErrNotFound) {
+			p.rememberNotFound(downloadURL, err)
+			return nil, upstreamNotFound(err)
+		}
 		return nil, fmt.Errorf("fetching from upstream: %w", err)
 	}
+	p.logUpstreamArtifact(ctx, fetchedURL, artifact)
+	if err := p.checkArtifactContent(ctx, ecosystem, fetchedURL, artifact); err != nil {
+		_ = artifact.Body.Close()
+		return nil, err
+	}
+	artifact.Body = checkDigest(ctx, artifact.Body)
+	artifact.Body = p.fetched(inflight, fetchedURL, artifact.Body)
 
-	storagePath := storage.ArtifactPath(ecosystem, "", name, version, filename)
-	size, hash, err := p.Storage.Store(ctx, storagePath, artifact.Body)
+	storagePath := p.storageKey(storage.ArtifactPathLimited(ecosystem, "", name, version, filename, p.MaxFilenameLength))
+	size, hash, err := p.Storage.Store(fetchCtx, storagePath, artifact.Body)
 	_ = artifact.Body.Close()
 	if err != nil {
+		if fetchTimedOut(ctx, fetchCtx) {
+			metrics.RecordUpstreamError(ecosystem, "fetch_timeout")
+			return nil, ErrUpstreamTimeout
+		}
 		return nil, fmt.Errorf("storing artifact: %w", err)
 	}
+	if err := p.checkStoredSize(ctx, ecosystem, storagePath, fetchedURL, artifact.Size, size); err != nil {
+		return nil, err
+	}
 
-	if err := p.updateCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, downloadURL, storagePath, hash, size, artifact.ContentType); err != nil {
-		p.Logger.Warn("failed to update cache database", "error", err)
+	if err := p.recordCacheDB(ecosystem, name, filename, pkgPURL, versionPURL, fetchedURL, storagePath, hash, size, artifact.ContentType); err != nil {
+		return nil, err
 	}
 
 	reader, err := p.Storage.Open(ctx, storagePath)
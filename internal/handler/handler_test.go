@@ -102,7 +102,12 @@ type mockFetcher struct {
 	fetchErr      error
 	fetchErrByURL map[string]error
 	fetchCalled   bool
+	fetchCount    int
 	fetchedURL    string
+	headSize      int64
+	headType      string
+	headErr       error
+	headURL       string
 }
 
 func (f *mockFetcher) Fetch(ctx context.Context, url string) (*fetch.Artifact, error) {
@@ -111,6 +116,7 @@ func (f *mockFetcher) Fetch(ctx context.Context, url string) (*fetch.Artifact, e
 
 func (f *mockFetcher) FetchWithHeaders(_ context.Context, url string, _ http.Header) (*fetch.Artifact, error) {
 	f.fetchCalled = true
+	f.fetchCount++
 	f.fetchedURL = url
 	if f.fetchErrByURL != nil {
 		if err, ok := f.fetchErrByURL[url]; ok {
@@ -123,8 +129,9 @@ func (f *mockFetcher) FetchWithHeaders(_ context.Context, url string, _ http.Hea
 	return f.artifact, nil
 }
 
-func (f *mockFetcher) Head(_ context.Context, _ string) (int64, string, error) {
-	return 0, "", nil
+func (f *mockFetcher) Head(_ context.Context, url string) (int64, string, error) {
+	f.headURL = url
+	return f.headSize, f.headType, f.headErr
 }
 
 // setupTestProxy creates a Proxy with a real DB (SQLite in temp dir) and mock storage/fetcher.
@@ -495,9 +502,116 @@ func TestGetOrFetchArtifact_DirectServe_DisabledIgnoresSigning(t *testing.T) {
 	}
 }
 
+func TestUpdateCacheDB_PreservesYanked(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+
+	cache := func() {
+		t.Helper()
+		err := proxy.updateCacheDB("npm", "left-pad", "left-pad-1.0.0.tgz",
+			"pkg:npm/left-pad", "pkg:npm/left-pad@1.0.0", "https://registry.npmjs.org/left-pad/-/left-pad-1.0.0.tgz",
+			"npm/left-pad/1.0.0/left-pad-1.0.0.tgz", "abc123", 42, "application/octet-stream")
+		if err != nil {
+			t.Fatalf("updateCacheDB: %v", err)
+		}
+	}
+
+	cache()
+	if err := db.SetVersionYanked("pkg:npm/left-pad@1.0.0", true); err != nil {
+		t.Fatalf("SetVersionYanked: %v", err)
+	}
+	cache()
+
+	ver, err := db.GetVersionByPURL("pkg:npm/left-pad@1.0.0")
+	if err != nil || ver == nil {
+		t.Fatalf("GetVersionByPURL: %v", err)
+	}
+	if !ver.Yanked {
+		t.Error("refetching the artifact cleared the yanked flag")
+	}
+}
+
+func TestUpdateCacheDB_RetriesWhileLocked(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	// A short busy timeout makes the first attempts fail with "database is
+	// locked" instead of waiting the lock out inside SQLite.
+	db, err := database.CreateWithBusyTimeout(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	locker, err := database.OpenWithBusyTimeout(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to open second connection: %v", err)
+	}
+	t.Cleanup(func() { _ = locker.Close() })
+
+	// Hold the write lock from another connection, as a concurrent mirror
+	// run or burst of downloads would, and release it shortly after.
+	tx, err := locker.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE packages SET name = name"); err != nil {
+		t.Fatalf("taking write lock: %v", err)
+	}
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(60 * time.Millisecond)
+		_ = tx.Rollback()
+		close(released)
+	}()
+
+	proxy := NewProxy(db, newMockStorage(), &mockFetcher{}, fetch.NewResolver(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err = proxy.updateCacheDB("npm", "lodash", "lodash-4.17.21.tgz",
+		"pkg:npm/lodash", "pkg:npm/lodash@4.17.21", "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz",
+		"npm/lodash/4.17.21/lodash-4.17.21.tgz", "abc123", 42, "application/octet-stream")
+	<-released
+	if err != nil {
+		t.Fatalf("updateCacheDB failed under contention: %v", err)
+	}
+
+	art, err := db.GetArtifact("pkg:npm/lodash@4.17.21", "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if art == nil || !art.StoragePath.Valid {
+		t.Fatalf("artifact not recorded as cached: %+v", art)
+	}
+}
+
+func TestRetryOnBusy_StopsOnOtherErrors(t *testing.T) {
+	calls := 0
+	wantErr := errors.New("constraint failed")
+	err := retryOnBusy(func() error {
+		calls++
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("err = %v, want %v", err, wantErr)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryOnBusy_GivesUp(t *testing.T) {
+	calls := 0
+	err := retryOnBusy(func() error {
+		calls++
+		return errors.New("database is locked (5) (SQLITE_BUSY)")
+	})
+	if err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+	if calls != cacheDBAttempts {
+		t.Errorf("calls = %d, want %d", calls, cacheDBAttempts)
+	}
+}
+
 func TestServeArtifact_Redirect(t *testing.T) {
 	w := httptest.NewRecorder()
-	ServeArtifact(w, &CacheResult{
+	testProxy().ServeArtifact(w, &CacheResult{
 		RedirectURL: "https://bucket.s3.amazonaws.com/file?sig=abc",
 		Hash:        "abc123",
 		Cached:      true,
@@ -519,7 +633,7 @@ func TestServeArtifact_Redirect(t *testing.T) {
 
 func TestServeArtifact_Stream(t *testing.T) {
 	w := httptest.NewRecorder()
-	ServeArtifact(w, &CacheResult{
+	testProxy().ServeArtifact(w, &CacheResult{
 		Reader:      io.NopCloser(strings.NewReader("payload")),
 		Size:        7,
 		ContentType: "application/octet-stream",
@@ -591,6 +705,48 @@ func TestGetOrFetchArtifactFromURL_CacheMiss(t *testing.T) {
 	}
 }
 
+func TestGetOrFetchArtifactFromURL_StoragePrefix(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	proxy.StoragePrefix = "/staging/"
+
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("fetched content")),
+		ContentType: "application/gzip",
+	}
+
+	result, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "pypi", "newpkg", "1.0.0", "newpkg-1.0.0.tar.gz", "https://pypi.org/files/newpkg-1.0.0.tar.gz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = result.Reader.Close()
+
+	want := "staging/" + storage.ArtifactPath("pypi", "", "newpkg", "1.0.0", "newpkg-1.0.0.tar.gz")
+	if _, ok := store.files[want]; !ok {
+		t.Fatalf("artifact not stored at %s; have %v", want, store.files)
+	}
+	artifact, err := db.GetArtifact("pkg:pypi/newpkg@1.0.0", "newpkg-1.0.0.tar.gz")
+	if err != nil || artifact == nil {
+		t.Fatalf("GetArtifact() = %v, %v", artifact, err)
+	}
+	if artifact.StoragePath.String != want {
+		t.Errorf("storage_path = %q, want %q", artifact.StoragePath.String, want)
+	}
+
+	fetcher.fetchCalled = false
+	result, err = proxy.GetOrFetchArtifactFromURL(context.Background(), "pypi", "newpkg", "1.0.0", "newpkg-1.0.0.tar.gz", "https://pypi.org/files/newpkg-1.0.0.tar.gz")
+	if err != nil {
+		t.Fatalf("unexpected error on second request: %v", err)
+	}
+	defer func() { _ = result.Reader.Close() }()
+	if !result.Cached || fetcher.fetchCalled {
+		t.Errorf("second request: cached = %v, fetched = %v; want a cache hit", result.Cached, fetcher.fetchCalled)
+	}
+	body, _ := io.ReadAll(result.Reader)
+	if string(body) != "fetched content" {
+		t.Errorf("got body %q, want %q", body, "fetched content")
+	}
+}
+
 func TestGetOrFetchArtifactFromURL_FetchError(t *testing.T) {
 	proxy, _, _, fetcher := setupTestProxy(t)
 	fetcher.fetchErr = errors.New("connection refused")
@@ -631,7 +787,7 @@ func TestServeArtifact(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	ServeArtifact(w, result)
+	testProxy().ServeArtifact(w, result)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
@@ -656,7 +812,7 @@ func TestServeArtifact_EmptyFields(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	ServeArtifact(w, result)
+	testProxy().ServeArtifact(w, result)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
@@ -672,6 +828,21 @@ func TestServeArtifact_EmptyFields(t *testing.T) {
 	}
 }
 
+func TestServeArtifact_EmptyCachedArtifact(t *testing.T) {
+	result := &CacheResult{
+		Reader: io.NopCloser(strings.NewReader("")),
+		Hash:   "e3b0c442",
+		Cached: true,
+	}
+
+	w := httptest.NewRecorder()
+	testProxy().ServeArtifact(w, result)
+
+	if w.Header().Get("Content-Length") != "0" {
+		t.Errorf("Content-Length = %q, want %q", w.Header().Get("Content-Length"), "0")
+	}
+}
+
 func TestJSONError(t *testing.T) {
 	tests := []struct {
 		status  int
@@ -949,6 +1120,67 @@ func TestFetchOrCacheMetadata_TTL_Zero_AlwaysRevalidates(t *testing.T) {
 	}
 }
 
+func TestFetchOrCacheMetadata_TTLOverride(t *testing.T) {
+	upstreamHits := map[string]int{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits[r.URL.Path]++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"v":1}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.CacheMetadata = true
+	proxy.MetadataTTL = 1 * time.Hour
+	proxy.MetadataTTLOverrides = map[string]time.Duration{"npm/react": 0}
+	proxy.HTTPClient = upstream.Client()
+
+	ctx := context.Background()
+	for range 2 {
+		if _, _, err := proxy.FetchOrCacheMetadata(ctx, "npm", "react", upstream.URL+"/react"); err != nil {
+			t.Fatalf("fetch react: %v", err)
+		}
+		if _, _, err := proxy.FetchOrCacheMetadata(ctx, "npm", "lodash", upstream.URL+"/lodash"); err != nil {
+			t.Fatalf("fetch lodash: %v", err)
+		}
+	}
+
+	if upstreamHits["/react"] != 2 {
+		t.Errorf("react upstream hits = %d, want 2 (override TTL of 0)", upstreamHits["/react"])
+	}
+	if upstreamHits["/lodash"] != 1 {
+		t.Errorf("lodash upstream hits = %d, want 1 (default TTL)", upstreamHits["/lodash"])
+	}
+}
+
+func TestMetadataTTL_Overrides(t *testing.T) {
+	proxy := testProxy()
+	proxy.MetadataTTL = 5 * time.Minute
+	proxy.MetadataTTLOverrides = map[string]time.Duration{
+		"npm/react":       30 * time.Second,
+		"npm/@babel/core": time.Hour,
+		"pypi/requests":   24 * time.Hour,
+	}
+
+	tests := []struct {
+		ecosystem, cacheKey string
+		want                time.Duration
+	}{
+		{"npm", "react", 30 * time.Second},
+		{"npm", "react-dom", 5 * time.Minute},
+		{"npm", "@babel/core", time.Hour},
+		{"npm", "@babel/parser", 5 * time.Minute},
+		{"pypi", "requests/simple", 24 * time.Hour},
+		{"pypi", "requests/2.31.0", 24 * time.Hour},
+		{"cargo", "react", 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := proxy.MetadataTTLFor(tt.ecosystem, tt.cacheKey); got != tt.want {
+			t.Errorf("MetadataTTLFor(%q, %q) = %v, want %v", tt.ecosystem, tt.cacheKey, got, tt.want)
+		}
+	}
+}
+
 func TestProxyCached_StaleWarningHeader(t *testing.T) {
 	requestCount := 0
 	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1041,3 +1273,35 @@ func TestCanonicalPackagePURLMatchesConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteArtifactError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{upstreamNotFound(fetch.ErrNotFound), http.StatusNotFound},
+		{fmt.Errorf("fetching: %w", fetch.ErrNotFound), http.StatusNotFound},
+		{ErrFetchLimitReached, http.StatusServiceUnavailable},
+		{ErrUpstreamTimeout, http.StatusGatewayTimeout},
+		{errors.Join(ErrCacheUnavailable, errors.New("disk I/O error")), http.StatusServiceUnavailable},
+		{&quarantineError{purl: "pkg:npm/left-pad@1.4.0", period: time.Hour}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		if !writeArtifactError(w, tt.err) {
+			t.Errorf("writeArtifactError(%v) = false, want true", tt.err)
+			continue
+		}
+		if w.Code != tt.want {
+			t.Errorf("writeArtifactError(%v) status = %d, want %d", tt.err, w.Code, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if writeArtifactError(w, errors.New("connection reset by peer")) {
+		t.Error("writeArtifactError handled an error it has no status for")
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("unhandled error wrote a response: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// HeadArtifact describes an artifact for a HEAD request without downloading
+// it. A cached artifact is described from the database. Anything else is
+// checked with an upstream HEAD, so existence checks from clients never
+// fill the cache. The result has no Reader. An empty downloadURL is
+// resolved the way GetOrFetchArtifact resolves it.
+func (p *Proxy) HeadArtifact(ctx context.Context, ecosystem, name, version, filename, downloadURL string) (*CacheResult, error) {
+	if err := p.checkArtifactAllowed(ecosystem, filename); err != nil {
+		return nil, err
+	}
+	name = Canonicalize(ecosystem, name)
+	if err := p.checkQuarantine(ctx, ecosystem, name, version); err != nil {
+		return nil, err
+	}
+	versionPURL := purl.MakePURLString(ecosystem, name, version)
+
+	if upstreamOverride(ctx) == nil && !p.refreshRequested(ctx, ecosystem) {
+		artifact, err := p.DB.GetArtifact(versionPURL, filename)
+		if err != nil {
+			return nil, fmt.Errorf("checking artifact cache: %w", err)
+		}
+		if artifact != nil && artifact.IsCached() {
+			result := &CacheResult{
+				Size:        artifact.Size.Int64,
+				ContentType: artifact.ContentType.String,
+				Hash:        artifact.ContentHash.String,
+				Cached:      true,
+				FetchedAt:   artifact.FetchedAt.Time,
+			}
+			markImmutable(result, ecosystem, version, filename)
+			return result, nil
+		}
+	}
+
+	notFoundKey := downloadURL
+	if downloadURL == "" {
+		notFoundKey = versionPURL + "#" + filename
+	}
+	if !p.refreshRequested(ctx, ecosystem) && p.isNotFoundCached(notFoundKey) {
+		return nil, upstreamNotFound(fetch.ErrNotFound)
+	}
+
+	if downloadURL == "" {
+		info, err := p.resolve(ctx, ecosystem, name, version)
+		if err != nil {
+			if errors.Is(err, fetch.ErrNotFound) {
+				p.rememberNotFound(notFoundKey, err)
+				return nil, upstreamNotFound(err)
+			}
+			return nil, fmt.Errorf("resolving download URL: %w", err)
+		}
+		downloadURL = info.URL
+	}
+
+	if err := p.checkUpstreamLoop(ctx, downloadURL); err != nil {
+		return nil, err
+	}
+	headCtx, cancel := p.withFetchDeadline(ctx)
+	defer cancel()
+	size, contentType, err := p.Fetcher.Head(headCtx, downloadURL)
+	if err != nil {
+		if fetchTimedOut(ctx, headCtx) {
+			return nil, ErrUpstreamTimeout
+		}
+		if errors.Is(err, fetch.ErrNotFound) {
+			p.rememberNotFound(notFoundKey, err)
+			return nil, upstreamNotFound(err)
+		}
+		return nil, fmt.Errorf("checking upstream: %w", err)
+	}
+
+	result := &CacheResult{Size: size, ContentType: contentType}
+	markImmutable(result, ecosystem, version, filename)
+	return result, nil
+}
+
+// ServeArtifactHead writes the headers ServeArtifact would send for result,
+// without a body. A negative Size, from an upstream that didn't send
+// Content-Length, leaves the length out.
+func (p *Proxy) ServeArtifactHead(w http.ResponseWriter, result *CacheResult) {
+	if result.ContentType != "" {
+		w.Header().Set("Content-Type", result.ContentType)
+	}
+	if result.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(result.Size, 10))
+	}
+	if result.Hash != "" {
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, result.Hash))
+	}
+	if result.Immutable {
+		setImmutableCacheHeaders(w.Header())
+	}
+	setAgeHeaders(w.Header(), result.FetchedAt)
+	w.WriteHeader(http.StatusOK)
+}
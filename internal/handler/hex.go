@@ -59,6 +59,13 @@ func (h *HexHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if name := trimLatestFilename(filename, ".tar"); name != "" {
+		h.proxy.redirectToLatest(w, r, "hex", name, func(version string) string {
+			return fmt.Sprintf("%s/hex/tarballs/%s-%s.tar", requestBaseURL(r, h.proxyURL), name, version)
+		})
+		return
+	}
+
 	// Extract name and version from filename (e.g., "phoenix-1.7.10.tar")
 	name, version := h.parseTarballFilename(filename)
 	if name == "" || version == "" {
@@ -69,14 +76,16 @@ func (h *HexHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("hex download request",
 		"name", name, "version", version, "filename", filename)
 
-	result, err := h.proxy.GetOrFetchArtifact(r.Context(), "hex", name, version, filename)
+	result, err := h.proxy.GetOrFetchArtifact(expectBinary(r.Context()), "hex", name, version, filename)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // parseTarballFilename extracts name and version from a hex tarball filename.
@@ -122,11 +131,7 @@ func (h *HexHandler) handlePackages(w http.ResponseWriter, r *http.Request) {
 	defer func() { _ = protoResp.Body.Close() }()
 
 	if protoResp.StatusCode != http.StatusOK {
-		for k, vv := range protoResp.Header {
-			for _, v := range vv {
-				w.Header().Add(k, v)
-			}
-		}
+		h.proxy.copyUpstreamHeaders(w.Header(), protoResp.Header)
 		w.WriteHeader(protoResp.StatusCode)
 		_, _ = io.Copy(w, protoResp.Body)
 		return
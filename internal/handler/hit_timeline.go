@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+// hitTimelineBatchSize is how many cache hits are buffered before they are
+// written to artifact_hits without waiting for the next FlushHitTimeline.
+const hitTimelineBatchSize = 500
+
+// hitTimeline buffers cache hits so each one doesn't cost a database write.
+type hitTimeline struct {
+	mu      sync.Mutex
+	pending []database.ArtifactHit
+}
+
+// EnableHitTimeline turns on recording of every cache hit in the
+// artifact_hits table. Hits are buffered and written in batches, by
+// FlushHitTimeline or once hitTimelineBatchSize have built up. It must be
+// called before handlers serve traffic.
+func (p *Proxy) EnableHitTimeline() {
+	p.hitTimeline = &hitTimeline{}
+}
+
+// recordHitTimeline buffers a cache hit, writing the buffer in the
+// background once it is full.
+func (p *Proxy) recordHitTimeline(versionPURL, filename string) {
+	t := p.hitTimeline
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.pending = append(t.pending, database.ArtifactHit{
+		VersionPURL: versionPURL,
+		Filename:    filename,
+		HitAt:       time.Now(),
+	})
+	var batch []database.ArtifactHit
+	if len(t.pending) >= hitTimelineBatchSize {
+		batch, t.pending = t.pending, nil
+	}
+	t.mu.Unlock()
+
+	if batch != nil {
+		go p.writeHitTimeline(batch)
+	}
+}
+
+// FlushHitTimeline writes any buffered cache hits. It does nothing when the
+// hit timeline is not enabled.
+func (p *Proxy) FlushHitTimeline() {
+	t := p.hitTimeline
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	p.writeHitTimeline(batch)
+}
+
+// writeHitTimeline inserts batch into artifact_hits. A failed write loses
+// the batch; it is logged and never affects a response.
+func (p *Proxy) writeHitTimeline(batch []database.ArtifactHit) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := retryOnBusy(func() error { return p.DB.InsertArtifactHits(batch) }); err != nil {
+		p.Logger.Warn("failed to record artifact hits", "hits", len(batch), "error", err)
+	}
+}
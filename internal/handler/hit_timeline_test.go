@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHitTimelineRecordsCacheHits(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "tarball")
+
+	// Hits aren't buffered until the timeline is enabled.
+	result, err := proxy.GetOrFetchArtifact(t.Context(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetOrFetchArtifact: %v", err)
+	}
+	_ = result.Reader.Close()
+	proxy.FlushHitTimeline()
+
+	proxy.EnableHitTimeline()
+	before := time.Now()
+	for range 2 {
+		result, err := proxy.GetOrFetchArtifact(t.Context(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz")
+		if err != nil {
+			t.Fatalf("GetOrFetchArtifact: %v", err)
+		}
+		_ = result.Reader.Close()
+	}
+
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM artifact_hits`); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d hits written before flush, want them buffered", count)
+	}
+
+	proxy.FlushHitTimeline()
+	var hits []struct {
+		VersionPURL string    `db:"version_purl"`
+		Filename    string    `db:"filename"`
+		HitAt       time.Time `db:"hit_at"`
+	}
+	if err := db.Select(&hits, `SELECT version_purl, filename, hit_at FROM artifact_hits`); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("recorded %d hits, want 2", len(hits))
+	}
+	for _, h := range hits {
+		if h.VersionPURL != "pkg:npm/lodash@4.17.21" || h.Filename != "lodash-4.17.21.tgz" {
+			t.Errorf("hit = %+v", h)
+		}
+		if h.HitAt.Before(before.Add(-time.Second)) || h.HitAt.After(time.Now()) {
+			t.Errorf("hit_at = %v, want around %v", h.HitAt, before)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+// isIndexOnly reports whether ecosystem is in index-only mode: metadata is
+// proxied and rewritten as usual, but artifacts are never cached.
+func (p *Proxy) isIndexOnly(ecosystem string) bool {
+	return p.IndexOnly[ecosystem]
+}
+
+// indexOnlyArtifact answers an artifact request in index-only mode. The
+// client is redirected to downloadURL so the bytes never pass through the
+// proxy. Upstreams that need the proxy's own credentials, passed in headers,
+// can't be redirected to, so those artifacts are streamed through instead,
+// still without being stored.
+func (p *Proxy) indexOnlyArtifact(ctx context.Context, ecosystem, versionPURL, downloadURL string, headers http.Header) (*CacheResult, error) {
+	var result *CacheResult
+	if len(headers) > 0 {
+		var err error
+		if result, err = p.fetchUncached(ctx, downloadURL, headers); err != nil {
+			return nil, err
+		}
+	} else {
+		result = &CacheResult{RedirectURL: downloadURL}
+	}
+	attachUsage(ctx, result, ecosystem, versionPURL)
+	noteCacheStatus(ctx, CacheStatusBypass)
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestIndexOnlyRedirectsWithoutCaching(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	proxy.IndexOnly = map[string]bool{"npm": true}
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("\x1f\x8btarball"))}
+
+	w := httptest.NewRecorder()
+	NewNPMHandler(proxy, "http://proxy.local").Routes().ServeHTTP(w,
+		httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if got, want := w.Header().Get("Location"), "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+	if fetcher.fetchCalled {
+		t.Error("index-only artifacts should not be fetched by the proxy")
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %d files, want none", len(store.files))
+	}
+	if n, _ := db.GetCachedArtifactCount(); n != 0 {
+		t.Errorf("recorded %d cached artifacts, want none", n)
+	}
+
+	result, err := proxy.GetOrFetchArtifactFromURL(t.Context(), "npm", "lodash", "4.17.21",
+		"lodash-4.17.21.tgz", "https://cdn.example.com/lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetOrFetchArtifactFromURL: %v", err)
+	}
+	if result.RedirectURL != "https://cdn.example.com/lodash-4.17.21.tgz" {
+		t.Errorf("RedirectURL = %q", result.RedirectURL)
+	}
+
+	// Other ecosystems are still cached.
+	if _, err := proxy.GetOrFetchArtifactFromURL(t.Context(), "cargo", "serde", "1.0.0",
+		"serde-1.0.0.crate", "https://static.crates.io/crates/serde/serde-1.0.0.crate"); err != nil {
+		t.Fatalf("cargo fetch: %v", err)
+	}
+	if n, _ := db.GetCachedArtifactCount(); n != 1 {
+		t.Errorf("recorded %d cached artifacts, want 1", n)
+	}
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// InflightFetch describes an upstream artifact download that is running.
+type InflightFetch struct {
+	Ecosystem string    `json:"ecosystem"`
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	URL       string    `json:"url"`
+	StartedAt time.Time `json:"started_at"`
+	// Bytes is how much of the body has been read from upstream so far.
+	Bytes int64 `json:"bytes"`
+}
+
+// inflightFetch is the live record behind an InflightFetch. url is guarded
+// by Proxy.inflightMu since a fallback may replace it mid-fetch; bytes is
+// updated by the body reader without the lock.
+type inflightFetch struct {
+	ecosystem string
+	name      string
+	version   string
+	url       string
+	startedAt time.Time
+	bytes     atomic.Int64
+}
+
+// trackFetch registers a download that holds a fetch slot and returns its
+// record along with a function that removes it once the download ends.
+func (p *Proxy) trackFetch(ecosystem, name, version, url string) (*inflightFetch, func()) {
+	f := &inflightFetch{
+		ecosystem: ecosystem,
+		name:      name,
+		version:   version,
+		url:       url,
+		startedAt: time.Now(),
+	}
+	p.inflightMu.Lock()
+	if p.inflight == nil {
+		p.inflight = make(map[*inflightFetch]struct{})
+	}
+	p.inflight[f] = struct{}{}
+	p.inflightMu.Unlock()
+	return f, func() {
+		p.inflightMu.Lock()
+		delete(p.inflight, f)
+		p.inflightMu.Unlock()
+	}
+}
+
+// fetched records the URL the body actually came from and wraps body so
+// the bytes read from it are counted.
+func (p *Proxy) fetched(f *inflightFetch, url string, body io.ReadCloser) io.ReadCloser {
+	p.inflightMu.Lock()
+	f.url = url
+	p.inflightMu.Unlock()
+	return &inflightBody{ReadCloser: body, fetch: f}
+}
+
+type inflightBody struct {
+	io.ReadCloser
+	fetch *inflightFetch
+}
+
+func (b *inflightBody) Read(buf []byte) (int, error) {
+	n, err := b.ReadCloser.Read(buf)
+	b.fetch.bytes.Add(int64(n))
+	return n, err
+}
+
+// InflightFetches returns the upstream artifact downloads running now,
+// oldest first.
+func (p *Proxy) InflightFetches() []InflightFetch {
+	p.inflightMu.Lock()
+	fetches := make([]InflightFetch, 0, len(p.inflight))
+	for f := range p.inflight {
+		fetches = append(fetches, InflightFetch{
+			Ecosystem: f.ecosystem,
+			Name:      f.name,
+			Version:   f.version,
+			URL:       f.url,
+			StartedAt: f.startedAt,
+			Bytes:     f.bytes.Load(),
+		})
+	}
+	p.inflightMu.Unlock()
+
+	sort.Slice(fetches, func(i, j int) bool {
+		if !fetches[i].StartedAt.Equal(fetches[j].StartedAt) {
+			return fetches[i].StartedAt.Before(fetches[j].StartedAt)
+		}
+		return fetches[i].URL < fetches[j].URL
+	})
+	return fetches
+}
+
+// InflightHandler serves GET /api/inflight, listing the upstream downloads
+// the proxy is running so operators can see what it is busy with during an
+// incident. Requests must carry the debug bearer token.
+type InflightHandler struct {
+	proxy *Proxy
+	token string
+}
+
+// NewInflightHandler creates the handler. Requests must carry token as a
+// bearer token.
+func NewInflightHandler(proxy *Proxy, token string) *InflightHandler {
+	return &InflightHandler{proxy: proxy, token: token}
+}
+
+func (h *InflightHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !bearerAuthorized(r, h.token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="proxy debug"`)
+		JSONError(w, http.StatusUnauthorized, "debug endpoints require a valid bearer token")
+		return
+	}
+
+	fetches := h.proxy.InflightFetches()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"count":   len(fetches),
+		"fetches": fetches,
+	})
+}
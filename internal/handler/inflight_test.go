@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func getInflight(t *testing.T, h *InflightHandler) []InflightFetch {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/inflight", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Count   int             `json:"count"`
+		Fetches []InflightFetch `json:"fetches"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Count != len(resp.Fetches) {
+		t.Errorf("count = %d, want %d", resp.Count, len(resp.Fetches))
+	}
+	return resp.Fetches
+}
+
+func TestInflightListsRunningFetch(t *testing.T) {
+	const downloadURL = "https://registry.example.com/lodash-4.17.21.tgz"
+	body, upstream := io.Pipe()
+	started := make(chan struct{})
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.Fetcher = &mockFetcherWithHeaders{
+		fetchFn: func(_ context.Context, _ string, _ http.Header) (*fetch.Artifact, error) {
+			close(started)
+			return &fetch.Artifact{Body: body, Size: -1, ContentType: "application/octet-stream"}, nil
+		},
+	}
+	h := NewInflightHandler(proxy, "s3cret")
+
+	if got := getInflight(t, h); len(got) != 0 {
+		t.Fatalf("fetches before download = %+v, want none", got)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		result, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", downloadURL)
+		if err == nil {
+			_ = result.Reader.Close()
+		}
+		done <- err
+	}()
+
+	<-started
+	if _, err := upstream.Write([]byte("partial")); err != nil {
+		t.Fatalf("writing body: %v", err)
+	}
+
+	// The pipe write returns once storage has the bytes, which can be just
+	// before the count is updated.
+	var f InflightFetch
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fetches := getInflight(t, h)
+		if len(fetches) != 1 {
+			t.Fatalf("fetches during download = %+v, want one", fetches)
+		}
+		f = fetches[0]
+		if f.Bytes == int64(len("partial")) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if f.Ecosystem != "npm" || f.Name != "lodash" || f.Version != "4.17.21" || f.URL != downloadURL {
+		t.Errorf("fetch = %+v, want npm lodash 4.17.21 from %s", f, downloadURL)
+	}
+	if f.Bytes != int64(len("partial")) {
+		t.Errorf("bytes = %d, want %d", f.Bytes, len("partial"))
+	}
+	if f.StartedAt.IsZero() {
+		t.Error("started_at not set")
+	}
+
+	_ = upstream.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch did not finish")
+	}
+
+	if got := getInflight(t, h); len(got) != 0 {
+		t.Errorf("fetches after download = %+v, want none", got)
+	}
+}
+
+func TestInflightRequiresToken(t *testing.T) {
+	h := NewInflightHandler(testProxy(), "s3cret")
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/inflight", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want 401", auth, w.Code)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
@@ -138,3 +140,50 @@ func (v *verifyingReader) verify() {
 		}
 	}
 }
+
+// ErrDigestMismatch is returned when content fetched by digest doesn't hash
+// to that digest. Nothing is cached.
+var ErrDigestMismatch = errors.New("content does not match its digest")
+
+type expectDigestKey struct{}
+
+// expectDigest marks artifact downloads made with the returned context as
+// addressed by digest ("sha256:<hex>"), so one whose body hashes to
+// anything else is refused rather than cached.
+func expectDigest(ctx context.Context, digest string) context.Context {
+	return context.WithValue(ctx, expectDigestKey{}, digest)
+}
+
+// checkDigest wraps an upstream artifact body for downloads marked with
+// expectDigest. The read that reaches the end of a body whose sha256 is
+// wrong fails with ErrDigestMismatch, which makes Storage.Store fail before
+// the artifact is recorded.
+func checkDigest(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	digest, _ := ctx.Value(expectDigestKey{}).(string)
+	want, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok {
+		return body
+	}
+	return &digestReader{r: body, h: sha256.New(), want: want}
+}
+
+type digestReader struct {
+	r    io.ReadCloser
+	h    hash.Hash
+	want string
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.h.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(d.h.Sum(nil)); subtle.ConstantTimeCompare([]byte(got), []byte(d.want)) != 1 {
+			return n, fmt.Errorf("%w: got sha256:%s, want sha256:%s", ErrDigestMismatch, got, d.want)
+		}
+	}
+	return n, err
+}
+
+func (d *digestReader) Close() error {
+	return d.r.Close()
+}
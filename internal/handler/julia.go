@@ -88,16 +88,18 @@ func (h *JuliaHandler) handleRegistry(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("julia registry request", "uuid", uuid, "hash", hash)
 
 	upstreamURL := h.upstreamURL + r.URL.Path
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "julia", juliaRegistryName, hash, hash+".tar.gz", upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "julia", juliaRegistryName, hash, hash+".tar.gz", upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get registry", "error", err)
-		http.Error(w, "failed to fetch registry", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get registry", "error", err)
+			http.Error(w, "failed to fetch registry", http.StatusBadGateway)
+		}
 		return
 	}
 
 	go h.refreshNamesFromRegistry(uuid, hash)
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handlePackage serves an immutable package source tarball.
@@ -117,14 +119,16 @@ func (h *JuliaHandler) handlePackage(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("julia package request", "name", name, "uuid", uuid, "hash", hash)
 
 	upstreamURL := h.upstreamURL + r.URL.Path
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "julia", name, hash, hash+".tar.gz", upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "julia", name, hash, hash+".tar.gz", upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get package", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get package", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handleArtifact serves an immutable binary artifact tarball. Artifacts are
@@ -139,14 +143,16 @@ func (h *JuliaHandler) handleArtifact(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("julia artifact request", "hash", hash)
 
 	upstreamURL := h.upstreamURL + r.URL.Path
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "julia", juliaArtifactName, hash, hash+".tar.gz", upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "julia", juliaArtifactName, hash, hash+".tar.gz", upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch artifact", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch artifact", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // proxyUpstream forwards a request to the upstream Pkg server without caching.
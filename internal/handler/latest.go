@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// latestAlias stands in for a version in download paths, e.g.
+// /npm/lodash/-/latest or /cargo/crates/serde/latest/download. It is a
+// convenience for trying the proxy by hand with curl. None of the
+// ecosystems that accept it allow "latest" as a real version, so it never
+// shadows a real download.
+const latestAlias = "latest"
+
+// resolveLatestVersion returns the latest version of a package: the one
+// recorded in the database when known, otherwise whatever enrichment
+// resolves from upstream. Returns "" when neither knows.
+func (p *Proxy) resolveLatestVersion(ctx context.Context, ecosystem, name string) (string, error) {
+	name = Canonicalize(ecosystem, name)
+	if pkg, err := p.DB.GetPackageByEcosystemName(ecosystem, name); err == nil && pkg != nil &&
+		pkg.LatestVersion.Valid && pkg.LatestVersion.String != "" {
+		return pkg.LatestVersion.String, nil
+	}
+	if p.Enrichment == nil {
+		return "", nil
+	}
+	return p.Enrichment.GetLatestVersion(ctx, ecosystem, name)
+}
+
+// redirectToLatest answers a latest alias with a 302 to the concrete
+// download URL that location builds for the resolved version. The redirect
+// isn't cacheable since it moves with every release.
+func (p *Proxy) redirectToLatest(w http.ResponseWriter, r *http.Request, ecosystem, name string, location func(version string) string) {
+	version, err := p.resolveLatestVersion(r.Context(), ecosystem, name)
+	if err != nil {
+		p.Logger.Warn("failed to resolve latest version",
+			"ecosystem", ecosystem, "name", name, "error", err)
+		http.Error(w, "failed to resolve latest version", http.StatusBadGateway)
+		return
+	}
+	if version == "" {
+		http.Error(w, "no latest version known", http.StatusNotFound)
+		return
+	}
+
+	p.Logger.Info("redirecting to latest version",
+		"ecosystem", ecosystem, "name", name, "version", version)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, location(version), http.StatusFound)
+}
+
+// trimLatestFilename returns the package name from a "{name}-latest{ext}"
+// download filename, or "" if filename isn't the latest alias.
+func trimLatestFilename(filename, ext string) string {
+	name, ok := strings.CutSuffix(filename, "-"+latestAlias+ext)
+	if !ok {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/purl"
+)
+
+func recordLatestVersion(t *testing.T, db *database.DB, ecosystem, name, latest string) {
+	t.Helper()
+	err := db.UpsertPackage(&database.Package{
+		PURL:          purl.MakePURLString(ecosystem, name, ""),
+		Ecosystem:     ecosystem,
+		Name:          name,
+		LatestVersion: sql.NullString{String: latest, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("UpsertPackage failed: %v", err)
+	}
+}
+
+func TestLatestRedirects(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+	recordLatestVersion(t, db, "npm", "lodash", "4.17.21")
+	recordLatestVersion(t, db, "npm", "@babel/core", "7.24.0")
+	recordLatestVersion(t, db, "cargo", "serde", "1.0.200")
+	recordLatestVersion(t, db, "gem", "rails", "7.1.3")
+	recordLatestVersion(t, db, "hex", "phoenix", "1.7.12")
+
+	const base = "http://proxy.test"
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		want    string
+	}{
+		{"npm", NewNPMHandler(proxy, base).Routes(), "/lodash/-/latest", base + "/npm/lodash/-/lodash-4.17.21.tgz"},
+		{"npm scoped", NewNPMHandler(proxy, base).Routes(), "/@babel%2fcore/-/latest", base + "/npm/@babel%2Fcore/-/core-7.24.0.tgz"},
+		{"cargo", NewCargoHandler(proxy, base).Routes(), "/crates/serde/latest/download", base + "/cargo/crates/serde/1.0.200/download"},
+		{"gem", NewGemHandler(proxy, base).Routes(), "/gems/rails-latest.gem", base + "/gem/gems/rails-7.1.3.gem"},
+		{"hex", NewHexHandler(proxy, base).Routes(), "/tarballs/phoenix-latest.tar", base + "/hex/tarballs/phoenix-1.7.12.tar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want 302: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+		})
+	}
+}
+
+func TestLatestRedirect_UnknownPackage(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	h := NewNPMHandler(proxy, "http://proxy.test")
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/left-pad/-/latest", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when no latest version is known", w.Code)
+	}
+}
+
+func TestTrimLatestFilename(t *testing.T) {
+	if got := trimLatestFilename("aws-sdk-s3-latest.gem", ".gem"); got != "aws-sdk-s3" {
+		t.Errorf("trimLatestFilename() = %q, want aws-sdk-s3", got)
+	}
+	if got := trimLatestFilename("rails-7.1.3.gem", ".gem"); got != "" {
+		t.Errorf("trimLatestFilename() = %q for a real version, want empty", got)
+	}
+}
@@ -79,6 +79,7 @@ func (h *MavenHandler) handleRequest(w http.ResponseWriter, r *http.Request) {
 func (h *MavenHandler) handleMetadata(w http.ResponseWriter, r *http.Request, urlPath string) {
 	cacheKey := strings.ReplaceAll(urlPath, "/", "_")
 	upstreamURL := fmt.Sprintf("%s/%s", h.upstreamURL, urlPath)
+	setMetadataMaxAge(w, h.proxy.MetadataTTLFor("maven", cacheKey))
 
 	body, contentType, err := h.proxy.FetchOrCacheMetadata(r.Context(), "maven", cacheKey, upstreamURL, "*/*")
 	if err != nil {
@@ -130,16 +131,14 @@ func (h *MavenHandler) handleDownload(w http.ResponseWriter, r *http.Request, ur
 		}
 	}
 	if err != nil {
-		if errors.Is(err, ErrUpstreamNotFound) {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch artifact", http.StatusBadGateway)
 		}
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch artifact", http.StatusBadGateway)
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // parsePath extracts Maven coordinates from a URL path.
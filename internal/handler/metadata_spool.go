@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// metadataSpoolThreshold is the size above which spoolMetadata moves a
+// document from memory to a temporary file.
+const metadataSpoolThreshold = 1 << 20
+
+// metadataSpool is a metadata document read from upstream or the cache. Up
+// to metadataSpoolThreshold bytes it is held in memory; a larger one is
+// written to a temporary file, so it can be read through more than once
+// without being buffered whole.
+type metadataSpool struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+// spoolMetadata reads r into a spool under the same size limit as
+// ReadMetadata.
+func (p *Proxy) spoolMetadata(r io.Reader) (*metadataSpool, error) {
+	limit := p.metadataMaxSize()
+	head, err := io.ReadAll(io.LimitReader(r, min(limit, metadataSpoolThreshold)+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(head)) > limit {
+		return nil, ErrMetadataTooLarge
+	}
+	if len(head) <= metadataSpoolThreshold {
+		return &metadataSpool{data: head, size: int64(len(head))}, nil
+	}
+
+	f, err := os.CreateTemp("", "proxy-metadata-*")
+	if err != nil {
+		return nil, err
+	}
+	s := &metadataSpool{file: f}
+	rest := io.LimitReader(r, limit+1-int64(len(head)))
+	s.size, err = io.Copy(f, io.MultiReader(bytes.NewReader(head), rest))
+	if err == nil && s.size > limit {
+		err = ErrMetadataTooLarge
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Size returns the length of the document.
+func (s *metadataSpool) Size() int64 {
+	return s.size
+}
+
+// Reader returns a reader over the whole document. Each call starts at the
+// beginning, and readers may be used concurrently.
+func (s *metadataSpool) Reader() io.Reader {
+	if s.file == nil {
+		return bytes.NewReader(s.data)
+	}
+	return io.NewSectionReader(s.file, 0, s.size)
+}
+
+// Bytes returns the document, reading it into memory if it was spooled to
+// disk.
+func (s *metadataSpool) Bytes() ([]byte, error) {
+	if s.file == nil {
+		return s.data, nil
+	}
+	return io.ReadAll(s.Reader())
+}
+
+// Close removes the temporary file, if there is one.
+func (s *metadataSpool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if rmErr := os.Remove(s.file.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
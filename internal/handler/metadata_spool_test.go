@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpoolMetadata(t *testing.T) {
+	p := &Proxy{MetadataMaxSize: 4 * metadataSpoolThreshold}
+
+	t.Run("small body stays in memory", func(t *testing.T) {
+		spool, err := p.spoolMetadata(bytes.NewReader([]byte("hello world")))
+		if err != nil {
+			t.Fatalf("spoolMetadata: %v", err)
+		}
+		defer func() { _ = spool.Close() }()
+		if spool.file != nil {
+			t.Error("small body was spooled to disk")
+		}
+		if got, _ := spool.Bytes(); string(got) != "hello world" {
+			t.Errorf("Bytes() = %q", got)
+		}
+	})
+
+	t.Run("large body goes to disk", func(t *testing.T) {
+		data := bytes.Repeat([]byte("x"), 2*metadataSpoolThreshold)
+		spool, err := p.spoolMetadata(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("spoolMetadata: %v", err)
+		}
+		if spool.file == nil {
+			t.Fatal("large body was held in memory")
+		}
+		if spool.Size() != int64(len(data)) {
+			t.Errorf("Size() = %d, want %d", spool.Size(), len(data))
+		}
+		for range 2 {
+			got, err := io.ReadAll(spool.Reader())
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("Reader() returned %d bytes, err %v", len(got), err)
+			}
+		}
+
+		name := spool.file.Name()
+		if err := spool.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("spool file %s still exists after Close", name)
+		}
+	})
+
+	t.Run("over limit", func(t *testing.T) {
+		data := bytes.Repeat([]byte("x"), 4*metadataSpoolThreshold+1)
+		if _, err := p.spoolMetadata(bytes.NewReader(data)); !errors.Is(err, ErrMetadataTooLarge) {
+			t.Errorf("err = %v, want ErrMetadataTooLarge", err)
+		}
+	})
+}
+
+func TestCoalesceMetadataSpoolClosesAfterLastRelease(t *testing.T) {
+	p := testProxy()
+	data := bytes.Repeat([]byte("x"), 2*metadataSpoolThreshold)
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*metadataSpool, error) {
+		<-release
+		return p.spoolMetadata(bytes.NewReader(data))
+	}
+
+	type result struct {
+		spool   *metadataSpool
+		release func()
+	}
+	results := make(chan result, 2)
+	for range 2 {
+		go func() {
+			spool, done, err := p.coalesceMetadataSpool(context.Background(), "key", fetch)
+			if err != nil {
+				t.Errorf("coalesceMetadataSpool: %v", err)
+			}
+			results <- result{spool, done}
+		}()
+	}
+	for {
+		p.spoolFlight.mu.Lock()
+		joined := p.spoolFlight.calls["key"] != nil && p.spoolFlight.calls["key"].callers == 2
+		p.spoolFlight.mu.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	a, b := <-results, <-results
+	if a.spool != b.spool {
+		t.Fatal("concurrent callers got different spools")
+	}
+	name := a.spool.file.Name()
+
+	a.release()
+	if _, err := io.ReadAll(b.spool.Reader()); err != nil {
+		t.Fatalf("reading after the other caller released: %v", err)
+	}
+	b.release()
+	for {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Artifacts are cached under version PURL and filename, which only
+// identifies the bytes if upstream sends the same ones whatever the
+// request's Accept header says. Of the artifact downloads:
+//
+//   - cargo, composer, conan, conda, cran, debian, gem, golang, hex, julia,
+//     maven, npm, nuget, pub, pypi and rpm send no Accept header; upstream
+//     has one representation per file.
+//   - oci blobs and manifests fetched by digest send a fixed Accept, but
+//     the digest names the exact bytes, so it can't select a different
+//     variant.
+//
+// Metadata negotiates in places (PyPI simple pages, container manifests by
+// tag) and keys its own cache on the format; see pypiSimpleFormat.cacheKey.
+// artifactVariantFilename covers any future artifact download that does
+// forward an Accept header, so two representations never share an entry.
+
+// artifactVariantSeparator joins a filename and its variant discriminator.
+const artifactVariantSeparator = "~"
+
+// artifactVariantFilename returns the filename an artifact fetched with
+// headers is cached under. When headers carry an Accept header and the
+// artifact isn't addressed by content digest, a short hash of the
+// normalized Accept value is appended so each variant gets its own cache
+// entry. Otherwise filename is returned unchanged.
+func artifactVariantFilename(filename, version string, headers http.Header) string {
+	accept := normalizeAccept(headers.Get("Accept"))
+	if accept == "" || isDigestReference(version) || isDigestReference(filename) {
+		return filename
+	}
+	sum := sha256.Sum256([]byte(accept))
+	return filename + artifactVariantSeparator + hex.EncodeToString(sum[:6])
+}
+
+// normalizeAccept lowercases an Accept value and strips the whitespace
+// around its media ranges and parameters, so spellings that differ only in
+// formatting select the same variant. Order is kept since it can matter.
+func normalizeAccept(accept string) string {
+	ranges := strings.Split(accept, ",")
+	out := ranges[:0]
+	for _, r := range ranges {
+		params := strings.Split(r, ";")
+		for i, p := range params {
+			params[i] = strings.ToLower(strings.TrimSpace(p))
+		}
+		if params[0] == "" {
+			continue
+		}
+		out = append(out, strings.Join(params, ";"))
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestNegotiatedArtifactVariantsCachedSeparately(t *testing.T) {
+	const downloadURL = "https://downloads.example.com/widget/1.0.0/widget-1.0.0.bin"
+	variants := map[string]string{
+		"application/vnd.widget.v1": "widget v1 bytes",
+		"application/vnd.widget.v2": "widget v2 bytes",
+	}
+
+	proxy, _, _, _ := setupTestProxy(t)
+	fetches := 0
+	proxy.Fetcher = &mockFetcherWithHeaders{
+		fetchFn: func(_ context.Context, _ string, headers http.Header) (*fetch.Artifact, error) {
+			fetches++
+			body := variants[headers.Get("Accept")]
+			return &fetch.Artifact{Body: io.NopCloser(strings.NewReader(body)), Size: int64(len(body))}, nil
+		},
+	}
+
+	get := func(accept string) (string, bool) {
+		t.Helper()
+		result, err := proxy.GetOrFetchArtifactFromURLWithHeaders(context.Background(),
+			"generic", "widget", "1.0.0", "widget-1.0.0.bin", downloadURL, http.Header{"Accept": {accept}})
+		if err != nil {
+			t.Fatalf("Accept %s: %v", accept, err)
+		}
+		defer func() { _ = result.Reader.Close() }()
+		body, err := io.ReadAll(result.Reader)
+		if err != nil {
+			t.Fatalf("reading body: %v", err)
+		}
+		return string(body), result.Cached
+	}
+
+	for accept, want := range variants {
+		if got, cached := get(accept); got != want || cached {
+			t.Errorf("first fetch with Accept %s = %q (cached %v), want %q from upstream", accept, got, cached, want)
+		}
+	}
+	for accept, want := range variants {
+		if got, cached := get(accept); got != want || !cached {
+			t.Errorf("second fetch with Accept %s = %q (cached %v), want cached %q", accept, got, cached, want)
+		}
+	}
+	if fetches != len(variants) {
+		t.Errorf("upstream fetched %d times, want %d", fetches, len(variants))
+	}
+}
+
+func TestArtifactVariantFilename(t *testing.T) {
+	accept := func(v string) http.Header { return http.Header{"Accept": {v}} }
+
+	if got := artifactVariantFilename("a.tgz", "1.0.0", nil); got != "a.tgz" {
+		t.Errorf("no headers = %q, want a.tgz unchanged", got)
+	}
+	if got := artifactVariantFilename("manifest.json", "sha256:abc", accept("application/json")); got != "manifest.json" {
+		t.Errorf("digest version = %q, want manifest.json unchanged", got)
+	}
+
+	v1 := artifactVariantFilename("a.tgz", "1.0.0", accept("application/json; q=0.9, text/plain"))
+	if !strings.HasPrefix(v1, "a.tgz"+artifactVariantSeparator) {
+		t.Errorf("negotiated filename = %q, want a.tgz%s<variant>", v1, artifactVariantSeparator)
+	}
+	if got := artifactVariantFilename("a.tgz", "1.0.0", accept("Application/JSON;q=0.9,text/plain")); got != v1 {
+		t.Errorf("reformatted Accept = %q, want same variant %q", got, v1)
+	}
+	if got := artifactVariantFilename("a.tgz", "1.0.0", accept("text/plain")); got == v1 {
+		t.Errorf("different Accept shares variant %q", got)
+	}
+}
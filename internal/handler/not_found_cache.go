@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// defaultNotFoundTTL is how long an upstream 404 for an artifact is
+// remembered when Proxy.NotFoundTTL is not set by the server.
+const defaultNotFoundTTL = time.Minute
+
+// maxNotFoundEntries bounds the negative cache so a flood of requests for
+// made-up versions can't grow it without limit.
+const maxNotFoundEntries = 10000
+
+// upstreamNotFound wraps a fetch or resolve error so callers can match
+// either ErrUpstreamNotFound or the underlying fetch.ErrNotFound.
+func upstreamNotFound(err error) error {
+	return fmt.Errorf("%w: %w", ErrUpstreamNotFound, err)
+}
+
+// isNotFoundCached reports whether key recently returned 404 upstream.
+func (p *Proxy) isNotFoundCached(key string) bool {
+	if p.NotFoundTTL <= 0 {
+		return false
+	}
+	p.notFoundMu.Lock()
+	defer p.notFoundMu.Unlock()
+	expires, ok := p.notFound[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(p.notFound, key)
+		return false
+	}
+	return true
+}
+
+// rememberNotFound records an upstream 404 for key if err is one.
+func (p *Proxy) rememberNotFound(key string, err error) {
+	if p.NotFoundTTL <= 0 || !errors.Is(err, fetch.ErrNotFound) {
+		return
+	}
+	p.notFoundMu.Lock()
+	defer p.notFoundMu.Unlock()
+	if p.notFound == nil {
+		p.notFound = make(map[string]time.Time)
+	}
+	now := time.Now()
+	if len(p.notFound) >= maxNotFoundEntries {
+		for k, expires := range p.notFound {
+			if now.After(expires) {
+				delete(p.notFound, k)
+			}
+		}
+		if len(p.notFound) >= maxNotFoundEntries {
+			return
+		}
+	}
+	p.notFound[key] = now.Add(p.NotFoundTTL)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestGetOrFetchArtifactFromURL_NotFoundIsNegativelyCached(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	fetcher.fetchErr = fetch.ErrNotFound
+
+	const downloadURL = "https://files.pythonhosted.org/packages/ab/cd/missing-9.9.9.tar.gz"
+	for i := range 2 {
+		_, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "pypi", "missing", "9.9.9", "missing-9.9.9.tar.gz", downloadURL)
+		if !errors.Is(err, ErrUpstreamNotFound) {
+			t.Fatalf("request %d: expected ErrUpstreamNotFound, got %v", i+1, err)
+		}
+		if !errors.Is(err, fetch.ErrNotFound) {
+			t.Fatalf("request %d: expected error to wrap fetch.ErrNotFound, got %v", i+1, err)
+		}
+	}
+
+	if fetcher.fetchCount != 1 {
+		t.Errorf("upstream fetched %d times, want 1", fetcher.fetchCount)
+	}
+}
+
+func TestGetOrFetchArtifactFromURL_NotFoundCacheExpires(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	proxy.NotFoundTTL = time.Millisecond
+	fetcher.fetchErr = fetch.ErrNotFound
+
+	const downloadURL = "https://files.pythonhosted.org/packages/ab/cd/missing-9.9.9.tar.gz"
+	_, _ = proxy.GetOrFetchArtifactFromURL(context.Background(), "pypi", "missing", "9.9.9", "missing-9.9.9.tar.gz", downloadURL)
+	time.Sleep(5 * time.Millisecond)
+	_, _ = proxy.GetOrFetchArtifactFromURL(context.Background(), "pypi", "missing", "9.9.9", "missing-9.9.9.tar.gz", downloadURL)
+
+	if fetcher.fetchCount != 2 {
+		t.Errorf("upstream fetched %d times, want 2 after the negative cache entry expired", fetcher.fetchCount)
+	}
+}
+
+func TestGetOrFetchArtifactFromURL_TransportErrorNotCached(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	fetcher.fetchErr = errors.New("connection refused")
+
+	const downloadURL = "https://files.pythonhosted.org/packages/ab/cd/flaky-1.0.0.tar.gz"
+	for range 2 {
+		_, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "pypi", "flaky", "1.0.0", "flaky-1.0.0.tar.gz", downloadURL)
+		if errors.Is(err, ErrUpstreamNotFound) {
+			t.Fatalf("transport error should not be reported as not found: %v", err)
+		}
+	}
+
+	if fetcher.fetchCount != 2 {
+		t.Errorf("upstream fetched %d times, want 2", fetcher.fetchCount)
+	}
+}
+
+func TestNPMDownload_UpstreamNotFound(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	fetcher.fetchErr = fetch.ErrNotFound
+
+	h := NewNPMHandler(proxy, "http://localhost:8080")
+	routes := h.Routes()
+
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-0.0.0-missing.tgz", nil)
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("request %d: status = %d, want %d (body %q)", i+1, w.Code, http.StatusNotFound, w.Body.String())
+		}
+	}
+
+	if fetcher.fetchCount != 1 {
+		t.Errorf("upstream fetched %d times, want 1", fetcher.fetchCount)
+	}
+}
@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"sort"
@@ -21,7 +23,7 @@ const (
 type NPMHandler struct {
 	proxy       *Proxy
 	upstreamURL string
-	proxyURL    string // URL where this proxy is hosted
+	linkBase
 }
 
 // NewNPMHandler creates a new npm protocol handler.
@@ -29,7 +31,7 @@ func NewNPMHandler(proxy *Proxy, proxyURL string) *NPMHandler {
 	return &NPMHandler{
 		proxy:       proxy,
 		upstreamURL: npmUpstream,
-		proxyURL:    strings.TrimSuffix(proxyURL, "/"),
+		linkBase:    linkBase{proxyURL: strings.TrimSuffix(proxyURL, "/")},
 	}
 }
 
@@ -37,15 +39,31 @@ func NewNPMHandler(proxy *Proxy, proxyURL string) *NPMHandler {
 // Mount this at /npm on your router.
 func (h *NPMHandler) Routes() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		path := strings.TrimPrefix(r.URL.Path, "/")
+
+		if path == npmAuditQuickPath {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.handleAuditQuick(w, r)
 			return
 		}
 
-		path := strings.TrimPrefix(r.URL.Path, "/")
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			h.handleWrite(w, r)
+			return
+		}
 
-		// Check if this is a tarball download (contains /-/)
-		if strings.Contains(path, "/-/") {
+		// Check if this is a tarball download (contains /-/). npm may
+		// check a tarball with HEAD before fetching it.
+		isDownload := strings.Contains(path, "/-/")
+		if r.Method != http.MethodGet && (r.Method != http.MethodHead || !isDownload) {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if isDownload {
 			h.handleDownload(w, r)
 			return
 		}
@@ -64,8 +82,25 @@ func (h *NPMHandler) handlePackageMetadata(w http.ResponseWriter, r *http.Reques
 	}
 
 	h.proxy.Logger.Info("npm metadata request", "package", packageName)
+	setMetadataMaxAge(w, h.proxy.MetadataTTLFor("npm", packageName))
+
+	local, err := h.loadLocalPackument(Canonicalize("npm", packageName))
+	if err != nil {
+		h.proxy.Logger.Error("failed to load npm packument", "package", packageName, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to load package")
+		return
+	}
+	if local != nil && npmUnpublished(local) {
+		JSONError(w, http.StatusNotFound, "package was unpublished")
+		return
+	}
+	if local != nil {
+		forRequest(h, r).serveLocalPackument(w, Canonicalize("npm", packageName), local)
+		return
+	}
 
-	upstreamURL := fmt.Sprintf("%s/%s", h.upstreamURL, url.PathEscape(packageName))
+	upstream, _ := h.upstreamFor(packageName)
+	upstreamURL := fmt.Sprintf("%s/%s", upstream, url.PathEscape(packageName))
 
 	// Use abbreviated metadata when cooldown is disabled — it's much smaller
 	// (e.g. drizzle-orm: 4MB vs 92MB) but lacks the time map needed for cooldown.
@@ -74,7 +109,11 @@ func (h *NPMHandler) handlePackageMetadata(w http.ResponseWriter, r *http.Reques
 		accept = contentTypeJSON
 	}
 
-	body, _, err := h.proxy.FetchOrCacheMetadata(r.Context(), "npm", packageName, upstreamURL, accept)
+	policy := metadataCachePolicy{enabled: h.proxy.CacheMetadata, ttl: h.proxy.MetadataTTLFor("npm", packageName)}
+	spool, release, err := h.proxy.coalesceMetadataSpool(r.Context(), metadataFlightKey(upstreamURL, accept), func(ctx context.Context) (*metadataSpool, error) {
+		spool, _, err := h.proxy.fetchOrCacheMetadataSpool(ctx, "npm", packageName, upstreamURL, policy, accept)
+		return spool, err
+	})
 	if err != nil {
 		if errors.Is(err, ErrUpstreamNotFound) {
 			JSONError(w, http.StatusNotFound, "package not found")
@@ -84,20 +123,40 @@ func (h *NPMHandler) handlePackageMetadata(w http.ResponseWriter, r *http.Reques
 		JSONError(w, http.StatusBadGateway, "failed to fetch from upstream")
 		return
 	}
+	defer release()
 
-	rewritten, err := h.rewriteMetadata(packageName, body)
-	if err != nil {
-		// If rewriting fails, just proxy the original
-		h.proxy.Logger.Warn("failed to rewrite metadata, proxying original", "error", err)
-		w.Header().Set("Content-Type", contentTypeJSON)
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(body)
+	forRequest(h, r).writePackageMetadata(w, packageName, spool)
+}
+
+// writePackageMetadata rewrites the packument in spool for this proxy and
+// writes it to w. Packuments larger than npmStreamRewriteMin go through the
+// token rewriter, straight from the spool into w; smaller ones are decoded
+// whole. If rewriting fails the original is served.
+func (h *NPMHandler) writePackageMetadata(w http.ResponseWriter, packageName string, spool *metadataSpool) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	if spool.Size() > npmStreamRewriteMin {
+		if err := h.streamRewriteMetadata(w, packageName, spool); err != nil {
+			h.proxy.Logger.Warn("failed to rewrite metadata, proxying original", "error", err)
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.Copy(w, spool.Reader())
+		}
 		return
 	}
 
-	w.Header().Set("Content-Type", contentTypeJSON)
+	body, err := spool.Bytes()
+	if err != nil {
+		h.proxy.Logger.Error("failed to read npm metadata", "package", packageName, "error", err)
+		JSONError(w, http.StatusBadGateway, "failed to fetch from upstream")
+		return
+	}
+	if rewritten, err := h.rewriteMetadata(packageName, body); err != nil {
+		h.proxy.Logger.Warn("failed to rewrite metadata, proxying original", "error", err)
+	} else {
+		body = rewritten
+	}
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(rewritten)
+	_, _ = w.Write(body)
 }
 
 // rewriteMetadata rewrites tarball URLs in npm package metadata to point at this proxy.
@@ -194,20 +253,33 @@ func (h *NPMHandler) rewriteTarballURLs(versions map[string]any, packageName str
 		if !ok {
 			continue
 		}
-
-		filename := tarball
-		if idx := strings.LastIndex(tarball, "/"); idx >= 0 {
-			filename = tarball[idx+1:]
+		if newTarball, ok := h.rewriteTarballURL(packageName, version, tarball); ok {
+			dist["tarball"] = newTarball
 		}
+	}
+}
 
-		escapedName := url.PathEscape(packageName)
-		newTarball := fmt.Sprintf("%s/npm/%s/-/%s", h.proxyURL, escapedName, filename)
-		dist["tarball"] = newTarball
+// rewriteTarballURL returns the proxy URL for one version's tarball. ok is
+// false, and the URL is left alone, when the tarball isn't on a trusted
+// upstream.
+func (h *NPMHandler) rewriteTarballURL(packageName, version, tarball string) (string, bool) {
+	if !h.isTrustedTarball(packageName, tarball) {
+		h.proxy.logUntrustedUpstream("npm", tarball)
+		return "", false
+	}
 
-		h.proxy.Logger.Debug("rewrote tarball URL",
-			"package", packageName, "version", version,
-			"old", tarball, "new", newTarball)
+	filename := tarball
+	if idx := strings.LastIndex(tarball, "/"); idx >= 0 {
+		filename = tarball[idx+1:]
 	}
+
+	escapedName := url.PathEscape(packageName)
+	newTarball := fmt.Sprintf("%s/npm/%s/-/%s", h.proxyURL, escapedName, filename)
+
+	h.proxy.Logger.Debug("rewrote tarball URL",
+		"package", packageName, "version", version,
+		"old", tarball, "new", newTarball)
+	return newTarball, true
 }
 
 // findNewestVersion returns the version string with the most recent timestamp
@@ -251,6 +323,18 @@ func (h *NPMHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if filename == latestAlias {
+		h.proxy.redirectToLatest(w, r, "npm", packageName, func(version string) string {
+			shortName := packageName
+			if _, after, ok := strings.Cut(packageName, "/"); ok {
+				shortName = after
+			}
+			return fmt.Sprintf("%s/npm/%s/-/%s-%s.tgz",
+				requestBaseURL(r, h.proxyURL), url.PathEscape(packageName), shortName, version)
+		})
+		return
+	}
+
 	// Extract version from filename (e.g., "lodash-4.17.21.tgz" -> "4.17.21")
 	version := h.extractVersionFromFilename(packageName, filename)
 	if version == "" {
@@ -261,14 +345,53 @@ func (h *NPMHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("npm download request",
 		"package", packageName, "version", version, "filename", filename)
 
-	result, err := h.proxy.GetOrFetchArtifact(r.Context(), "npm", packageName, version, filename)
+	local, err := h.localPackument(Canonicalize("npm", packageName))
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		JSONError(w, http.StatusBadGateway, "failed to fetch package")
+		h.proxy.Logger.Error("failed to load npm packument", "package", packageName, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to load package")
+		return
+	}
+	if local != nil {
+		h.serveLocalTarball(w, r, Canonicalize("npm", packageName), version, filename)
 		return
 	}
 
-	ServeArtifact(w, result)
+	downloadURL := h.scopedTarballURL(packageName, filename)
+
+	if r.Method == http.MethodHead {
+		result, err := h.proxy.HeadArtifact(r.Context(), "npm", packageName, version, filename, downloadURL)
+		if err != nil {
+			h.writeDownloadError(w, err)
+			return
+		}
+		h.proxy.ServeArtifactHead(w, result)
+		return
+	}
+
+	var result *CacheResult
+	if downloadURL != "" {
+		result, err = h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "npm", packageName, version, filename, downloadURL)
+	} else {
+		result, err = h.proxy.GetOrFetchArtifact(expectBinary(r.Context()), "npm", packageName, version, filename)
+	}
+	if err != nil {
+		h.writeDownloadError(w, err)
+		return
+	}
+
+	h.proxy.ServeArtifact(w, result)
+}
+
+// writeDownloadError answers a tarball download or HEAD request that failed.
+func (h *NPMHandler) writeDownloadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUpstreamNotFound) {
+		JSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !writeArtifactError(w, err) {
+		h.proxy.Logger.Error("failed to get artifact", "error", err)
+		JSONError(w, http.StatusBadGateway, "failed to fetch package")
+	}
 }
 
 // extractPackageName extracts the package name from the request path.
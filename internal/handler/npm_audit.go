@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/git-pkgs/proxy/internal/enrichment"
+	"github.com/git-pkgs/purl"
+)
+
+// npmAuditQuickPath is where npm posts its dependency tree for `npm audit`.
+const npmAuditQuickPath = "-/npm/v1/security/audits/quick"
+
+// maxAuditRequestSize caps the audit request body. Lockfile trees for large
+// monorepos run to several megabytes.
+const maxAuditRequestSize = 32 << 20 // 32 MB
+
+// npmAuditRequest is the body npm sends: the root package plus its resolved
+// dependency tree, shaped like a v1 package-lock.
+type npmAuditRequest struct {
+	Name         string                        `json:"name"`
+	Version      string                        `json:"version"`
+	Requires     map[string]string             `json:"requires"`
+	Dependencies map[string]npmAuditDependency `json:"dependencies"`
+}
+
+type npmAuditDependency struct {
+	Version      string                        `json:"version"`
+	Dev          bool                          `json:"dev"`
+	Optional     bool                          `json:"optional"`
+	Bundled      bool                          `json:"bundled"`
+	Dependencies map[string]npmAuditDependency `json:"dependencies"`
+}
+
+// npmAuditResponse follows the report format of the npm registry's quick
+// audit endpoint.
+type npmAuditResponse struct {
+	Actions    []npmAuditAction         `json:"actions"`
+	Advisories map[string]npmAdvisory   `json:"advisories"`
+	Muted      []any                    `json:"muted"`
+	Metadata   npmAuditResponseMetadata `json:"metadata"`
+}
+
+type npmAuditAction struct {
+	Action   string            `json:"action"`
+	Module   string            `json:"module"`
+	Target   string            `json:"target,omitempty"`
+	IsMajor  bool              `json:"isMajor"`
+	Resolves []npmAuditResolve `json:"resolves"`
+}
+
+type npmAuditResolve struct {
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	Dev      bool   `json:"dev"`
+	Optional bool   `json:"optional"`
+	Bundled  bool   `json:"bundled"`
+}
+
+type npmAdvisory struct {
+	ID                 int               `json:"id"`
+	GitHubAdvisoryID   string            `json:"github_advisory_id"`
+	Title              string            `json:"title"`
+	ModuleName         string            `json:"module_name"`
+	Severity           string            `json:"severity"`
+	URL                string            `json:"url"`
+	Overview           string            `json:"overview"`
+	Recommendation     string            `json:"recommendation"`
+	References         string            `json:"references"`
+	VulnerableVersions string            `json:"vulnerable_versions"`
+	PatchedVersions    string            `json:"patched_versions"`
+	CVSS               npmAdvisoryCVSS   `json:"cvss"`
+	Findings           []npmAuditFinding `json:"findings"`
+	Access             string            `json:"access"`
+}
+
+type npmAdvisoryCVSS struct {
+	Score float64 `json:"score"`
+}
+
+type npmAuditFinding struct {
+	Version string   `json:"version"`
+	Paths   []string `json:"paths"`
+}
+
+type npmAuditResponseMetadata struct {
+	Vulnerabilities      map[string]int `json:"vulnerabilities"`
+	Dependencies         int            `json:"dependencies"`
+	DevDependencies      int            `json:"devDependencies"`
+	OptionalDependencies int            `json:"optionalDependencies"`
+	TotalDependencies    int            `json:"totalDependencies"`
+}
+
+// auditedPackage is one name@version found in the tree, with every path
+// that reaches it.
+type auditedPackage struct {
+	name, version string
+	paths         []string
+	dev, optional bool
+	bundled       bool
+	topLevel      bool
+}
+
+// handleAuditQuick answers `npm audit` by checking every package in the
+// posted tree against the configured vulnerability sources.
+func (h *NPMHandler) handleAuditQuick(w http.ResponseWriter, r *http.Request) {
+	if h.proxy.Enrichment == nil {
+		JSONError(w, http.StatusServiceUnavailable, "audit is not available")
+		return
+	}
+
+	var req npmAuditRequest
+	body := http.MaxBytesReader(w, r.Body, maxAuditRequestSize)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid audit request")
+		return
+	}
+	_, _ = io.Copy(io.Discard, body)
+
+	pkgs := flattenAuditTree(req)
+
+	queries := make([]struct{ Ecosystem, Name, Version string }, len(pkgs))
+	for i, p := range pkgs {
+		queries[i] = struct{ Ecosystem, Name, Version string }{"npm", p.name, p.version}
+	}
+
+	results, err := h.proxy.Enrichment.BulkCheckVulnerabilities(r.Context(), queries)
+	if err != nil {
+		h.proxy.Logger.Error("npm audit vulnerability lookup failed", "error", err)
+		JSONError(w, http.StatusBadGateway, "vulnerability lookup failed")
+		return
+	}
+
+	resp := buildAuditResponse(pkgs, results)
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// flattenAuditTree walks the dependency tree and returns each distinct
+// name@version, sorted by name then version so advisory ids are stable.
+func flattenAuditTree(req npmAuditRequest) []*auditedPackage {
+	byKey := make(map[string]*auditedPackage)
+	var walk func(deps map[string]npmAuditDependency, parent string, top bool)
+	walk = func(deps map[string]npmAuditDependency, parent string, top bool) {
+		for name, dep := range deps {
+			if dep.Version == "" {
+				continue
+			}
+			p := name
+			if parent != "" {
+				p = parent + ">" + name
+			}
+			key := name + "@" + dep.Version
+			ap, ok := byKey[key]
+			if !ok {
+				ap = &auditedPackage{name: name, version: dep.Version, dev: dep.Dev, optional: dep.Optional, bundled: dep.Bundled}
+				byKey[key] = ap
+			}
+			ap.paths = append(ap.paths, p)
+			if top {
+				ap.topLevel = true
+			}
+			walk(dep.Dependencies, p, false)
+		}
+	}
+	walk(req.Dependencies, "", true)
+
+	pkgs := make([]*auditedPackage, 0, len(byKey))
+	for _, ap := range byKey {
+		sort.Strings(ap.paths)
+		pkgs = append(pkgs, ap)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].name != pkgs[j].name {
+			return pkgs[i].name < pkgs[j].name
+		}
+		return pkgs[i].version < pkgs[j].version
+	})
+	return pkgs
+}
+
+func buildAuditResponse(pkgs []*auditedPackage, results map[string][]enrichment.VulnInfo) *npmAuditResponse {
+	resp := &npmAuditResponse{
+		Actions:    []npmAuditAction{},
+		Advisories: map[string]npmAdvisory{},
+		Muted:      []any{},
+		Metadata: npmAuditResponseMetadata{
+			Vulnerabilities: map[string]int{"info": 0, "low": 0, "moderate": 0, "high": 0, "critical": 0},
+		},
+	}
+
+	// npm identifies advisories by integer; OSV ids are strings, so assign
+	// sequential ids and keep the original as github_advisory_id.
+	advisoryIDs := make(map[string]int)
+
+	for _, p := range pkgs {
+		switch {
+		case p.dev:
+			resp.Metadata.DevDependencies++
+		case p.optional:
+			resp.Metadata.OptionalDependencies++
+		default:
+			resp.Metadata.Dependencies++
+		}
+
+		vulns := results[purl.MakePURLString("npm", p.name, p.version)]
+		for _, v := range vulns {
+			id, ok := advisoryIDs[v.ID]
+			if !ok {
+				id = len(advisoryIDs) + 1
+				advisoryIDs[v.ID] = id
+				resp.Advisories[strconv.Itoa(id)] = newNPMAdvisory(id, p.name, v)
+			}
+			adv := resp.Advisories[strconv.Itoa(id)]
+			adv.Findings = append(adv.Findings, npmAuditFinding{Version: p.version, Paths: p.paths})
+			resp.Advisories[strconv.Itoa(id)] = adv
+			resp.Metadata.Vulnerabilities[adv.Severity] += len(p.paths)
+
+			resp.Actions = append(resp.Actions, auditAction(p, id, v.FixedVersion))
+		}
+	}
+	resp.Metadata.TotalDependencies = resp.Metadata.Dependencies + resp.Metadata.DevDependencies + resp.Metadata.OptionalDependencies
+
+	return resp
+}
+
+func newNPMAdvisory(id int, module string, v enrichment.VulnInfo) npmAdvisory {
+	adv := npmAdvisory{
+		ID:                 id,
+		GitHubAdvisoryID:   v.ID,
+		Title:              v.Summary,
+		ModuleName:         module,
+		Severity:           npmSeverity(v.Severity),
+		URL:                "https://osv.dev/vulnerability/" + v.ID,
+		Overview:           v.Summary,
+		References:         strings.Join(v.References, "\n"),
+		VulnerableVersions: "*",
+		PatchedVersions:    "<0.0.0",
+		Access:             "public",
+	}
+	if adv.Title == "" {
+		adv.Title = v.ID
+	}
+	if v.CVSSScore > 0 {
+		adv.CVSS.Score = v.CVSSScore
+	}
+	if v.FixedVersion != "" {
+		adv.VulnerableVersions = "<" + v.FixedVersion
+		adv.PatchedVersions = ">=" + v.FixedVersion
+		adv.Recommendation = "Upgrade to version " + v.FixedVersion + " or later"
+	} else {
+		adv.Recommendation = "None available"
+	}
+	return adv
+}
+
+// auditAction suggests how to resolve one advisory. Direct dependencies can
+// be installed at the fixed version; transitive ones need their parent
+// updated; without a fix the only option is to review.
+func auditAction(p *auditedPackage, id int, fixed string) npmAuditAction {
+	a := npmAuditAction{Action: "review", Module: p.name}
+	if fixed != "" {
+		a.Target = fixed
+		a.IsMajor = majorVersion(fixed) != majorVersion(p.version)
+		if p.topLevel {
+			a.Action = "install"
+		} else {
+			a.Action = "update"
+		}
+	}
+	for _, path := range p.paths {
+		a.Resolves = append(a.Resolves, npmAuditResolve{
+			ID:       id,
+			Path:     path,
+			Dev:      p.dev,
+			Optional: p.optional,
+			Bundled:  p.bundled,
+		})
+	}
+	return a
+}
+
+// npmSeverity maps a vulnerability level onto npm's scale. Unknown severity
+// is reported as moderate so it still fails the default audit level.
+func npmSeverity(level string) string {
+	switch strings.ToLower(level) {
+	case "critical":
+		return "critical"
+	case "high":
+		return "high"
+	case "low":
+		return "low"
+	default:
+		return "moderate"
+	}
+}
+
+func majorVersion(v string) string {
+	v = strings.TrimPrefix(v, "v")
+	if idx := strings.IndexByte(v, '.'); idx >= 0 {
+		return v[:idx]
+	}
+	return v
+}
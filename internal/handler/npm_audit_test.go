@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/enrichment"
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/vulns"
+)
+
+// auditVulnSource reports vulnerabilities for specific name@version pairs.
+type auditVulnSource struct {
+	byPackage map[string][]vulns.Vulnerability
+	err       error
+	queried   []string
+}
+
+func (s *auditVulnSource) Name() string { return "test" }
+
+func (s *auditVulnSource) Query(_ context.Context, p *purl.PURL) ([]vulns.Vulnerability, error) {
+	return s.byPackage[p.Name+"@"+p.Version], s.err
+}
+
+func (s *auditVulnSource) QueryBatch(_ context.Context, purls []*purl.PURL) ([][]vulns.Vulnerability, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	out := make([][]vulns.Vulnerability, len(purls))
+	for i, p := range purls {
+		s.queried = append(s.queried, p.Name+"@"+p.Version)
+		out[i] = s.byPackage[p.Name+"@"+p.Version]
+	}
+	return out, nil
+}
+
+func (s *auditVulnSource) Get(_ context.Context, _ string) (*vulns.Vulnerability, error) {
+	return nil, s.err
+}
+
+const testAuditRequest = `{
+	"name": "app",
+	"version": "1.0.0",
+	"requires": {"lodash": "^4.17.0", "express": "^4.0.0"},
+	"dependencies": {
+		"lodash": {"version": "4.17.4"},
+		"express": {
+			"version": "4.18.2",
+			"dependencies": {
+				"qs": {"version": "6.5.0"}
+			}
+		},
+		"jest": {"version": "29.0.0", "dev": true}
+	}
+}`
+
+func newAuditTestHandler(src vulns.Source) *NPMHandler {
+	proxy := testProxy()
+	proxy.Enrichment = enrichment.New(slog.Default(), enrichment.WithVulnSource(src))
+	return &NPMHandler{proxy: proxy, upstreamURL: "https://registry.npmjs.org", linkBase: linkBase{proxyURL: "http://proxy.local"}}
+}
+
+func TestNPMAuditQuick(t *testing.T) {
+	src := &auditVulnSource{byPackage: map[string][]vulns.Vulnerability{
+		"lodash@4.17.4": {{
+			ID:               "GHSA-jf85-cpcp-j695",
+			Summary:          "Prototype Pollution in lodash",
+			DatabaseSpecific: map[string]any{"severity": "HIGH"},
+			References:       []vulns.Reference{{Type: "ADVISORY", URL: "https://nvd.nist.gov/vuln/detail/CVE-2019-10744"}},
+			Affected: []vulns.Affected{{
+				Package: vulns.Package{Ecosystem: "npm", Name: "lodash"},
+				Ranges:  []vulns.Range{{Type: "SEMVER", Events: []vulns.Event{{Introduced: "0"}, {Fixed: "4.17.12"}}}},
+			}},
+		}},
+		"qs@6.5.0": {{
+			ID:      "GHSA-hrpp-h998-j3pp",
+			Summary: "qs vulnerable to Prototype Pollution",
+		}},
+	}}
+	h := newAuditTestHandler(src)
+
+	req := httptest.NewRequest(http.MethodPost, "/-/npm/v1/security/audits/quick", strings.NewReader(testAuditRequest))
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var resp npmAuditResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if len(src.queried) != 4 {
+		t.Errorf("queried %v, want all 4 packages in the tree", src.queried)
+	}
+
+	if len(resp.Advisories) != 2 {
+		t.Fatalf("got %d advisories, want 2: %s", len(resp.Advisories), w.Body.String())
+	}
+	var lodash *npmAdvisory
+	for _, adv := range resp.Advisories {
+		if adv.ModuleName == "lodash" {
+			lodash = &adv
+		}
+	}
+	if lodash == nil {
+		t.Fatal("lodash advisory missing from response")
+	}
+	if lodash.GitHubAdvisoryID != "GHSA-jf85-cpcp-j695" || lodash.Severity != "high" {
+		t.Errorf("lodash advisory = %+v", lodash)
+	}
+	if lodash.PatchedVersions != ">=4.17.12" || lodash.VulnerableVersions != "<4.17.12" {
+		t.Errorf("lodash ranges = %q / %q", lodash.VulnerableVersions, lodash.PatchedVersions)
+	}
+	if len(lodash.Findings) != 1 || lodash.Findings[0].Version != "4.17.4" || lodash.Findings[0].Paths[0] != "lodash" {
+		t.Errorf("lodash findings = %+v", lodash.Findings)
+	}
+	if _, ok := resp.Advisories[strconv.Itoa(lodash.ID)]; !ok {
+		t.Errorf("advisory not keyed by its id %d", lodash.ID)
+	}
+
+	actions := map[string]npmAuditAction{}
+	for _, a := range resp.Actions {
+		actions[a.Module] = a
+	}
+	if a := actions["lodash"]; a.Action != "install" || a.Target != "4.17.12" || a.IsMajor {
+		t.Errorf("lodash action = %+v", a)
+	}
+	if a := actions["qs"]; a.Action != "review" || a.Resolves[0].Path != "express>qs" {
+		t.Errorf("qs action = %+v", a)
+	}
+
+	m := resp.Metadata
+	if m.Vulnerabilities["high"] != 1 || m.Vulnerabilities["moderate"] != 1 {
+		t.Errorf("vulnerability counts = %v", m.Vulnerabilities)
+	}
+	if m.Dependencies != 3 || m.DevDependencies != 1 || m.TotalDependencies != 4 {
+		t.Errorf("dependency counts = %+v", m)
+	}
+}
+
+func TestNPMAuditQuickNoVulnerabilities(t *testing.T) {
+	h := newAuditTestHandler(&auditVulnSource{})
+
+	req := httptest.NewRequest(http.MethodPost, "/-/npm/v1/security/audits/quick", strings.NewReader(testAuditRequest))
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`"advisories":{}`, `"actions":[]`, `"muted":[]`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %s: %s", want, body)
+		}
+	}
+}
+
+func TestNPMAuditQuickErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		h      *NPMHandler
+		method string
+		body   string
+		want   int
+	}{
+		{"get not allowed", newAuditTestHandler(&auditVulnSource{}), http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid json", newAuditTestHandler(&auditVulnSource{}), http.MethodPost, "{", http.StatusBadRequest},
+		{"source failure", newAuditTestHandler(&auditVulnSource{err: errors.New("osv down")}), http.MethodPost, testAuditRequest, http.StatusBadGateway},
+		{"no enrichment", &NPMHandler{proxy: testProxy()}, http.MethodPost, testAuditRequest, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/-/npm/v1/security/audits/quick", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			tt.h.Routes().ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
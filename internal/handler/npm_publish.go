@@ -0,0 +1,589 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // npm dist.shasum is SHA-1
+	"crypto/sha512"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/metrics"
+	"github.com/git-pkgs/proxy/internal/storage"
+	"github.com/git-pkgs/purl"
+)
+
+// npm clients send every registry write for a package as PUT /{name}. A
+// publish carries the new version's tarball in _attachments; deprecate and
+// undeprecate send the whole packument back with the deprecated field of
+// some versions changed. Publishing is only accepted for names that aren't
+// proxied from upstream, and those packages are then served only from here.
+// A name is first published only if upstream answers 404 for it or it is
+// listed in NPMLocalNames, so nobody can claim a public name before the
+// proxy has cached it.
+
+const defaultNPMMaxPublishSize = 100 << 20
+
+// npmVersionPattern matches a SemVer 2.0 version, which is what npm accepts
+// for a publish. It also keeps separators and ".." out of the storage key
+// the version ends up in.
+var npmVersionPattern = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*)?` +
+	`(?:\+[0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*)?$`)
+
+// errNPMUpstreamCheck means upstream couldn't say whether a name is taken.
+var errNPMUpstreamCheck = errors.New("checking upstream for package name")
+
+// npmWriteBody is the part of a PUT /{name} body the proxy looks at.
+type npmWriteBody struct {
+	Name        string                     `json:"name"`
+	DistTags    map[string]string          `json:"dist-tags"`
+	Versions    map[string]json.RawMessage `json:"versions"`
+	Attachments map[string]npmAttachment   `json:"_attachments"`
+}
+
+type npmAttachment struct {
+	Data   string `json:"data"`
+	Length int64  `json:"length"`
+}
+
+// handleWrite routes a PUT or DELETE to publish, deprecate or, when
+// NPMUnpublish is set, unpublish, and rejects every other registry mutation
+// with 405. All of them need NPMPublishToken.
+func (h *NPMHandler) handleWrite(w http.ResponseWriter, r *http.Request) {
+	if !h.proxy.NPMPublish {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !bearerAuthorized(r, h.proxy.NPMPublishToken) {
+		writeNPMUnauthorized(w)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if name, filename, ok := parseNPMRevPath(path); ok && h.proxy.NPMUnpublish {
+		h.handleUnpublish(w, r, Canonicalize("npm", name), filename)
+		return
+	}
+
+	name := h.extractPackageName(r)
+	if r.Method != http.MethodPut || strings.HasPrefix(path, "-/") || strings.Contains(path, "/-/") ||
+		!isNPMPackageName(name) {
+		h.rejectWrite(w, r, name, "unsupported npm registry write")
+		return
+	}
+	name = Canonicalize("npm", name)
+
+	body, ok := h.decodeWriteBody(w, r, name)
+	if !ok {
+		return
+	}
+
+	h.proxy.npmPublishMu.Lock()
+	defer h.proxy.npmPublishMu.Unlock()
+
+	if len(body.Attachments) > 0 {
+		h.handlePublish(w, r, name, body)
+		return
+	}
+	h.handleDeprecate(w, r, name, body)
+}
+
+// decodeWriteBody reads a PUT body for name, capped at NPMMaxPublishSize.
+// On failure it writes the error response and returns false.
+func (h *NPMHandler) decodeWriteBody(w http.ResponseWriter, r *http.Request, name string) (*npmWriteBody, bool) {
+	maxSize := h.proxy.NPMMaxPublishSize
+	if maxSize <= 0 {
+		maxSize = defaultNPMMaxPublishSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	var body npmWriteBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.proxy.RecordPolicyEvent(r, "npm", name, "", PolicyDecisionDeny,
+				fmt.Sprintf("publish exceeds max size of %d bytes", maxSize))
+			JSONError(w, http.StatusRequestEntityTooLarge, "publish too large")
+			return nil, false
+		}
+		JSONError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	if Canonicalize("npm", body.Name) != name {
+		JSONError(w, http.StatusBadRequest, "package name in body does not match URL")
+		return nil, false
+	}
+	return &body, true
+}
+
+// writeNPMUnauthorized answers a registry write without a valid publish
+// token.
+func writeNPMUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="npm publish"`)
+	JSONError(w, http.StatusUnauthorized, "publishing requires a valid token")
+}
+
+// rejectWrite answers an unsupported registry mutation with 405.
+func (h *NPMHandler) rejectWrite(w http.ResponseWriter, r *http.Request, name, reason string) {
+	h.proxy.RecordPolicyEvent(r, "npm", name, "", PolicyDecisionDeny, reason)
+	JSONError(w, http.StatusMethodNotAllowed, reason)
+}
+
+// handlePublish stores a newly published version and adds it to the
+// package's local packument.
+func (h *NPMHandler) handlePublish(w http.ResponseWriter, r *http.Request, name string, body *npmWriteBody) {
+	if len(body.Versions) != 1 || len(body.Attachments) != 1 {
+		JSONError(w, http.StatusBadRequest, "publish must carry exactly one version and one tarball")
+		return
+	}
+	var version string
+	var rawManifest json.RawMessage
+	for v, m := range body.Versions {
+		version, rawManifest = v, m
+	}
+	if !npmVersionPattern.MatchString(version) {
+		JSONError(w, http.StatusBadRequest, "version is not valid semver")
+		return
+	}
+
+	filename := npmTarballFilename(name, version)
+	attachment, ok := body.Attachments[filename]
+	if !ok {
+		JSONError(w, http.StatusBadRequest, "tarball attachment does not match version")
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(attachment.Data)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "tarball attachment is not valid base64")
+		return
+	}
+	if attachment.Length > 0 && attachment.Length != int64(len(data)) {
+		JSONError(w, http.StatusBadRequest, "tarball length does not match attachment")
+		return
+	}
+
+	var manifest map[string]any
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid version manifest")
+		return
+	}
+	if v, _ := manifest["version"].(string); v != version {
+		JSONError(w, http.StatusBadRequest, "version manifest does not match version")
+		return
+	}
+	integrity, err := setNPMDist(manifest, data)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	doc, err := h.loadPublishTarget(r.Context(), name)
+	if errors.Is(err, errNPMUpstreamCheck) {
+		h.proxy.Logger.Warn("refusing npm publish", "package", name, "error", err)
+		JSONError(w, http.StatusBadGateway, "could not confirm the package name is unused upstream")
+		return
+	}
+	if err != nil {
+		h.proxy.Logger.Error("failed to load npm packument", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to publish package")
+		return
+	}
+	if doc == nil {
+		h.proxy.RecordPolicyEvent(r, "npm", name, version, PolicyDecisionDeny,
+			"package is proxied from upstream")
+		JSONError(w, http.StatusConflict, "package is proxied from upstream and cannot be published here")
+		return
+	}
+	times, _ := doc["time"].(map[string]any)
+	if _, published := times[version]; published {
+		h.proxy.RecordPolicyEvent(r, "npm", name, version, PolicyDecisionDeny,
+			"version was published before")
+		JSONError(w, http.StatusConflict, "cannot publish over a previously published version")
+		return
+	}
+	delete(times, "unpublished")
+	versions, _ := doc["versions"].(map[string]any)
+	if versions == nil {
+		versions = map[string]any{}
+		doc["versions"] = versions
+	}
+
+	distTags, _ := doc["dist-tags"].(map[string]any)
+	if distTags == nil {
+		distTags = map[string]any{}
+		doc["dist-tags"] = distTags
+	}
+	for tag, v := range body.DistTags {
+		distTags[tag] = v
+	}
+	if len(distTags) == 0 {
+		distTags["latest"] = version
+	}
+	latest, _ := distTags["latest"].(string)
+
+	if err := h.storePublishedVersion(r, name, version, latest, filename, integrity, manifest, data); err != nil {
+		h.proxy.Logger.Error("failed to store npm publish", "package", name, "version", version, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to publish package")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	versions[version] = manifest
+	if _, ok := times["created"]; !ok {
+		times["created"] = now
+	}
+	times["modified"] = now
+	times[version] = now
+
+	if err := h.saveLocalPackument(name, doc); err != nil {
+		h.proxy.Logger.Error("failed to save npm packument", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to publish package")
+		return
+	}
+
+	h.proxy.Logger.Info("npm package published", "package", name, "version", version)
+	writeNPMOK(w, http.StatusCreated)
+}
+
+// loadPublishTarget returns the local packument for name, a fresh one if
+// the name is unused, or nil if the name is already proxied from upstream.
+// A name outside NPMLocalNames counts as unused only if upstream has no
+// package by that name.
+func (h *NPMHandler) loadPublishTarget(ctx context.Context, name string) (map[string]any, error) {
+	doc, err := h.loadLocalPackument(name)
+	if err != nil || doc != nil {
+		return doc, err
+	}
+
+	pkg, err := h.proxy.DB.GetPackageByPURL(purl.MakePURLString("npm", name, ""))
+	if err != nil {
+		return nil, err
+	}
+	if pkg != nil {
+		return nil, nil
+	}
+	if !h.isLocalName(name) {
+		exists, err := h.existsUpstream(ctx, name)
+		if err != nil || exists {
+			return nil, err
+		}
+	}
+	return map[string]any{
+		"_id":       name,
+		"name":      name,
+		"dist-tags": map[string]any{},
+		"versions":  map[string]any{},
+		"time":      map[string]any{},
+	}, nil
+}
+
+// isLocalName reports whether name is listed in NPMLocalNames, by itself or
+// through its scope.
+func (h *NPMHandler) isLocalName(name string) bool {
+	scope, _, scoped := strings.Cut(name, "/")
+	for _, local := range h.proxy.NPMLocalNames {
+		local = Canonicalize("npm", local)
+		if local == name || (scoped && local == scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// existsUpstream reports whether the registry name would be proxied from
+// has a package by that name. Any answer other than 200 or 404 is an
+// error, so an unreachable upstream blocks a first publish rather than
+// letting a public name be claimed.
+func (h *NPMHandler) existsUpstream(ctx context.Context, name string) (bool, error) {
+	upstream, _ := h.upstreamFor(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream+"/"+url.PathEscape(name), nil)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errNPMUpstreamCheck, err)
+	}
+	req.Header.Set("Accept", npmAbbreviatedCT)
+
+	resp, err := h.proxy.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errNPMUpstreamCheck, err)
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: upstream returned %d", errNPMUpstreamCheck, resp.StatusCode)
+	}
+}
+
+// storePublishedVersion writes the tarball to storage and records the
+// package, version and artifact rows. The artifact is pinned because there
+// is no upstream to fetch it from again if it were evicted.
+func (h *NPMHandler) storePublishedVersion(r *http.Request, name, version, latest, filename, integrity string, manifest map[string]any, data []byte) error {
+	pkgPURL := purl.MakePURLString("npm", name, "")
+	versionPURL := purl.MakePURLString("npm", name, version)
+	storagePath := h.proxy.storageKey(storage.ArtifactPathLimited("npm", "", name, version, filename, h.proxy.MaxFilenameLength))
+
+	storeStart := time.Now()
+	size, hash, err := h.proxy.Storage.Store(r.Context(), storagePath, bytes.NewReader(data))
+	metrics.RecordStorageOperation("write", time.Since(storeStart))
+	if err != nil {
+		metrics.RecordStorageError("write")
+		return fmt.Errorf("storing tarball: %w", err)
+	}
+
+	now := time.Now()
+	description, _ := manifest["description"].(string)
+	pkg := &database.Package{
+		PURL:          pkgPURL,
+		Ecosystem:     "npm",
+		Name:          name,
+		LatestVersion: sql.NullString{String: latest, Valid: latest != ""},
+		Description:   sql.NullString{String: description, Valid: description != ""},
+		EnrichedAt:    sql.NullTime{Time: now, Valid: true},
+	}
+	if err := retryOnBusy(func() error { return h.proxy.DB.UpsertPackage(pkg) }); err != nil {
+		return fmt.Errorf("upserting package: %w", err)
+	}
+
+	ver := &database.Version{
+		PURL:        versionPURL,
+		PackagePURL: pkgPURL,
+		Integrity:   sql.NullString{String: integrity, Valid: true},
+		PublishedAt: sql.NullTime{Time: now, Valid: true},
+		EnrichedAt:  sql.NullTime{Time: now, Valid: true},
+	}
+	if err := retryOnBusy(func() error { return h.proxy.DB.UpsertVersion(ver) }); err != nil {
+		return fmt.Errorf("upserting version: %w", err)
+	}
+
+	art := &database.Artifact{
+		VersionPURL: versionPURL,
+		Filename:    filename,
+		StoragePath: sql.NullString{String: storagePath, Valid: true},
+		ContentHash: sql.NullString{String: hash, Valid: true},
+		Size:        sql.NullInt64{Int64: size, Valid: true},
+		ContentType: sql.NullString{String: "application/octet-stream", Valid: true},
+		FetchedAt:   sql.NullTime{Time: now, Valid: true},
+	}
+	if err := retryOnBusy(func() error { return h.proxy.DB.UpsertArtifact(art) }); err != nil {
+		return fmt.Errorf("upserting artifact: %w", err)
+	}
+	if err := retryOnBusy(func() error { return h.proxy.DB.PinArtifact(versionPURL, filename, true) }); err != nil {
+		return fmt.Errorf("pinning artifact: %w", err)
+	}
+	return nil
+}
+
+// handleDeprecate applies the deprecated field of each version in body to
+// the local packument. npm sends the full version list, so a body that adds
+// or drops versions is some other mutation and is rejected.
+func (h *NPMHandler) handleDeprecate(w http.ResponseWriter, r *http.Request, name string, body *npmWriteBody) {
+	doc, err := h.loadLocalPackument(name)
+	if err != nil {
+		h.proxy.Logger.Error("failed to load npm packument", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to update package")
+		return
+	}
+	if doc == nil {
+		h.rejectWrite(w, r, name, "package is not published to this proxy")
+		return
+	}
+
+	versions, _ := doc["versions"].(map[string]any)
+	if len(body.Versions) != len(versions) {
+		h.rejectWrite(w, r, name, "only npm deprecate is supported for published packages")
+		return
+	}
+
+	changed := false
+	for version, raw := range body.Versions {
+		existing, ok := versions[version].(map[string]any)
+		if !ok {
+			h.rejectWrite(w, r, name, "only npm deprecate is supported for published packages")
+			return
+		}
+		var incoming struct {
+			Deprecated string `json:"deprecated"`
+		}
+		if err := json.Unmarshal(raw, &incoming); err != nil {
+			JSONError(w, http.StatusBadRequest, "invalid version manifest")
+			return
+		}
+		if current, _ := existing["deprecated"].(string); current == incoming.Deprecated {
+			continue
+		}
+		if incoming.Deprecated == "" {
+			delete(existing, "deprecated")
+		} else {
+			existing["deprecated"] = incoming.Deprecated
+		}
+		changed = true
+	}
+
+	if changed {
+		if times, ok := doc["time"].(map[string]any); ok {
+			times["modified"] = time.Now().UTC().Format(time.RFC3339)
+		}
+		if err := h.saveLocalPackument(name, doc); err != nil {
+			h.proxy.Logger.Error("failed to save npm packument", "package", name, "error", err)
+			JSONError(w, http.StatusInternalServerError, "failed to update package")
+			return
+		}
+		h.proxy.Logger.Info("npm package deprecation updated", "package", name)
+	}
+
+	writeNPMOK(w, http.StatusOK)
+}
+
+// loadLocalPackument returns the packument of a package published to this
+// proxy, or nil if name isn't one.
+func (h *NPMHandler) loadLocalPackument(name string) (map[string]any, error) {
+	local, err := h.localPackument(name)
+	if err != nil || local == nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(local.Document), &doc); err != nil {
+		return nil, fmt.Errorf("decoding packument: %w", err)
+	}
+	return doc, nil
+}
+
+// localPackument returns the stored packument row for name, or nil if the
+// package isn't published to this proxy.
+func (h *NPMHandler) localPackument(name string) (*database.NPMPackument, error) {
+	if h.proxy.DB == nil {
+		return nil, nil
+	}
+	return h.proxy.DB.GetNPMPackument(name)
+}
+
+func (h *NPMHandler) saveLocalPackument(name string, doc map[string]any) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return retryOnBusy(func() error { return h.proxy.DB.UpsertNPMPackument(name, string(data)) })
+}
+
+// serveLocalPackument writes the packument of a locally published package
+// with tarball URLs pointing at this proxy.
+func (h *NPMHandler) serveLocalPackument(w http.ResponseWriter, name string, doc map[string]any) {
+	versions, _ := doc["versions"].(map[string]any)
+	for version, vdata := range versions {
+		vmap, ok := vdata.(map[string]any)
+		if !ok {
+			continue
+		}
+		dist, ok := vmap["dist"].(map[string]any)
+		if !ok {
+			dist = map[string]any{}
+			vmap["dist"] = dist
+		}
+		dist["tarball"] = fmt.Sprintf("%s/npm/%s/-/%s", h.proxyURL, url.PathEscape(name), npmTarballFilename(name, version))
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(doc)
+}
+
+// serveLocalTarball serves a tarball of a locally published package from
+// the cache. It never falls through to upstream, so a same-named public
+// package can't be substituted.
+func (h *NPMHandler) serveLocalTarball(w http.ResponseWriter, r *http.Request, name, version, filename string) {
+	versionPURL := purl.MakePURLString("npm", name, version)
+	trace := h.proxy.newCacheTrace()
+	result, err := h.proxy.checkCache(r.Context(), purl.MakePURLString("npm", name, ""), versionPURL, filename, trace)
+	if err != nil {
+		h.proxy.Logger.Error("failed to get published artifact", "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to read package")
+		return
+	}
+	if result == nil {
+		JSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	trace.finish(result, "local")
+	markImmutable(result, "npm", version, filename)
+	attachUsage(r.Context(), result, "npm", versionPURL)
+	h.proxy.ServeArtifact(w, result)
+}
+
+// setNPMDist checks the shasum and integrity a client sent for a tarball,
+// fills in any that are missing, and returns the integrity string.
+func setNPMDist(manifest map[string]any, data []byte) (string, error) {
+	dist, ok := manifest["dist"].(map[string]any)
+	if !ok {
+		dist = map[string]any{}
+		manifest["dist"] = dist
+	}
+
+	sum1 := sha1.Sum(data) //nolint:gosec // npm dist.shasum is SHA-1
+	shasum := hex.EncodeToString(sum1[:])
+	sum512 := sha512.Sum512(data)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum512[:])
+
+	if got, ok := dist["shasum"].(string); ok && got != "" && got != shasum {
+		return "", fmt.Errorf("tarball shasum does not match dist.shasum")
+	}
+	if got, ok := dist["integrity"].(string); ok && got != "" {
+		algo, digest, ok := parseSRI(got)
+		if !ok {
+			return "", fmt.Errorf("unsupported dist.integrity %q", got)
+		}
+		hasher := newSRIHash(algo)
+		hasher.Write(data)
+		if !bytes.Equal(hasher.Sum(nil), digest) {
+			return "", fmt.Errorf("tarball does not match dist.integrity")
+		}
+	}
+
+	dist["shasum"] = shasum
+	dist["integrity"] = integrity
+	return integrity, nil
+}
+
+// npmTarballFilename returns the registry's tarball filename for a version,
+// e.g. "core-7.23.0.tgz" for @babel/core 7.23.0.
+func npmTarballFilename(name, version string) string {
+	shortName := name
+	if _, after, ok := strings.Cut(name, "/"); ok {
+		shortName = after
+	}
+	return shortName + "-" + version + ".tgz"
+}
+
+// isNPMPackageName reports whether name has the shape of an npm package
+// name, so paths such as /{name}/-rev/{rev} aren't mistaken for one.
+func isNPMPackageName(name string) bool {
+	if name == "" || containsPathTraversal(name) {
+		return false
+	}
+	if strings.HasPrefix(name, "@") {
+		scope, pkg, ok := strings.Cut(name, "/")
+		return ok && len(scope) > 1 && pkg != "" && !strings.Contains(pkg, "/")
+	}
+	return !strings.Contains(name, "/")
+}
+
+func writeNPMOK(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
@@ -0,0 +1,603 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testNPMPublishToken = "test-publish-token"
+
+func npmPublishBody(name, version, tarball string) string {
+	filename := npmTarballFilename(name, version)
+	return fmt.Sprintf(`{
+		"_id": %q,
+		"name": %q,
+		"dist-tags": {"latest": %q},
+		"versions": {%q: {"name": %q, "version": %q, "dist": {}}},
+		"_attachments": {%q: {"content_type": "application/octet-stream", "data": %q, "length": %d}}
+	}`, name, name, version, version, name, version, filename,
+		base64.StdEncoding.EncodeToString([]byte(tarball)), len(tarball))
+}
+
+func npmPut(t *testing.T, h http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testNPMPublishToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// newNPMPublishHandler returns npm routes that accept publishes sent with
+// testNPMPublishToken, in front of an upstream that has none of the
+// packages the tests publish.
+func newNPMPublishHandler(t *testing.T, proxy *Proxy) http.Handler {
+	t.Helper()
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(upstream.Close)
+
+	proxy.NPMPublish = true
+	proxy.NPMPublishToken = testNPMPublishToken
+	h := NewNPMHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+	return h.Routes()
+}
+
+func getPackument(t *testing.T, h http.Handler, path string) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, body = %s", path, w.Code, w.Body.String())
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decoding packument: %v", err)
+	}
+	return doc
+}
+
+func TestNPMPublish(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	h := newNPMPublishHandler(t, proxy)
+
+	w := npmPut(t, h, "/@acme%2fwidgets", npmPublishBody("@acme/widgets", "1.0.0", "tarball-bytes"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("publish status = %d, want %d; body = %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	key := "npm/@acme/widgets/1.0.0/widgets-1.0.0.tgz"
+	if got := string(store.files[key]); got != "tarball-bytes" {
+		t.Errorf("stored tarball at %s = %q, want %q", key, got, "tarball-bytes")
+	}
+	art, err := db.GetArtifact("pkg:npm/%40acme/widgets@1.0.0", "widgets-1.0.0.tgz")
+	if err != nil || art == nil {
+		t.Fatalf("GetArtifact() = %v, %v; want the published artifact", art, err)
+	}
+	if !art.Pinned {
+		t.Error("published artifact should be pinned so eviction can't drop it")
+	}
+
+	doc := getPackument(t, h, "/@acme%2fwidgets")
+	versions := doc["versions"].(map[string]any)
+	v := versions["1.0.0"].(map[string]any)
+	dist := v["dist"].(map[string]any)
+	if got := dist["tarball"]; got != "http://proxy.local/npm/@acme%2Fwidgets/-/widgets-1.0.0.tgz" {
+		t.Errorf("tarball = %v", got)
+	}
+	if got, _ := dist["integrity"].(string); !strings.HasPrefix(got, "sha512-") {
+		t.Errorf("integrity = %q, want a sha512 SRI string", got)
+	}
+	if tags := doc["dist-tags"].(map[string]any); tags["latest"] != "1.0.0" {
+		t.Errorf("dist-tags = %v, want latest 1.0.0", tags)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/@acme%2fwidgets/-/widgets-1.0.0.tgz", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if body, _ := io.ReadAll(rec.Body); string(body) != "tarball-bytes" {
+		t.Errorf("download body = %q", body)
+	}
+	if fetcher.fetchCalled {
+		t.Error("published package should never be fetched from upstream")
+	}
+
+	w = npmPut(t, h, "/@acme%2fwidgets", npmPublishBody("@acme/widgets", "1.0.0", "other-bytes"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("republish status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestNPMPublish_ProxiedPackageConflict(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "upstream")
+	h := newNPMPublishHandler(t, proxy)
+
+	w := npmPut(t, h, "/lodash", npmPublishBody("lodash", "99.0.0", "evil"))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if _, ok := store.files["npm/lodash/99.0.0/lodash-99.0.0.tgz"]; ok {
+		t.Error("tarball for a proxied package should not be stored")
+	}
+}
+
+func TestNPMPublish_NameTakenUpstream(t *testing.T) {
+	proxy, _, store, _ := setupTestProxy(t)
+	status := http.StatusOK
+	var requested []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath())
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	proxy.NPMPublish = true
+	proxy.NPMPublishToken = testNPMPublishToken
+	nh := NewNPMHandler(proxy, "http://proxy.local")
+	nh.upstreamURL = upstream.URL
+	h := nh.Routes()
+
+	w := npmPut(t, h, "/@acme%2fwidgets", npmPublishBody("@acme/widgets", "1.0.0", "v1"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("name taken upstream: status = %d, want %d; body = %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	if len(requested) != 1 || requested[0] != "/@acme%2Fwidgets" {
+		t.Errorf("upstream requests = %v, want the packument of @acme/widgets", requested)
+	}
+
+	status = http.StatusInternalServerError
+	if w := npmPut(t, h, "/@acme%2fwidgets", npmPublishBody("@acme/widgets", "1.0.0", "v1")); w.Code != http.StatusBadGateway {
+		t.Errorf("upstream failing: status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %d files for names upstream didn't disown", len(store.files))
+	}
+
+	// A listed scope is published without asking upstream.
+	proxy.NPMLocalNames = []string{"@ACME"}
+	requested = nil
+	if w := npmPut(t, h, "/@acme%2fwidgets", npmPublishBody("@acme/widgets", "1.0.0", "v1")); w.Code != http.StatusCreated {
+		t.Errorf("local scope: status = %d, want %d; body = %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if len(requested) != 0 {
+		t.Errorf("upstream was asked about a local name: %v", requested)
+	}
+}
+
+func TestNPMPublish_InvalidVersion(t *testing.T) {
+	proxy, _, store, _ := setupTestProxy(t)
+	h := newNPMPublishHandler(t, proxy)
+
+	for _, version := range []string{"1.0", "v1.0.0", "..", "1.0.0/../../x", `1.0.0-a\b`, "1.0.0-..", "01.0.0"} {
+		w := npmPut(t, h, "/widgets", npmPublishBody("widgets", version, "v1"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("version %q: status = %d, want %d", version, w.Code, http.StatusBadRequest)
+		}
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %d files for invalid versions", len(store.files))
+	}
+
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "2.0.0-beta.1+build.5", "v1")); w.Code != http.StatusCreated {
+		t.Errorf("prerelease version: status = %d, want %d; body = %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+}
+
+func TestNPMPublish_RequiresToken(t *testing.T) {
+	proxy, _, store, _ := setupTestProxy(t)
+	h := newNPMPublishHandler(t, proxy)
+
+	for _, auth := range []string{"", "Bearer wrong-token", testNPMPublishToken} {
+		req := httptest.NewRequest(http.MethodPut, "/widgets", strings.NewReader(npmPublishBody("widgets", "1.0.0", "v1")))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, http.StatusUnauthorized)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer") {
+			t.Errorf("Authorization %q: WWW-Authenticate = %q, want a Bearer challenge", auth, got)
+		}
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %d files from unauthorized publishes", len(store.files))
+	}
+
+	// With no token configured nothing can be published.
+	proxy.NPMPublishToken = ""
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.0.0", "v1")); w.Code != http.StatusUnauthorized {
+		t.Errorf("no configured token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestNPMDeprecate(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	h := newNPMPublishHandler(t, proxy)
+
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.0.0", "v1")); w.Code != http.StatusCreated {
+		t.Fatalf("publish status = %d; body = %s", w.Code, w.Body.String())
+	}
+
+	// npm deprecate sends back the packument it fetched with the
+	// deprecated field set on the matching versions.
+	doc := getPackument(t, h, "/widgets")
+	doc["versions"].(map[string]any)["1.0.0"].(map[string]any)["deprecated"] = "use widgets2"
+	body, _ := json.Marshal(doc)
+	if w := npmPut(t, h, "/widgets", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("deprecate status = %d, want %d; body = %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	doc = getPackument(t, h, "/widgets")
+	v := doc["versions"].(map[string]any)["1.0.0"].(map[string]any)
+	if v["deprecated"] != "use widgets2" {
+		t.Errorf("deprecated = %v, want %q", v["deprecated"], "use widgets2")
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/widgets", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("deprecate with wrong token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	v["deprecated"] = ""
+	body, _ = json.Marshal(doc)
+	if w := npmPut(t, h, "/widgets", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("undeprecate status = %d", w.Code)
+	}
+	doc = getPackument(t, h, "/widgets")
+	if _, ok := doc["versions"].(map[string]any)["1.0.0"].(map[string]any)["deprecated"]; ok {
+		t.Error("empty deprecation message should remove the deprecated field")
+	}
+}
+
+func TestNPMWrite_Unsupported(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+	h := newNPMPublishHandler(t, proxy)
+
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.0.0", "v1")); w.Code != http.StatusCreated {
+		t.Fatalf("publish status = %d; body = %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"drop version", http.MethodPut, "/widgets", `{"name":"widgets","versions":{}}`},
+		{"unpublish rev", http.MethodPut, "/widgets/-rev/1-abc", `{"name":"widgets","versions":{}}`},
+		{"dist-tag", http.MethodPut, "/-/package/widgets/dist-tags/beta", `"1.0.0"`},
+		{"delete", http.MethodDelete, "/widgets/-rev/1-abc", ""},
+		{"deprecate proxied", http.MethodPut, "/lodash", `{"name":"lodash","versions":{"1.0.0":{"deprecated":"x"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+testNPMPublishToken)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("status = %d, want %d; body = %s", w.Code, http.StatusMethodNotAllowed, w.Body.String())
+			}
+		})
+	}
+
+	doc := getPackument(t, h, "/widgets")
+	if _, ok := doc["versions"].(map[string]any)["1.0.0"]; !ok {
+		t.Error("rejected writes should leave the packument unchanged")
+	}
+	events, err := db.ListPolicyEvents("", 10, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyEvents() error = %v", err)
+	}
+	if len(events) != len(tests) {
+		t.Errorf("got %d policy events, want %d", len(events), len(tests))
+	}
+}
+
+func TestNPMWrite_PublishDisabled(t *testing.T) {
+	proxy, _, store, _ := setupTestProxy(t)
+	h := NewNPMHandler(proxy, "http://proxy.local").Routes()
+
+	w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.0.0", "v1"))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %d files with publish disabled", len(store.files))
+	}
+}
+
+func npmDelete(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodDelete, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testNPMPublishToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestNPMUnpublishVersion(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	proxy.NPMUnpublish = true
+	h := newNPMPublishHandler(t, proxy)
+
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", v, "tarball "+v)); w.Code != http.StatusCreated {
+			t.Fatalf("publish %s status = %d; body = %s", v, w.Code, w.Body.String())
+		}
+	}
+
+	// npm unpublish widgets@1.1.0 sends the packument back without the
+	// version, then deletes the tarball.
+	doc := getPackument(t, h, "/widgets")
+	delete(doc["versions"].(map[string]any), "1.1.0")
+	body, _ := json.Marshal(doc)
+	if w := npmPut(t, h, "/widgets/-rev/undefined", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("unpublish status = %d; body = %s", w.Code, w.Body.String())
+	}
+	if w := npmDelete(t, h, "/widgets/-/widgets-1.1.0.tgz/-rev/undefined"); w.Code != http.StatusOK {
+		t.Fatalf("tarball delete status = %d; body = %s", w.Code, w.Body.String())
+	}
+
+	doc = getPackument(t, h, "/widgets")
+	if _, ok := doc["versions"].(map[string]any)["1.1.0"]; ok {
+		t.Error("unpublished version still in packument")
+	}
+	if _, ok := doc["time"].(map[string]any)["1.1.0"]; !ok {
+		t.Error("unpublished version's time entry was dropped")
+	}
+	if latest := doc["dist-tags"].(map[string]any)["latest"]; latest != "1.0.0" {
+		t.Errorf("latest = %v, want 1.0.0", latest)
+	}
+	if _, ok := store.files["npm/widgets/1.1.0/widgets-1.1.0.tgz"]; ok {
+		t.Error("unpublished tarball still in storage")
+	}
+	if art, _ := db.GetArtifact("pkg:npm/widgets@1.1.0", "widgets-1.1.0.tgz"); art != nil {
+		t.Error("unpublished artifact still in database")
+	}
+	if v, _ := db.GetVersionByPURL("pkg:npm/widgets@1.1.0"); v != nil {
+		t.Error("unpublished version still in database")
+	}
+	if _, ok := store.files["npm/widgets/1.0.0/widgets-1.0.0.tgz"]; !ok {
+		t.Error("remaining version's tarball was deleted")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets/-/widgets-1.1.0.tgz", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("download of unpublished version status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if w := npmDelete(t, h, "/widgets/-/widgets-1.0.0.tgz/-rev/undefined"); w.Code != http.StatusConflict {
+		t.Errorf("deleting a published version's tarball status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	if w := npmDelete(t, h, "/widgets/-rev/undefined"); w.Code != http.StatusOK {
+		t.Fatalf("package unpublish status = %d; body = %s", w.Code, w.Body.String())
+	}
+	if pkg, _ := db.GetPackageByPURL("pkg:npm/widgets"); pkg != nil {
+		t.Error("unpublished package still in database")
+	}
+	if len(store.files) != 0 {
+		t.Errorf("%d tarballs left in storage after unpublishing the package", len(store.files))
+	}
+	local, _ := db.GetNPMPackument("widgets")
+	if local == nil {
+		t.Fatal("unpublished package left no tombstone")
+	}
+	var tombstone map[string]any
+	if err := json.Unmarshal([]byte(local.Document), &tombstone); err != nil {
+		t.Fatalf("decoding tombstone: %v", err)
+	}
+	if _, ok := tombstone["versions"]; ok {
+		t.Error("tombstone still lists versions")
+	}
+	unpublished, _ := tombstone["time"].(map[string]any)["unpublished"].(map[string]any)
+	if got := fmt.Sprint(unpublished["versions"]); got != "[1.0.0]" {
+		t.Errorf("tombstone versions = %s, want [1.0.0]", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("packument of unpublished package status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestNPMUnpublish_VersionCannotBeRepublished(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.NPMUnpublish = true
+	h := newNPMPublishHandler(t, proxy)
+
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", v, "tarball "+v)); w.Code != http.StatusCreated {
+			t.Fatalf("publish %s status = %d; body = %s", v, w.Code, w.Body.String())
+		}
+	}
+	doc := getPackument(t, h, "/widgets")
+	delete(doc["versions"].(map[string]any), "1.1.0")
+	body, _ := json.Marshal(doc)
+	if w := npmPut(t, h, "/widgets/-rev/undefined", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("unpublish status = %d; body = %s", w.Code, w.Body.String())
+	}
+
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.1.0", "different bytes")); w.Code != http.StatusConflict {
+		t.Errorf("republishing an unpublished version status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if _, ok := getPackument(t, h, "/widgets")["versions"].(map[string]any)["1.1.0"]; ok {
+		t.Error("republished version is in the packument")
+	}
+
+	if w := npmDelete(t, h, "/widgets/-rev/undefined"); w.Code != http.StatusOK {
+		t.Fatalf("package unpublish status = %d; body = %s", w.Code, w.Body.String())
+	}
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", v, "again "+v)); w.Code != http.StatusConflict {
+			t.Errorf("republishing %s after unpublishing the package status = %d, want %d", v, w.Code, http.StatusConflict)
+		}
+	}
+
+	// A new version brings the package back.
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "2.0.0", "v2")); w.Code != http.StatusCreated {
+		t.Fatalf("publishing a new version status = %d; body = %s", w.Code, w.Body.String())
+	}
+	doc = getPackument(t, h, "/widgets")
+	if versions := doc["versions"].(map[string]any); len(versions) != 1 || versions["2.0.0"] == nil {
+		t.Errorf("versions = %v, want only 2.0.0", versions)
+	}
+	if _, ok := doc["time"].(map[string]any)["unpublished"]; ok {
+		t.Error("republished package is still marked unpublished")
+	}
+}
+
+func TestNPMUnpublishPackage_NotProxiedFromUpstream(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.NPMPublish = true
+	proxy.NPMPublishToken = testNPMPublishToken
+	proxy.NPMUnpublish = true
+	proxy.NPMLocalNames = []string{"widgets"}
+
+	// Upstream has its own widgets, which must not replace the unpublished
+	// local package.
+	upstreamHits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"name":"widgets","dist-tags":{"latest":"9.9.9"},"versions":{"9.9.9":{"name":"widgets","version":"9.9.9"}}}`)
+	}))
+	t.Cleanup(upstream.Close)
+	nh := NewNPMHandler(proxy, "http://proxy.local")
+	nh.upstreamURL = upstream.URL
+	h := nh.Routes()
+
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.0.0", "v1")); w.Code != http.StatusCreated {
+		t.Fatalf("publish status = %d; body = %s", w.Code, w.Body.String())
+	}
+	if w := npmDelete(t, h, "/widgets/-rev/undefined"); w.Code != http.StatusOK {
+		t.Fatalf("package unpublish status = %d; body = %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/widgets", "/widgets/-/widgets-9.9.9.tgz"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+	if upstreamHits != 0 {
+		t.Errorf("upstream was asked %d times for an unpublished local package", upstreamHits)
+	}
+}
+
+func TestNPMUnpublish_RequiresToken(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	proxy.NPMUnpublish = true
+	h := newNPMPublishHandler(t, proxy)
+
+	if w := npmPut(t, h, "/widgets", npmPublishBody("widgets", "1.0.0", "v1")); w.Code != http.StatusCreated {
+		t.Fatalf("publish status = %d; body = %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"unpublish version", http.MethodPut, "/widgets/-rev/undefined", `{"name":"widgets","versions":{}}`},
+		{"delete tarball", http.MethodDelete, "/widgets/-/widgets-1.0.0.tgz/-rev/undefined", ""},
+		{"unpublish package", http.MethodDelete, "/widgets/-rev/undefined", ""},
+	}
+	for _, tt := range tests {
+		for _, auth := range []string{"", "Bearer wrong-token"} {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("%s with Authorization %q: status = %d, want %d", tt.name, auth, w.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+
+	if pkg, _ := db.GetPackageByPURL("pkg:npm/widgets"); pkg == nil {
+		t.Error("unauthorized unpublish removed the package")
+	}
+	if _, ok := store.files["npm/widgets/1.0.0/widgets-1.0.0.tgz"]; !ok {
+		t.Error("unauthorized unpublish removed the tarball")
+	}
+}
+
+func TestNPMUnpublish_ProxiedPackageRejected(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	proxy.NPMUnpublish = true
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "upstream")
+	h := newNPMPublishHandler(t, proxy)
+
+	for _, tt := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/lodash/-rev/1-abc", `{"name":"lodash","versions":{}}`},
+		{http.MethodDelete, "/lodash/-/lodash-4.17.21.tgz/-rev/1-abc", ""},
+		{http.MethodDelete, "/lodash/-rev/1-abc", ""},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+testNPMPublishToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, w.Code, http.StatusMethodNotAllowed)
+		}
+	}
+
+	if art, _ := db.GetArtifact("pkg:npm/lodash@4.17.21", "lodash-4.17.21.tgz"); art == nil {
+		t.Error("proxied artifact was removed")
+	}
+	if len(store.files) != 1 {
+		t.Errorf("storage has %d files, want the proxied tarball kept", len(store.files))
+	}
+}
+
+func TestParseNPMRevPath(t *testing.T) {
+	tests := []struct {
+		path         string
+		wantName     string
+		wantFilename string
+		wantOK       bool
+	}{
+		{"widgets/-rev/1-abc", "widgets", "", true},
+		{"@acme%2fwidgets/-rev/1-abc", "@acme/widgets", "", true},
+		{"@acme/widgets/-/widgets-1.0.0.tgz/-rev/2-def", "@acme/widgets", "widgets-1.0.0.tgz", true},
+		{"widgets", "", "", false},
+		{"widgets/-rev/", "", "", false},
+		{"-/package/widgets/-rev/1", "", "", false},
+	}
+	for _, tt := range tests {
+		name, filename, ok := parseNPMRevPath(tt.path)
+		if name != tt.wantName || filename != tt.wantFilename || ok != tt.wantOK {
+			t.Errorf("parseNPMRevPath(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.path, name, filename, ok, tt.wantName, tt.wantFilename, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SetNPMScopeUpstreams routes scoped npm packages to their own registries,
+// keyed by scope with its "@" (e.g. "@mycompany"). Packages outside these
+// scopes use the default upstream. Entries that don't parse as absolute
+// URLs are skipped; config validation rejects them before this is called.
+func (p *Proxy) SetNPMScopeUpstreams(scopes map[string]string) {
+	p.npmScopeUpstreams = nil
+	for scope, upstream := range scopes {
+		u, err := url.Parse(strings.TrimSpace(upstream))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			continue
+		}
+		if p.npmScopeUpstreams == nil {
+			p.npmScopeUpstreams = make(map[string]string)
+		}
+		p.npmScopeUpstreams[strings.ToLower(scope)] = strings.TrimSuffix(u.String(), "/")
+	}
+}
+
+// upstreamFor returns the registry packageName is fetched from. scoped is
+// true when it comes from the package's scope mapping rather than the
+// default upstream.
+func (h *NPMHandler) upstreamFor(packageName string) (upstream string, scoped bool) {
+	if scope, _, ok := strings.Cut(packageName, "/"); ok && strings.HasPrefix(scope, "@") {
+		if upstream, ok := h.proxy.npmScopeUpstreams[strings.ToLower(scope)]; ok {
+			return upstream, true
+		}
+	}
+	return h.upstreamURL, false
+}
+
+// scopedTarballURL returns the URL of filename on the registry mapped to
+// packageName's scope, or "" when the package isn't in a mapped scope and
+// the download is resolved the usual way. Registries are assumed to serve
+// tarballs at the standard /<name>/-/<filename> path.
+func (h *NPMHandler) scopedTarballURL(packageName, filename string) string {
+	upstream, scoped := h.upstreamFor(packageName)
+	if !scoped {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/-/%s", upstream, packageName, url.PathEscape(filename))
+}
+
+// isTrustedTarball reports whether a tarball URL in packageName's metadata
+// may be rewritten to this proxy: its host is trusted for npm, or it is the
+// registry mapped to the package's scope.
+func (h *NPMHandler) isTrustedTarball(packageName, tarball string) bool {
+	if h.proxy.IsTrustedUpstream("npm", tarball) {
+		return true
+	}
+	upstream, scoped := h.upstreamFor(packageName)
+	return scoped && urlHostPort(tarball) != "" && urlHostPort(tarball) == urlHostPort(upstream)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestNPMScopeUpstreamMetadata(t *testing.T) {
+	var internalPaths, publicPaths []string
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalPaths = append(internalPaths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"@mycompany/widgets","versions":{"1.2.0":{"dist":{` +
+			`"tarball":"http://` + r.Host + `/@mycompany/widgets/-/widgets-1.2.0.tgz"}}}}`))
+	}))
+	defer internal.Close()
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		publicPaths = append(publicPaths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"lodash","versions":{}}`))
+	}))
+	defer public.Close()
+
+	proxy := testProxy()
+	proxy.SetNPMScopeUpstreams(map[string]string{"@MyCompany": internal.URL + "/"})
+	h := &NPMHandler{proxy: proxy, upstreamURL: public.URL, linkBase: linkBase{proxyURL: "http://proxy.local"}}
+
+	w := httptest.NewRecorder()
+	h.handlePackageMetadata(w, httptest.NewRequest(http.MethodGet, "/@mycompany%2fwidgets", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scoped status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(internalPaths) != 1 || internalPaths[0] != "/@mycompany%2Fwidgets" {
+		t.Errorf("internal upstream requests = %v", internalPaths)
+	}
+	if len(publicPaths) != 0 {
+		t.Errorf("scoped package should not reach the default upstream, got %v", publicPaths)
+	}
+
+	var result struct {
+		Versions map[string]struct {
+			Dist struct {
+				Tarball string `json:"tarball"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("parsing response: %v", err)
+	}
+	if got, want := result.Versions["1.2.0"].Dist.Tarball, "http://proxy.local/npm/@mycompany%2Fwidgets/-/widgets-1.2.0.tgz"; got != want {
+		t.Errorf("tarball = %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"lodash", "@other/pkg"} {
+		w = httptest.NewRecorder()
+		h.handlePackageMetadata(w, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, want %d", name, w.Code, http.StatusOK)
+		}
+	}
+	if len(publicPaths) != 2 {
+		t.Errorf("default upstream requests = %v, want lodash and @other/pkg", publicPaths)
+	}
+	if len(internalPaths) != 1 {
+		t.Errorf("internal upstream requests = %v, want only the scoped package", internalPaths)
+	}
+}
+
+func TestNPMScopeUpstreamDownload(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	proxy.SetNPMScopeUpstreams(map[string]string{"@mycompany": "https://npm.internal.example.com/registry"})
+	h := NewNPMHandler(proxy, "http://proxy.local")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/@mycompany/widgets/-/widgets-1.2.0.tgz", "https://npm.internal.example.com/registry/@mycompany/widgets/-/widgets-1.2.0.tgz"},
+		{"/lodash/-/lodash-4.17.21.tgz", "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz"},
+	}
+	for _, tt := range tests {
+		fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("\x1f\x8btarball"))}
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.path, w.Code, http.StatusOK, w.Body.String())
+		}
+		if fetcher.fetchedURL != tt.want {
+			t.Errorf("%s: fetched %q, want %q", tt.path, fetcher.fetchedURL, tt.want)
+		}
+	}
+}
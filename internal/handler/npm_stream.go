@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// npmStreamRewriteMin is the packument size above which
+// writePackageMetadata uses the token rewriter. Decoding a packument into
+// maps takes several times its size in memory, which for the largest
+// (thousands of versions, tens of megabytes) adds up quickly. Smaller
+// documents are cheap to decode whole and keep the simpler path.
+const npmStreamRewriteMin = metadataSpoolThreshold
+
+// npmStreamPlan is what the streaming rewriter changes besides tarball
+// URLs: the versions cooldown removes and the dist-tags.latest to write in
+// place of a removed one.
+type npmStreamPlan struct {
+	removed map[string]bool
+	latest  string
+}
+
+// streamRewriteMetadata rewrites the packument in spool into w, which gets
+// a 200 once the document has been checked. The spool is read twice token
+// by token, never decoded into maps: once for the cooldown decisions, which
+// need the time map that npm puts after the versions, and once to copy it
+// with those applied and tarball URLs rewritten. Keys keep their upstream
+// order. Neither the packument nor its rewritten copy is held in memory.
+//
+// An error before anything is written leaves w untouched for the caller
+// to answer; once the copy has started, a failure can only truncate it.
+func (h *NPMHandler) streamRewriteMetadata(w http.ResponseWriter, packageName string, spool *metadataSpool) error {
+	plan, err := h.npmCooldownPlan(packageName, spool.Reader())
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := h.rewritePackumentStream(w, spool.Reader(), packageName, plan); err != nil {
+		h.proxy.Logger.Warn("npm metadata response cut short", "package", packageName, "error", err)
+	}
+	return nil
+}
+
+// npmCooldownPlan reads the version list, time map and dist-tags from a
+// packument and works out which versions cooldown removes. The plan is
+// empty when cooldown is off, but the whole document is still read, so a
+// malformed one is caught before any of it is sent.
+func (h *NPMHandler) npmCooldownPlan(packageName string, src io.Reader) (npmStreamPlan, error) {
+	var plan npmStreamPlan
+	cooldownOn := h.proxy.Cooldown != nil && h.proxy.Cooldown.Enabled()
+
+	var (
+		versions = make(map[string]any)
+		timeMap  map[string]any
+		distTags map[string]any
+	)
+	dec := json.NewDecoder(src)
+	if err := expectJSONDelim(dec, '{'); err != nil {
+		return plan, err
+	}
+	for dec.More() {
+		key, err := jsonObjectKey(dec)
+		if err != nil {
+			return plan, err
+		}
+		switch {
+		case !cooldownOn:
+			err = skipJSONValue(dec)
+		case key == "time":
+			err = dec.Decode(&timeMap)
+		case key == "dist-tags":
+			err = dec.Decode(&distTags)
+		case key == "versions":
+			err = collectJSONObjectKeys(dec, versions)
+		default:
+			err = skipJSONValue(dec)
+		}
+		if err != nil {
+			return plan, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return plan, err
+	}
+	if timeMap == nil {
+		return plan, nil
+	}
+
+	packagePURL := canonicalPackagePURL("npm", packageName)
+	plan.removed = make(map[string]bool)
+	for version := range versions {
+		publishedStr, ok := timeMap[version].(string)
+		if !ok {
+			continue
+		}
+		publishedAt, err := time.Parse(time.RFC3339, publishedStr)
+		if err != nil {
+			continue
+		}
+		if !h.proxy.Cooldown.IsAllowed("npm", packagePURL, publishedAt) {
+			h.proxy.Logger.Info("cooldown: filtering npm version",
+				"package", packageName, "version", version,
+				"published", publishedStr)
+			plan.removed[version] = true
+			delete(versions, version)
+		}
+	}
+
+	if latest, ok := distTags["latest"].(string); ok {
+		if _, exists := versions[latest]; !exists {
+			plan.latest = h.findNewestVersion(versions, timeMap)
+		}
+	}
+	return plan, nil
+}
+
+// rewritePackumentStream copies the packument in src to dst token by token,
+// rewriting each versions.*.dist.tarball to point at this proxy and
+// applying plan. Output is written to dst as it is produced rather than
+// after src has been read to the end.
+func (h *NPMHandler) rewritePackumentStream(dst io.Writer, src io.Reader, packageName string, plan npmStreamPlan) error {
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+	s := &npmPackumentStream{
+		h:           h,
+		dec:         dec,
+		out:         bufio.NewWriter(dst),
+		packageName: packageName,
+		plan:        plan,
+	}
+	if err := s.copyValue(nil); err != nil {
+		return err
+	}
+	return s.out.Flush()
+}
+
+type npmPackumentStream struct {
+	h           *NPMHandler
+	dec         *json.Decoder
+	out         *bufio.Writer
+	packageName string
+	plan        npmStreamPlan
+}
+
+// copyValue copies the next value, found under path, to the output.
+func (s *npmPackumentStream) copyValue(path []string) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '[' {
+			return s.copyArray(path)
+		}
+		return s.copyObject(path)
+	case string:
+		return s.writeString(s.rewriteString(path, v))
+	case json.Number:
+		_, err = s.out.WriteString(v.String())
+	case bool:
+		_, err = s.out.WriteString(strconv.FormatBool(v))
+	case nil:
+		_, err = s.out.WriteString("null")
+	default:
+		err = fmt.Errorf("unexpected JSON token %v", tok)
+	}
+	return err
+}
+
+func (s *npmPackumentStream) copyObject(path []string) error {
+	_ = s.out.WriteByte('{')
+	first := true
+	for s.dec.More() {
+		key, err := jsonObjectKey(s.dec)
+		if err != nil {
+			return err
+		}
+		if len(path) == 1 && (path[0] == "versions" || path[0] == "time") && s.plan.removed[key] {
+			if err := skipJSONValue(s.dec); err != nil {
+				return err
+			}
+			continue
+		}
+		if !first {
+			_ = s.out.WriteByte(',')
+		}
+		first = false
+		if err := s.writeString(key); err != nil {
+			return err
+		}
+		_ = s.out.WriteByte(':')
+		if err := s.copyValue(append(path, key)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	return s.out.WriteByte('}')
+}
+
+func (s *npmPackumentStream) copyArray(path []string) error {
+	_ = s.out.WriteByte('[')
+	for i := 0; s.dec.More(); i++ {
+		if i > 0 {
+			_ = s.out.WriteByte(',')
+		}
+		if err := s.copyValue(append(path, "")); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	return s.out.WriteByte(']')
+}
+
+// rewriteString returns the replacement for the string at path: a proxy
+// tarball URL or the new dist-tags.latest. Other strings are unchanged.
+func (s *npmPackumentStream) rewriteString(path []string, v string) string {
+	switch {
+	case len(path) == 4 && path[0] == "versions" && path[2] == "dist" && path[3] == "tarball":
+		if rewritten, ok := s.h.rewriteTarballURL(s.packageName, path[1], v); ok {
+			return rewritten
+		}
+	case len(path) == 2 && path[0] == "dist-tags" && path[1] == "latest" && s.plan.latest != "":
+		return s.plan.latest
+	}
+	return v
+}
+
+func (s *npmPackumentStream) writeString(v string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.out.Write(b)
+	return err
+}
+
+// expectJSONDelim reads the next token and fails unless it is want.
+func expectJSONDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q in JSON, got %v", want, tok)
+	}
+	return nil
+}
+
+// jsonObjectKey reads the next object key.
+func jsonObjectKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected JSON object key, got %v", tok)
+	}
+	return key, nil
+}
+
+// collectJSONObjectKeys reads an object, adding its keys to keys and
+// skipping their values.
+func collectJSONObjectKeys(dec *json.Decoder, keys map[string]any) error {
+	if err := expectJSONDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := jsonObjectKey(dec)
+		if err != nil {
+			return err
+		}
+		keys[key] = nil
+		if err := skipJSONValue(dec); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// skipJSONValue reads past the next value without keeping it.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := tok.(json.Delim); ok {
+			if d == '{' || d == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/cooldown"
+)
+
+// largePackument builds a packument with n versions published a minute
+// apart, the last recent of them within the hour and the rest ten days ago.
+func largePackument(n, recent int) []byte {
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString(`{"_id":"bigpkg","name":"bigpkg","description":"a <big> & busy package",`)
+	fmt.Fprintf(&b, `"dist-tags":{"latest":"1.0.%d","beta":"1.0.%d"},"versions":{`, n-1, n-2)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `"1.0.%d":{"name":"bigpkg","version":"1.0.%d","keywords":["a","b"],`+
+			`"deprecated":false,"gitHead":null,"_nodeVersion":"20.10.0","size":%d,`+
+			`"dependencies":{"left-pad":"^1.3.0"},`+
+			`"dist":{"shasum":"%040d","integrity":"sha512-%086d","fileCount":12,`+
+			`"tarball":"https://registry.npmjs.org/bigpkg/-/bigpkg-1.0.%d.tgz"}}`,
+			i, i, 1000+i, i, i, i)
+	}
+	b.WriteString(`},"time":{`)
+	fmt.Fprintf(&b, `"created":%q,"modified":%q`, now.Format(time.RFC3339), now.Format(time.RFC3339))
+	for i := range n {
+		published := now.Add(-10*24*time.Hour + time.Duration(i)*time.Minute)
+		if i >= n-recent {
+			published = now.Add(-time.Hour + time.Duration(i-n)*time.Minute)
+		}
+		fmt.Fprintf(&b, `,"1.0.%d":%q`, i, published.Format(time.RFC3339))
+	}
+	b.WriteString(`},"readme":"line one\nline two ☃"}`)
+	return []byte(b.String())
+}
+
+func TestNPMStreamRewriteMatchesMapRewrite(t *testing.T) {
+	for _, withCooldown := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cooldown=%v", withCooldown), func(t *testing.T) {
+			proxy := testProxy()
+			if withCooldown {
+				proxy.Cooldown = &cooldown.Config{Default: "3d"}
+			}
+			h := &NPMHandler{proxy: proxy, linkBase: linkBase{proxyURL: "http://localhost:8080"}}
+
+			// Small enough for rewriteMetadata to take the map path.
+			body := largePackument(50, 3)
+			if len(body) > npmStreamRewriteMin {
+				t.Fatalf("packument is %d bytes, want under %d", len(body), npmStreamRewriteMin)
+			}
+
+			want, err := h.rewriteMetadata("bigpkg", body)
+			if err != nil {
+				t.Fatalf("rewriteMetadata: %v", err)
+			}
+			got, err := streamRewrite(h, body)
+			if err != nil {
+				t.Fatalf("streamRewriteMetadata: %v", err)
+			}
+
+			var wantDoc, gotDoc map[string]any
+			if err := json.Unmarshal(want, &wantDoc); err != nil {
+				t.Fatalf("parsing map output: %v", err)
+			}
+			if err := json.Unmarshal(got, &gotDoc); err != nil {
+				t.Fatalf("parsing streamed output: %v", err)
+			}
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Errorf("streamed rewrite differs from map rewrite")
+			}
+		})
+	}
+}
+
+// streamRewrite runs streamRewriteMetadata over body and returns what it
+// wrote.
+func streamRewrite(h *NPMHandler, body []byte) ([]byte, error) {
+	spool, err := h.proxy.spoolMetadata(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = spool.Close() }()
+
+	w := httptest.NewRecorder()
+	if err := h.streamRewriteMetadata(w, "bigpkg", spool); err != nil {
+		return nil, err
+	}
+	return w.Body.Bytes(), nil
+}
+
+func TestNPMMetadataLargePackument(t *testing.T) {
+	const n = 4000
+	body := largePackument(n, 2)
+	if len(body) <= npmStreamRewriteMin {
+		t.Fatalf("packument is %d bytes, want over %d", len(body), npmStreamRewriteMin)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	defer upstream.Close()
+
+	proxy := testProxy()
+	proxy.Cooldown = &cooldown.Config{Default: "3d"}
+	h := &NPMHandler{proxy: proxy, upstreamURL: upstream.URL, linkBase: linkBase{proxyURL: "http://localhost:8080"}}
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bigpkg", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	output := w.Body.Bytes()
+
+	var result struct {
+		DistTags map[string]string `json:"dist-tags"`
+		Versions map[string]struct {
+			Dist struct {
+				Tarball string `json:"tarball"`
+			} `json:"dist"`
+		} `json:"versions"`
+		Time map[string]string `json:"time"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		t.Fatalf("parsing output: %v", err)
+	}
+
+	if len(result.Versions) != n-2 {
+		t.Errorf("got %d versions, want %d", len(result.Versions), n-2)
+	}
+	for _, v := range []string{fmt.Sprintf("1.0.%d", n-1), fmt.Sprintf("1.0.%d", n-2)} {
+		if _, ok := result.Versions[v]; ok {
+			t.Errorf("version %s should be filtered by cooldown", v)
+		}
+		if _, ok := result.Time[v]; ok {
+			t.Errorf("time entry for %s should be filtered by cooldown", v)
+		}
+	}
+	if got := result.Versions["1.0.0"].Dist.Tarball; got != "http://localhost:8080/npm/bigpkg/-/bigpkg-1.0.0.tgz" {
+		t.Errorf("tarball = %q", got)
+	}
+	if result.DistTags["latest"] == fmt.Sprintf("1.0.%d", n-1) {
+		t.Error("dist-tags.latest should move off the filtered version")
+	}
+	if _, ok := result.Versions[result.DistTags["latest"]]; !ok {
+		t.Errorf("dist-tags.latest = %q is not a remaining version", result.DistTags["latest"])
+	}
+}
+
+// progressReader records how much of its input had been read each time
+// the writer it watches was written to.
+type progressReader struct {
+	r    io.Reader
+	read int
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += n
+	return n, err
+}
+
+type watchingWriter struct {
+	src          *progressReader
+	firstWriteAt int
+	bytes.Buffer
+}
+
+func (w *watchingWriter) Write(b []byte) (int, error) {
+	if w.Len() == 0 {
+		w.firstWriteAt = w.src.read
+	}
+	return w.Buffer.Write(b)
+}
+
+// The rewriter emits output while it reads rather than after the whole
+// document.
+func TestNPMRewritePackumentStreamWritesAsItReads(t *testing.T) {
+	h := &NPMHandler{proxy: testProxy(), linkBase: linkBase{proxyURL: "http://localhost:8080"}}
+	body := largePackument(4000, 0)
+
+	src := &progressReader{r: bytes.NewReader(body)}
+	dst := &watchingWriter{src: src}
+	if err := h.rewritePackumentStream(dst, src, "bigpkg", npmStreamPlan{}); err != nil {
+		t.Fatalf("rewritePackumentStream: %v", err)
+	}
+
+	if dst.firstWriteAt >= len(body)/2 {
+		t.Errorf("first output written after reading %d of %d bytes; want output before the end of input", dst.firstWriteAt, len(body))
+	}
+	if !json.Valid(dst.Bytes()) {
+		t.Error("output is not valid JSON")
+	}
+}
+
+func TestNPMStreamRewriteMalformed(t *testing.T) {
+	h := &NPMHandler{proxy: testProxy(), linkBase: linkBase{proxyURL: "http://localhost:8080"}}
+	for _, body := range []string{
+		`{"versions":{"1.0.0":{"dist":{"tarball":`,
+		`{"versions":[}`,
+		`not json`,
+	} {
+		spool, err := h.proxy.spoolMetadata(strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("spoolMetadata: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if err := h.streamRewriteMetadata(w, "bigpkg", spool); err == nil {
+			t.Errorf("streamRewriteMetadata(%q) succeeded, want error", body)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("streamRewriteMetadata(%q) wrote %q before failing", body, w.Body.String())
+		}
+		_ = spool.Close()
+	}
+}
+
+// heapWatcher is a ResponseWriter that discards the body and records the
+// largest live heap seen while it is written to.
+type heapWatcher struct {
+	httptest.ResponseRecorder
+	writes  int
+	maxHeap uint64
+}
+
+func (w *heapWatcher) Write(b []byte) (int, error) {
+	if w.writes%50 == 0 {
+		runtime.GC()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		w.maxHeap = max(w.maxHeap, ms.HeapAlloc)
+	}
+	w.writes++
+	return len(b), nil
+}
+
+// A large packument is rewritten from its spool into the response without
+// either copy being held in memory.
+func TestNPMStreamRewriteMemory(t *testing.T) {
+	h := &NPMHandler{proxy: testProxy(), linkBase: linkBase{proxyURL: "http://localhost:8080"}}
+	body := largePackument(20000, 0)
+	size := len(body)
+	spool, err := h.proxy.spoolMetadata(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("spoolMetadata: %v", err)
+	}
+	defer func() { _ = spool.Close() }()
+	body = nil
+
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base := ms.HeapAlloc
+
+	w := &heapWatcher{}
+	if err := h.streamRewriteMetadata(w, "bigpkg", spool); err != nil {
+		t.Fatalf("streamRewriteMetadata: %v", err)
+	}
+	if w.writes == 0 {
+		t.Fatal("nothing was written")
+	}
+	if grew := int64(w.maxHeap) - int64(base); grew > int64(size/8) {
+		t.Errorf("live heap grew by %d bytes rewriting a %d byte packument", grew, size)
+	}
+}
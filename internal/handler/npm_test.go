@@ -49,7 +49,7 @@ func TestNPMExtractVersionFromFilename(t *testing.T) {
 func TestNPMRewriteMetadata(t *testing.T) {
 	h := &NPMHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -90,7 +90,7 @@ func TestNPMRewriteMetadata(t *testing.T) {
 func TestNPMRewriteMetadataScopedPackage(t *testing.T) {
 	h := &NPMHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -153,7 +153,7 @@ func TestNPMHandlerMetadataProxy(t *testing.T) {
 	h := &NPMHandler{
 		proxy:       testProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	// Test metadata request
@@ -193,7 +193,7 @@ func TestNPMRewriteMetadataCooldown(t *testing.T) {
 
 	h := &NPMHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -262,7 +262,7 @@ func TestNPMRewriteMetadataCooldownExemptPackage(t *testing.T) {
 
 	h := &NPMHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -317,7 +317,7 @@ func TestNPMHandlerUsesAbbreviatedMetadata(t *testing.T) {
 		h := &NPMHandler{
 			proxy:       testProxy(),
 			upstreamURL: upstream.URL,
-			proxyURL:    "http://proxy.local",
+			linkBase:    linkBase{proxyURL: "http://proxy.local"},
 		}
 
 		req := httptest.NewRequest(http.MethodGet, "/testpkg", nil)
@@ -336,7 +336,7 @@ func TestNPMHandlerUsesAbbreviatedMetadata(t *testing.T) {
 		h := &NPMHandler{
 			proxy:       proxy,
 			upstreamURL: upstream.URL,
-			proxyURL:    "http://proxy.local",
+			linkBase:    linkBase{proxyURL: "http://proxy.local"},
 		}
 
 		req := httptest.NewRequest(http.MethodGet, "/testpkg", nil)
@@ -358,7 +358,7 @@ func TestNPMHandlerMetadataNotFound(t *testing.T) {
 	h := &NPMHandler{
 		proxy:       testProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/nonexistent", nil)
@@ -371,3 +371,34 @@ func TestNPMHandlerMetadataNotFound(t *testing.T) {
 		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
 	}
 }
+
+func TestNPMHandlerHeadTarball(t *testing.T) {
+	proxy, _, store, fetcher := setupTestProxy(t)
+	fetcher.headSize = 1234
+	fetcher.headType = "application/octet-stream"
+	h := NewNPMHandler(proxy, "http://proxy.local").Routes()
+
+	req := httptest.NewRequest(http.MethodHead, "/lodash/-/lodash-4.17.21.tgz", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Length"); got != "1234" {
+		t.Errorf("Content-Length = %q, want 1234", got)
+	}
+	if fetcher.headURL != "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz" {
+		t.Errorf("upstream HEAD URL = %q", fetcher.headURL)
+	}
+	if fetcher.fetchCalled || len(store.files) != 0 {
+		t.Error("HEAD should not download or cache the tarball")
+	}
+
+	req = httptest.NewRequest(http.MethodHead, "/lodash", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD on metadata status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/vers"
+)
+
+// npm unpublish works against the packument revision it fetched. Removing
+// one version PUTs the packument without it to /{name}/-rev/{rev}, then
+// DELETEs /{name}/-/{filename}/-rev/{rev}; removing the whole package
+// DELETEs /{name}/-rev/{rev}. Writes are serialized by npmPublishMu, so the
+// revision itself isn't checked.
+//
+// Unpublishing leaves tombstones in the packument, the way the npm
+// registry does. A removed version keeps its entry in the time map, and a
+// version with a time entry can't be published again, so a version number
+// never points at two different tarballs. Removing the whole package keeps
+// a packument with only its time map and time.unpublished, which is served
+// as a 404. The name stays local, so it is never proxied from upstream
+// afterwards.
+
+// parseNPMRevPath splits a path of the form "{name}/-rev/{rev}" or
+// "{name}/-/{filename}/-rev/{rev}". ok is false for anything else.
+func parseNPMRevPath(path string) (name, filename string, ok bool) {
+	idx := strings.LastIndex(path, "/-rev/")
+	if idx < 0 {
+		return "", "", false
+	}
+	if rev := path[idx+len("/-rev/"):]; rev == "" || strings.Contains(rev, "/") {
+		return "", "", false
+	}
+	rest := path[:idx]
+	if before, after, found := strings.Cut(rest, "/-/"); found {
+		if after == "" || strings.Contains(after, "/") {
+			return "", "", false
+		}
+		rest, filename = before, after
+	}
+	name, err := url.PathUnescape(rest)
+	if err != nil || !isNPMPackageName(name) {
+		return "", "", false
+	}
+	return name, filename, true
+}
+
+// handleUnpublish routes the writes npm unpublish makes. Only packages
+// published to this proxy can be unpublished.
+func (h *NPMHandler) handleUnpublish(w http.ResponseWriter, r *http.Request, name, filename string) {
+	switch {
+	case r.Method == http.MethodPut && filename == "":
+		body, ok := h.decodeWriteBody(w, r, name)
+		if !ok {
+			return
+		}
+		h.proxy.npmPublishMu.Lock()
+		defer h.proxy.npmPublishMu.Unlock()
+		h.unpublishVersions(w, r, name, body)
+	case r.Method == http.MethodDelete && filename == "":
+		h.proxy.npmPublishMu.Lock()
+		defer h.proxy.npmPublishMu.Unlock()
+		h.unpublishPackage(w, r, name)
+	case r.Method == http.MethodDelete:
+		h.proxy.npmPublishMu.Lock()
+		defer h.proxy.npmPublishMu.Unlock()
+		h.unpublishTarball(w, r, name, filename)
+	default:
+		h.rejectWrite(w, r, name, "unsupported npm registry write")
+	}
+}
+
+// loadUnpublishTarget returns the local packument for name. For a package
+// that isn't published here it writes the rejection and returns nil.
+func (h *NPMHandler) loadUnpublishTarget(w http.ResponseWriter, r *http.Request, name string) map[string]any {
+	doc, err := h.loadLocalPackument(name)
+	if err != nil {
+		h.proxy.Logger.Error("failed to load npm packument", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to unpublish package")
+		return nil
+	}
+	if doc == nil || npmUnpublished(doc) {
+		h.rejectWrite(w, r, name, "package is not published to this proxy")
+		return nil
+	}
+	return doc
+}
+
+// npmUnpublished reports whether doc is the tombstone of a package that was
+// unpublished entirely.
+func npmUnpublished(doc map[string]any) bool {
+	times, _ := doc["time"].(map[string]any)
+	_, ok := times["unpublished"]
+	return ok
+}
+
+// unpublishVersions removes every version of the local packument that body
+// leaves out, along with its tarball and database rows. Dist-tags pointing
+// at a removed version are dropped and latest moves to the highest
+// remaining version. Removing every version unpublishes the package.
+func (h *NPMHandler) unpublishVersions(w http.ResponseWriter, r *http.Request, name string, body *npmWriteBody) {
+	doc := h.loadUnpublishTarget(w, r, name)
+	if doc == nil {
+		return
+	}
+	if len(body.Attachments) > 0 {
+		h.rejectWrite(w, r, name, "unsupported npm registry write")
+		return
+	}
+
+	versions, _ := doc["versions"].(map[string]any)
+	for version := range body.Versions {
+		if _, ok := versions[version]; !ok {
+			h.rejectWrite(w, r, name, "unpublish cannot add versions")
+			return
+		}
+	}
+	var removed []string
+	for version := range versions {
+		if _, ok := body.Versions[version]; !ok {
+			removed = append(removed, version)
+		}
+	}
+	if len(removed) == 0 {
+		writeNPMOK(w, http.StatusOK)
+		return
+	}
+	if len(removed) == len(versions) {
+		h.unpublishPackage(w, r, name)
+		return
+	}
+
+	times, _ := doc["time"].(map[string]any)
+	for _, version := range removed {
+		if err := h.removePublishedVersion(r.Context(), name, version); err != nil {
+			h.proxy.Logger.Error("failed to unpublish npm version", "package", name, "version", version, "error", err)
+			JSONError(w, http.StatusInternalServerError, "failed to unpublish package")
+			return
+		}
+		delete(versions, version)
+	}
+
+	distTags, _ := doc["dist-tags"].(map[string]any)
+	for tag, v := range distTags {
+		if version, _ := v.(string); versions[version] == nil {
+			delete(distTags, tag)
+		}
+	}
+	if _, ok := distTags["latest"]; !ok {
+		var latest string
+		for version := range versions {
+			if latest == "" || vers.CompareWithScheme(version, latest, "npm") > 0 {
+				latest = version
+			}
+		}
+		distTags["latest"] = latest
+	}
+	if times != nil {
+		times["modified"] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if err := h.saveLocalPackument(name, doc); err != nil {
+		h.proxy.Logger.Error("failed to save npm packument", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to unpublish package")
+		return
+	}
+	latest, _ := distTags["latest"].(string)
+	if err := h.proxy.DB.SetPackageLatestVersion(purl.MakePURLString("npm", name, ""), latest); err != nil {
+		h.proxy.Logger.Warn("failed to update latest version", "package", name, "error", err)
+	}
+
+	h.proxy.Logger.Info("npm versions unpublished", "package", name, "versions", removed)
+	writeNPMOK(w, http.StatusOK)
+}
+
+// unpublishPackage removes a locally published package entirely: its
+// tarballs and database rows, and every version from its packument. The
+// packument is kept as a tombstone, so the name isn't proxied from upstream
+// afterwards and none of its versions can be published again.
+func (h *NPMHandler) unpublishPackage(w http.ResponseWriter, r *http.Request, name string) {
+	doc := h.loadUnpublishTarget(w, r, name)
+	if doc == nil {
+		return
+	}
+
+	var paths []string
+	err := retryOnBusy(func() error {
+		var err error
+		paths, err = h.proxy.DB.DeletePackage(purl.MakePURLString("npm", name, ""))
+		return err
+	})
+	if err != nil {
+		h.proxy.Logger.Error("failed to unpublish npm package", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to unpublish package")
+		return
+	}
+	if err := h.saveLocalPackument(name, npmTombstone(doc)); err != nil {
+		h.proxy.Logger.Error("failed to save npm packument", "package", name, "error", err)
+		JSONError(w, http.StatusInternalServerError, "failed to unpublish package")
+		return
+	}
+	h.deletePublishedTarballs(r.Context(), paths)
+
+	h.proxy.Logger.Info("npm package unpublished", "package", name)
+	writeNPMOK(w, http.StatusOK)
+}
+
+// npmTombstone returns what is left of doc once the whole package is
+// unpublished: its name and its time map, with the unpublished versions
+// recorded under time.unpublished.
+func npmTombstone(doc map[string]any) map[string]any {
+	versions, _ := doc["versions"].(map[string]any)
+	removed := make([]string, 0, len(versions))
+	for version := range versions {
+		removed = append(removed, version)
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return vers.CompareWithScheme(removed[i], removed[j], "npm") < 0
+	})
+
+	times, _ := doc["time"].(map[string]any)
+	if times == nil {
+		times = map[string]any{}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	times["modified"] = now
+	times["unpublished"] = map[string]any{
+		"time":     now,
+		"versions": removed,
+	}
+	return map[string]any{
+		"_id":  doc["_id"],
+		"name": doc["name"],
+		"time": times,
+	}
+}
+
+// unpublishTarball answers the tarball DELETE npm sends after removing a
+// version from the packument. The tarball went with the version, so there
+// is nothing left to do. A tarball whose version is still published can't
+// be deleted on its own.
+func (h *NPMHandler) unpublishTarball(w http.ResponseWriter, r *http.Request, name, filename string) {
+	doc := h.loadUnpublishTarget(w, r, name)
+	if doc == nil {
+		return
+	}
+	versions, _ := doc["versions"].(map[string]any)
+	for version := range versions {
+		if npmTarballFilename(name, version) == filename {
+			JSONError(w, http.StatusConflict, "tarball belongs to a published version; unpublish the version instead")
+			return
+		}
+	}
+	writeNPMOK(w, http.StatusOK)
+}
+
+// removePublishedVersion deletes a published version's database rows and
+// tarball.
+func (h *NPMHandler) removePublishedVersion(ctx context.Context, name, version string) error {
+	var paths []string
+	err := retryOnBusy(func() error {
+		var err error
+		paths, err = h.proxy.DB.DeleteVersion(purl.MakePURLString("npm", name, version))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	h.deletePublishedTarballs(ctx, paths)
+	return nil
+}
+
+// deletePublishedTarballs removes unpublished tarballs from storage. A
+// failure only leaves an orphaned blob, which a reconcile scan reports, so
+// it is logged rather than returned.
+func (h *NPMHandler) deletePublishedTarballs(ctx context.Context, paths []string) {
+	for _, path := range paths {
+		if err := h.proxy.Storage.Delete(context.WithoutCancel(ctx), path); err != nil {
+			h.proxy.Logger.Warn("failed to delete unpublished tarball", "path", path, "error", err)
+		}
+	}
+}
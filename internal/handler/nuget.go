@@ -18,7 +18,7 @@ const (
 type NuGetHandler struct {
 	proxy       *Proxy
 	upstreamURL string
-	proxyURL    string
+	linkBase
 }
 
 // NewNuGetHandler creates a new NuGet protocol handler.
@@ -26,7 +26,7 @@ func NewNuGetHandler(proxy *Proxy, proxyURL string) *NuGetHandler {
 	return &NuGetHandler{
 		proxy:       proxy,
 		upstreamURL: nugetUpstream,
-		proxyURL:    strings.TrimSuffix(proxyURL, "/"),
+		linkBase:    linkBase{proxyURL: strings.TrimSuffix(proxyURL, "/")},
 	}
 }
 
@@ -70,7 +70,7 @@ func (h *NuGetHandler) handleServiceIndex(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	rewritten, err := h.rewriteServiceIndex(body)
+	rewritten, err := forRequest(h, r).rewriteServiceIndex(body)
 	if err != nil {
 		h.proxy.Logger.Warn("failed to rewrite service index, proxying original", "error", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -181,11 +181,7 @@ func (h *NuGetHandler) handleRegistration(w http.ResponseWriter, r *http.Request
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		for k, vv := range resp.Header {
-			for _, v := range vv {
-				w.Header().Add(k, v)
-			}
-		}
+		h.proxy.copyUpstreamHeaders(w.Header(), resp.Header)
 		w.WriteHeader(resp.StatusCode)
 		_, _ = io.Copy(w, resp.Body)
 		return
@@ -312,14 +308,16 @@ func (h *NuGetHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	name := strings.ToLower(id)
 	upstreamURL := fmt.Sprintf("%s/v3-flatcontainer/%s/%s/%s", h.upstreamURL, name, version, filename)
 
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "nuget", name, version, filename, upstreamURL)
+	result, err := h.proxy.GetOrFetchArtifactFromURL(expectBinary(r.Context()), "nuget", name, version, filename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // proxyUpstream forwards a request to NuGet without caching.
@@ -348,11 +346,7 @@ func (h *NuGetHandler) proxyUpstream(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
+	h.proxy.copyUpstreamHeaders(w.Header(), resp.Header)
 
 	w.WriteHeader(resp.StatusCode)
 	_, _ = io.Copy(w, resp.Body)
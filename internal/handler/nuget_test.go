@@ -24,7 +24,7 @@ func TestNuGetRewriteServiceIndex(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: nugetUpstream,
-		proxyURL:    "http://localhost:8080",
+		linkBase:    linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -127,7 +127,7 @@ func TestNuGetShouldRewriteService(t *testing.T) {
 
 func TestNuGetRewriteURL(t *testing.T) {
 	h := &NuGetHandler{
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	tests := []struct {
@@ -186,7 +186,7 @@ func TestNuGetHandleServiceIndex(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3/index.json", nil)
@@ -223,7 +223,7 @@ func TestNuGetHandleServiceIndexUpstreamError(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3/index.json", nil)
@@ -240,7 +240,7 @@ func TestNuGetHandleServiceIndexUpstreamUnreachable(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: "http://127.0.0.1:1", // unreachable
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3/index.json", nil)
@@ -262,7 +262,7 @@ func TestNuGetHandleServiceIndexInvalidJSON(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3/index.json", nil)
@@ -284,7 +284,7 @@ func TestNuGetHandleDownloadEmptyParams(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: "http://localhost:1",
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	// Missing path values
@@ -313,7 +313,7 @@ func TestNuGetHandleDownloadNonNupkg(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/newtonsoft.json/13.0.1/newtonsoft.json.nuspec", nil)
@@ -349,7 +349,7 @@ func TestNuGetProxyUpstream(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/newtonsoft.json/index.json", nil)
@@ -375,7 +375,7 @@ func TestNuGetProxyUpstreamNotFound(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/nonexistent/index.json", nil)
@@ -391,7 +391,7 @@ func TestNuGetProxyUpstreamBadUpstream(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: "http://127.0.0.1:1",
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test/index.json", nil)
@@ -412,16 +412,21 @@ func TestNuGetProxyUpstreamCopiesHeaders(t *testing.T) {
 	}))
 	defer upstream.Close()
 
+	proxy := nugetTestProxy()
+	proxy.SetForwardedResponseHeaders([]string{"X-Custom"})
 	h := &NuGetHandler{
-		proxy:       nugetTestProxy(),
+		proxy:       proxy,
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test/index.json", nil)
 	w := httptest.NewRecorder()
 	h.proxyUpstream(w, req)
 
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
 	if w.Header().Get("X-Custom") != "value" {
 		t.Errorf("X-Custom = %q, want %q", w.Header().Get("X-Custom"), "value")
 	}
@@ -442,7 +447,7 @@ func TestNuGetProxyUpstreamForwardsAcceptEncoding(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test/index.json", nil)
@@ -510,7 +515,7 @@ func TestNuGetRoutes(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	routes := h.Routes()
@@ -550,7 +555,7 @@ func TestNewNuGetHandlerNoTrailingSlash(t *testing.T) {
 
 func TestNuGetRewriteServiceIndexNoResources(t *testing.T) {
 	h := &NuGetHandler{
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{"version":"3.0.0"}`
@@ -571,7 +576,7 @@ func TestNuGetRewriteServiceIndexNoResources(t *testing.T) {
 
 func TestNuGetRewriteServiceIndexAllTypes(t *testing.T) {
 	h := &NuGetHandler{
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	// Test every rewritable service type
@@ -633,7 +638,7 @@ func TestNuGetProxyUpstreamPreservesStatusCodes(t *testing.T) {
 		h := &NuGetHandler{
 			proxy:       nugetTestProxy(),
 			upstreamURL: upstream.URL,
-			proxyURL:    "http://proxy.local",
+			linkBase:    linkBase{proxyURL: "http://proxy.local"},
 		}
 
 		req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test/index.json", nil)
@@ -660,7 +665,7 @@ func TestNuGetProxyUpstreamCopiesBody(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test/index.json", nil)
@@ -677,7 +682,7 @@ func TestNuGetHandleDownloadMissingID(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: "http://localhost:1",
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer//1.0.0/test.nupkg", nil)
@@ -697,7 +702,7 @@ func TestNuGetHandleDownloadMissingVersion(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: "http://localhost:1",
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test//test.nupkg", nil)
@@ -717,7 +722,7 @@ func TestNuGetHandleDownloadMissingFilename(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(),
 		upstreamURL: "http://localhost:1",
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3-flatcontainer/test/1.0.0/", nil)
@@ -814,7 +819,7 @@ func TestNuGetCooldownFiltering(t *testing.T) {
 
 	h := &NuGetHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	filtered, err := h.applyCooldownFiltering(body)
@@ -880,7 +885,7 @@ func TestNuGetCooldownFilteringWithPackageOverride(t *testing.T) {
 
 	h := &NuGetHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	filtered, err := h.applyCooldownFiltering(body)
@@ -928,7 +933,7 @@ func TestNuGetCooldownNoCooldownConfig(t *testing.T) {
 	// No cooldown - applyCooldownFiltering still works, just doesn't filter
 	h := &NuGetHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	filtered, err := h.applyCooldownFiltering(body)
@@ -990,7 +995,7 @@ func TestNuGetCooldownFilteringNuGetTimestamp(t *testing.T) {
 
 	h := &NuGetHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	filtered, err := h.applyCooldownFiltering(body)
@@ -1055,7 +1060,7 @@ func TestNuGetHandleRegistrationWithCooldown(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       proxy,
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3/registration5-gz-semver2/testpkg/index.json", nil)
@@ -1090,7 +1095,7 @@ func TestNuGetHandleRegistrationWithoutCooldown(t *testing.T) {
 	h := &NuGetHandler{
 		proxy:       nugetTestProxy(), // no cooldown configured
 		upstreamURL: upstream.URL,
-		proxyURL:    "http://proxy.local",
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/v3/registration5-gz-semver2/testpkg/index.json", nil)
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+// Policy decisions recorded in the policy_events table.
+const (
+	PolicyDecisionDeny = "deny"
+)
+
+// defaultPolicyEventsMax is used when Proxy.PolicyEventsMax is unset.
+const defaultPolicyEventsMax = 10000
+
+// RecordPolicyEvent writes an audit record for a request that was rejected by
+// a policy, then trims the table to the newest PolicyEventsMax rows. Failures
+// are logged and never affect the response sent to the client.
+func (p *Proxy) RecordPolicyEvent(r *http.Request, ecosystem, name, version, decision, reason string) {
+	p.recordPolicyEvent(clientIP(r), ecosystem, name, version, decision, reason)
+}
+
+// recordPolicyEventCtx is RecordPolicyEvent for decisions made below the
+// handler, where only the request context is passed along. The client
+// address comes from ClientIPMiddleware.
+func (p *Proxy) recordPolicyEventCtx(ctx context.Context, ecosystem, name, version, decision, reason string) {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	p.recordPolicyEvent(ip, ecosystem, name, version, decision, reason)
+}
+
+func (p *Proxy) recordPolicyEvent(ip, ecosystem, name, version, decision, reason string) {
+	p.Logger.Info("policy decision",
+		"ecosystem", ecosystem, "name", name, "version", version,
+		"decision", decision, "reason", reason)
+
+	if p.DB == nil {
+		return
+	}
+
+	event := &database.PolicyEvent{
+		ClientIP:  ip,
+		Ecosystem: ecosystem,
+		Name:      name,
+		Version:   version,
+		Decision:  decision,
+		Reason:    reason,
+	}
+	if err := p.DB.InsertPolicyEvent(event); err != nil {
+		p.Logger.Warn("failed to record policy event", "error", err)
+		return
+	}
+
+	limit := p.PolicyEventsMax
+	if limit <= 0 {
+		limit = defaultPolicyEventsMax
+	}
+	if _, err := p.DB.PrunePolicyEvents(limit); err != nil {
+		p.Logger.Warn("failed to prune policy events", "error", err)
+	}
+}
+
+type clientIPKey struct{}
+
+// ClientIPMiddleware puts the client's address in the request context so
+// policy events recorded while serving the request carry it, even when the
+// decision is made in code that only sees the context.
+func ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
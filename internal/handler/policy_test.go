@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordPolicyEvent_GradleReadOnlyPut(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+	proxy.GradleReadOnly = true
+
+	h := NewGradleBuildCacheHandler(proxy)
+	req := httptest.NewRequest(http.MethodPut, "/blocked-key", strings.NewReader("payload"))
+	req.RemoteAddr = "192.0.2.10:54321"
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	events, err := db.ListPolicyEvents("", 10, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyEvents() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+
+	e := events[0]
+	if e.Ecosystem != "gradle" || e.Name != "blocked-key" {
+		t.Errorf("event package = %s/%s, want gradle/blocked-key", e.Ecosystem, e.Name)
+	}
+	if e.Decision != PolicyDecisionDeny {
+		t.Errorf("decision = %q, want %q", e.Decision, PolicyDecisionDeny)
+	}
+	if e.Reason != "gradle build cache is read-only" {
+		t.Errorf("reason = %q", e.Reason)
+	}
+	if e.ClientIP != "192.0.2.10" {
+		t.Errorf("client_ip = %q, want %q", e.ClientIP, "192.0.2.10")
+	}
+}
+
+func TestRecordPolicyEvent_Prunes(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+	proxy.PolicyEventsMax = 3
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		proxy.RecordPolicyEvent(req, "npm", name, "1.0.0", PolicyDecisionDeny, "test")
+	}
+
+	events, err := db.ListPolicyEvents("", 10, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyEvents() error = %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if events[0].Name != "e" || events[2].Name != "c" {
+		t.Errorf("kept events %s..%s, want e..c", events[0].Name, events[2].Name)
+	}
+}
@@ -18,7 +18,7 @@ const (
 type PubHandler struct {
 	proxy       *Proxy
 	upstreamURL string
-	proxyURL    string
+	linkBase
 }
 
 // NewPubHandler creates a new pub.dev protocol handler.
@@ -26,7 +26,7 @@ func NewPubHandler(proxy *Proxy, proxyURL string) *PubHandler {
 	return &PubHandler{
 		proxy:       proxy,
 		upstreamURL: pubUpstream,
-		proxyURL:    strings.TrimSuffix(proxyURL, "/"),
+		linkBase:    linkBase{proxyURL: strings.TrimSuffix(proxyURL, "/")},
 	}
 }
 
@@ -65,14 +65,16 @@ func (h *PubHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	h.proxy.Logger.Info("pub download request",
 		"name", name, "version", version)
 
-	result, err := h.proxy.GetOrFetchArtifact(r.Context(), "pub", name, version, filename)
+	result, err := h.proxy.GetOrFetchArtifact(expectBinary(r.Context()), "pub", name, version, filename)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get artifact", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handlePackageMetadata proxies package metadata and rewrites archive URLs.
@@ -87,6 +89,7 @@ func (h *PubHandler) handlePackageMetadata(w http.ResponseWriter, r *http.Reques
 
 	upstreamURL := fmt.Sprintf("%s/api/packages/%s", h.upstreamURL, name)
 
+	setMetadataMaxAge(w, h.proxy.MetadataTTLFor("pub", name))
 	body, _, err := h.proxy.FetchOrCacheMetadata(r.Context(), "pub", name, upstreamURL)
 	if err != nil {
 		if errors.Is(err, ErrUpstreamNotFound) {
@@ -98,7 +101,7 @@ func (h *PubHandler) handlePackageMetadata(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	rewritten, err := h.rewriteMetadata(name, body)
+	rewritten, err := forRequest(h, r).rewriteMetadata(name, body)
 	if err != nil {
 		h.proxy.Logger.Warn("failed to rewrite metadata, proxying original", "error", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -12,7 +12,7 @@ import (
 func TestPubRewriteMetadata(t *testing.T) {
 	h := &PubHandler{
 		proxy:    testProxy(),
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -54,7 +54,7 @@ func TestPubRewriteMetadataCooldown(t *testing.T) {
 
 	h := &PubHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
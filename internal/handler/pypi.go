@@ -1,15 +1,16 @@
 package handler
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -26,7 +27,7 @@ const (
 type PyPIHandler struct {
 	proxy       *Proxy
 	upstreamURL string
-	proxyURL    string
+	linkBase
 }
 
 // NewPyPIHandler creates a new PyPI protocol handler.
@@ -34,7 +35,7 @@ func NewPyPIHandler(proxy *Proxy, proxyURL string) *PyPIHandler {
 	return &PyPIHandler{
 		proxy:       proxy,
 		upstreamURL: pypiUpstream,
-		proxyURL:    strings.TrimSuffix(proxyURL, "/"),
+		linkBase:    linkBase{proxyURL: strings.TrimSuffix(proxyURL, "/")},
 	}
 }
 
@@ -56,10 +57,18 @@ func (h *PyPIHandler) Routes() http.Handler {
 	return mux
 }
 
-// handleSimpleIndex serves the simple API index.
+// simpleIndexCacheKey is the metadata cache key for the root /simple/ page.
+// PyPI names cannot start with an underscore, so it never collides with a
+// package's "<name>/simple" key.
+const simpleIndexCacheKey = "_index/simple"
+
+// handleSimpleIndex serves the simple API index in the format the client
+// negotiated. With metadata caching on, the last good copy is served while
+// upstream is unreachable.
 func (h *PyPIHandler) handleSimpleIndex(w http.ResponseWriter, r *http.Request) {
-	// Just proxy the index through
-	h.proxySimple(w, r, "/simple/")
+	format := negotiateSimpleFormat(r.Header.Get("Accept"))
+	w.Header().Add("Vary", "Accept")
+	h.proxy.ProxyCached(w, r, h.upstreamURL+"/simple/", "pypi", format.cacheKey(simpleIndexCacheKey), format.upstreamAccept())
 }
 
 // handleSimplePackage serves the simple API package page with rewritten links.
@@ -73,30 +82,65 @@ func (h *PyPIHandler) handleSimplePackage(w http.ResponseWriter, r *http.Request
 	h.proxy.Logger.Info("pypi simple request", "package", name)
 
 	upstreamURL := fmt.Sprintf("%s/simple/%s/", h.upstreamURL, name)
-	cacheKey := name + "/simple"
-
-	body, _, err := h.proxy.FetchOrCacheMetadata(r.Context(), "pypi", cacheKey, upstreamURL, "text/html")
+	format := negotiateSimpleFormat(r.Header.Get("Accept"))
+	cacheKey := format.cacheKey(name + "/simple")
+	setMetadataMaxAge(w, h.proxy.MetadataTTLFor("pypi", cacheKey))
+
+	rh := forRequest(h, r)
+	key := metadataFlightKey(upstreamURL, format.upstreamAccept(), rh.proxyURL)
+	rewritten, contentType, err := h.proxy.coalesceMetadata(r.Context(), key, func(ctx context.Context) ([]byte, string, error) {
+		return rh.fetchSimplePage(r.WithContext(ctx), name, upstreamURL, cacheKey, format)
+	})
 	if err != nil {
-		if errors.Is(err, ErrUpstreamNotFound) {
+		switch {
+		case errors.Is(err, ErrUpstreamNotFound):
 			http.Error(w, "not found", http.StatusNotFound)
-			return
+		case errors.Is(err, errInvalidSimplePage):
+			h.proxy.Logger.Error("failed to rewrite simple JSON page", "error", err)
+			http.Error(w, "invalid response from upstream", http.StatusBadGateway)
+		default:
+			h.proxy.Logger.Error("upstream request failed", "error", err)
+			http.Error(w, "upstream request failed", http.StatusBadGateway)
 		}
-		h.proxy.Logger.Error("upstream request failed", "error", err)
-		http.Error(w, "upstream request failed", http.StatusBadGateway)
 		return
 	}
 
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(rewritten)))
+	if h.proxy.CacheMetadata && h.proxy.lookupCachedMeta("pypi", cacheKey).stale {
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rewritten)
+}
+
+// errInvalidSimplePage is returned by fetchSimplePage when upstream sent a
+// JSON page that can't be parsed.
+var errInvalidSimplePage = errors.New("invalid simple page")
+
+// fetchSimplePage fetches a simple API package page in format and rewrites
+// its links for this proxy, dropping versions held back by cooldown.
+func (h *PyPIHandler) fetchSimplePage(r *http.Request, name, upstreamURL, cacheKey string, format simpleFormat) ([]byte, string, error) {
+	body, contentType, err := h.proxy.FetchOrCacheMetadata(r.Context(), "pypi", cacheKey, upstreamURL, format.upstreamAccept())
+	if err != nil {
+		return nil, "", err
+	}
+
 	// When cooldown is enabled, fetch JSON metadata to get version timestamps
 	var filteredVersions map[string]bool
 	if h.proxy.Cooldown != nil && h.proxy.Cooldown.Enabled() {
 		filteredVersions = h.fetchFilteredVersions(r, name)
 	}
 
-	rewritten := h.rewriteSimpleHTML(body, filteredVersions)
-
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(rewritten)
+	if format == simpleJSON && isSimpleJSON(contentType) {
+		rewritten, err := h.rewriteSimpleJSON(body, filteredVersions)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %w", errInvalidSimplePage, err)
+		}
+		return rewritten, pypiSimpleJSONType, nil
+	}
+	return h.rewriteSimpleHTML(body, filteredVersions), "text/html", nil
 }
 
 // fetchFilteredVersions fetches JSON metadata and returns a set of version strings
@@ -172,9 +216,10 @@ func (h *PyPIHandler) rewriteSimpleHTML(body []byte, filteredVersions map[string
 		})
 	}
 
-	// Match href attributes pointing to packages
-	// PyPI URLs look like: https://files.pythonhosted.org/packages/...
-	re := regexp.MustCompile(`href="(https://files\.pythonhosted\.org/packages/[^"]+)"`)
+	// Match absolute href attributes. Package URLs look like
+	// https://files.pythonhosted.org/packages/... and only those on a
+	// trusted host are rewritten.
+	re := regexp.MustCompile(`href="(https?://[^"]+)"`)
 
 	return re.ReplaceAllFunc(body, func(match []byte) []byte {
 		submatch := re.FindSubmatch(match)
@@ -185,7 +230,11 @@ func (h *PyPIHandler) rewriteSimpleHTML(body []byte, filteredVersions map[string
 		origURL := string(submatch[1])
 
 		u, err := url.Parse(origURL)
-		if err != nil {
+		if err != nil || !strings.HasPrefix(u.Path, "/packages/") {
+			return match
+		}
+		if !h.proxy.IsTrustedUpstream("pypi", origURL) {
+			h.proxy.logUntrustedUpstream("pypi", origURL)
 			return match
 		}
 
@@ -226,6 +275,7 @@ func (h *PyPIHandler) handleVersionJSON(w http.ResponseWriter, r *http.Request)
 
 // proxyAndRewriteJSON fetches JSON metadata and rewrites download URLs.
 func (h *PyPIHandler) proxyAndRewriteJSON(w http.ResponseWriter, r *http.Request, upstreamURL, cacheKey string) {
+	setMetadataMaxAge(w, h.proxy.MetadataTTLFor("pypi", cacheKey))
 	body, _, err := h.proxy.FetchOrCacheMetadata(r.Context(), "pypi", cacheKey, upstreamURL)
 	if err != nil {
 		if errors.Is(err, ErrUpstreamNotFound) {
@@ -237,7 +287,7 @@ func (h *PyPIHandler) proxyAndRewriteJSON(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	rewritten, err := h.rewriteJSONMetadata(body)
+	rewritten, err := forRequest(h, r).rewriteJSONMetadata(body)
 	if err != nil {
 		h.proxy.Logger.Warn("failed to rewrite metadata, proxying original", "error", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -246,6 +296,7 @@ func (h *PyPIHandler) proxyAndRewriteJSON(w http.ResponseWriter, r *http.Request
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(rewritten)))
 	_, _ = w.Write(rewritten)
 }
 
@@ -384,11 +435,13 @@ func (h *PyPIHandler) rewriteURLEntry(entry map[string]any) {
 		return
 	}
 
-	// Only rewrite pythonhosted.org URLs
-	if u.Host == "files.pythonhosted.org" {
-		newURL := fmt.Sprintf("%s/pypi/packages%s", h.proxyURL, u.Path)
-		entry["url"] = newURL
+	if !h.proxy.IsTrustedUpstream("pypi", urlStr) {
+		h.proxy.logUntrustedUpstream("pypi", urlStr)
+		return
 	}
+
+	newURL := fmt.Sprintf("%s/pypi/packages%s", h.proxyURL, u.Path)
+	entry["url"] = newURL
 }
 
 // handleDownload serves a package file, fetching and caching from upstream if needed.
@@ -408,6 +461,11 @@ func (h *PyPIHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	filename := parts[len(parts)-1]
+	if wheel, ok := strings.CutSuffix(filename, wheelMetadataSuffix); ok && strings.HasSuffix(wheel, ".whl") {
+		if h.serveCachedWheelMetadata(w, r, wheel) {
+			return
+		}
+	}
 	name, version := h.parseFilename(filename)
 
 	if name == "" {
@@ -424,14 +482,37 @@ func (h *PyPIHandler) handleDownload(w http.ResponseWriter, r *http.Request) {
 	// string
 	upstreamURL := fmt.Sprintf("https://files.pythonhosted.org/%s", path)
 
-	result, err := h.proxy.GetOrFetchArtifactFromURL(r.Context(), "pypi", name, version, filename, upstreamURL)
+	// pip may check a file with HEAD before downloading it. Answer from
+	// the cache or an upstream HEAD rather than caching the whole file.
+	if r.Method == http.MethodHead {
+		result, err := h.proxy.HeadArtifact(r.Context(), "pypi", name, version, filename, upstreamURL)
+		if err != nil {
+			h.writeDownloadError(w, err)
+			return
+		}
+		h.proxy.ServeArtifactHead(w, result)
+		return
+	}
+
+	ctx := r.Context()
+	if !strings.HasSuffix(filename, wheelMetadataSuffix) {
+		ctx = expectBinary(ctx)
+	}
+	result, err := h.proxy.GetOrFetchArtifactFromURL(ctx, "pypi", name, version, filename, upstreamURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get artifact", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		h.writeDownloadError(w, err)
 		return
 	}
 
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
+}
+
+// writeDownloadError answers a download or HEAD request that failed.
+func (h *PyPIHandler) writeDownloadError(w http.ResponseWriter, err error) {
+	if !writeArtifactError(w, err) {
+		h.proxy.Logger.Error("failed to get artifact", "error", err)
+		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+	}
 }
 
 // parseFilename extracts package name and version from a PyPI filename.
@@ -494,32 +575,3 @@ func hashPath(path string) string {
 	h := sha256.Sum256([]byte(path))
 	return hex.EncodeToString(h[:8])
 }
-
-// proxySimple proxies a simple API request.
-func (h *PyPIHandler) proxySimple(w http.ResponseWriter, r *http.Request, path string) {
-	upstreamURL := h.upstreamURL + path
-
-	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstreamURL, nil)
-	if err != nil {
-		http.Error(w, "failed to create request", http.StatusInternalServerError)
-		return
-	}
-	req.Header.Set("Accept", "text/html")
-
-	resp, err := h.proxy.HTTPClient.Do(req)
-	if err != nil {
-		h.proxy.Logger.Error("upstream request failed", "error", err)
-		http.Error(w, "upstream request failed", http.StatusBadGateway)
-		return
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
-	}
-
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
-}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/git-pkgs/archives"
+	"github.com/git-pkgs/purl"
+)
+
+const (
+	// wheelMetadataSuffix is appended to a wheel's URL to fetch just its
+	// METADATA file (PEP 658).
+	wheelMetadataSuffix = ".metadata"
+
+	// maxWheelMetadataScanSize caps the size of a cached wheel that is opened
+	// to serve its METADATA. The archive reader buffers the whole wheel, so
+	// larger wheels fall back to fetching the .metadata file from upstream.
+	maxWheelMetadataScanSize = 256 << 20 // 256 MB
+
+	// maxWheelMetadataSize caps the METADATA file read out of a wheel.
+	maxWheelMetadataSize = 16 << 20 // 16 MB
+)
+
+// serveCachedWheelMetadata answers a PEP 658 request for wheelFilename's
+// METADATA from the cached wheel, so pip can resolve dependencies without
+// a round trip upstream. The file is served byte for byte as it appears in
+// the wheel, which is what the data-dist-info-metadata hash in the simple
+// index covers. Reports whether it wrote a response; when the wheel isn't
+// cached the caller fetches the .metadata file from upstream instead.
+func (h *PyPIHandler) serveCachedWheelMetadata(w http.ResponseWriter, r *http.Request, wheelFilename string) bool {
+	if upstreamOverride(r.Context()) != nil {
+		return false
+	}
+	name, version := h.parseFilename(wheelFilename)
+	if name == "" {
+		return false
+	}
+
+	versionPURL := purl.MakePURLString("pypi", Canonicalize("pypi", name), version)
+	artifact, err := h.proxy.DB.GetArtifact(versionPURL, wheelFilename)
+	if err != nil || artifact == nil || !artifact.IsCached() || artifact.Size.Int64 > maxWheelMetadataScanSize {
+		return false
+	}
+
+	metadata, err := h.proxy.readWheelMetadata(r.Context(), artifact.StoragePath.String, wheelFilename)
+	if err != nil {
+		h.proxy.Logger.Warn("failed to read METADATA from cached wheel, fetching from upstream",
+			"filename", wheelFilename, "error", err)
+		return false
+	}
+
+	h.proxy.Logger.Info("serving wheel metadata from cached wheel",
+		"name", name, "version", version, "filename", wheelFilename)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(metadata)))
+	setImmutableCacheHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(metadata)
+	return true
+}
+
+// readWheelMetadata extracts {name}-{version}.dist-info/METADATA from the
+// wheel stored at storagePath.
+func (p *Proxy) readWheelMetadata(ctx context.Context, storagePath, wheelFilename string) ([]byte, error) {
+	rc, err := p.Storage.Open(ctx, storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening wheel: %w", err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	reader, err := archives.Open(wheelFilename, io.LimitReader(rc, maxWheelMetadataScanSize))
+	if err != nil {
+		return nil, fmt.Errorf("opening wheel archive: %w", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	files, err := reader.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing wheel: %w", err)
+	}
+	var metadataPath string
+	for _, f := range files {
+		dir, base := path.Split(strings.TrimPrefix(f.Path, "/"))
+		if !f.IsDir && base == "METADATA" && strings.Count(dir, "/") == 1 && strings.HasSuffix(dir, ".dist-info/") {
+			metadataPath = f.Path
+			break
+		}
+	}
+	if metadataPath == "" {
+		return nil, fmt.Errorf("no .dist-info/METADATA in %s", wheelFilename)
+	}
+
+	entry, err := reader.Extract(metadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("extracting %s: %w", metadataPath, err)
+	}
+	defer func() { _ = entry.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(entry, maxWheelMetadataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", metadataPath, err)
+	}
+	if len(data) > maxWheelMetadataSize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", metadataPath, maxWheelMetadataSize)
+	}
+	return data, nil
+}
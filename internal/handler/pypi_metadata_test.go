@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const demoWheelMetadata = "Metadata-Version: 2.1\nName: demo-pkg\nVersion: 1.0\nRequires-Dist: requests>=2\n"
+
+func buildWheel(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestPyPIHandler_WheelMetadataFromCachedWheel(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	wheel := buildWheel(t, map[string]string{
+		"demo_pkg/__init__.py":                 "",
+		"demo_pkg-1.0.dist-info/METADATA":      demoWheelMetadata,
+		"demo_pkg-1.0.dist-info/RECORD":        "",
+		"demo_pkg/vendored.dist-info/METADATA": "not the wheel's metadata",
+	})
+	seedPackage(t, db, store, "pypi", "demo-pkg", "1.0", "demo_pkg-1.0-py3-none-any.whl", wheel)
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	req := httptest.NewRequest(http.MethodGet, "/packages/packages/ab/cd/ef/demo_pkg-1.0-py3-none-any.whl.metadata", nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != demoWheelMetadata {
+		t.Errorf("body = %q, want the wheel's METADATA", w.Body.String())
+	}
+	if fetcher.fetchCalled {
+		t.Error("fetched from upstream although the wheel is cached")
+	}
+}
+
+func TestPyPIHandler_WheelMetadataFallsBackToUpstream(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	// A cached wheel without a .dist-info directory can't answer the request.
+	seedPackage(t, db, store, "pypi", "demo-pkg", "1.0", "demo_pkg-1.0-py3-none-any.whl",
+		buildWheel(t, map[string]string{"demo_pkg/__init__.py": ""}))
+	fetcher.fetchErr = errors.New("upstream unavailable")
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	for _, filename := range []string{"demo_pkg-1.0-py3-none-any.whl.metadata", "other-2.0-py3-none-any.whl.metadata"} {
+		fetcher.fetchCalled = false
+		req := httptest.NewRequest(http.MethodGet, "/packages/packages/ab/cd/ef/"+filename, nil)
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, req)
+
+		if !fetcher.fetchCalled {
+			t.Errorf("%s: expected an upstream fetch", filename)
+		}
+		if fetcher.fetchedURL != "https://files.pythonhosted.org/packages/ab/cd/ef/"+filename {
+			t.Errorf("%s: fetched %q", filename, fetcher.fetchedURL)
+		}
+	}
+}
+
+func TestPyPIHandler_SimplePagesKeepMetadataHashes(t *testing.T) {
+	const fileURL = "https://files.pythonhosted.org/packages/ab/cd/ef/demo_pkg-1.0-py3-none-any.whl"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "json") {
+			w.Header().Set("Content-Type", pypiSimpleJSONType)
+			_, _ = w.Write([]byte(`{"meta":{"api-version":"1.1"},"name":"demo-pkg","files":[{"filename":"demo_pkg-1.0-py3-none-any.whl","url":"` +
+				fileURL + `","hashes":{"sha256":"abc"},"core-metadata":{"sha256":"def"},"data-dist-info-metadata":{"sha256":"def"}}]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<a href="` + fileURL + `#sha256=abc" data-dist-info-metadata="sha256=def" data-core-metadata="sha256=def">demo_pkg-1.0-py3-none-any.whl</a>`))
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.HTTPClient = upstream.Client()
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+
+	req := httptest.NewRequest(http.MethodGet, "/simple/demo-pkg/", nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+	html := w.Body.String()
+	if !strings.Contains(html, `href="http://proxy.local/pypi/packages/packages/ab/cd/ef/demo_pkg-1.0-py3-none-any.whl"`) {
+		t.Errorf("file link not rewritten: %s", html)
+	}
+	if !strings.Contains(html, `data-dist-info-metadata="sha256=def"`) || !strings.Contains(html, `data-core-metadata="sha256=def"`) {
+		t.Errorf("metadata hashes dropped: %s", html)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/simple/demo-pkg/", nil)
+	req.Header.Set("Accept", pipAccept)
+	w = httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+	var page struct {
+		Files []map[string]any `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Files) != 1 {
+		t.Fatalf("decoding page: %v: %s", err, w.Body.String())
+	}
+	for _, key := range []string{"core-metadata", "data-dist-info-metadata"} {
+		if hashes, _ := page.Files[0][key].(map[string]any); hashes["sha256"] != "def" {
+			t.Errorf("%s = %v, want upstream hash kept", key, page.Files[0][key])
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// PEP 691 media types for the simple repository API.
+const (
+	pypiSimpleJSONType       = "application/vnd.pypi.simple.v1+json"
+	pypiSimpleHTMLType       = "application/vnd.pypi.simple.v1+html"
+	pypiSimpleLatestJSONType = "application/vnd.pypi.simple.latest+json"
+	pypiSimpleLatestHTMLType = "application/vnd.pypi.simple.latest+html"
+)
+
+// simpleFormat is the representation of a simple API page a client asked
+// for. Each format is fetched and cached separately, and responses carry
+// Vary: Accept so shared caches in front of the proxy keep them apart too.
+type simpleFormat int
+
+const (
+	simpleHTML simpleFormat = iota
+	simpleJSON
+)
+
+// negotiateSimpleFormat picks JSON when the Accept header rates the PEP 691
+// JSON type at least as high as any HTML type, and HTML otherwise. A
+// missing header or a bare wildcard gets HTML, which every installer reads.
+func negotiateSimpleFormat(accept string) simpleFormat {
+	var jsonQ, htmlQ float64
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case pypiSimpleJSONType, pypiSimpleLatestJSONType:
+			jsonQ = max(jsonQ, q)
+		case pypiSimpleHTMLType, pypiSimpleLatestHTMLType, "text/html", "text/*", "*/*":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	if jsonQ > 0 && jsonQ >= htmlQ {
+		return simpleJSON
+	}
+	return simpleHTML
+}
+
+// cacheKey returns the metadata cache key for this format of the page
+// cached as base. HTML keeps the bare key so existing cache entries stay
+// valid.
+func (f simpleFormat) cacheKey(base string) string {
+	if f == simpleJSON {
+		return base + "+json"
+	}
+	return base
+}
+
+// upstreamAccept is the Accept header sent upstream for this format.
+func (f simpleFormat) upstreamAccept() string {
+	if f == simpleJSON {
+		return pypiSimpleJSONType
+	}
+	return "text/html"
+}
+
+// isSimpleJSON reports whether an upstream response is a PEP 691 JSON page.
+// Mirrors that predate PEP 691 answer a JSON request with HTML.
+func isSimpleJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasSuffix(mediaType, "+json")
+}
+
+// rewriteSimpleJSON rewrites file URLs in a PEP 691 project page to point at
+// this proxy. Files for versions in filteredVersions are dropped.
+func (h *PyPIHandler) rewriteSimpleJSON(body []byte, filteredVersions map[string]bool) ([]byte, error) {
+	var page map[string]any
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("parsing simple JSON page: %w", err)
+	}
+
+	files, _ := page["files"].([]any)
+	kept := make([]any, 0, len(files))
+	for _, f := range files {
+		entry, ok := f.(map[string]any)
+		if !ok {
+			continue
+		}
+		if len(filteredVersions) > 0 {
+			filename, _ := entry["filename"].(string)
+			if _, version := h.parseFilename(filename); version != "" && filteredVersions[version] {
+				continue
+			}
+		}
+		h.rewriteURLEntry(entry)
+		kept = append(kept, entry)
+	}
+	if files != nil {
+		page["files"] = kept
+	}
+
+	return json.Marshal(page)
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const pipAccept = "application/vnd.pypi.simple.v1+json, application/vnd.pypi.simple.v1+html; q=0.1, text/html; q=0.01"
+
+func TestNegotiateSimpleFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   simpleFormat
+	}{
+		{"", simpleHTML},
+		{"*/*", simpleHTML},
+		{"text/html", simpleHTML},
+		{pipAccept, simpleJSON},
+		{"application/vnd.pypi.simple.latest+json", simpleJSON},
+		{"application/vnd.pypi.simple.v1+json;q=0.5, text/html", simpleHTML},
+		{"application/vnd.pypi.simple.v1+json;q=0", simpleHTML},
+		{"application/json", simpleHTML},
+	}
+	for _, tt := range tests {
+		if got := negotiateSimpleFormat(tt.accept); got != tt.want {
+			t.Errorf("negotiateSimpleFormat(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// negotiatingPyPIUpstream serves /simple/ and /simple/requests/ as HTML or
+// PEP 691 JSON depending on Accept, and counts requests per format.
+func negotiatingPyPIUpstream(t *testing.T) (*httptest.Server, map[string]int, *sync.Mutex) {
+	t.Helper()
+	hits := map[string]int{}
+	var mu sync.Mutex
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wantJSON := strings.Contains(r.Header.Get("Accept"), pypiSimpleJSONType)
+		mu.Lock()
+		if wantJSON {
+			hits[r.URL.Path+" json"]++
+		} else {
+			hits[r.URL.Path+" html"]++
+		}
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/simple/" && wantJSON:
+			w.Header().Set("Content-Type", pypiSimpleJSONType)
+			_, _ = w.Write([]byte(`{"meta":{"api-version":"1.0"},"projects":[{"name":"requests"}]}`))
+		case r.URL.Path == "/simple/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="/simple/requests/">requests</a>`))
+		case r.URL.Path == "/simple/requests/" && wantJSON:
+			w.Header().Set("Content-Type", pypiSimpleJSONType)
+			_, _ = w.Write([]byte(`{"meta":{"api-version":"1.0"},"name":"requests","files":[` +
+				`{"filename":"requests-2.31.0.tar.gz","url":"https://files.pythonhosted.org/packages/ab/cd/ef/requests-2.31.0.tar.gz","hashes":{"sha256":"abc"}}]}`))
+		case r.URL.Path == "/simple/requests/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="https://files.pythonhosted.org/packages/ab/cd/ef/requests-2.31.0.tar.gz#sha256=abc">requests-2.31.0.tar.gz</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, hits, &mu
+}
+
+func TestPyPIHandler_SimpleFormatsCachedSeparately(t *testing.T) {
+	upstream, hits, mu := negotiatingPyPIUpstream(t)
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.CacheMetadata = true
+	proxy.MetadataTTL = time.Hour
+	proxy.HTTPClient = upstream.Client()
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s (Accept %q): status = %d, want 200", path, accept, w.Code)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("GET %s: Vary = %q, want Accept", path, got)
+		}
+		return w
+	}
+
+	// Alternate formats twice so the second round comes from the cache.
+	for round := range 2 {
+		for _, path := range []string{"/simple/", "/simple/requests/"} {
+			html := get(path, "text/html")
+			if ct := html.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("round %d GET %s HTML client: Content-Type = %q", round, path, ct)
+			}
+			if !strings.Contains(html.Body.String(), "<a ") {
+				t.Errorf("round %d GET %s HTML client got %q", round, path, html.Body.String())
+			}
+
+			js := get(path, pipAccept)
+			if ct := js.Header().Get("Content-Type"); ct != pypiSimpleJSONType {
+				t.Errorf("round %d GET %s JSON client: Content-Type = %q", round, path, ct)
+			}
+			var page map[string]any
+			if err := json.Unmarshal(js.Body.Bytes(), &page); err != nil {
+				t.Errorf("round %d GET %s JSON client got non-JSON %q", round, path, js.Body.String())
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range []string{"/simple/ html", "/simple/ json", "/simple/requests/ html", "/simple/requests/ json"} {
+		if hits[key] != 1 {
+			t.Errorf("upstream %s fetched %d times, want 1 (then cached)", key, hits[key])
+		}
+	}
+}
+
+func TestPyPIHandler_SimpleJSONRewritesFileURLs(t *testing.T) {
+	upstream, _, _ := negotiatingPyPIUpstream(t)
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.HTTPClient = upstream.Client()
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+
+	req := httptest.NewRequest(http.MethodGet, "/simple/requests/", nil)
+	req.Header.Set("Accept", pipAccept)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	var page struct {
+		Files []struct {
+			URL    string            `json:"url"`
+			Hashes map[string]string `json:"hashes"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding page: %v: %s", err, w.Body.String())
+	}
+	if len(page.Files) != 1 {
+		t.Fatalf("files = %+v, want one", page.Files)
+	}
+	if want := "http://proxy.local/pypi/packages/packages/ab/cd/ef/requests-2.31.0.tar.gz"; page.Files[0].URL != want {
+		t.Errorf("url = %q, want %q", page.Files[0].URL, want)
+	}
+	if page.Files[0].Hashes["sha256"] != "abc" {
+		t.Errorf("hashes = %v, want upstream hashes kept", page.Files[0].Hashes)
+	}
+}
+
+func TestPyPIHandler_SimpleRewriteRecomputesContentLength(t *testing.T) {
+	const page = `<a href="https://files.pythonhosted.org/packages/ab/cd/ef/requests-2.31.0.tar.gz#sha256=abc">requests-2.31.0.tar.gz</a>`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		_, _ = w.Write([]byte(page))
+	}))
+	t.Cleanup(upstream.Close)
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.HTTPClient = upstream.Client()
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/simple/requests/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Body.Len() == len(page) {
+		t.Fatalf("body was not rewritten: %s", w.Body.String())
+	}
+
+	got := w.Header().Get("Content-Length")
+	if got == strconv.Itoa(len(page)) {
+		t.Fatalf("Content-Length = %s, the upstream length", got)
+	}
+	if got != "" && got != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Content-Length = %s, want %d or absent", got, w.Body.Len())
+	}
+}
@@ -56,7 +56,7 @@ func TestPyPIRewriteJSONMetadataCooldown(t *testing.T) {
 
 	h := &PyPIHandler{
 		proxy:    proxy,
-		proxyURL: "http://localhost:8080",
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
 	}
 
 	input := `{
@@ -192,3 +192,180 @@ func TestPyPIHandler_DownloadCacheMiss(t *testing.T) {
 		t.Error("expected fetcher to be called on cache miss")
 	}
 }
+
+func TestPyPIHandler_HeadUncached(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	fetcher.headSize = 4096
+	fetcher.headType = "application/octet-stream"
+
+	h := NewPyPIHandler(proxy, "http://localhost")
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	resp, err := http.Head(srv.URL + "/packages/packages/ab/cd/ef0123456789/requests-2.31.0-py3-none-any.whl")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.ContentLength != 4096 {
+		t.Errorf("Content-Length = %d, want 4096", resp.ContentLength)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/octet-stream" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	want := "https://files.pythonhosted.org/packages/ab/cd/ef0123456789/requests-2.31.0-py3-none-any.whl"
+	if fetcher.headURL != want {
+		t.Errorf("upstream HEAD URL = %q, want %q", fetcher.headURL, want)
+	}
+	if fetcher.fetchCalled {
+		t.Error("HEAD should not download the file")
+	}
+	if len(store.files) != 0 {
+		t.Errorf("HEAD stored %d files, want none", len(store.files))
+	}
+	if art, _ := db.GetArtifact("pkg:pypi/requests@2.31.0", "requests-2.31.0-py3-none-any.whl"); art != nil {
+		t.Error("HEAD should not record an artifact")
+	}
+}
+
+func TestPyPIHandler_HeadCached(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	seedPackage(t, db, store, "pypi", "requests", "2.31.0",
+		"requests-2.31.0-py3-none-any.whl", "wheel binary data")
+
+	h := NewPyPIHandler(proxy, "http://localhost")
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	resp, err := http.Head(srv.URL + "/packages/packages/ab/cd/ef0123456789/requests-2.31.0-py3-none-any.whl")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.ContentLength != int64(len("wheel binary data")) {
+		t.Errorf("Content-Length = %d, want %d", resp.ContentLength, len("wheel binary data"))
+	}
+	if resp.Header.Get("ETag") == "" {
+		t.Error("cached HEAD should send an ETag")
+	}
+	if fetcher.headURL != "" || fetcher.fetchCalled {
+		t.Error("cached HEAD should not contact upstream")
+	}
+}
+
+func TestPyPIHandler_HeadNotFound(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+	fetcher.headErr = fetch.ErrNotFound
+
+	h := NewPyPIHandler(proxy, "http://localhost")
+	req := httptest.NewRequest(http.MethodHead, "/packages/packages/ab/cd/ef0123456789/missing-1.0.0.tar.gz", nil)
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// flakyPyPIUpstream answers the first request for each path and fails every
+// request after that, simulating PyPI going down once the cache is warm.
+func flakyPyPIUpstream(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+	served := map[string]bool{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if served[r.URL.Path] {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		served[r.URL.Path] = true
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(page))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestPyPIHandler_SimpleServedFromCacheWhenUpstreamDown(t *testing.T) {
+	const pkgPage = `<a href="https://files.pythonhosted.org/packages/ab/cd/ef/requests-2.31.0.tar.gz#sha256=abc">requests-2.31.0.tar.gz</a>`
+	const indexPage = `<a href="/simple/requests/">requests</a>`
+	upstream := flakyPyPIUpstream(t, map[string]string{
+		"/simple/":          indexPage,
+		"/simple/requests/": pkgPage,
+	})
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.CacheMetadata = true
+	proxy.MetadataTTL = time.Millisecond
+	proxy.HTTPClient = upstream.Client()
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	fresh := map[string]string{}
+	for _, path := range []string{"/simple/", "/simple/requests/"} {
+		w := get(path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s while upstream up: status = %d, want 200", path, w.Code)
+		}
+		if got := w.Header().Get("Warning"); got != "" {
+			t.Errorf("GET %s fresh response has Warning %q", path, got)
+		}
+		fresh[path] = w.Body.String()
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	for _, path := range []string{"/simple/", "/simple/requests/"} {
+		w := get(path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s while upstream down: status = %d, want 200", path, w.Code)
+		}
+		if w.Body.String() != fresh[path] {
+			t.Errorf("GET %s body = %q, want cached %q", path, w.Body.String(), fresh[path])
+		}
+		if got := w.Header().Get("Warning"); got != `110 - "Response is Stale"` {
+			t.Errorf("GET %s Warning = %q, want stale warning", path, got)
+		}
+	}
+
+	if !strings.Contains(fresh["/simple/requests/"], "http://proxy.local/pypi/packages/") {
+		t.Errorf("package page links not rewritten: %s", fresh["/simple/requests/"])
+	}
+}
+
+func TestPyPIHandler_SimpleUpstreamDownWithoutCache(t *testing.T) {
+	upstream := flakyPyPIUpstream(t, nil)
+
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.CacheMetadata = true
+	proxy.HTTPClient = upstream.Client()
+	upstream.Close()
+
+	h := NewPyPIHandler(proxy, "http://proxy.local")
+	h.upstreamURL = upstream.URL
+
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/simple/requests/", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
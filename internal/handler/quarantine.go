@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/git-pkgs/purl"
+)
+
+// ErrVersionQuarantined is returned for a version published upstream more
+// recently than its ecosystem's quarantine period. Handlers answer 403.
+var ErrVersionQuarantined = errors.New("version is quarantined")
+
+const (
+	// publishedCacheTTL is how long a publish time looked up from the
+	// registry is reused for a version the database has no time for.
+	publishedCacheTTL = time.Hour
+	// publishedErrorCacheTTL is how long a failed lookup is reused, so an
+	// enrichment outage costs one lookup per version a minute rather than
+	// one per download.
+	publishedErrorCacheTTL = time.Minute
+	// maxPublishedEntries bounds the publish time cache.
+	maxPublishedEntries = 10000
+)
+
+// Quarantine refuses downloads of versions published upstream within a
+// grace period, giving the ecosystem time to flag malicious releases
+// before they are served. Publish times come from the versions table,
+// falling back to the enrichment service. A version whose publish time
+// can't be found is refused unless FailOpen is set.
+type Quarantine struct {
+	// Default is the quarantine period for ecosystems without an entry in
+	// Ecosystems. Zero disables it.
+	Default time.Duration
+	// Ecosystems overrides Default per ecosystem.
+	Ecosystems map[string]time.Duration
+	// Allow lists canonical package and version PURLs served regardless.
+	// A package PURL covers all of its versions.
+	Allow []string
+	// FailOpen serves versions whose publish time is unknown or couldn't be
+	// looked up. By default they are refused.
+	FailOpen bool
+}
+
+// period returns the quarantine period for ecosystem.
+func (q *Quarantine) period(ecosystem string) time.Duration {
+	if d, ok := q.Ecosystems[ecosystem]; ok {
+		return d
+	}
+	return q.Default
+}
+
+// allowed reports whether the package or this version of it is allowlisted.
+func (q *Quarantine) allowed(pkgPURL, versionPURL string) bool {
+	for _, entry := range q.Allow {
+		if entry == pkgPURL || entry == versionPURL {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantineError explains why a version was refused and when it will be
+// served. A zero publishedAt means the publish time couldn't be found. It
+// matches ErrVersionQuarantined.
+type quarantineError struct {
+	purl        string
+	publishedAt time.Time
+	period      time.Duration
+}
+
+func (e *quarantineError) Error() string {
+	if e.publishedAt.IsZero() {
+		return fmt.Sprintf("the publish time of %s could not be determined, so it is refused under the %s quarantine for new versions",
+			e.purl, e.period)
+	}
+	return fmt.Sprintf("%s was published at %s, within the %s quarantine for new versions; it will be served from %s",
+		e.purl, e.publishedAt.UTC().Format(time.RFC3339), e.period,
+		e.publishedAt.Add(e.period).UTC().Format(time.RFC3339))
+}
+
+func (e *quarantineError) Unwrap() error { return ErrVersionQuarantined }
+
+type publishedEntry struct {
+	at      time.Time
+	err     error
+	expires time.Time
+}
+
+// checkQuarantine returns an error matching ErrVersionQuarantined if the
+// version was published upstream within its ecosystem's quarantine period
+// and isn't allowlisted, or if its publish time can't be found and the
+// quarantine doesn't fail open. name must already be canonical. Refusals
+// are recorded as policy events.
+func (p *Proxy) checkQuarantine(ctx context.Context, ecosystem, name, version string) error {
+	if p.Quarantine == nil || version == "" || isDigestReference(version) {
+		return nil
+	}
+	period := p.Quarantine.period(ecosystem)
+	if period <= 0 {
+		return nil
+	}
+	pkgPURL := purl.MakePURLString(ecosystem, name, "")
+	versionPURL := purl.MakePURLString(ecosystem, name, version)
+	if p.Quarantine.allowed(pkgPURL, versionPURL) {
+		return nil
+	}
+
+	publishedAt, err := p.versionPublishedAt(ctx, ecosystem, name, version, versionPURL)
+	if err != nil {
+		p.Logger.Warn("failed to look up version publish time", "purl", versionPURL, "error", err)
+	}
+	if publishedAt.IsZero() && p.Quarantine.FailOpen {
+		return nil
+	}
+	if !publishedAt.IsZero() && time.Since(publishedAt) >= period {
+		return nil
+	}
+
+	qerr := &quarantineError{purl: versionPURL, publishedAt: publishedAt, period: period}
+	p.recordPolicyEventCtx(ctx, ecosystem, name, version, PolicyDecisionDeny, qerr.Error())
+	return qerr
+}
+
+// versionPublishedAt returns when upstream published a version, or the zero
+// time if that isn't known. The versions table is checked first; otherwise
+// the enrichment service is asked and its answer stored on the version's
+// row, if there is one. Answers, including that the registry has no time
+// for the version, are remembered for publishedCacheTTL; failed lookups
+// for publishedErrorCacheTTL.
+func (p *Proxy) versionPublishedAt(ctx context.Context, ecosystem, name, version, versionPURL string) (time.Time, error) {
+	ver, err := p.DB.GetVersionByPURL(versionPURL)
+	if err != nil {
+		p.Logger.Warn("failed to read version publish time", "purl", versionPURL, "error", err)
+	} else if ver != nil && ver.PublishedAt.Valid {
+		return ver.PublishedAt.Time, nil
+	}
+
+	if entry, ok := p.cachedPublishedAt(versionPURL); ok {
+		return entry.at, entry.err
+	}
+	if p.Enrichment == nil {
+		return time.Time{}, nil
+	}
+
+	info, err := p.Enrichment.EnrichVersion(ctx, ecosystem, name, version)
+	if err != nil {
+		p.rememberPublishedAt(versionPURL, publishedEntry{err: err, expires: time.Now().Add(publishedErrorCacheTTL)})
+		return time.Time{}, err
+	}
+	var publishedAt time.Time
+	if info != nil {
+		publishedAt = info.PublishedAt
+	}
+	if !publishedAt.IsZero() && ver != nil {
+		if err := p.DB.SetVersionPublishedAt(versionPURL, publishedAt); err != nil {
+			p.Logger.Warn("failed to record version publish time", "purl", versionPURL, "error", err)
+		}
+	}
+	p.rememberPublishedAt(versionPURL, publishedEntry{at: publishedAt, expires: time.Now().Add(publishedCacheTTL)})
+	return publishedAt, nil
+}
+
+func (p *Proxy) cachedPublishedAt(versionPURL string) (publishedEntry, bool) {
+	p.publishedMu.Lock()
+	defer p.publishedMu.Unlock()
+	entry, ok := p.published[versionPURL]
+	if !ok {
+		return publishedEntry{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(p.published, versionPURL)
+		return publishedEntry{}, false
+	}
+	return entry, true
+}
+
+func (p *Proxy) rememberPublishedAt(versionPURL string, entry publishedEntry) {
+	p.publishedMu.Lock()
+	defer p.publishedMu.Unlock()
+	if p.published == nil {
+		p.published = make(map[string]publishedEntry)
+	}
+	now := time.Now()
+	if len(p.published) >= maxPublishedEntries {
+		for k, entry := range p.published {
+			if now.After(entry.expires) {
+				delete(p.published, k)
+			}
+		}
+		if len(p.published) >= maxPublishedEntries {
+			return
+		}
+	}
+	p.published[versionPURL] = entry
+}
+
+// writeQuarantinedError answers a download refused by checkQuarantine,
+// explaining when the version will be served.
+func writeQuarantinedError(w http.ResponseWriter, err error) {
+	var qe *quarantineError
+	if errors.As(err, &qe) {
+		http.Error(w, qe.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, ErrVersionQuarantined.Error(), http.StatusForbidden)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/enrichment"
+	"github.com/git-pkgs/registries"
+)
+
+func TestQuarantineRefusesNewlyPublishedVersions(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "left-pad", "1.3.0", "left-pad-1.3.0.tgz", "old release")
+	seedPackage(t, db, store, "npm", "left-pad", "1.4.0", "left-pad-1.4.0.tgz", "new release")
+	seedPackage(t, db, store, "npm", "right-pad", "2.0.0", "right-pad-2.0.0.tgz", "allowed release")
+	for purl, age := range map[string]time.Duration{
+		"pkg:npm/left-pad@1.3.0":  30 * 24 * time.Hour,
+		"pkg:npm/left-pad@1.4.0":  time.Hour,
+		"pkg:npm/right-pad@2.0.0": time.Hour,
+	} {
+		if err := db.SetVersionPublishedAt(purl, time.Now().Add(-age)); err != nil {
+			t.Fatalf("SetVersionPublishedAt(%s): %v", purl, err)
+		}
+	}
+	proxy.Quarantine = &Quarantine{
+		Ecosystems: map[string]time.Duration{"npm": 48 * time.Hour},
+		Allow:      []string{"pkg:npm/right-pad"},
+	}
+	h := ClientIPMiddleware(NewNPMHandler(proxy, "http://proxy.local").Routes())
+
+	get := func(method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := get(http.MethodGet, "/left-pad/-/left-pad-1.4.0.tgz")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("new version status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "pkg:npm/left-pad@1.4.0") || !strings.Contains(body, "48h0m0s quarantine") {
+		t.Errorf("new version body = %q, want an explanation naming the version and period", body)
+	}
+	if w := get(http.MethodHead, "/left-pad/-/left-pad-1.4.0.tgz"); w.Code != http.StatusForbidden {
+		t.Errorf("HEAD on new version status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = get(http.MethodGet, "/left-pad/-/left-pad-1.3.0.tgz")
+	if w.Code != http.StatusOK || w.Body.String() != "old release" {
+		t.Errorf("old version = %d %q, want 200 with the cached tarball", w.Code, w.Body.String())
+	}
+	w = get(http.MethodGet, "/right-pad/-/right-pad-2.0.0.tgz")
+	if w.Code != http.StatusOK || w.Body.String() != "allowed release" {
+		t.Errorf("allowlisted version = %d %q, want 200 with the cached tarball", w.Code, w.Body.String())
+	}
+
+	events, err := db.ListPolicyEvents("npm", 10, 0)
+	if err != nil {
+		t.Fatalf("ListPolicyEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].Name != "left-pad" || events[0].Version != "1.4.0" {
+		t.Errorf("policy events = %+v, want the two refusals of left-pad 1.4.0", events)
+	}
+	for _, e := range events {
+		if e.ClientIP != "192.0.2.1" {
+			t.Errorf("policy event client IP = %q, want the requester's address", e.ClientIP)
+		}
+	}
+}
+
+func TestQuarantineUnknownPublishTime(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "left-pad", "1.4.0", "left-pad-1.4.0.tgz", "release")
+	proxy.Quarantine = &Quarantine{Default: 48 * time.Hour}
+	h := NewNPMHandler(proxy, "http://proxy.local").Routes()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/left-pad/-/left-pad-1.4.0.tgz", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d when the publish time is unknown", w.Code, http.StatusForbidden)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "could not be determined") {
+		t.Errorf("body = %q, want it to say the publish time is unknown", body)
+	}
+
+	proxy.Quarantine.FailOpen = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/left-pad/-/left-pad-1.4.0.tgz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d with fail_open", w.Code, http.StatusOK)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestQuarantineCachesFailedLookups(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "left-pad", "1.4.0", "left-pad-1.4.0.tgz", "release")
+	proxy.Quarantine = &Quarantine{Default: 48 * time.Hour}
+
+	var lookups atomic.Int32
+	regClient := registries.NewClient(registries.WithMaxRetries(0))
+	regClient.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		lookups.Add(1)
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("unavailable")),
+			Request:    r,
+		}, nil
+	})}
+	proxy.Enrichment = enrichment.New(proxy.Logger, enrichment.WithRegistryClient(regClient))
+	h := NewNPMHandler(proxy, "http://proxy.local").Routes()
+
+	for i := range 3 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/left-pad/-/left-pad-1.4.0.tgz", nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("request %d: status = %d, want %d while the lookup fails", i, w.Code, http.StatusForbidden)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("registry was asked %d times, want the failed lookup reused", n)
+	}
+}
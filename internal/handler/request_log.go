@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Cache statuses reported in RequestLogFields.
+const (
+	// CacheStatusHit means the artifact was served from the cache.
+	CacheStatusHit = "hit"
+	// CacheStatusMiss means the artifact was fetched from upstream.
+	CacheStatusMiss = "miss"
+	// CacheStatusBypass means the artifact was passed through without
+	// touching the cache, as for index-only ecosystems or an upstream
+	// override.
+	CacheStatusBypass = "bypass"
+)
+
+// RequestLogFields collects the cache-relevant attributes of one request for
+// the request log, so log-based analytics don't have to parse paths. The
+// package fields come from the route; the cache status is recorded by the
+// proxy when an artifact is served.
+type RequestLogFields struct {
+	Ecosystem string
+	Name      string
+	Version   string
+
+	mu    sync.Mutex
+	cache string
+}
+
+type requestLogFieldsKey struct{}
+
+// NewRequestLogFields returns fields for a request to path, with the
+// package parsed from the route, and a context that records the cache
+// status of the artifact served while handling it.
+func NewRequestLogFields(ctx context.Context, path string) (context.Context, *RequestLogFields) {
+	f := &RequestLogFields{}
+	f.Ecosystem, f.Name, f.Version = ParseRequestPackage(path)
+	return context.WithValue(ctx, requestLogFieldsKey{}, f), f
+}
+
+// CacheStatus returns the recorded cache status, or "" when the request
+// served no artifact.
+func (f *RequestLogFields) CacheStatus() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cache
+}
+
+// noteCacheStatus records status for the request behind ctx. Only the first
+// artifact is recorded, so the artifact a client asked for wins over any
+// fetched alongside it.
+func noteCacheStatus(ctx context.Context, status string) {
+	f, ok := ctx.Value(requestLogFieldsKey{}).(*RequestLogFields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	if f.cache == "" {
+		f.cache = status
+	}
+	f.mu.Unlock()
+}
+
+// requestPackageParsers extract the package name and, where the route has
+// one, the version from a request path below an ecosystem's mount point.
+var requestPackageParsers = map[string]func(rest string) (name, version string){
+	"npm":      parseNPMRequestPackage,
+	"cargo":    parseCargoRequestPackage,
+	"go":       parseGoRequestPackage,
+	"pypi":     parsePyPIRequestPackage,
+	"gem":      parseGemRequestPackage,
+	"hex":      parseHexRequestPackage,
+	"nuget":    parseNuGetRequestPackage,
+	"composer": parseComposerRequestPackage,
+}
+
+// ParseRequestPackage returns the ecosystem, package name and version a
+// request path refers to, e.g. "npm", "lodash", "4.17.21" for
+// /npm/lodash/-/lodash-4.17.21.tgz. Parts the route doesn't carry are
+// empty; ecosystems without a parser only report the ecosystem, and paths
+// outside the protocol handlers report nothing.
+func ParseRequestPackage(path string) (ecosystem, name, version string) {
+	mount, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	ecosystem, ok := mountEcosystems[mount]
+	if !ok {
+		return "", "", ""
+	}
+	if parse, ok := requestPackageParsers[mount]; ok && rest != "" {
+		name, version = parse(rest)
+	}
+	return ecosystem, name, version
+}
+
+// mountEcosystems maps the path prefixes protocol handlers are mounted at
+// to the ecosystem their artifacts are recorded under.
+var mountEcosystems = map[string]string{
+	"npm": "npm", "cargo": "cargo", "gem": "gem", "go": "golang",
+	"hex": "hex", "pub": "pub", "pypi": "pypi", "maven": "maven",
+	"gradle": "gradle", "nuget": "nuget", "composer": "composer",
+	"conan": "conan", "conda": "conda", "cran": "cran", "julia": "julia",
+	"v2": "oci", "debian": "deb", "rpm": "rpm",
+}
+
+// /npm/{name} or /npm/{name}/-/{filename}, with scoped names either
+// escaped (@scope%2fname) or not.
+func parseNPMRequestPackage(rest string) (name, version string) {
+	h := &NPMHandler{}
+	if strings.Contains(rest, "/-/") {
+		name, filename := h.parseDownloadPath(rest)
+		return name, h.extractVersionFromFilename(name, filename)
+	}
+	if decoded, err := url.PathUnescape(rest); err == nil {
+		rest = decoded
+	}
+	if strings.HasPrefix(rest, "-/") {
+		return "", ""
+	}
+	return rest, ""
+}
+
+// /cargo/crates/{name}/{version}/download and the sparse index files,
+// which end in the crate name.
+func parseCargoRequestPackage(rest string) (name, version string) {
+	rest = strings.TrimPrefix(rest, "api/v1/")
+	parts := strings.Split(rest, "/")
+	if len(parts) == 4 && parts[0] == "crates" && parts[3] == "download" {
+		return parts[1], parts[2]
+	}
+	if rest == "config.json" {
+		return "", ""
+	}
+	return parts[len(parts)-1], ""
+}
+
+// /go/{module}/@v/{version}.{info,mod,zip}, /go/{module}/@v/list and
+// /go/{module}/@latest.
+func parseGoRequestPackage(rest string) (name, version string) {
+	if strings.HasPrefix(rest, "sumdb/") {
+		return "", ""
+	}
+	module, file, ok := strings.Cut(rest, "/@v/")
+	if !ok {
+		module, _, ok = strings.Cut(rest, "/@latest")
+		if !ok {
+			return "", ""
+		}
+		return decodeGoModulePath(module), ""
+	}
+	if file != "list" {
+		if dot := strings.LastIndex(file, "."); dot > 0 {
+			version = file[:dot]
+		}
+	}
+	return decodeGoModulePath(module), version
+}
+
+// decodeGoModulePath undoes the module proxy's case encoding, where an
+// upper-case letter is sent as "!" and its lower-case form.
+func decodeGoModulePath(escaped string) string {
+	if !strings.Contains(escaped, "!") {
+		return escaped
+	}
+	var b strings.Builder
+	upper := false
+	for _, r := range escaped {
+		switch {
+		case r == '!':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// /pypi/simple/{name}/, /pypi/pypi/{name}[/{version}]/json and
+// /pypi/packages/.../{filename}.
+func parsePyPIRequestPackage(rest string) (name, version string) {
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	switch {
+	case parts[0] == "simple" && len(parts) == 2:
+		return parts[1], ""
+	case parts[0] == "pypi" && len(parts) == 3:
+		return parts[1], ""
+	case parts[0] == "pypi" && len(parts) == 4:
+		return parts[1], parts[2]
+	case parts[0] == "packages" && len(parts) > 1:
+		return (&PyPIHandler{}).parseFilename(parts[len(parts)-1])
+	}
+	return "", ""
+}
+
+// /gem/gems/{name}-{version}.gem and /gem/info/{name}.
+func parseGemRequestPackage(rest string) (name, version string) {
+	dir, file, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", ""
+	}
+	switch dir {
+	case "gems":
+		return (&GemHandler{}).parseGemFilename(file)
+	case "info":
+		return file, ""
+	}
+	return "", ""
+}
+
+// /hex/tarballs/{name}-{version}.tar and /hex/packages/{name}.
+func parseHexRequestPackage(rest string) (name, version string) {
+	dir, file, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", ""
+	}
+	switch dir {
+	case "tarballs":
+		return (&HexHandler{}).parseTarballFilename(file)
+	case "packages":
+		return file, ""
+	}
+	return "", ""
+}
+
+// /nuget/v3-flatcontainer/{id}/{version}/{filename} and
+// /nuget/v3-flatcontainer/{id}/index.json.
+func parseNuGetRequestPackage(rest string) (name, version string) {
+	parts := strings.Split(rest, "/")
+	if len(parts) < 3 || parts[0] != "v3-flatcontainer" {
+		return "", ""
+	}
+	if len(parts) == 4 {
+		return parts[1], parts[2]
+	}
+	return parts[1], ""
+}
+
+// /composer/files/{vendor}/{package}/{version}/{filename} and
+// /composer/p2/{vendor}/{package}.json.
+func parseComposerRequestPackage(rest string) (name, version string) {
+	parts := strings.Split(rest, "/")
+	switch {
+	case parts[0] == "files" && len(parts) == 5:
+		return parts[1] + "/" + parts[2], parts[3]
+	case parts[0] == "p2" && len(parts) == 3:
+		pkg := strings.TrimSuffix(strings.TrimSuffix(parts[2], ".json"), "~dev")
+		return parts[1] + "/" + pkg, ""
+	}
+	return "", ""
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestParseRequestPackage(t *testing.T) {
+	tests := []struct {
+		path                     string
+		ecosystem, name, version string
+	}{
+		{"/npm/lodash/-/lodash-4.17.21.tgz", "npm", "lodash", "4.17.21"},
+		{"/npm/lodash", "npm", "lodash", ""},
+		{"/npm/@babel%2fcore", "npm", "@babel/core", ""},
+		{"/npm/@babel/core/-/core-7.23.0.tgz", "npm", "@babel/core", "7.23.0"},
+		{"/cargo/crates/serde/1.0.200/download", "cargo", "serde", "1.0.200"},
+		{"/cargo/se/rd/serde", "cargo", "serde", ""},
+		{"/go/github.com/!burnt!sushi/toml/@v/v1.3.2.zip", "golang", "github.com/BurntSushi/toml", "v1.3.2"},
+		{"/go/golang.org/x/text/@v/list", "golang", "golang.org/x/text", ""},
+		{"/pypi/simple/requests/", "pypi", "requests", ""},
+		{"/pypi/pypi/requests/2.31.0/json", "pypi", "requests", "2.31.0"},
+		{"/gem/gems/rails-7.1.0.gem", "gem", "rails", "7.1.0"},
+		{"/hex/tarballs/phoenix-1.7.10.tar", "hex", "phoenix", "1.7.10"},
+		{"/nuget/v3-flatcontainer/newtonsoft.json/13.0.3/newtonsoft.json.13.0.3.nupkg", "nuget", "newtonsoft.json", "13.0.3"},
+		{"/composer/files/monolog/monolog/3.5.0/monolog-3.5.0.zip", "composer", "monolog/monolog", "3.5.0"},
+		{"/composer/p2/monolog/monolog.json", "composer", "monolog/monolog", ""},
+		{"/v2/library/alpine/manifests/latest", "oci", "", ""},
+		{"/api/packages", "", "", ""},
+		{"/health", "", "", ""},
+	}
+	for _, tt := range tests {
+		ecosystem, name, version := ParseRequestPackage(tt.path)
+		if ecosystem != tt.ecosystem || name != tt.name || version != tt.version {
+			t.Errorf("ParseRequestPackage(%q) = %q, %q, %q; want %q, %q, %q",
+				tt.path, ecosystem, name, version, tt.ecosystem, tt.name, tt.version)
+		}
+	}
+}
+
+func TestRequestLogFieldsCacheStatus(t *testing.T) {
+	proxy, _, _, fetcher := setupTestProxy(t)
+
+	fetch1 := func() *RequestLogFields {
+		t.Helper()
+		fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("\x1f\x8btarball"))}
+		ctx, fields := NewRequestLogFields(t.Context(), "/npm/lodash/-/lodash-4.17.21.tgz")
+		result, err := proxy.GetOrFetchArtifact(ctx, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz")
+		if err != nil {
+			t.Fatalf("GetOrFetchArtifact: %v", err)
+		}
+		_ = result.Reader.Close()
+		return fields
+	}
+
+	if got := fetch1().CacheStatus(); got != CacheStatusMiss {
+		t.Errorf("first fetch cache status = %q, want %q", got, CacheStatusMiss)
+	}
+	if got := fetch1().CacheStatus(); got != CacheStatusHit {
+		t.Errorf("second fetch cache status = %q, want %q", got, CacheStatusHit)
+	}
+}
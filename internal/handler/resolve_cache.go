@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// defaultResolveCacheTTL is how long a resolved download URL is reused when
+// Proxy.ResolveCacheTTL is not set by the server.
+const defaultResolveCacheTTL = time.Hour
+
+// maxResolveEntries bounds the resolver cache so a burst of misses across
+// many packages can't grow it without limit.
+const maxResolveEntries = 10000
+
+type resolvedEntry struct {
+	info    fetch.ArtifactInfo
+	expires time.Time
+}
+
+// resolve turns ecosystem, name and version into a download URL. A
+// version's URL doesn't change once published, so successful results are
+// reused for ResolveCacheTTL instead of asking the registry again, which
+// for some ecosystems means a metadata round-trip on every cache miss.
+// Errors are not cached; upstream 404s go through the not-found cache.
+func (p *Proxy) resolve(ctx context.Context, ecosystem, name, version string) (*fetch.ArtifactInfo, error) {
+	key := purl.MakePURLString(ecosystem, name, version)
+	if info, ok := p.cachedResolution(key); ok {
+		return info, nil
+	}
+
+	info, err := p.Resolver.Resolve(ctx, ecosystem, name, version)
+	if err != nil {
+		return nil, err
+	}
+	p.rememberResolution(key, info)
+	return info, nil
+}
+
+func (p *Proxy) cachedResolution(key string) (*fetch.ArtifactInfo, bool) {
+	if p.ResolveCacheTTL <= 0 {
+		return nil, false
+	}
+	p.resolvedMu.Lock()
+	defer p.resolvedMu.Unlock()
+	entry, ok := p.resolved[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(p.resolved, key)
+		return nil, false
+	}
+	info := entry.info
+	return &info, true
+}
+
+func (p *Proxy) rememberResolution(key string, info *fetch.ArtifactInfo) {
+	if p.ResolveCacheTTL <= 0 || info == nil {
+		return
+	}
+	p.resolvedMu.Lock()
+	defer p.resolvedMu.Unlock()
+	if p.resolved == nil {
+		p.resolved = make(map[string]resolvedEntry)
+	}
+	now := time.Now()
+	if len(p.resolved) >= maxResolveEntries {
+		for k, entry := range p.resolved {
+			if now.After(entry.expires) {
+				delete(p.resolved, k)
+			}
+		}
+		if len(p.resolved) >= maxResolveEntries {
+			return
+		}
+	}
+	p.resolved[key] = resolvedEntry{info: *info, expires: now.Add(p.ResolveCacheTTL)}
+}
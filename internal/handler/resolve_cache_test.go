@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/registries"
+	"github.com/git-pkgs/registries/client"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// countingRegistry resolves download URLs from version metadata, the way
+// registries without a URL template do, and counts the lookups.
+type countingRegistry struct {
+	calls int
+	err   error
+}
+
+func (r *countingRegistry) Ecosystem() string { return "pypi" }
+
+func (r *countingRegistry) URLs() client.URLBuilder { return &client.BaseURLs{} }
+
+func (r *countingRegistry) FetchVersions(_ context.Context, _ string) ([]registries.Version, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []registries.Version{{
+		Number:   "2.31.0",
+		Metadata: map[string]any{"download_url": "https://files.pythonhosted.org/packages/ab/cd/requests-2.31.0.tar.gz"},
+	}}, nil
+}
+
+func TestResolve_ServedFromCache(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	reg := &countingRegistry{}
+	proxy.Resolver.RegisterRegistry(reg)
+
+	for i := range 2 {
+		info, err := proxy.resolve(context.Background(), "pypi", "requests", "2.31.0")
+		if err != nil {
+			t.Fatalf("resolve %d: %v", i+1, err)
+		}
+		if info.Filename != "requests-2.31.0.tar.gz" {
+			t.Errorf("resolve %d: filename = %q", i+1, info.Filename)
+		}
+	}
+	if reg.calls != 1 {
+		t.Errorf("registry consulted %d times, want 1", reg.calls)
+	}
+
+	if _, err := proxy.resolve(context.Background(), "pypi", "requests", "2.32.0"); !errors.Is(err, fetch.ErrNotFound) {
+		t.Errorf("other version: err = %v, want ErrNotFound", err)
+	}
+	if reg.calls != 2 {
+		t.Errorf("a different version should be resolved separately, got %d calls", reg.calls)
+	}
+}
+
+func TestResolve_ErrorsNotCached(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	reg := &countingRegistry{err: errors.New("registry unavailable")}
+	proxy.Resolver.RegisterRegistry(reg)
+
+	for range 2 {
+		if _, err := proxy.resolve(context.Background(), "pypi", "requests", "2.31.0"); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if reg.calls != 2 {
+		t.Errorf("registry consulted %d times, want 2", reg.calls)
+	}
+}
+
+func TestResolve_CacheExpiresAndCanBeDisabled(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	reg := &countingRegistry{}
+	proxy.Resolver.RegisterRegistry(reg)
+
+	proxy.ResolveCacheTTL = time.Millisecond
+	_, _ = proxy.resolve(context.Background(), "pypi", "requests", "2.31.0")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = proxy.resolve(context.Background(), "pypi", "requests", "2.31.0")
+	if reg.calls != 2 {
+		t.Errorf("registry consulted %d times, want 2 after the entry expired", reg.calls)
+	}
+
+	proxy.ResolveCacheTTL = 0
+	_, _ = proxy.resolve(context.Background(), "pypi", "requests", "2.31.0")
+	_, _ = proxy.resolve(context.Background(), "pypi", "requests", "2.31.0")
+	if reg.calls != 4 {
+		t.Errorf("registry consulted %d times, want 4 with the cache disabled", reg.calls)
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// forwardedResponseHeaders are the upstream response headers passed through
+// to clients when a request is forwarded as-is. They describe the body and
+// how it may be cached. Everything else, notably Set-Cookie and upstream
+// tracking or debugging headers, is dropped: cookies from a registry would
+// otherwise be set on the proxy's own origin and make responses uncacheable
+// for shared caches.
+var forwardedResponseHeaders = []string{
+	"Accept-Ranges",
+	"Age",
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Link",
+	"Location",
+	"Retry-After",
+	"Vary",
+	"WWW-Authenticate",
+}
+
+// defaultForwardedHeaders is forwardedResponseHeaders as a set.
+var defaultForwardedHeaders = headerSet(forwardedResponseHeaders, nil)
+
+// SetForwardedResponseHeaders adds names to the upstream response headers
+// passed through to clients. It must be called before handlers serve
+// traffic.
+func (p *Proxy) SetForwardedResponseHeaders(names []string) {
+	p.forwardedHeaders = headerSet(forwardedResponseHeaders, names)
+}
+
+func headerSet(base, extra []string) map[string]bool {
+	set := make(map[string]bool, len(base)+len(extra))
+	for _, names := range [][]string{base, extra} {
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				set[http.CanonicalHeaderKey(name)] = true
+			}
+		}
+	}
+	return set
+}
+
+// copyUpstreamHeaders copies the forwarded subset of an upstream response's
+// headers to dst, leaving out any named in skip.
+func (p *Proxy) copyUpstreamHeaders(dst, src http.Header, skip ...string) {
+	allowed := p.forwardedHeaders
+	if allowed == nil {
+		allowed = defaultForwardedHeaders
+	}
+	for key, values := range src {
+		if !allowed[key] || containsHeader(skip, key) {
+			continue
+		}
+		for _, v := range values {
+			dst.Add(key, v)
+		}
+	}
+}
+
+func containsHeader(names []string, key string) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
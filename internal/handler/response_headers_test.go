@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyUpstreamForwardsOnlyAllowlistedHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("X-Served-By", "cache-1")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	proxy, _, _, _ := setupTestProxy(t)
+
+	w := httptest.NewRecorder()
+	proxy.ProxyUpstream(w, httptest.NewRequest(http.MethodGet, "/x", nil), upstream.URL, nil)
+
+	if got := w.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+	if got := w.Header().Get("ETag"); got != `"abc"` {
+		t.Errorf("ETag = %q, want \"abc\"", got)
+	}
+	for _, h := range []string{"Set-Cookie", "X-Request-Id", "X-Served-By"} {
+		if got := w.Header().Get(h); got != "" {
+			t.Errorf("%s forwarded as %q, want dropped", h, got)
+		}
+	}
+
+	proxy.SetForwardedResponseHeaders([]string{"x-request-id"})
+	w = httptest.NewRecorder()
+	proxy.ProxyFile(w, httptest.NewRequest(http.MethodGet, "/x", nil), upstream.URL)
+
+	if got := w.Header().Get("X-Request-Id"); got != "req-1" {
+		t.Errorf("X-Request-Id = %q, want req-1 once configured", got)
+	}
+	if got := w.Header().Get("Set-Cookie"); got != "" {
+		t.Errorf("Set-Cookie forwarded as %q, want dropped", got)
+	}
+}
+
+func TestCopyUpstreamHeadersSkip(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	src := http.Header{}
+	src.Set("Content-Type", "application/json")
+	src.Set("Content-Length", "42")
+
+	dst := http.Header{}
+	proxy.copyUpstreamHeaders(dst, src, "content-length")
+
+	if dst.Get("Content-Length") != "" {
+		t.Error("skipped Content-Length was copied")
+	}
+	if dst.Get("Content-Type") != "application/json" {
+		t.Error("Content-Type was not copied")
+	}
+}
@@ -83,13 +83,15 @@ func (h *RPMHandler) handlePackageDownload(w http.ResponseWriter, r *http.Reques
 	result, err := h.proxy.GetOrFetchArtifactFromURL(
 		r.Context(), "rpm", name, version, filename, downloadURL)
 	if err != nil {
-		h.proxy.Logger.Error("failed to get rpm package", "error", err)
-		http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		if !writeArtifactError(w, err) {
+			h.proxy.Logger.Error("failed to get rpm package", "error", err)
+			http.Error(w, "failed to fetch package", http.StatusBadGateway)
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/x-rpm")
-	ServeArtifact(w, result)
+	h.proxy.ServeArtifact(w, result)
 }
 
 // handleMetadata proxies repository metadata files (repomd.xml, primary.xml.gz, etc.).
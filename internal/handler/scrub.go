@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+	"github.com/git-pkgs/proxy/internal/storage"
+)
+
+// Scrub results, as counted by metrics.RecordScrubResult.
+const (
+	scrubOK      = "ok"
+	scrubCorrupt = "corrupt"
+	scrubMissing = "missing"
+	scrubError   = "error"
+)
+
+// ScrubResult summarises one integrity scrub pass.
+type ScrubResult struct {
+	Checked int
+	Corrupt int
+	Missing int
+	Errors  int
+}
+
+// ScrubArtifacts re-reads up to n randomly chosen cached artifacts and
+// checks them against their recorded content hash and upstream integrity,
+// the same way a cache hit is verified. Corrupt artifacts, and those whose
+// blob has gone from storage, have their cache entry cleared so the next
+// request fetches a fresh copy. This catches bit rot in artifacts that are
+// rarely downloaded, which the read path would otherwise only notice when
+// a client next asks for them.
+func (p *Proxy) ScrubArtifacts(ctx context.Context, n int) (ScrubResult, error) {
+	var result ScrubResult
+	if n <= 0 {
+		return result, nil
+	}
+
+	artifacts, err := p.DB.SampleCachedArtifacts(n)
+	if err != nil {
+		return result, fmt.Errorf("sampling artifacts: %w", err)
+	}
+
+	for _, art := range artifacts {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		result.Checked++
+
+		status := p.scrubArtifact(ctx, art.VersionPURL, art.Filename, art.Ecosystem,
+			art.StoragePath, art.ContentHash.String, art.Integrity.String)
+		switch status {
+		case scrubCorrupt:
+			result.Corrupt++
+		case scrubMissing:
+			result.Missing++
+		case scrubError:
+			result.Errors++
+		}
+		metrics.RecordScrubResult(status)
+	}
+	return result, nil
+}
+
+func (p *Proxy) scrubArtifact(ctx context.Context, versionPURL, filename, ecosystem, path, contentHash, sri string) string {
+	reader, err := p.Storage.Open(ctx, path)
+	if errors.Is(err, storage.ErrNotFound) {
+		p.Logger.Warn("scrub: cached artifact missing from storage",
+			"purl", versionPURL, "filename", filename, "path", path)
+		if err := p.DB.ClearArtifactCache(versionPURL, filename); err != nil {
+			p.Logger.Warn("scrub: failed to clear missing artifact from cache", "error", err)
+			return scrubError
+		}
+		return scrubMissing
+	}
+	if err != nil {
+		p.Logger.Warn("scrub: failed to open cached artifact", "path", path, "error", err)
+		return scrubError
+	}
+
+	corrupt := false
+	verified := newVerifyingReader(reader, contentHash, sri, func(reason string) {
+		corrupt = true
+		p.Logger.Error("cached artifact failed integrity check",
+			"purl", versionPURL, "filename", filename,
+			"path", path, "reason", reason, "source", "scrub")
+		metrics.RecordIntegrityFailure(ecosystem)
+	})
+	_, copyErr := io.Copy(io.Discard, verified)
+	_ = verified.Close()
+	if copyErr != nil {
+		p.Logger.Warn("scrub: failed to read cached artifact", "path", path, "error", copyErr)
+		return scrubError
+	}
+
+	if !corrupt {
+		return scrubOK
+	}
+	if err := p.DB.ClearArtifactCache(versionPURL, filename); err != nil {
+		p.Logger.Warn("failed to clear corrupt artifact from cache", "error", err)
+	}
+	return scrubCorrupt
+}
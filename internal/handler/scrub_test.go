@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/storage"
+)
+
+func TestScrubArtifactsClearsCorrupt(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+
+	seedPackage(t, db, store, "npm", "good", "1.0.0", "good-1.0.0.tgz", "good tarball")
+	seedPackage(t, db, store, "npm", "bad", "1.0.0", "bad-1.0.0.tgz", "bad tarball")
+	for _, a := range []struct{ purl, filename, content string }{
+		{"pkg:npm/good@1.0.0", "good-1.0.0.tgz", "good tarball"},
+		{"pkg:npm/bad@1.0.0", "bad-1.0.0.tgz", "bad tarball"},
+	} {
+		art, err := db.GetArtifact(a.purl, a.filename)
+		if err != nil {
+			t.Fatalf("GetArtifact: %v", err)
+		}
+		art.ContentHash.String = sha256Hex(a.content)
+		if err := db.UpsertArtifact(art); err != nil {
+			t.Fatalf("UpsertArtifact: %v", err)
+		}
+	}
+
+	// Flip the bad artifact's bytes on disk after its hash was recorded.
+	store.files[storage.ArtifactPath("npm", "", "bad", "1.0.0", "bad-1.0.0.tgz")] = []byte("bit rotted")
+
+	result, err := proxy.ScrubArtifacts(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("ScrubArtifacts: %v", err)
+	}
+	if result.Checked != 2 || result.Corrupt != 1 || result.Missing != 0 || result.Errors != 0 {
+		t.Errorf("result = %+v, want 2 checked, 1 corrupt", result)
+	}
+
+	bad, err := db.GetArtifact("pkg:npm/bad@1.0.0", "bad-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if bad.StoragePath.Valid {
+		t.Error("corrupt artifact should have its cache entry cleared")
+	}
+	good, err := db.GetArtifact("pkg:npm/good@1.0.0", "good-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if !good.StoragePath.Valid {
+		t.Error("intact artifact should stay cached")
+	}
+}
+
+func TestScrubArtifactsClearsMissing(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+
+	seedPackage(t, db, store, "npm", "gone", "1.0.0", "gone-1.0.0.tgz", "tarball")
+	delete(store.files, storage.ArtifactPath("npm", "", "gone", "1.0.0", "gone-1.0.0.tgz"))
+
+	result, err := proxy.ScrubArtifacts(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("ScrubArtifacts: %v", err)
+	}
+	if result.Checked != 1 || result.Missing != 1 {
+		t.Errorf("result = %+v, want 1 checked, 1 missing", result)
+	}
+
+	art, err := db.GetArtifact("pkg:npm/gone@1.0.0", "gone-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if art.StoragePath.Valid {
+		t.Error("artifact with missing blob should have its cache entry cleared")
+	}
+}
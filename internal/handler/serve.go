@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+)
+
+// defaultServeBufferSize is used when Proxy.ServeBufferSize is unset. It
+// matches the buffer io.Copy allocates on its own.
+const defaultServeBufferSize = 32 << 10
+
+// serveBufferPools holds one *sync.Pool of []byte per configured buffer size
+// so large buffers are reused across requests instead of allocated per copy.
+var serveBufferPools sync.Map
+
+func serveBufferPool(size int) *sync.Pool {
+	if pool, ok := serveBufferPools.Load(size); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := serveBufferPools.LoadOrStore(size, &sync.Pool{
+		New: func() any {
+			buf := make([]byte, size)
+			return &buf
+		},
+	})
+	return pool.(*sync.Pool)
+}
+
+// writerOnly hides any ReadFrom method on the wrapped writer so io.CopyBuffer
+// uses the buffer it is given.
+type writerOnly struct {
+	io.Writer
+}
+
+// copyArtifact streams an artifact body to w. Bodies backed by a plain file
+// are handed to the writer's ReadFrom, which lets net/http use sendfile.
+// Everything else goes through a pooled buffer of ServeBufferSize bytes.
+// It returns the number of bytes written.
+func (p *Proxy) copyArtifact(w io.Writer, r io.Reader) int64 {
+	var (
+		n    int64
+		err  error
+		mode string
+	)
+	if f, ok := fileSource(r); ok {
+		mode = "sendfile"
+		n, err = io.Copy(w, f)
+	} else {
+		mode = "buffered"
+		size := p.ServeBufferSize
+		if size <= 0 {
+			size = defaultServeBufferSize
+		}
+		pool := serveBufferPool(size)
+		buf := pool.Get().(*[]byte)
+		n, err = io.CopyBuffer(writerOnly{w}, r, *buf)
+		pool.Put(buf)
+	}
+	metrics.RecordBytesServed(mode, n)
+	if err != nil && p.Logger != nil {
+		p.Logger.Debug("artifact stream ended early", "bytes", n, "error", err)
+	}
+	return n
+}
+
+// fileSource returns the *os.File behind r when reads can go straight to the
+// file. Storage readers from gocloud's fileblob expose it through As; readers
+// that wrap the body (such as integrity verification) are not unwrapped.
+func fileSource(r io.Reader) (*os.File, bool) {
+	if f, ok := r.(*os.File); ok {
+		return f, true
+	}
+	if a, ok := r.(interface{ As(any) bool }); ok {
+		var inner io.Reader
+		if a.As(&inner) {
+			f, ok := inner.(*os.File)
+			return f, ok
+		}
+	}
+	return nil, false
+}
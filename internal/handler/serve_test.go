@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const largeArtifactSize = 8<<20 + 123 // not a multiple of any buffer size
+
+func writeLargeArtifact(t testing.TB) (string, []byte) {
+	t.Helper()
+	data := make([]byte, largeArtifactSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("generating data: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "layer.tar.gz")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing artifact: %v", err)
+	}
+	return path, data
+}
+
+func serveLargeArtifact(t testing.TB, p *Proxy, open func() io.ReadCloser) []byte {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		p.ServeArtifact(w, &CacheResult{
+			Reader:      open(),
+			Size:        largeArtifactSize,
+			ContentType: "application/octet-stream",
+		})
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	return body
+}
+
+func TestServeArtifactLarge(t *testing.T) {
+	path, data := writeLargeArtifact(t)
+	want := sha256.Sum256(data)
+
+	tests := []struct {
+		name   string
+		buffer int
+		open   func() io.ReadCloser
+	}{
+		{"file with sendfile", 0, func() io.ReadCloser {
+			f, _ := os.Open(path)
+			return f
+		}},
+		{"wrapped reader with configured buffer", 1 << 20, func() io.ReadCloser {
+			f, _ := os.Open(path)
+			return struct {
+				io.Reader
+				io.Closer
+			}{f, f}
+		}},
+		{"wrapped reader with default buffer", 0, func() io.ReadCloser {
+			return io.NopCloser(bytes.NewReader(data))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProxy()
+			p.ServeBufferSize = tt.buffer
+			body := serveLargeArtifact(t, p, tt.open)
+			if len(body) != largeArtifactSize {
+				t.Fatalf("served %d bytes, want %d", len(body), largeArtifactSize)
+			}
+			if sha256.Sum256(body) != want {
+				t.Error("served body does not match artifact")
+			}
+		})
+	}
+}
+
+type readerWithAs struct {
+	io.ReadCloser
+	inner io.Reader
+}
+
+func (r readerWithAs) As(i any) bool {
+	p, ok := i.(*io.Reader)
+	if ok {
+		*p = r.inner
+	}
+	return ok
+}
+
+func TestFileSource(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if got, ok := fileSource(f); !ok || got != f {
+		t.Error("expected *os.File to be used directly")
+	}
+	if got, ok := fileSource(readerWithAs{io.NopCloser(f), f}); !ok || got != f {
+		t.Error("expected file behind As to be used")
+	}
+	if _, ok := fileSource(io.NopCloser(f)); ok {
+		t.Error("wrapped reader should not be unwrapped")
+	}
+	if _, ok := fileSource(readerWithAs{inner: bytes.NewReader(nil)}); ok {
+		t.Error("non-file reader behind As should not be used")
+	}
+}
+
+func BenchmarkServeArtifact(b *testing.B) {
+	path, _ := writeLargeArtifact(b)
+	for _, size := range []int{32 << 10, 256 << 10, 1 << 20} {
+		b.Run(byteCountName(size), func(b *testing.B) {
+			p := testProxy()
+			p.ServeBufferSize = size
+			b.SetBytes(largeArtifactSize)
+			for b.Loop() {
+				f, _ := os.Open(path)
+				w := httptest.NewRecorder()
+				p.ServeArtifact(w, &CacheResult{Reader: struct {
+					io.Reader
+					io.Closer
+				}{f, f}, Size: largeArtifactSize})
+			}
+		})
+	}
+}
+
+func byteCountName(n int) string {
+	if n >= 1<<20 {
+		return "buffer=" + strconv.Itoa(n>>20) + "MB"
+	}
+	return "buffer=" + strconv.Itoa(n>>10) + "KB"
+}
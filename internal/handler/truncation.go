@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/git-pkgs/proxy/internal/metrics"
+)
+
+// ErrTruncatedDownload is returned when an upstream body ended before the
+// Content-Length it advertised. The partial blob is deleted rather than
+// cached, and handlers answer with 502 so the client retries.
+var ErrTruncatedDownload = errors.New("upstream download truncated")
+
+// checkStoredSize compares the size of a freshly stored artifact with the
+// Content-Length upstream advertised for it. An unknown length (-1) or zero
+// is not checked. On a mismatch the stored blob is deleted so a broken
+// download is never served from cache.
+func (p *Proxy) checkStoredSize(ctx context.Context, ecosystem, storagePath, upstreamURL string, advertised, stored int64) error {
+	if advertised <= 0 || stored == advertised {
+		return nil
+	}
+
+	p.Logger.Warn("upstream download size mismatch, discarding",
+		"ecosystem", ecosystem, "url", upstreamURL, "content_length", advertised, "stored", stored)
+	metrics.RecordUpstreamError(ecosystem, "truncated")
+	if err := p.Storage.Delete(context.WithoutCancel(ctx), storagePath); err != nil {
+		metrics.RecordStorageError("delete")
+		p.Logger.Error("failed to delete truncated artifact", "path", storagePath, "error", err)
+	}
+	return fmt.Errorf("%w: got %d of %d bytes from %s", ErrTruncatedDownload, stored, advertised, upstreamURL)
+}
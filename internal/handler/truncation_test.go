@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/purl"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestTruncatedDownloadNotCached(t *testing.T) {
+	proxy, db, store, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("only part")),
+		Size:        1024,
+		ContentType: "application/octet-stream",
+	}
+
+	h := NewNPMHandler(proxy, "http://localhost")
+	w := httptest.NewRecorder()
+	h.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lodash/-/lodash-4.17.21.tgz", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("storage holds %d files, want the truncated blob deleted", len(store.files))
+	}
+	art, err := db.GetArtifact(purl.MakePURLString("npm", "lodash", "4.17.21"), "lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if art != nil && art.IsCached() {
+		t.Error("truncated artifact was recorded as cached")
+	}
+}
+
+func TestTruncatedDownloadFromURL(t *testing.T) {
+	proxy, _, store, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body: io.NopCloser(strings.NewReader("short")),
+		Size: 6,
+	}
+
+	_, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+	if !errors.Is(err, ErrTruncatedDownload) {
+		t.Fatalf("err = %v, want ErrTruncatedDownload", err)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("storage holds %d files, want none", len(store.files))
+	}
+}
+
+func TestUnknownContentLengthAccepted(t *testing.T) {
+	proxy, _, store, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body: io.NopCloser(strings.NewReader("tarball")),
+		Size: -1,
+	}
+
+	result, err := proxy.GetOrFetchArtifactFromURL(context.Background(), "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", npmPrimaryTarball)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = result.Reader.Close()
+	if len(store.files) != 1 {
+		t.Errorf("storage holds %d files, want 1", len(store.files))
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// defaultTrustedHosts lists the upstream hosts whose URLs each ecosystem's
+// metadata rewriting will point back at this proxy. Anything else found in
+// upstream metadata is left as-is so a crafted or tampered response can't
+// turn the proxy into a relay for arbitrary hosts.
+var defaultTrustedHosts = map[string][]string{
+	"pypi": {"files.pythonhosted.org"},
+	"npm":  {"registry.npmjs.org"},
+	"composer": {
+		"repo.packagist.org",
+		"api.github.com",
+		"codeload.github.com",
+		"github.com",
+		"gitlab.com",
+		"bitbucket.org",
+	},
+}
+
+// IsTrustedUpstream reports whether rawURL points at a host that is allowed
+// to be rewritten and fetched through the proxy for the given ecosystem.
+// Only http and https URLs are considered.
+func (p *Proxy) IsTrustedUpstream(ecosystem, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return false
+	}
+	for _, h := range defaultTrustedHosts[ecosystem] {
+		if host == h {
+			return true
+		}
+	}
+	for _, h := range p.TrustedHosts[ecosystem] {
+		if host == strings.ToLower(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// logUntrustedUpstream records a URL that was skipped by rewriting because
+// its host is not trusted for the ecosystem.
+func (p *Proxy) logUntrustedUpstream(ecosystem, rawURL string) {
+	p.Logger.Warn("not rewriting url to untrusted upstream host",
+		"ecosystem", ecosystem, "url", rawURL)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestIsTrustedUpstream(t *testing.T) {
+	p := &Proxy{
+		Logger:       slog.Default(),
+		TrustedHosts: map[string][]string{"npm": {"NPM.Internal.Example"}},
+	}
+
+	tests := []struct {
+		ecosystem string
+		url       string
+		want      bool
+	}{
+		{"pypi", "https://files.pythonhosted.org/packages/ab/cd/x-1.0.tar.gz", true},
+		{"pypi", "https://FILES.pythonhosted.org:443/packages/ab/cd/x-1.0.tar.gz", true},
+		{"pypi", "https://evil.example/packages/ab/cd/x-1.0.tar.gz", false},
+		{"pypi", "ftp://files.pythonhosted.org/packages/x", false},
+		{"pypi", "/packages/ab/cd/x-1.0.tar.gz", false},
+		{"npm", "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz", true},
+		{"npm", "https://npm.internal.example/lodash/-/lodash-4.17.21.tgz", true},
+		{"npm", "https://files.pythonhosted.org/lodash-4.17.21.tgz", false},
+		{"composer", "https://api.github.com/repos/a/b/zipball/abc", true},
+		{"cargo", "https://static.crates.io/crates/serde/serde-1.0.0.crate", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.IsTrustedUpstream(tt.ecosystem, tt.url); got != tt.want {
+			t.Errorf("IsTrustedUpstream(%q, %q) = %v, want %v", tt.ecosystem, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestPyPIRewriteJSONMetadataUntrustedHost(t *testing.T) {
+	h := &PyPIHandler{
+		proxy:    testProxy(),
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
+	}
+
+	input := `{
+		"info": {"name": "requests"},
+		"releases": {
+			"2.31.0": [
+				{"url": "https://files.pythonhosted.org/packages/ab/cd/requests-2.31.0.tar.gz"},
+				{"url": "https://evil.example/packages/ab/cd/requests-2.31.0-py3-none-any.whl"}
+			]
+		},
+		"urls": [{"url": "https://evil.example/packages/ab/cd/requests-2.31.0.tar.gz"}]
+	}`
+
+	output, err := h.rewriteJSONMetadata([]byte(input))
+	if err != nil {
+		t.Fatalf("rewriteJSONMetadata failed: %v", err)
+	}
+
+	var result struct {
+		Releases map[string][]map[string]string `json:"releases"`
+		URLs     []map[string]string            `json:"urls"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		t.Fatalf("failed to parse output: %v", err)
+	}
+
+	files := result.Releases["2.31.0"]
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if want := "http://localhost:8080/pypi/packages/packages/ab/cd/requests-2.31.0.tar.gz"; files[0]["url"] != want {
+		t.Errorf("trusted url = %q, want %q", files[0]["url"], want)
+	}
+	if want := "https://evil.example/packages/ab/cd/requests-2.31.0-py3-none-any.whl"; files[1]["url"] != want {
+		t.Errorf("untrusted url = %q, want it left untouched", files[1]["url"])
+	}
+	if want := "https://evil.example/packages/ab/cd/requests-2.31.0.tar.gz"; result.URLs[0]["url"] != want {
+		t.Errorf("untrusted urls entry = %q, want it left untouched", result.URLs[0]["url"])
+	}
+}
+
+func TestPyPIRewriteSimpleHTMLUntrustedHost(t *testing.T) {
+	h := &PyPIHandler{
+		proxy:    testProxy(),
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
+	}
+
+	input := `<a href="https://files.pythonhosted.org/packages/ab/cd/requests-2.31.0.tar.gz#sha256=aa">requests-2.31.0.tar.gz</a>
+<a href="https://evil.example/packages/ab/cd/requests-2.31.0-py3-none-any.whl#sha256=bb">requests-2.31.0-py3-none-any.whl</a>`
+
+	output := string(h.rewriteSimpleHTML([]byte(input), nil))
+
+	if !strings.Contains(output, `href="http://localhost:8080/pypi/packages/packages/ab/cd/requests-2.31.0.tar.gz"`) {
+		t.Errorf("trusted link not rewritten:\n%s", output)
+	}
+	if !strings.Contains(output, `href="https://evil.example/packages/ab/cd/requests-2.31.0-py3-none-any.whl#sha256=bb"`) {
+		t.Errorf("untrusted link should be left untouched:\n%s", output)
+	}
+}
+
+func TestNPMRewriteMetadataUntrustedHost(t *testing.T) {
+	h := &NPMHandler{
+		proxy:    testProxy(),
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
+	}
+
+	input := `{
+		"name": "lodash",
+		"versions": {
+			"4.17.21": {"dist": {"tarball": "https://evil.example/lodash/-/lodash-4.17.21.tgz"}}
+		}
+	}`
+
+	output, err := h.rewriteMetadata("lodash", []byte(input))
+	if err != nil {
+		t.Fatalf("rewriteMetadata failed: %v", err)
+	}
+
+	if !strings.Contains(string(output), "https://evil.example/lodash/-/lodash-4.17.21.tgz") {
+		t.Errorf("untrusted tarball url should be left untouched: %s", output)
+	}
+}
+
+func TestComposerRewriteDistURLUntrustedHost(t *testing.T) {
+	h := &ComposerHandler{
+		proxy:    testProxy(),
+		linkBase: linkBase{proxyURL: "http://localhost:8080"},
+	}
+
+	vmap := map[string]any{
+		"dist": map[string]any{
+			"url":  "https://evil.example/vendor/pkg/1.0.0.zip",
+			"type": "zip",
+		},
+	}
+
+	h.rewriteDistURL(vmap, "vendor/pkg", "1.0.0")
+
+	if got := vmap["dist"].(map[string]any)["url"]; got != "https://evil.example/vendor/pkg/1.0.0.zip" {
+		t.Errorf("untrusted dist url = %q, want it left untouched", got)
+	}
+}
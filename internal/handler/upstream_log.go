@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// upstreamLogHeaders are the upstream response headers logged at debug
+// level. They cover the usual suspects when an upstream misbehaves: wrong
+// content types, unexpected redirects and rate limiting.
+var upstreamLogHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"ETag",
+	"Last-Modified",
+	"Location",
+	"Retry-After",
+}
+
+// upstreamLogHeaderPrefixes matches rate-limit headers, which vary by
+// registry (X-RateLimit-Remaining, RateLimit-Reset, ...). Header names are
+// compared in canonical form.
+var upstreamLogHeaderPrefixes = []string{
+	"X-Ratelimit-",
+	"Ratelimit-",
+}
+
+// upstreamHeaderAttrs returns the logged subset of h as slog attributes
+// keyed by lower-cased header name.
+func upstreamHeaderAttrs(h http.Header) []any {
+	var attrs []any
+	for _, name := range upstreamLogHeaders {
+		if v := h.Get(name); v != "" {
+			attrs = append(attrs, strings.ToLower(name), v)
+		}
+	}
+	var rateLimit []string
+	for name := range h {
+		for _, prefix := range upstreamLogHeaderPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				rateLimit = append(rateLimit, name)
+				break
+			}
+		}
+	}
+	sort.Strings(rateLimit)
+	for _, name := range rateLimit {
+		attrs = append(attrs, strings.ToLower(name), h.Get(name))
+	}
+	return attrs
+}
+
+// SetUpstreamTransport makes HTTPClient send upstream requests through rt,
+// keeping the debug logging NewProxy installs. Call it before
+// EnableUpstreamOverride, which wraps whatever transport is set.
+func (p *Proxy) SetUpstreamTransport(rt http.RoundTripper) {
+	p.HTTPClient.Transport = &upstreamLogTransport{base: rt, proxy: p}
+}
+
+// upstreamLogTransport logs the status and selected headers of every
+// upstream response when the proxy's logger is at debug level.
+type upstreamLogTransport struct {
+	base  http.RoundTripper
+	proxy *Proxy
+}
+
+func (t *upstreamLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// Every request through HTTPClient passes here, so this is where
+	// metadata and passthrough requests are stopped from looping back.
+	if err := t.proxy.checkUpstreamLoop(req.Context(), req.URL.String()); err != nil {
+		return nil, err
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	logger := t.proxy.Logger
+	if logger.Enabled(req.Context(), slog.LevelDebug) {
+		attrs := []any{"method", req.Method, "url", req.URL.String(), "status", resp.StatusCode}
+		logger.Debug("upstream response", append(attrs, upstreamHeaderAttrs(resp.Header)...)...)
+	}
+	return resp, nil
+}
+
+// logUpstreamArtifact logs what the artifact fetcher got back from upstream
+// at debug level. The fetcher only returns successful responses and doesn't
+// expose their headers, so this is limited to what fetch.Artifact carries.
+func (p *Proxy) logUpstreamArtifact(ctx context.Context, url string, artifact *fetch.Artifact) {
+	if !p.Logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []any{"url", url, "content-type", artifact.ContentType, "content-length", artifact.Size}
+	if artifact.ETag != "" {
+		attrs = append(attrs, "etag", artifact.ETag)
+	}
+	p.Logger.Debug("upstream artifact response", attrs...)
+}
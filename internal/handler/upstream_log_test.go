@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func newUpstreamLogTestProxy(t *testing.T, level slog.Level) (*Proxy, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: level}))
+	proxy := NewProxy(nil, newMockStorage(), &mockFetcher{}, fetch.NewResolver(), logger)
+	return proxy, &buf
+}
+
+func newUpstreamLogTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.npm.install-v1+json")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUpstreamLog_DebugLogsStatusAndHeaders(t *testing.T) {
+	upstream := newUpstreamLogTestServer(t)
+	proxy, buf := newUpstreamLogTestProxy(t, slog.LevelDebug)
+
+	req := httptest.NewRequest(http.MethodGet, "/lodash", nil)
+	proxy.ProxyFile(httptest.NewRecorder(), req, upstream.URL+"/lodash")
+
+	out := buf.String()
+	for _, want := range []string{
+		`msg="upstream response"`,
+		"status=418",
+		"content-type=application/vnd.npm.install-v1+json",
+		"x-ratelimit-remaining=42",
+		"url=" + upstream.URL + "/lodash",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("debug log missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("debug log includes a header that isn't on the allowlist:\n%s", out)
+	}
+}
+
+func TestUpstreamLog_SilentAboveDebug(t *testing.T) {
+	upstream := newUpstreamLogTestServer(t)
+	proxy, buf := newUpstreamLogTestProxy(t, slog.LevelInfo)
+
+	req := httptest.NewRequest(http.MethodGet, "/lodash", nil)
+	proxy.ProxyFile(httptest.NewRecorder(), req, upstream.URL+"/lodash")
+
+	if strings.Contains(buf.String(), "upstream response") {
+		t.Errorf("upstream response logged at info level:\n%s", buf.String())
+	}
+}
+
+func TestUpstreamLog_ArtifactFetch(t *testing.T) {
+	var buf bytes.Buffer
+	p, _, _, fetcher := setupTestProxy(t)
+	p.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("tarball")),
+		Size:        7,
+		ContentType: "application/octet-stream",
+		ETag:        `"v1"`,
+	}
+
+	result, err := p.GetOrFetchArtifactFromURL(t.Context(), "npm", "lodash", "4.17.21",
+		"lodash-4.17.21.tgz", "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz")
+	if err != nil {
+		t.Fatalf("GetOrFetchArtifactFromURL: %v", err)
+	}
+	_ = result.Reader.Close()
+
+	out := buf.String()
+	for _, want := range []string{
+		`msg="upstream artifact response"`,
+		"content-type=application/octet-stream",
+		"content-length=7",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("debug log missing %q:\n%s", want, out)
+		}
+	}
+}
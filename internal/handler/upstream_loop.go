@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrUpstreamLoop is returned instead of fetching an upstream URL that
+// points back at this proxy. That happens when base_url or an upstream
+// setting is misconfigured, for example a trusted host that is really the
+// proxy's own address: the proxy would fetch from itself, which fetches
+// from itself again, until something times out.
+var ErrUpstreamLoop = errors.New("upstream URL points back at this proxy; check base_url and the upstream configuration")
+
+// SetSelfURLs records the addresses this proxy is reached at, typically the
+// configured base URL. Upstream requests to any of them fail with
+// ErrUpstreamLoop. A request's detected base URL, when base URL detection
+// is on, is always treated as one of them.
+func (p *Proxy) SetSelfURLs(urls ...string) {
+	p.selfHosts = nil
+	for _, raw := range urls {
+		host := urlHostPort(raw)
+		if host == "" {
+			continue
+		}
+		if p.selfHosts == nil {
+			p.selfHosts = make(map[string]bool)
+		}
+		p.selfHosts[host] = true
+	}
+}
+
+// checkUpstreamLoop returns ErrUpstreamLoop if rawURL's host and port are
+// those of this proxy, either configured with SetSelfURLs or detected for
+// the request ctx belongs to.
+func (p *Proxy) checkUpstreamLoop(ctx context.Context, rawURL string) error {
+	if len(p.selfHosts) == 0 && RequestBaseURL(ctx, "") == "" {
+		return nil
+	}
+	host := urlHostPort(rawURL)
+	if host == "" {
+		return nil
+	}
+	if p.selfHosts[host] || host == urlHostPort(RequestBaseURL(ctx, "")) {
+		return fmt.Errorf("%w: %s", ErrUpstreamLoop, rawURL)
+	}
+	return nil
+}
+
+// urlHostPort returns rawURL's lower-cased host and port, filling in the
+// scheme's default port so http://proxy and http://proxy:80 compare equal.
+// It returns "" for URLs that aren't absolute http(s) URLs.
+func urlHostPort(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		default:
+			return ""
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func TestUpstreamLoopRejected(t *testing.T) {
+	proxy, _, store, fetcher := setupTestProxy(t)
+	proxy.SetSelfURLs("http://proxy.local:8080")
+	fetcher.artifact = &fetch.Artifact{Body: io.NopCloser(strings.NewReader("\x1f\x8btarball"))}
+
+	_, err := proxy.GetOrFetchArtifactFromURL(t.Context(), "npm", "lodash", "4.17.21",
+		"lodash-4.17.21.tgz", "http://PROXY.local:8080/npm/lodash/-/lodash-4.17.21.tgz")
+	if !errors.Is(err, ErrUpstreamLoop) {
+		t.Fatalf("err = %v, want ErrUpstreamLoop", err)
+	}
+	if fetcher.fetchCalled {
+		t.Error("self-referential URL should not be fetched")
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %d files, want none", len(store.files))
+	}
+
+	// The same host on another port is a different server.
+	if _, err := proxy.GetOrFetchArtifactFromURL(t.Context(), "npm", "lodash", "4.17.21",
+		"lodash-4.17.21.tgz", "http://proxy.local:9090/lodash/-/lodash-4.17.21.tgz"); err != nil {
+		t.Fatalf("fetch from other port: %v", err)
+	}
+}
+
+func TestUpstreamLoopRejected_Metadata(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("upstream should not be requested")
+	}))
+	defer upstream.Close()
+
+	// The request's detected base URL counts as the proxy's own address.
+	ctx := context.WithValue(t.Context(), baseURLKey{}, upstream.URL)
+	_, _, err := proxy.FetchOrCacheMetadata(ctx, "npm", "lodash", upstream.URL+"/lodash")
+	if !errors.Is(err, ErrUpstreamLoop) {
+		t.Fatalf("err = %v, want ErrUpstreamLoop", err)
+	}
+}
+
+func TestURLHostPort(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://proxy.local", "proxy.local:80"},
+		{"https://Proxy.Local/npm", "proxy.local:443"},
+		{"http://proxy.local:8080", "proxy.local:8080"},
+		{"http://[::1]:8080/x", "[::1]:8080"},
+		{"ftp://proxy.local", ""},
+		{"/relative/path", ""},
+	}
+	for _, tt := range tests {
+		if got := urlHostPort(tt.url); got != tt.want {
+			t.Errorf("urlHostPort(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
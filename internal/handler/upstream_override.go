@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// UpstreamOverrideHeader names the request header that, when the debug
+// override is enabled, redirects every upstream request made while serving
+// that request to a different base URL.
+const UpstreamOverrideHeader = "X-Proxy-Upstream"
+
+type upstreamOverrideKey struct{}
+
+// EnableUpstreamOverride turns on X-Proxy-Upstream handling for hosts in
+// allowedHosts and wraps the fetcher and HTTP client so overridden requests
+// are sent to the override. It must be called before handlers serve traffic.
+func (p *Proxy) EnableUpstreamOverride(allowedHosts []string) {
+	p.upstreamOverrideHosts = make(map[string]bool, len(allowedHosts))
+	for _, h := range allowedHosts {
+		p.upstreamOverrideHosts[strings.ToLower(h)] = true
+	}
+
+	if _, ok := p.Fetcher.(*overrideFetcher); !ok && p.Fetcher != nil {
+		p.Fetcher = &overrideFetcher{FetcherInterface: p.Fetcher}
+	}
+	// Copy the client rather than modifying it, since it may be shared
+	// (e.g. http.DefaultClient).
+	client := http.Client{Timeout: defaultHTTPTimeout}
+	if p.HTTPClient != nil {
+		client = *p.HTTPClient
+	}
+	if _, ok := client.Transport.(*overrideTransport); !ok {
+		client.Transport = &overrideTransport{base: client.Transport}
+	}
+	p.HTTPClient = &client
+}
+
+// UpstreamOverrideMiddleware reads X-Proxy-Upstream and, when the override is
+// enabled and the URL's host is allowlisted, attaches it to the request
+// context. A rejected override gets a 400 so a misconfigured debug session
+// doesn't silently fall back to the real upstream. When the override is not
+// enabled the header is ignored.
+func (p *Proxy) UpstreamOverrideMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get(UpstreamOverrideHeader)
+		if raw == "" || p.upstreamOverrideHosts == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u, err := p.parseUpstreamOverride(raw)
+		if err != nil {
+			p.Logger.Warn("rejected upstream override", "value", raw, "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		p.Logger.Info("using upstream override", "path", r.URL.Path, "upstream", u.String())
+		ctx := context.WithValue(r.Context(), upstreamOverrideKey{}, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (p *Proxy) parseUpstreamOverride(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%s must be an absolute http(s) URL", UpstreamOverrideHeader)
+	}
+	if !p.upstreamOverrideHosts[strings.ToLower(u.Hostname())] {
+		return nil, fmt.Errorf("%s host %q is not in debug.upstream_override_hosts", UpstreamOverrideHeader, u.Hostname())
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, nil
+}
+
+// upstreamOverride returns the override attached to ctx, or nil.
+func upstreamOverride(ctx context.Context) *url.URL {
+	u, _ := ctx.Value(upstreamOverrideKey{}).(*url.URL)
+	return u
+}
+
+// applyUpstreamOverride points rawURL at override: the scheme and host are
+// replaced and any path on the override is prepended to rawURL's path.
+func applyUpstreamOverride(override *url.URL, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = override.Scheme
+	u.Host = override.Host
+	u.User = override.User
+	if override.Path != "" {
+		u.Path = override.Path + "/" + strings.TrimPrefix(u.Path, "/")
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+// overrideTransport sends requests whose context carries an upstream
+// override to the override URL instead.
+type overrideTransport struct {
+	base http.RoundTripper
+}
+
+func (t *overrideTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	override := upstreamOverride(req.Context())
+	if override == nil {
+		return base.RoundTrip(req)
+	}
+
+	target, err := url.Parse(applyUpstreamOverride(override, req.URL.String()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL = target
+	req.Host = ""
+	return base.RoundTrip(req)
+}
+
+// overrideFetcher rewrites artifact URLs for requests carrying an upstream
+// override before handing them to the wrapped fetcher.
+type overrideFetcher struct {
+	fetch.FetcherInterface
+}
+
+func (f *overrideFetcher) rewrite(ctx context.Context, rawURL string) string {
+	if override := upstreamOverride(ctx); override != nil {
+		return applyUpstreamOverride(override, rawURL)
+	}
+	return rawURL
+}
+
+func (f *overrideFetcher) Fetch(ctx context.Context, url string) (*fetch.Artifact, error) {
+	return f.FetcherInterface.Fetch(ctx, f.rewrite(ctx, url))
+}
+
+func (f *overrideFetcher) FetchWithHeaders(ctx context.Context, url string, headers http.Header) (*fetch.Artifact, error) {
+	return f.FetcherInterface.FetchWithHeaders(ctx, f.rewrite(ctx, url), headers)
+}
+
+func (f *overrideFetcher) Head(ctx context.Context, url string) (int64, string, error) {
+	return f.FetcherInterface.Head(ctx, f.rewrite(ctx, url))
+}
+
+// fetchUncached fetches an artifact for a request carrying an upstream
+// override. Nothing is read from or written to the cache so a debugging
+// session can't serve stale copies or poison the cache for other clients.
+func (p *Proxy) fetchUncached(ctx context.Context, downloadURL string, headers http.Header) (*CacheResult, error) {
+	if err := p.checkUpstreamLoop(ctx, downloadURL); err != nil {
+		return nil, err
+	}
+	artifact, err := p.Fetcher.FetchWithHeaders(ctx, downloadURL, headers)
+	if err != nil {
+		if errors.Is(err, fetch.ErrNotFound) {
+			return nil, upstreamNotFound(err)
+		}
+		return nil, fmt.Errorf("fetching from upstream: %w", err)
+	}
+	noteCacheStatus(ctx, CacheStatusBypass)
+	return &CacheResult{
+		Reader:      artifact.Body,
+		Size:        artifact.Size,
+		ContentType: artifact.ContentType,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/registries/fetch"
+)
+
+func newOverrideTestUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"testpkg","description":"` + name + `","versions":{}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func serveNPMMetadataWithOverride(t *testing.T, proxy *Proxy, upstreamURL, override string) *httptest.ResponseRecorder {
+	t.Helper()
+	h := &NPMHandler{
+		proxy:       proxy,
+		upstreamURL: upstreamURL,
+		linkBase:    linkBase{proxyURL: "http://proxy.local"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/testpkg", nil)
+	req.SetPathValue("name", "testpkg")
+	req.Header.Set(UpstreamOverrideHeader, override)
+
+	w := httptest.NewRecorder()
+	proxy.UpstreamOverrideMiddleware(http.HandlerFunc(h.handlePackageMetadata)).ServeHTTP(w, req)
+	return w
+}
+
+func TestUpstreamOverride_EnabledUsesOverride(t *testing.T) {
+	primary := newOverrideTestUpstream(t, "real")
+	mirror := newOverrideTestUpstream(t, "mirror")
+
+	proxy := testProxy()
+	proxy.EnableUpstreamOverride([]string{"127.0.0.1"})
+
+	w := serveNPMMetadataWithOverride(t, proxy, primary.URL, mirror.URL)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"mirror"`) {
+		t.Errorf("expected response from override upstream, got %s", w.Body.String())
+	}
+	if http.DefaultClient.Transport != nil {
+		t.Error("EnableUpstreamOverride modified http.DefaultClient")
+	}
+}
+
+func TestUpstreamOverride_DisabledIgnoresHeader(t *testing.T) {
+	primary := newOverrideTestUpstream(t, "real")
+	mirror := newOverrideTestUpstream(t, "mirror")
+
+	w := serveNPMMetadataWithOverride(t, testProxy(), primary.URL, mirror.URL)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"real"`) {
+		t.Errorf("expected response from configured upstream, got %s", w.Body.String())
+	}
+}
+
+func TestUpstreamOverride_RejectsUnlistedHost(t *testing.T) {
+	primary := newOverrideTestUpstream(t, "real")
+
+	proxy := testProxy()
+	proxy.EnableUpstreamOverride([]string{"mirror.example.com"})
+
+	for _, override := range []string{"https://evil.example.com", "ftp://mirror.example.com", "mirror.example.com"} {
+		w := serveNPMMetadataWithOverride(t, proxy, primary.URL, override)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("override %q: status = %d, want %d", override, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestUpstreamOverride_ArtifactBypassesCache(t *testing.T) {
+	proxy, _, store, fetcher := setupTestProxy(t)
+	fetcher.artifact = &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader("tarball")),
+		Size:        7,
+		ContentType: "application/octet-stream",
+	}
+	proxy.EnableUpstreamOverride([]string{"mirror.example.com"})
+
+	override, _ := url.Parse("https://mirror.example.com/npm")
+	ctx := context.WithValue(context.Background(), upstreamOverrideKey{}, override)
+
+	result, err := proxy.GetOrFetchArtifactFromURL(ctx, "npm", "testpkg", "1.0.0", "testpkg-1.0.0.tgz",
+		"https://registry.npmjs.org/testpkg/-/testpkg-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = result.Reader.Close()
+
+	if want := "https://mirror.example.com/npm/testpkg/-/testpkg-1.0.0.tgz"; fetcher.fetchedURL != want {
+		t.Errorf("fetched %q, want %q", fetcher.fetchedURL, want)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("override fetch was written to storage: %v", store.files)
+	}
+}
+
+func TestApplyUpstreamOverride(t *testing.T) {
+	tests := []struct {
+		override, raw, want string
+	}{
+		{"https://mirror.example.com", "https://registry.npmjs.org/lodash", "https://mirror.example.com/lodash"},
+		{"http://mirror.example.com:8080/pypi", "https://pypi.org/simple/requests/", "http://mirror.example.com:8080/pypi/simple/requests/"},
+		{"https://mirror.example.com", "https://repo1.maven.org/maven2/a/b?x=1", "https://mirror.example.com/maven2/a/b?x=1"},
+	}
+	for _, tt := range tests {
+		o, _ := url.Parse(tt.override)
+		if got := applyUpstreamOverride(o, tt.raw); got != tt.want {
+			t.Errorf("applyUpstreamOverride(%q, %q) = %q, want %q", tt.override, tt.raw, got, tt.want)
+		}
+	}
+}
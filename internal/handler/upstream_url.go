@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters added by link shorteners and
+// analytics that never change which file upstream serves.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+}
+
+// isTrackingParam reports whether the query parameter key is a tracking
+// parameter: one of trackingParams or any utm_* parameter.
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return trackingParams[key] || strings.HasPrefix(key, "utm_")
+}
+
+// normalizeUpstreamURL returns rawURL in a canonical form, so the same
+// artifact fetched through slightly different URLs is recorded the same
+// way. The scheme and host are lowercased, a default port and the fragment
+// are dropped, tracking parameters are removed and the remaining query is
+// sorted by key. Other parameters, such as the signature on a presigned
+// URL, are kept. A URL that doesn't parse is returned unchanged.
+func normalizeUpstreamURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	switch port := u.Port(); {
+	case port == "",
+		port == "80" && u.Scheme == "http",
+		port == "443" && u.Scheme == "https":
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		u.Host = host
+	default:
+		u.Host = strings.ToLower(u.Host)
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.RawQuery != "" {
+		query, err := url.ParseQuery(u.RawQuery)
+		if err == nil {
+			for key := range query {
+				if isTrackingParam(key) {
+					delete(query, key)
+				}
+			}
+			u.RawQuery = query.Encode()
+		}
+	}
+	u.ForceQuery = false
+
+	return u.String()
+}
@@ -0,0 +1,56 @@
+package handler
+
+import "testing"
+
+func TestNormalizeUpstreamURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{
+			"HTTPS://Registry.NPMjs.org:443/lodash/-/lodash-4.17.21.tgz?utm_source=ci#readme",
+			"https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz",
+		},
+		{
+			"https://files.example.com/pkg.whl?X-Amz-Signature=abc&fbclid=1&X-Amz-Date=20260101",
+			"https://files.example.com/pkg.whl?X-Amz-Date=20260101&X-Amz-Signature=abc",
+		},
+		{
+			"http://Mirror.Example.com:8080/Pkg-1.0.tgz?",
+			"http://mirror.example.com:8080/Pkg-1.0.tgz",
+		},
+		{
+			"http://[::1]:80/a.tgz",
+			"http://[::1]/a.tgz",
+		},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := normalizeUpstreamURL(tt.in); got != tt.want {
+			t.Errorf("normalizeUpstreamURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateCacheDBNormalizesUpstreamURL(t *testing.T) {
+	proxy, db, _, _ := setupTestProxy(t)
+	proxy.NormalizeUpstreamURLs = true
+
+	for _, upstreamURL := range []string{
+		"https://registry.npmjs.org/left-pad/-/left-pad-1.0.0.tgz?utm_source=renovate",
+		"HTTPS://Registry.npmjs.org:443/left-pad/-/left-pad-1.0.0.tgz#sha512",
+	} {
+		if err := proxy.updateCacheDB("npm", "left-pad", "left-pad-1.0.0.tgz",
+			"pkg:npm/left-pad", "pkg:npm/left-pad@1.0.0", upstreamURL,
+			"npm/left-pad/1.0.0/left-pad-1.0.0.tgz", "abc123", 10, "application/gzip"); err != nil {
+			t.Fatalf("updateCacheDB(%q): %v", upstreamURL, err)
+		}
+
+		art, err := db.GetArtifact("pkg:npm/left-pad@1.0.0", "left-pad-1.0.0.tgz")
+		if err != nil || art == nil {
+			t.Fatalf("GetArtifact: %v", err)
+		}
+		if want := "https://registry.npmjs.org/left-pad/-/left-pad-1.0.0.tgz"; art.UpstreamURL != want {
+			t.Errorf("stored upstream URL for %q = %q, want %q", upstreamURL, art.UpstreamURL, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+const (
+	// DefaultTeamHeader is the request header read for the team when no
+	// other header is configured.
+	DefaultTeamHeader = "X-Team"
+
+	// defaultUsageLogMax is used when Proxy.UsageLogMax is unset.
+	defaultUsageLogMax = 1000000
+	// usagePruneEvery is how many access log rows are written between
+	// prunes of the table back down to UsageLogMax.
+	usagePruneEvery = 1000
+	// maxTeamLength bounds the team name stored per row.
+	maxTeamLength = 128
+)
+
+type usageTeamKey struct{}
+
+// usageRecord identifies an artifact to record in the access log once it
+// has been served.
+type usageRecord struct {
+	team      string
+	ecosystem string
+	purl      string
+}
+
+// EnableUsageLog turns on recording of every artifact served in the
+// access_log table. The team is read from teamHeader, or DefaultTeamHeader
+// when empty, falling back to the Common Name of the client's verified TLS
+// certificate when clientCertTeam is set.
+func (p *Proxy) EnableUsageLog(teamHeader string, clientCertTeam bool) {
+	if teamHeader == "" {
+		teamHeader = DefaultTeamHeader
+	}
+	p.usageEnabled = true
+	p.usageTeamHeader = teamHeader
+	p.usageClientCertTeam = clientCertTeam
+}
+
+// UsageMiddleware attaches the requesting team to the request context so
+// artifacts served while handling it are attributed to that team. Requests
+// without a team are still recorded, under the empty team. When the usage
+// log is not enabled it does nothing.
+func (p *Proxy) UsageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.usageEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), usageTeamKey{}, p.requestTeam(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestTeam returns the team a request is attributed to.
+func (p *Proxy) requestTeam(r *http.Request) string {
+	team := strings.TrimSpace(r.Header.Get(p.usageTeamHeader))
+	if team == "" && p.usageClientCertTeam && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		team = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	if len(team) > maxTeamLength {
+		team = team[:maxTeamLength]
+	}
+	return team
+}
+
+// attachUsage marks result to be recorded in the access log when served, if
+// the request behind ctx passed through UsageMiddleware.
+func attachUsage(ctx context.Context, result *CacheResult, ecosystem, versionPURL string) {
+	team, ok := ctx.Value(usageTeamKey{}).(string)
+	if !ok || result == nil {
+		return
+	}
+	result.usage = &usageRecord{team: team, ecosystem: ecosystem, purl: versionPURL}
+}
+
+// recordUsage writes an access log row for bytes served of the artifact in
+// u, pruning the table every usagePruneEvery rows. Failures are logged and
+// never affect the response.
+func (p *Proxy) recordUsage(u *usageRecord, bytes int64) {
+	if u == nil || p.DB == nil {
+		return
+	}
+
+	entry := &database.AccessLogEntry{
+		Team:      u.team,
+		Ecosystem: u.ecosystem,
+		PURL:      u.purl,
+		Bytes:     max(bytes, 0),
+	}
+	if err := p.DB.InsertAccessLog(entry); err != nil {
+		p.Logger.Warn("failed to record artifact access", "error", err)
+		return
+	}
+
+	if p.usageInserts.Add(1)%usagePruneEvery != 0 {
+		return
+	}
+	limit := p.UsageLogMax
+	if limit <= 0 {
+		limit = defaultUsageLogMax
+	}
+	if _, err := p.DB.PruneAccessLog(limit); err != nil {
+		p.Logger.Warn("failed to prune access log", "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsageLogAccumulatesBytesPerTeam(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	const tarball = "tarball data"
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", tarball)
+	// Store the real hash so repeated hits pass the integrity check.
+	sum := sha256.Sum256([]byte(tarball))
+	if _, err := db.Exec("UPDATE artifacts SET content_hash = ?", hex.EncodeToString(sum[:])); err != nil {
+		t.Fatal(err)
+	}
+	proxy.EnableUsageLog("", false)
+	h := proxy.UsageMiddleware(NewNPMHandler(proxy, "http://localhost").Routes())
+
+	for _, team := range []string{"payments", "payments", "search", ""} {
+		header := http.Header{}
+		if team != "" {
+			header.Set(DefaultTeamHeader, team)
+		}
+		if w := serveNPMTarball(h, header); w.Code != http.StatusOK {
+			t.Fatalf("team %q: status = %d: %s", team, w.Code, w.Body.String())
+		}
+	}
+
+	usage, err := db.GetUsageByTeam(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetUsageByTeam() error = %v", err)
+	}
+	got := map[string][2]int64{}
+	for _, u := range usage {
+		got[u.Team] = [2]int64{u.Requests, u.Bytes}
+	}
+	n := int64(len(tarball))
+	want := map[string][2]int64{
+		"payments": {2, 2 * n},
+		"search":   {1, n},
+		"":         {1, n},
+	}
+	for team, w := range want {
+		if got[team] != w {
+			t.Errorf("team %q: [requests bytes] = %v, want %v", team, got[team], w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got teams %v, want %v", got, want)
+	}
+}
+
+func TestUsageLogDisabled(t *testing.T) {
+	proxy, db, store, _ := setupTestProxy(t)
+	seedPackage(t, db, store, "npm", "lodash", "4.17.21", "lodash-4.17.21.tgz", "tarball data")
+	h := proxy.UsageMiddleware(NewNPMHandler(proxy, "http://localhost").Routes())
+
+	serveNPMTarball(h, http.Header{DefaultTeamHeader: {"payments"}})
+
+	usage, err := db.GetUsageByTeam(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetUsageByTeam() error = %v", err)
+	}
+	if len(usage) != 0 {
+		t.Errorf("usage = %+v, want nothing recorded while disabled", usage)
+	}
+}
+
+func TestRequestTeam(t *testing.T) {
+	proxy, _, _, _ := setupTestProxy(t)
+	proxy.EnableUsageLog("X-Cost-Center", true)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "platform"}}
+	tests := []struct {
+		name   string
+		header string
+		state  *tls.ConnectionState
+		want   string
+	}{
+		{name: "header", header: "search", want: "search"},
+		{name: "header wins over certificate", header: "search",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, want: "search"},
+		{name: "verified certificate",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, want: "platform"},
+		{name: "unverified certificate ignored",
+			state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, want: ""},
+		{name: "none", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Cost-Center", tt.header)
+			}
+			r.TLS = tt.state
+			if got := proxy.requestTeam(r); got != tt.want {
+				t.Errorf("requestTeam() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package metrics
 
 import (
 	"net/http"
+	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -60,6 +62,30 @@ var (
 		},
 	)
 
+	EcosystemCachedArtifacts = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_ecosystem_cached_artifacts",
+			Help: "Number of cached artifacts by ecosystem",
+		},
+		[]string{"ecosystem"},
+	)
+
+	EcosystemCacheSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_ecosystem_cache_size_bytes",
+			Help: "Size of cached artifacts in bytes by ecosystem",
+		},
+		[]string{"ecosystem"},
+	)
+
+	EcosystemCacheHits = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_ecosystem_cached_artifact_hits",
+			Help: "Recorded hits on currently cached artifacts by ecosystem",
+		},
+		[]string{"ecosystem"},
+	)
+
 	// Upstream metrics
 	UpstreamFetchDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -78,6 +104,14 @@ var (
 		[]string{"ecosystem", "error_type"},
 	)
 
+	UpstreamFetchesInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_upstream_fetches_in_flight",
+			Help: "Number of upstream artifact downloads currently running, by ecosystem",
+		},
+		[]string{"ecosystem"},
+	)
+
 	// Circuit breaker metrics
 	CircuitBreakerState = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -113,6 +147,13 @@ var (
 		[]string{"operation"},
 	)
 
+	CacheRecordingDegraded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "proxy_cache_recording_degraded",
+			Help: "1 while fetched artifacts can't be recorded in the database, 0 otherwise",
+		},
+	)
+
 	// Active requests
 	ActiveRequests = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -129,6 +170,22 @@ var (
 		[]string{"ecosystem"},
 	)
 
+	ScrubbedArtifacts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_scrub_artifacts_total",
+			Help: "Cached artifacts re-hashed by the background integrity scrub, by result (ok|corrupt|missing|error)",
+		},
+		[]string{"result"},
+	)
+
+	BytesServed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_artifact_bytes_served_total",
+			Help: "Total artifact bytes written to clients, by copy mode (sendfile|buffered)",
+		},
+		[]string{"mode"},
+	)
+
 	HealthProbeFailures = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "proxy_health_probe_failures_total",
@@ -136,6 +193,22 @@ var (
 		},
 		[]string{"step"},
 	)
+
+	// Build and process metrics
+	BuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_build_info",
+			Help: "Always 1, labeled with the version and commit the proxy was built from",
+		},
+		[]string{"version", "commit", "go_version"},
+	)
+
+	StartTime = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "proxy_start_time_seconds",
+			Help: "Unix time the proxy process started",
+		},
+	)
 )
 
 func init() {
@@ -147,16 +220,26 @@ func init() {
 		CacheMisses,
 		CacheSize,
 		CachedArtifacts,
+		EcosystemCachedArtifacts,
+		EcosystemCacheSize,
+		EcosystemCacheHits,
 		UpstreamFetchDuration,
 		UpstreamErrors,
+		UpstreamFetchesInFlight,
 		CircuitBreakerState,
 		CircuitBreakerTrips,
 		StorageOperationDuration,
 		StorageErrors,
+		CacheRecordingDegraded,
 		ActiveRequests,
 		IntegrityFailures,
+		ScrubbedArtifacts,
+		BytesServed,
 		HealthProbeFailures,
+		BuildInfo,
+		StartTime,
 	)
+	StartTime.SetToCurrentTime()
 }
 
 // Handler returns an HTTP handler for the Prometheus /metrics endpoint.
@@ -164,6 +247,13 @@ func Handler() http.Handler {
 	return promhttp.Handler()
 }
 
+// SetBuildInfo publishes the build version and commit on proxy_build_info.
+// Call it once at startup.
+func SetBuildInfo(version, commit string) {
+	BuildInfo.Reset()
+	BuildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+}
+
 // RecordRequest tracks request metrics with timing.
 func RecordRequest(ecosystem string, status int, duration time.Duration) {
 	statusStr := strconv.Itoa(status)
@@ -191,6 +281,16 @@ func RecordUpstreamError(ecosystem, errorType string) {
 	UpstreamErrors.WithLabelValues(ecosystem, errorType).Inc()
 }
 
+// IncrementUpstreamFetches marks an upstream download as started.
+func IncrementUpstreamFetches(ecosystem string) {
+	UpstreamFetchesInFlight.WithLabelValues(ecosystem).Inc()
+}
+
+// DecrementUpstreamFetches marks an upstream download as finished.
+func DecrementUpstreamFetches(ecosystem string) {
+	UpstreamFetchesInFlight.WithLabelValues(ecosystem).Dec()
+}
+
 // RecordStorageOperation tracks storage operation duration.
 func RecordStorageOperation(operation string, duration time.Duration) {
 	StorageOperationDuration.WithLabelValues(operation).Observe(duration.Seconds())
@@ -201,6 +301,19 @@ func RecordIntegrityFailure(ecosystem string) {
 	IntegrityFailures.WithLabelValues(ecosystem).Inc()
 }
 
+// RecordScrubResult counts one artifact checked by the integrity scrub.
+func RecordScrubResult(result string) {
+	ScrubbedArtifacts.WithLabelValues(result).Inc()
+}
+
+// RecordBytesServed adds n to the bytes-served counter. Throughput is the
+// rate of this counter.
+func RecordBytesServed(mode string, n int64) {
+	if n > 0 {
+		BytesServed.WithLabelValues(mode).Add(float64(n))
+	}
+}
+
 // RecordHealthProbeFailure increments the health probe failure counter.
 // step is one of: "write", "size", "read", "verify", "delete".
 func RecordHealthProbeFailure(step string) {
@@ -212,12 +325,59 @@ func RecordStorageError(operation string) {
 	StorageErrors.WithLabelValues(operation).Inc()
 }
 
+// SetCacheRecordingDegraded reports whether fetched artifacts are failing
+// to be recorded in the database.
+func SetCacheRecordingDegraded(degraded bool) {
+	if degraded {
+		CacheRecordingDegraded.Set(1)
+	} else {
+		CacheRecordingDegraded.Set(0)
+	}
+}
+
 // UpdateCacheStats updates cache size and artifact count gauges.
 func UpdateCacheStats(sizeBytes, artifactCount int64) {
 	CacheSize.Set(float64(sizeBytes))
 	CachedArtifacts.Set(float64(artifactCount))
 }
 
+var (
+	ecosystemStatsMu       sync.Mutex
+	ecosystemStatsReported map[string]bool
+)
+
+// EcosystemCacheStats is one ecosystem's share of the cache.
+type EcosystemCacheStats struct {
+	Ecosystem string
+	Artifacts int64
+	SizeBytes int64
+	Hits      int64
+}
+
+// UpdateEcosystemCacheStats replaces the per-ecosystem cache gauges with
+// stats. Ecosystems missing from stats, such as ones whose artifacts were
+// all evicted, are dropped rather than left at their last value.
+func UpdateEcosystemCacheStats(stats []EcosystemCacheStats) {
+	ecosystemStatsMu.Lock()
+	defer ecosystemStatsMu.Unlock()
+
+	seen := make(map[string]bool, len(stats))
+	for _, s := range stats {
+		seen[s.Ecosystem] = true
+		EcosystemCachedArtifacts.WithLabelValues(s.Ecosystem).Set(float64(s.Artifacts))
+		EcosystemCacheSize.WithLabelValues(s.Ecosystem).Set(float64(s.SizeBytes))
+		EcosystemCacheHits.WithLabelValues(s.Ecosystem).Set(float64(s.Hits))
+	}
+	for ecosystem := range ecosystemStatsReported {
+		if !seen[ecosystem] {
+			EcosystemCachedArtifacts.DeleteLabelValues(ecosystem)
+			EcosystemCacheSize.DeleteLabelValues(ecosystem)
+			EcosystemCacheHits.DeleteLabelValues(ecosystem)
+		}
+	}
+	ecosystemStatsReported = seen
+}
+
 // UpdateCircuitBreakerState updates circuit breaker state gauge.
 // state: 0=closed, 1=half-open, 2=open
 func UpdateCircuitBreakerState(registry string, state int) {
@@ -1,6 +1,12 @@
 package metrics
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -234,3 +240,39 @@ func TestMetricNames(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildInfoScrape(t *testing.T) {
+	SetBuildInfo("1.2.3", "abc1234")
+
+	srv := httptest.NewServer(Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("scraping metrics: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading metrics: %v", err)
+	}
+	out := string(body)
+
+	wantInfo := fmt.Sprintf(`proxy_build_info{commit="abc1234",go_version=%q,version="1.2.3"} 1`, runtime.Version())
+	if !strings.Contains(out, wantInfo) {
+		t.Errorf("metrics output missing %s", wantInfo)
+	}
+
+	var startTime float64
+	for _, line := range strings.Split(out, "\n") {
+		if v, ok := strings.CutPrefix(line, "proxy_start_time_seconds "); ok {
+			startTime, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatalf("parsing start time %q: %v", v, err)
+			}
+		}
+	}
+	if startTime <= 0 || startTime > float64(time.Now().UnixNano())/1e9 {
+		t.Errorf("proxy_start_time_seconds = %v, want a past unix time", startTime)
+	}
+}
@@ -1,21 +1,33 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	shared "github.com/git-pkgs/enrichment"
 	"github.com/git-pkgs/proxy/internal/database"
 	"github.com/git-pkgs/proxy/internal/enrichment"
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/proxy/internal/storage"
 	"github.com/git-pkgs/purl"
 	"github.com/go-chi/chi/v5"
 )
 
 const (
-	maxBodySize            = 1 << 20 // 1 MB
+	maxBodySize            = 1 << 20 // 1 MB, default request body limit
+	defaultMaxItems        = 500
+	defaultPageSize        = 50
+	defaultMaxPageSize     = 200
 	licenseCategoryUnknown = "unknown"
 	defaultSortBy          = "hits"
+
+	defaultPolicyEventsLimit = 100
+	maxPolicyEventsLimit     = 1000
 )
 
 // APIHandler provides REST endpoints for package enrichment data.
@@ -23,6 +35,26 @@ type APIHandler struct {
 	enrichment *enrichment.Service
 	ecosystems *shared.EcosystemsClient
 	db         DBSearcher
+	// storage holds cached artifacts, read for their manifests by the
+	// deps endpoint. It is unavailable when nil.
+	storage storage.Storage
+
+	// ecosystemsErr is why the ecosystems client couldn't be created.
+	// Bulk lookups then go to each package's registry instead.
+	ecosystemsErr error
+
+	// maxBodySize and maxItems bound the POST request bodies.
+	maxBodySize int64
+	maxItems    int
+
+	// pageSize and maxPageSize are the default and largest per_page for
+	// the package list and search endpoints.
+	pageSize    int
+	maxPageSize int
+
+	// metadataTTL returns how long cached metadata stays fresh, to flag
+	// stale documents. Nil reports none as stale.
+	metadataTTL func(ecosystem, cacheKey string) time.Duration
 }
 
 // DBSearcher defines the interface for database search operations.
@@ -31,17 +63,34 @@ type DBSearcher interface {
 	CountSearchResults(query string, ecosystem string) (int64, error)
 	ListCachedPackages(ecosystem string, sortBy string, limit int, offset int) ([]database.PackageListItem, error)
 	CountCachedPackages(ecosystem string) (int64, error)
+	ListPolicyEvents(ecosystem string, limit, offset int) ([]database.PolicyEvent, error)
+	GetUsageByTeam(from, to time.Time) ([]database.TeamUsage, error)
+	GetVersionsByPackagePURLSorted(packagePURL string) ([]database.Version, error)
+	GetCachedVersions(packagePURL string) ([]database.CachedVersion, error)
+	GetMetadataCacheForPackage(ecosystem, name string) ([]database.MetadataCacheEntry, error)
+	GetVersionByPURL(purl string) (*database.Version, error)
+	GetArtifactsByVersionPURL(versionPURL string) ([]database.Artifact, error)
+	SetVersionYanked(purl string, yanked bool) error
+	GetPackageByPURL(purl string) (*database.Package, error)
+	UpsertPackage(pkg *database.Package) error
+	FindNameCollisions() ([]database.NameCollision, error)
 }
 
 // NewAPIHandler creates a new API handler with enrichment services.
 func NewAPIHandler(svc *enrichment.Service, db DBSearcher) *APIHandler {
 	h := &APIHandler{
-		enrichment: svc,
-		db:         db,
+		enrichment:  svc,
+		db:          db,
+		maxBodySize: maxBodySize,
+		maxItems:    defaultMaxItems,
+		pageSize:    defaultPageSize,
+		maxPageSize: defaultMaxPageSize,
 	}
 	// Try to initialize ecosystems client for bulk lookups
 	if client, err := shared.NewEcosystemsClient(); err == nil {
 		h.ecosystems = client
+	} else {
+		h.ecosystemsErr = err
 	}
 	return h
 }
@@ -57,6 +106,8 @@ type PackageResponse struct {
 	Homepage        string `json:"homepage,omitempty"`
 	Repository      string `json:"repository,omitempty"`
 	RegistryURL     string `json:"registry_url,omitempty"`
+	SupplierName    string `json:"supplier_name,omitempty"`
+	SupplierType    string `json:"supplier_type,omitempty"`
 }
 
 // VersionResponse contains enriched version metadata.
@@ -125,6 +176,30 @@ type OutdatedResult struct {
 	IsOutdated    bool   `json:"is_outdated"`
 }
 
+// PackageVersionsResponse lists the versions the proxy knows about for a
+// package, and the package's cached metadata documents.
+type PackageVersionsResponse struct {
+	Ecosystem string                 `json:"ecosystem"`
+	Name      string                 `json:"name"`
+	Versions  []PackageVersionResult `json:"versions"`
+	Count     int                    `json:"count"`
+	Metadata  []MetadataFreshness    `json:"metadata,omitempty"`
+}
+
+// PackageVersionResult is one known version and whether it is cached.
+// FirstCachedAt stays fixed once an artifact is stored; LastFetchedAt moves
+// when it is downloaded again. Artifacts are immutable, so an old
+// LastFetchedAt is expected and not a sign of staleness.
+type PackageVersionResult struct {
+	Version       string `json:"version"`
+	PublishedAt   string `json:"published_at,omitempty"`
+	Yanked        bool   `json:"yanked"`
+	License       string `json:"license,omitempty"`
+	Cached        bool   `json:"cached"`
+	FirstCachedAt string `json:"first_cached_at,omitempty"`
+	LastFetchedAt string `json:"last_fetched_at,omitempty"`
+}
+
 // BulkRequest is the request body for bulk package lookups.
 type BulkRequest struct {
 	PURLs []string `json:"purls"`
@@ -180,7 +255,10 @@ func (h *APIHandler) HandlePackagePath(w http.ResponseWriter, r *http.Request) {
 			Homepage:        info.Homepage,
 			Repository:      info.Repository,
 			RegistryURL:     info.RegistryURL,
+			SupplierName:    info.SupplierName,
+			SupplierType:    info.SupplierType,
 		}
+		h.recordSupplier(ecosystem, fullName, info)
 		writeJSON(w, resp)
 		return
 	}
@@ -191,6 +269,18 @@ func (h *APIHandler) HandlePackagePath(w http.ResponseWriter, r *http.Request) {
 	h.getVersion(w, r, ecosystem, name, version)
 }
 
+// getPackage handles GET /api/package/{ecosystem}/{name}
+// @Summary Get package metadata
+// @Description Looks up a package in its upstream registry. Namespaced names (npm @scope/name, Composer vendor/name) keep their slash.
+// @Tags api
+// @Produce json
+// @Param ecosystem path string true "Ecosystem"
+// @Param name path string true "Package name"
+// @Success 200 {object} PackageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/package/{ecosystem}/{name} [get]
 func (h *APIHandler) getPackage(w http.ResponseWriter, r *http.Request, ecosystem, name string) {
 	info, err := h.enrichment.EnrichPackage(r.Context(), ecosystem, name)
 	if err != nil {
@@ -213,11 +303,44 @@ func (h *APIHandler) getPackage(w http.ResponseWriter, r *http.Request, ecosyste
 		Homepage:        info.Homepage,
 		Repository:      info.Repository,
 		RegistryURL:     info.RegistryURL,
+		SupplierName:    info.SupplierName,
+		SupplierType:    info.SupplierType,
 	}
+	h.recordSupplier(ecosystem, name, info)
 
 	writeJSON(w, resp)
 }
 
+// recordSupplier stores the enriched supplier on the package's row so the
+// package page can show it. Packages the proxy hasn't cached are left out
+// of the database; a lookup alone doesn't add them.
+func (h *APIHandler) recordSupplier(ecosystem, name string, info *enrichment.PackageInfo) {
+	if h.db == nil || info.SupplierName == "" {
+		return
+	}
+	pkg, err := h.db.GetPackageByPURL(purl.MakePURLString(ecosystem, handler.Canonicalize(ecosystem, name), ""))
+	if err != nil || pkg == nil {
+		return
+	}
+	if pkg.SupplierName.String == info.SupplierName && pkg.SupplierType.String == info.SupplierType {
+		return
+	}
+	pkg.SupplierName = sql.NullString{String: info.SupplierName, Valid: true}
+	pkg.SupplierType = sql.NullString{String: info.SupplierType, Valid: info.SupplierType != ""}
+	_ = h.db.UpsertPackage(pkg)
+}
+
+// getVersion handles GET /api/package/{ecosystem}/{name}/{version}
+// @Summary Get version metadata with vulnerabilities
+// @Tags api
+// @Produce json
+// @Param ecosystem path string true "Ecosystem"
+// @Param name path string true "Package name"
+// @Param version path string true "Version"
+// @Success 200 {object} EnrichmentResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/package/{ecosystem}/{name}/{version} [get]
 func (h *APIHandler) getVersion(w http.ResponseWriter, r *http.Request, ecosystem, name, version string) {
 	result, err := h.enrichment.EnrichFull(r.Context(), ecosystem, name, version)
 	if err != nil {
@@ -257,6 +380,11 @@ func (h *APIHandler) getVersion(w http.ResponseWriter, r *http.Request, ecosyste
 		if !result.Version.PublishedAt.IsZero() {
 			resp.Version.PublishedAt = result.Version.PublishedAt.Format("2006-01-02T15:04:05Z")
 		}
+		// Remember upstream's yanked status so the version page and the
+		// versions list show it without another lookup. Best effort.
+		if h.db != nil {
+			_ = h.db.SetVersionYanked(purl.MakePURLString(ecosystem, handler.Canonicalize(ecosystem, name), version), result.Version.Yanked)
+		}
 	}
 
 	for _, v := range result.Vulnerabilities {
@@ -273,8 +401,111 @@ func (h *APIHandler) getVersion(w http.ResponseWriter, r *http.Request, ecosyste
 	writeJSON(w, resp)
 }
 
+// HandleVersionsPath handles GET /api/versions/{ecosystem}/{name}. The
+// whole path after the ecosystem is the package name, so namespaced names
+// keep their slash.
+// @Summary List known versions of a package
+// @Description Lists every version the proxy has seen for a package, newest first by the ecosystem's version ordering, with whether any artifact for it is cached.
+// @Tags api
+// @Produce json
+// @Param ecosystem path string true "Ecosystem"
+// @Param name path string true "Package name"
+// @Success 200 {object} PackageVersionsResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/versions/{ecosystem}/{name} [get]
+func (h *APIHandler) HandleVersionsPath(w http.ResponseWriter, r *http.Request) {
+	ecosystem := chi.URLParam(r, "ecosystem")
+	wildcard := chi.URLParam(r, "*")
+	if err := validatePackagePath(wildcard); err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	segments := splitWildcardPath(wildcard)
+	if ecosystem == "" || len(segments) == 0 {
+		badRequest(w, "ecosystem and name are required")
+		return
+	}
+	name := strings.Join(segments, "/")
+
+	if h.db == nil {
+		internalError(w, "database unavailable")
+		return
+	}
+
+	pkgPURL := purl.MakePURLString(ecosystem, handler.Canonicalize(ecosystem, name), "")
+	versions, err := h.db.GetVersionsByPackagePURLSorted(pkgPURL)
+	if err != nil {
+		internalError(w, "failed to list versions")
+		return
+	}
+	if len(versions) == 0 {
+		notFound(w, "package not found")
+		return
+	}
+
+	cachedVersions, err := h.db.GetCachedVersions(pkgPURL)
+	if err != nil {
+		internalError(w, "failed to list cached versions")
+		return
+	}
+	cached := make(map[string]database.CachedVersion, len(cachedVersions))
+	for _, c := range cachedVersions {
+		cached[c.VersionPURL] = c
+	}
+
+	resp := &PackageVersionsResponse{
+		Ecosystem: ecosystem,
+		Name:      name,
+		Versions:  make([]PackageVersionResult, 0, len(versions)),
+	}
+	for _, v := range versions {
+		c, isCached := cached[v.PURL]
+		result := PackageVersionResult{
+			Version: v.Version(),
+			Yanked:  v.Yanked,
+			Cached:  isCached,
+		}
+		if v.PublishedAt.Valid {
+			result.PublishedAt = v.PublishedAt.Time.UTC().Format(time.RFC3339)
+		}
+		if v.License.Valid {
+			result.License = v.License.String
+		}
+		if isCached {
+			result.FirstCachedAt = c.FirstCachedAt.UTC().Format(time.RFC3339)
+			if c.LastFetchedAt.Valid {
+				result.LastFetchedAt = c.LastFetchedAt.Time.UTC().Format(time.RFC3339)
+			}
+		}
+		resp.Versions = append(resp.Versions, result)
+	}
+	resp.Count = len(resp.Versions)
+
+	entries, err := h.db.GetMetadataCacheForPackage(ecosystem, handler.Canonicalize(ecosystem, name))
+	if err != nil {
+		internalError(w, "failed to list cached metadata")
+		return
+	}
+	resp.Metadata = metadataFreshness(entries, h.metadataTTL, time.Now())
+
+	writeJSON(w, resp)
+}
+
 // HandleVulnsPath dispatches /api/vulns/{ecosystem}/* to the vulns handler.
 // Supports both {name} and {name}/{version} paths with namespaced package names.
+// @Summary List vulnerabilities
+// @Description Without a version, lists every known vulnerability for the package.
+// @Tags api
+// @Produce json
+// @Param ecosystem path string true "Ecosystem"
+// @Param name path string true "Package name"
+// @Param version path string true "Version"
+// @Success 200 {object} VulnsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/vulns/{ecosystem}/{name} [get]
+// @Router /api/vulns/{ecosystem}/{name}/{version} [get]
 func (h *APIHandler) HandleVulnsPath(w http.ResponseWriter, r *http.Request) {
 	ecosystem := chi.URLParam(r, "ecosystem")
 	wildcard := chi.URLParam(r, "*")
@@ -339,13 +570,13 @@ func (h *APIHandler) HandleVulnsPath(w http.ResponseWriter, r *http.Request) {
 // @Param request body OutdatedRequest true "Packages to check"
 // @Success 200 {object} OutdatedResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 504 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/outdated [post]
 func (h *APIHandler) HandleOutdated(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 	var req OutdatedRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		badRequest(w, "invalid request body")
+	if !decodeJSONBody(w, r, h.maxBodySize, &req) {
 		return
 	}
 
@@ -353,6 +584,9 @@ func (h *APIHandler) HandleOutdated(w http.ResponseWriter, r *http.Request) {
 		badRequest(w, "packages list is required")
 		return
 	}
+	if !checkItemLimit(w, "packages", len(req.Packages), h.maxItems) {
+		return
+	}
 
 	resp := OutdatedResponse{
 		Results: make([]OutdatedResult, 0, len(req.Packages)),
@@ -374,6 +608,9 @@ func (h *APIHandler) HandleOutdated(w http.ResponseWriter, r *http.Request) {
 		resp.Results = append(resp.Results, result)
 	}
 
+	if writeTimeoutIfExpired(w, r) {
+		return
+	}
 	writeJSON(w, resp)
 }
 
@@ -385,13 +622,13 @@ func (h *APIHandler) HandleOutdated(w http.ResponseWriter, r *http.Request) {
 // @Param request body BulkRequest true "PURLs"
 // @Success 200 {object} BulkResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 504 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/bulk [post]
 func (h *APIHandler) HandleBulkLookup(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 	var req BulkRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		badRequest(w, "invalid request body")
+	if !decodeJSONBody(w, r, h.maxBodySize, &req) {
 		return
 	}
 
@@ -399,64 +636,85 @@ func (h *APIHandler) HandleBulkLookup(w http.ResponseWriter, r *http.Request) {
 		badRequest(w, "purls list is required")
 		return
 	}
+	if !checkItemLimit(w, "purls", len(req.PURLs), h.maxItems) {
+		return
+	}
 
 	resp := BulkResponse{
 		Packages: make(map[string]*PackageResponse),
 	}
 
-	// Use ecosystems client for bulk lookup if available
+	// Use ecosystems client for bulk lookup if available, and fall back
+	// to the registries when it isn't or the lookup fails.
+	var packages map[string]*enrichment.PackageInfo
 	if h.ecosystems != nil {
-		packages, err := h.ecosystems.BulkLookup(r.Context(), req.PURLs)
+		results, err := h.ecosystems.BulkLookup(r.Context(), req.PURLs)
 		if err == nil {
-			for purl, info := range packages {
+			packages = make(map[string]*enrichment.PackageInfo, len(results))
+			for purlStr, info := range results {
 				if info != nil {
-					resp.Packages[purl] = &PackageResponse{
-						Ecosystem:       info.Ecosystem,
-						Name:            info.Name,
-						LatestVersion:   info.LatestVersion,
-						License:         info.License,
-						LicenseCategory: string(h.enrichment.CategorizeLicense(info.License)),
-						Description:     info.Description,
-						Homepage:        info.Homepage,
-						Repository:      info.Repository,
-						RegistryURL:     info.RegistryURL,
+					packages[purlStr] = &enrichment.PackageInfo{
+						Ecosystem:     info.Ecosystem,
+						Name:          info.Name,
+						LatestVersion: info.LatestVersion,
+						License:       info.License,
+						Description:   info.Description,
+						Homepage:      info.Homepage,
+						Repository:    info.Repository,
+						RegistryURL:   info.RegistryURL,
 					}
 				}
 			}
 		}
-	} else {
-		// Fall back to individual lookups via registries
-		packages := make([]struct{ Ecosystem, Name string }, 0, len(req.PURLs))
+	}
+	if packages == nil {
+		packages = h.bulkLookupFromRegistries(r.Context(), req.PURLs)
+	}
 
-		for _, purlStr := range req.PURLs {
-			p, err := purl.Parse(purlStr)
-			if err != nil {
-				continue
-			}
-			ecosystem := purl.PURLTypeToEcosystem(p.Type)
-			name := p.FullName()
-			packages = append(packages, struct{ Ecosystem, Name string }{ecosystem, name})
+	for purlStr, info := range packages {
+		resp.Packages[purlStr] = &PackageResponse{
+			Ecosystem:       info.Ecosystem,
+			Name:            info.Name,
+			LatestVersion:   info.LatestVersion,
+			License:         info.License,
+			LicenseCategory: string(h.enrichment.CategorizeLicense(info.License)),
+			Description:     info.Description,
+			Homepage:        info.Homepage,
+			Repository:      info.Repository,
+			RegistryURL:     info.RegistryURL,
+			SupplierName:    info.SupplierName,
+			SupplierType:    info.SupplierType,
 		}
+	}
 
-		results := h.enrichment.BulkEnrichPackages(r.Context(), packages)
-		for purlStr, info := range results {
-			if info != nil {
-				resp.Packages[purlStr] = &PackageResponse{
-					Ecosystem:       info.Ecosystem,
-					Name:            info.Name,
-					LatestVersion:   info.LatestVersion,
-					License:         info.License,
-					LicenseCategory: string(h.enrichment.CategorizeLicense(info.License)),
-					Description:     info.Description,
-					Homepage:        info.Homepage,
-					Repository:      info.Repository,
-					RegistryURL:     info.RegistryURL,
-				}
-			}
+	if writeTimeoutIfExpired(w, r) {
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// bulkLookupFromRegistries looks each package up in its own registry.
+// Results are keyed by the unversioned package PURL.
+func (h *APIHandler) bulkLookupFromRegistries(ctx context.Context, purls []string) map[string]*enrichment.PackageInfo {
+	packages := make([]struct{ Ecosystem, Name string }, 0, len(purls))
+
+	for _, purlStr := range purls {
+		p, err := purl.Parse(purlStr)
+		if err != nil {
+			continue
 		}
+		ecosystem := purl.PURLTypeToEcosystem(p.Type)
+		name := p.FullName()
+		packages = append(packages, struct{ Ecosystem, Name string }{ecosystem, name})
 	}
 
-	writeJSON(w, resp)
+	results := h.enrichment.BulkEnrichPackages(ctx, packages)
+	for purlStr, info := range results {
+		if info == nil {
+			delete(results, purlStr)
+		}
+	}
+	return results
 }
 
 // SearchResponse contains search results.
@@ -483,6 +741,8 @@ type SearchPackageResult struct {
 // @Produce json
 // @Param q query string true "Query"
 // @Param ecosystem query string false "Ecosystem"
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Results per page, clamped to api.max_page_size"
 // @Success 200 {object} SearchResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -496,8 +756,7 @@ func (h *APIHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	page := 1
-	limit := 50
+	page, limit := pagination(r, h.pageSize, h.maxPageSize)
 
 	// Search in database
 	results, err := h.db.SearchPackages(query, ecosystem, limit, (page-1)*limit)
@@ -543,6 +802,25 @@ func (h *APIHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, resp)
 }
 
+// pagination reads the page and per_page query parameters. Missing or
+// invalid values fall back to page 1 and pageSize; per_page above
+// maxPageSize is clamped to it.
+func pagination(r *http.Request, pageSize, maxPageSize int) (page, limit int) {
+	page = 1
+	if v := r.URL.Query().Get("page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			page = n
+		}
+	}
+	limit = pageSize
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	return page, min(limit, maxPageSize)
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(v); err != nil {
@@ -580,6 +858,8 @@ type PackageListResult struct {
 // @Produce json
 // @Param ecosystem query string false "Ecosystem"
 // @Param sort query string false "Sort" Enums(hits,name,size,cached_at,ecosystem,vulns)
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Results per page, clamped to api.max_page_size"
 // @Success 200 {object} PackagesListResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -604,8 +884,7 @@ func (h *APIHandler) HandlePackagesList(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	page := 1
-	limit := 50
+	page, limit := pagination(r, h.pageSize, h.maxPageSize)
 
 	packages, err := h.db.ListCachedPackages(ecosystem, sortBy, limit, (page-1)*limit)
 	if err != nil {
@@ -661,3 +940,87 @@ func (h *APIHandler) HandlePackagesList(w http.ResponseWriter, r *http.Request)
 
 	writeJSON(w, resp)
 }
+
+// PolicyEventsResponse contains recorded policy decisions, newest first.
+type PolicyEventsResponse struct {
+	Events    []PolicyEventResult `json:"events"`
+	Count     int                 `json:"count"`
+	Ecosystem string              `json:"ecosystem,omitempty"`
+	Limit     int                 `json:"limit"`
+	Offset    int                 `json:"offset"`
+}
+
+// PolicyEventResult represents a single policy decision.
+type PolicyEventResult struct {
+	Timestamp string `json:"timestamp"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	Decision  string `json:"decision"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// HandlePolicyEvents handles GET /api/policy-events
+// @Summary List policy decision audit events
+// @Description Events carry the client IP of the refused request, so this is only served when admin.token is set; send it as a bearer token.
+// @Tags api
+// @Produce json
+// @Param ecosystem query string false "Ecosystem"
+// @Param limit query int false "Maximum events to return (default 100, max 1000)"
+// @Param offset query int false "Number of events to skip"
+// @Success 200 {object} PolicyEventsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/policy-events [get]
+func (h *APIHandler) HandlePolicyEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ecosystem := q.Get("ecosystem")
+
+	limit := defaultPolicyEventsLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPolicyEventsLimit {
+			badRequest(w, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			badRequest(w, "offset must be a non-negative integer")
+			return
+		}
+		offset = n
+	}
+
+	events, err := h.db.ListPolicyEvents(ecosystem, limit, offset)
+	if err != nil {
+		internalError(w, "failed to list policy events")
+		return
+	}
+	resp := &PolicyEventsResponse{
+		Events:    make([]PolicyEventResult, 0, len(events)),
+		Count:     len(events),
+		Ecosystem: ecosystem,
+		Limit:     limit,
+		Offset:    offset,
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, PolicyEventResult{
+			Timestamp: e.CreatedAt.UTC().Format(time.RFC3339),
+			ClientIP:  e.ClientIP,
+			Ecosystem: e.Ecosystem,
+			Name:      e.Name,
+			Version:   e.Version,
+			Decision:  e.Decision,
+			Reason:    e.Reason,
+		})
+	}
+
+	writeJSON(w, resp)
+}
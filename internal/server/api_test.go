@@ -4,16 +4,25 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-pkgs/proxy/internal/database"
 	"github.com/git-pkgs/proxy/internal/enrichment"
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/proxy/internal/storage"
+	"github.com/git-pkgs/registries"
+	"github.com/git-pkgs/registries/fetch"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -32,6 +41,39 @@ func TestNewAPIHandler(t *testing.T) {
 	}
 }
 
+// A package whose name ends in "versions" or "deps" is looked up like any
+// other; those listings have routes of their own.
+func TestHandlePackagePath_SubEndpointNames(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"_id": %q, "name": %q, "dist-tags": {"latest": "1.0.0"}, "versions": {"1.0.0": {}}}`, name, name)
+	}))
+	defer upstream.Close()
+
+	regClient := registries.NewClient(registries.WithMaxRetries(0))
+	regClient.HTTPClient = &http.Client{Transport: redirectTransport{target: upstream.URL}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewAPIHandler(enrichment.New(logger, enrichment.WithRegistryClient(regClient)), nil)
+	r := chi.NewRouter()
+	r.Get("/api/package/{ecosystem}/*", h.HandlePackagePath)
+
+	for _, name := range []string{"@acme/versions", "@acme/deps"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/package/npm/"+name, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want 200; body: %s", name, w.Code, w.Body.String())
+		}
+		var resp PackageResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if resp.Name != name || resp.LatestVersion != "1.0.0" {
+			t.Errorf("GET %s = %s %s, want %s 1.0.0", name, resp.Name, resp.LatestVersion, name)
+		}
+	}
+}
+
 func TestHandlePackagePath_MissingParams(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	svc := enrichment.New(logger)
@@ -114,17 +156,103 @@ func TestHandleOutdated_OversizedBody(t *testing.T) {
 	svc := enrichment.New(logger)
 	h := NewAPIHandler(svc, nil)
 
-	// Send a body larger than 1 MB
-	body := make([]byte, 2<<20)
-	for i := range body {
-		body[i] = 'x'
-	}
+	// Send a well-formed body larger than 1 MB
+	body := oversizedPackagesBody(2 << 20)
 	req := httptest.NewRequest("POST", "/api/outdated", bytes.NewReader(body))
 	w := httptest.NewRecorder()
 	h.HandleOutdated(w, req)
 
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d for oversized body, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	if resp.Code != ErrCodePayloadTooLarge {
+		t.Errorf("code = %q, want %q", resp.Code, ErrCodePayloadTooLarge)
+	}
+}
+
+// oversizedPackagesBody returns valid JSON of at least size bytes, so the
+// decoder hits the body limit rather than a syntax error.
+func oversizedPackagesBody(size int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"packages":[`)
+	for b.Len() < size {
+		b.WriteString(`{"ecosystem":"npm","name":"lodash","version":"4.17.21"},`)
+	}
+	b.WriteString(`{"ecosystem":"npm","name":"lodash","version":"4.17.21"}]}`)
+	return b.Bytes()
+}
+
+func TestHandleOutdated_TooManyPackages(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := enrichment.New(logger)
+	h := NewAPIHandler(svc, nil)
+	h.maxItems = 2
+
+	body := `{"packages":[{"ecosystem":"npm","name":"a","version":"1.0.0"},{"ecosystem":"npm","name":"b","version":"1.0.0"},{"ecosystem":"npm","name":"c","version":"1.0.0"}]}`
+	req := httptest.NewRequest("POST", "/api/outdated", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.HandleOutdated(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "too many packages") {
+		t.Errorf("body = %s, want a message naming the limit", w.Body.String())
+	}
+}
+
+func TestHandleBulkLookup_TooManyPURLs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := enrichment.New(logger)
+	h := NewAPIHandler(svc, nil)
+	h.maxItems = 1
+
+	req := httptest.NewRequest("POST", "/api/bulk", strings.NewReader(`{"purls":["pkg:npm/a","pkg:npm/b"]}`))
+	w := httptest.NewRecorder()
+	h.HandleBulkLookup(w, req)
+
 	if w.Code != http.StatusBadRequest {
-		t.Errorf("expected status %d for oversized body, got %d", http.StatusBadRequest, w.Code)
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "too many purls") {
+		t.Errorf("body = %s, want a message naming the limit", w.Body.String())
+	}
+}
+
+func TestHandleBulkLookup_OversizedBody(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := enrichment.New(logger)
+	h := NewAPIHandler(svc, nil)
+	h.maxBodySize = 64
+
+	body := `{"purls":["pkg:npm/` + strings.Repeat("a", 100) + `"]}`
+	req := httptest.NewRequest("POST", "/api/bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.HandleBulkLookup(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	handler := requestTimeout(time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		if writeTimeoutIfExpired(w, r) {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/api/outdated", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusGatewayTimeout, w.Code)
 	}
 }
 
@@ -489,3 +617,404 @@ func TestHandlePackagesListAPI_InvalidSort(t *testing.T) {
 		t.Errorf("expected status 400 for invalid sort, got %d", w.Code)
 	}
 }
+
+func TestListEndpointsPageSize(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	for i := range 5 {
+		name := "page-size-" + string(rune('a'+i))
+		pkg := &database.Package{PURL: "pkg:npm/" + name, Ecosystem: testEcosystemNPM, Name: name}
+		if err := db.UpsertPackage(pkg); err != nil {
+			t.Fatalf("UpsertPackage failed: %v", err)
+		}
+		ver := &database.Version{PURL: pkg.PURL + "@1.0.0", PackagePURL: pkg.PURL}
+		if err := db.UpsertVersion(ver); err != nil {
+			t.Fatalf("UpsertVersion failed: %v", err)
+		}
+		art := &database.Artifact{
+			VersionPURL: ver.PURL,
+			Filename:    name + "-1.0.0.tgz",
+			UpstreamURL: "https://registry.npmjs.org/" + name + "/-/" + name + "-1.0.0.tgz",
+			StoragePath: sql.NullString{String: "/tmp/test.tgz", Valid: true},
+		}
+		if err := db.UpsertArtifact(art); err != nil {
+			t.Fatalf("UpsertArtifact failed: %v", err)
+		}
+	}
+
+	h := NewAPIHandler(enrichment.New(slog.New(slog.NewTextHandler(io.Discard, nil))), db)
+	h.pageSize = 2
+	h.maxPageSize = 3
+
+	r := chi.NewRouter()
+	r.Get("/api/packages", h.HandlePackagesList)
+	r.Get("/api/search", h.HandleSearch)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"default", "", 2},
+		{"within bounds", "per_page=1", 1},
+		{"at max", "per_page=3", 3},
+		{"over max", "per_page=100", 3},
+		{"invalid", "per_page=abc", 2},
+		{"last page", "per_page=3&page=2", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/api/packages?"+tt.query, nil))
+			var list PackagesListResponse
+			if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+				t.Fatalf("decoding /api/packages: %v", err)
+			}
+			if len(list.Results) != tt.want {
+				t.Errorf("/api/packages returned %d results, want %d", len(list.Results), tt.want)
+			}
+			if list.Total != 5 {
+				t.Errorf("/api/packages total = %d, want 5", list.Total)
+			}
+
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/api/search?q=page-size&"+tt.query, nil))
+			var search SearchResponse
+			if err := json.NewDecoder(w.Body).Decode(&search); err != nil {
+				t.Fatalf("decoding /api/search: %v", err)
+			}
+			if len(search.Results) != tt.want {
+				t.Errorf("/api/search returned %d results, want %d", len(search.Results), tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePolicyEvents(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	store, err := storage.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystem failed: %v", err)
+	}
+
+	proxy := handler.NewProxy(db, store, fetch.NewFetcher(), fetch.NewResolver(), logger)
+	proxy.GradleReadOnly = true
+
+	h := NewAPIHandler(enrichment.New(logger), db)
+	r := chi.NewRouter()
+	r.Mount("/gradle", http.StripPrefix("/gradle", handler.NewGradleBuildCacheHandler(proxy).Routes()))
+	r.Get("/api/policy-events", h.HandlePolicyEvents)
+
+	req := httptest.NewRequest(http.MethodPut, "/gradle/deadbeef", strings.NewReader("payload"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/policy-events?ecosystem=gradle", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var resp PolicyEventsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Count != 1 || len(resp.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(resp.Events))
+	}
+	e := resp.Events[0]
+	if e.Name != "deadbeef" || e.Decision != handler.PolicyDecisionDeny {
+		t.Errorf("event = %+v", e)
+	}
+	if e.Reason != "gradle build cache is read-only" {
+		t.Errorf("reason = %q", e.Reason)
+	}
+}
+
+func TestHandlePolicyEvents_RequiresAdminToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	for _, tc := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong-token", http.StatusUnauthorized},
+		{"Bearer " + testAdminToken, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/policy-events", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("Authorization %q: status = %d, want %d", tc.auth, w.Code, tc.want)
+		}
+	}
+}
+
+func TestHandlePolicyEventsInvalidLimit(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	h := NewAPIHandler(nil, db)
+	req := httptest.NewRequest(http.MethodGet, "/api/policy-events?limit=0", nil)
+	w := httptest.NewRecorder()
+	h.HandlePolicyEvents(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlePackageVersions(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	pkg := &database.Package{PURL: "pkg:npm/lodash", Ecosystem: testEcosystemNPM, Name: "lodash"}
+	if err := db.UpsertPackage(pkg); err != nil {
+		t.Fatalf("UpsertPackage failed: %v", err)
+	}
+	for _, v := range []string{"1.9.0", "2.0.0-beta.1", "1.10.0", "2.0.0"} {
+		ver := &database.Version{
+			PURL:        "pkg:npm/lodash@" + v,
+			PackagePURL: pkg.PURL,
+			License:     sql.NullString{String: "MIT", Valid: true},
+			Yanked:      v == "1.9.0",
+		}
+		if err := db.UpsertVersion(ver); err != nil {
+			t.Fatalf("UpsertVersion failed: %v", err)
+		}
+	}
+	for _, a := range []*database.Artifact{
+		{
+			VersionPURL: "pkg:npm/lodash@1.10.0",
+			Filename:    "lodash-1.10.0.tgz",
+			UpstreamURL: "https://registry.npmjs.org/lodash/-/lodash-1.10.0.tgz",
+			StoragePath: sql.NullString{String: "npm/lodash/1.10.0/lodash-1.10.0.tgz", Valid: true},
+		},
+		{
+			// Known but not stored: doesn't count as cached.
+			VersionPURL: "pkg:npm/lodash@2.0.0",
+			Filename:    "lodash-2.0.0.tgz",
+			UpstreamURL: "https://registry.npmjs.org/lodash/-/lodash-2.0.0.tgz",
+		},
+	} {
+		if err := db.UpsertArtifact(a); err != nil {
+			t.Fatalf("UpsertArtifact failed: %v", err)
+		}
+	}
+
+	h := NewAPIHandler(nil, db)
+	r := chi.NewRouter()
+	r.Get("/api/versions/{ecosystem}/*", h.HandleVersionsPath)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/versions/npm/lodash", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var resp PackageVersionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := []struct {
+		version string
+		cached  bool
+	}{
+		{"2.0.0", false},
+		{"2.0.0-beta.1", false},
+		{"1.10.0", true},
+		{"1.9.0", false},
+	}
+	if resp.Count != len(want) || len(resp.Versions) != len(want) {
+		t.Fatalf("got %d versions, want %d", len(resp.Versions), len(want))
+	}
+	for i, wv := range want {
+		got := resp.Versions[i]
+		if got.Version != wv.version || got.Cached != wv.cached {
+			t.Errorf("versions[%d] = %s cached=%v, want %s cached=%v", i, got.Version, got.Cached, wv.version, wv.cached)
+		}
+		if got.License != "MIT" {
+			t.Errorf("versions[%d].License = %q, want MIT", i, got.License)
+		}
+	}
+	if !resp.Versions[3].Yanked {
+		t.Error("expected 1.9.0 to be reported as yanked")
+	}
+
+	// Yanked status recorded after the fact is reported too.
+	if err := db.SetVersionYanked("pkg:npm/lodash@2.0.0", true); err != nil {
+		t.Fatalf("SetVersionYanked failed: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/versions/npm/lodash", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	resp = PackageVersionsResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.Versions[0].Yanked {
+		t.Error("expected 2.0.0 to be reported as yanked after SetVersionYanked")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/versions/npm/unknown", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown package status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// redirectTransport sends every request to a test server, whatever host
+// it was addressed to.
+type redirectTransport struct {
+	target string
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(rt.target)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = u.Scheme
+	req.URL.Host = u.Host
+	req.Host = u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHandleBulkLookup_FallbackWithoutEcosystems(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lodash" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{
+			"_id": "lodash",
+			"name": "lodash",
+			"dist-tags": {"latest": "4.17.21"},
+			"versions": {"4.17.21": {"name": "lodash", "version": "4.17.21", "license": "MIT", "description": "Lodash modular utilities."}}
+		}`)
+	}))
+	defer upstream.Close()
+
+	regClient := registries.NewClient(registries.WithMaxRetries(0))
+	regClient.HTTPClient = &http.Client{Transport: redirectTransport{target: upstream.URL}}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := enrichment.New(logger, enrichment.WithRegistryClient(regClient))
+	h := NewAPIHandler(svc, nil)
+	h.ecosystems = nil
+	h.ecosystemsErr = errors.New("ecosystems unavailable")
+
+	body := `{"purls":["pkg:npm/lodash@4.17.20","pkg:npm/does-not-exist"]}`
+	req := httptest.NewRequest("POST", "/api/bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.HandleBulkLookup(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body.String())
+	}
+	var resp BulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resp.Packages) != 1 {
+		t.Fatalf("got %d packages, want 1: %+v", len(resp.Packages), resp.Packages)
+	}
+	pkg := resp.Packages["pkg:npm/lodash"]
+	if pkg == nil {
+		t.Fatal("missing result for pkg:npm/lodash")
+	}
+	if pkg.LatestVersion != "4.17.21" {
+		t.Errorf("latest_version = %q, want 4.17.21", pkg.LatestVersion)
+	}
+	if pkg.License != "MIT" || pkg.LicenseCategory != "permissive" {
+		t.Errorf("license = %q (%s), want MIT (permissive)", pkg.License, pkg.LicenseCategory)
+	}
+}
+
+func TestGetPackageRecordsSupplier(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{
+			"_id": "test",
+			"name": "test",
+			"dist-tags": {"latest": "1.0.0"},
+			"maintainers": [{"name": "jdoe", "email": "jdoe@example.com"}],
+			"versions": {"1.0.0": {"name": "test", "version": "1.0.0", "license": "MIT"}}
+		}`)
+	}))
+	defer upstream.Close()
+
+	ts := newTestServer(t)
+	defer ts.close()
+	seedTestPackage(t, ts.db, "test")
+
+	regClient := registries.NewClient(registries.WithMaxRetries(0))
+	regClient.HTTPClient = &http.Client{Transport: redirectTransport{target: upstream.URL}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewAPIHandler(enrichment.New(logger, enrichment.WithRegistryClient(regClient)), ts.db)
+
+	w := httptest.NewRecorder()
+	h.getPackage(w, httptest.NewRequest("GET", "/api/package/npm/test", nil), "npm", "test")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body.String())
+	}
+	var resp PackageResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.SupplierName != "jdoe" || resp.SupplierType != enrichment.SupplierPerson {
+		t.Errorf("supplier = %q/%q, want jdoe/person", resp.SupplierName, resp.SupplierType)
+	}
+
+	pkg, err := ts.db.GetPackageByPURL("pkg:npm/test")
+	if err != nil || pkg == nil {
+		t.Fatalf("GetPackageByPURL = %v, %v", pkg, err)
+	}
+	if pkg.SupplierName.String != "jdoe" || pkg.SupplierType.String != enrichment.SupplierPerson {
+		t.Errorf("stored supplier = %q/%q, want jdoe/person", pkg.SupplierName.String, pkg.SupplierType.String)
+	}
+
+	page := httptest.NewRecorder()
+	ts.handler.ServeHTTP(page, httptest.NewRequest("GET", "/ui/package/npm/test", nil))
+	if page.Code != http.StatusOK {
+		t.Fatalf("package page status = %d, want 200", page.Code)
+	}
+	if body := page.Body.String(); !strings.Contains(body, "Supplier:") || !strings.Contains(body, "jdoe") {
+		t.Error("package page doesn't show the supplier")
+	}
+}
@@ -2,15 +2,18 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/git-pkgs/archives"
 	"github.com/git-pkgs/archives/diff"
 	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/handler"
 	"github.com/git-pkgs/purl"
 	"github.com/go-chi/chi/v5"
 )
@@ -25,10 +28,14 @@ const maxBrowseArchiveSize = 512 << 20 // 512 MB
 // archiveFilename returns a filename suitable for archive format detection.
 // Some ecosystems (e.g. composer) store artifacts with bare hash filenames
 // that have no extension. This adds .zip when the original has no extension
-// and the content is likely a zip archive.
+// and the content is likely a zip archive. Cargo's .crate files are gzipped
+// tarballs under another name, so they get .tar.gz.
 func archiveFilename(filename string) string {
-	if path.Ext(filename) == "" {
+	switch path.Ext(filename) {
+	case "":
 		return filename + ".zip"
+	case ".crate":
+		return filename + ".tar.gz"
 	}
 	return filename
 }
@@ -78,23 +85,140 @@ func openArchive(filename string, content io.Reader, ecosystem string) (archives
 	}
 
 	if ecosystem == "npm" {
-		return archives.OpenBytesWithPrefix(fname, data, "package/")
+		reader, err := archives.OpenBytesWithPrefix(fname, data, "package/")
+		if err != nil {
+			return nil, err
+		}
+		return &safeArchive{Reader: reader}, nil
 	}
 
 	probe, err := archives.OpenBytes(fname, data)
 	if err != nil {
 		return nil, err
 	}
-	prefix := detectSingleRootDir(probe)
+	prefix := detectSingleRootDir(&safeArchive{Reader: probe})
 	_ = probe.Close()
 
-	return archives.OpenBytesWithPrefix(fname, data, prefix)
+	reader, err := archives.OpenBytesWithPrefix(fname, data, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &safeArchive{Reader: reader}, nil
+}
+
+// errUnsafeArchivePath is returned for paths that are absolute or climb out
+// of the archive root.
+var errUnsafeArchivePath = errors.New("path escapes archive root")
+
+// isUnsafeArchivePath reports whether p is absolute (including Windows drive
+// and UNC forms) or has a ".." segment. Backslashes count as separators, as
+// zip files written on Windows often use them.
+func isUnsafeArchivePath(p string) bool {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return true
+	}
+	for seg := range strings.SplitSeq(p, "/") {
+		if seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// safeArchive wraps an archive reader so crafted entry names such as
+// "../../etc/passwd" or "/etc/passwd" never reach clients. Such entries are
+// dropped from listings, and requests for paths outside the archive root
+// fail with errUnsafeArchivePath before reaching the underlying reader.
+type safeArchive struct {
+	archives.Reader
+}
+
+func (a *safeArchive) List() ([]archives.FileInfo, error) {
+	files, err := a.Reader.List()
+	if err != nil {
+		return nil, err
+	}
+	return dropUnsafeEntries(files), nil
+}
+
+// ListDir accepts "" or "/" for the root, as the underlying readers do, so
+// leading slashes are not treated as absolute here.
+func (a *safeArchive) ListDir(dirPath string) ([]archives.FileInfo, error) {
+	if isUnsafeArchivePath(strings.TrimLeft(dirPath, "/")) {
+		return nil, errUnsafeArchivePath
+	}
+	files, err := a.Reader.ListDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return dropUnsafeEntries(files), nil
+}
+
+func (a *safeArchive) Extract(filePath string) (io.ReadCloser, error) {
+	if isUnsafeArchivePath(filePath) {
+		return nil, errUnsafeArchivePath
+	}
+	return a.Reader.Extract(filePath)
+}
+
+func dropUnsafeEntries(files []archives.FileInfo) []archives.FileInfo {
+	safe := files[:0]
+	for _, f := range files {
+		if !isUnsafeArchivePath(f.Path) {
+			safe = append(safe, f)
+		}
+	}
+	return safe
 }
 
 // BrowseListResponse contains the file listing for a directory in an archives.
 type BrowseListResponse struct {
-	Path  string           `json:"path"`
-	Files []BrowseFileInfo `json:"files"`
+	Path   string           `json:"path"`
+	Source BrowseSource     `json:"source"`
+	Files  []BrowseFileInfo `json:"files"`
+}
+
+// BrowseSource identifies the cached artifact a browse or compare response
+// was read from, so clients can tell which archive they are looking at when
+// a version has more than one (e.g. an sdist and several wheels).
+type BrowseSource struct {
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size,omitempty"`
+	FetchedAt string `json:"fetched_at,omitempty"`
+}
+
+func newBrowseSource(a *database.Artifact) BrowseSource {
+	src := BrowseSource{Filename: a.Filename}
+	if a.Size.Valid {
+		src.Size = a.Size.Int64
+	}
+	if a.FetchedAt.Valid {
+		src.FetchedAt = a.FetchedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return src
+}
+
+// selectCachedArtifact picks the artifact to browse. With no filename it
+// returns the first cached artifact; otherwise it returns the cached artifact
+// with that filename. When nothing matches it returns nil and a message
+// suitable for a 404 response.
+func selectCachedArtifact(artifacts []database.Artifact, filename string) (*database.Artifact, string) {
+	for i := range artifacts {
+		if filename != "" && artifacts[i].Filename != filename {
+			continue
+		}
+		if artifacts[i].StoragePath.Valid {
+			return &artifacts[i], ""
+		}
+		if filename != "" {
+			return nil, "artifact not cached"
+		}
+	}
+	if filename != "" {
+		return nil, "artifact not found"
+	}
+	return nil, "artifact not cached"
 }
 
 // BrowseFileInfo contains metadata about a file in an archives.
@@ -109,14 +233,16 @@ type BrowseFileInfo struct {
 // handleBrowseList returns a list of files in a directory within an archived package version.
 // GET /api/browse/{ecosystem}/{name}/{version}?path=/some/dir
 // @Summary List files inside a cached artifact
-// @Description Lists files from the first cached artifact for a package version.
+// @Description Lists files from a cached artifact for a package version. Uses the first cached artifact unless artifact is given.
 // @Tags browse
 // @Produce json
 // @Param ecosystem path string true "Ecosystem"
 // @Param name path string true "Package name"
 // @Param version path string true "Version"
 // @Param path query string false "Directory path inside the archive"
+// @Param artifact query string false "Filename of the cached artifact to browse"
 // @Success 200 {object} BrowseListResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /ui/api/browse/{ecosystem}/{name}/{version} [get]
@@ -127,6 +253,8 @@ type BrowseFileInfo struct {
 //
 //	{name}/{version}              -> browse list
 //	{name}/{version}/file/{path}  -> browse file
+//	{name}/{version}/archive      -> repackaged directory
+//	{name}/{version}/tree         -> recursive file tree
 func (s *Server) handleBrowsePath(w http.ResponseWriter, r *http.Request) {
 	ecosystem := chi.URLParam(r, "ecosystem")
 	wildcard := chi.URLParam(r, "*")
@@ -168,6 +296,30 @@ func (s *Server) handleBrowsePath(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Trailing /archive repackages a directory as a zip or tar.gz, and
+	// trailing /tree lists every file at once.
+	if len(segments) >= 3 {
+		var action func(w http.ResponseWriter, r *http.Request, ecosystem, name, version string)
+		switch segments[len(segments)-1] {
+		case "archive":
+			action = s.browseArchive
+		case "tree":
+			action = s.browseTree
+		}
+		if action != nil {
+			nameVersionSegments := segments[:len(segments)-1]
+			name, rest := resolvePackageName(s.db, ecosystem, nameVersionSegments)
+			if name == "" {
+				name = strings.Join(nameVersionSegments[:len(nameVersionSegments)-1], "/")
+				rest = nameVersionSegments[len(nameVersionSegments)-1:]
+			}
+			if len(rest) == 1 {
+				action(w, r, ecosystem, name, rest[0])
+				return
+			}
+		}
+	}
+
 	// No /file/ segment: this is a browse list.
 	name, rest := resolvePackageName(s.db, ecosystem, segments)
 	if name == "" && len(segments) >= 2 {
@@ -199,7 +351,7 @@ func (s *Server) handleComparePath(w http.ResponseWriter, r *http.Request) {
 
 	// The last two segments are fromVersion and toVersion.
 	// Everything before that is the package name.
-	name := strings.Join(segments[:len(segments)-2], "/")
+	name := handler.Canonicalize(ecosystem, strings.Join(segments[:len(segments)-2], "/"))
 	fromVersion := segments[len(segments)-2]
 	toVersion := segments[len(segments)-1]
 
@@ -222,17 +374,9 @@ func (s *Server) browseList(w http.ResponseWriter, r *http.Request, ecosystem, n
 		return
 	}
 
-	// Find the first cached artifact
-	var cachedArtifact *database.Artifact
-	for i := range artifacts {
-		if artifacts[i].StoragePath.Valid {
-			cachedArtifact = &artifacts[i]
-			break
-		}
-	}
-
+	cachedArtifact, msg := selectCachedArtifact(artifacts, r.URL.Query().Get("artifact"))
 	if cachedArtifact == nil {
-		notFound(w, "artifact not cached")
+		notFound(w, msg)
 		return
 	}
 
@@ -256,6 +400,10 @@ func (s *Server) browseList(w http.ResponseWriter, r *http.Request, ecosystem, n
 
 	// List files in the directory
 	files, err := archiveReader.ListDir(dirPath)
+	if errors.Is(err, errUnsafeArchivePath) {
+		badRequest(w, "invalid path")
+		return
+	}
 	if err != nil {
 		s.logger.Error("failed to list directory", "error", err, "path", dirPath)
 		internalError(w, "failed to list directory")
@@ -264,8 +412,9 @@ func (s *Server) browseList(w http.ResponseWriter, r *http.Request, ecosystem, n
 
 	// Convert to response format
 	response := BrowseListResponse{
-		Path:  dirPath,
-		Files: make([]BrowseFileInfo, len(files)),
+		Path:   dirPath,
+		Source: newBrowseSource(cachedArtifact),
+		Files:  make([]BrowseFileInfo, len(files)),
 	}
 
 	for i, f := range files {
@@ -292,6 +441,7 @@ func (s *Server) browseList(w http.ResponseWriter, r *http.Request, ecosystem, n
 // @Param name path string true "Package name"
 // @Param version path string true "Version"
 // @Param filepath path string true "File path inside the archive"
+// @Param artifact query string false "Filename of the cached artifact to browse"
 // @Success 200 {file} file
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
@@ -316,17 +466,9 @@ func (s *Server) browseFile(w http.ResponseWriter, r *http.Request, ecosystem, n
 		return
 	}
 
-	// Find the first cached artifact
-	var cachedArtifact *database.Artifact
-	for i := range artifacts {
-		if artifacts[i].StoragePath.Valid {
-			cachedArtifact = &artifacts[i]
-			break
-		}
-	}
-
+	cachedArtifact, msg := selectCachedArtifact(artifacts, r.URL.Query().Get("artifact"))
 	if cachedArtifact == nil {
-		notFound(w, "artifact not cached")
+		notFound(w, msg)
 		return
 	}
 
@@ -350,6 +492,10 @@ func (s *Server) browseFile(w http.ResponseWriter, r *http.Request, ecosystem, n
 
 	// Extract the file
 	fileReader, err := archiveReader.Extract(filePath)
+	if errors.Is(err, errUnsafeArchivePath) {
+		badRequest(w, "invalid file path")
+		return
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			notFound(w, "file not found")
@@ -496,6 +642,8 @@ type BrowseSourceData struct {
 // @Param name path string true "Package name"
 // @Param fromVersion path string true "From version"
 // @Param toVersion path string true "To version"
+// @Param from_artifact query string false "Filename of the cached artifact to use for the from version"
+// @Param to_artifact query string false "Filename of the cached artifact to use for the to version"
 // @Success 200 {object} map[string]any
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -518,19 +666,9 @@ func (s *Server) compareDiff(w http.ResponseWriter, r *http.Request, ecosystem,
 	}
 
 	// Find cached artifacts
-	var fromArtifact, toArtifact *database.Artifact
-	for i := range fromArtifacts {
-		if fromArtifacts[i].StoragePath.Valid {
-			fromArtifact = &fromArtifacts[i]
-			break
-		}
-	}
-	for i := range toArtifacts {
-		if toArtifacts[i].StoragePath.Valid {
-			toArtifact = &toArtifacts[i]
-			break
-		}
-	}
+	query := r.URL.Query()
+	fromArtifact, _ := selectCachedArtifact(fromArtifacts, query.Get("from_artifact"))
+	toArtifact, _ := selectCachedArtifact(toArtifacts, query.Get("to_artifact"))
 
 	if fromArtifact == nil || toArtifact == nil {
 		notFound(w, "one or both versions not cached")
@@ -579,7 +717,19 @@ func (s *Server) compareDiff(w http.ResponseWriter, r *http.Request, ecosystem,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(result)
+	_ = json.NewEncoder(w).Encode(CompareResponse{
+		CompareResult: result,
+		FromSource:    newBrowseSource(fromArtifact),
+		ToSource:      newBrowseSource(toArtifact),
+	})
+}
+
+// CompareResponse is the diff between two versions along with the artifacts
+// each side was read from.
+type CompareResponse struct {
+	*diff.CompareResult
+	FromSource BrowseSource `json:"from_source"`
+	ToSource   BrowseSource `json:"to_source"`
 }
 
 // ComparePageData contains data for the version comparison page.
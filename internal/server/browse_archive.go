@@ -0,0 +1,239 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/git-pkgs/archives"
+	"github.com/git-pkgs/purl"
+)
+
+const (
+	repackageFormatZip   = "zip"
+	repackageFormatTarGz = "tar.gz"
+)
+
+// handleBrowseArchive repackages a subdirectory of a cached artifact.
+// GET /api/browse/{ecosystem}/{name}/{version}/archive?path=dist&format=zip
+// @Summary Download a directory from a cached artifact as an archive
+// @Description Streams a new zip or tar.gz containing only the files under path. Paths inside the archive are relative to the artifact root, so path=dist yields entries like dist/index.js. An empty path repackages the whole artifact.
+// @Tags browse
+// @Produce application/zip
+// @Produce application/gzip
+// @Param ecosystem path string true "Ecosystem"
+// @Param name path string true "Package name"
+// @Param version path string true "Version"
+// @Param path query string false "Directory inside the archive"
+// @Param format query string false "Output format: zip (default) or tar.gz"
+// @Param artifact query string false "Filename of the cached artifact to browse"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ui/api/browse/{ecosystem}/{name}/{version}/archive [get]
+func (s *Server) browseArchive(w http.ResponseWriter, r *http.Request, ecosystem, name, version string) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = repackageFormatZip
+	case repackageFormatZip, repackageFormatTarGz:
+	case "tgz":
+		format = repackageFormatTarGz
+	default:
+		badRequest(w, "format must be zip or tar.gz")
+		return
+	}
+
+	dirPath := strings.Trim(r.URL.Query().Get("path"), "/")
+	if dirPath != "" {
+		dirPath = path.Clean(dirPath)
+		if dirPath == ".." || strings.HasPrefix(dirPath, "../") {
+			badRequest(w, "invalid path")
+			return
+		}
+		if dirPath == "." {
+			dirPath = ""
+		}
+	}
+
+	versionPURL := purl.MakePURLString(ecosystem, name, version)
+	artifacts, err := s.db.GetArtifactsByVersionPURL(versionPURL)
+	if err != nil {
+		notFound(w, "version not found")
+		return
+	}
+	if len(artifacts) == 0 {
+		notFound(w, "no artifacts cached")
+		return
+	}
+
+	cachedArtifact, msg := selectCachedArtifact(artifacts, r.URL.Query().Get("artifact"))
+	if cachedArtifact == nil {
+		notFound(w, msg)
+		return
+	}
+
+	artifactReader, err := s.storage.Open(r.Context(), cachedArtifact.StoragePath.String)
+	if err != nil {
+		s.logger.Error("failed to read artifact from storage", "error", err)
+		internalError(w, "failed to read artifact")
+		return
+	}
+	defer func() { _ = artifactReader.Close() }()
+
+	archiveReader, err := openArchive(cachedArtifact.Filename, artifactReader, ecosystem)
+	if err != nil {
+		s.logger.Error("failed to open archive", "error", err, "filename", cachedArtifact.Filename)
+		internalError(w, "failed to open archive")
+		return
+	}
+	defer func() { _ = archiveReader.Close() }()
+
+	all, err := archiveReader.List()
+	if err != nil {
+		s.logger.Error("failed to list archive", "error", err, "filename", cachedArtifact.Filename)
+		internalError(w, "failed to list archive")
+		return
+	}
+	files := filesUnder(all, dirPath)
+	if len(files) == 0 {
+		notFound(w, "path not found")
+		return
+	}
+
+	filename := repackageFilename(name, version, dirPath, format)
+	if format == repackageFormatZip {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Headers are committed once the first entry is written, so failures
+	// from here on can only be logged; the client sees a truncated archive.
+	if format == repackageFormatZip {
+		err = writeZip(w, archiveReader, files)
+	} else {
+		err = writeTarGz(w, archiveReader, files)
+	}
+	if err != nil {
+		s.logger.Error("failed to stream repackaged archive", "error", err,
+			"filename", cachedArtifact.Filename, "path", dirPath)
+	}
+}
+
+// filesUnder returns the regular files in all that live under dir. An empty
+// dir matches every file. Entries whose names would land outside the root
+// of the repackaged archive, such as "../evil.sh", are skipped.
+func filesUnder(all []archives.FileInfo, dir string) []archives.FileInfo {
+	var files []archives.FileInfo
+	for _, f := range all {
+		if f.IsDir {
+			continue
+		}
+		p := strings.TrimPrefix(f.Path, "/")
+		if isUnsafeArchivePath(p) {
+			continue
+		}
+		if clean := path.Clean(p); clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			continue
+		}
+		if dir != "" && !strings.HasPrefix(p, dir+"/") {
+			continue
+		}
+		f.Path = p
+		files = append(files, f)
+	}
+	return files
+}
+
+// repackageFilename builds the Content-Disposition filename, e.g.
+// "babel-core-7.0.0-dist.zip" for @babel/core 7.0.0 with path=dist.
+func repackageFilename(name, version, dir, format string) string {
+	base := strings.TrimPrefix(name, "@") + "-" + version
+	if dir != "" {
+		base += "-" + path.Base(dir)
+	}
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, base)
+	return base + "." + format
+}
+
+func writeZip(w io.Writer, reader archives.Reader, files []archives.FileInfo) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		hdr := &zip.FileHeader{
+			Name:     f.Path,
+			Method:   zip.Deflate,
+			Modified: f.ModTime,
+		}
+		hdr.SetMode(os.FileMode(entryPerm(f.Mode)))
+		dst, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyEntry(dst, reader, f.Path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, reader archives.Reader, files []archives.FileInfo) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.Path,
+			Mode:     int64(entryPerm(f.Mode)),
+			Size:     f.Size,
+			ModTime:  f.ModTime,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyEntry(tw, reader, f.Path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// entryPerm returns the permission bits for a repackaged file, defaulting to
+// 0644 when the source archive doesn't record any.
+func entryPerm(mode uint32) uint32 {
+	if perm := mode & 0o777; perm != 0 { //nolint:mnd // permission bits
+		return perm
+	}
+	return 0o644 //nolint:mnd // rw-r--r--
+}
+
+func copyEntry(dst io.Writer, reader archives.Reader, filePath string) error {
+	src, err := reader.Extract(filePath)
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", filePath, err)
+	}
+	defer func() { _ = src.Close() }()
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("copying %s: %w", filePath, err)
+	}
+	return nil
+}
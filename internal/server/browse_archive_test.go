@@ -0,0 +1,236 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/git-pkgs/archives"
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+func setupRepackageArtifact(t *testing.T, ts *testServer) {
+	t.Helper()
+
+	data := createArchiveWithContent(t, map[string]string{
+		"package.json":         `{"name":"@scope/lib"}`,
+		"dist/index.js":        "module.exports = 1\n",
+		"dist/sub/helper.js":   "exports.h = 2\n",
+		"distribution/note.md": "not in dist\n",
+		"src/index.ts":         "export default 1\n",
+	})
+	artifactsDir := filepath.Join(ts.tempDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("failed to create artifacts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "lib.tgz"), data, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	pkg := &database.Package{PURL: "pkg:npm/%40scope/lib", Ecosystem: "npm", Name: "@scope/lib"}
+	if err := ts.db.UpsertPackage(pkg); err != nil {
+		t.Fatalf("failed to upsert package: %v", err)
+	}
+	ver := &database.Version{PURL: "pkg:npm/%40scope/lib@2.0.0", PackagePURL: pkg.PURL}
+	if err := ts.db.UpsertVersion(ver); err != nil {
+		t.Fatalf("failed to upsert version: %v", err)
+	}
+	if err := ts.db.UpsertArtifact(&database.Artifact{
+		VersionPURL: ver.PURL,
+		Filename:    "lib-2.0.0.tgz",
+		UpstreamURL: "https://registry.npmjs.org/@scope/lib/-/lib-2.0.0.tgz",
+		StoragePath: sql.NullString{String: "lib.tgz", Valid: true},
+	}); err != nil {
+		t.Fatalf("failed to upsert artifact: %v", err)
+	}
+}
+
+func TestBrowseArchiveZipContainsOnlySubtree(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	setupRepackageArtifact(t, ts)
+
+	req := httptest.NewRequest("GET", "/ui/api/browse/npm/@scope/lib/2.0.0/archive?path=dist&format=zip", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="scope-lib-2.0.0-dist.zip"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a valid zip: %v", err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		got[f.Name] = string(body)
+	}
+
+	want := map[string]string{
+		"dist/index.js":      "module.exports = 1\n",
+		"dist/sub/helper.js": "exports.h = 2\n",
+	}
+	if len(got) != len(want) {
+		t.Errorf("zip entries = %v, want exactly %v", sortedKeys(got), sortedKeys(want))
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestBrowseArchiveTarGz(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	setupRepackageArtifact(t, ts)
+
+	req := httptest.NewRequest("GET", "/ui/api/browse/npm/@scope/lib/2.0.0/archive?path=src&format=tar.gz", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("response is not gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 1 || names[0] != "src/index.ts" {
+		t.Errorf("tar entries = %v, want [src/index.ts]", names)
+	}
+}
+
+func TestBrowseArchiveErrors(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	setupRepackageArtifact(t, ts)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?path=missing", http.StatusNotFound},
+		{"?path=dist&format=rar", http.StatusBadRequest},
+		{"?path=../etc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/ui/api/browse/npm/@scope/lib/2.0.0/archive"+tt.query, nil)
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
+
+func TestBrowseArchiveSkipsEntriesOutsideRoot(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	data := createTarGzArchive(t, map[string]string{
+		"package/index.js":          "ok\n",
+		"package/../../evil.sh":     "rm -rf ~\n",
+		"package/lib/../../../x.sh": "rm -rf ~\n",
+		"/etc/passwd":               "root\n",
+	})
+	artifactsDir := filepath.Join(ts.tempDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("failed to create artifacts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "crafted.tgz"), data, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	ver := &database.Version{PURL: "pkg:npm/crafted@1.0.0", PackagePURL: "pkg:npm/crafted"}
+	if err := ts.db.UpsertPackage(&database.Package{PURL: ver.PackagePURL, Ecosystem: "npm", Name: "crafted"}); err != nil {
+		t.Fatalf("failed to upsert package: %v", err)
+	}
+	if err := ts.db.UpsertVersion(ver); err != nil {
+		t.Fatalf("failed to upsert version: %v", err)
+	}
+	if err := ts.db.UpsertArtifact(&database.Artifact{
+		VersionPURL: ver.PURL,
+		Filename:    "crafted-1.0.0.tgz",
+		UpstreamURL: "https://registry.npmjs.org/crafted/-/crafted-1.0.0.tgz",
+		StoragePath: sql.NullString{String: "crafted.tgz", Valid: true},
+	}); err != nil {
+		t.Fatalf("failed to upsert artifact: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/ui/api/browse/npm/crafted/1.0.0/archive", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 1 || names[0] != "index.js" {
+		t.Errorf("zip entries = %v, want [index.js]", names)
+	}
+}
+
+func TestFilesUnderSkipsEscapingPaths(t *testing.T) {
+	all := []archives.FileInfo{
+		{Path: "dist/index.js"},
+		{Path: "dist/../../evil.sh"},
+		{Path: "/../etc/passwd"},
+		{Path: "..\\evil.bat"},
+		{Path: "C:/evil.exe"},
+	}
+	files := filesUnder(all, "")
+	if len(files) != 1 || files[0].Path != "dist/index.js" {
+		t.Errorf("filesUnder = %+v, want only dist/index.js", files)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
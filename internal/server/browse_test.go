@@ -5,14 +5,17 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-pkgs/proxy/internal/database"
 )
@@ -525,6 +528,15 @@ func TestHandleCompareDiff(t *testing.T) {
 		t.Error("should have detected file changes")
 	}
 
+	fromSource, ok := result["from_source"].(map[string]interface{})
+	if !ok || fromSource["filename"] != "test-compare-1.0.0.tgz" {
+		t.Errorf("from_source = %v, want filename test-compare-1.0.0.tgz", result["from_source"])
+	}
+	toSource, ok := result["to_source"].(map[string]interface{})
+	if !ok || toSource["filename"] != "test-compare-2.0.0.tgz" {
+		t.Errorf("to_source = %v, want filename test-compare-2.0.0.tgz", result["to_source"])
+	}
+
 	// Check counts exist
 	if _, ok := result["files_changed"]; !ok {
 		t.Error("response should have files_changed")
@@ -534,6 +546,109 @@ func TestHandleCompareDiff(t *testing.T) {
 	}
 }
 
+func TestBrowseSelectsArtifactByFilename(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	artifactsDir := filepath.Join(ts.tempDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("failed to create artifacts dir: %v", err)
+	}
+
+	sdist := createArchiveWithContent(t, map[string]string{"setup.py": "from setuptools import setup\n"})
+	other := createArchiveWithContent(t, map[string]string{"pyproject.toml": "[project]\n"})
+	if err := os.WriteFile(filepath.Join(artifactsDir, "a.tar.gz"), sdist, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "b.tar.gz"), other, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	pkg := &database.Package{PURL: "pkg:npm/multi", Ecosystem: "npm", Name: "multi"}
+	if err := ts.db.UpsertPackage(pkg); err != nil {
+		t.Fatalf("failed to upsert package: %v", err)
+	}
+	ver := &database.Version{PURL: "pkg:npm/multi@1.0.0", PackagePURL: pkg.PURL}
+	if err := ts.db.UpsertVersion(ver); err != nil {
+		t.Fatalf("failed to upsert version: %v", err)
+	}
+
+	fetchedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, a := range []*database.Artifact{
+		{
+			VersionPURL: ver.PURL,
+			Filename:    "multi-1.0.0.tgz",
+			UpstreamURL: "https://example.com/multi-1.0.0.tgz",
+			StoragePath: sql.NullString{String: "a.tar.gz", Valid: true},
+			Size:        sql.NullInt64{Int64: int64(len(sdist)), Valid: true},
+			FetchedAt:   sql.NullTime{Time: fetchedAt, Valid: true},
+		},
+		{
+			VersionPURL: ver.PURL,
+			Filename:    "multi-1.0.0-alt.tgz",
+			UpstreamURL: "https://example.com/multi-1.0.0-alt.tgz",
+			StoragePath: sql.NullString{String: "b.tar.gz", Valid: true},
+			Size:        sql.NullInt64{Int64: int64(len(other)), Valid: true},
+			FetchedAt:   sql.NullTime{Time: fetchedAt, Valid: true},
+		},
+	} {
+		if err := ts.db.UpsertArtifact(a); err != nil {
+			t.Fatalf("failed to upsert artifact: %v", err)
+		}
+	}
+
+	tests := []struct {
+		artifact string
+		wantFile string
+		wantSize int
+	}{
+		{"multi-1.0.0.tgz", "setup.py", len(sdist)},
+		{"multi-1.0.0-alt.tgz", "pyproject.toml", len(other)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.artifact, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ui/api/browse/npm/multi/1.0.0?artifact="+tt.artifact, nil)
+			w := httptest.NewRecorder()
+			ts.handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var response BrowseListResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Files) != 1 || response.Files[0].Name != tt.wantFile {
+				t.Errorf("files = %+v, want only %s", response.Files, tt.wantFile)
+			}
+			if response.Source.Filename != tt.artifact {
+				t.Errorf("source filename = %q, want %q", response.Source.Filename, tt.artifact)
+			}
+			if response.Source.Size != int64(tt.wantSize) {
+				t.Errorf("source size = %d, want %d", response.Source.Size, tt.wantSize)
+			}
+			if response.Source.FetchedAt != "2026-01-02T03:04:05Z" {
+				t.Errorf("source fetched_at = %q", response.Source.FetchedAt)
+			}
+
+			req = httptest.NewRequest("GET", "/ui/api/browse/npm/multi/1.0.0/file/"+tt.wantFile+"?artifact="+tt.artifact, nil)
+			w = httptest.NewRecorder()
+			ts.handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("browse file: expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/ui/api/browse/npm/multi/1.0.0?artifact=missing.tgz", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown artifact: expected status 404, got %d", w.Code)
+	}
+}
+
 func createArchiveWithContent(t *testing.T, files map[string]string) []byte {
 	t.Helper()
 
@@ -619,6 +734,7 @@ func TestArchiveFilename(t *testing.T) {
 		{"file.zip", "file.zip"},
 		{"archive.tgz", "archive.tgz"},
 		{"noext", "noext.zip"},
+		{"serde-1.0.0.crate", "serde-1.0.0.crate.tar.gz"},
 	}
 
 	for _, tt := range tests {
@@ -800,3 +916,138 @@ func createTarGzArchive(t *testing.T, files map[string]string) []byte {
 	}
 	return buf.Bytes()
 }
+
+func TestOpenArchiveDropsTraversalEntries(t *testing.T) {
+	data := createZipArchive(t, map[string]string{
+		"README.md":             "hello",
+		"src/main.go":           "package main",
+		"../../etc/passwd":      "root:x:0:0",
+		"/etc/shadow":           "root:*",
+		`..\..\windows\win.ini`: "[fonts]",
+		"src/../../escape.txt":  "escaped",
+	})
+	reader, err := openArchive("test.zip", bytes.NewReader(data), "composer")
+	if err != nil {
+		t.Fatalf("openArchive failed: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	files, err := reader.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	for _, f := range files {
+		if isUnsafeArchivePath(f.Path) {
+			t.Errorf("List returned unsafe entry %q", f.Path)
+		}
+	}
+	if len(files) != 2 {
+		t.Errorf("List returned %d files, want 2", len(files))
+	}
+
+	root, err := reader.ListDir("")
+	if err != nil {
+		t.Fatalf("ListDir failed: %v", err)
+	}
+	for _, f := range root {
+		if isUnsafeArchivePath(f.Path) {
+			t.Errorf("ListDir returned unsafe entry %q", f.Path)
+		}
+	}
+
+	for _, p := range []string{"../../etc/passwd", "/etc/shadow", `..\..\windows\win.ini`, "src/../../escape.txt"} {
+		if _, err := reader.Extract(p); !errors.Is(err, errUnsafeArchivePath) {
+			t.Errorf("Extract(%q) error = %v, want errUnsafeArchivePath", p, err)
+		}
+	}
+	if _, err := reader.ListDir("../.."); !errors.Is(err, errUnsafeArchivePath) {
+		t.Errorf("ListDir(../..) error = %v, want errUnsafeArchivePath", err)
+	}
+
+	rc, err := reader.Extract("README.md")
+	if err != nil {
+		t.Fatalf("Extract(README.md) failed: %v", err)
+	}
+	_ = rc.Close()
+}
+
+func TestOpenArchiveIgnoresTraversalEntriesForRootDetection(t *testing.T) {
+	data := createTarGzArchive(t, map[string]string{
+		"repo-abc/README.md": "hello",
+		"../outside.txt":     "escaped",
+	})
+	reader, err := openArchive("test.tar.gz", bytes.NewReader(data), "composer")
+	if err != nil {
+		t.Fatalf("openArchive failed: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	files, err := reader.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "README.md" {
+		t.Errorf("files = %+v, want only README.md with repo-abc/ stripped", files)
+	}
+}
+
+func TestBrowseRejectsTraversalPaths(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	archiveData := createTarGzArchive(t, map[string]string{
+		"package/README.md":  "hello",
+		"../../etc/passwd":   "root:x:0:0",
+		"package/../../evil": "evil",
+	})
+	if _, _, err := ts.storage.Store(context.Background(), testArchiveName, bytes.NewReader(archiveData)); err != nil {
+		t.Fatalf("storing archive: %v", err)
+	}
+
+	pkg := &database.Package{PURL: "pkg:npm/crafted", Ecosystem: "npm", Name: "crafted"}
+	if err := ts.db.UpsertPackage(pkg); err != nil {
+		t.Fatalf("failed to upsert package: %v", err)
+	}
+	ver := &database.Version{PURL: "pkg:npm/crafted@1.0.0", PackagePURL: pkg.PURL}
+	if err := ts.db.UpsertVersion(ver); err != nil {
+		t.Fatalf("failed to upsert version: %v", err)
+	}
+	artifact := &database.Artifact{
+		VersionPURL: ver.PURL,
+		Filename:    "crafted-1.0.0.tgz",
+		UpstreamURL: "https://registry.npmjs.org/crafted/-/crafted-1.0.0.tgz",
+		StoragePath: sql.NullString{String: testArchiveName, Valid: true},
+	}
+	if err := ts.db.UpsertArtifact(artifact); err != nil {
+		t.Fatalf("failed to upsert artifact: %v", err)
+	}
+
+	for _, target := range []string{
+		"/ui/api/browse/npm/crafted/1.0.0/file/../../etc/passwd",
+		"/ui/api/browse/npm/crafted/1.0.0?path=../..",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %s", target, w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "root:x") {
+			t.Errorf("%s: response leaked crafted entry content", target)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ui/api/browse/npm/crafted/1.0.0", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp BrowseListResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding listing: %v", err)
+	}
+	if len(resp.Files) != 1 || resp.Files[0].Path != "README.md" {
+		t.Errorf("listing = %+v, want only README.md", resp.Files)
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/git-pkgs/archives"
+	"github.com/git-pkgs/purl"
+)
+
+// maxBrowseTreeEntries caps how many files and directories a tree response
+// holds. Archives with more entries are cut off and marked truncated rather
+// than building an unbounded response.
+const maxBrowseTreeEntries = 50000
+
+// BrowseTreeNode is a file or directory in a BrowseTreeResponse. Directories
+// list their contents in Children, directories first, then by name.
+type BrowseTreeNode struct {
+	Path     string            `json:"path"`
+	Name     string            `json:"name"`
+	Size     int64             `json:"size"`
+	IsDir    bool              `json:"is_dir"`
+	ModTime  string            `json:"mod_time,omitempty"`
+	Children []*BrowseTreeNode `json:"children,omitempty"`
+}
+
+// BrowseTreeResponse is the whole file tree of a cached artifact.
+type BrowseTreeResponse struct {
+	Source BrowseSource      `json:"source"`
+	Files  []*BrowseTreeNode `json:"files"`
+	// Entries counts the files and directories in the tree.
+	Entries int `json:"entries"`
+	// Truncated is set when the archive holds more than the entry cap and
+	// the tree is incomplete.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// handleBrowseTree returns the full recursive file tree of a cached artifact.
+// GET /api/browse/{ecosystem}/{name}/{version}/tree
+// @Summary List every file inside a cached artifact as a tree
+// @Description Returns all files and directories of a cached artifact in one nested response, so a client can render the whole tree without listing each directory. Very large archives are cut off and marked truncated.
+// @Tags browse
+// @Produce json
+// @Param ecosystem path string true "Ecosystem"
+// @Param name path string true "Package name"
+// @Param version path string true "Version"
+// @Param artifact query string false "Filename of the cached artifact to browse"
+// @Success 200 {object} BrowseTreeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /ui/api/browse/{ecosystem}/{name}/{version}/tree [get]
+func (s *Server) browseTree(w http.ResponseWriter, r *http.Request, ecosystem, name, version string) {
+	versionPURL := purl.MakePURLString(ecosystem, name, version)
+	artifacts, err := s.db.GetArtifactsByVersionPURL(versionPURL)
+	if err != nil {
+		notFound(w, "version not found")
+		return
+	}
+	if len(artifacts) == 0 {
+		notFound(w, "no artifacts cached")
+		return
+	}
+
+	cachedArtifact, msg := selectCachedArtifact(artifacts, r.URL.Query().Get("artifact"))
+	if cachedArtifact == nil {
+		notFound(w, msg)
+		return
+	}
+
+	artifactReader, err := s.storage.Open(r.Context(), cachedArtifact.StoragePath.String)
+	if err != nil {
+		s.logger.Error("failed to read artifact from storage", "error", err)
+		internalError(w, "failed to read artifact")
+		return
+	}
+	defer func() { _ = artifactReader.Close() }()
+
+	archiveReader, err := openArchive(cachedArtifact.Filename, artifactReader, ecosystem)
+	if err != nil {
+		s.logger.Error("failed to open archive", "error", err, "filename", cachedArtifact.Filename)
+		internalError(w, "failed to open archive")
+		return
+	}
+	defer func() { _ = archiveReader.Close() }()
+
+	all, err := archiveReader.List()
+	if err != nil {
+		s.logger.Error("failed to list archive", "error", err, "filename", cachedArtifact.Filename)
+		internalError(w, "failed to list archive")
+		return
+	}
+
+	tree := buildFileTree(all, maxBrowseTreeEntries)
+	tree.Source = newBrowseSource(cachedArtifact)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tree)
+}
+
+// buildFileTree nests a flat archive listing into a tree. Directories that
+// only appear as a prefix of a file path are filled in, since many archives
+// have no entries for them. At most limit nodes are added.
+func buildFileTree(files []archives.FileInfo, limit int) BrowseTreeResponse {
+	sorted := make([]archives.FileInfo, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	root := &BrowseTreeNode{IsDir: true}
+	dirs := map[string]*BrowseTreeNode{"": root}
+	var resp BrowseTreeResponse
+
+	// dir returns the node for p, creating it and any missing parents.
+	var dir func(p string) *BrowseTreeNode
+	dir = func(p string) *BrowseTreeNode {
+		if n, ok := dirs[p]; ok {
+			return n
+		}
+		parent := dir(parentDir(p))
+		if parent == nil || resp.Entries >= limit {
+			resp.Truncated = true
+			return nil
+		}
+		n := &BrowseTreeNode{Path: p, Name: path.Base(p), IsDir: true}
+		parent.Children = append(parent.Children, n)
+		dirs[p] = n
+		resp.Entries++
+		return n
+	}
+
+	for _, f := range sorted {
+		p := strings.Trim(f.Path, "/")
+		if p == "" {
+			continue
+		}
+		if f.IsDir {
+			if n := dir(p); n != nil && !f.ModTime.IsZero() {
+				n.ModTime = f.ModTime.Format("2006-01-02 15:04:05")
+			}
+			continue
+		}
+		parent := dir(parentDir(p))
+		if parent == nil || resp.Entries >= limit {
+			resp.Truncated = true
+			continue
+		}
+		parent.Children = append(parent.Children, &BrowseTreeNode{
+			Path:    p,
+			Name:    path.Base(p),
+			Size:    f.Size,
+			ModTime: f.ModTime.Format("2006-01-02 15:04:05"),
+		})
+		resp.Entries++
+	}
+
+	sortTree(root)
+	resp.Files = root.Children
+	if resp.Files == nil {
+		resp.Files = []*BrowseTreeNode{}
+	}
+	return resp
+}
+
+func parentDir(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+func sortTree(n *BrowseTreeNode) {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return a.Name < b.Name
+	})
+	for _, c := range n.Children {
+		if c.IsDir {
+			sortTree(c)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-pkgs/archives"
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+func TestHandleBrowseTree(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	artifactsDir := filepath.Join(ts.tempDir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("failed to create artifacts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, testArchiveName), createTestArchive(t), 0644); err != nil {
+		t.Fatalf("failed to write test archive: %v", err)
+	}
+
+	pkg := &database.Package{PURL: "pkg:npm/test-browse", Ecosystem: "npm", Name: "test-browse"}
+	if err := ts.db.UpsertPackage(pkg); err != nil {
+		t.Fatalf("failed to upsert package: %v", err)
+	}
+	ver := &database.Version{PURL: "pkg:npm/test-browse@1.0.0", PackagePURL: pkg.PURL}
+	if err := ts.db.UpsertVersion(ver); err != nil {
+		t.Fatalf("failed to upsert version: %v", err)
+	}
+	if err := ts.db.UpsertArtifact(&database.Artifact{
+		VersionPURL: ver.PURL,
+		Filename:    "test-browse-1.0.0.tgz",
+		UpstreamURL: "https://registry.npmjs.org/test-browse/-/test-browse-1.0.0.tgz",
+		StoragePath: sql.NullString{String: testArchiveName, Valid: true},
+	}); err != nil {
+		t.Fatalf("failed to upsert artifact: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/ui/api/browse/npm/test-browse/1.0.0/tree", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp BrowseTreeResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Source.Filename != "test-browse-1.0.0.tgz" {
+		t.Errorf("source = %q, want test-browse-1.0.0.tgz", resp.Source.Filename)
+	}
+	if resp.Truncated {
+		t.Error("tree should not be truncated")
+	}
+
+	// Directories come first, then files, each sorted by name.
+	var got []string
+	var walk func(nodes []*BrowseTreeNode)
+	walk = func(nodes []*BrowseTreeNode) {
+		for _, n := range nodes {
+			entry := n.Path
+			if n.IsDir {
+				entry += "/"
+			}
+			got = append(got, entry)
+			walk(n.Children)
+		}
+	}
+	walk(resp.Files)
+
+	want := []string{
+		"lib/",
+		"lib/helper.js",
+		"lib/index.js",
+		"test/",
+		"test/index.test.js",
+		"README.md",
+		"package.json",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tree = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tree[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if resp.Entries != len(want) {
+		t.Errorf("entries = %d, want %d", resp.Entries, len(want))
+	}
+
+	lib := resp.Files[0]
+	if lib.Name != "lib" || len(lib.Children) != 2 {
+		t.Fatalf("lib = %+v, want a directory with two files", lib)
+	}
+	if index := lib.Children[1]; index.Name != "index.js" || index.Size != int64(len("module.exports = {};")) {
+		t.Errorf("lib/index.js = %+v", index)
+	}
+}
+
+func TestBrowseTreeNotCached(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	req := httptest.NewRequest("GET", "/ui/api/browse/npm/missing/1.0.0/tree", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestBuildFileTreeTruncates(t *testing.T) {
+	files := []archives.FileInfo{
+		{Path: "a/1.txt"},
+		{Path: "a/2.txt"},
+		{Path: "b/3.txt"},
+		{Path: "c.txt"},
+	}
+
+	tree := buildFileTree(files, 3)
+	if !tree.Truncated {
+		t.Error("expected tree to be truncated")
+	}
+	if tree.Entries != 3 {
+		t.Errorf("entries = %d, want 3", tree.Entries)
+	}
+	if len(tree.Files) != 1 || tree.Files[0].Path != "a" || len(tree.Files[0].Children) != 2 {
+		t.Errorf("files = %+v, want only a/ with two files", tree.Files)
+	}
+
+	if full := buildFileTree(files, maxBrowseTreeEntries); full.Truncated || full.Entries != 6 {
+		t.Errorf("full tree entries = %d, truncated = %v; want 6, false", full.Entries, full.Truncated)
+	}
+}
+
+func TestBuildFileTreeExplicitDirs(t *testing.T) {
+	tree := buildFileTree([]archives.FileInfo{
+		{Path: "docs/", IsDir: true},
+		{Path: "docs/guide.md", Size: 4},
+		{Path: "empty", IsDir: true},
+	}, maxBrowseTreeEntries)
+
+	if tree.Entries != 3 {
+		t.Errorf("entries = %d, want 3", tree.Entries)
+	}
+	if len(tree.Files) != 2 || tree.Files[0].Path != "docs" || tree.Files[1].Path != "empty" {
+		t.Fatalf("files = %+v, want docs and empty directories", tree.Files)
+	}
+	if len(tree.Files[0].Children) != 1 || tree.Files[0].Children[0].Size != 4 {
+		t.Errorf("docs children = %+v", tree.Files[0].Children)
+	}
+}
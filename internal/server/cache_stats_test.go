@@ -0,0 +1,71 @@
+package server
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func seedCachedArtifact(t *testing.T, db *database.DB, ecosystem, name, filename string, size, hits int64) {
+	t.Helper()
+
+	pkgPURL := "pkg:" + ecosystem + "/" + name
+	if err := db.UpsertPackage(&database.Package{PURL: pkgPURL, Ecosystem: ecosystem, Name: name}); err != nil {
+		t.Fatalf("failed to upsert package: %v", err)
+	}
+	versionPURL := pkgPURL + "@1.0.0"
+	if err := db.UpsertVersion(&database.Version{PURL: versionPURL, PackagePURL: pkgPURL}); err != nil {
+		t.Fatalf("failed to upsert version: %v", err)
+	}
+	if err := db.UpsertArtifact(&database.Artifact{
+		VersionPURL: versionPURL,
+		Filename:    filename,
+		UpstreamURL: "https://example.com/" + filename,
+		StoragePath: sql.NullString{String: ecosystem + "/" + filename, Valid: true},
+		Size:        sql.NullInt64{Int64: size, Valid: true},
+		HitCount:    hits,
+	}); err != nil {
+		t.Fatalf("failed to upsert artifact: %v", err)
+	}
+}
+
+func TestUpdateCacheStatsPerEcosystem(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	seedCachedArtifact(t, ts.db, "npm", "lodash", "lodash-1.0.0.tgz", 100, 3)
+	seedCachedArtifact(t, ts.db, "npm", "react", "react-1.0.0.tgz", 200, 4)
+	seedCachedArtifact(t, ts.db, "cargo", "serde", "serde-1.0.0.crate", 50, 1)
+
+	ts.server.updateCacheStats()
+
+	tests := []struct {
+		ecosystem             string
+		artifacts, size, hits float64
+	}{
+		{"npm", 2, 300, 7},
+		{"cargo", 1, 50, 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(metrics.EcosystemCachedArtifacts.WithLabelValues(tt.ecosystem)); got != tt.artifacts {
+			t.Errorf("%s artifacts = %v, want %v", tt.ecosystem, got, tt.artifacts)
+		}
+		if got := testutil.ToFloat64(metrics.EcosystemCacheSize.WithLabelValues(tt.ecosystem)); got != tt.size {
+			t.Errorf("%s size = %v, want %v", tt.ecosystem, got, tt.size)
+		}
+		if got := testutil.ToFloat64(metrics.EcosystemCacheHits.WithLabelValues(tt.ecosystem)); got != tt.hits {
+			t.Errorf("%s hits = %v, want %v", tt.ecosystem, got, tt.hits)
+		}
+	}
+
+	if err := ts.db.ClearArtifactCache("pkg:cargo/serde@1.0.0", "serde-1.0.0.crate"); err != nil {
+		t.Fatalf("ClearArtifactCache: %v", err)
+	}
+	ts.server.updateCacheStats()
+	if n := testutil.CollectAndCount(metrics.EcosystemCachedArtifacts); n != 1 {
+		t.Errorf("got %d ecosystem series after evicting cargo, want 1", n)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/purl"
+)
+
+// CachedCheckRequest is the request body for a bulk cache check.
+type CachedCheckRequest struct {
+	PURLs []string `json:"purls"`
+}
+
+// CachedCheckResult reports whether one version is fully cached.
+type CachedCheckResult struct {
+	Cached    bool   `json:"cached"`
+	Artifacts int    `json:"artifacts"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CachedCheckResponse maps each requested PURL to its cache status.
+// AllCached is true when every PURL is cached.
+type CachedCheckResponse struct {
+	PURLs     map[string]CachedCheckResult `json:"purls"`
+	AllCached bool                         `json:"all_cached"`
+}
+
+// HandleCachedCheck handles POST /api/cached
+// @Summary Check which versions are cached
+// @Description Takes versioned PURLs and reports, for each, whether all of its known artifacts are in the cache. CI can use this before a build to decide whether it can run against the proxy offline. A version the proxy has never seen, or one with any artifact not yet downloaded, is reported as not cached.
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param request body CachedCheckRequest true "Versioned PURLs"
+// @Success 200 {object} CachedCheckResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/cached [post]
+func (h *APIHandler) HandleCachedCheck(w http.ResponseWriter, r *http.Request) {
+	var req CachedCheckRequest
+	if !decodeJSONBody(w, r, h.maxBodySize, &req) {
+		return
+	}
+
+	if len(req.PURLs) == 0 {
+		badRequest(w, "purls list is required")
+		return
+	}
+	if !checkItemLimit(w, "purls", len(req.PURLs), h.maxItems) {
+		return
+	}
+
+	resp := CachedCheckResponse{
+		PURLs:     make(map[string]CachedCheckResult, len(req.PURLs)),
+		AllCached: true,
+	}
+	for _, purlStr := range req.PURLs {
+		result, err := h.cachedStatus(purlStr)
+		if err != nil {
+			internalError(w, "failed to check cache")
+			return
+		}
+		resp.PURLs[purlStr] = result
+		resp.AllCached = resp.AllCached && result.Cached
+	}
+
+	writeJSON(w, resp)
+}
+
+// cachedStatus looks up one versioned PURL. Malformed or unversioned PURLs
+// are reported in the result rather than failing the whole request.
+func (h *APIHandler) cachedStatus(purlStr string) (CachedCheckResult, error) {
+	p, err := purl.Parse(purlStr)
+	if err != nil {
+		return CachedCheckResult{Error: "invalid purl"}, nil
+	}
+	if p.Version == "" {
+		return CachedCheckResult{Error: "purl has no version"}, nil
+	}
+
+	ecosystem := purl.PURLTypeToEcosystem(p.Type)
+	name := handler.Canonicalize(ecosystem, p.FullName())
+	versionPURL := purl.MakePURLString(ecosystem, name, p.Version)
+
+	ver, err := h.db.GetVersionByPURL(versionPURL)
+	if err != nil {
+		return CachedCheckResult{}, err
+	}
+	if ver == nil {
+		return CachedCheckResult{}, nil
+	}
+
+	artifacts, err := h.db.GetArtifactsByVersionPURL(versionPURL)
+	if err != nil {
+		return CachedCheckResult{}, err
+	}
+	result := CachedCheckResult{Artifacts: len(artifacts), Cached: len(artifacts) > 0}
+	for i := range artifacts {
+		if !artifacts[i].IsCached() {
+			result.Cached = false
+			break
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/enrichment"
+)
+
+func TestHandleCachedCheck(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	seed := func(versionPURL, filename string, cached bool) {
+		t.Helper()
+		art := &database.Artifact{
+			VersionPURL: versionPURL,
+			Filename:    filename,
+			UpstreamURL: "https://example.com/" + filename,
+		}
+		if cached {
+			art.StoragePath = sql.NullString{String: "npm/" + filename, Valid: true}
+			art.FetchedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		if err := db.UpsertArtifact(art); err != nil {
+			t.Fatalf("UpsertArtifact failed: %v", err)
+		}
+	}
+	for _, v := range []struct{ pkg, version string }{
+		{"pkg:npm/lodash", "pkg:npm/lodash@4.17.21"},
+		{"pkg:npm/react", "pkg:npm/react@18.2.0"},
+		{"pkg:pypi/requests", "pkg:pypi/requests@2.31.0"},
+	} {
+		if err := db.UpsertVersion(&database.Version{PURL: v.version, PackagePURL: v.pkg}); err != nil {
+			t.Fatalf("UpsertVersion failed: %v", err)
+		}
+	}
+	seed("pkg:npm/lodash@4.17.21", "lodash-4.17.21.tgz", true)
+	seed("pkg:npm/react@18.2.0", "react-18.2.0.tgz", false)
+	seed("pkg:pypi/requests@2.31.0", "requests-2.31.0-py3-none-any.whl", true)
+	seed("pkg:pypi/requests@2.31.0", "requests-2.31.0.tar.gz", false)
+
+	h := NewAPIHandler(enrichment.New(slog.New(slog.NewTextHandler(os.Stdout, nil))), db)
+	body, _ := json.Marshal(CachedCheckRequest{PURLs: []string{
+		"pkg:npm/lodash@4.17.21",
+		"pkg:npm/react@18.2.0",
+		"pkg:pypi/Requests@2.31.0",
+		"pkg:npm/left-pad@1.3.0",
+		"pkg:npm/lodash",
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/api/cached", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.HandleCachedCheck(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp CachedCheckResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := map[string]CachedCheckResult{
+		"pkg:npm/lodash@4.17.21":   {Cached: true, Artifacts: 1},
+		"pkg:npm/react@18.2.0":     {Cached: false, Artifacts: 1},
+		"pkg:pypi/Requests@2.31.0": {Cached: false, Artifacts: 2},
+		"pkg:npm/left-pad@1.3.0":   {Cached: false},
+		"pkg:npm/lodash":           {Cached: false, Error: "purl has no version"},
+	}
+	if len(resp.PURLs) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(resp.PURLs), len(want), resp.PURLs)
+	}
+	for purl, w := range want {
+		if got := resp.PURLs[purl]; got != w {
+			t.Errorf("%s = %+v, want %+v", purl, got, w)
+		}
+	}
+	if resp.AllCached {
+		t.Error("all_cached = true, want false")
+	}
+}
+
+func TestHandleCachedCheck_EmptyPURLs(t *testing.T) {
+	h := NewAPIHandler(enrichment.New(slog.New(slog.NewTextHandler(os.Stdout, nil))), nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/cached", bytes.NewReader([]byte(`{"purls":[]}`)))
+	w := httptest.NewRecorder()
+	h.HandleCachedCheck(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+// CollisionsResponse lists groups of known packages whose names collide.
+type CollisionsResponse struct {
+	Collisions []database.NameCollision `json:"collisions"`
+	Count      int                      `json:"count"`
+}
+
+// HandleCollisions handles GET /api/collisions
+// @Summary List package name collisions
+// @Description Reports package names the proxy has seen in more than one ecosystem, or in spellings that differ only in case or '-', '_' and '.' separators. Either can point at a dependency confusion attempt. Names are compared after folding case and collapsing separators, the way PyPI normalizes names.
+// @Tags api
+// @Produce json
+// @Success 200 {object} CollisionsResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/collisions [get]
+func (h *APIHandler) HandleCollisions(w http.ResponseWriter, _ *http.Request) {
+	collisions, err := h.db.FindNameCollisions()
+	if err != nil {
+		internalError(w, "failed to find name collisions")
+		return
+	}
+	writeJSON(w, &CollisionsResponse{Collisions: collisions, Count: len(collisions)})
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/enrichment"
+)
+
+func TestHandleCollisions(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	for _, p := range []database.Package{
+		{PURL: "pkg:npm/foo", Ecosystem: "npm", Name: "foo"},
+		{PURL: "pkg:pypi/foo", Ecosystem: "pypi", Name: "foo"},
+		{PURL: "pkg:npm/bar", Ecosystem: "npm", Name: "bar"},
+	} {
+		if err := db.UpsertPackage(&p); err != nil {
+			t.Fatalf("UpsertPackage failed: %v", err)
+		}
+	}
+
+	h := NewAPIHandler(enrichment.New(slog.New(slog.NewTextHandler(os.Stdout, nil))), db)
+	w := httptest.NewRecorder()
+	h.HandleCollisions(w, httptest.NewRequest(http.MethodGet, "/api/collisions", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body.String())
+	}
+	var resp CollisionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Count != 1 || len(resp.Collisions) != 1 {
+		t.Fatalf("got %d collisions, want 1: %+v", resp.Count, resp.Collisions)
+	}
+	c := resp.Collisions[0]
+	if c.Key != "foo" || len(c.Ecosystems) != 2 || c.Ecosystems[0] != "npm" || c.Ecosystems[1] != "pypi" {
+		t.Errorf("collision = %+v, want foo in npm and pypi", c)
+	}
+}
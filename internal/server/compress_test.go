@@ -0,0 +1,122 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCompressMiddleware_Dashboard(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	ts.server.cfg.HTTP.Compression.Enabled = true
+
+	r := chi.NewRouter()
+	ts.server.mountUI(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/ui/", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := w.Header().Get("Vary"); !strings.Contains(got, "Accept-Encoding") {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	if got := w.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q, want none on a gzip response", got)
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	if !strings.Contains(string(body), "git-pkgs proxy") {
+		t.Error("decompressed dashboard should contain the title")
+	}
+}
+
+func TestCompressMiddleware_Passthrough(t *testing.T) {
+	large := strings.Repeat(`{"name":"lodash"},`, 200)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		encoding       string
+		body           string
+	}{
+		{"tiny response", "gzip", "application/json", "", `{"ok":true}`},
+		{"client without gzip", "", "application/json", "", large},
+		{"gzip refused", "gzip;q=0", "application/json", "", large},
+		{"already encoded", "gzip", "application/json", "br", large},
+		{"binary content", "gzip", "application/octet-stream", "", large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := CompressMiddleware(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				_, _ = io.WriteString(w, tt.body)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/packages", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("body was modified: got %d bytes, want %d", w.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestCompressMiddleware_KeepsStatus(t *testing.T) {
+	h := CompressMiddleware(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":"not found"}`)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/package/npm/missing", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("response over the threshold should be compressed")
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != `{"error":"not found"}` {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -66,6 +66,7 @@ type PackageShowData struct {
 	Versions        []database.Version
 	Vulnerabilities []database.Vulnerability
 	LicenseCategory string
+	Metadata        []MetadataFreshness
 }
 
 // VersionShowData contains data for rendering the version show page.
@@ -76,6 +77,7 @@ type VersionShowData struct {
 	Artifacts         []database.Artifact
 	Vulnerabilities   []database.Vulnerability
 	IsOutdated        bool
+	Yanked            bool
 	LicenseCategory   string
 	HasCachedArtifact bool
 }
@@ -154,6 +156,15 @@ func ecosystemBadgeLabel(ecosystem string) string {
 	}
 }
 
+// yankedLabel is the ecosystem's word for a version pulled by its publisher.
+// Go modules retract versions; most other registries yank them.
+func yankedLabel(ecosystem string) string {
+	if ecosystem == "golang" {
+		return "retracted"
+	}
+	return "yanked"
+}
+
 func ecosystemBadgeClasses(ecosystem string) string {
 	base := "inline-flex items-center px-2 py-0.5 rounded text-xs font-medium"
 
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/purl"
+	"github.com/go-chi/chi/v5"
+)
+
+// Dependency scopes reported by the deps endpoint.
+const (
+	DependencyScopeRuntime     = "runtime"
+	DependencyScopeDevelopment = "development"
+	DependencyScopePeer        = "peer"
+	DependencyScopeOptional    = "optional"
+	DependencyScopeBuild       = "build"
+)
+
+// maxManifestSize bounds how much of a manifest is read from an archive.
+const maxManifestSize = 1 << 20
+
+// manifestParser reads the declared dependencies from a manifest file.
+type manifestParser struct {
+	path  string
+	parse func(data []byte) ([]DependencyResult, error)
+}
+
+// manifestParsers maps each supported ecosystem to the manifest in its
+// artifacts, relative to the archive root openArchive strips to.
+var manifestParsers = map[string]manifestParser{
+	"npm":   {path: "package.json", parse: parsePackageJSONDeps},
+	"cargo": {path: "Cargo.toml", parse: parseCargoTomlDeps},
+}
+
+// errManifestMissing is returned when the artifact has no manifest.
+var errManifestMissing = errors.New("manifest not found in artifact")
+
+// DependencyResult is a dependency declared in a package's manifest.
+type DependencyResult struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`
+	Scope      string `json:"scope"`
+	Optional   bool   `json:"optional,omitempty"`
+	// Target is the platform condition a cargo dependency applies to,
+	// such as cfg(windows).
+	Target string `json:"target,omitempty"`
+}
+
+// DependenciesResponse lists the dependencies declared by a cached version.
+type DependenciesResponse struct {
+	Ecosystem    string             `json:"ecosystem"`
+	Name         string             `json:"name"`
+	Version      string             `json:"version"`
+	Manifest     string             `json:"manifest"`
+	Source       BrowseSource       `json:"source"`
+	Dependencies []DependencyResult `json:"dependencies"`
+}
+
+// HandleDepsPath handles GET /api/deps/{ecosystem}/{name}/{version}. The
+// last path segment is the version and everything before it the name.
+// @Summary List the dependencies a cached version declares
+// @Description Reads the manifest (package.json for npm, Cargo.toml for cargo) from the version's cached artifact and lists its declared dependencies with their version constraints. Nothing is fetched from upstream, so the version must be cached.
+// @Tags api
+// @Produce json
+// @Param ecosystem path string true "Ecosystem (npm or cargo)"
+// @Param name path string true "Package name"
+// @Param version path string true "Version"
+// @Param artifact query string false "Filename of the cached artifact to read"
+// @Success 200 {object} DependenciesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/deps/{ecosystem}/{name}/{version} [get]
+func (h *APIHandler) HandleDepsPath(w http.ResponseWriter, r *http.Request) {
+	ecosystem := chi.URLParam(r, "ecosystem")
+	wildcard := chi.URLParam(r, "*")
+	if err := validatePackagePath(wildcard); err != nil {
+		badRequest(w, err.Error())
+		return
+	}
+	segments := splitWildcardPath(wildcard)
+	if ecosystem == "" || len(segments) < 2 {
+		badRequest(w, "ecosystem, name and version are required")
+		return
+	}
+	name := strings.Join(segments[:len(segments)-1], "/")
+	version := segments[len(segments)-1]
+
+	parser, ok := manifestParsers[ecosystem]
+	if !ok {
+		badRequest(w, fmt.Sprintf("dependency listing is not supported for %s", ecosystem))
+		return
+	}
+	if h.db == nil || h.storage == nil {
+		internalError(w, "cache unavailable")
+		return
+	}
+
+	name = handler.Canonicalize(ecosystem, name)
+	artifacts, err := h.db.GetArtifactsByVersionPURL(purl.MakePURLString(ecosystem, name, version))
+	if err != nil {
+		internalError(w, "failed to look up artifacts")
+		return
+	}
+	if len(artifacts) == 0 {
+		notFound(w, "no artifacts cached")
+		return
+	}
+	cachedArtifact, msg := selectCachedArtifact(artifacts, r.URL.Query().Get("artifact"))
+	if cachedArtifact == nil {
+		notFound(w, msg)
+		return
+	}
+
+	data, err := h.readManifest(r, ecosystem, cachedArtifact.Filename, cachedArtifact.StoragePath.String, parser.path)
+	if errors.Is(err, errManifestMissing) {
+		notFound(w, fmt.Sprintf("%s not found in %s", parser.path, cachedArtifact.Filename))
+		return
+	}
+	if err != nil {
+		internalError(w, "failed to read manifest")
+		return
+	}
+
+	deps, err := parser.parse(data)
+	if err != nil {
+		internalError(w, fmt.Sprintf("failed to parse %s", parser.path))
+		return
+	}
+	sortDependencies(deps)
+
+	writeJSON(w, &DependenciesResponse{
+		Ecosystem:    ecosystem,
+		Name:         name,
+		Version:      version,
+		Manifest:     parser.path,
+		Source:       newBrowseSource(cachedArtifact),
+		Dependencies: deps,
+	})
+}
+
+// readManifest extracts manifestPath from the cached artifact at
+// storagePath.
+func (h *APIHandler) readManifest(r *http.Request, ecosystem, filename, storagePath, manifestPath string) ([]byte, error) {
+	content, err := h.storage.Open(r.Context(), storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening artifact: %w", err)
+	}
+	defer func() { _ = content.Close() }()
+
+	archive, err := openArchive(filename, content, ecosystem)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = archive.Close() }()
+
+	manifest, err := archive.Extract(manifestPath)
+	if err != nil {
+		return nil, errManifestMissing
+	}
+	defer func() { _ = manifest.Close() }()
+	return io.ReadAll(io.LimitReader(manifest, maxManifestSize))
+}
+
+// parsePackageJSONDeps reads the dependency maps of an npm package.json.
+func parsePackageJSONDeps(data []byte) ([]DependencyResult, error) {
+	var manifest struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	deps := []DependencyResult{}
+	for _, group := range []struct {
+		scope string
+		deps  map[string]string
+	}{
+		{DependencyScopeRuntime, manifest.Dependencies},
+		{DependencyScopeDevelopment, manifest.DevDependencies},
+		{DependencyScopePeer, manifest.PeerDependencies},
+		{DependencyScopeOptional, manifest.OptionalDependencies},
+	} {
+		for name, constraint := range group.deps {
+			deps = append(deps, DependencyResult{
+				Name:       name,
+				Constraint: constraint,
+				Scope:      group.scope,
+				Optional:   group.scope == DependencyScopeOptional,
+			})
+		}
+	}
+	return deps, nil
+}
+
+// cargoDependencyTables holds the dependency tables of a Cargo.toml, at
+// the top level or under a [target.'cfg(...)'] table.
+type cargoDependencyTables struct {
+	Dependencies      map[string]toml.Primitive `toml:"dependencies"`
+	DevDependencies   map[string]toml.Primitive `toml:"dev-dependencies"`
+	BuildDependencies map[string]toml.Primitive `toml:"build-dependencies"`
+}
+
+// cargoDependency is the table form of a Cargo.toml dependency.
+type cargoDependency struct {
+	Version  string `toml:"version"`
+	Package  string `toml:"package"`
+	Optional bool   `toml:"optional"`
+}
+
+// parseCargoTomlDeps reads the dependency tables of a Cargo.toml. A
+// dependency is either a version string or a table; a renamed dependency
+// is reported under its crate name.
+func parseCargoTomlDeps(data []byte) ([]DependencyResult, error) {
+	var manifest struct {
+		cargoDependencyTables
+		Target map[string]cargoDependencyTables `toml:"target"`
+	}
+	md, err := toml.Decode(string(data), &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := []DependencyResult{}
+	add := func(tables cargoDependencyTables, target string) error {
+		for _, group := range []struct {
+			scope string
+			deps  map[string]toml.Primitive
+		}{
+			{DependencyScopeRuntime, tables.Dependencies},
+			{DependencyScopeDevelopment, tables.DevDependencies},
+			{DependencyScopeBuild, tables.BuildDependencies},
+		} {
+			for name, value := range group.deps {
+				dep := DependencyResult{Name: name, Scope: group.scope, Target: target}
+				var constraint string
+				if err := md.PrimitiveDecode(value, &constraint); err == nil {
+					dep.Constraint = constraint
+				} else {
+					var table cargoDependency
+					if err := md.PrimitiveDecode(value, &table); err != nil {
+						return fmt.Errorf("dependency %s: %w", name, err)
+					}
+					dep.Constraint = table.Version
+					dep.Optional = table.Optional
+					if table.Package != "" {
+						dep.Name = table.Package
+					}
+				}
+				deps = append(deps, dep)
+			}
+		}
+		return nil
+	}
+
+	if err := add(manifest.cargoDependencyTables, ""); err != nil {
+		return nil, err
+	}
+	for target, tables := range manifest.Target {
+		if err := add(tables, target); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+// dependencyScopeOrder lists scopes in the order dependencies are returned.
+var dependencyScopeOrder = map[string]int{
+	DependencyScopeRuntime:     0,
+	DependencyScopeBuild:       1,
+	DependencyScopeDevelopment: 2,
+	DependencyScopePeer:        3,
+	DependencyScopeOptional:    4,
+}
+
+// sortDependencies orders dependencies by scope, then target, then name,
+// so responses are stable.
+func sortDependencies(deps []DependencyResult) {
+	sort.Slice(deps, func(i, j int) bool {
+		a, b := deps[i], deps[j]
+		if a.Scope != b.Scope {
+			return dependencyScopeOrder[a.Scope] < dependencyScopeOrder[b.Scope]
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Name < b.Name
+	})
+}
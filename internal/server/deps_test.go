@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/storage"
+	"github.com/git-pkgs/purl"
+	"github.com/go-chi/chi/v5"
+)
+
+// cacheTestArchive records a cached artifact for ecosystem/name@version
+// and writes data to its storage path.
+func cacheTestArchive(t *testing.T, db *database.DB, store storage.Storage, ecosystem, name, version, filename string, data []byte) {
+	t.Helper()
+	pkgPURL := purl.MakePURLString(ecosystem, name, "")
+	if err := db.UpsertPackage(&database.Package{PURL: pkgPURL, Ecosystem: ecosystem, Name: name}); err != nil {
+		t.Fatalf("UpsertPackage: %v", err)
+	}
+	versionPURL := purl.MakePURLString(ecosystem, name, version)
+	if err := db.UpsertVersion(&database.Version{PURL: versionPURL, PackagePURL: pkgPURL}); err != nil {
+		t.Fatalf("UpsertVersion: %v", err)
+	}
+	storagePath := ecosystem + "/" + name + "/" + filename
+	if _, _, err := store.Store(context.Background(), storagePath, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if err := db.UpsertArtifact(&database.Artifact{
+		VersionPURL: versionPURL,
+		Filename:    filename,
+		UpstreamURL: "https://example.com/" + filename,
+		StoragePath: sql.NullString{String: storagePath, Valid: true},
+	}); err != nil {
+		t.Fatalf("UpsertArtifact: %v", err)
+	}
+}
+
+func newDepsTestRouter(t *testing.T) (http.Handler, *database.DB, storage.Storage) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.Create(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	store, err := storage.NewFilesystem(filepath.Join(dir, "artifacts"))
+	if err != nil {
+		t.Fatalf("NewFilesystem: %v", err)
+	}
+
+	h := NewAPIHandler(nil, db)
+	h.storage = store
+	r := chi.NewRouter()
+	r.Get("/api/deps/{ecosystem}/*", h.HandleDepsPath)
+	return r, db, store
+}
+
+func getDeps(t *testing.T, r http.Handler, path string) (int, DependenciesResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var resp DependenciesResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestPackageDepsNPM(t *testing.T) {
+	r, db, store := newDepsTestRouter(t)
+	tarball := createTarGzArchive(t, map[string]string{
+		"package/package.json": `{
+			"name": "@acme/widget",
+			"version": "2.1.0",
+			"dependencies": {"lodash": "^4.17.21", "@babel/core": "7.x"},
+			"devDependencies": {"jest": "^29.0.0"},
+			"peerDependencies": {"react": ">=17"},
+			"optionalDependencies": {"fsevents": "~2.3.2"}
+		}`,
+		"package/index.js": "module.exports = {}",
+	})
+	cacheTestArchive(t, db, store, "npm", "@acme/widget", "2.1.0", "widget-2.1.0.tgz", tarball)
+
+	code, resp := getDeps(t, r, "/api/deps/npm/@acme/widget/2.1.0")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if resp.Manifest != "package.json" || resp.Source.Filename != "widget-2.1.0.tgz" || resp.Name != "@acme/widget" {
+		t.Errorf("response header fields = %+v", resp)
+	}
+	want := []DependencyResult{
+		{Name: "@babel/core", Constraint: "7.x", Scope: DependencyScopeRuntime},
+		{Name: "lodash", Constraint: "^4.17.21", Scope: DependencyScopeRuntime},
+		{Name: "jest", Constraint: "^29.0.0", Scope: DependencyScopeDevelopment},
+		{Name: "react", Constraint: ">=17", Scope: DependencyScopePeer},
+		{Name: "fsevents", Constraint: "~2.3.2", Scope: DependencyScopeOptional, Optional: true},
+	}
+	if !reflect.DeepEqual(resp.Dependencies, want) {
+		t.Errorf("dependencies = %+v, want %+v", resp.Dependencies, want)
+	}
+}
+
+func TestPackageDepsCargo(t *testing.T) {
+	r, db, store := newDepsTestRouter(t)
+	crate := createTarGzArchive(t, map[string]string{
+		"widget-0.3.0/Cargo.toml": `
+[package]
+name = "widget"
+version = "0.3.0"
+
+[dependencies]
+serde = { version = "1.0", features = ["derive"] }
+log = "0.4"
+json = { package = "serde_json", version = "1", optional = true }
+
+[dev-dependencies]
+tempfile = "3"
+
+[build-dependencies]
+cc = "1.0"
+
+[target.'cfg(windows)'.dependencies]
+winapi = "0.3"
+`,
+		"widget-0.3.0/src/lib.rs": "",
+	})
+	cacheTestArchive(t, db, store, "cargo", "widget", "0.3.0", "widget-0.3.0.crate", crate)
+
+	code, resp := getDeps(t, r, "/api/deps/cargo/widget/0.3.0")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	want := []DependencyResult{
+		{Name: "log", Constraint: "0.4", Scope: DependencyScopeRuntime},
+		{Name: "serde", Constraint: "1.0", Scope: DependencyScopeRuntime},
+		{Name: "serde_json", Constraint: "1", Scope: DependencyScopeRuntime, Optional: true},
+		{Name: "winapi", Constraint: "0.3", Scope: DependencyScopeRuntime, Target: "cfg(windows)"},
+		{Name: "cc", Constraint: "1.0", Scope: DependencyScopeBuild},
+		{Name: "tempfile", Constraint: "3", Scope: DependencyScopeDevelopment},
+	}
+	if !reflect.DeepEqual(resp.Dependencies, want) {
+		t.Errorf("dependencies = %+v, want %+v", resp.Dependencies, want)
+	}
+}
+
+func TestPackageDepsErrors(t *testing.T) {
+	r, db, store := newDepsTestRouter(t)
+	cacheTestArchive(t, db, store, "npm", "no-manifest", "1.0.0", "no-manifest-1.0.0.tgz",
+		createTarGzArchive(t, map[string]string{"package/index.js": ""}))
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/api/deps/npm/no-manifest/1.0.0", http.StatusNotFound},
+		{"/api/deps/npm/not-cached/1.0.0", http.StatusNotFound},
+		{"/api/deps/pypi/requests/2.0.0", http.StatusBadRequest},
+		{"/api/deps/npm/no-version", http.StatusBadRequest},
+	} {
+		if code, _ := getDeps(t, r, tc.path); code != tc.want {
+			t.Errorf("GET %s status = %d, want %d", tc.path, code, tc.want)
+		}
+	}
+}
@@ -1,17 +1,25 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 )
 
 // Error codes returned in API error responses. These are stable identifiers
 // that clients can match on; the message text is for humans and may change.
 const (
-	ErrCodeBadRequest = "BAD_REQUEST"
-	ErrCodeNotFound   = "NOT_FOUND"
-	ErrCodeUpstream   = "UPSTREAM_ERROR"
-	ErrCodeInternal   = "INTERNAL_ERROR"
+	ErrCodeBadRequest      = "BAD_REQUEST"
+	ErrCodeNotFound        = "NOT_FOUND"
+	ErrCodeUnauthorized    = "UNAUTHORIZED"
+	ErrCodeConflict        = "CONFLICT"
+	ErrCodePayloadTooLarge = "PAYLOAD_TOO_LARGE"
+	ErrCodeTimeout         = "TIMEOUT"
+	ErrCodeUpstream        = "UPSTREAM_ERROR"
+	ErrCodeInternal        = "INTERNAL_ERROR"
 )
 
 // ErrorResponse is the JSON body returned for API errors.
@@ -40,3 +48,53 @@ func notFound(w http.ResponseWriter, message string) {
 func internalError(w http.ResponseWriter, message string) {
 	writeError(w, http.StatusInternalServerError, ErrCodeInternal, message)
 }
+
+// decodeJSONBody decodes the request body into v, reading at most limit
+// bytes. On failure it writes a 413 for an oversized body or a 400 for
+// malformed JSON and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", limit))
+			return false
+		}
+		badRequest(w, "invalid request body")
+		return false
+	}
+	return true
+}
+
+// checkItemLimit writes a 400 and returns false when a request lists more
+// than limit entries in field.
+func checkItemLimit(w http.ResponseWriter, field string, n, limit int) bool {
+	if n > limit {
+		badRequest(w, fmt.Sprintf("too many %s: got %d, limit is %d per request", field, n, limit))
+		return false
+	}
+	return true
+}
+
+// writeTimeoutIfExpired writes a 504 and returns true when the request
+// context's deadline passed while the handler was working.
+func writeTimeoutIfExpired(w http.ResponseWriter, r *http.Request) bool {
+	if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		return false
+	}
+	writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "request timed out")
+	return true
+}
+
+// requestTimeout bounds each request's context to d. Handlers check the
+// deadline with writeTimeoutIfExpired.
+func requestTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -2,9 +2,13 @@ package server
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
+	"net/http"
 	"time"
 
+	"github.com/git-pkgs/proxy/internal/config"
 	"github.com/git-pkgs/proxy/internal/database"
 	"github.com/git-pkgs/proxy/internal/storage"
 )
@@ -38,6 +42,8 @@ func (s *Server) startEvictionLoop(ctx context.Context) {
 }
 
 func (s *Server) runEviction(ctx context.Context, maxSize int64) {
+	s.evictMu.Lock()
+	defer s.evictMu.Unlock()
 	evictLRU(ctx, s.db, s.storage, s.logger, maxSize)
 }
 
@@ -103,3 +109,150 @@ func evictLRU(ctx context.Context, db *database.DB, store storage.Storage, logge
 			"evicted", evicted, "freed_bytes", freedBytes)
 	}
 }
+
+// EvictionPreviewResponse lists the artifacts LRU eviction would remove to
+// bring the cache under a target size.
+type EvictionPreviewResponse struct {
+	TargetSize    int64                   `json:"target_size_bytes"`
+	CurrentSize   int64                   `json:"current_size_bytes"`
+	ProjectedSize int64                   `json:"projected_size_bytes"`
+	FreedBytes    int64                   `json:"freed_bytes"`
+	TargetMet     bool                    `json:"target_met"`
+	Count         int                     `json:"count"`
+	Artifacts     []EvictionPreviewResult `json:"artifacts"`
+}
+
+// EvictionPreviewResult is one artifact in eviction order.
+type EvictionPreviewResult struct {
+	VersionPURL     string `json:"version_purl"`
+	Filename        string `json:"filename"`
+	Size            int64  `json:"size_bytes"`
+	LastAccessedAt  string `json:"last_accessed_at,omitempty"`
+	CumulativeFreed int64  `json:"cumulative_freed_bytes"`
+}
+
+// handleEvictionPreview reports what LRU eviction would remove without
+// deleting anything.
+// @Summary Preview LRU eviction
+// @Description Lists cached artifacts in least-recently-used order until removing them would bring the cache under target_size. Nothing is deleted. target_size defaults to storage.max_size. Only served when admin.token is set; send it as a bearer token.
+// @Tags api
+// @Produce json
+// @Param target_size query string false "Target cache size, e.g. 5GB"
+// @Success 200 {object} EvictionPreviewResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/eviction/preview [get]
+func (s *Server) handleEvictionPreview(w http.ResponseWriter, r *http.Request) {
+	target := s.cfg.ParseMaxSize()
+	if v := r.URL.Query().Get("target_size"); v != "" {
+		size, err := config.ParseSize(v)
+		if err != nil || size < 0 {
+			badRequest(w, "invalid target_size")
+			return
+		}
+		target = size
+	} else if target <= 0 {
+		badRequest(w, "target_size is required when storage.max_size is unset")
+		return
+	}
+
+	totalSize, err := s.db.GetTotalCacheSize()
+	if err != nil {
+		internalError(w, "failed to get cache size")
+		return
+	}
+
+	resp := &EvictionPreviewResponse{
+		TargetSize:  target,
+		CurrentSize: totalSize,
+		Artifacts:   []EvictionPreviewResult{},
+	}
+
+	// Read the LRU order a batch at a time, as evictLRU does, and stop
+	// once the target is met rather than loading every artifact.
+	for offset := 0; totalSize-resp.FreedBytes > target; offset += evictionBatch {
+		artifacts, err := s.db.ListLeastRecentlyUsedArtifacts(offset, evictionBatch)
+		if err != nil {
+			internalError(w, "failed to list artifacts")
+			return
+		}
+		if len(artifacts) == 0 {
+			break
+		}
+		for _, art := range artifacts {
+			if totalSize-resp.FreedBytes <= target {
+				break
+			}
+			size := int64(0)
+			if art.Size.Valid {
+				size = art.Size.Int64
+			}
+			resp.FreedBytes += size
+			result := EvictionPreviewResult{
+				VersionPURL:     art.VersionPURL,
+				Filename:        art.Filename,
+				Size:            size,
+				CumulativeFreed: resp.FreedBytes,
+			}
+			if art.LastAccessedAt.Valid {
+				result.LastAccessedAt = art.LastAccessedAt.Time.UTC().Format(time.RFC3339)
+			}
+			resp.Artifacts = append(resp.Artifacts, result)
+		}
+	}
+
+	resp.ProjectedSize = totalSize - resp.FreedBytes
+	resp.TargetMet = resp.ProjectedSize <= target
+	resp.Count = len(resp.Artifacts)
+
+	writeJSON(w, resp)
+}
+
+// PinRequest sets or clears the pinned flag on one cached artifact.
+type PinRequest struct {
+	VersionPURL string `json:"version_purl"`
+	Filename    string `json:"filename"`
+	Pinned      bool   `json:"pinned"`
+}
+
+// handleArtifactPin pins or unpins an artifact.
+// @Summary Pin or unpin an artifact
+// @Description Pinned artifacts are never removed by LRU eviction and are left out of the eviction preview. Use this for baseline artifacts such as a golden base image. Send pinned=false to make an artifact evictable again.
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param request body PinRequest true "Artifact to pin"
+// @Success 200 {object} PinRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/artifacts/pin [post]
+func (s *Server) handleArtifactPin(w http.ResponseWriter, r *http.Request) {
+	var req PinRequest
+	if !decodeJSONBody(w, r, s.cfg.ParseAPIMaxBodySize(), &req) {
+		return
+	}
+	if req.VersionPURL == "" || req.Filename == "" {
+		badRequest(w, "version_purl and filename are required")
+		return
+	}
+
+	err := s.db.PinArtifact(req.VersionPURL, req.Filename, req.Pinned)
+	if errors.Is(err, sql.ErrNoRows) {
+		notFound(w, "artifact not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to pin artifact", "error", err,
+			"version_purl", req.VersionPURL, "filename", req.Filename)
+		internalError(w, "failed to update artifact")
+		return
+	}
+
+	s.logger.Info("artifact pin updated",
+		"version_purl", req.VersionPURL, "filename", req.Filename, "pinned", req.Pinned)
+	writeJSON(w, req)
+}
@@ -3,8 +3,12 @@ package server
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -149,6 +153,59 @@ func TestEvictLRU_EvictsOldestFirst(t *testing.T) {
 	}
 }
 
+func TestEvictLRU_SkipsPinned(t *testing.T) {
+	db, store := setupEvictionTest(t)
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	now := time.Now()
+	seedArtifact(t, ctx, db, store, "golden", 500, now.Add(-3*time.Hour))
+	seedArtifact(t, ctx, db, store, "mid-pkg", 500, now.Add(-1*time.Hour))
+	seedArtifact(t, ctx, db, store, "new-pkg", 500, now)
+
+	if err := db.PinArtifact("pkg:npm/golden@1.0.0", "golden-1.0.0.tgz", true); err != nil {
+		t.Fatalf("PinArtifact failed: %v", err)
+	}
+
+	evictLRU(ctx, db, store, logger, 1100)
+
+	golden, err := db.GetArtifact("pkg:npm/golden@1.0.0", "golden-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("failed to get artifact: %v", err)
+	}
+	if !golden.StoragePath.Valid || !golden.Pinned {
+		t.Error("expected pinned artifact to survive eviction although it is least recently used")
+	}
+	mid, err := db.GetArtifact("pkg:npm/mid-pkg@1.0.0", "mid-pkg-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("failed to get artifact: %v", err)
+	}
+	if mid.StoragePath.Valid {
+		t.Error("expected the oldest unpinned artifact to be evicted instead")
+	}
+}
+
+func TestEvictLRU_AllPinnedStops(t *testing.T) {
+	db, store := setupEvictionTest(t)
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	seedArtifact(t, ctx, db, store, "golden", 500, time.Now())
+	if err := db.PinArtifact("pkg:npm/golden@1.0.0", "golden-1.0.0.tgz", true); err != nil {
+		t.Fatalf("PinArtifact failed: %v", err)
+	}
+
+	evictLRU(ctx, db, store, logger, 100)
+
+	count, err := db.GetCachedArtifactCount()
+	if err != nil {
+		t.Fatalf("failed to get count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected pinned artifact to stay cached over the limit, got count %d", count)
+	}
+}
+
 func TestEvictLRU_EvictsMultipleToGetUnderLimit(t *testing.T) {
 	db, store := setupEvictionTest(t)
 	ctx := context.Background()
@@ -288,3 +345,250 @@ func defaultTestConfig(storagePath, dbPath string) *config.Config {
 		Log: config.LogConfig{Level: "info", Format: "text"},
 	}
 }
+
+func TestEvictionPreview_SelectsLeastRecentlyUsedUntilTarget(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	ctx := context.Background()
+
+	store, err := storage.NewFilesystem(filepath.Join(ts.tempDir, "artifacts"))
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	now := time.Now()
+	seedArtifact(t, ctx, ts.db, store, "pkg-new", 300, now)
+	seedArtifact(t, ctx, ts.db, store, "pkg-oldest", 400, now.Add(-4*time.Hour))
+	seedArtifact(t, ctx, ts.db, store, "pkg-mid", 200, now.Add(-2*time.Hour))
+	seedArtifact(t, ctx, ts.db, store, "pkg-old", 100, now.Add(-3*time.Hour))
+
+	// Total is 1000 bytes. Getting under 450 needs pkg-oldest, pkg-old and
+	// pkg-mid (700 bytes), leaving pkg-new alone.
+	w := previewEviction(ts, "?target_size=450B")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp EvictionPreviewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	wantOrder := []string{"pkg-oldest-1.0.0.tgz", "pkg-old-1.0.0.tgz", "pkg-mid-1.0.0.tgz"}
+	wantCumulative := []int64{400, 500, 700}
+	if len(resp.Artifacts) != len(wantOrder) {
+		t.Fatalf("got %d artifacts, want %d: %+v", len(resp.Artifacts), len(wantOrder), resp.Artifacts)
+	}
+	for i, art := range resp.Artifacts {
+		if art.Filename != wantOrder[i] {
+			t.Errorf("artifacts[%d] = %s, want %s", i, art.Filename, wantOrder[i])
+		}
+		if art.CumulativeFreed != wantCumulative[i] {
+			t.Errorf("artifacts[%d] cumulative = %d, want %d", i, art.CumulativeFreed, wantCumulative[i])
+		}
+	}
+	if resp.CurrentSize != 1000 || resp.FreedBytes != 700 || resp.ProjectedSize != 300 || !resp.TargetMet {
+		t.Errorf("unexpected totals: %+v", resp)
+	}
+
+	// Nothing was deleted.
+	count, err := ts.db.GetCachedArtifactCount()
+	if err != nil {
+		t.Fatalf("failed to get count: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 cached artifacts after preview, got %d", count)
+	}
+}
+
+// previewEviction requests an eviction preview with the admin token.
+func previewEviction(ts *testServer, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/eviction/preview"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	return w
+}
+
+// The preview reads the LRU order in batches and stops once the target is
+// met, so it works the same past the first batch.
+func TestEvictionPreview_PagesThroughBatches(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	ctx := context.Background()
+
+	const n = 2*evictionBatch + 10
+	now := time.Now()
+	for i := range n {
+		seedArtifact(t, ctx, ts.db, ts.storage, fmt.Sprintf("pkg-%03d", i), 10, now.Add(time.Duration(i-n)*time.Minute))
+	}
+
+	// Reaching 50 bytes needs all but the five newest.
+	w := previewEviction(ts, "?target_size=50B")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp EvictionPreviewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Count != n-5 || !resp.TargetMet || resp.ProjectedSize != 50 {
+		t.Fatalf("count = %d, projected = %d, met = %v; want %d, 50, true", resp.Count, resp.ProjectedSize, resp.TargetMet, n-5)
+	}
+	for i, art := range resp.Artifacts {
+		if want := fmt.Sprintf("pkg-%03d-1.0.0.tgz", i); art.Filename != want {
+			t.Fatalf("artifacts[%d] = %s, want %s", i, art.Filename, want)
+		}
+	}
+}
+
+func TestEvictionPreview_RequiresAdminToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	for _, auth := range []string{"", "Bearer wrong-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/eviction/preview?target_size=5GB", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestEvictionPreview_UnderTarget(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	w := previewEviction(ts, "?target_size=5GB")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp EvictionPreviewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.TargetSize != 5<<30 || resp.Count != 0 || !resp.TargetMet {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestEvictionPreview_BadTarget(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	for _, query := range []string{"", "?target_size=lots"} {
+		w := previewEviction(ts, query)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func pinArtifact(t *testing.T, ts *testServer, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/artifacts/pin", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestEvictionPreview_SkipsPinned(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	ctx := context.Background()
+
+	now := time.Now()
+	seedArtifact(t, ctx, ts.db, ts.storage, "golden", 400, now.Add(-4*time.Hour))
+	seedArtifact(t, ctx, ts.db, ts.storage, "pkg-old", 100, now.Add(-3*time.Hour))
+	seedArtifact(t, ctx, ts.db, ts.storage, "pkg-new", 300, now)
+
+	w := pinArtifact(t, ts, `{"version_purl":"pkg:npm/golden@1.0.0","filename":"golden-1.0.0.tgz","pinned":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("pin status = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = previewEviction(ts, "?target_size=500B")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp EvictionPreviewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	for _, art := range resp.Artifacts {
+		if art.Filename == "golden-1.0.0.tgz" {
+			t.Fatalf("pinned artifact listed for eviction: %+v", resp.Artifacts)
+		}
+	}
+	if len(resp.Artifacts) != 2 || resp.Artifacts[0].Filename != "pkg-old-1.0.0.tgz" {
+		t.Errorf("artifacts = %+v, want pkg-old then pkg-new", resp.Artifacts)
+	}
+
+	// Unpinning makes it evictable again.
+	w = pinArtifact(t, ts, `{"version_purl":"pkg:npm/golden@1.0.0","filename":"golden-1.0.0.tgz","pinned":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unpin status = %d: %s", w.Code, w.Body.String())
+	}
+	lru, err := ts.db.GetLeastRecentlyUsedArtifacts(1)
+	if err != nil {
+		t.Fatalf("GetLeastRecentlyUsedArtifacts failed: %v", err)
+	}
+	if len(lru) != 1 || lru[0].Filename != "golden-1.0.0.tgz" {
+		t.Errorf("lru = %+v, want golden first once unpinned", lru)
+	}
+}
+
+func TestArtifactPin_Errors(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"version_purl":"pkg:npm/missing@1.0.0","filename":"missing-1.0.0.tgz","pinned":true}`, http.StatusNotFound},
+		{`{"version_purl":"pkg:npm/missing@1.0.0","pinned":true}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := pinArtifact(t, ts, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
+
+func TestArtifactPin_RequiresAdminToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	seedArtifact(t, context.Background(), ts.db, ts.storage, "golden", 400, time.Now().Add(-time.Hour))
+
+	for _, auth := range []string{"", "Bearer wrong-token"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/artifacts/pin",
+			strings.NewReader(`{"version_purl":"pkg:npm/golden@1.0.0","filename":"golden-1.0.0.tgz","pinned":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	lru, err := ts.db.GetLeastRecentlyUsedArtifacts(1)
+	if err != nil {
+		t.Fatalf("GetLeastRecentlyUsedArtifacts failed: %v", err)
+	}
+	if len(lru) != 1 || lru[0].Filename != "golden-1.0.0.tgz" {
+		t.Errorf("lru = %+v, want golden still evictable", lru)
+	}
+}
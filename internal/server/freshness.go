@@ -0,0 +1,45 @@
+package server
+
+import (
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+// MetadataFreshness describes one cached metadata document. Unlike
+// artifacts, metadata changes upstream, so a document is Stale once it is
+// older than its TTL. The next request for it goes upstream, or gets the
+// stale copy if upstream is unreachable.
+type MetadataFreshness struct {
+	Key       string `json:"key"`
+	FetchedAt string `json:"fetched_at,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+	Stale     bool   `json:"stale"`
+
+	// FetchedTime is FetchedAt as a time, for the dashboard templates.
+	FetchedTime time.Time `json:"-"`
+}
+
+// metadataFreshness reports the freshness of each cached metadata entry as
+// of now. ttl gives the TTL for an entry's cache key; a nil ttl, or a TTL of
+// zero, marks nothing stale.
+func metadataFreshness(entries []database.MetadataCacheEntry, ttl func(ecosystem, cacheKey string) time.Duration, now time.Time) []MetadataFreshness {
+	result := make([]MetadataFreshness, 0, len(entries))
+	for _, e := range entries {
+		m := MetadataFreshness{Key: e.Name}
+		var d time.Duration
+		if ttl != nil {
+			d = ttl(e.Ecosystem, e.Name)
+		}
+		if d > 0 {
+			m.TTL = d.String()
+		}
+		if e.FetchedAt.Valid {
+			m.FetchedTime = e.FetchedAt.Time
+			m.FetchedAt = e.FetchedAt.Time.UTC().Format(time.RFC3339)
+			m.Stale = d > 0 && now.Sub(e.FetchedAt.Time) > d
+		}
+		result = append(result, m)
+	}
+	return result
+}
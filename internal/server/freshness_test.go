@@ -0,0 +1,92 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMetadataFreshness(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	entries := []database.MetadataCacheEntry{
+		{Ecosystem: "pypi", Name: "requests", FetchedAt: sql.NullTime{Time: now.Add(-time.Minute), Valid: true}},
+		{Ecosystem: "pypi", Name: "requests/simple", FetchedAt: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}},
+	}
+	ttl := func(_, _ string) time.Duration { return 5 * time.Minute }
+
+	got := metadataFreshness(entries, ttl, now)
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if got[0].Stale || got[0].TTL != "5m0s" {
+		t.Errorf("recent entry = %+v, want fresh with a 5m TTL", got[0])
+	}
+	if !got[1].Stale {
+		t.Errorf("hour-old entry = %+v, want stale", got[1])
+	}
+
+	for _, m := range metadataFreshness(entries, nil, now) {
+		if m.Stale {
+			t.Errorf("%s reported stale without a TTL", m.Key)
+		}
+	}
+}
+
+func TestHandlePackageVersions_CacheTimes(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	fetched := time.Now().Add(-30 * 24 * time.Hour).UTC().Truncate(time.Second)
+	_ = db.UpsertPackage(&database.Package{PURL: "pkg:npm/lodash", Ecosystem: testEcosystemNPM, Name: "lodash"})
+	_ = db.UpsertVersion(&database.Version{PURL: "pkg:npm/lodash@4.17.21", PackagePURL: "pkg:npm/lodash"})
+	if err := db.UpsertArtifact(&database.Artifact{
+		VersionPURL: "pkg:npm/lodash@4.17.21",
+		Filename:    "lodash-4.17.21.tgz",
+		UpstreamURL: "https://registry.npmjs.org/lodash/-/lodash-4.17.21.tgz",
+		StoragePath: sql.NullString{String: "npm/lodash/4.17.21/lodash-4.17.21.tgz", Valid: true},
+		FetchedAt:   sql.NullTime{Time: fetched, Valid: true},
+	}); err != nil {
+		t.Fatalf("UpsertArtifact failed: %v", err)
+	}
+	if err := db.UpsertMetadataCache(&database.MetadataCacheEntry{
+		Ecosystem:   testEcosystemNPM,
+		Name:        "lodash",
+		StoragePath: "_metadata/npm/lodash/metadata",
+		FetchedAt:   sql.NullTime{Time: fetched, Valid: true},
+	}); err != nil {
+		t.Fatalf("UpsertMetadataCache failed: %v", err)
+	}
+
+	h := NewAPIHandler(nil, db)
+	h.metadataTTL = func(_, _ string) time.Duration { return time.Hour }
+	r := chi.NewRouter()
+	r.Get("/api/versions/{ecosystem}/*", h.HandleVersionsPath)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/versions/npm/lodash", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp PackageVersionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	v := resp.Versions[0]
+	if v.FirstCachedAt == "" || v.LastFetchedAt != fetched.Format(time.RFC3339) {
+		t.Errorf("version = %+v, want first_cached_at set and last_fetched_at %s", v, fetched.Format(time.RFC3339))
+	}
+	if len(resp.Metadata) != 1 || !resp.Metadata[0].Stale {
+		t.Errorf("metadata = %+v, want one stale document", resp.Metadata)
+	}
+}
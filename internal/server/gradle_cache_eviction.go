@@ -35,7 +35,7 @@ func (s *Server) startGradleBuildCacheEviction(ctx context.Context) {
 		"interval", interval)
 
 	sweep := func() {
-		deletedCount, freedBytes, err := sweepGradleBuildCache(ctx, s.storage, lister, maxAge, maxSize, time.Now())
+		deletedCount, freedBytes, err := sweepGradleBuildCache(ctx, s.storage, lister, s.cfg.Storage.Prefix, maxAge, maxSize, time.Now())
 		if err != nil {
 			s.logger.Warn("gradle cache eviction sweep failed", "error", err)
 			return
@@ -68,11 +68,12 @@ func sweepGradleBuildCache(
 	ctx context.Context,
 	store storage.Storage,
 	lister gradleBuildCacheLister,
+	prefix string,
 	maxAge time.Duration,
 	maxSize int64,
 	now time.Time,
 ) (int, int64, error) {
-	entries, err := lister.ListPrefix(ctx, gradleBuildCacheStoragePrefix)
+	entries, err := lister.ListPrefix(ctx, storage.PrefixedPath(prefix, gradleBuildCacheStoragePrefix))
 	if err != nil {
 		return 0, 0, fmt.Errorf("listing gradle cache entries: %w", err)
 	}
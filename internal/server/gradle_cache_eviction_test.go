@@ -88,7 +88,7 @@ func TestSweepGradleBuildCache_MaxAge(t *testing.T) {
 		{Path: "_gradle/http-build-cache/new", Size: 10, ModTime: now.Add(-2 * time.Hour)},
 	})
 
-	deleted, freed, err := sweepGradleBuildCache(context.Background(), store, store, 24*time.Hour, 0, now)
+	deleted, freed, err := sweepGradleBuildCache(context.Background(), store, store, "", 24*time.Hour, 0, now)
 	if err != nil {
 		t.Fatalf("sweepGradleBuildCache() error = %v", err)
 	}
@@ -115,7 +115,7 @@ func TestSweepGradleBuildCache_MaxSizeOldestFirst(t *testing.T) {
 		{Path: "_gradle/http-build-cache/c", Size: 5, ModTime: now.Add(-1 * time.Hour)},
 	})
 
-	deleted, freed, err := sweepGradleBuildCache(context.Background(), store, store, 0, 10, now)
+	deleted, freed, err := sweepGradleBuildCache(context.Background(), store, store, "", 0, 10, now)
 	if err != nil {
 		t.Fatalf("sweepGradleBuildCache() error = %v", err)
 	}
@@ -50,12 +50,18 @@ func (e *probeError) Unwrap() error { return e.err }
 
 // storageProbe runs a write → size-check → read → verify → delete round-trip
 // against the storage backend. Returns nil on success or a *probeError on failure.
-func storageProbe(ctx context.Context, s storage.Storage) (err error) {
+func storageProbe(ctx context.Context, s storage.Storage) error {
+	return storageProbeUnder(ctx, s, "")
+}
+
+// storageProbeUnder is storageProbe with the probe object written inside
+// the storage prefix.
+func storageProbeUnder(ctx context.Context, s storage.Storage, prefix string) (err error) {
 	suffix, suffixErr := randomSuffix()
 	if suffixErr != nil {
 		return &probeError{step: "write", err: fmt.Errorf("generating random suffix: %w", suffixErr)}
 	}
-	path := probePathPrefix + strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + suffix
+	path := storage.PrefixedPath(prefix, probePathPrefix) + strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + suffix
 	payload := []byte(probeMarker + suffix)
 
 	// 1. Store
@@ -110,6 +116,7 @@ func randomSuffix() (string, error) {
 // It is safe for concurrent use.
 type healthCache struct {
 	storage      storage.Storage
+	prefix       string
 	interval     time.Duration
 	probeTimeout time.Duration
 	logger       *slog.Logger
@@ -154,7 +161,7 @@ func (c *healthCache) Check() error {
 	// Fresh probe under a detached context
 	probeCtx, cancel := context.WithTimeout(context.Background(), c.probeTimeout)
 	defer cancel()
-	err := storageProbe(probeCtx, c.storage)
+	err := storageProbeUnder(probeCtx, c.storage, c.prefix)
 
 	// Transition logging and metric increment happen only on the fresh-probe path.
 	c.logTransition(c.lastErr, err)
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/handler"
+)
+
+const (
+	// hitTimelineFlushInterval is how often buffered cache hits are written
+	// to artifact_hits.
+	hitTimelineFlushInterval = 5 * time.Second
+	// hitTimelineRollupInterval is how often hits past the retention window
+	// are rolled up into per-day totals.
+	hitTimelineRollupInterval = time.Hour
+)
+
+// startHitTimeline enables the artifact_hits record on proxy when
+// configured, flushing buffered hits every hitTimelineFlushInterval and
+// rolling up and pruning old ones every hitTimelineRollupInterval.
+func (s *Server) startHitTimeline(ctx context.Context, proxy *handler.Proxy) {
+	if !s.cfg.HitTimeline.Enabled {
+		return
+	}
+	proxy.EnableHitTimeline()
+	s.flushHitTimeline = proxy.FlushHitTimeline
+
+	retention := s.cfg.ParseHitTimelineRetention()
+	dailyRetention := s.cfg.ParseHitTimelineDailyRetention()
+	s.logger.Info("hit timeline enabled", "retention", retention, "daily_retention", dailyRetention)
+
+	go func() {
+		flush := time.NewTicker(hitTimelineFlushInterval)
+		defer flush.Stop()
+		rollup := time.NewTicker(hitTimelineRollupInterval)
+		defer rollup.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-flush.C:
+				proxy.FlushHitTimeline()
+			case <-rollup.C:
+				s.rollupHitTimeline(retention, dailyRetention)
+			}
+		}
+	}()
+}
+
+// rollupHitTimeline rolls hits older than retention up into per-day totals
+// and drops per-day totals older than dailyRetention.
+func (s *Server) rollupHitTimeline(retention, dailyRetention time.Duration) {
+	now := time.Now()
+	rolled, err := s.db.RollupArtifactHits(now.Add(-retention))
+	if err != nil {
+		s.logger.Warn("hit timeline rollup failed", "error", err)
+		return
+	}
+	pruned, err := s.db.PruneDailyArtifactHits(now.Add(-dailyRetention))
+	if err != nil {
+		s.logger.Warn("hit timeline prune failed", "error", err)
+		return
+	}
+	if rolled > 0 || pruned > 0 {
+		s.logger.Info("hit timeline rolled up", "hits", rolled, "days_pruned", pruned)
+	}
+}
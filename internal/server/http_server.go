@@ -0,0 +1,24 @@
+package server
+
+import "net/http"
+
+// newHTTPServer builds the listener's http.Server. HTTP/1.1 is always
+// served, and HTTP/2 is negotiated on TLS connections. With h2c enabled,
+// cleartext connections that open with the HTTP/2 preface (prior knowledge,
+// as load balancers use) are served as HTTP/2 too, so parallel artifact
+// pulls can be multiplexed over a few backend connections.
+func (s *Server) newHTTPServer(h http.Handler) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(s.cfg.H2C)
+
+	return &http.Server{
+		Addr:         s.cfg.Listen,
+		Handler:      h,
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout, // Large artifacts need time
+		IdleTimeout:  serverIdleTimeout,
+		Protocols:    protocols,
+	}
+}
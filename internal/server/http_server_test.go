@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/config"
+)
+
+// serveProtocolTest serves an endpoint that reports the request's protocol
+// with the server's http.Server settings and returns its URL.
+func serveProtocolTest(t *testing.T, h2c bool) string {
+	t.Helper()
+
+	s := &Server{cfg: &config.Config{H2C: h2c}}
+	srv := s.newHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+	return "http://" + ln.Addr().String() + "/"
+}
+
+// h2cClient only speaks HTTP/2 over cleartext with prior knowledge.
+func h2cClient() *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{
+		Transport: &http.Transport{Protocols: protocols},
+		Timeout:   5 * time.Second,
+	}
+}
+
+func TestHTTPServer_H2C(t *testing.T) {
+	url := serveProtocolTest(t, true)
+
+	resp, err := h2cClient().Get(url)
+	if err != nil {
+		t.Fatalf("h2c request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Errorf("got %s, server saw %q; want HTTP/2.0", resp.Proto, body)
+	}
+
+	// HTTP/1.1 clients keep working on the same listener.
+	resp, err = http.Get(url)
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("got %s, want HTTP/1.1", resp.Proto)
+	}
+}
+
+func TestHTTPServer_H2CDisabled(t *testing.T) {
+	url := serveProtocolTest(t, false)
+
+	resp, err := h2cClient().Get(url)
+	if err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("h2c request succeeded with %s, want failure when h2c is off", resp.Proto)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+// latestVersionResolver looks up the newest published version of a package.
+// *enrichment.Service satisfies this interface.
+type latestVersionResolver interface {
+	GetLatestVersion(ctx context.Context, ecosystem, name string) (string, error)
+}
+
+// startLatestVersionBackfill periodically fills in packages.latest_version for
+// packages that were cached through the proxy handlers, which never set it.
+// Without it the dashboard can't tell whether a cached version is outdated.
+func (s *Server) startLatestVersionBackfill(ctx context.Context, resolver latestVersionResolver) {
+	interval := s.cfg.ParseBackfillInterval()
+	if interval <= 0 {
+		return
+	}
+
+	batchSize := s.cfg.ParseBackfillBatchSize()
+	delay := s.cfg.ParseBackfillDelay()
+	s.logger.Info("latest version backfill enabled",
+		"interval", interval, "batch_size", batchSize, "delay", delay)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n := backfillLatestVersions(ctx, s.db, resolver, s.logger, batchSize, delay)
+			if n > 0 {
+				s.logger.Info("latest version backfill completed", "updated", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// backfillLatestVersions resolves latest_version for up to limit packages,
+// waiting delay between upstream lookups. Packages that fail to resolve are
+// still marked as enriched so they move to the back of the queue. Returns the
+// number of packages that gained a latest_version.
+func backfillLatestVersions(ctx context.Context, db *database.DB, resolver latestVersionResolver, logger *slog.Logger, limit int, delay time.Duration) int {
+	packages, err := db.GetPackagesMissingLatestVersion(limit)
+	if err != nil {
+		logger.Warn("latest version backfill: failed to list packages", "error", err)
+		return 0
+	}
+
+	updated := 0
+	for i, pkg := range packages {
+		if i > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+				return updated
+			case <-time.After(delay):
+			}
+		}
+		if ctx.Err() != nil {
+			return updated
+		}
+
+		latest, err := resolver.GetLatestVersion(ctx, pkg.Ecosystem, pkg.Name)
+		if err != nil {
+			logger.Debug("latest version backfill: lookup failed",
+				"ecosystem", pkg.Ecosystem, "name", pkg.Name, "error", err)
+			latest = ""
+		}
+
+		if err := db.SetPackageLatestVersion(pkg.PURL, latest); err != nil {
+			logger.Warn("latest version backfill: failed to update package",
+				"purl", pkg.PURL, "error", err)
+			continue
+		}
+		if latest != "" {
+			updated++
+		}
+	}
+
+	return updated
+}
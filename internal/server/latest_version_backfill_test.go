@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeLatestVersionResolver struct {
+	versions map[string]string
+	calls    int
+}
+
+func (f *fakeLatestVersionResolver) GetLatestVersion(_ context.Context, ecosystem, name string) (string, error) {
+	f.calls++
+	v, ok := f.versions[ecosystem+"/"+name]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestBackfillLatestVersions(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	seedTestPackage(t, ts.db, "backfill-pkg")
+	seedTestPackage(t, ts.db, "backfill-missing")
+
+	resolver := &fakeLatestVersionResolver{versions: map[string]string{
+		"npm/backfill-pkg": "2.0.0",
+	}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	updated := backfillLatestVersions(context.Background(), ts.db, resolver, logger, 10, 0)
+	if updated != 1 {
+		t.Fatalf("updated = %d, want 1", updated)
+	}
+	if resolver.calls != 2 {
+		t.Errorf("resolver calls = %d, want 2", resolver.calls)
+	}
+
+	pkg, err := ts.db.GetPackageByPURL("pkg:npm/backfill-pkg")
+	if err != nil || pkg == nil {
+		t.Fatalf("GetPackageByPURL: %v", err)
+	}
+	if !pkg.LatestVersion.Valid || pkg.LatestVersion.String != "2.0.0" {
+		t.Fatalf("latest_version = %v, want 2.0.0", pkg.LatestVersion)
+	}
+
+	missing, err := ts.db.GetPackageByPURL("pkg:npm/backfill-missing")
+	if err != nil || missing == nil {
+		t.Fatalf("GetPackageByPURL: %v", err)
+	}
+	if missing.LatestVersion.Valid {
+		t.Errorf("unresolved package latest_version = %q, want NULL", missing.LatestVersion.String)
+	}
+	if !missing.EnrichedAt.Valid {
+		t.Error("unresolved package should be marked as enriched so it is not retried first")
+	}
+
+	// The version page now flags 1.0.0 as outdated.
+	req := httptest.NewRequest(http.MethodGet, "/ui/package/npm/backfill-pkg/1.0.0", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, ">outdated</span>") {
+		t.Error("expected version page to show outdated badge")
+	}
+	if !strings.Contains(body, "2.0.0") {
+		t.Error("expected version page to show latest version")
+	}
+
+	// The package without a resolved latest version is not flagged.
+	req = httptest.NewRequest(http.MethodGet, "/ui/package/npm/backfill-missing/1.0.0", nil)
+	w = httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), ">outdated</span>") {
+		t.Error("package without latest_version should not be marked outdated")
+	}
+}
+
+func TestBackfillLatestVersionsSurvivesProxyUpsert(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	seedTestPackage(t, ts.db, "backfill-keep")
+	resolver := &fakeLatestVersionResolver{versions: map[string]string{"npm/backfill-keep": "3.1.0"}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	backfillLatestVersions(context.Background(), ts.db, resolver, logger, 10, 0)
+
+	// Caching another version re-upserts the package without a latest version.
+	seedTestPackage(t, ts.db, "backfill-keep")
+
+	pkg, err := ts.db.GetPackageByPURL("pkg:npm/backfill-keep")
+	if err != nil || pkg == nil {
+		t.Fatalf("GetPackageByPURL: %v", err)
+	}
+	if pkg.LatestVersion.String != "3.1.0" {
+		t.Errorf("latest_version = %q after re-upsert, want 3.1.0", pkg.LatestVersion.String)
+	}
+}
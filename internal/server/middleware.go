@@ -2,10 +2,16 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"runtime/debug"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/git-pkgs/proxy/internal/handler"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
@@ -32,6 +38,44 @@ func RequestIDMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// StaticHeadersMiddleware sets the configured headers on every response.
+// They are set before next runs, so a handler can still override one.
+func StaticHeadersMiddleware(headers map[string]string) func(http.Handler) http.Handler {
+	if len(headers) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	canonical := make(map[string]string, len(headers))
+	for name, value := range headers {
+		canonical[http.CanonicalHeaderKey(name)] = value
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for name, value := range canonical {
+				h.Set(name, value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdminTokenMiddleware guards operator endpoints: requests must send token
+// as "Authorization: Bearer <token>" or get a 401. The comparison runs in
+// constant time. An empty token rejects every request.
+func AdminTokenMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="proxy admin"`)
+				writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "admin endpoints require a valid bearer token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetRequestID retrieves the request ID from context.
 func GetRequestID(ctx context.Context) string {
 	if id, ok := ctx.Value(requestIDKey).(string); ok {
@@ -40,25 +84,104 @@ func GetRequestID(ctx context.Context) string {
 	return ""
 }
 
-// LoggerMiddleware logs HTTP requests with request ID correlation.
+// LoggerMiddleware logs HTTP requests with request ID correlation. With
+// log.cache_fields on, the package and cache status of the request are
+// added as their own fields.
 func (s *Server) LoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		requestID := GetRequestID(r.Context())
 
+		var fields *handler.RequestLogFields
+		if s.cfg != nil && s.cfg.Log.CacheFields {
+			var ctx context.Context
+			ctx, fields = handler.NewRequestLogFields(r.Context(), r.URL.Path)
+			r = r.WithContext(ctx)
+		}
+
 		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(rw, r)
 
-		s.logger.Info("request",
+		attrs := []any{
 			"request_id", requestID,
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", rw.status,
 			"duration", time.Since(start),
-			"remote", r.RemoteAddr)
+			"remote", r.RemoteAddr,
+		}
+		if fields != nil {
+			attrs = appendCacheLogFields(attrs, fields)
+		}
+		s.logger.Info("request", attrs...)
 	})
 }
 
+// appendCacheLogFields adds the non-empty fields of f to attrs.
+func appendCacheLogFields(attrs []any, f *handler.RequestLogFields) []any {
+	for _, kv := range [][2]string{
+		{"ecosystem", f.Ecosystem},
+		{"name", f.Name},
+		{"version", f.Version},
+		{"cache", f.CacheStatus()},
+	} {
+		if kv[1] != "" {
+			attrs = append(attrs, kv[0], kv[1])
+		}
+	}
+	return attrs
+}
+
+// RecoverMiddleware turns a panic in a handler into a 500 in the error shape
+// the client's protocol expects, picked from the path prefix: an OCI errors
+// object under /v2/, npm's {"error": ...} under /npm/, the API's error JSON
+// under /api/, and plain text elsewhere. The panic and its stack are logged
+// with the request ID. http.ErrAbortHandler is re-raised so net/http can
+// abort the connection as intended.
+func (s *Server) RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+			s.logger.Error("panic serving request",
+				"request_id", GetRequestID(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", rec,
+				"stack", string(debug.Stack()))
+			writePanicError(w, r.URL.Path)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writePanicError writes the 500 for a recovered panic in the error format
+// of the protocol served at path.
+func writePanicError(w http.ResponseWriter, path string) {
+	const message = "internal server error"
+	switch {
+	case strings.HasPrefix(path, "/v2/"):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"errors": []map[string]string{
+				{"code": "UNKNOWN", "message": message},
+			},
+		})
+	case strings.HasPrefix(path, "/npm/"):
+		handler.JSONError(w, http.StatusInternalServerError, message)
+	case strings.HasPrefix(path, "/api/"):
+		internalError(w, message)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
 // ActiveRequestsMiddleware tracks the number of active requests using Prometheus metrics.
 func ActiveRequestsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,13 +1,19 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/git-pkgs/proxy/internal/config"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
@@ -147,3 +153,167 @@ func TestResponseWriter_WriteHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestStaticHeadersMiddleware(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	headers := map[string]string{
+		"strict-transport-security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"Content-Security-Policy":   config.DashboardContentSecurityPolicy,
+		"Content-Type":              "text/x-overridden",
+	}
+	h := StaticHeadersMiddleware(headers)(ts.handler)
+
+	gradleReq := httptest.NewRequest(http.MethodPut, "/gradle/abc123", strings.NewReader("bytes"))
+	h.ServeHTTP(httptest.NewRecorder(), gradleReq)
+
+	for _, path := range []string{"/stats", "/gradle/abc123", "/ui/"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+				t.Errorf("Strict-Transport-Security = %q", got)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q", got)
+			}
+			if got := w.Header().Get("Content-Security-Policy"); got != config.DashboardContentSecurityPolicy {
+				t.Errorf("Content-Security-Policy = %q", got)
+			}
+			if got := w.Header().Get("Content-Type"); got == "text/x-overridden" {
+				t.Error("handler's Content-Type should win over the configured one")
+			}
+		})
+	}
+}
+
+func TestStaticHeadersMiddlewareEmpty(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := StaticHeadersMiddleware(nil)(next)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(w.Header()) != 0 {
+		t.Errorf("headers = %v, want none", w.Header())
+	}
+}
+
+// TestDashboardContentSecurityPolicyAllowsTemplates guards the default CSP
+// against a template starting to load a script or stylesheet from a host
+// the policy doesn't allow.
+func TestDashboardContentSecurityPolicyAllowsTemplates(t *testing.T) {
+	external := regexp.MustCompile(`<(?:script|link)[^>]+(?:src|href)="(https://[^/"]+)`)
+	err := fs.WalkDir(templatesFS, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := templatesFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, m := range external.FindAllStringSubmatch(string(data), -1) {
+			if !strings.Contains(config.DashboardContentSecurityPolicy, m[1]) {
+				t.Errorf("%s loads from %s, which the dashboard CSP does not allow", path, m[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoggerMiddlewareCacheFields(t *testing.T) {
+	var logs bytes.Buffer
+	s := &Server{
+		cfg:    &config.Config{Log: config.LogConfig{CacheFields: true}},
+		logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+	}
+	handler := s.LoggerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/npm/lodash/-/lodash-4.17.21.tgz", nil))
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("parsing log line %q: %v", logs.String(), err)
+	}
+	for key, want := range map[string]string{"ecosystem": "npm", "name": "lodash", "version": "4.17.21"} {
+		if entry[key] != want {
+			t.Errorf("%s = %v, want %q", key, entry[key], want)
+		}
+	}
+	if _, ok := entry["cache"]; ok {
+		t.Errorf("cache = %v, want no field when no artifact was served", entry["cache"])
+	}
+
+	// Off by default.
+	logs.Reset()
+	s.cfg.Log.CacheFields = false
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/npm/lodash/-/lodash-4.17.21.tgz", nil))
+	if strings.Contains(logs.String(), `"ecosystem"`) {
+		t.Errorf("cache fields logged while disabled: %s", logs.String())
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs strings.Builder
+	s := &Server{logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	handler := middleware.RequestID(RequestIDMiddleware(s.RecoverMiddleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))))
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/v2/library/alpine/manifests/latest", "application/json", `{"errors":[{"code":"UNKNOWN","message":"internal server error"}]}`},
+		{"/npm/lodash", "application/json", `{"error":"internal server error"}`},
+		{"/pypi/simple/requests/", "text/plain; charset=utf-8", "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.body {
+				t.Errorf("body = %s, want %s", got, tt.body)
+			}
+			requestID := rec.Header().Get("X-Request-ID")
+			if !strings.Contains(logs.String(), "request_id="+requestID) {
+				t.Errorf("panic log missing request ID %q: %s", requestID, logs.String())
+			}
+		})
+	}
+	if !strings.Contains(logs.String(), "stack=") {
+		t.Error("panic log missing stack trace")
+	}
+}
+
+func TestRecoverMiddleware_AbortHandler(t *testing.T) {
+	s := &Server{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	handler := s.RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/npm/lodash", nil))
+}
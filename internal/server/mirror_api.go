@@ -1,7 +1,6 @@
 package server
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/git-pkgs/proxy/internal/mirror"
@@ -11,19 +10,24 @@ import (
 // MirrorAPIHandler handles mirror API requests.
 type MirrorAPIHandler struct {
 	jobs *mirror.JobStore
+
+	// maxBodySize and maxItems bound the job request body.
+	maxBodySize int64
+	maxItems    int
 }
 
 // NewMirrorAPIHandler creates a new mirror API handler.
 func NewMirrorAPIHandler(jobs *mirror.JobStore) *MirrorAPIHandler {
-	return &MirrorAPIHandler{jobs: jobs}
+	return &MirrorAPIHandler{jobs: jobs, maxBodySize: maxBodySize, maxItems: defaultMaxItems}
 }
 
 // HandleCreate starts a new mirror job.
 func (h *MirrorAPIHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 	var req mirror.JobRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		badRequest(w, "invalid request body")
+	if !decodeJSONBody(w, r, h.maxBodySize, &req) {
+		return
+	}
+	if !checkItemLimit(w, "purls", len(req.PURLs), h.maxItems) {
 		return
 	}
 
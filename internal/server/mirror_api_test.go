@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/git-pkgs/proxy/internal/database"
@@ -74,11 +75,24 @@ func TestMirrorAPICreateJob(t *testing.T) {
 func TestMirrorAPICreateOversizedBody(t *testing.T) {
 	h := setupMirrorAPI(t)
 
-	body := bytes.Repeat([]byte("x"), int(maxBodySize)+1)
+	body := []byte(`{"registry":"` + strings.Repeat("x", int(maxBodySize)) + `"}`)
 	req := httptest.NewRequest("POST", "/api/mirror", bytes.NewReader(body))
 	w := httptest.NewRecorder()
 	h.HandleCreate(w, req)
 
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestMirrorAPICreateTooManyPURLs(t *testing.T) {
+	h := setupMirrorAPI(t)
+	h.maxItems = 1
+
+	req := httptest.NewRequest("POST", "/api/mirror", strings.NewReader(`{"purls":["pkg:npm/a@1.0.0","pkg:npm/b@1.0.0"]}`))
+	w := httptest.NewRecorder()
+	h.HandleCreate(w, req)
+
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
 	}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	swaggerdoc "github.com/git-pkgs/proxy/docs/swagger"
+)
+
+// openAPIVersion is the OpenAPI version of the document served at
+// /api/openapi.json.
+const openAPIVersion = "3.0.3"
+
+// openAPI3Doc converts the swag-generated Swagger 2.0 document once and
+// caches the result. The Swagger document is itself generated from the
+// handler annotations and response struct tags, so both stay in sync with
+// the code.
+var openAPI3Doc = sync.OnceValues(func() ([]byte, error) {
+	return convertSwaggerToOpenAPI3([]byte(swaggerdoc.SwaggerInfo.ReadDoc()))
+})
+
+// handleOpenAPI3JSON serves the API description as OpenAPI 3.
+func (s *Server) handleOpenAPI3JSON(w http.ResponseWriter, _ *http.Request) {
+	doc, err := openAPI3Doc()
+	if err != nil {
+		s.logger.Error("failed to build OpenAPI document", "error", err)
+		internalError(w, "failed to build OpenAPI document")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(doc)
+}
+
+// swaggerDoc is the subset of Swagger 2.0 that swag emits for this API.
+type swaggerDoc struct {
+	Info        map[string]any                         `json:"info"`
+	BasePath    string                                 `json:"basePath"`
+	Paths       map[string]map[string]swaggerOperation `json:"paths"`
+	Definitions map[string]any                         `json:"definitions"`
+}
+
+type swaggerOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Consumes    []string                   `json:"consumes,omitempty"`
+	Produces    []string                   `json:"produces,omitempty"`
+	Parameters  []map[string]any           `json:"parameters,omitempty"`
+	Responses   map[string]swaggerResponse `json:"responses"`
+}
+
+type swaggerResponse struct {
+	Description string `json:"description"`
+	Schema      any    `json:"schema,omitempty"`
+}
+
+// convertSwaggerToOpenAPI3 rewrites a Swagger 2.0 document as OpenAPI 3:
+// definitions move to components/schemas, body parameters become request
+// bodies, and response schemas are keyed by media type.
+func convertSwaggerToOpenAPI3(swagger []byte) ([]byte, error) {
+	var src swaggerDoc
+	if err := json.Unmarshal(swagger, &src); err != nil {
+		return nil, fmt.Errorf("parsing swagger document: %w", err)
+	}
+
+	paths := make(map[string]any, len(src.Paths))
+	for path, ops := range src.Paths {
+		item := make(map[string]any, len(ops))
+		for method, op := range ops {
+			item[method] = convertOperation(op)
+		}
+		paths[path] = item
+	}
+
+	schemas := make(map[string]any, len(src.Definitions))
+	for name, schema := range src.Definitions {
+		schemas[name] = convertSchema(schema)
+	}
+
+	basePath := src.BasePath
+	if basePath == "" {
+		basePath = "/"
+	}
+
+	doc := map[string]any{
+		"openapi":    openAPIVersion,
+		"info":       src.Info,
+		"servers":    []map[string]string{{"url": basePath}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+	return json.MarshalIndent(doc, "", "    ")
+}
+
+func convertOperation(op swaggerOperation) map[string]any {
+	out := map[string]any{}
+	if op.Summary != "" {
+		out["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		out["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		out["tags"] = op.Tags
+	}
+
+	var params []map[string]any
+	for _, p := range op.Parameters {
+		if p["in"] == "body" {
+			body := map[string]any{
+				"content": mediaTypes(op.Consumes, p["schema"]),
+			}
+			if desc, ok := p["description"].(string); ok && desc != "" {
+				body["description"] = desc
+			}
+			if req, ok := p["required"].(bool); ok {
+				body["required"] = req
+			}
+			out["requestBody"] = body
+			continue
+		}
+		params = append(params, convertParameter(p))
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	responses := make(map[string]any, len(op.Responses))
+	for code, resp := range op.Responses {
+		r := map[string]any{"description": resp.Description}
+		if resp.Schema != nil {
+			r["content"] = mediaTypes(op.Produces, resp.Schema)
+		}
+		responses[code] = r
+	}
+	out["responses"] = responses
+	return out
+}
+
+// convertParameter moves the type keywords of a non-body parameter into a
+// schema object, as OpenAPI 3 requires.
+func convertParameter(p map[string]any) map[string]any {
+	out := map[string]any{}
+	schema := map[string]any{}
+	for k, v := range p {
+		switch k {
+		case "name", "in", "description", "required":
+			out[k] = v
+		case "type", "format", "enum", "items", "default", "minimum", "maximum":
+			schema[k] = convertSchema(v)
+		}
+	}
+	if len(schema) > 0 {
+		out["schema"] = schema
+	}
+	return out
+}
+
+// mediaTypes keys schema by each of the operation's media types, defaulting
+// to JSON.
+func mediaTypes(types []string, schema any) map[string]any {
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	converted := convertSchema(schema)
+	content := make(map[string]any, len(types))
+	for _, t := range types {
+		content[t] = map[string]any{"schema": converted}
+	}
+	return content
+}
+
+// convertSchema rewrites definition references and Swagger-only types
+// within a schema.
+func convertSchema(v any) any {
+	switch s := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(s))
+		for k, val := range s {
+			if ref, ok := val.(string); ok && k == "$ref" {
+				out[k] = strings.Replace(ref, "#/definitions/", "#/components/schemas/", 1)
+				continue
+			}
+			out[k] = convertSchema(val)
+		}
+		if out["type"] == "file" {
+			out["type"] = "string"
+			out["format"] = "binary"
+		}
+		return out
+	case []any:
+		out := make([]any, len(s))
+		for i, val := range s {
+			out[i] = convertSchema(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleOpenAPI3JSON(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("document is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+
+	for _, path := range []string{
+		"/stats",
+		"/api/package/{ecosystem}/{name}",
+		"/api/package/{ecosystem}/{name}/{version}",
+		"/api/vulns/{ecosystem}/{name}",
+		"/api/outdated",
+		"/api/bulk",
+		"/api/search",
+		"/api/packages",
+		"/ui/api/browse/{ecosystem}/{name}/{version}",
+		"/ui/api/compare/{ecosystem}/{name}/{fromVersion}/{toVersion}",
+	} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("missing path %s", path)
+		}
+	}
+
+	for _, schema := range []string{
+		"server.PackageResponse",
+		"server.EnrichmentResponse",
+		"server.VulnsResponse",
+		"server.OutdatedRequest",
+		"server.OutdatedResponse",
+		"server.BulkResponse",
+		"server.ErrorResponse",
+	} {
+		if _, ok := doc.Components.Schemas[schema]; !ok {
+			t.Errorf("missing schema %s", schema)
+		}
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "#/definitions/") {
+		t.Error("document still references #/definitions/")
+	}
+	if strings.Contains(body, `"in": "body"`) {
+		t.Error("document still has Swagger body parameters")
+	}
+
+	outdated := doc.Paths["/api/outdated"]["post"]
+	if _, ok := outdated["requestBody"]; !ok {
+		t.Error("POST /api/outdated has no requestBody")
+	}
+}
+
+func TestConvertSwaggerToOpenAPI3(t *testing.T) {
+	swagger := `{
+		"swagger": "2.0",
+		"info": {"title": "t", "version": "1"},
+		"basePath": "/",
+		"paths": {
+			"/file/{name}": {
+				"get": {
+					"produces": ["application/octet-stream"],
+					"parameters": [
+						{"type": "string", "name": "name", "in": "path", "required": true},
+						{"type": "string", "enum": ["a", "b"], "name": "mode", "in": "query"}
+					],
+					"responses": {
+						"200": {"description": "OK", "schema": {"type": "file"}},
+						"404": {"description": "Not Found"}
+					}
+				}
+			}
+		},
+		"definitions": {
+			"x.Outer": {"type": "object", "properties": {"inner": {"$ref": "#/definitions/x.Inner"}}},
+			"x.Inner": {"type": "object"}
+		}
+	}`
+
+	out, err := convertSwaggerToOpenAPI3([]byte(swagger))
+	if err != nil {
+		t.Fatalf("convert failed: %v", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	op := doc["paths"].(map[string]any)["/file/{name}"].(map[string]any)["get"].(map[string]any)
+	params := op["parameters"].([]any)
+	mode := params[1].(map[string]any)
+	if _, ok := mode["type"]; ok {
+		t.Error("parameter type should move into schema")
+	}
+	if enum := mode["schema"].(map[string]any)["enum"].([]any); len(enum) != 2 {
+		t.Errorf("enum = %v, want [a b]", enum)
+	}
+
+	ok := op["responses"].(map[string]any)["200"].(map[string]any)
+	schema := ok["content"].(map[string]any)["application/octet-stream"].(map[string]any)["schema"].(map[string]any)
+	if schema["type"] != "string" || schema["format"] != "binary" {
+		t.Errorf("file response schema = %v, want string/binary", schema)
+	}
+	if _, hasContent := op["responses"].(map[string]any)["404"].(map[string]any)["content"]; hasContent {
+		t.Error("response without schema should have no content")
+	}
+
+	outer := doc["components"].(map[string]any)["schemas"].(map[string]any)["x.Outer"].(map[string]any)
+	ref := outer["properties"].(map[string]any)["inner"].(map[string]any)["$ref"]
+	if ref != "#/components/schemas/x.Inner" {
+		t.Errorf("$ref = %v, want #/components/schemas/x.Inner", ref)
+	}
+}
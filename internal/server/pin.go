@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/purl"
+)
+
+// PinAPIHandler fetches exact package versions and pins them, so builds that
+// depend on them keep working however long ago they were cached.
+type PinAPIHandler struct {
+	proxy  *handler.Proxy
+	db     *database.DB
+	logger *slog.Logger
+
+	// evictMu is held while a version's artifacts are pinned, so an LRU
+	// eviction pass never runs between finding them and pinning them. It
+	// is not held during the upstream fetch, which would stall eviction
+	// for as long as the download takes.
+	evictMu *sync.Mutex
+
+	// maxBodySize and maxItems bound the request body.
+	maxBodySize int64
+	maxItems    int
+}
+
+// NewPinAPIHandler creates a pin API handler. evictMu must be the lock the
+// server's eviction loop holds while it runs.
+func NewPinAPIHandler(proxy *handler.Proxy, db *database.DB, logger *slog.Logger, evictMu *sync.Mutex) *PinAPIHandler {
+	return &PinAPIHandler{
+		proxy:       proxy,
+		db:          db,
+		logger:      logger,
+		evictMu:     evictMu,
+		maxBodySize: maxBodySize,
+		maxItems:    defaultMaxItems,
+	}
+}
+
+// PinVersionsRequest lists the package versions to fetch and pin.
+type PinVersionsRequest struct {
+	Packages []PinVersion `json:"packages"`
+}
+
+// PinVersion identifies one exact package version.
+type PinVersion struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+}
+
+// PinVersionsResponse reports the outcome for each requested version.
+type PinVersionsResponse struct {
+	Results []PinVersionResult `json:"results"`
+	Pinned  int                `json:"pinned"`
+	Failed  int                `json:"failed"`
+}
+
+// PinVersionResult is the outcome for one version. Fetched is true when the
+// version wasn't cached and was downloaded by this request.
+type PinVersionResult struct {
+	Ecosystem string   `json:"ecosystem"`
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	PURL      string   `json:"purl,omitempty"`
+	Fetched   bool     `json:"fetched"`
+	Artifacts []string `json:"artifacts,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+var errNothingPinned = errors.New("no cached artifacts to pin")
+
+// HandlePin fetches each version if it isn't cached and pins its artifacts.
+// @Summary Fetch and pin package versions
+// @Description Downloads each listed version if it isn't cached yet and pins its artifacts so LRU eviction never removes them. Versions are handled one at a time and each gets its own result; a failure doesn't stop the rest. Only served when mirror_api is enabled, since it triggers upstream downloads, and admin.token is set; requests must send that token.
+// @Tags api
+// @Accept json
+// @Produce json
+// @Param request body PinVersionsRequest true "Versions to pin"
+// @Success 200 {object} PinVersionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Router /api/pin [post]
+func (h *PinAPIHandler) HandlePin(w http.ResponseWriter, r *http.Request) {
+	var req PinVersionsRequest
+	if !decodeJSONBody(w, r, h.maxBodySize, &req) {
+		return
+	}
+	if len(req.Packages) == 0 {
+		badRequest(w, "packages is required")
+		return
+	}
+	if !checkItemLimit(w, "packages", len(req.Packages), h.maxItems) {
+		return
+	}
+
+	resp := PinVersionsResponse{Results: make([]PinVersionResult, 0, len(req.Packages))}
+	for _, pv := range req.Packages {
+		result := h.pinOne(r.Context(), pv)
+		if result.Error != "" {
+			resp.Failed++
+		} else {
+			resp.Pinned++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	writeJSON(w, resp)
+}
+
+func (h *PinAPIHandler) pinOne(ctx context.Context, pv PinVersion) PinVersionResult {
+	result := PinVersionResult{Ecosystem: pv.Ecosystem, Name: pv.Name, Version: pv.Version}
+	if pv.Ecosystem == "" || pv.Name == "" || pv.Version == "" {
+		result.Error = "ecosystem, name and version are required"
+		return result
+	}
+
+	ecosystem := purl.NormalizeEcosystem(pv.Ecosystem)
+	name := handler.Canonicalize(ecosystem, pv.Name)
+	result.PURL = purl.MakePURLString(ecosystem, name, pv.Version)
+
+	filenames, err := h.pinCachedArtifacts(result.PURL)
+	if errors.Is(err, errNothingPinned) {
+		// Eviction may remove the fetched artifact before it is pinned;
+		// the version then fails with errNothingPinned and can be retried.
+		fetched, fetchErr := h.proxy.GetOrFetchArtifact(ctx, ecosystem, name, pv.Version, "")
+		if fetchErr != nil {
+			h.logger.Warn("pin: fetch failed", "purl", result.PURL, "error", fetchErr)
+			result.Error = fetchErr.Error()
+			return result
+		}
+		if fetched.Reader != nil {
+			_ = fetched.Reader.Close()
+		}
+		result.Fetched = true
+		filenames, err = h.pinCachedArtifacts(result.PURL)
+	}
+	if err != nil {
+		h.logger.Warn("pin: failed to pin artifacts", "purl", result.PURL, "error", err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Artifacts = filenames
+
+	h.logger.Info("pinned version", "purl", result.PURL, "fetched", result.Fetched, "artifacts", len(filenames))
+	return result
+}
+
+// pinCachedArtifacts pins every cached artifact of versionPURL and returns
+// their filenames. It holds evictMu throughout.
+func (h *PinAPIHandler) pinCachedArtifacts(versionPURL string) ([]string, error) {
+	h.evictMu.Lock()
+	defer h.evictMu.Unlock()
+
+	artifacts, err := h.db.GetArtifactsByVersionPURL(versionPURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+	for _, art := range artifacts {
+		if !art.IsCached() {
+			continue
+		}
+		if err := h.db.PinArtifact(art.VersionPURL, art.Filename, true); err != nil {
+			return filenames, err
+		}
+		filenames = append(filenames, art.Filename)
+	}
+	if len(filenames) == 0 {
+		return nil, errNothingPinned
+	}
+	return filenames, nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/git-pkgs/registries/fetch"
+)
+
+// stubFetcher answers every download with the same body.
+type stubFetcher struct {
+	mu    sync.Mutex
+	body  string
+	calls int
+}
+
+func (f *stubFetcher) Fetch(_ context.Context, _ string) (*fetch.Artifact, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	return &fetch.Artifact{
+		Body:        io.NopCloser(strings.NewReader(f.body)),
+		Size:        int64(len(f.body)),
+		ContentType: "application/octet-stream",
+	}, nil
+}
+
+func (f *stubFetcher) FetchWithHeaders(ctx context.Context, url string, _ http.Header) (*fetch.Artifact, error) {
+	return f.Fetch(ctx, url)
+}
+
+func (f *stubFetcher) Head(_ context.Context, _ string) (int64, string, error) {
+	return int64(len(f.body)), "application/octet-stream", nil
+}
+
+func TestHandlePin_FetchesAndSurvivesEviction(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fetcher := &stubFetcher{body: "\x1f\x8b tarball bytes"}
+	proxy := handler.NewProxy(ts.db, ts.storage, fetcher, fetch.NewResolver(), logger)
+	h := NewPinAPIHandler(proxy, ts.db, logger, &ts.server.evictMu)
+
+	// An unpinned neighbour that eviction is free to remove.
+	other, err := proxy.GetOrFetchArtifact(context.Background(), "npm", "left-pad", "1.3.0", "")
+	if err != nil {
+		t.Fatalf("caching left-pad: %v", err)
+	}
+	_ = other.Reader.Close()
+
+	body := `{"packages":[{"ecosystem":"npm","name":"lodash","version":"4.17.21"},{"ecosystem":"npm","name":"lodash"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/pin", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.HandlePin(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp PinVersionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Pinned != 1 || resp.Failed != 1 {
+		t.Errorf("pinned = %d, failed = %d; want 1 and 1", resp.Pinned, resp.Failed)
+	}
+	got := resp.Results[0]
+	if !got.Fetched || got.PURL != "pkg:npm/lodash@4.17.21" {
+		t.Errorf("result = %+v, want a fetched pkg:npm/lodash@4.17.21", got)
+	}
+	if len(got.Artifacts) != 1 || got.Artifacts[0] != "lodash-4.17.21.tgz" {
+		t.Errorf("artifacts = %v, want [lodash-4.17.21.tgz]", got.Artifacts)
+	}
+	if resp.Results[1].Error == "" {
+		t.Error("a package without a version should fail")
+	}
+
+	ts.server.runEviction(context.Background(), 1)
+
+	pinned, err := ts.db.GetArtifact("pkg:npm/lodash@4.17.21", "lodash-4.17.21.tgz")
+	if err != nil || pinned == nil {
+		t.Fatalf("GetArtifact() = %v, %v", pinned, err)
+	}
+	if !pinned.Pinned || !pinned.IsCached() {
+		t.Errorf("pinned artifact after eviction: pinned=%v cached=%v, want both", pinned.Pinned, pinned.IsCached())
+	}
+	if ok, _ := ts.storage.Exists(context.Background(), pinned.StoragePath.String); !ok {
+		t.Error("pinned artifact was deleted from storage")
+	}
+
+	evicted, err := ts.db.GetArtifact("pkg:npm/left-pad@1.3.0", "left-pad-1.3.0.tgz")
+	if err != nil || evicted == nil {
+		t.Fatalf("GetArtifact(left-pad) = %v, %v", evicted, err)
+	}
+	if evicted.IsCached() {
+		t.Error("unpinned artifact should have been evicted")
+	}
+
+	// Pinning again finds the version cached and doesn't refetch it.
+	calls := fetcher.calls
+	req = httptest.NewRequest(http.MethodPost, "/api/pin", strings.NewReader(`{"packages":[{"ecosystem":"npm","name":"lodash","version":"4.17.21"}]}`))
+	w = httptest.NewRecorder()
+	h.HandlePin(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Results[0].Fetched || fetcher.calls != calls {
+		t.Errorf("second pin fetched again (fetched=%v, calls %d -> %d)", resp.Results[0].Fetched, calls, fetcher.calls)
+	}
+}
+
+func TestHandlePin_EmptyRequest(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	h := NewPinAPIHandler(nil, ts.db, slog.New(slog.NewTextHandler(io.Discard, nil)), &ts.server.evictMu)
+	req := httptest.NewRequest(http.MethodPost, "/api/pin", strings.NewReader(`{"packages":[]}`))
+	w := httptest.NewRecorder()
+	h.HandlePin(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+// blockingFetcher holds each download until release is closed.
+type blockingFetcher struct {
+	stubFetcher
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *blockingFetcher) Fetch(ctx context.Context, url string) (*fetch.Artifact, error) {
+	close(f.started)
+	<-f.release
+	return f.stubFetcher.Fetch(ctx, url)
+}
+
+func (f *blockingFetcher) FetchWithHeaders(ctx context.Context, url string, _ http.Header) (*fetch.Artifact, error) {
+	return f.Fetch(ctx, url)
+}
+
+func TestHandlePin_FetchDoesNotBlockEviction(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fetcher := &blockingFetcher{
+		stubFetcher: stubFetcher{body: "\x1f\x8b tarball bytes"},
+		started:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	proxy := handler.NewProxy(ts.db, ts.storage, fetcher, fetch.NewResolver(), logger)
+	h := NewPinAPIHandler(proxy, ts.db, logger, &ts.server.evictMu)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/pin",
+			strings.NewReader(`{"packages":[{"ecosystem":"npm","name":"lodash","version":"4.17.21"}]}`))
+		w := httptest.NewRecorder()
+		h.HandlePin(w, req)
+		done <- w
+	}()
+
+	<-fetcher.started
+	if !ts.server.evictMu.TryLock() {
+		t.Error("evictMu is held while the version downloads")
+	} else {
+		ts.server.evictMu.Unlock()
+	}
+	close(fetcher.release)
+
+	w := <-done
+	var resp PinVersionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Pinned != 1 {
+		t.Errorf("pinned = %d, want 1; results = %+v", resp.Pinned, resp.Results)
+	}
+}
+
+func TestHandlePin_RequiresAdminToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	for _, auth := range []string{"", "Bearer wrong-token"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/pin",
+			strings.NewReader(`{"packages":[{"ecosystem":"npm","name":"lodash","version":"4.17.21"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// reconcileBatch is how many artifact rows are checked per query.
+	reconcileBatch = 500
+	// maxReportedOrphans caps the orphan paths listed on a job. The count
+	// is always exact.
+	maxReportedOrphans = 1000
+	// maxFinishedReconcileJobs is how many finished jobs are kept for
+	// polling before the oldest is dropped.
+	maxFinishedReconcileJobs = 20
+)
+
+// Reconcile job states.
+const (
+	ReconcileStateRunning  = "running"
+	ReconcileStateComplete = "complete"
+	ReconcileStateFailed   = "failed"
+)
+
+// ReconcileJob reports the progress of a storage-vs-database scan.
+type ReconcileJob struct {
+	ID         string     `json:"id"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Checked is the number of cached artifact rows examined so far.
+	Checked int `json:"checked"`
+	// Cleared is the number of rows whose blob was missing. They are marked
+	// uncached so the next request refetches from upstream.
+	Cleared int `json:"cleared"`
+	// OrphanCount is the number of blobs with no artifact row. Orphans are
+	// reported, never deleted.
+	OrphanCount int      `json:"orphan_count"`
+	Orphans     []string `json:"orphans"`
+	// OrphanScan is "skipped" when the storage backend cannot list objects.
+	OrphanScan string `json:"orphan_scan,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// reconcileLister is implemented by storage backends that can enumerate
+// their contents, which the orphan scan needs.
+type reconcileLister interface {
+	ListPrefix(ctx context.Context, prefix string) ([]storage.ObjectInfo, error)
+}
+
+// reconciler runs at most one reconcile job at a time and keeps recent jobs
+// for polling.
+type reconciler struct {
+	ctx     context.Context
+	db      *database.DB
+	storage storage.Storage
+	logger  *slog.Logger
+
+	// prefix is storage.prefix. The orphan scan only looks under it, so
+	// other instances sharing the bucket aren't reported as orphans.
+	prefix string
+
+	mu      sync.Mutex
+	jobs    map[string]*ReconcileJob
+	order   []string
+	running string
+}
+
+// newReconciler creates a reconciler whose jobs stop when ctx is canceled.
+func newReconciler(ctx context.Context, db *database.DB, store storage.Storage, logger *slog.Logger) *reconciler {
+	return &reconciler{
+		ctx:     ctx,
+		db:      db,
+		storage: store,
+		logger:  logger,
+		jobs:    make(map[string]*ReconcileJob),
+	}
+}
+
+// start launches a reconcile job. If one is already running its id is
+// returned with started set to false.
+func (rc *reconciler) start() (id string, started bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.running != "" {
+		return rc.running, false
+	}
+
+	job := &ReconcileJob{
+		ID:        newReconcileID(),
+		State:     ReconcileStateRunning,
+		StartedAt: time.Now(),
+		Orphans:   []string{},
+	}
+	rc.jobs[job.ID] = job
+	rc.order = append(rc.order, job.ID)
+	rc.running = job.ID
+	rc.pruneLocked()
+
+	go rc.run(job)
+	return job.ID, true
+}
+
+// get returns a snapshot of a job, or nil if the id is unknown.
+func (rc *reconciler) get(id string) *ReconcileJob {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	job := rc.jobs[id]
+	if job == nil {
+		return nil
+	}
+	snapshot := *job
+	snapshot.Orphans = append([]string(nil), job.Orphans...)
+	return &snapshot
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxFinishedReconcileJobs.
+func (rc *reconciler) pruneLocked() {
+	for len(rc.order) > maxFinishedReconcileJobs+1 {
+		oldest := rc.order[0]
+		if oldest == rc.running {
+			return
+		}
+		delete(rc.jobs, oldest)
+		rc.order = rc.order[1:]
+	}
+}
+
+func (rc *reconciler) locked(fn func()) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	fn()
+}
+
+func (rc *reconciler) run(job *ReconcileJob) {
+	rc.logger.Info("reconcile started", "job", job.ID)
+
+	err := rc.scan(rc.ctx, job)
+
+	rc.locked(func() {
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			job.State = ReconcileStateFailed
+			job.Error = err.Error()
+		} else {
+			job.State = ReconcileStateComplete
+		}
+		rc.running = ""
+	})
+
+	if err != nil {
+		rc.logger.Warn("reconcile failed", "job", job.ID, "error", err)
+		return
+	}
+	rc.logger.Info("reconcile completed", "job", job.ID,
+		"checked", job.Checked, "cleared", job.Cleared, "orphans", job.OrphanCount)
+}
+
+// scan checks every cached artifact row against storage, clearing rows
+// whose blob is gone, then lists storage for blobs no row points at.
+func (rc *reconciler) scan(ctx context.Context, job *ReconcileJob) error {
+	known := make(map[string]bool)
+
+	var afterID int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		artifacts, err := rc.db.ListCachedArtifactsAfter(afterID, reconcileBatch)
+		if err != nil {
+			return fmt.Errorf("listing artifacts: %w", err)
+		}
+		if len(artifacts) == 0 {
+			break
+		}
+
+		for _, art := range artifacts {
+			afterID = art.ID
+			path := art.StoragePath.String
+
+			exists, err := rc.storage.Exists(ctx, path)
+			if err != nil {
+				return fmt.Errorf("checking %s: %w", path, err)
+			}
+
+			cleared := false
+			if exists {
+				known[path] = true
+			} else {
+				if err := rc.db.ClearArtifactCache(art.VersionPURL, art.Filename); err != nil {
+					return fmt.Errorf("clearing %s %s: %w", art.VersionPURL, art.Filename, err)
+				}
+				rc.logger.Info("reconcile: cleared artifact with missing blob",
+					"purl", art.VersionPURL, "filename", art.Filename, "path", path)
+				cleared = true
+			}
+
+			rc.locked(func() {
+				job.Checked++
+				if cleared {
+					job.Cleared++
+				}
+			})
+		}
+	}
+
+	lister, ok := rc.storage.(reconcileLister)
+	if !ok {
+		rc.locked(func() { job.OrphanScan = "skipped" })
+		return nil
+	}
+
+	listPrefix := storage.PrefixedPath(rc.prefix, "")
+	objects, err := lister.ListPrefix(ctx, listPrefix)
+	if err != nil {
+		return fmt.Errorf("listing storage: %w", err)
+	}
+	var orphans []string
+	for _, obj := range objects {
+		if known[obj.Path] || isInternalStoragePath(strings.TrimPrefix(obj.Path, listPrefix)) {
+			continue
+		}
+		orphans = append(orphans, obj.Path)
+	}
+	sort.Strings(orphans)
+
+	rc.locked(func() {
+		job.OrphanCount = len(orphans)
+		if len(orphans) > maxReportedOrphans {
+			orphans = orphans[:maxReportedOrphans]
+		}
+		job.Orphans = append(job.Orphans, orphans...)
+	})
+	return nil
+}
+
+// isInternalStoragePath reports whether path belongs to the proxy's own
+// bookkeeping (cached metadata, the Gradle build cache, health probes)
+// rather than to an artifact row.
+func isInternalStoragePath(path string) bool {
+	return strings.HasPrefix(path, "_") || strings.HasPrefix(path, ".")
+}
+
+func newReconcileID() string {
+	b := make([]byte, 8) //nolint:mnd // 64-bit id
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// handleReconcileStart starts a background reconcile.
+// @Summary Start storage reconciliation
+// @Description Starts a background scan that marks artifacts whose blobs are missing from storage as uncached, so they are refetched, and reports blobs no artifact points at. Only one scan runs at a time; starting another while one is running returns 409 with the running job's id.
+// @Tags api
+// @Produce json
+// @Success 202 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/reconcile [post]
+func (rc *reconciler) handleReconcileStart(w http.ResponseWriter, _ *http.Request) {
+	id, started := rc.start()
+	if !started {
+		writeError(w, http.StatusConflict, ErrCodeConflict, "reconcile job "+id+" is already running")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, map[string]string{"id": id})
+}
+
+// handleReconcileGet reports a reconcile job's progress.
+// @Summary Get reconcile job status
+// @Tags api
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} ReconcileJob
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/reconcile/{id} [get]
+func (rc *reconciler) handleReconcileGet(w http.ResponseWriter, r *http.Request) {
+	job := rc.get(chi.URLParam(r, "id"))
+	if job == nil {
+		notFound(w, "job not found")
+		return
+	}
+	writeJSON(w, job)
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/storage"
+)
+
+func startReconcile(t *testing.T, ts *testServer) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/reconcile", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp["id"] == "" {
+		t.Fatal("expected job id")
+	}
+	return resp["id"]
+}
+
+func waitReconcile(t *testing.T, ts *testServer, id string) ReconcileJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		req := httptest.NewRequest(http.MethodGet, "/api/reconcile/"+id, nil)
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var job ReconcileJob
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("decoding job: %v", err)
+		}
+		if job.State != ReconcileStateRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("reconcile did not finish")
+	return ReconcileJob{}
+}
+
+func TestReconcile_ClearsMissingBlobs(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	ctx := context.Background()
+	now := time.Now()
+	seedArtifact(t, ctx, ts.db, ts.storage, "kept", 10, now)
+	seedArtifact(t, ctx, ts.db, ts.storage, "lost", 10, now)
+
+	lostPath := storage.ArtifactPath("npm", "", "lost", "1.0.0", "lost-1.0.0.tgz")
+	if err := ts.storage.Delete(ctx, lostPath); err != nil {
+		t.Fatalf("deleting blob: %v", err)
+	}
+	orphanPath := "npm/stray/1.0.0/stray-1.0.0.tgz"
+	if _, _, err := ts.storage.Store(ctx, orphanPath, strings.NewReader("stray")); err != nil {
+		t.Fatalf("storing orphan: %v", err)
+	}
+	if _, _, err := ts.storage.Store(ctx, "_metadata/npm/kept", strings.NewReader("{}")); err != nil {
+		t.Fatalf("storing metadata: %v", err)
+	}
+
+	job := waitReconcile(t, ts, startReconcile(t, ts))
+
+	if job.State != ReconcileStateComplete {
+		t.Fatalf("state = %q, want %q (error %q)", job.State, ReconcileStateComplete, job.Error)
+	}
+	if job.FinishedAt == nil {
+		t.Error("expected finished_at")
+	}
+	if job.Checked != 2 || job.Cleared != 1 {
+		t.Errorf("checked = %d, cleared = %d, want 2 and 1", job.Checked, job.Cleared)
+	}
+	if job.OrphanCount != 1 || len(job.Orphans) != 1 || job.Orphans[0] != orphanPath {
+		t.Errorf("orphans = %v (count %d), want [%s]", job.Orphans, job.OrphanCount, orphanPath)
+	}
+
+	lost, err := ts.db.GetArtifact("pkg:npm/lost@1.0.0", "lost-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if lost.IsCached() {
+		t.Error("artifact with missing blob should no longer be cached")
+	}
+	kept, err := ts.db.GetArtifact("pkg:npm/kept@1.0.0", "kept-1.0.0.tgz")
+	if err != nil {
+		t.Fatalf("GetArtifact: %v", err)
+	}
+	if !kept.IsCached() {
+		t.Error("artifact with blob present should still be cached")
+	}
+
+	exists, err := ts.storage.Exists(ctx, orphanPath)
+	if err != nil || !exists {
+		t.Error("orphan blob should be reported, not deleted")
+	}
+}
+
+func TestReconcile_OrphanScanStaysInPrefix(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	ts.reconcile.prefix = "prod"
+
+	ctx := context.Background()
+	ownOrphan := "prod/npm/stray/1.0.0/stray-1.0.0.tgz"
+	for _, path := range []string{
+		ownOrphan,
+		"prod/_metadata/npm/stray/metadata",
+		"staging/npm/other/1.0.0/other-1.0.0.tgz",
+		"npm/legacy/1.0.0/legacy-1.0.0.tgz",
+	} {
+		if _, _, err := ts.storage.Store(ctx, path, strings.NewReader("x")); err != nil {
+			t.Fatalf("storing %s: %v", path, err)
+		}
+	}
+
+	job := waitReconcile(t, ts, startReconcile(t, ts))
+
+	if job.State != ReconcileStateComplete {
+		t.Fatalf("state = %q, want %q (error %q)", job.State, ReconcileStateComplete, job.Error)
+	}
+	if job.OrphanCount != 1 || len(job.Orphans) != 1 || job.Orphans[0] != ownOrphan {
+		t.Errorf("orphans = %v (count %d), want [%s]", job.Orphans, job.OrphanCount, ownOrphan)
+	}
+}
+
+func TestReconcile_OneAtATime(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	rc := ts.reconcile
+	rc.mu.Lock()
+	rc.running = "inprogress"
+	rc.mu.Unlock()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/reconcile", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Code != ErrCodeConflict || !strings.Contains(resp.Message, "inprogress") {
+		t.Errorf("response = %+v, want conflict naming the running job", resp)
+	}
+}
+
+func TestReconcile_UnknownJob(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reconcile/nope", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestReconcile_RequiresAdminToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	for _, auth := range []string{"", "Bearer wrong-token", testAdminToken} {
+		req := httptest.NewRequest(http.MethodPost, "/api/reconcile", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+	ts.reconcile.mu.Lock()
+	defer ts.reconcile.mu.Unlock()
+	if len(ts.reconcile.jobs) != 0 {
+		t.Errorf("unauthorized requests started %d reconcile jobs", len(ts.reconcile.jobs))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"unicode"
 
 	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/handler"
 )
 
 // maxPackagePathLen bounds the wildcard portion of package routes (name plus
@@ -42,13 +43,16 @@ func validatePackagePath(path string) error {
 // off the last segment as a non-name suffix (version, action, etc.) and
 // tries again, working backwards until a match is found or segments run out.
 //
-// Returns the package name and the remaining path segments after the name.
-// If no package is found, returns empty name and the original segments.
+// Candidates are canonicalized the same way the proxy stores names, so
+// /pypi/Flask finds the flask row.
+//
+// Returns the canonical package name and the remaining path segments after
+// the name. If no package is found, returns empty name and the original segments.
 func resolvePackageName(db *database.DB, ecosystem string, segments []string) (name string, rest []string) {
 	// Try increasingly longer prefixes as the package name.
 	// Start with the longest possible name (all segments) and work down.
 	for i := len(segments); i >= 1; i-- {
-		candidate := strings.Join(segments[:i], "/")
+		candidate := handler.Canonicalize(ecosystem, strings.Join(segments[:i], "/"))
 		pkg, err := db.GetPackageByEcosystemName(ecosystem, candidate)
 		if err == nil && pkg != nil {
 			return candidate, segments[i:]
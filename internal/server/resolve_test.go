@@ -39,6 +39,7 @@ func TestResolvePackageName(t *testing.T) {
 	seedPackage(t, db, "npm", "lodash", "pkg:npm/lodash")
 	seedPackage(t, db, "composer", "monolog/monolog", "pkg:composer/monolog/monolog")
 	seedPackage(t, db, "composer", "symfony/console", "pkg:composer/symfony/console")
+	seedPackage(t, db, "pypi", "flask", "pkg:pypi/flask")
 
 	tests := []struct {
 		name      string
@@ -68,6 +69,14 @@ func TestResolvePackageName(t *testing.T) {
 			segments: []string{"symfony", "console", "6.0.0", "browse"},
 			wantName: "symfony/console", wantRest: []string{"6.0.0", "browse"},
 		},
+		{
+			name: "non-canonical spelling", ecosystem: "pypi",
+			segments: []string{"Flask", "3.0.0"}, wantName: "flask", wantRest: []string{"3.0.0"},
+		},
+		{
+			name: "non-canonical namespaced spelling", ecosystem: "composer",
+			segments: []string{"Symfony", "Console"}, wantName: "symfony/console", wantRest: nil,
+		},
 		{
 			name: "not found", ecosystem: "npm",
 			segments: []string{"nonexistent"}, wantName: "", wantRest: []string{"nonexistent"},
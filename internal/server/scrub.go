@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/handler"
+)
+
+// startIntegrityScrub periodically re-hashes a random sample of cached
+// artifacts, clearing any that no longer match. Like the vacuum, each run
+// waits until no requests are in flight so it doesn't compete with
+// downloads for storage bandwidth.
+func (s *Server) startIntegrityScrub(ctx context.Context, proxy *handler.Proxy) {
+	interval := s.cfg.ParseStorageScrubInterval()
+	if interval <= 0 {
+		return
+	}
+	sample := s.cfg.ParseStorageScrubSampleSize()
+
+	s.logger.Info("integrity scrub enabled", "interval", interval, "sample_size", sample)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !s.waitForIdle(ctx, vacuumIdleRetry) {
+					return
+				}
+				s.scrubArtifacts(ctx, proxy, sample)
+			}
+		}
+	}()
+}
+
+func (s *Server) scrubArtifacts(ctx context.Context, proxy *handler.Proxy, sample int) {
+	start := time.Now()
+	result, err := proxy.ScrubArtifacts(ctx, sample)
+	if err != nil {
+		s.logger.Warn("integrity scrub failed", "error", err)
+		return
+	}
+	s.logger.Info("integrity scrub completed",
+		"checked", result.Checked,
+		"corrupt", result.Corrupt,
+		"missing", result.Missing,
+		"errors", result.Errors,
+		"duration", time.Since(start))
+}
@@ -23,11 +23,11 @@
 // Additional endpoints:
 //   - /health       - Health check endpoint
 //   - /stats        - Cache statistics (JSON)
-//   - /openapi.json - OpenAPI spec (JSON)
+//   - /openapi.json - Swagger 2.0 spec (JSON)
 //   - /metrics      - Prometheus metrics
 //
 // Web UI (HTML), mounted under /ui so reverse proxies can gate it
-// separately from the package endpoints:
+// separately from the package endpoints. Disabled with dashboard.enabled:
 //   - /ui/                - Dashboard
 //   - /ui/install         - Client configuration guide
 //   - /ui/packages        - List all cached packages
@@ -36,14 +36,27 @@
 //   - /ui/api/browse/...  - Archive browsing (used by the UI)
 //   - /ui/api/compare/... - Archive diffing (used by the UI)
 //
-// API endpoints for enrichment data:
+// API endpoints for enrichment data, disabled with api.enabled:
+//   - GET  /api/openapi.json                        - OpenAPI 3 spec (JSON)
 //   - GET  /api/package/{ecosystem}/{name}          - Package metadata
 //   - GET  /api/package/{ecosystem}/{name}/{version} - Version metadata with vulns
+//   - GET  /api/versions/{ecosystem}/{name}         - Known versions with cache status
+//   - GET  /api/deps/{ecosystem}/{name}/{version}   - Dependencies declared by a cached version
 //   - GET  /api/vulns/{ecosystem}/{name}            - Package vulnerabilities
 //   - GET  /api/vulns/{ecosystem}/{name}/{version}  - Version vulnerabilities
 //   - POST /api/outdated                            - Check outdated packages
 //   - POST /api/bulk                                - Bulk package lookup
+//   - POST /api/cached                              - Check which versions are cached
 //   - GET  /api/packages                            - List cached packages (JSON)
+//   - GET  /api/policy-events                       - Policy decision audit log
+//   - GET  /api/usage                               - Artifact downloads per team
+//   - GET  /api/collisions                          - Package names shared across ecosystems
+//   - GET  /api/eviction/preview                    - Dry-run of LRU eviction
+//   - POST /api/artifacts/pin                       - Pin an artifact against eviction
+//   - POST /api/reconcile                           - Start a storage/database reconcile
+//   - GET  /api/reconcile/{id}                      - Reconcile job progress
+//   - GET  /api/debug/upstream                      - Raw upstream response (debug.enabled)
+//   - GET  /api/inflight                            - Upstream downloads in progress (debug.enabled)
 package server
 
 import (
@@ -52,10 +65,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	swaggerdoc "github.com/git-pkgs/proxy/docs/swagger"
@@ -92,6 +107,28 @@ type Server struct {
 	templates *Templates
 	cancel      context.CancelFunc
 	healthCache *healthCache
+	reconcile   *reconciler
+	inFlight    atomic.Int64
+
+	// bulkLookup reports whether POST /api/bulk can use the ecosystems
+	// API. Nil when the API is disabled.
+	bulkLookup *HealthCheck
+
+	// cacheRecording returns the last failure to record a fetched artifact
+	// in the database. Nil until the protocol handlers are set up.
+	cacheRecording func() error
+
+	// metadataTTL returns how long cached metadata under a cache key stays
+	// fresh. Nil until the protocol handlers are set up.
+	metadataTTL func(ecosystem, cacheKey string) time.Duration
+
+	// flushHitTimeline writes buffered cache hits to artifact_hits. Nil
+	// unless the hit timeline is enabled.
+	flushHitTimeline func()
+
+	// evictMu is held by each LRU eviction pass and by POST /api/pin while
+	// it pins a version's artifacts.
+	evictMu sync.Mutex
 }
 
 // New creates a new Server with the given configuration.
@@ -104,7 +141,7 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 	case "postgres":
 		db, err = database.OpenPostgresOrCreate(cfg.Database.URL)
 	default:
-		db, err = database.OpenOrCreate(cfg.Database.Path)
+		db, err = database.OpenOrCreateWithBusyTimeout(cfg.Database.Path, cfg.ParseDatabaseBusyTimeout())
 	}
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
@@ -117,12 +154,11 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 	}
 
 	// Initialize storage
-	storageURL := cfg.Storage.URL
-	if storageURL == "" {
-		// Fall back to file:// with Path
-		storageURL = "file://" + cfg.Storage.Path //nolint:staticcheck // backwards compat
+	for _, d := range cfg.Deprecations() {
+		logger.Warn("deprecated config setting",
+			"field", d.Field, "replacement", d.Replacement, "detail", d.Detail)
 	}
-	store, err := storage.OpenBucket(context.Background(), storageURL)
+	store, err := storage.OpenBucket(context.Background(), cfg.StorageURL())
 	if err != nil {
 		_ = db.Close()
 		return nil, fmt.Errorf("initializing storage: %w", err)
@@ -131,18 +167,25 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 	// Verify storage is accessible (catches bad S3 credentials/endpoints early).
 	// Exists returns (false, nil) for a missing key, so only real connectivity
 	// or permission errors surface here.
-	if _, err := store.Exists(context.Background(), ".health-check"); err != nil {
+	if _, err := store.Exists(context.Background(), storage.PrefixedPath(cfg.Storage.Prefix, ".health-check")); err != nil {
 		_ = store.Close()
 		_ = db.Close()
 		return nil, fmt.Errorf("verifying storage connectivity: %w", err)
 	}
 
+	if err := checkStorageIdentity(context.Background(), cfg, db, store, logger); err != nil {
+		_ = store.Close()
+		_ = db.Close()
+		return nil, fmt.Errorf("checking storage identity: %w", err)
+	}
+
 	hc, err := newHealthCache(store, cfg.Health.StorageProbeInterval, logger)
 	if err != nil {
 		_ = store.Close()
 		_ = db.Close()
 		return nil, fmt.Errorf("initializing health cache: %w", err)
 	}
+	hc.prefix = cfg.Storage.Prefix
 
 	return &Server{
 		cfg:         cfg,
@@ -154,10 +197,59 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 	}, nil
 }
 
+// mountUI registers the web UI under /ui and redirects / to it. Mounted
+// under /ui so a reverse proxy can apply different access rules to it than
+// to the package endpoints (#123). With the dashboard disabled nothing is
+// registered and those paths get a 404.
+func (s *Server) mountUI(r chi.Router) {
+	if !s.cfg.Dashboard.Enabled {
+		return
+	}
+	r.Route("/ui", func(ui chi.Router) {
+		ui.Use(s.compress())
+		ui.Mount("/static", http.StripPrefix("/ui/static/", staticHandler()))
+		ui.Get("/", s.handleRoot)
+		ui.Get("/install", s.handleInstall)
+		ui.Get("/search", s.handleSearch)
+		ui.Get("/packages", s.handlePackagesList)
+		ui.Get("/package/{ecosystem}/*", s.handlePackagePath)
+		ui.Get("/api/browse/{ecosystem}/*", s.handleBrowsePath)
+		ui.Get("/api/compare/{ecosystem}/*", s.handleComparePath)
+	})
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	})
+}
+
+// compress returns the response compression middleware for dashboard and
+// API routes, or a pass-through when compression is off.
+func (s *Server) compress() func(http.Handler) http.Handler {
+	if !s.cfg.HTTP.Compression.Enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return CompressMiddleware(s.cfg.ParseCompressionMinSize())
+}
+
 // Start starts the HTTP server.
 func (s *Server) Start() error {
+	var certs *certReloader
+	if s.cfg.TLS.Enabled() {
+		var err error
+		if certs, err = newCertReloader(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile, s.logger); err != nil {
+			return err
+		}
+		if certs.clientCAs, err = s.cfg.TLS.ClientCAs(); err != nil {
+			return err
+		}
+	}
+
+	for _, host := range s.cfg.Upstream.InsecureHosts() {
+		s.logger.Warn("TLS certificate verification disabled for upstream host; connections to it can be intercepted",
+			"host", host)
+	}
+
 	// Create shared components with circuit breaker
-	baseFetcher := fetch.NewFetcher(fetch.WithAuthFunc(s.authForURL))
+	baseFetcher := fetch.NewFetcher(s.fetcherOptions()...)
 	fetcher := fetch.NewCircuitBreakerFetcher(baseFetcher)
 	resolver := fetch.NewResolver()
 	cd := &cooldown.Config{
@@ -165,17 +257,93 @@ func (s *Server) Start() error {
 		Ecosystems: s.cfg.Cooldown.Ecosystems,
 		Packages:   s.cfg.Cooldown.NormalizedPackages(),
 	}
+	vulnSource, err := enrichment.NewVulnSource(s.cfg.Enrichment.VulnSources, s.cfg.Enrichment.GHSATokenValue(), s.logger)
+	if err != nil {
+		return fmt.Errorf("configuring vulnerability sources: %w", err)
+	}
+	enrichSvc := enrichment.New(s.logger, enrichment.WithVulnSource(vulnSource))
+
 	proxy := handler.NewProxy(s.db, s.storage, fetcher, resolver, s.logger)
 	proxy.HTTPClient.Timeout = s.cfg.ParseHTTPTimeout()
+	proxy.SetUpstreamTransport(s.upstreamRoundTripper())
 	proxy.Cooldown = cd
+	if period, ecosystems := s.cfg.Quarantine.ParseDefault(), s.cfg.Quarantine.ParseEcosystems(); period > 0 || len(ecosystems) > 0 {
+		proxy.Quarantine = &handler.Quarantine{
+			Default:    period,
+			Ecosystems: ecosystems,
+			Allow:      s.cfg.Quarantine.NormalizedAllow(),
+			FailOpen:   s.cfg.Quarantine.FailOpen,
+		}
+	}
 	proxy.CacheMetadata = s.cfg.CacheMetadata
 	proxy.MetadataTTL = s.cfg.ParseMetadataTTL()
+	proxy.MetadataTTLOverrides = s.cfg.ParseMetadataTTLOverrides()
 	proxy.MetadataMaxSize = s.cfg.ParseMetadataMaxSize()
+	proxy.ServeBufferSize = s.cfg.ParseServeBufferSize()
 	proxy.GradleReadOnly = s.cfg.Gradle.BuildCache.ReadOnly
 	proxy.GradleMaxUploadSize = s.cfg.ParseGradleBuildCacheMaxUploadSize()
+	proxy.NPMPublish = s.cfg.NPM.Publish
+	proxy.NPMPublishToken = s.cfg.NPM.PublishTokenValue()
+	proxy.NPMLocalNames = s.cfg.NPM.LocalNames
+	proxy.NPMMaxPublishSize = s.cfg.ParseNPMMaxPublishSize()
+	proxy.NPMUnpublish = s.cfg.NPM.Unpublish
+	proxy.SetNPMScopeUpstreams(s.cfg.NPM.Scopes)
 	proxy.DirectServe = s.cfg.Storage.DirectServe
 	proxy.DirectServeTTL = s.cfg.ParseDirectServeTTL()
 	proxy.DirectServeBaseURL = s.cfg.Storage.DirectServeBaseURL
+	proxy.MaxFilenameLength = s.cfg.Storage.MaxFilenameLength
+	proxy.StoragePrefix = s.cfg.Storage.Prefix
+	proxy.ContainerPrefetchIndex = s.cfg.Container.PrefetchIndex
+	proxy.CargoIndexTTL = s.cfg.ParseCargoIndexTTL()
+	proxy.GemSpecsTTL = s.cfg.ParseGemSpecsTTL()
+	proxy.GoListTTL = s.cfg.ParseGoListTTL()
+	proxy.CondaChannels = s.cfg.Conda.Channels
+	proxy.CondaDefaultChannel = s.cfg.Conda.DefaultChannel
+	proxy.DebianSuites = s.cfg.Debian.Suites
+	proxy.DebianDefaultSuite = s.cfg.Debian.DefaultSuite
+	proxy.TrustedHosts = s.cfg.Upstream.TrustedHosts
+	proxy.AllowedArtifacts = s.cfg.Cache.AllowedArtifacts
+	if len(s.cfg.Cache.IndexOnly) > 0 {
+		proxy.IndexOnly = make(map[string]bool, len(s.cfg.Cache.IndexOnly))
+		for _, ecosystem := range s.cfg.Cache.IndexOnly {
+			proxy.IndexOnly[ecosystem] = true
+		}
+	}
+	proxy.NotFoundTTL = s.cfg.ParseNotFoundTTL()
+	proxy.FailClosedOnDBError = s.cfg.Database.FailClosed
+	s.cacheRecording = proxy.CacheRecordingError
+	s.metadataTTL = proxy.MetadataTTLFor
+	proxy.ResolveCacheTTL = s.cfg.ParseResolveCacheTTL()
+	proxy.Enrichment = enrichSvc
+	if s.cfg.Debug.AllowUpstreamOverride {
+		s.logger.Warn("debug upstream override enabled; X-Proxy-Upstream is honoured",
+			"hosts", s.cfg.Debug.UpstreamOverrideHosts)
+		proxy.EnableUpstreamOverride(s.cfg.Debug.UpstreamOverrideHosts)
+	}
+	proxy.CacheTrace = s.cfg.Debug.CacheTrace
+	if s.cfg.Debug.AllowCacheRefresh {
+		s.logger.Warn("debug cache refresh enabled; X-Proxy-Refresh and Cache-Control: no-cache are honoured with a valid token",
+			"ecosystems", s.cfg.Debug.CacheRefreshEcosystems)
+		proxy.EnableCacheRefresh(s.cfg.Debug.CacheRefreshEcosystems, s.cfg.Debug.CacheRefreshTokenValue())
+	}
+	if s.cfg.DetectBaseURL() {
+		if err := proxy.EnableBaseURLDetection(s.cfg.TrustedProxies); err != nil {
+			return fmt.Errorf("configuring base URL detection: %w", err)
+		}
+	}
+	proxy.SetSelfURLs(s.cfg.StaticBaseURL())
+	proxy.MaxConcurrentFetches = s.cfg.Upstream.MaxConcurrentFetches
+	proxy.FetchQueueTimeout = s.cfg.ParseFetchQueueTimeout()
+	proxy.FetchTimeout = s.cfg.ParseFetchTimeout()
+	proxy.SkipContentCheck = s.cfg.Upstream.SkipContentCheck
+	proxy.NormalizeUpstreamURLs = s.cfg.Upstream.NormalizeURLs
+	proxy.SetForwardedResponseHeaders(s.cfg.Upstream.ResponseHeaders)
+	proxy.SetUpstreamFallbacks(s.cfg.Upstream.Fallbacks)
+	proxy.PolicyEventsMax = s.cfg.API.PolicyEventsMax
+	if s.cfg.Usage.Enabled {
+		proxy.EnableUsageLog(s.cfg.Usage.TeamHeader, s.cfg.Usage.ClientCertTeam)
+		proxy.UsageLogMax = s.cfg.Usage.MaxRows
+	}
 
 	// Create router with Chi
 	r := chi.NewRouter()
@@ -183,61 +351,76 @@ func (s *Server) Start() error {
 	// Add middleware
 	r.Use(middleware.RequestID)
 	r.Use(RequestIDMiddleware)
+	r.Use(StaticHeadersMiddleware(s.cfg.HTTP.Headers))
 	r.Use(s.LoggerMiddleware)
-	r.Use(middleware.Recoverer)
+	r.Use(s.RecoverMiddleware)
+	r.Use(proxy.UpstreamOverrideMiddleware)
+	r.Use(proxy.CacheRefreshMiddleware)
+	r.Use(proxy.UsageMiddleware)
+	r.Use(handler.ClientIPMiddleware)
+	r.Use(proxy.BaseURLMiddleware)
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path != "/metrics" {
 				metrics.IncrementActiveRequests()
 				defer metrics.DecrementActiveRequests()
+				s.inFlight.Add(1)
+				defer s.inFlight.Add(-1)
 			}
 			next.ServeHTTP(w, r)
 		})
 	})
 
-	// Mount protocol handlers
-	npmHandler := handler.NewNPMHandler(proxy, s.cfg.BaseURL)
-	cargoHandler := handler.NewCargoHandler(proxy, s.cfg.BaseURL)
-	gemHandler := handler.NewGemHandler(proxy, s.cfg.BaseURL)
-	goHandler := handler.NewGoHandler(proxy, s.cfg.BaseURL)
-	hexHandler := handler.NewHexHandler(proxy, s.cfg.BaseURL)
-	pubHandler := handler.NewPubHandler(proxy, s.cfg.BaseURL)
-	pypiHandler := handler.NewPyPIHandler(proxy, s.cfg.BaseURL)
+	// Mount protocol handlers. With base_url: auto this is only a fallback;
+	// handlers that write links use the base URL detected per request.
+	baseURL := s.cfg.StaticBaseURL()
+	npmHandler := handler.NewNPMHandler(proxy, baseURL)
+	cargoHandler := handler.NewCargoHandler(proxy, baseURL)
+	gemHandler := handler.NewGemHandler(proxy, baseURL)
+	goHandler := handler.NewGoHandler(proxy, baseURL)
+	hexHandler := handler.NewHexHandler(proxy, baseURL)
+	pubHandler := handler.NewPubHandler(proxy, baseURL)
+	pypiHandler := handler.NewPyPIHandler(proxy, baseURL)
 	mavenHandler := handler.NewMavenHandler(
 		proxy,
-		s.cfg.BaseURL,
+		baseURL,
 		s.cfg.Upstream.Maven,
 		s.cfg.Upstream.GradlePluginPortal,
 	)
 	gradleHandler := handler.NewGradleBuildCacheHandler(proxy)
-	nugetHandler := handler.NewNuGetHandler(proxy, s.cfg.BaseURL)
-	composerHandler := handler.NewComposerHandler(proxy, s.cfg.BaseURL)
-	conanHandler := handler.NewConanHandler(proxy, s.cfg.BaseURL)
-	condaHandler := handler.NewCondaHandler(proxy, s.cfg.BaseURL)
-	cranHandler := handler.NewCRANHandler(proxy, s.cfg.BaseURL)
-	juliaHandler := handler.NewJuliaHandler(proxy, s.cfg.BaseURL)
-	containerHandler := handler.NewContainerHandler(proxy, s.cfg.BaseURL)
-	debianHandler := handler.NewDebianHandler(proxy, s.cfg.BaseURL)
-	rpmHandler := handler.NewRPMHandler(proxy, s.cfg.BaseURL)
-
-	r.Mount("/npm", http.StripPrefix("/npm", npmHandler.Routes()))
-	r.Mount("/cargo", http.StripPrefix("/cargo", cargoHandler.Routes()))
-	r.Mount("/gem", http.StripPrefix("/gem", gemHandler.Routes()))
-	r.Mount("/go", http.StripPrefix("/go", goHandler.Routes()))
-	r.Mount("/hex", http.StripPrefix("/hex", hexHandler.Routes()))
-	r.Mount("/pub", http.StripPrefix("/pub", pubHandler.Routes()))
-	r.Mount("/pypi", http.StripPrefix("/pypi", pypiHandler.Routes()))
-	r.Mount("/maven", http.StripPrefix("/maven", mavenHandler.Routes()))
-	r.Mount("/gradle", http.StripPrefix("/gradle", gradleHandler.Routes()))
-	r.Mount("/nuget", http.StripPrefix("/nuget", nugetHandler.Routes()))
-	r.Mount("/composer", http.StripPrefix("/composer", composerHandler.Routes()))
-	r.Mount("/conan", http.StripPrefix("/conan", conanHandler.Routes()))
-	r.Mount("/conda", http.StripPrefix("/conda", condaHandler.Routes()))
-	r.Mount("/cran", http.StripPrefix("/cran", cranHandler.Routes()))
-	r.Mount("/julia", http.StripPrefix("/julia", juliaHandler.Routes()))
-	r.Mount("/v2", http.StripPrefix("/v2", containerHandler.Routes()))
-	r.Mount("/debian", http.StripPrefix("/debian", debianHandler.Routes()))
-	r.Mount("/rpm", http.StripPrefix("/rpm", rpmHandler.Routes()))
+	nugetHandler := handler.NewNuGetHandler(proxy, baseURL)
+	composerHandler := handler.NewComposerHandler(proxy, baseURL)
+	conanHandler := handler.NewConanHandler(proxy, baseURL)
+	condaHandler := handler.NewCondaHandler(proxy, baseURL)
+	cranHandler := handler.NewCRANHandler(proxy, baseURL)
+	juliaHandler := handler.NewJuliaHandler(proxy, baseURL)
+	containerHandler := handler.NewContainerHandler(proxy, baseURL)
+	debianHandler := handler.NewDebianHandler(proxy, baseURL)
+	rpmHandler := handler.NewRPMHandler(proxy, baseURL)
+
+	// Protocol responses get a Cache-Control policy so CDNs and clients can
+	// keep immutable artifacts and revalidate metadata.
+	r.Group(func(r chi.Router) {
+		r.Use(proxy.CacheControlMiddleware)
+		r.Mount("/npm", http.StripPrefix("/npm", npmHandler.Routes()))
+		r.Mount("/cargo", http.StripPrefix("/cargo", cargoHandler.Routes()))
+		r.Mount("/gem", http.StripPrefix("/gem", gemHandler.Routes()))
+		r.Mount("/go", http.StripPrefix("/go", goHandler.Routes()))
+		r.Mount("/hex", http.StripPrefix("/hex", hexHandler.Routes()))
+		r.Mount("/pub", http.StripPrefix("/pub", pubHandler.Routes()))
+		r.Mount("/pypi", http.StripPrefix("/pypi", pypiHandler.Routes()))
+		r.Mount("/maven", http.StripPrefix("/maven", mavenHandler.Routes()))
+		r.Mount("/gradle", http.StripPrefix("/gradle", gradleHandler.Routes()))
+		r.Mount("/nuget", http.StripPrefix("/nuget", nugetHandler.Routes()))
+		r.Mount("/composer", http.StripPrefix("/composer", composerHandler.Routes()))
+		r.Mount("/conan", http.StripPrefix("/conan", conanHandler.Routes()))
+		r.Mount("/conda", http.StripPrefix("/conda", condaHandler.Routes()))
+		r.Mount("/cran", http.StripPrefix("/cran", cranHandler.Routes()))
+		r.Mount("/julia", http.StripPrefix("/julia", juliaHandler.Routes()))
+		r.Mount("/v2", http.StripPrefix("/v2", containerHandler.Routes()))
+		r.Mount("/debian", http.StripPrefix("/debian", debianHandler.Routes()))
+		r.Mount("/rpm", http.StripPrefix("/rpm", rpmHandler.Routes()))
+	})
 
 	// Health, stats, and metrics endpoints
 	r.Get("/health", s.handleHealth)
@@ -247,59 +430,108 @@ func (s *Server) Start() error {
 		metrics.Handler().ServeHTTP(w, r)
 	})
 
-	// Web UI. Mounted under /ui so a reverse proxy can apply different
-	// access rules to it than to the package endpoints above (#123).
-	r.Route("/ui", func(ui chi.Router) {
-		ui.Mount("/static", http.StripPrefix("/ui/static/", staticHandler()))
-		ui.Get("/", s.handleRoot)
-		ui.Get("/install", s.handleInstall)
-		ui.Get("/search", s.handleSearch)
-		ui.Get("/packages", s.handlePackagesList)
-		ui.Get("/package/{ecosystem}/*", s.handlePackagePath)
-		ui.Get("/api/browse/{ecosystem}/*", s.handleBrowsePath)
-		ui.Get("/api/compare/{ecosystem}/*", s.handleComparePath)
-	})
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/ui/", http.StatusFound)
-	})
-
-	// API endpoints for enrichment data
-	enrichSvc := enrichment.New(s.logger)
-	apiHandler := NewAPIHandler(enrichSvc, s.db)
-
-	r.Get("/api/package/{ecosystem}/*", apiHandler.HandlePackagePath)
-	r.Get("/api/vulns/{ecosystem}/*", apiHandler.HandleVulnsPath)
-	r.Post("/api/outdated", apiHandler.HandleOutdated)
-	r.Post("/api/bulk", apiHandler.HandleBulkLookup)
-	r.Get("/api/search", apiHandler.HandleSearch)
-	r.Get("/api/packages", apiHandler.HandlePackagesList)
+	s.mountUI(r)
 
 	// Start background context (used by mirror jobs and cleanup)
 	bgCtx, bgCancel := context.WithCancel(context.Background())
 	s.cancel = bgCancel
 	s.startGradleBuildCacheEviction(bgCtx)
+	s.startDatabaseVacuum(bgCtx)
+	s.startHitTimeline(bgCtx, proxy)
+	s.startIntegrityScrub(bgCtx, proxy)
+	s.startLatestVersionBackfill(bgCtx, enrichSvc)
+
+	s.reconcile = newReconciler(bgCtx, s.db, s.storage, s.logger)
+	s.reconcile.prefix = s.cfg.Storage.Prefix
+
+	// JSON responses such as package lists can be large, so the API is
+	// compressed like the dashboard.
+	api := r.With(s.compress())
+
+	if s.cfg.API.Enabled {
+		// API endpoints for enrichment data
+		apiHandler := NewAPIHandler(enrichSvc, s.db)
+		apiHandler.maxBodySize = s.cfg.ParseAPIMaxBodySize()
+		apiHandler.maxItems = s.cfg.ParseAPIMaxItems()
+		apiHandler.pageSize = s.cfg.ParseAPIDefaultPageSize()
+		apiHandler.maxPageSize = s.cfg.ParseAPIMaxPageSize()
+		apiHandler.metadataTTL = proxy.MetadataTTLFor
+		apiHandler.storage = s.storage
+		if err := apiHandler.ecosystemsErr; err != nil {
+			s.logger.Warn("ecosystems client unavailable, bulk lookups will query each registry",
+				"error", err)
+			s.bulkLookup = &HealthCheck{Status: "degraded", Error: err.Error()}
+		} else {
+			s.bulkLookup = &HealthCheck{Status: "ok"}
+		}
+		apiTimeout := requestTimeout(s.cfg.ParseAPIRequestTimeout())
+
+		api.Get("/api/openapi.json", s.handleOpenAPI3JSON)
+		api.Get("/api/package/{ecosystem}/*", apiHandler.HandlePackagePath)
+		api.Get("/api/versions/{ecosystem}/*", apiHandler.HandleVersionsPath)
+		api.Get("/api/deps/{ecosystem}/*", apiHandler.HandleDepsPath)
+		api.Get("/api/vulns/{ecosystem}/*", apiHandler.HandleVulnsPath)
+		api.With(apiTimeout).Post("/api/outdated", apiHandler.HandleOutdated)
+		api.With(apiTimeout).Post("/api/bulk", apiHandler.HandleBulkLookup)
+		api.Post("/api/cached", apiHandler.HandleCachedCheck)
+		api.Get("/api/search", apiHandler.HandleSearch)
+		api.Get("/api/packages", apiHandler.HandlePackagesList)
+		api.Get("/api/usage", apiHandler.HandleUsage)
+		api.Get("/api/collisions", apiHandler.HandleCollisions)
+
+		// Operator endpoints that change the cache or read through all of
+		// it are only served with an admin token, which every request must
+		// carry.
+		if token := s.cfg.Admin.TokenValue(); token != "" {
+			admin := api.With(AdminTokenMiddleware(token))
+			admin.Get("/api/eviction/preview", s.handleEvictionPreview)
+			admin.Get("/api/policy-events", apiHandler.HandlePolicyEvents)
+			admin.Post("/api/artifacts/pin", s.handleArtifactPin)
+			admin.Post("/api/reconcile", s.reconcile.handleReconcileStart)
+			admin.Get("/api/reconcile/{id}", s.reconcile.handleReconcileGet)
+
+			// Pinning by version downloads from upstream, so it also needs
+			// mirror_api.
+			if s.cfg.MirrorAPI {
+				pinAPI := NewPinAPIHandler(proxy, s.db, s.logger, &s.evictMu)
+				pinAPI.maxBodySize = s.cfg.ParseAPIMaxBodySize()
+				pinAPI.maxItems = s.cfg.ParseAPIMaxItems()
+				admin.Post("/api/pin", pinAPI.HandlePin)
+			}
+		}
+	} else if s.cfg.MirrorAPI {
+		s.logger.Warn("mirror_api is set but the JSON API is disabled; /api/mirror and /api/pin are not served")
+	}
+
+	if s.cfg.Debug.Enabled {
+		s.logger.Warn("debug endpoints enabled; /api/debug/upstream fetches raw upstream responses and /api/inflight lists running downloads")
+		r.Method(http.MethodGet, "/api/debug/upstream",
+			handler.NewDebugUpstreamHandler(proxy, s.cfg.Debug.TokenValue(), s.cfg.Upstream.Maven))
+		r.Method(http.MethodGet, "/api/inflight", handler.NewInflightHandler(proxy, s.cfg.Debug.TokenValue()))
+	}
 
 	// Mirror API endpoints (opt-in via mirror_api config or PROXY_MIRROR_API env)
-	if s.cfg.MirrorAPI {
+	if s.cfg.API.Enabled && s.cfg.MirrorAPI {
 		mirrorSvc := mirror.New(proxy, s.db, s.storage, s.logger, 4) //nolint:mnd // default concurrency
 		jobStore := mirror.NewJobStore(bgCtx, mirrorSvc)
 		mirrorAPI := NewMirrorAPIHandler(jobStore)
-		r.Post("/api/mirror", mirrorAPI.HandleCreate)
-		r.Get("/api/mirror/{id}", mirrorAPI.HandleGet)
-		r.Delete("/api/mirror/{id}", mirrorAPI.HandleCancel)
+		mirrorAPI.maxBodySize = s.cfg.ParseAPIMaxBodySize()
+		mirrorAPI.maxItems = s.cfg.ParseAPIMaxItems()
+		api.Post("/api/mirror", mirrorAPI.HandleCreate)
+		api.Get("/api/mirror/{id}", mirrorAPI.HandleGet)
+		api.Delete("/api/mirror/{id}", mirrorAPI.HandleCancel)
 		go jobStore.StartCleanup(bgCtx)
 	}
 
-	s.http = &http.Server{
-		Addr:         s.cfg.Listen,
-		Handler:      r,
-		ReadTimeout:  serverReadTimeout,
-		WriteTimeout: serverWriteTimeout, // Large artifacts need time
-		IdleTimeout:  serverIdleTimeout,
+	s.http = s.newHTTPServer(r)
+	if certs != nil {
+		s.http.TLSConfig = certs.tlsConfig()
 	}
 
 	s.logger.Info("starting server",
 		"listen", s.cfg.Listen,
+		"h2c", s.cfg.H2C,
+		"tls", s.cfg.TLS.Enabled(),
 		"base_url", s.cfg.BaseURL,
 		"ui_url", s.cfg.UIBaseURL,
 		"storage", s.storage.URL(),
@@ -307,10 +539,14 @@ func (s *Server) Start() error {
 	go s.updateCacheStatsMetrics()
 	go s.startEvictionLoop(bgCtx)
 
+	if s.http.TLSConfig != nil {
+		return s.http.ListenAndServeTLS("", "")
+	}
 	return s.http.ListenAndServe()
 }
 
-// updateCacheStatsMetrics periodically updates cache statistics in Prometheus metrics.
+// updateCacheStatsMetrics periodically updates cache statistics, overall and
+// per ecosystem, in Prometheus metrics.
 func (s *Server) updateCacheStatsMetrics() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
@@ -330,6 +566,22 @@ func (s *Server) updateCacheStats() {
 		return
 	}
 	metrics.UpdateCacheStats(stats.TotalSize, stats.TotalArtifacts)
+
+	byEcosystem, err := s.db.GetCacheStatsByEcosystem()
+	if err != nil {
+		s.logger.Warn("failed to get per-ecosystem cache stats for metrics", "error", err)
+		return
+	}
+	composition := make([]metrics.EcosystemCacheStats, 0, len(byEcosystem))
+	for _, e := range byEcosystem {
+		composition = append(composition, metrics.EcosystemCacheStats{
+			Ecosystem: e.Ecosystem,
+			Artifacts: e.Artifacts,
+			SizeBytes: e.Size,
+			Hits:      e.Hits,
+		})
+	}
+	metrics.UpdateEcosystemCacheStats(composition)
 }
 
 // Shutdown gracefully shuts down the server.
@@ -348,6 +600,12 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Requests have drained, so write the last buffered hits before the
+	// database is closed.
+	if s.flushHitTimeline != nil {
+		s.flushHitTimeline()
+	}
+
 	if s.storage != nil {
 		if err := s.storage.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("storage close: %w", err))
@@ -490,14 +748,15 @@ func (s *Server) handleOpenAPIJSON(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (s *Server) handleInstall(w http.ResponseWriter, r *http.Request) {
+	baseURL := handler.RequestBaseURL(r.Context(), s.cfg.StaticBaseURL())
 	data := struct {
 		Layout
 		BaseURL    string
 		Registries []RegistryConfig
 	}{
 		Layout:     s.layoutFor(r),
-		BaseURL:    s.cfg.BaseURL,
-		Registries: getRegistryConfigs(s.cfg.BaseURL),
+		BaseURL:    baseURL,
+		Registries: getRegistryConfigs(baseURL),
 	}
 
 	if err := s.templates.Render(w, "install", data); err != nil {
@@ -514,13 +773,7 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	page := 1
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-	limit := 50
+	page, limit := pagination(r, s.cfg.ParseAPIDefaultPageSize(), s.cfg.ParseAPIMaxPageSize())
 
 	results, err := s.db.SearchPackages(query, ecosystem, limit, (page-1)*limit)
 	if err != nil {
@@ -581,13 +834,7 @@ func (s *Server) handlePackagesList(w http.ResponseWriter, r *http.Request) {
 		sortBy = defaultSortBy
 	}
 
-	page := 1
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-	limit := 50
+	page, limit := pagination(r, s.cfg.ParseAPIDefaultPageSize(), s.cfg.ParseAPIMaxPageSize())
 
 	packages, err := s.db.ListCachedPackages(ecosystem, sortBy, limit, (page-1)*limit)
 	if err != nil {
@@ -677,7 +924,7 @@ func (s *Server) handlePackagePath(w http.ResponseWriter, r *http.Request) {
 	// Check for compare route: {name}/compare/{versions}
 	for i, seg := range segments {
 		if seg == "compare" && i > 0 && i < len(segments)-1 {
-			name := strings.Join(segments[:i], "/")
+			name := handler.Canonicalize(ecosystem, strings.Join(segments[:i], "/"))
 			versions := strings.Join(segments[i+1:], "/")
 			s.showComparePage(w, r, ecosystem, name, versions)
 			return
@@ -730,7 +977,7 @@ func (s *Server) showPackage(w http.ResponseWriter, r *http.Request, ecosystem,
 		return
 	}
 
-	versions, err := s.db.GetVersionsByPackagePURL(pkg.PURL)
+	versions, err := s.db.GetVersionsByPackagePURLSorted(pkg.PURL)
 	if err != nil {
 		s.logger.Error("failed to get versions", "error", err)
 		versions = []database.Version{}
@@ -742,12 +989,18 @@ func (s *Server) showPackage(w http.ResponseWriter, r *http.Request, ecosystem,
 		vulns = []database.Vulnerability{}
 	}
 
+	metadata, err := s.db.GetMetadataCacheForPackage(ecosystem, name)
+	if err != nil {
+		s.logger.Error("failed to get cached metadata", "error", err)
+	}
+
 	data := PackageShowData{
 		Layout:          s.layoutFor(r),
 		Package:         pkg,
 		Versions:        versions,
 		Vulnerabilities: vulns,
 		LicenseCategory: categorizeLicense(pkg.License),
+		Metadata:        metadataFreshness(metadata, s.metadataTTL, time.Now()),
 	}
 
 	if err := s.templates.Render(w, "package_show", data); err != nil {
@@ -800,6 +1053,7 @@ func (s *Server) showVersion(w http.ResponseWriter, r *http.Request, ecosystem,
 		Artifacts:         artifacts,
 		Vulnerabilities:   vulns,
 		IsOutdated:        isOutdated,
+		Yanked:            ver.Yanked,
 		LicenseCategory:   categorizeLicense(ver.License),
 		HasCachedArtifact: hasCached,
 	}
@@ -858,6 +1112,12 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 	resp := HealthResponse{Status: "ok", Checks: map[string]HealthCheck{}}
 
+	// Bulk lookup without the ecosystems API still works, just slower, so
+	// it is reported but never fails the health check.
+	if s.bulkLookup != nil {
+		resp.Checks["bulk_lookup"] = *s.bulkLookup
+	}
+
 	// Database check (short-circuit; do not waste a storage probe call when DB is down).
 	// On DB failure the storage entry reports "skipped" rather than being omitted so
 	// the response always carries the same key set for monitors that expect it.
@@ -871,6 +1131,20 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 	resp.Checks["database"] = HealthCheck{Status: "ok"}
 
+	// The database can answer reads while writes fail. Downloads are still
+	// served uncached then, so this only fails the check when they aren't.
+	if s.cacheRecording != nil {
+		cr := HealthCheck{Status: "ok"}
+		if err := s.cacheRecording(); err != nil {
+			cr = HealthCheck{Status: "degraded", Error: err.Error()}
+			if s.cfg.Database.FailClosed {
+				cr.Status = "error"
+				resp.Status = "error"
+			}
+		}
+		resp.Checks["cache_recording"] = cr
+	}
+
 	// Storage probe (via cache).
 	if err := s.healthCache.Check(); err != nil {
 		resp.Status = "error"
@@ -886,7 +1160,11 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 	resp.Checks["storage"] = HealthCheck{Status: "ok"}
 
-	w.WriteHeader(http.StatusOK)
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
@@ -1014,3 +1292,14 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// ReadFrom passes io.Copy through to the underlying writer so file-backed
+// artifacts can still be sent with sendfile.
+func (rw *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(rw.ResponseWriter, r)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -22,11 +24,18 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// testAdminToken is the admin token newTestServer guards operator
+// endpoints with.
+const testAdminToken = "test-admin-token"
+
 type testServer struct {
 	handler http.Handler
 	db      *database.DB
 	storage storage.Storage
 	tempDir string
+
+	server    *Server
+	reconcile *reconciler
 }
 
 func newTestServer(t *testing.T) *testServer {
@@ -59,9 +68,10 @@ func newTestServer(t *testing.T) *testServer {
 	proxy := handler.NewProxy(db, store, fetcher, resolver, logger)
 
 	cfg := &config.Config{
-		BaseURL:  "http://localhost:8080",
-		Storage:  config.StorageConfig{Path: storagePath},
-		Database: config.DatabaseConfig{Path: dbPath},
+		BaseURL:   "http://localhost:8080",
+		Storage:   config.StorageConfig{Path: storagePath},
+		Database:  config.DatabaseConfig{Path: dbPath},
+		Dashboard: config.DashboardConfig{Enabled: true},
 	}
 
 	r := chi.NewRouter()
@@ -96,30 +106,30 @@ func newTestServer(t *testing.T) *testServer {
 		logger:      logger,
 		templates:   &Templates{},
 		healthCache: hc,
+		reconcile:   newReconciler(context.Background(), db, store, logger),
 	}
 
 	r.Get("/health", s.handleHealth)
 	r.Get("/stats", s.handleStats)
 	r.Get("/openapi.json", s.handleOpenAPIJSON)
-	r.Route("/ui", func(ui chi.Router) {
-		ui.Mount("/static", http.StripPrefix("/ui/static/", staticHandler()))
-		ui.Get("/", s.handleRoot)
-		ui.Get("/install", s.handleInstall)
-		ui.Get("/search", s.handleSearch)
-		ui.Get("/packages", s.handlePackagesList)
-		ui.Get("/package/{ecosystem}/*", s.handlePackagePath)
-		ui.Get("/api/browse/{ecosystem}/*", s.handleBrowsePath)
-		ui.Get("/api/compare/{ecosystem}/*", s.handleComparePath)
-	})
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/ui/", http.StatusFound)
-	})
+	r.Get("/api/openapi.json", s.handleOpenAPI3JSON)
+	admin := r.With(AdminTokenMiddleware(testAdminToken))
+	admin.Get("/api/eviction/preview", s.handleEvictionPreview)
+	admin.Get("/api/policy-events", NewAPIHandler(nil, db).HandlePolicyEvents)
+	admin.Post("/api/artifacts/pin", s.handleArtifactPin)
+	admin.Post("/api/reconcile", s.reconcile.handleReconcileStart)
+	admin.Get("/api/reconcile/{id}", s.reconcile.handleReconcileGet)
+	admin.Post("/api/pin", NewPinAPIHandler(nil, db, logger, &s.evictMu).HandlePin)
+	s.mountUI(r)
 
 	return &testServer{
 		handler: r,
 		db:      db,
 		storage: store,
 		tempDir: tempDir,
+
+		server:    s,
+		reconcile: s.reconcile,
 	}
 }
 
@@ -212,6 +222,70 @@ func TestHealthEndpoint(t *testing.T) {
 	}
 }
 
+func TestHealthEndpoint_BulkLookupDegraded(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+	ts.server.bulkLookup = &HealthCheck{Status: "degraded", Error: "ecosystems unavailable"}
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body.String())
+	}
+	var resp HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Status != "ok" {
+		t.Errorf("status = %q, want ok", resp.Status)
+	}
+	if got := resp.Checks["bulk_lookup"]; got.Status != "degraded" || got.Error != "ecosystems unavailable" {
+		t.Errorf("bulk_lookup check = %+v, want degraded with the init error", got)
+	}
+}
+
+func TestHealthEndpoint_CacheRecordingDegraded(t *testing.T) {
+	tests := []struct {
+		name       string
+		failClosed bool
+		wantCode   int
+		wantStatus string
+		wantCheck  string
+	}{
+		{"serving uncached", false, http.StatusOK, "ok", "degraded"},
+		{"fail closed", true, http.StatusServiceUnavailable, "error", "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.close()
+			ts.server.cfg.Database.FailClosed = tt.failClosed
+			ts.server.cacheRecording = func() error { return errors.New("upserting artifact: database is closed") }
+
+			req := httptest.NewRequest("GET", "/health", nil)
+			w := httptest.NewRecorder()
+			ts.handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			var resp HealthResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if got := resp.Checks["cache_recording"]; got.Status != tt.wantCheck || got.Error == "" {
+				t.Errorf("cache_recording check = %+v, want %s with the write error", got, tt.wantCheck)
+			}
+		})
+	}
+}
+
 func TestHealthEndpoint_DBFailureShortCircuits(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.close()
@@ -519,6 +593,43 @@ func TestRootRedirectsToUI(t *testing.T) {
 	}
 }
 
+func TestDashboardDisabled(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	proxy := handler.NewProxy(ts.db, ts.storage, fetch.NewFetcher(), fetch.NewResolver(), logger)
+	s := &Server{
+		cfg:       &config.Config{Dashboard: config.DashboardConfig{Enabled: false}},
+		db:        ts.db,
+		storage:   ts.storage,
+		logger:    logger,
+		templates: &Templates{},
+	}
+
+	r := chi.NewRouter()
+	r.Mount("/npm", http.StripPrefix("/npm", handler.NewNPMHandler(proxy, "http://localhost:8080").Routes()))
+	s.mountUI(r)
+
+	for _, path := range []string{"/", "/ui/", "/ui/search?q=x", "/ui/packages", "/ui/api/browse/npm/x/1.0.0", "/ui/static/style.css"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want 404", path, w.Code)
+		}
+	}
+
+	// The npm handler itself rejects an empty package name, which shows the
+	// request was routed to it rather than 404ing at the router.
+	req := httptest.NewRequest(http.MethodGet, "/npm/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid package name") {
+		t.Errorf("GET /npm/: status = %d, body = %q; want the npm handler's 400", w.Code, w.Body.String())
+	}
+}
+
 func TestDashboardWithEnrichmentStats(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.close()
@@ -590,6 +701,49 @@ func TestVersionShowWithHitCount(t *testing.T) {
 	}
 }
 
+func TestVersionShowYankedBadge(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.close()
+
+	for _, eco := range []string{"npm", "golang"} {
+		pkg := &database.Package{PURL: "pkg:" + eco + "/test", Ecosystem: eco, Name: "test"}
+		if err := ts.db.UpsertPackage(pkg); err != nil {
+			t.Fatalf("failed to upsert package: %v", err)
+		}
+		for _, v := range []string{"1.0.0", "1.0.1"} {
+			ver := &database.Version{PURL: pkg.PURL + "@" + v, PackagePURL: pkg.PURL}
+			if err := ts.db.UpsertVersion(ver); err != nil {
+				t.Fatalf("failed to upsert version: %v", err)
+			}
+		}
+		if err := ts.db.SetVersionYanked(pkg.PURL+"@1.0.0", true); err != nil {
+			t.Fatalf("SetVersionYanked: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		badge string
+		want  bool
+	}{
+		{"/ui/package/npm/test/1.0.0", ">yanked</span>", true},
+		{"/ui/package/npm/test/1.0.1", ">yanked</span>", false},
+		{"/ui/package/golang/test/1.0.0", ">retracted</span>", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.path, w.Code)
+		}
+		if got := strings.Contains(w.Body.String(), tt.badge); got != tt.want {
+			t.Errorf("%s: badge %q shown = %v, want %v", tt.path, tt.badge, got, tt.want)
+		}
+	}
+}
+
 func TestSearchWithNullValues(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.close()
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/git-pkgs/proxy/internal/config"
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/storage"
+)
+
+const (
+	// settingInstanceID names the proxy_settings row holding a random ID
+	// generated the first time the database is used.
+	settingInstanceID = "instance_id"
+	// settingStorageURL names the proxy_settings row recording the storage
+	// the database was last used with.
+	settingStorageURL = "storage_url"
+	// storageSentinelPath is the key, under storage.prefix, holding the
+	// instance ID of the database the storage was last used with. Each
+	// prefix sharing a bucket has its own.
+	storageSentinelPath = ".proxy-instance"
+)
+
+const (
+	// instanceIDBytes is the length of a generated instance ID before hex
+	// encoding.
+	instanceIDBytes = 16
+	// maxSentinelSize bounds how much of the sentinel object is read.
+	maxSentinelSize = 1 << 10
+)
+
+// checkStorageIdentity catches a database and storage that don't belong
+// together, such as a fresh database pointed at an old storage directory or
+// an old database pointed at a new bucket. Either way the database's
+// cached artifacts can't be found, or the storage's can't be used, and
+// everything is quietly fetched again.
+//
+// The database records the storage it was last used with and the storage
+// holds a sentinel naming the database's instance ID. A mismatch in either
+// is logged or, in fail mode, returned as an error. Until it is resolved
+// neither record is updated, so it is reported on every start; starting
+// with -allow-storage-change accepts the new pairing and records it.
+func checkStorageIdentity(ctx context.Context, cfg *config.Config, db *database.DB, store storage.Storage, logger *slog.Logger) error {
+	mode := cfg.ParseStorageIdentityCheck()
+	if mode == config.StorageIdentityOff {
+		return nil
+	}
+
+	instanceID, ok, err := db.GetSetting(settingInstanceID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		instanceID, err = newInstanceID()
+		if err != nil {
+			return err
+		}
+		if err := db.SetSetting(settingInstanceID, instanceID); err != nil {
+			return err
+		}
+	}
+
+	location := storageLocation(cfg)
+	sentinelPath := storage.PrefixedPath(cfg.Storage.Prefix, storageSentinelPath)
+
+	var problems []string
+	recorded, ok, err := db.GetSetting(settingStorageURL)
+	if err != nil {
+		return err
+	}
+	if ok && recorded != location {
+		problems = append(problems, fmt.Sprintf("the database was last used with storage %s, not %s", recorded, location))
+	}
+	owner, err := readStorageSentinel(ctx, store, sentinelPath)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != instanceID {
+		problems = append(problems, fmt.Sprintf("storage %s was last used by a different database (instance %s, this one is %s)", location, owner, instanceID))
+	}
+
+	if len(problems) > 0 {
+		if !cfg.Storage.AllowChange {
+			msg := "database and storage don't match: " + strings.Join(problems, "; ") +
+				". Cached artifacts will be fetched again. If the move was intentional, start once with -allow-storage-change"
+			if mode == config.StorageIdentityFail {
+				return errors.New(msg)
+			}
+			logger.Warn(msg, "storage", location, "instance_id", instanceID)
+			return nil
+		}
+		logger.Warn("storage change acknowledged, recording the new storage",
+			"storage", location, "previous", recorded, "instance_id", instanceID)
+	}
+
+	if !ok || recorded != location {
+		if err := db.SetSetting(settingStorageURL, location); err != nil {
+			return err
+		}
+	}
+	if owner != instanceID {
+		if _, _, err := store.Store(ctx, sentinelPath, strings.NewReader(instanceID)); err != nil {
+			return fmt.Errorf("writing storage sentinel: %w", err)
+		}
+	}
+	return nil
+}
+
+// storageLocation identifies the configured storage by its URL, without
+// any credentials. The prefix isn't part of it: entries recorded under an
+// old prefix are still found, so changing it doesn't lose the cache.
+func storageLocation(cfg *config.Config) string {
+	location := cfg.StorageURL()
+	if u, err := url.Parse(location); err == nil && u.User != nil {
+		u.User = nil
+		location = u.String()
+	}
+	return location
+}
+
+// readStorageSentinel returns the instance ID stored at path, or "" when
+// there is none.
+func readStorageSentinel(ctx context.Context, store storage.Storage, path string) (string, error) {
+	r, err := store.Open(ctx, path)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading storage sentinel: %w", err)
+	}
+	defer func() { _ = r.Close() }()
+	data, err := io.ReadAll(io.LimitReader(r, maxSentinelSize))
+	if err != nil {
+		return "", fmt.Errorf("reading storage sentinel: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func newInstanceID() (string, error) {
+	b := make([]byte, instanceIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating instance ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/config"
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/storage"
+)
+
+// identityCheck runs checkStorageIdentity for db against the filesystem
+// storage at dir, returning anything it logged and its error.
+func identityCheck(t *testing.T, db *database.DB, dir, mode string, allowChange bool) (string, error) {
+	t.Helper()
+	store, err := storage.NewFilesystem(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystem: %v", err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{
+		URL:           "file://" + dir,
+		IdentityCheck: mode,
+		AllowChange:   allowChange,
+	}}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	err = checkStorageIdentity(context.Background(), cfg, db, store, logger)
+	return logs.String(), err
+}
+
+func openIdentityTestDB(t *testing.T, path string) *database.DB {
+	t.Helper()
+	db, err := database.OpenOrCreate(path)
+	if err != nil {
+		t.Fatalf("OpenOrCreate: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestStorageIdentityDifferentStorageURL(t *testing.T) {
+	dir := t.TempDir()
+	oldStorage := filepath.Join(dir, "old")
+	newStorage := filepath.Join(dir, "new")
+	db := openIdentityTestDB(t, filepath.Join(dir, "proxy.db"))
+
+	if logs, err := identityCheck(t, db, oldStorage, "", false); err != nil || logs != "" {
+		t.Fatalf("first start: err %v, logs %q; want neither", err, logs)
+	}
+	if logs, err := identityCheck(t, db, oldStorage, "", false); err != nil || logs != "" {
+		t.Fatalf("restart with same storage: err %v, logs %q; want neither", err, logs)
+	}
+
+	logs, err := identityCheck(t, db, newStorage, config.StorageIdentityWarn, false)
+	if err != nil {
+		t.Fatalf("warn mode returned %v", err)
+	}
+	if !strings.Contains(logs, "level=WARN") || !strings.Contains(logs, "file://"+oldStorage) {
+		t.Errorf("warn mode logs = %q, want a warning naming the old storage", logs)
+	}
+
+	_, err = identityCheck(t, db, newStorage, config.StorageIdentityFail, false)
+	if err == nil || !strings.Contains(err.Error(), "-allow-storage-change") {
+		t.Errorf("fail mode error = %v, want a mismatch error", err)
+	}
+
+	if logs, err := identityCheck(t, db, newStorage, config.StorageIdentityOff, false); err != nil || logs != "" {
+		t.Errorf("off mode: err %v, logs %q; want neither", err, logs)
+	}
+
+	if _, err := identityCheck(t, db, newStorage, config.StorageIdentityFail, true); err != nil {
+		t.Fatalf("allow change returned %v", err)
+	}
+	if logs, err := identityCheck(t, db, newStorage, config.StorageIdentityFail, false); err != nil || logs != "" {
+		t.Errorf("start after acknowledged move: err %v, logs %q; want neither", err, logs)
+	}
+}
+
+func TestStorageIdentityFreshDatabaseOnOldStorage(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "artifacts")
+
+	first := openIdentityTestDB(t, filepath.Join(dir, "first.db"))
+	if _, err := identityCheck(t, first, store, config.StorageIdentityFail, false); err != nil {
+		t.Fatalf("first start: %v", err)
+	}
+
+	fresh := openIdentityTestDB(t, filepath.Join(dir, "fresh.db"))
+	_, err := identityCheck(t, fresh, store, config.StorageIdentityFail, false)
+	if err == nil || !strings.Contains(err.Error(), "different database") {
+		t.Errorf("fresh database on old storage: error = %v, want a mismatch error", err)
+	}
+}
@@ -29,6 +29,7 @@ func (t *Templates) load() error {
 			"supportedEcosystems": supportedEcosystems,
 			"ecosystemBadgeClass": ecosystemBadgeClasses,
 			"ecosystemBadgeLabel": ecosystemBadgeLabel,
+			"yankedLabel":         yankedLabel,
 		}
 
 		pageFiles, err := templatesFS.ReadDir("templates/pages")
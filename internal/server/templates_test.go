@@ -2,12 +2,17 @@ package server
 
 import (
 	"database/sql"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/git-pkgs/proxy/internal/config"
 	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/handler"
+	"github.com/go-chi/chi/v5"
 )
 
 func TestTemplatesRenderAllPages(t *testing.T) {
@@ -308,6 +313,41 @@ func TestInstallPage(t *testing.T) {
 	}
 }
 
+func TestInstallPageAutoBaseURL(t *testing.T) {
+	cfg := &config.Config{BaseURL: config.BaseURLAuto, Listen: ":8080", Dashboard: config.DashboardConfig{Enabled: true}}
+	proxy := handler.NewProxy(nil, nil, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := proxy.EnableBaseURLDetection([]string{"192.0.2.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{cfg: cfg, logger: slog.New(slog.NewTextHandler(io.Discard, nil)), templates: &Templates{}}
+	r := chi.NewRouter()
+	r.Use(proxy.BaseURLMiddleware)
+	s.mountUI(r)
+
+	req := httptest.NewRequest("GET", "/ui/install", nil)
+	req.RemoteAddr = "192.0.2.10:41000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "pkgs.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"registry=https://pkgs.example.com/npm/",
+		"https://pkgs.example.com/pypi/simple/",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("install page missing %q", want)
+		}
+	}
+	if strings.Contains(body, "localhost:8080") {
+		t.Error("install page used the fallback base URL despite forwarded headers")
+	}
+}
+
 func TestPackageShowPage(t *testing.T) {
 	ts := newTestServer(t)
 	defer ts.close()
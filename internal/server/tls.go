@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a certificate from disk and reloads it when the
+// certificate or key file changes, so a renewal (certbot, cert-manager) is
+// picked up on the next handshake without restarting the proxy.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	// clientCAs, when set, verifies client certificates presented during
+	// the handshake. Clients without one are still accepted.
+	clientCAs *x509.CertPool
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod fileVersion
+	keyMod  fileVersion
+}
+
+// fileVersion identifies one version of a file on disk.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func statVersion(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// newCertReloader loads the key pair once and fails if it isn't usable.
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the key pair and records which versions of the files it came
+// from. Callers hold mu, except during construction.
+func (r *certReloader) load() error {
+	certMod, err := statVersion(r.certFile)
+	if err != nil {
+		return fmt.Errorf("reading tls certificate: %w", err)
+	}
+	keyMod, err := statVersion(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("reading tls key: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading tls certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	return nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate callback. It checks the
+// files on each handshake and reloads them if either changed. If the new
+// pair doesn't load, for example because only one of the two files has been
+// replaced so far, the previous certificate keeps being served until the
+// files change again.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, certErr := statVersion(r.certFile)
+	keyMod, keyErr := statVersion(r.keyFile)
+	if certErr != nil || keyErr != nil || (certMod == r.certMod && keyMod == r.keyMod) {
+		return r.cert, nil
+	}
+
+	if err := r.load(); err != nil {
+		r.logger.Warn("tls certificate reload failed, serving previous certificate", "error", err)
+		r.certMod = certMod
+		r.keyMod = keyMod
+		return r.cert, nil
+	}
+	r.logger.Info("tls certificate reloaded", "cert_file", r.certFile)
+	return r.cert, nil
+}
+
+// tlsConfig returns the server TLS settings backed by the reloader.
+func (r *certReloader) tlsConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+	if r.clientCAs != nil {
+		cfg.ClientCAs = r.clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg
+}
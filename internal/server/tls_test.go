@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/config"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for localhost with
+// the given common name to certFile and keyFile.
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedCommonName makes a fresh TLS connection to addr and returns the
+// common name of the certificate the server presented.
+func servedCommonName(t *testing.T, addr string) string {
+	t.Helper()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			ForceAttemptHTTP2: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test certificate
+		},
+	}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		t.Fatal("response has no peer certificate")
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("negotiated %s over TLS, want HTTP/2", resp.Proto)
+	}
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestTLSServingReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile, "first")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	certs, err := newCertReloader(certFile, keyFile, logger)
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+
+	s := &Server{cfg: &config.Config{}}
+	srv := s.newHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.TLSConfig = certs.tlsConfig()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.ServeTLS(ln, "", "") }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+	addr := ln.Addr().String()
+
+	if got := servedCommonName(t, addr); got != "first" {
+		t.Fatalf("served certificate %q, want first", got)
+	}
+
+	// Renew the certificate in place. Push the modification times forward
+	// so the change is visible on filesystems with coarse timestamps.
+	writeSelfSignedCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := servedCommonName(t, addr); got != "second" {
+		t.Errorf("served certificate %q after renewal, want second", got)
+	}
+}
+
+func TestCertReloaderKeepsCertificateOnBadReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile, "first")
+
+	certs, err := newCertReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+
+	// Only the certificate has been replaced so far; it doesn't match the key.
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := certs.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("GetCertificate() = %v, %v; want previous certificate", cert, err)
+	}
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.Subject.CommonName != "first" {
+		t.Errorf("served %q, want first", leaf.Subject.CommonName)
+	}
+}
+
+func TestNewCertReloaderRejectsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), slog.Default()); err == nil {
+		t.Error("newCertReloader accepted missing files")
+	}
+}
+
+func TestCertReloaderClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile, "server")
+
+	certs, err := newCertReloader(certFile, keyFile, slog.Default())
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	if cfg := certs.tlsConfig(); cfg.ClientAuth != tls.NoClientCert {
+		t.Errorf("ClientAuth = %v without client CAs, want NoClientCert", cfg.ClientAuth)
+	}
+
+	certs.clientCAs, err = config.TLSConfig{ClientCAFile: certFile}.ClientCAs()
+	if err != nil {
+		t.Fatalf("ClientCAs() error = %v", err)
+	}
+	cfg := certs.tlsConfig()
+	if cfg.ClientAuth != tls.VerifyClientCertIfGiven || cfg.ClientCAs == nil {
+		t.Errorf("ClientAuth = %v, ClientCAs set = %v; want verified optional client certificates",
+			cfg.ClientAuth, cfg.ClientCAs != nil)
+	}
+}
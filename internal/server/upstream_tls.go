@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/git-pkgs/registries/fetch"
+	"github.com/git-pkgs/registries/safehttp"
+)
+
+// Artifact download client settings, matching the fetcher's own defaults.
+const (
+	artifactClientTimeout    = 5 * time.Minute
+	artifactHeaderTimeout    = 60 * time.Second
+	artifactIdleConnsPerHost = 10
+)
+
+// upstreamTLSConfig returns the TLS settings for connections to upstream
+// registries: the configured minimum version and, if set, cipher suites.
+func (s *Server) upstreamTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   s.cfg.ParseMinTLSVersion(),
+		CipherSuites: s.cfg.ParseTLSCipherSuites(),
+	}
+}
+
+// upstreamTransport returns the transport shared by metadata requests and
+// the calls handlers make to upstream directly, such as container registry
+// tag lists, with the upstream TLS policy applied.
+func (s *Server) upstreamTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = s.upstreamTLSConfig()
+	return t
+}
+
+// upstreamRoundTripper returns upstreamTransport, routed per host through
+// a copy that skips certificate verification for the hosts configured with
+// upstream.host_tls insecure_skip_verify.
+func (s *Server) upstreamRoundTripper() http.RoundTripper {
+	strict := s.upstreamTransport()
+	hosts := s.cfg.Upstream.InsecureHosts()
+	if len(hosts) == 0 {
+		return strict
+	}
+	insecure := strict.Clone()
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	return newInsecureHostTransport(strict, insecure, hosts)
+}
+
+// insecureHostTransport sends requests for its hosts through insecure and
+// everything else through strict. It picks per request, so a redirect off
+// an insecure host is verified again.
+type insecureHostTransport struct {
+	strict   http.RoundTripper
+	insecure http.RoundTripper
+	hosts    map[string]bool
+}
+
+func newInsecureHostTransport(strict, insecure http.RoundTripper, hosts []string) *insecureHostTransport {
+	t := &insecureHostTransport{strict: strict, insecure: insecure, hosts: make(map[string]bool, len(hosts))}
+	for _, h := range hosts {
+		t.hosts[strings.ToLower(h)] = true
+	}
+	return t
+}
+
+func (t *insecureHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.skipsVerify(req.URL.Host) {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.strict.RoundTrip(req)
+}
+
+// skipsVerify reports whether host, with or without its port, is one of
+// the insecure hosts. An entry with a port only matches that port.
+func (t *insecureHostTransport) skipsVerify(host string) bool {
+	host = strings.ToLower(host)
+	if t.hosts[host] {
+		return true
+	}
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	return t.hosts[strings.Trim(host, "[]")]
+}
+
+// fetcherOptions returns the artifact fetcher's options. Go clients already
+// refuse anything below TLS 1.2, so the fetcher keeps its own transport, with
+// its DNS cache, unless the policy is stricter than that or some hosts skip
+// certificate verification; then it gets transports carrying the policy
+// behind the same SSRF dial gate.
+func (s *Server) fetcherOptions() []fetch.Option {
+	opts := []fetch.Option{fetch.WithAuthFunc(s.authForURL)}
+	tlsConfig := s.upstreamTLSConfig()
+	insecureHosts := s.cfg.Upstream.InsecureHosts()
+	if tlsConfig.MinVersion == tls.VersionTLS12 && len(tlsConfig.CipherSuites) == 0 && len(insecureHosts) == 0 {
+		return opts
+	}
+
+	client := s.artifactClient(tlsConfig)
+	if len(insecureHosts) > 0 {
+		insecureTLS := tlsConfig.Clone()
+		insecureTLS.InsecureSkipVerify = true
+		client.Transport = newInsecureHostTransport(client.Transport, s.artifactClient(insecureTLS).Transport, insecureHosts)
+	}
+	return append(opts, fetch.WithHTTPClient(client))
+}
+
+// artifactClient returns an artifact download client using tlsConfig,
+// behind the SSRF dial gate.
+func (s *Server) artifactClient(tlsConfig *tls.Config) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	t.ResponseHeaderTimeout = artifactHeaderTimeout
+	t.MaxIdleConnsPerHost = artifactIdleConnsPerHost
+	return safehttp.New(&http.Client{Timeout: artifactClientTimeout, Transport: t}, safehttp.Options{})
+}
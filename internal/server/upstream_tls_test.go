@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-pkgs/proxy/internal/config"
+)
+
+func TestUpstreamTransportMinTLSVersion(t *testing.T) {
+	tests := []struct {
+		configured string
+		want       uint16
+	}{
+		{"", tls.VersionTLS12},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+	}
+	for _, tt := range tests {
+		cfg := config.Default()
+		cfg.Upstream.MinTLSVersion = tt.configured
+		s := &Server{cfg: cfg}
+
+		transport := s.upstreamTransport()
+		if transport.TLSClientConfig == nil {
+			t.Fatalf("min_tls_version %q: TLSClientConfig is nil", tt.configured)
+		}
+		if got := transport.TLSClientConfig.MinVersion; got != tt.want {
+			t.Errorf("min_tls_version %q: MinVersion = %x, want %x", tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamTransportCipherSuites(t *testing.T) {
+	cfg := config.Default()
+	cfg.Upstream.TLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	s := &Server{cfg: cfg}
+
+	got := s.upstreamTransport().TLSClientConfig.CipherSuites
+	if len(got) != 1 || got[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("CipherSuites = %v, want [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256]", got)
+	}
+}
+
+func TestFetcherOptionsKeepDefaultTransport(t *testing.T) {
+	s := &Server{cfg: config.Default()}
+	if n := len(s.fetcherOptions()); n != 1 {
+		t.Errorf("default policy: %d fetcher options, want only auth", n)
+	}
+
+	cfg := config.Default()
+	cfg.Upstream.MinTLSVersion = "1.3"
+	s = &Server{cfg: cfg}
+	if n := len(s.fetcherOptions()); n != 2 {
+		t.Errorf("TLS 1.3 policy: %d fetcher options, want auth and HTTP client", n)
+	}
+}
+
+func TestUpstreamRoundTripperInsecureHostOnly(t *testing.T) {
+	insecure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer insecure.Close()
+	strict := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer strict.Close()
+
+	// Both test servers are 127.0.0.1 with self-signed certificates, so the
+	// port in the key is what tells them apart.
+	cfg := config.Default()
+	cfg.Upstream.HostTLS = map[string]config.HostTLSConfig{
+		strings.TrimPrefix(insecure.URL, "https://"): {InsecureSkipVerify: true},
+	}
+	s := &Server{cfg: cfg}
+	client := &http.Client{Transport: s.upstreamRoundTripper()}
+
+	resp, err := client.Get(insecure.URL)
+	if err != nil {
+		t.Fatalf("request to insecure host: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	_, err = client.Get(strict.URL)
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		t.Errorf("request to other host = %v, want certificate verification error", err)
+	}
+
+	if s.upstreamTransport().TLSClientConfig.InsecureSkipVerify {
+		t.Error("shared transport should keep verifying certificates")
+	}
+}
+
+func TestInsecureHostTransportMatching(t *testing.T) {
+	rt := newInsecureHostTransport(nil, nil, []string{"Registry.Internal", "mirror.internal:8443", "::1"})
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"registry.internal", true},
+		{"registry.internal:443", true},
+		{"REGISTRY.INTERNAL", true},
+		{"mirror.internal:8443", true},
+		{"mirror.internal", false},
+		{"mirror.internal:443", false},
+		{"[::1]:8080", true},
+		{"registry.npmjs.org", false},
+		{"evil.registry.internal", false},
+	}
+	for _, tt := range tests {
+		if got := rt.skipsVerify(tt.host); got != tt.want {
+			t.Errorf("skipsVerify(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestFetcherOptionsInsecureHost(t *testing.T) {
+	cfg := config.Default()
+	cfg.Upstream.HostTLS = map[string]config.HostTLSConfig{
+		"registry.internal": {InsecureSkipVerify: true},
+	}
+	s := &Server{cfg: cfg}
+	if n := len(s.fetcherOptions()); n != 2 {
+		t.Errorf("insecure host: %d fetcher options, want auth and HTTP client", n)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultUsageWindow is the range /api/usage covers when from is omitted.
+const defaultUsageWindow = 30 * 24 * time.Hour
+
+// UsageResponse totals the artifacts served per team over a time range.
+type UsageResponse struct {
+	From          string            `json:"from"`
+	To            string            `json:"to"`
+	Teams         []TeamUsageResult `json:"teams"`
+	TotalRequests int64             `json:"total_requests"`
+	TotalBytes    int64             `json:"total_bytes"`
+}
+
+// TeamUsageResult is one team's share of the artifacts served. Requests
+// that named no team are reported under an empty team.
+type TeamUsageResult struct {
+	Team     string `json:"team"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// HandleUsage handles GET /api/usage
+// @Summary Artifact downloads per team
+// @Description Totals the artifact downloads recorded in the access log per team, for chargeback. Requires usage.enabled. from and to accept RFC 3339 timestamps or dates; the range includes from and excludes to. Defaults to the last 30 days.
+// @Tags api
+// @Produce json
+// @Param from query string false "Start of the range (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "End of the range, exclusive (RFC 3339 or YYYY-MM-DD, default now)"
+// @Success 200 {object} UsageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/usage [get]
+func (h *APIHandler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	to := time.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		t, ok := parseUsageTime(v)
+		if !ok {
+			badRequest(w, "to must be an RFC 3339 timestamp or YYYY-MM-DD date")
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultUsageWindow)
+	if v := q.Get("from"); v != "" {
+		t, ok := parseUsageTime(v)
+		if !ok {
+			badRequest(w, "from must be an RFC 3339 timestamp or YYYY-MM-DD date")
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		badRequest(w, "from must be before to")
+		return
+	}
+
+	usage, err := h.db.GetUsageByTeam(from, to)
+	if err != nil {
+		internalError(w, "failed to aggregate usage")
+		return
+	}
+
+	resp := &UsageResponse{
+		From:  from.Format(time.RFC3339),
+		To:    to.Format(time.RFC3339),
+		Teams: make([]TeamUsageResult, 0, len(usage)),
+	}
+	for _, u := range usage {
+		resp.Teams = append(resp.Teams, TeamUsageResult{Team: u.Team, Requests: u.Requests, Bytes: u.Bytes})
+		resp.TotalRequests += u.Requests
+		resp.TotalBytes += u.Bytes
+	}
+
+	writeJSON(w, resp)
+}
+
+// parseUsageTime accepts an RFC 3339 timestamp or a bare date, which is
+// taken as midnight UTC.
+func parseUsageTime(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), true
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
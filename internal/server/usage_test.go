@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+	"github.com/git-pkgs/proxy/internal/enrichment"
+)
+
+func TestHandleUsage(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	day := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, e := range []database.AccessLogEntry{
+		{Team: "payments", Ecosystem: "npm", PURL: "pkg:npm/lodash@4.17.21", Bytes: 100, CreatedAt: day},
+		{Team: "payments", Ecosystem: "npm", PURL: "pkg:npm/react@18.2.0", Bytes: 50, CreatedAt: day},
+		{Team: "search", Ecosystem: "pypi", PURL: "pkg:pypi/requests@2.31.0", Bytes: 400, CreatedAt: day},
+		{Team: "search", Ecosystem: "pypi", PURL: "pkg:pypi/requests@2.31.0", Bytes: 400, CreatedAt: day.AddDate(0, 0, 1)},
+	} {
+		if err := db.InsertAccessLog(&e); err != nil {
+			t.Fatalf("InsertAccessLog failed: %v", err)
+		}
+	}
+
+	h := NewAPIHandler(enrichment.New(slog.New(slog.NewTextHandler(os.Stdout, nil))), db)
+	req := httptest.NewRequest(http.MethodGet, "/api/usage?from=2025-03-10&to=2025-03-11", nil)
+	w := httptest.NewRecorder()
+	h.HandleUsage(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp UsageResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := []TeamUsageResult{
+		{Team: "search", Requests: 1, Bytes: 400},
+		{Team: "payments", Requests: 2, Bytes: 150},
+	}
+	if len(resp.Teams) != len(want) {
+		t.Fatalf("got teams %+v, want %+v", resp.Teams, want)
+	}
+	for i := range want {
+		if resp.Teams[i] != want[i] {
+			t.Errorf("teams[%d] = %+v, want %+v", i, resp.Teams[i], want[i])
+		}
+	}
+	if resp.TotalBytes != 550 || resp.TotalRequests != 3 {
+		t.Errorf("totals = %d requests, %d bytes; want 3, 550", resp.TotalRequests, resp.TotalBytes)
+	}
+	if resp.From != "2025-03-10T00:00:00Z" || resp.To != "2025-03-11T00:00:00Z" {
+		t.Errorf("range = %s..%s", resp.From, resp.To)
+	}
+}
+
+func TestHandleUsage_BadRange(t *testing.T) {
+	h := NewAPIHandler(enrichment.New(slog.New(slog.NewTextHandler(os.Stdout, nil))), nil)
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2025-13-01",
+		"from=2025-03-11&to=2025-03-10",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/usage?"+query, nil)
+		w := httptest.NewRecorder()
+		h.HandleUsage(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+// vacuumIdleRetry is how often a due vacuum checks again for a quiet moment
+// while requests are in flight.
+const vacuumIdleRetry = time.Minute
+
+// startDatabaseVacuum periodically returns free SQLite pages to the
+// filesystem. Each run waits until no requests are in flight so the
+// single database connection isn't taken from a download.
+func (s *Server) startDatabaseVacuum(ctx context.Context) {
+	interval := s.cfg.ParseDatabaseVacuumInterval()
+	if interval <= 0 || s.db.Dialect() == database.DialectPostgres {
+		return
+	}
+
+	s.logger.Info("database vacuum enabled", "interval", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !s.waitForIdle(ctx, vacuumIdleRetry) {
+					return
+				}
+				s.vacuumDatabase(ctx)
+			}
+		}
+	}()
+}
+
+// waitForIdle blocks until no requests are in flight, checking every poll.
+// It returns false if ctx is done first.
+func (s *Server) waitForIdle(ctx context.Context, poll time.Duration) bool {
+	for s.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(poll):
+		}
+	}
+	return ctx.Err() == nil
+}
+
+func (s *Server) vacuumDatabase(ctx context.Context) {
+	start := time.Now()
+	result, err := s.db.Vacuum(ctx, false)
+	switch {
+	case errors.Is(err, database.ErrVacuumNeedsFull):
+		s.logger.Warn("database vacuum skipped: run 'proxy vacuum' once to enable incremental vacuuming")
+	case err != nil:
+		s.logger.Warn("database vacuum failed", "error", err)
+	default:
+		s.logger.Info("database vacuum completed",
+			"free_pages", result.FreePages,
+			"reclaimed_bytes", result.ReclaimedBytes(),
+			"duration", time.Since(start))
+	}
+}
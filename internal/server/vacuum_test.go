@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-pkgs/proxy/internal/database"
+)
+
+func TestWaitForIdle(t *testing.T) {
+	s := &Server{}
+	s.inFlight.Add(1)
+
+	done := make(chan bool, 1)
+	go func() { done <- s.waitForIdle(context.Background(), time.Millisecond) }()
+
+	select {
+	case <-done:
+		t.Fatal("waitForIdle returned while a request was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.inFlight.Add(-1)
+	select {
+	case idle := <-done:
+		if !idle {
+			t.Error("waitForIdle() = false, want true once idle")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitForIdle did not return after requests finished")
+	}
+}
+
+func TestWaitForIdle_Cancelled(t *testing.T) {
+	s := &Server{}
+	s.inFlight.Add(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s.waitForIdle(ctx, time.Millisecond) {
+		t.Error("waitForIdle() = true, want false for a cancelled context")
+	}
+}
+
+func TestVacuumDatabase(t *testing.T) {
+	db, err := database.Create(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	s := &Server{db: db, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	s.vacuumDatabase(context.Background())
+
+	if _, err := db.GetCachedArtifactCount(); err != nil {
+		t.Errorf("database not queryable after vacuum: %v", err)
+	}
+}
@@ -42,6 +42,8 @@ func (fs *Filesystem) fullPath(path string) (string, error) {
 }
 
 func (fs *Filesystem) prefixPath(prefix string) (string, error) {
+	// Prefixes name directories here, so "npm/" and "npm" are the same.
+	prefix = strings.TrimSuffix(prefix, "/")
 	if prefix == "" {
 		return fs.root, nil
 	}
@@ -15,7 +15,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"io"
+	"path"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const dirPermissions = 0755
@@ -71,16 +75,134 @@ type Storage interface {
 	Close() error
 }
 
+// PrefixedPath returns path inside the namespace prefix, so several proxy
+// instances can share one bucket without their keys colliding. Leading and
+// trailing slashes on prefix are ignored; an empty prefix returns path
+// unchanged.
+func PrefixedPath(prefix, path string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return path
+	}
+	return prefix + "/" + path
+}
+
 // ArtifactPath builds a storage path for an artifact.
 // Format: {ecosystem}/{namespace}/{name}/{version}/{filename}
 // For packages without namespace: {ecosystem}/{name}/{version}/{filename}
+// The filename is passed through SanitizeFilename with
+// DefaultMaxFilenameLength.
 func ArtifactPath(ecosystem, namespace, name, version, filename string) string {
+	return ArtifactPathLimited(ecosystem, namespace, name, version, filename, DefaultMaxFilenameLength)
+}
+
+// ArtifactPathLimited is ArtifactPath with the filename capped at
+// maxFilenameLength bytes instead of the default.
+func ArtifactPathLimited(ecosystem, namespace, name, version, filename string, maxFilenameLength int) string {
+	filename = SanitizeFilename(filename, maxFilenameLength)
 	if namespace != "" {
 		return ecosystem + "/" + namespace + "/" + name + "/" + version + "/" + filename
 	}
 	return ecosystem + "/" + name + "/" + version + "/" + filename
 }
 
+const (
+	// DefaultMaxFilenameLength is the filename length cap used by
+	// ArtifactPath. It leaves room under the 255-byte name limit of most
+	// filesystems.
+	DefaultMaxFilenameLength = 200
+
+	// MinMaxFilenameLength is the smallest cap SanitizeFilename honours,
+	// enough for the hash suffix plus a readable stem and extension.
+	MinMaxFilenameLength = 64
+
+	// filenameHashLength is how many hex digits of the original name's
+	// SHA-256 are kept in the suffix of a rewritten filename.
+	filenameHashLength = 16
+
+	// maxFilenameExtLength bounds how much of a rewritten filename is kept
+	// as its extension.
+	maxFilenameExtLength = 16
+)
+
+// SanitizeFilename returns filename in a form that is safe as the last
+// segment of a storage key. Names made of letters, digits and ._-+~@=,:!
+// that fit in maxLength bytes are returned unchanged. Otherwise any query
+// string or fragment is dropped, other characters become underscores, the
+// stem is truncated to fit, and a hash of the original name is added before
+// the extension, so distinct names keep distinct keys and the same name
+// always maps to the same key. A maxLength of zero means
+// DefaultMaxFilenameLength.
+func SanitizeFilename(filename string, maxLength int) string {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxFilenameLength
+	}
+	maxLength = max(maxLength, MinMaxFilenameLength)
+
+	clean := cleanFilename(filename)
+	if clean == filename && len(clean) <= maxLength && strings.Trim(clean, ".") != "" {
+		return filename
+	}
+
+	sum := sha256.Sum256([]byte(filename))
+	suffix := "-" + hex.EncodeToString(sum[:])[:filenameHashLength]
+
+	ext := filenameExt(clean)
+	stem := strings.TrimSuffix(clean, ext)
+	if room := maxLength - len(suffix) - len(ext); len(stem) > room {
+		stem = truncateUTF8(stem, room)
+	}
+	if strings.Trim(stem, ".") == "" {
+		stem = "artifact"
+	}
+	return stem + suffix + ext
+}
+
+// cleanFilename drops any query string or fragment from name and replaces
+// every character outside the allowed set with an underscore.
+func cleanFilename(name string) string {
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			return r
+		case strings.ContainsRune("._-+~@=,:!", r):
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// filenameExt returns the extension kept when a filename is rewritten,
+// including compound tar extensions such as ".tar.gz".
+func filenameExt(name string) string {
+	ext := path.Ext(name)
+	if ext == name || len(ext) < 2 || len(ext) > maxFilenameExtLength {
+		return ""
+	}
+	if inner := path.Ext(strings.TrimSuffix(name, ext)); inner == ".tar" {
+		ext = inner + ext
+	}
+	return ext
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 // HashingReader wraps a reader and computes SHA256 hash as content is read.
 type HashingReader struct {
 	r    io.Reader
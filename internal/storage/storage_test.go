@@ -8,6 +8,7 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestArtifactPath(t *testing.T) {
@@ -35,6 +36,118 @@ func TestArtifactPath(t *testing.T) {
 	}
 }
 
+func TestPrefixedPath(t *testing.T) {
+	tests := []struct {
+		prefix string
+		path   string
+		want   string
+	}{
+		{"", "npm/lodash/4.17.21/lodash-4.17.21.tgz", "npm/lodash/4.17.21/lodash-4.17.21.tgz"},
+		{"prod", "npm/lodash/4.17.21/lodash-4.17.21.tgz", "prod/npm/lodash/4.17.21/lodash-4.17.21.tgz"},
+		{"/tenants/prod/", "_metadata/npm/lodash/metadata", "tenants/prod/_metadata/npm/lodash/metadata"},
+		{"/", "npm/x", "npm/x"},
+		{"prod", "", "prod/"},
+	}
+
+	for _, tt := range tests {
+		if got := PrefixedPath(tt.prefix, tt.path); got != tt.want {
+			t.Errorf("PrefixedPath(%q, %q) = %q, want %q", tt.prefix, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 300) + ".tar.gz"
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{"too long", long},
+		{"query string", "requests-2.31.0.tar.gz?download=1&token=abc"},
+		{"fragment", "requests-2.31.0-py3-none-any.whl#sha256=deadbeef"},
+		{"percent encoded", "foo%2Fbar%20baz-1.0.whl"},
+		{"slashes", "../../etc/passwd"},
+		{"backslashes", `..\..\windows\win.ini`},
+		{"control characters", "evil\x00name\n.tgz"},
+		{"dots only", ".."},
+		{"empty", ""},
+		{"long multibyte", strings.Repeat("ü", 200) + ".zip"},
+	}
+
+	seen := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeFilename(tt.filename, DefaultMaxFilenameLength)
+			if got == tt.filename {
+				t.Fatalf("SanitizeFilename(%q) left the name unchanged", tt.filename)
+			}
+			if len(got) > DefaultMaxFilenameLength {
+				t.Errorf("len = %d, want <= %d", len(got), DefaultMaxFilenameLength)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("%q is not valid UTF-8", got)
+			}
+			if strings.ContainsAny(got, "/\\?#% \x00\n") || strings.Trim(got, ".") == "" {
+				t.Errorf("%q is not a safe storage key segment", got)
+			}
+			if again := SanitizeFilename(tt.filename, DefaultMaxFilenameLength); again != got {
+				t.Errorf("not stable: %q then %q", got, again)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("%q and %q both map to %q", other, tt.filename, got)
+			}
+			seen[got] = tt.filename
+		})
+	}
+
+	if got := SanitizeFilename(long, DefaultMaxFilenameLength); !strings.HasSuffix(got, ".tar.gz") {
+		t.Errorf("truncated name %q lost its .tar.gz extension", got)
+	}
+	if got := SanitizeFilename("requests-2.31.0.tar.gz?x=1", 0); !strings.HasPrefix(got, "requests-2.31.0-") || !strings.HasSuffix(got, ".tar.gz") {
+		t.Errorf("query string name = %q, want requests-2.31.0-<hash>.tar.gz", got)
+	}
+}
+
+func TestSanitizeFilenameKeepsOrdinaryNames(t *testing.T) {
+	for _, name := range []string{
+		"lodash-4.17.21.tgz",
+		"requests-2.31.0-py3-none-any.whl",
+		"sha256:6d3f1c2a9b8e7f0a1b2c3d4e5f60718293a4b5c6d7e8f90123456789abcdef0",
+		"serde-1.0.0+build.1.crate",
+		"v1.2.3.zip",
+		"münchen-1.0.tar.gz",
+		strings.Repeat("a", DefaultMaxFilenameLength),
+	} {
+		if got := SanitizeFilename(name, DefaultMaxFilenameLength); got != name {
+			t.Errorf("SanitizeFilename(%q) = %q, want unchanged", name, got)
+		}
+	}
+}
+
+func TestSanitizeFilenameLengthCap(t *testing.T) {
+	a := strings.Repeat("x", 150) + "-a.whl"
+	b := strings.Repeat("x", 150) + "-b.whl"
+
+	gotA, gotB := SanitizeFilename(a, 100), SanitizeFilename(b, 100)
+	if len(gotA) > 100 || len(gotB) > 100 {
+		t.Errorf("lengths = %d, %d; want <= 100", len(gotA), len(gotB))
+	}
+	if gotA == gotB {
+		t.Errorf("names differing only past the cap share key %q", gotA)
+	}
+	if SanitizeFilename(a, DefaultMaxFilenameLength) != a {
+		t.Error("name within the default cap should be unchanged")
+	}
+	if got := SanitizeFilename(a, 10); len(got) > MinMaxFilenameLength {
+		t.Errorf("cap below the minimum: len = %d, want <= %d", len(got), MinMaxFilenameLength)
+	}
+
+	path := ArtifactPathLimited("pypi", "", "pkg", "1.0", a, 100)
+	if want := "pypi/pkg/1.0/" + gotA; path != want {
+		t.Errorf("ArtifactPathLimited = %q, want %q", path, want)
+	}
+}
+
 func TestHashingReader(t *testing.T) {
 	content := "hello world"
 	r := NewHashingReader(strings.NewReader(content))